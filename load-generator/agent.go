@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"load-generator/internal/cluster"
+	"load-generator/internal/grpc"
+)
+
+func runAgent(args []string) {
+	fs := newFlagSet("agent", "Execute the share of a distributed run the coordinator assigns and report the results back to it.\nThe agent waits for the coordinator to start and for all other agents to register.")
+	coordinatorAddr := fs.String("coordinator", "localhost:7070", "host:port of the coordinator")
+	hostname := fs.String("hostname", "", "Name of the agent in the coordinator's summary, defaults to the host name")
+	wait := fs.Duration("wait", time.Minute, "How long to retry connecting to an unreachable coordinator")
+	dir := fs.String("results-dir", "./results", "Directory the agent's run writes its artifacts to, in the subdirectory agent<N>_<runId>")
+	fs.Parse(args)
+
+	logger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	if *hostname == "" {
+		*hostname, _ = os.Hostname()
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		logger.Error("Unable to locate the load-generator executable", "error", err)
+		os.Exit(exitFailure)
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	client := cluster.NewClient(*coordinatorAddr)
+	var assignment cluster.Assignment
+	err = retryUnavailable(ctx, *wait, func() error {
+		assignment, err = client.Register(ctx, cluster.RegisterRequest{Hostname: *hostname})
+		return err
+	})
+	if err != nil {
+		logger.Error("Unable to register at the coordinator", "coordinator", *coordinatorAddr, "error", err)
+		os.Exit(exitConnection)
+	}
+
+	runID = assignment.RunID
+	logger = logger.With("runId", runID)
+	agentDir := filepath.Join(*dir, fmt.Sprintf("agent%d_%s", assignment.AgentIndex+1, runID))
+	logger.Info("Starting assigned run", "agent", assignment.AgentIndex+1, "agents", assignment.NumAgents,
+		"mode", assignment.Command, "args", assignment.Args, "resultsDir", agentDir)
+	// a later -results-dir takes precedence over one given to the coordinator
+	exitCode := runChildCommand(ctx, executable, assignment.Command, append(assignment.Args, "-results-dir="+agentDir))
+
+	report := cluster.AgentReport{AgentIndex: assignment.AgentIndex, Hostname: *hostname, ExitCode: exitCode}
+	report.ResultsFilename = findRunArtifact(agentDir, "results", assignment.Command, "csv")
+	if filename := findRunArtifact(agentDir, "summary", assignment.Command, "json"); filename != "" {
+		if report.SummaryJSON, err = os.ReadFile(filename); err != nil {
+			logger.Warn("Unable to read summary", "filename", filename, "error", err)
+		}
+	}
+
+	// the report is delivered even if the agent was interrupted, the coordinator waits for it
+	reportCtx, cancel := context.WithTimeout(context.Background(), *wait)
+	defer cancel()
+	err = retryUnavailable(reportCtx, *wait, func() error {
+		// the results are streamed from the file, which is reopened for every attempt
+		if report.ResultsFilename == "" {
+			return client.Report(reportCtx, report, nil)
+		}
+		f, err := os.Open(report.ResultsFilename)
+		if err != nil {
+			logger.Warn("Unable to read results", "filename", report.ResultsFilename, "error", err)
+			return client.Report(reportCtx, report, nil)
+		}
+		defer f.Close()
+		return client.Report(reportCtx, report, f)
+	})
+	if err != nil {
+		logger.Error("Unable to report the results to the coordinator", "coordinator", *coordinatorAddr, "error", err)
+		os.Exit(exitConnection)
+	}
+	logger.Info("Reported results to the coordinator", "exitCode", exitCode, "resultsFile", report.ResultsFilename)
+	if exitCode != 0 {
+		os.Exit(exitCode)
+	}
+}
+
+// retryUnavailable calls fn until it doesn't fail with an unreachable coordinator or wait passed
+func retryUnavailable(ctx context.Context, wait time.Duration, fn func() error) error {
+	deadline := time.Now().Add(wait)
+	for {
+		err := fn()
+		if grpc.Code(err) != grpc.CodeUnavailable || time.Now().After(deadline) {
+			return err
+		}
+		logger.Info("Coordinator unreachable, retrying", "error", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+// findRunArtifact returns the newest artifact of the kind, e.g. results, the run wrote into dir
+func findRunArtifact(dir, kind, mode, ext string) string {
+	matches, _ := filepath.Glob(filepath.Join(dir, fmt.Sprintf("%s_%s_*%s.%s", kind, mode, runID, ext)))
+	if len(matches) == 0 {
+		return ""
+	}
+	return matches[len(matches)-1]
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"load-generator/internal/targets"
+	"load-generator/internal/workload"
+)
+
+func runAudit(args []string) {
+	fs := newFlagSet("audit", "Look up the event_id of every event of the trips file in the database in chunks and write the missing events to the audit file,\n"+
+		"a trips CSV with the core columns, so exactly the lost events of a failure-heavy run can be inserted again with insert -trips.\n"+
+		"The command fails with exit code 5 if events are missing.")
+	var common commonOptions
+	common.register(fs)
+	tripsPath := fs.String("trips", "../escooter-trips-generator/output/escooter-trips-small.csv", "Path or https:// or s3:// URL of a CSV file containing the escooter trip events")
+	chunkSize := fs.Int("chunk-size", 10000, "Number of event IDs looked up per query")
+	var tenants tenantOptions
+	tenants.register(fs)
+	fs.Parse(args)
+
+	ctx, stop := signalContext()
+	defer stop()
+	common.setup("audit", 0)
+	defer common.close()
+	dbTarget := common.dbTarget
+	tenancy = tenants.mustLoad(dbTarget, common.schemaVariant)
+	if *chunkSize < 1 {
+		logger.Error("Invalid CLI argument", "argument", "chunk-size", "error", "expected at least one event ID per query")
+		os.Exit(exitConfig)
+	}
+	if common.dryRun {
+		logger.Error("Invalid CLI argument", "argument", "dry-run", "error", "the audit only reads from the database, it has no statements to print")
+		os.Exit(exitConfig)
+	}
+
+	logger.Info("Starting load-generator with following cli arguments",
+		"mode", "audit",
+		"log", common.logLevel,
+		"db", dbTarget.String(),
+		"trips", *tripsPath,
+		"chunkSize", *chunkSize,
+		"tenants", tenants.tenants,
+	)
+
+	conn, err := pgx.Connect(ctx, common.connString)
+	if err != nil {
+		logger.Error("Unable to connect to database", "error", err)
+		os.Exit(exitConnection)
+	}
+	defer conn.Close(context.Background())
+	for _, tenant := range tenancy.SchemaTenants() {
+		if err := targets.RefreshEvents(ctx, conn, dbTarget, tenant); err != nil {
+			logger.Error("Unable to audit the events", "error", err)
+			os.Exit(exitFailure)
+		}
+	}
+
+	r, err := workload.OpenTripEvents(*tripsPath)
+	if err != nil {
+		logger.Error("Unable to open the trips file", "trips", *tripsPath, "error", err)
+		os.Exit(exitConfig)
+	}
+	defer r.Close()
+
+	file := createArtifactCSV("audit", "missing", "events", dbTarget.String())
+	filename := file.Name()
+	defer file.Close()
+	csvWriter := csv.NewWriter(file)
+	if err := csvWriter.Write([]string{"event_id", "trip_id", "timestamp", "latitude", "longitude"}); err != nil {
+		logger.Error("Failed to write audit CSV header", "error", err)
+		os.Exit(exitFailure)
+	}
+
+	audited, missing, lookups := 0, 0, 0
+	startTime := time.Now()
+	// the chunks are looked up per events table, CrateDB's tenants have one each
+	chunks := make(map[int][]workload.TripEvent)
+	lookUp := func(tenant int) {
+		chunk := chunks[tenant]
+		ids := make([]string, len(chunk))
+		for i, event := range chunk {
+			ids[i] = event.EventID
+		}
+		stored, err := targets.StoredEventIDs(ctx, conn, dbTarget, tenant, ids)
+		if err != nil {
+			logger.Error("Unable to audit the events", "error", err)
+			os.Exit(exitFailure)
+		}
+		for _, event := range chunk {
+			if stored[event.EventID] {
+				continue
+			}
+			missing++
+			if err := csvWriter.Write([]string{event.EventID, event.TripID, event.Timestamp, event.Latitude, event.Longitude}); err != nil {
+				logger.Error("Failed to write audit CSV record", "error", err)
+				os.Exit(exitFailure)
+			}
+		}
+		audited += len(chunk)
+		chunks[tenant] = chunk[:0]
+		lookups++
+		logger.Debug("Audited chunk of events", "tenant", tenant, "audited", audited, "missing", missing)
+		if lookups%100 == 0 {
+			logger.Info("Audit progress", "audited", audited, "missing", missing, "timeElapsedInSec", time.Since(startTime).Seconds())
+		}
+	}
+	for {
+		if ctx.Err() != nil {
+			logger.Warn("Audit interrupted, the audit file lists only the missing events of the events audited before", "audited", audited)
+			break
+		}
+		event, err := r.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			logger.Error("Unable to read the trips file", "trips", *tripsPath, "error", err)
+			os.Exit(exitConfig)
+		}
+		tenant := 0
+		if dbTarget == targets.CrateDB {
+			tenant = tenancy.TripTenant(event.TripID)
+		}
+		chunks[tenant] = append(chunks[tenant], event)
+		if len(chunks[tenant]) == *chunkSize {
+			lookUp(tenant)
+		}
+	}
+	if ctx.Err() == nil {
+		for tenant, chunk := range chunks {
+			if len(chunk) > 0 {
+				lookUp(tenant)
+			}
+		}
+	}
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		logger.Error("Failed to write audit CSV file", "filename", filename, "error", err)
+		os.Exit(exitFailure)
+	}
+
+	if missing > 0 {
+		logger.Error("Events of the trips file are missing in the database", "audited", audited, "missing", missing, "filename", filename)
+		os.Exit(exitAssertion)
+	}
+	if ctx.Err() != nil {
+		os.Exit(exitAborted)
+	}
+	logger.Info("All events of the trips file are stored", "audited", audited)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"os"
+	"strconv"
+	"sync"
+
+	"load-generator/internal/targets"
+	"load-generator/internal/workload"
+)
+
+// BadRowReport counts the malformed rows of the trips file skipped by -on-bad-row
+type BadRowReport struct {
+	Policy         string `json:"policy"`
+	Rows           int    `json:"rows"`
+	DeadLetterFile string `json:"deadLetterFile,omitempty"`
+}
+
+// badRowOptions is the flag of insert deciding what happens to malformed rows of the trips file
+type badRowOptions struct {
+	policy string
+}
+
+func (o *badRowOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.policy, "on-bad-row", workload.BadRowFail, "What to do with a row of -trips that can't be parsed or has an empty ID, an unparseable timestamp or coordinates out of range:\n"+
+		"fail aborts the run, skip logs its line and the reason and continues, deadletter additionally writes it to the deadletter file")
+}
+
+// BadRows skips the malformed rows of the trips file and writes them to the dead-letter file.
+// All methods are no-ops on a nil BadRows, malformed rows then abort the run.
+type BadRows struct {
+	policy   string
+	filename string
+
+	mu        sync.Mutex
+	rows      int
+	file      *os.File
+	csvWriter *csv.Writer
+}
+
+var badRows *BadRows
+
+// mustLoad validates -on-bad-row, nil with fail
+func (o *badRowOptions) mustLoad(dbTarget targets.DBTarget, numWorkers int) *BadRows {
+	policy, err := workload.ParseBadRowPolicy(o.policy)
+	if err != nil {
+		logger.Error("Invalid CLI argument", "argument", "on-bad-row", "error", err)
+		os.Exit(exitConfig)
+	}
+	if policy == workload.BadRowFail {
+		return nil
+	}
+	b := &BadRows{policy: policy}
+	if policy == workload.BadRowDeadLetter {
+		b.file = createArtifactCSV("deadletter", "insert", dbTarget.String(), workersPart(numWorkers))
+		b.filename = b.file.Name()
+		b.csvWriter = csv.NewWriter(b.file)
+		if err := b.csvWriter.Write([]string{"runId", "line", "reason", "row"}); err != nil {
+			logger.Error("Failed to write dead-letter CSV header", "error", err)
+			os.Exit(exitFailure)
+		}
+	}
+	return b
+}
+
+// Skip reports whether err is a malformed row which was skipped
+func (b *BadRows) Skip(err error) bool {
+	var badRow *workload.BadRowError
+	if b == nil || !errors.As(err, &badRow) {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rows++
+	logger.Warn("Skipping malformed trip event", "line", badRow.Line, "reason", badRow.Reason, "policy", b.policy)
+	if b.csvWriter != nil {
+		var row bytes.Buffer
+		w := csv.NewWriter(&row)
+		w.Write(badRow.Record)
+		w.Flush()
+		record := []string{runID, strconv.Itoa(badRow.Line), badRow.Reason, string(bytes.TrimRight(row.Bytes(), "\n"))}
+		if err := b.csvWriter.Write(record); err != nil {
+			logger.Error("Failed to write dead-letter CSV record", "error", err)
+		}
+	}
+	return true
+}
+
+// Close closes the dead-letter file and returns the report, nil with fail
+func (b *BadRows) Close() *BadRowReport {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.csvWriter != nil {
+		b.csvWriter.Flush()
+		if err := b.csvWriter.Error(); err != nil {
+			logger.Error("Failed to write dead-letter CSV file", "filename", b.filename, "error", err)
+		}
+		b.file.Close()
+		b.csvWriter = nil
+	}
+	if b.rows > 0 {
+		logger.Warn("Skipped malformed trip events", "rows", b.rows, "policy", b.policy, "deadLetterFile", b.filename)
+	}
+	return &BadRowReport{Policy: b.policy, Rows: b.rows, DeadLetterFile: b.filename}
+}
@@ -2,414 +2,244 @@ package main
 
 import (
 	"context"
-	"encoding/csv"
 	"fmt"
-	"io"
-	"os"
-	"sync"
+	"log/slog"
 	"time"
 
 	"github.com/jackc/pgx/v5"
+
+	"load-generator/internal/benchmark"
+	"load-generator/internal/results"
+	"load-generator/internal/targets"
+	"load-generator/internal/workload"
 )
 
-type InsertEvent struct {
-	WorkerID             int
-	JobType              string
-	BatchSize            int
-	UseBulkInsert        bool
-	StartTime            string
-	EndTime              string
-	InsertDurationMs     int64
-	WaitedForJobTimeMs   int64
-	SuccessfullyInserted int
-	FailedInserts        int
-}
+func benchmarkInserts(ctx context.Context, connString string, api *restTarget, numWorkers int, drainTimeout time.Duration, batchSize int, useBulkInsert bool, rate float64, dbTarget targets.DBTarget, tripsSource string, attributes []workload.EventAttribute, csvWriter *results.CSVWriter) (RunSummary, error) {
+	logger.Info("Starting Insert Benchmark", "dbConnString", redactConnString(connString), "numWorkers", numWorkers, "dbTarget", dbTarget.String(), "trips", tripsSource, "rate", rate)
+	aborted := RunSummary{Mode: "insert", DBTarget: dbTarget.String(), NumWorkers: numWorkers, Aborted: true}
 
-func benchmarkInserts(ctx context.Context, connString string, numWorkers int, batchSize int, useBulkInsert bool, dbTarget DBTarget, tripsFilename string, csvWriter *csv.Writer) {
-	logger.Info("Starting Insert Benchmark", "dbConnString", connString, "numWorkers", numWorkers, "dbTarget", dbTarget.String(), "tripsFilename", tripsFilename)
-	// create specified number of workers
-	var wg sync.WaitGroup
-	readyStatus := make(chan int, numWorkers)
-	jobs := make(chan []TripEvent, numWorkers*2) // batches of events
-	successCh := make(chan int, numWorkers)
-	failureCh := make(chan int, numWorkers)
-	eventCh := make(chan InsertEvent, numWorkers*10)
-	for i := 1; i <= numWorkers; i++ {
-		wg.Add(1)
-		go func(id int) {
-			insertWorker(ctx, id, jobs, connString, dbTarget, useBulkInsert, successCh, failureCh, eventCh, readyStatus)
-			wg.Done()
-		}(i)
+	// workers of a REST API target send HTTP requests instead
+	var target benchmark.InsertTarget = &dbInsertTarget{connString: connString, dbTarget: dbTarget, useBulkInsert: useBulkInsert}
+	if api != nil {
+		logger.Info("Sending the inserts to the REST API instead of the database", "api", api.String())
+		target = apiInsertTarget{api}
 	}
-	logger.Info("Started worker threads", "numWorkers", numWorkers)
 
-	// Write CSV header
-	csvHeader := []string{"workerId", "jobType", "batchSize", "useBulkInsert", "startTime", "endTime", "insertDurationMs", "waitedForJobTimeMs", "successfullyInserted", "failedInserts"}
-	if err := csvWriter.Write(csvHeader); err != nil {
-		logger.Error("Failed to write CSV header", "error", err)
-		os.Exit(1)
+	// Write CSV header, the aggregator wrote its own
+	if err := writeCSVHeaderUnlessAggregated(csvWriter, insertCSVHeader()); err != nil {
+		return aborted, fmt.Errorf("Writing CSV header: %w", err)
 	}
 
-	// Start CSV writer goroutine
-	var csvWg sync.WaitGroup
-	csvWg.Add(1)
-	go func() {
-		defer csvWg.Done()
-		for event := range eventCh {
-			// Log the event (replacing worker logging)
-			logger.Debug("Worker finished batch insert",
-				"workerId", event.WorkerID,
-				"jobType", event.JobType,
-				"batchSize", event.BatchSize,
-				"useBulkInsert", event.UseBulkInsert,
-				"startTime", event.StartTime,
-				"endTime", event.EndTime,
-				"insertDurationMs", event.InsertDurationMs,
-				"waitedForJobTimeMs", event.WaitedForJobTimeMs,
-				"successfullyInserted", event.SuccessfullyInserted,
-			)
-
-			// Write to CSV
-			record := []string{
-				fmt.Sprintf("%d", event.WorkerID),
-				event.JobType,
-				fmt.Sprintf("%d", event.BatchSize),
-				fmt.Sprintf("%t", event.UseBulkInsert),
-				event.StartTime,
-				event.EndTime,
-				fmt.Sprintf("%d", event.InsertDurationMs),
-				fmt.Sprintf("%d", event.WaitedForJobTimeMs),
-				fmt.Sprintf("%d", event.SuccessfullyInserted),
-				fmt.Sprintf("%d", event.FailedInserts),
-			}
-			if err := csvWriter.Write(record); err != nil {
-				logger.Error("Failed to write CSV record", "error", err)
-			}
-		}
-	}()
-
-	// Wait for all workers to signal ready
-	workersReady := 0
-Waiting4Workers:
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case readyWorkerId := <-readyStatus:
-			logger.Debug("Worker reported ready", "id", readyWorkerId)
-			workersReady += 1
-			if workersReady == numWorkers {
-				break Waiting4Workers
-			}
-		}
+	cfg := benchmark.InsertConfig{
+		Config:        benchmark.Config{NumWorkers: numWorkers, DrainTimeout: drainTimeout, Control: runControl, Logger: logger},
+		BatchSize:     batchSize,
+		UseBulkInsert: useBulkInsert,
+		Rate:          rate,
+		Target:        target,
+		OpenSource: func(ctx context.Context) (workload.TripEventSource, error) {
+			return openTripSource(ctx, tripsSource, attributes)
+		},
+		SkipRow: badRows.Skip,
+		Tenant:  tenancy.TripTenant,
+		Record:  func(event results.InsertEvent) { recordInsertEvent(ctx, csvWriter, event) },
 	}
-
-	// open the csv file
-	f, err := os.Open(tripsFilename)
+	// every worker writes its shard and records its events itself, the recording is safe for concurrent use without aggregates
+	cfg.RecordInWorkers = resultShards != nil
+	result, err := benchmark.Inserts(ctx, cfg)
 	if err != nil {
-		logger.Error("Error opening file", "error", err, "filename", tripsFilename)
-		os.Exit(1)
+		return aborted, err
 	}
-	defer f.Close()
-	r := csv.NewReader(f)
 
-	// read header of csv
-	if _, err := r.Read(); err != nil {
-		logger.Error("Error in read pois header", "error", err)
-		os.Exit(1)
+	summary := RunSummary{
+		Mode:            "insert",
+		DBTarget:        dbTarget.String(),
+		NumWorkers:      numWorkers,
+		StartTime:       result.StartTime,
+		EndTime:         result.EndTime,
+		DurationSec:     result.EndTime.Sub(result.StartTime).Seconds(),
+		TotalOperations: result.Operations,
+		TotalSuccesses:  result.Successes,
+		TotalFailures:   result.Failures,
+		Aborted:         result.Aborted,
 	}
-
-	// read the trips csv and send batches to workers
-	startTime := time.Now()
-	tripEventsCount := 0
-	batch := make([]TripEvent, 0, batchSize)
-
-	for {
-		rec, err := r.Read()
-		if err == io.EOF {
-			// Send remaining batch if not empty
-			if len(batch) > 0 {
-				select {
-				case <-ctx.Done():
-					return
-				case jobs <- batch:
-				}
-			}
-			break
-		} else if err != nil {
-			logger.Error("Error in read of trips csv", "error", err)
-			os.Exit(1)
-		}
-
-		tripEvent := TripEvent{
-			EventID:   rec[0],
-			TripID:    rec[1],
-			Timestamp: rec[2],
-			Latitude:  rec[3],
-			Longitude: rec[4],
-		}
-
-		batch = append(batch, tripEvent)
-		tripEventsCount++
-
-		// Send batch when full
-		if len(batch) >= batchSize {
-			select {
-			case <-ctx.Done():
-				return
-			case jobs <- batch:
-			}
-			batch = make([]TripEvent, 0, batchSize)
-		}
-
-		if tripEventsCount%10000 == 0 {
-			logger.Info("Insert progress", "totalInsertedToJobQueue", tripEventsCount, "timeElapsedInSec", time.Since(startTime).Seconds())
-		}
+	if summary.Aborted {
+		// the trips table is not created from partially inserted events
+		return summary, nil
 	}
+	logger.Info("All escooter trip events added", "count", result.Operations, "timeElapsedInSec", summary.DurationSec, "startTime", result.StartTime, "endTime", result.EndTime, "totalSuccesses", result.Successes, "totalFailures", result.Failures)
 
-	close(jobs)
-	wg.Wait()
-
-	// Close event channel and wait for CSV writer to finish
-	close(eventCh)
-	csvWg.Wait()
-
-	// Collect success and failure counts from all workers
-	totalSuccesses := 0
-	totalFailures := 0
-	for range numWorkers {
-		totalSuccesses += <-successCh
-		totalFailures += <-failureCh
+	// Create trips table, the REST API is responsible for it
+	if api != nil {
+		return summary, nil
 	}
-	close(successCh)
-	close(failureCh)
-
-	endTime := time.Now()
-	if ctx.Err() == nil {
-		logger.Info("All escooter trip events added", "count", tripEventsCount, "timeElapsedInSec", endTime.Sub(startTime).Seconds(), "startTime", startTime, "endTime", endTime, "totalSuccesses", totalSuccesses, "totalFailures", totalFailures)
-	}
-
-	// Create trips table
 	switch dbTarget {
-	case MobilityDB:
-		err := importEventsIntoTrips(ctx, connString)
-		if err != nil {
-			logger.Error("Error during import of events into trips table", "error", err)
-			os.Exit(1)
+	case targets.MobilityDB:
+		if err := importEventsIntoTrips(ctx, connString); err != nil {
+			return summary, fmt.Errorf("Importing events into trips table: %w", err)
 		}
-	case CrateDB:
+	case targets.CrateDB:
 		// No additional processing needed for CrateDB - queries will use escooter_events directly
 		logger.Info("CrateDB insert completed - queries will use escooter_events directly")
 	}
+	return summary, nil
 }
 
-// each worker should measure and log all available metrics
-//   - whether the insert was sucessful
-//   - the time it took to insert (if provided in the response)
-//   - the latency of getting a response
-//   - time spend waiting for receiving the next job through channel
-func insertWorker(ctx context.Context, id int, tripEventBatches <-chan []TripEvent, connString string, dbTarget DBTarget, useBulkInsert bool, successCh chan<- int, failureCh chan<- int, eventCh chan<- InsertEvent, readyStatus chan<- int) {
-	logger.Debug("Worker started", "id", id)
-
-	conn, err := pgx.Connect(ctx, connString)
-	if err != nil {
-		logger.Error("Unable to connect to database", "error", err)
-		os.Exit(1)
+// recordInsertEvent logs the finished batch and writes it into the results and the metrics.
+// With -result-shards it is called by the workers concurrently.
+func recordInsertEvent(ctx context.Context, csvWriter *results.CSVWriter, event results.InsertEvent) {
+	// Log the event (replacing worker logging), sampled to keep the log output manageable
+	if eventLogSampler.Sample(event.FailedInserts > 0) {
+		level := slog.LevelDebug
+		if eventLogSampler.Quiet() {
+			level = slog.LevelWarn
+		}
+		logger.Log(ctx, level, "Worker finished batch insert",
+			"workerId", event.WorkerID,
+			"jobType", event.JobType,
+			"batchSize", event.BatchSize,
+			"useBulkInsert", event.UseBulkInsert,
+			"startTime", event.StartTime,
+			"endTime", event.EndTime,
+			"insertDurationUs", event.InsertDurationUs,
+			"waitedForJobTimeUs", event.WaitedForJobTimeUs,
+			"successfullyInserted", event.SuccessfullyInserted,
+			"failedInserts", event.FailedInserts,
+		)
 	}
-	defer conn.Close(ctx)
-	logger.Debug("Worker connected to db", "id", id)
-
-	readyStatus <- id
 
-	insertEventSql := insertEventCratedbSql
-	switch dbTarget {
-	case CrateDB:
-		insertEventSql = insertEventCratedbSql
-	case MobilityDB:
-		insertEventSql = insertEventMobilitydbSql
+	// Write to CSV, the shard of the worker or the aggregate
+	switch {
+	case resultsAggregator != nil:
+		if err := resultsAggregator.Observe(event.JobType, event.EndMonotonicUs, event.InsertDurationUs, event.FailedInserts == 0, event.SuccessfullyInserted+event.FailedInserts); err != nil {
+			logger.Error("Failed to write CSV record", "error", err)
+		}
+	case resultShards != nil:
+		resultShards.Write(event.WorkerID, insertCSVRecord(event))
+	default:
+		if err := csvWriter.Write(insertCSVRecord(event)); err != nil {
+			logger.Error("Failed to write CSV record", "error", err)
+		}
 	}
 
-	bulkInsertEventSql := bulkInsertEventCratedbSql
-	switch dbTarget {
-	case CrateDB:
-		bulkInsertEventSql = bulkInsertEventCratedbSql
-	case MobilityDB:
-		bulkInsertEventSql = bulkInsertEventMobilitydbSql
-	}
+	resultsWarehouse.AddInsertEvent(event)
+	workerFairness.Observe(event.WorkerID, event.SuccessfullyInserted+event.FailedInserts, time.Duration(event.InsertDurationUs)*time.Microsecond, event.FailedInserts == 0)
+	runControl.AddCompleted(event.SuccessfullyInserted, event.FailedInserts)
+	liveStream.Observe(time.Duration(event.InsertDurationUs)*time.Microsecond, event.SuccessfullyInserted, event.FailedInserts)
 
-	insertedByWorker := 0
-	failedInsertsByWorker := 0
-
-	defer func() {
-		successCh <- insertedByWorker
-		failureCh <- failedInsertsByWorker
-		logger.Info(
-			"Insert worker finished",
-			"id", id,
-			"insertedEvents", insertedByWorker,
-			"failedInserts", failedInsertsByWorker,
-			"ctxErr", ctx.Err(),
-		)
-	}()
-
-	lastJobFinishTime := time.Now()
-	for {
-		select {
-		case <-ctx.Done():
-			logger.Info("Worker finished because the passed context is marked as done", "id", id)
-			return
-		case batch, ok := <-tripEventBatches:
-			if !ok {
-				return
-			}
+	statsd.Timing("insert.batch_duration", time.Duration(event.InsertDurationUs)*time.Microsecond)
+	statsd.Count("insert.events.successful", int64(event.SuccessfullyInserted))
+	statsd.Count("insert.events.failed", int64(event.FailedInserts))
+}
 
-			logger.Debug("Worker: batch received, inserting into db...", "id", id, "batchSize", len(batch))
+// dbInsertTarget connects every worker to the database
+type dbInsertTarget struct {
+	connString    string
+	dbTarget      targets.DBTarget
+	useBulkInsert bool
+}
 
-			waitedForJobTime := time.Since(lastJobFinishTime)
+func (t *dbInsertTarget) NewInserter(ctx context.Context, id int) (benchmark.Inserter, error) {
+	conn, err := connectWorker(ctx, id, t.connString)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to connect to database: %w", err)
+	}
+	logger.Debug("Worker connected to db", "id", id)
+	failoverTracker.Connected(conn)
+	rttCollector.MeasureWorker(ctx, id, conn)
+	return &dbInserter{dbInsertTarget: t, id: id, conn: conn}, nil
+}
 
-			insertedInQuery := 0
-			batchSize := len(batch)
-			startTime := time.Now()
+type dbInserter struct {
+	*dbInsertTarget
+	id   int
+	conn *pgx.Conn // replaced when the worker reconnects
+}
 
-			if useBulkInsert {
-				insertQuery := bulkInsertEventSql(batch)
-				res, err := conn.Exec(ctx, insertQuery)
-				if err != nil {
-					logger.Warn("Error whil inserting escooter events batch", "worker", id, "error", err)
-				} else {
-					insertedInQuery += int(res.RowsAffected())
-					logger.Debug("Bulk inserted trip events", "worker", id, "rowsAffected", res.RowsAffected())
-				}
-			} else {
-				// Use pgx batch for efficient batch inserts
-				pgxBatch := &pgx.Batch{}
-				for _, tEvent := range batch {
-					query := insertEventSql(tEvent)
-					pgxBatch.Queue(query)
-				}
-
-				batchResults := conn.SendBatch(ctx, pgxBatch)
-				for range batchSize {
-					_, err := batchResults.Exec()
-					if err != nil {
-						logger.Error("Error inserting escooter event", "worker", id, "error", err)
-					} else {
-						insertedInQuery++
-					}
-				}
-				batchResults.Close()
-			}
+func (w *dbInserter) JobType() string { return "batch_insert" }
 
-			endTime := time.Now()
-
-			// Send event to main thread for logging and CSV writing
-			event := InsertEvent{
-				WorkerID:             id,
-				JobType:              "batch_insert",
-				BatchSize:            batchSize,
-				UseBulkInsert:        useBulkInsert,
-				StartTime:            startTime.Format(time.RFC3339),
-				EndTime:              endTime.Format(time.RFC3339),
-				InsertDurationMs:     endTime.Sub(startTime).Milliseconds(),
-				WaitedForJobTimeMs:   waitedForJobTime.Milliseconds(),
-				SuccessfullyInserted: insertedInQuery,
-				FailedInserts:        batchSize - insertedInQuery,
-			}
-			eventCh <- event
+func (w *dbInserter) Close() { w.conn.Close(context.Background()) }
 
-			insertedByWorker += insertedInQuery
-			failedInsertsByWorker += batchSize - insertedInQuery
+func (w *dbInserter) Insert(ctx context.Context, batch []workload.TripEvent) benchmark.InsertOutcome {
+	var outcome benchmark.InsertOutcome
+	w.conn, outcome.Reconnect = reconnectWorker(ctx, w.id, w.conn, w.connString)
+	outcome.Start = time.Now()
+	outcome.Inserted = insertBatch(ctx, w.conn, w.id, w.dbTarget, batch, w.useBulkInsert)
+	outcome.End = time.Now()
+	observeInsert(batch, outcome)
+	return outcome
+}
 
-			lastJobFinishTime = time.Now()
-		}
-	}
+// apiInsertTarget sends the batches of every worker to the REST API
+type apiInsertTarget struct {
+	api *restTarget
 }
 
-func insertEventCratedbSql(tEvent TripEvent) string {
-	return fmt.Sprintf(`
-INSERT INTO escooter_events (
-	event_id, trip_id, timestamp, geo_point
-)
-VALUES (
-	'%s', '%s', '%s', [%s, %s]
-);`, tEvent.EventID, tEvent.TripID, tEvent.Timestamp, tEvent.Longitude, tEvent.Latitude)
+func (t apiInsertTarget) NewInserter(ctx context.Context, id int) (benchmark.Inserter, error) {
+	return apiInserter{api: t.api, id: id}, nil
 }
 
-func insertEventMobilitydbSql(tEvent TripEvent) string {
-	return fmt.Sprintf(`
-INSERT INTO escooter_events (
-	event_id, trip_id, timestamp, geo_point
-)
-VALUES (
-	'%s', '%s', '%s', 'SRID=4326;POINT(%s %s)'
-);`, tEvent.EventID, tEvent.TripID, tEvent.Timestamp, tEvent.Longitude, tEvent.Latitude)
+type apiInserter struct {
+	api *restTarget
+	id  int
 }
 
-func bulkInsertEventCratedbSql(events []TripEvent) string {
-	eventIds := make([]string, len(events))
-	tripIds := make([]string, len(events))
-	timestamps := make([]string, len(events))
-	points := make([]string, len(events))
-	for i, tEvent := range events {
-		eventIds[i] = tEvent.EventID
-		tripIds[i] = tEvent.TripID
-		timestamps[i] = tEvent.Timestamp
-		points[i] = fmt.Sprintf("POINT( %s %s )", tEvent.Longitude, tEvent.Latitude)
-	}
+func (w apiInserter) JobType() string { return "api_batch_insert" }
 
-	return fmt.Sprintf(`
-INSERT INTO escooter_events (
-	event_id,
-	trip_id,
-	timestamp,
-	geo_point
-)
-(SELECT *
-	FROM  UNNEST(
-	[%s],
-	[%s],
-	[%s],
-	[%s]
-	)
-);`,
-		joinAndQuoteStrings(eventIds),
-		joinAndQuoteStrings(tripIds),
-		joinAndQuoteStrings(timestamps),
-		joinAndQuoteStrings(points),
-	)
+func (w apiInserter) Close() {}
+
+func (w apiInserter) Insert(ctx context.Context, batch []workload.TripEvent) benchmark.InsertOutcome {
+	outcome := benchmark.InsertOutcome{Start: time.Now()}
+	outcome.Inserted = w.api.insertBatch(ctx, w.id, batch)
+	outcome.End = time.Now()
+	observeInsert(batch, outcome)
+	return outcome
 }
 
-func bulkInsertEventMobilitydbSql(events []TripEvent) string {
-	eventIds := make([]string, len(events))
-	tripIds := make([]string, len(events))
-	timestamps := make([]string, len(events))
-	geo_points := make([]string, len(events))
-	for i, tEvent := range events {
-		eventIds[i] = tEvent.EventID
-		tripIds[i] = tEvent.TripID
-		timestamps[i] = tEvent.Timestamp
-		geo_points[i] = fmt.Sprintf("SRID=4326;POINT(%s %s)", tEvent.Longitude, tEvent.Latitude)
-	}
+// observeInsert passes the finished batch to the fault injection, failover and tenant reports
+func observeInsert(batch []workload.TripEvent, outcome benchmark.InsertOutcome) {
+	failed := len(batch) - outcome.Inserted
+	faultInjector.Observe(outcome.Start, outcome.End, outcome.Inserted, failed)
+	failoverTracker.Observe(outcome.End, outcome.End.Sub(outcome.Start), failed == 0)
+	tenancy.Observe(batch[0].Tenant, outcome.End.Sub(outcome.Start), failed == 0)
+}
 
-	return fmt.Sprintf(`
-INSERT INTO escooter_events (
-event_id, 
-trip_id,
-timestamp,
-geo_point
-)
-(SELECT *
-FROM  UNNEST(
-ARRAY[%s]::UUID[],
-ARRAY[%s]::UUID[],
-ARRAY[%s]::TIMESTAMPTZ[],
-ARRAY[%s]::geometry(Point, 4326)[]
-));`,
-		joinAndQuoteStrings(eventIds),
-		joinAndQuoteStrings(tripIds),
-		joinAndQuoteStrings(timestamps),
-		joinAndQuoteStrings(geo_points),
-	)
+// insertBatch inserts the events in one bulk statement or as pgx batch of single inserts
+// and returns the number of inserted events
+func insertBatch(ctx context.Context, conn *pgx.Conn, id int, dbTarget targets.DBTarget, batch []workload.TripEvent, useBulkInsert bool) int {
+	inserted := 0
+	if useBulkInsert {
+		insertQuery := targets.BulkInsertEventsSQL(dbTarget, batch)
+		res, err := conn.Exec(ctx, insertQuery)
+		if err != nil {
+			logger.Warn("Error whil inserting escooter events batch", "worker", id, "error", err)
+		} else if targets.IdempotentInserts() {
+			// events skipped as already stored aren't affected rows, but are stored as well
+			inserted += len(batch)
+			logger.Debug("Bulk inserted trip events", "worker", id, "rowsAffected", res.RowsAffected(), "conflicts", len(batch)-int(res.RowsAffected()))
+		} else {
+			inserted += int(res.RowsAffected())
+			logger.Debug("Bulk inserted trip events", "worker", id, "rowsAffected", res.RowsAffected())
+		}
+	} else {
+		// Use pgx batch for efficient batch inserts
+		pgxBatch := &pgx.Batch{}
+		for _, tEvent := range batch {
+			query := targets.InsertEventSQL(dbTarget, tEvent)
+			pgxBatch.Queue(query)
+		}
+
+		batchResults := conn.SendBatch(ctx, pgxBatch)
+		for range len(batch) {
+			_, err := batchResults.Exec()
+			if err != nil {
+				logger.Error("Error inserting escooter event", "worker", id, "error", err)
+			} else {
+				inserted++
+			}
+		}
+		batchResults.Close()
+	}
+	return inserted
 }
 
 func importEventsIntoTrips(ctx context.Context, connString string) error {
@@ -422,15 +252,11 @@ func importEventsIntoTrips(ctx context.Context, connString string) error {
 	}
 	defer conn.Close(ctx)
 
-	query := `
-INSERT INTO trips
-SELECT trip_id, tgeogpointseq(array_agg(tgeogpoint(geo_point, timestamp) ORDER BY timestamp)) AS trip
-FROM escooter_events
-GROUP BY trip_id
-ON CONFLICT (trip_id) DO UPDATE
-	SET trip = EXCLUDED.trip;`
-
-	_, err = conn.Exec(ctx, query)
+	importSQL := targets.ImportTripsSQL
+	if tenancy != nil {
+		importSQL = targets.ImportTenantTripsSQL
+	}
+	_, err = conn.Exec(ctx, targets.PrefixTables(importSQL))
 	if err != nil {
 		return fmt.Errorf("Executing insert to trips from escooter events: %w", err)
 	}
@@ -439,4 +265,3 @@ ON CONFLICT (trip_id) DO UPDATE
 	logger.Info("Finished importing escooter_events into trips table", "startTime", startTime, "endTime", endTime, "durationInS", endTime.Sub(startTime).Seconds())
 	return nil
 }
-
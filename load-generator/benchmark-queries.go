@@ -2,188 +2,160 @@ package main
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/binary"
-	"encoding/csv"
 	"fmt"
-	"io"
-	"math/rand"
-	"os"
-	"runtime"
+	"log/slog"
 	"strings"
-	"sync"
 	"text/template"
 	"time"
 
 	"github.com/jackc/pgx/v5"
-)
 
-type QueryEvent struct {
-	WorkerID           int
-	JobType            string
-	TemplateName       string
-	QueryDurationMs    int64
-	StartTime          string
-	EndTime            string
-	Successful         bool
-	ResultingRowsCount int
-	QueryIndex         int
-	ErrorMsg           string
-}
+	"load-generator/internal/benchmark"
+	"load-generator/internal/results"
+	"load-generator/internal/targets"
+	"load-generator/internal/workload"
+)
 
-func benchmarkQueries(ctx context.Context, connString string, numWorkers int, dbTarget DBTarget, tevents string, localities []Locality, pois []POI, queryTemplates *template.Template, numQueries int, seed int64, csvWriter *csv.Writer) {
+func benchmarkQueries(ctx context.Context, connString string, api *restTarget, numWorkers int, drainTimeout time.Duration, dbTarget targets.DBTarget, tevents string, tripIDSampleSize int, localities []workload.Locality, pois []workload.POI, queryTemplates *template.Template, numQueries int, seed int64, csvWriter *results.CSVWriter) (RunSummary, error) {
 	logger.Info("Starting Query Benchmark",
-		"dbConnString", connString,
+		"dbConnString", redactConnString(connString),
 		"numWorkers", numWorkers,
 		"dbTarget", dbTarget.String(),
 		"queriesNum", numQueries,
 		"seed", seed,
 	)
 
-	tripIds := ReadTripIds(ctx, tevents)
+	aborted := RunSummary{Mode: "query", DBTarget: dbTarget.String(), NumWorkers: numWorkers, Aborted: true}
+
+	tripIds, err := workload.SampleTripIDs(ctx, tevents, tripIDSampleSize, seed)
+	if err != nil {
+		return aborted, err
+	}
+	logger.Debug("Read trip events ids from CSV file", "file", tevents, "tripEventsCount", len(tripIds), "sampleSize", tripIDSampleSize)
 
 	// Create field generator
-	generator := NewQueryFieldGenerator(seed, localities, pois, tripIds)
+	generator, err := workload.NewQueryFieldGenerator(seed, localities, pois, tripIds)
+	if err != nil {
+		return aborted, err
+	}
+	if tenancy != nil {
+		generator.SetTenants(tenancy.distribution)
+	}
 
 	queryTemplates = queryTemplates.Option("missingkey=error")
-	err := ValidateTemplates(ctx, queryTemplates, connString, generator)
-	if err != nil {
-		logger.Error("Not all templates passed the validation, stopping benchmark", "error", err)
-		return
+	// workers of a REST API target send HTTP requests instead
+	var target benchmark.QueryTarget = &dbQueryTarget{connString: connString, templates: queryTemplates}
+	if api != nil {
+		logger.Info("Sending the queries to the REST API instead of the database", "api", api.String())
+		if err := api.validateQueries(ctx, generator); err != nil {
+			return aborted, err
+		}
+		target = apiQueryTarget{api}
+	} else if err := ValidateTemplates(ctx, queryTemplates, connString, generator); err != nil {
+		return aborted, err
 	}
 	logger.Info("Using query templates", "count", len(queryTemplates.Templates()))
 
-	// Start workers
-	readyStatus := make(chan int, numWorkers)
-	jobs := make(chan QueryJob, runtime.NumCPU()*100) // larger buffer to combat workers waiting for main thread to read the csv file
-	successCh := make(chan int, numWorkers)
-	failureCh := make(chan int, numWorkers)
-	eventCh := make(chan QueryEvent, numWorkers*10)
-	var wg sync.WaitGroup
-	for i := 1; i <= numWorkers; i++ {
-		wg.Add(1)
-		go func(id int) {
-			queryWorker(ctx, id, connString, queryTemplates, jobs, readyStatus, successCh, failureCh, eventCh)
-			wg.Done()
-		}(i)
+	// Write CSV header, the aggregator wrote its own
+	if err := writeCSVHeaderUnlessAggregated(csvWriter, queryCSVHeader()); err != nil {
+		return aborted, fmt.Errorf("Writing CSV header: %w", err)
 	}
-	logger.Info("Started query worker threads", "numWorkers", numWorkers)
 
-	// Write CSV header
-	csvHeader := []string{"workerId", "jobType", "templateName", "queryDurationMs", "startTime", "endTime", "successful", "resultingRowsCount", "queryIndex", "errorMsg"}
-	if err := csvWriter.Write(csvHeader); err != nil {
-		logger.Error("Failed to write CSV header", "error", err)
-		os.Exit(1)
+	cfg := benchmark.QueryConfig{
+		Config:        benchmark.Config{NumWorkers: numWorkers, DrainTimeout: drainTimeout, Control: runControl, Logger: logger},
+		NumQueries:    numQueries,
+		TemplateNames: workload.TemplateNames(queryTemplates),
+		Fields:        generator.GenerateFields,
+		Target:        target,
+		Record:        func(event results.QueryEvent) { recordQueryEvent(ctx, csvWriter, event) },
 	}
-
-	// Start CSV writer goroutine
-	var csvWg sync.WaitGroup
-	csvWg.Add(1)
-	go func() {
-		defer csvWg.Done()
-		for event := range eventCh {
-			// Log the event (replacing worker logging)
-			logger.Debug("Query worker finished query",
-				"workerId", event.WorkerID,
-				"jobType", event.JobType,
-				"templateName", event.TemplateName,
-				"queryDurationMs", event.QueryDurationMs,
-				"startTime", event.StartTime,
-				"endTime", event.EndTime,
-				"successful", event.Successful,
-				"resultingRowsCount", event.ResultingRowsCount,
-				"queryIndex", event.QueryIndex,
-				"error", event.ErrorMsg,
-			)
-
-			// Write to CSV
-			record := []string{
-				fmt.Sprintf("%d", event.WorkerID),
-				event.JobType,
-				event.TemplateName,
-				fmt.Sprintf("%d", event.QueryDurationMs),
-				event.StartTime,
-				event.EndTime,
-				fmt.Sprintf("%t", event.Successful),
-				fmt.Sprintf("%d", event.ResultingRowsCount),
-				fmt.Sprintf("%d", event.QueryIndex),
-				event.ErrorMsg,
-			}
-			if err := csvWriter.Write(record); err != nil {
-				logger.Error("Failed to write CSV record", "error", err)
-			}
-		}
-	}()
-
-	// Wait for all workers to signal ready
-	workersReady := 0
-Waiting4Workers:
-	for {
-		select {
-		case <-ctx.Done():
-			break Waiting4Workers
-		case readyWorkerId := <-readyStatus:
-			logger.Debug("Worker reported ready", "id", readyWorkerId)
-			workersReady += 1
-			if workersReady == numWorkers {
-				break Waiting4Workers
-			}
-		}
+	// every worker writes its shard and records its events itself, the recording is safe for concurrent use without aggregates
+	cfg.RecordInWorkers = resultShards != nil
+	result, err := benchmark.Queries(ctx, cfg)
+	if err != nil {
+		return aborted, err
 	}
 
-	templateNames := make([]string, len(queryTemplates.Templates()))
-	for i, tmpl := range queryTemplates.Templates() {
-		templateNames[i] = tmpl.Name()
+	if !result.Aborted {
+		logger.Info("All query workers finished",
+			"totalQueries", numQueries,
+			"timeElapsedInSec", result.EndTime.Sub(result.StartTime).Seconds(),
+			"startTime", result.StartTime,
+			"endTime", result.EndTime,
+			"totalSuccesses", result.Successes,
+			"totalFailures", result.Failures,
+		)
 	}
+	return RunSummary{
+		Mode:            "query",
+		DBTarget:        dbTarget.String(),
+		NumWorkers:      numWorkers,
+		StartTime:       result.StartTime,
+		EndTime:         result.EndTime,
+		DurationSec:     result.EndTime.Sub(result.StartTime).Seconds(),
+		TotalOperations: result.Operations,
+		TotalSuccesses:  result.Successes,
+		TotalFailures:   result.Failures,
+		Aborted:         result.Aborted,
+	}, nil
+}
 
-	// Wait for all workers to complete
-	startTime := time.Now()
-	for i := range numQueries {
-		if ctx.Err() != nil {
-			break
-		}
-		fields := generator.GenerateFields(i)
-		randTmplName := templateNames[i%len(templateNames)]
-		jobs <- QueryJob{
-			Fields:       fields,
-			TemplateName: randTmplName,
+// recordQueryEvent logs the finished query and writes it into the results and the metrics.
+// With -result-shards it is called by the workers concurrently.
+func recordQueryEvent(ctx context.Context, csvWriter *results.CSVWriter, event results.QueryEvent) {
+	// Log the event (replacing worker logging), sampled to keep the log output manageable
+	if eventLogSampler.Sample(!event.Successful) {
+		level := slog.LevelDebug
+		if eventLogSampler.Quiet() {
+			level = slog.LevelWarn
 		}
+		logger.Log(ctx, level, "Query worker finished query",
+			"workerId", event.WorkerID,
+			"jobType", event.JobType,
+			"templateName", event.TemplateName,
+			"queryDurationUs", event.QueryDurationUs,
+			"startTime", event.StartTime,
+			"endTime", event.EndTime,
+			"successful", event.Successful,
+			"resultingRowsCount", event.ResultingRowsCount,
+			"queryIndex", event.QueryIndex,
+			"error", event.ErrorMsg,
+		)
+	}
 
-		if i%1000 == 0 {
-			logger.Info("Query progress", "queriesAddedToQueue", i+1, "timeElapsedInSec", time.Since(startTime).Seconds())
+	// Write to CSV, the shard of the worker or the aggregate
+	switch {
+	case resultsAggregator != nil:
+		if err := resultsAggregator.Observe(event.TemplateName, event.EndMonotonicUs, event.QueryDurationUs, event.Successful, 1); err != nil {
+			logger.Error("Failed to write CSV record", "error", err)
+		}
+	case resultShards != nil:
+		resultShards.Write(event.WorkerID, queryCSVRecord(event))
+	default:
+		if err := csvWriter.Write(queryCSVRecord(event)); err != nil {
+			logger.Error("Failed to write CSV record", "error", err)
 		}
 	}
-	close(jobs)
-	wg.Wait()
-
-	// Close event channel and wait for CSV writer to finish
-	close(eventCh)
-	csvWg.Wait()
-
-	// Collect success and failure counts from all workers
-	totalSuccesses := 0
-	totalFailures := 0
-	for range numWorkers {
-		totalSuccesses += <-successCh
-		totalFailures += <-failureCh
+
+	resultsWarehouse.AddQueryEvent(event)
+	workerFairness.Observe(event.WorkerID, 1, time.Duration(event.QueryDurationUs)*time.Microsecond, event.Successful)
+	if event.Successful {
+		runControl.AddCompleted(1, 0)
+		liveStream.Observe(time.Duration(event.QueryDurationUs)*time.Microsecond, 1, 0)
+	} else {
+		runControl.AddCompleted(0, 1)
+		liveStream.Observe(time.Duration(event.QueryDurationUs)*time.Microsecond, 0, 1)
 	}
-	close(successCh)
-	close(failureCh)
 
-	endTime := time.Now()
-	if ctx.Err() == nil {
-		logger.Info("All query workers finished",
-			"totalQueries", numQueries,
-			"timeElapsedInSec", endTime.Sub(startTime).Seconds(),
-			"startTime", startTime,
-			"endTime", endTime,
-			"totalSuccesses", totalSuccesses,
-			"totalFailures", totalFailures,
-		)
+	statsd.Timing("query."+sanitizeStatsdName(event.TemplateName)+".duration", time.Duration(event.QueryDurationUs)*time.Microsecond)
+	if event.Successful {
+		statsd.Count("query.successful", 1)
+	} else {
+		statsd.Count("query.failed", 1)
 	}
 }
 
-func ValidateTemplates(ctx context.Context, templates *template.Template, connString string, generator *QueryFieldGenerator) error {
+func ValidateTemplates(ctx context.Context, templates *template.Template, connString string, generator *workload.QueryFieldGenerator) error {
 	templates = templates.Option("missingkey=error")
 
 	conn, err := pgx.Connect(ctx, connString)
@@ -192,10 +164,7 @@ func ValidateTemplates(ctx context.Context, templates *template.Template, connSt
 	}
 	defer conn.Close(ctx)
 
-	templateNames := make([]string, len(templates.Templates()))
-	for i, tmpl := range templates.Templates() {
-		templateNames[i] = tmpl.Name()
-	}
+	templateNames := workload.TemplateNames(templates)
 
 	logger.Info("Validating the templates by running all the query types on database", "templateNames", templateNames)
 
@@ -204,16 +173,17 @@ func ValidateTemplates(ctx context.Context, templates *template.Template, connSt
 	for _, tmpl := range templates.Templates() {
 		// Execute template with generated fields
 		var query strings.Builder
-		if err := templates.ExecuteTemplate(&query, tmpl.Name(), fields); err != nil {
+		if err := templates.ExecuteTemplate(&query, tmpl.Name(), targets.EscapeQueryFields(fields)); err != nil {
 			logger.Error("Template validation failed on template execution - contains undefined fields", "template", tmpl.Name(), "error", err, "fields", fields)
-			return err
+			return fmt.Errorf("%w: executing template %s: %w", errTemplateValidation, tmpl.Name(), err)
 		}
 
-		rows, err := conn.Query(ctx, query.String())
+		sql := tenancy.PrefixTables(fields.TenantID, query.String())
+		rows, err := conn.Query(ctx, sql)
 		if err != nil {
-			logger.Error("Template validation failed on querying the database", "template", tmpl.Name(), "error", err, "query", query.String())
+			logger.Error("Template validation failed on querying the database", "template", tmpl.Name(), "error", err, "query", sql)
 			rows.Close()
-			return err
+			return fmt.Errorf("%w: querying template %s: %w", errTemplateValidation, tmpl.Name(), err)
 		}
 		rows.Close()
 
@@ -222,245 +192,119 @@ func ValidateTemplates(ctx context.Context, templates *template.Template, connSt
 	return nil
 }
 
-func ReadTripIds(ctx context.Context, tripEventsCSV string) []string {
-	// open the csv file
-	f, err := os.Open(tripEventsCSV)
+// dbQueryTarget connects every worker to the database
+type dbQueryTarget struct {
+	connString string
+	templates  *template.Template
+}
+
+func (t *dbQueryTarget) NewQuerier(ctx context.Context, id int) (benchmark.Querier, error) {
+	conn, err := connectWorker(ctx, id, t.connString)
 	if err != nil {
-		logger.Error("Error opening file", "error", err, "filename", tripEventsCSV)
-		os.Exit(1)
+		return nil, fmt.Errorf("Unable to connect to database: %w", err)
 	}
-	defer f.Close()
-	r := csv.NewReader(f)
+	logger.Debug("Query worker connected to db", "id", id)
+	failoverTracker.Connected(conn)
+	rttCollector.MeasureWorker(ctx, id, conn)
+	return &dbQuerier{dbQueryTarget: t, id: id, conn: conn}, nil
+}
 
-	// read header of csv
-	if _, err := r.Read(); err != nil {
-		logger.Error("Error in read pois header", "error", err)
-		os.Exit(1)
-	}
+type dbQuerier struct {
+	*dbQueryTarget
+	id   int
+	conn *pgx.Conn // replaced when the worker reconnects
+}
 
-	tripEventIds := make([]string, 0)
-	lastTripId := "" // used to pass only unique values
-	for ctx.Err() == nil {
-		rec, err := r.Read()
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			logger.Error("Error in read of trips csv", "error", err)
-			os.Exit(1)
-		}
+func (w *dbQuerier) JobType() string { return "query" }
 
-		tripId := rec[1]
+func (w *dbQuerier) Close() { w.conn.Close(context.Background()) }
 
-		if tripId != lastTripId {
-			tripEventIds = append(tripEventIds, rec[1])
-			lastTripId = tripId
-		}
+func (w *dbQuerier) Query(ctx context.Context, job benchmark.QueryJob) (benchmark.QueryOutcome, error) {
+	// Execute template with generated fields
+	var query strings.Builder
+	if err := w.templates.ExecuteTemplate(&query, job.TemplateName, targets.EscapeQueryFields(job.Fields)); err != nil {
+		logger.Error("Query worker failed to execute template", "id", w.id, "template", job.TemplateName, "error", err, "fields", job.Fields)
+		return benchmark.QueryOutcome{}, err
 	}
-	logger.Debug("Read trip events ids from CSV file", "file", tripEventsCSV, "tripEventsCount", len(tripEventIds))
-	return tripEventIds
-}
 
-type QueryJob struct {
-	TemplateName string
-	Fields       QueryFields
+	sql := tenancy.PrefixTables(job.Fields.TenantID, query.String())
+	logger.Debug("Query worker executing query", "id", w.id, "query", sql, "template", job.TemplateName, "fields", job.Fields)
+	var outcome benchmark.QueryOutcome
+	w.conn, outcome.Reconnect = reconnectWorker(ctx, w.id, w.conn, w.connString)
+	outcome.Start = time.Now()
+	outcome.Rows, outcome.Successful, outcome.Err = executeQuery(ctx, w.conn, w.id, sql)
+	outcome.End = time.Now()
+	observeQuery(job, outcome)
+	return outcome, nil
 }
 
-// queryWorker executes queries
-func queryWorker(ctx context.Context, id int, connString string, templates *template.Template, jobs <-chan QueryJob, readyStatus chan<- int, successCh chan<- int, failureCh chan<- int, eventCh chan<- QueryEvent) {
-	logger.Debug("Query worker started", "id", id)
+// apiQueryTarget sends the queries of every worker to the REST API
+type apiQueryTarget struct {
+	api *restTarget
+}
 
-	conn, err := pgx.Connect(ctx, connString)
-	if err != nil {
-		logger.Error("Query worker was unable to connect to database, worker stopping", "id", id, "error", err)
-		return
-	}
-	defer conn.Close(ctx)
-	logger.Debug("Query worker connected to db", "id", id)
+func (t apiQueryTarget) NewQuerier(ctx context.Context, id int) (benchmark.Querier, error) {
+	return apiQuerier{api: t.api, id: id}, nil
+}
 
-	queryIndex := -1
-	successfulQueries := 0
-	failedQueries := 0
-
-	readyStatus <- id
-
-	defer func() {
-		successCh <- successfulQueries
-		failureCh <- failedQueries
-		logger.Info(
-			"Query worker finished",
-			"id", id,
-			"executedQueries", queryIndex+1,
-			"successfulQueries", successfulQueries,
-			"failedQueries", failedQueries,
-			"ctxErr", ctx.Err(),
-			"usedTemplates", len(templates.Templates()),
-		)
-	}()
-
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case job, ok := <-jobs:
-			if !ok {
-				return
-			}
-			queryIndex++
-
-			// Execute template with generated fields
-			var query strings.Builder
-			if err := templates.ExecuteTemplate(&query, job.TemplateName, job.Fields); err != nil {
-				logger.Error("Query worker failed to execute template", "id", id, "template", job.TemplateName, "error", err, "fields", job.Fields)
-				continue
-			}
-
-			logger.Debug("Query worker executing query", "id", id, "query", query.String(), "template", job.TemplateName, "fields", job.Fields)
-			querySuccessful := true
-			resultingRowsCount := 0
-			startTime := time.Now()
-			rows, err := conn.Query(ctx, query.String())
-			if err != nil {
-				querySuccessful = false
-				logger.Debug("Query worker query failed", "id", id, "error", err)
-			} else {
-				// consume the resulting rows
-				rowNum := -1
-				for rows.Next() {
-					rowNum++
-					rowVals, err := rows.Values()
-					if err != nil {
-						// This shouldn't happen as we first check with rows.Next if a value exist
-						querySuccessful = false
-						logger.Debug("Query worker query failed when reading values of a resulting rows", "id", id, "rowNum", rowNum, "error", err)
-					}
-
-					logger.Debug("Query worker query resulted in row", "id", id, "rowNum", rowNum, "error", err, "values", rowVals)
-					resultingRowsCount++
-				}
-				if err = rows.Err(); err != nil {
-					querySuccessful = false
-					logger.Debug("Query worker query failed when reading resulting rows", "id", id, "error", err)
-				}
-				rows.Close()
-			}
-
-			if querySuccessful {
-				successfulQueries++
-			} else {
-				failedQueries++
-			}
-
-			endTime := time.Now()
-			queryDuration := endTime.Sub(startTime)
-
-			// Prepare error message
-			var errorMsg string
-			if err != nil {
-				errorMsg = err.Error()
-			}
-
-			// Send event to main thread for logging and CSV writing
-			event := QueryEvent{
-				WorkerID:           id,
-				JobType:            "query",
-				TemplateName:       job.TemplateName,
-				QueryDurationMs:    queryDuration.Milliseconds(),
-				StartTime:          startTime.Format(time.RFC3339),
-				EndTime:            endTime.Format(time.RFC3339),
-				Successful:         querySuccessful,
-				ResultingRowsCount: resultingRowsCount,
-				QueryIndex:         queryIndex,
-				ErrorMsg:           errorMsg,
-			}
-			eventCh <- event
-		}
-	}
+type apiQuerier struct {
+	api *restTarget
+	id  int
 }
 
-// QueryFieldGenerator generates random query parameters in a seeded, deterministic manner
-type QueryFieldGenerator struct {
-	baseSeed int64
+func (w apiQuerier) JobType() string { return "api_query" }
 
-	// Real data pools from loaded files
-	localities []Locality
-	pois       []POI
-	tripIDs    []string
+func (w apiQuerier) Close() {}
 
-	// Time bounds for realistic queries
-	minTime time.Time
-	maxTime time.Time
+func (w apiQuerier) Query(ctx context.Context, job benchmark.QueryJob) (benchmark.QueryOutcome, error) {
+	outcome := benchmark.QueryOutcome{Start: time.Now(), Successful: true}
+	outcome.Rows, outcome.Err = w.api.query(ctx, job.TemplateName, job.Fields)
+	outcome.End = time.Now()
+	if outcome.Err != nil {
+		outcome.Successful = false
+		logger.Debug("Query worker request failed", "id", w.id, "error", outcome.Err)
+	}
+	observeQuery(job, outcome)
+	return outcome, nil
 }
 
-// QueryFields contains all possible template parameters
-type QueryFields struct {
-	LocalityId string
-	EndTime    string // RFC3339 string
-	Limit      int
-	POIID      string
-	Radius     float64
-	StartTime  string // RFC3339 string
-	Timestamp  string // RFC3339 string
-	TripID     string
+// observeQuery passes the finished query to the fault injection, failover and tenant reports
+func observeQuery(job benchmark.QueryJob, outcome benchmark.QueryOutcome) {
+	if outcome.Successful {
+		faultInjector.Observe(outcome.Start, outcome.End, 1, 0)
+	} else {
+		faultInjector.Observe(outcome.Start, outcome.End, 0, 1)
+	}
+	failoverTracker.Observe(outcome.End, outcome.End.Sub(outcome.Start), outcome.Successful)
+	tenancy.Observe(job.Fields.TenantID, outcome.End.Sub(outcome.Start), outcome.Successful)
 }
 
-// NewQueryFieldGenerator creates a new seeded field generator
-func NewQueryFieldGenerator(seed int64, localities []Locality, pois []POI, tripIds []string) *QueryFieldGenerator {
-	// Load Berlin time zone
-	berlinLoc, err := time.LoadLocation("Europe/Berlin")
+// executeQuery executes the query and consumes the resulting rows, err is the error of the query if it failed
+func executeQuery(ctx context.Context, conn *pgx.Conn, id int, sql string) (resultingRowsCount int, querySuccessful bool, err error) {
+	querySuccessful = true
+	rows, err := conn.Query(ctx, sql)
 	if err != nil {
-		panic("Failed to load Europe/Berlin timezone: " + err.Error())
+		logger.Debug("Query worker query failed", "id", id, "error", err)
+		return 0, false, err
 	}
+	defer rows.Close()
+	// consume the resulting rows
+	rowNum := -1
+	for rows.Next() {
+		rowNum++
+		rowVals, err := rows.Values()
+		if err != nil {
+			// This shouldn't happen as we first check with rows.Next if a value exist
+			querySuccessful = false
+			logger.Debug("Query worker query failed when reading values of a resulting rows", "id", id, "rowNum", rowNum, "error", err)
+		}
 
-	// Set realistic time bounds (adjust based on your dataset)
-	minTime := time.Date(2020, 1, 1, 0, 0, 0, 0, berlinLoc)
-	maxTime := time.Date(2025, 12, 31, 23, 59, 59, 0, berlinLoc)
-
-	return &QueryFieldGenerator{
-		baseSeed:   seed,
-		localities: localities,
-		pois:       pois,
-		tripIDs:    tripIds,
-		minTime:    minTime,
-		maxTime:    maxTime,
+		logger.Debug("Query worker query resulted in row", "id", id, "rowNum", rowNum, "error", err, "values", rowVals)
+		resultingRowsCount++
 	}
-}
-
-// GenerateFields generates all query fields for a specific worker and query index
-func (g *QueryFieldGenerator) GenerateFields(queryIndex int) QueryFields {
-	// Create single deterministic seed for this specific query
-	hash := sha256.New()
-	binary.Write(hash, binary.LittleEndian, g.baseSeed)
-	binary.Write(hash, binary.LittleEndian, queryIndex)
-
-	hashBytes := hash.Sum(nil)
-	seed := int64(binary.LittleEndian.Uint64(hashBytes[:8]))
-
-	// Create single RNG for all fields in this query
-	rng := rand.New(rand.NewSource(seed))
-
-	// Generate start time first
-	minDuration := int64(3600 * 1)
-	maxDuration := int64(3600 * 2)
-
-	timeRange := g.maxTime.Unix() - g.minTime.Unix()
-	startOffset := rng.Int63n(timeRange - maxDuration)
-	startTime := time.Unix(g.minTime.Unix()+startOffset, 0)
-
-	duration := minDuration + rng.Int63n(maxDuration-minDuration)
-	endTime := startTime.Add(time.Duration(duration) * time.Second)
-
-	// Generate single timestamp within reasonable bounds
-	timestampOffset := rng.Int63n(timeRange)
-	timestamp := time.Unix(g.minTime.Unix()+timestampOffset, 0)
-
-	return QueryFields{
-		LocalityId: g.localities[rng.Intn(len(g.localities))].LocalityID,
-		Limit:      5 + rng.Intn(95),
-		POIID:      g.pois[rng.Intn(len(g.pois))].POIID,
-		Radius:     1000 + rng.Float64()*4000, // 1000-5000 meters
-		StartTime:  startTime.Format(time.RFC3339),
-		EndTime:    endTime.Format(time.RFC3339),
-		Timestamp:  timestamp.Format(time.RFC3339),
-		TripID:     g.tripIDs[rng.Intn(len(g.tripIDs))],
+	if err = rows.Err(); err != nil {
+		querySuccessful = false
+		logger.Debug("Query worker query failed when reading resulting rows", "id", id, "error", err)
 	}
+	return resultingRowsCount, querySuccessful, err
 }
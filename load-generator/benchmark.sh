@@ -31,13 +31,13 @@ while [[ $# -gt 0 ]]; do
 done
 
 # Init DB
-go run . --mode init \
+go run . init \
   --dbTarget $DB_TARGET \
   --db $DB_CONN_STR \
   --migrations "./migrations/$DB_TARGET"
 
 # Insert
-go run . --mode insert \
+go run . insert \
   --dbTarget $DB_TARGET \
   --db $DB_CONN_STR \
   --nworkers $NWORKERS \
@@ -48,7 +48,7 @@ go run . --mode insert \
 sleep $WAIT_BETWEEN_STEPS
 
 # Simple queries
-if !  timeout --signal=INT $QRS_TIMEOUT go run . --mode query \
+if !  timeout --signal=INT $QRS_TIMEOUT go run . query \
     --dbTarget $DB_TARGET \
     --db $DB_CONN_STR \
     --nworkers $NWORKERS \
@@ -62,7 +62,7 @@ fi
 sleep $WAIT_BETWEEN_STEPS
 
 # Complex queries
-if ! timeout --signal=INT $QRS_TIMEOUT go run . --mode query \
+if ! timeout --signal=INT $QRS_TIMEOUT go run . query \
       --dbTarget $DB_TARGET \
       --db $DB_CONN_STR \
       --nworkers $NWORKERS_COMPLEX \
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"load-generator/internal/results"
+	"load-generator/internal/targets"
+)
+
+type canaryQuery struct {
+	Name string
+	SQL  string
+}
+
+// canaryCountQuery counts the events, its result is recorded with every canary query of the round as the size of the table
+const canaryCountQuery = `SELECT count(*) FROM escooter_events`
+
+// canaryQueries read the freshest events, which are the ones competing with the inserts.
+// The SQL is valid on both targets.
+var canaryQueries = []canaryQuery{
+	{Name: "count_events", SQL: canaryCountQuery},
+	{Name: "latest_timestamp", SQL: `SELECT max(timestamp) FROM escooter_events`},
+	{Name: "latest_events", SQL: `SELECT event_id, trip_id, timestamp, geo_point FROM escooter_events ORDER BY timestamp DESC LIMIT 100`},
+	{
+		Name: "latest_trip",
+		SQL: `SELECT count(*), min(timestamp), max(timestamp) FROM escooter_events
+WHERE trip_id = (SELECT trip_id FROM escooter_events ORDER BY timestamp DESC LIMIT 1)`,
+	},
+}
+
+var canaryCSVHeader = []string{"runId", "queryName", "startTime", "endTime", "queryDurationUs", "startMonotonicUs", "successful", "resultingRowsCount", "tableRows", "errorMsg"}
+
+// startCanaryQueries executes the canary queries on a dedicated connection every interval while the inserts run
+// and writes their latency to the canary CSV file, showing how reads degrade as the table grows.
+// Returned function stops the canaries and closes the file.
+func startCanaryQueries(ctx context.Context, interval time.Duration, connString string, dbTarget targets.DBTarget, numWorkers int) func() {
+	if interval <= 0 {
+		return func() {}
+	}
+
+	conn, err := pgx.Connect(ctx, connString)
+	if err != nil {
+		logger.Error("Canary queries were unable to connect to database", "error", err)
+		os.Exit(exitConnection)
+	}
+
+	file := createArtifactCSV("canary", "insert", dbTarget.String(), workersPart(numWorkers))
+	csvWriter := csv.NewWriter(file)
+	if err := csvWriter.Write(canaryCSVHeader); err != nil {
+		logger.Error("Failed to write canary CSV header", "error", err)
+		os.Exit(exitFailure)
+	}
+
+	// the canaries of CrateDB's tenants read the tables of tenant 1, MobilityDB's tenants share the tables
+	tenant := 0
+	if tenancy != nil {
+		tenant = 1
+	}
+	queries := make([]canaryQuery, len(canaryQueries))
+	for i, q := range canaryQueries {
+		queries[i] = canaryQuery{Name: q.Name, SQL: tenancy.PrefixTables(tenant, q.SQL)}
+	}
+	canary := &canaryRunner{conn: conn, queries: queries, csvWriter: csvWriter}
+
+	canaryCtx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-canaryCtx.Done():
+				return
+			case <-ticker.C:
+				canary.round(canaryCtx)
+			}
+		}
+	}()
+	logger.Info("Executing canary queries during the inserts", "interval", interval, "queries", len(queries))
+
+	return func() {
+		cancel()
+		wg.Wait()
+		csvWriter.Flush()
+		file.Close()
+		conn.Close(context.Background())
+	}
+}
+
+type canaryRunner struct {
+	conn      *pgx.Conn
+	queries   []canaryQuery
+	csvWriter *csv.Writer
+}
+
+// round executes every canary query once, in order
+func (c *canaryRunner) round(ctx context.Context) {
+	var records [][]string
+	tableRows := int64(-1) // unknown until the count succeeded
+	for i, q := range c.queries {
+		startTime := time.Now()
+		rowsCount, count, err := c.execute(ctx, q.SQL)
+		endTime := time.Now()
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil && canaryQueries[i].SQL == canaryCountQuery {
+			tableRows = count
+		}
+		var errorMsg string
+		if err != nil {
+			errorMsg = err.Error()
+			logger.Warn("Canary query failed", "query", q.Name, "error", err)
+		}
+		records = append(records, []string{
+			runID,
+			q.Name,
+			startTime.Format(time.RFC3339Nano),
+			endTime.Format(time.RFC3339Nano),
+			strconv.FormatInt(endTime.Sub(startTime).Microseconds(), 10),
+			strconv.FormatInt(results.MonotonicUs(startTime), 10),
+			strconv.FormatBool(err == nil),
+			strconv.Itoa(rowsCount),
+			"", // tableRows once the round finished
+			errorMsg,
+		})
+		statsd.Timing("insert.canary."+q.Name, endTime.Sub(startTime))
+	}
+	for _, record := range records {
+		if tableRows >= 0 {
+			record[8] = strconv.FormatInt(tableRows, 10)
+		}
+		if err := c.csvWriter.Write(record); err != nil {
+			logger.Error("Failed to write canary CSV record", "error", err)
+		}
+	}
+	c.csvWriter.Flush()
+	logger.Debug("Executed canary queries", "tableRows", tableRows)
+}
+
+// execute consumes the rows of the query, returning their number and the first column of the first row if it is an integer
+func (c *canaryRunner) execute(ctx context.Context, sql string) (int, int64, error) {
+	rows, err := c.conn.Query(ctx, sql)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer rows.Close()
+	rowsCount := 0
+	var first int64
+	for rows.Next() {
+		if rowsCount == 0 {
+			if values, err := rows.Values(); err == nil && len(values) > 0 {
+				if n, ok := values[0].(int64); ok {
+					first = n
+				}
+			}
+		}
+		rowsCount++
+	}
+	return rowsCount, first, rows.Err()
+}
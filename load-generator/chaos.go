@@ -0,0 +1,296 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"load-generator/internal/targets"
+)
+
+// kinds of faults the injector supports
+const (
+	faultRestart = "restart" // restart the container of the database
+	faultDrop    = "drop"    // terminate the connections of the workers
+)
+
+// Fault is a fault injected at an offset from the start of the run
+type Fault struct {
+	Kind string
+	At   time.Duration
+}
+
+// FaultReport describes an injected fault and how the workers recovered from it
+type FaultReport struct {
+	Kind              string     `json:"kind"`
+	AtSec             float64    `json:"atSec"` // configured offset from the start of the run
+	InjectedAt        time.Time  `json:"injectedAt"`
+	InjectDurationSec float64    `json:"injectDurationSec"` // e.g. the time docker restart took
+	Error             string     `json:"error,omitempty"`
+	RecoveredAt       *time.Time `json:"recoveredAt,omitempty"` // end of the first successful operation started after the fault was injected
+	RecoverySec       float64    `json:"recoverySec,omitempty"`
+	FailedOperations  int        `json:"failedOperations"` // operations failed after the injection until the recovery
+}
+
+// chaosOptions are the flags of the insert and query benchmarks injecting faults into the database during the run
+type chaosOptions struct {
+	faults          string
+	container       string
+	recoveryTimeout time.Duration
+}
+
+func (o *chaosOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.faults, "chaos", "", "Inject faults at offsets from the start of the run to measure availability, comma separated kind@offset, e.g. restart@2m,drop@5m.\nrestart restarts the container of -chaos-container, drop terminates the connections of the workers (mobilitydbc only).\nThe recovery time and failed operations of each fault are written to the summary file")
+	fs.StringVar(&o.container, "chaos-container", "", "Docker container of the database restarted by restart faults, e.g. loadgen-cratedb-cratedb-1 of env up cratedb")
+	fs.DurationVar(&o.recoveryTimeout, "chaos-recovery-timeout", 2*time.Minute, "Time a worker keeps reconnecting after losing its connection before its operations fail")
+}
+
+// FaultInjector injects the faults of a run and observes the operations to report the recovery from them.
+// All methods are no-ops on a nil FaultInjector.
+type FaultInjector struct {
+	faults          []Fault
+	container       string
+	connString      string
+	recoveryTimeout time.Duration
+
+	mu      sync.Mutex
+	reports []FaultReport
+	pending []int // indexes of the reports not yet recovered from
+}
+
+var faultInjector *FaultInjector
+
+// parseFaults parses the comma separated kind@offset list of -chaos
+func parseFaults(s string, dbTarget targets.DBTarget) ([]Fault, error) {
+	var faults []Fault
+	for _, spec := range strings.Split(s, ",") {
+		kind, at, ok := strings.Cut(strings.TrimSpace(spec), "@")
+		if !ok {
+			return nil, fmt.Errorf("Invalid fault %q, expected kind@offset, e.g. restart@2m", spec)
+		}
+		offset, err := time.ParseDuration(at)
+		if err != nil || offset < 0 {
+			return nil, fmt.Errorf("Invalid offset of fault %q, expected a positive duration, e.g. 2m", spec)
+		}
+		switch kind {
+		case faultRestart:
+		case faultDrop:
+			if dbTarget != targets.MobilityDB {
+				return nil, fmt.Errorf("drop faults are only supported by mobilitydbc, CrateDB can't terminate connections, use restart")
+			}
+		default:
+			return nil, fmt.Errorf("Unknown fault kind %q, expected restart or drop", kind)
+		}
+		faults = append(faults, Fault{Kind: kind, At: offset})
+	}
+	slices.SortStableFunc(faults, func(a, b Fault) int { return cmp.Compare(a.At, b.At) })
+	return faults, nil
+}
+
+// mustLoad sets up the fault injector of -chaos, nil without faults
+func (o *chaosOptions) mustLoad(dbTarget targets.DBTarget, connString string) *FaultInjector {
+	if o.faults == "" {
+		return nil
+	}
+	faults, err := parseFaults(o.faults, dbTarget)
+	if err != nil {
+		logger.Error("Invalid CLI argument", "argument", "chaos", "error", err)
+		os.Exit(exitConfig)
+	}
+	if slices.ContainsFunc(faults, func(f Fault) bool { return f.Kind == faultRestart }) {
+		if o.container == "" {
+			logger.Error("Invalid CLI argument", "argument", "chaos-container", "error", "restart faults require the container of the database")
+			os.Exit(exitConfig)
+		}
+		if _, err := exec.LookPath("docker"); err != nil {
+			logger.Error("Unable to find docker for restart faults", "error", err)
+			os.Exit(exitConfig)
+		}
+	}
+	reconnectTimeout = max(reconnectTimeout, o.recoveryTimeout)
+	return &FaultInjector{
+		faults:          faults,
+		container:       o.container,
+		connString:      connString,
+		recoveryTimeout: o.recoveryTimeout,
+	}
+}
+
+// Start injects the faults in the background at their offsets from now.
+// Returned function stops injecting faults.
+func (f *FaultInjector) Start(ctx context.Context) func() {
+	if f == nil {
+		return func() {}
+	}
+	logger.Info("Injecting faults during the run", "faults", f.faults, "container", f.container, "recoveryTimeout", f.recoveryTimeout)
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f.run(ctx, time.Now())
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func (f *FaultInjector) run(ctx context.Context, startTime time.Time) {
+	for _, fault := range f.faults {
+		timer := time.NewTimer(time.Until(startTime.Add(fault.At)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		f.inject(ctx, fault)
+	}
+}
+
+func (f *FaultInjector) inject(ctx context.Context, fault Fault) {
+	report := FaultReport{Kind: fault.Kind, AtSec: fault.At.Seconds(), InjectedAt: time.Now()}
+	f.mu.Lock()
+	f.reports = append(f.reports, report)
+	i := len(f.reports) - 1
+	f.pending = append(f.pending, i)
+	f.mu.Unlock()
+	logger.Warn("Injecting fault", "kind", fault.Kind, "atSec", fault.At.Seconds())
+
+	var err error
+	switch fault.Kind {
+	case faultRestart:
+		var out []byte
+		if out, err = exec.CommandContext(ctx, "docker", "restart", f.container).CombinedOutput(); err != nil {
+			err = fmt.Errorf("docker restart %s: %w: %s", f.container, err, strings.TrimSpace(string(out)))
+		}
+	case faultDrop:
+		err = f.dropConnections(ctx)
+	}
+	duration := time.Since(report.InjectedAt)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reports[i].InjectDurationSec = duration.Seconds()
+	if err != nil {
+		f.reports[i].Error = err.Error()
+		logger.Error("Unable to inject fault", "kind", fault.Kind, "error", err)
+		return
+	}
+	logger.Info("Injected fault", "kind", fault.Kind, "durationSec", duration.Seconds())
+}
+
+// dropConnections terminates all other client connections to the database, including the ones of the samplers
+func (f *FaultInjector) dropConnections(ctx context.Context) error {
+	conn, err := pgx.Connect(ctx, f.connString)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+	var terminated int
+	err = conn.QueryRow(ctx, `SELECT count(*) FROM (
+		SELECT pg_terminate_backend(pid) FROM pg_stat_activity
+		WHERE datname = current_database() AND pid <> pg_backend_pid() AND backend_type = 'client backend'
+	) AS terminated`).Scan(&terminated)
+	if err == nil {
+		logger.Info("Terminated connections", "count", terminated)
+	}
+	return err
+}
+
+// Observe records the outcome of an operation, the first successful operation started after a fault ends its recovery
+func (f *FaultInjector) Observe(startTime, endTime time.Time, succeeded, failed int) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pending = slices.DeleteFunc(f.pending, func(i int) bool {
+		report := &f.reports[i]
+		if endTime.Before(report.InjectedAt) {
+			return false
+		}
+		if succeeded > 0 && startTime.After(report.InjectedAt) {
+			report.RecoveredAt = &endTime
+			report.RecoverySec = endTime.Sub(report.InjectedAt).Seconds()
+			logger.Info("Recovered from fault", "kind", report.Kind, "recoverySec", report.RecoverySec, "failedOperations", report.FailedOperations)
+			return true
+		}
+		report.FailedOperations += failed
+		return false
+	})
+}
+
+// Report returns the reports of the injected faults, nil without faults
+func (f *FaultInjector) Report() []FaultReport {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.reports)
+}
+
+// reconnectTimeout is the time a worker keeps connecting after failing to connect or losing its connection,
+// set by -reconnect-timeout and raised by -chaos-recovery-timeout and -failover-timeout
+var reconnectTimeout = 5 * time.Second
+
+// connectWorker connects a worker to the database, retrying with backoff until reconnectTimeout,
+// so a transient network blip while the workers start doesn't fail the run
+func connectWorker(ctx context.Context, id int, connString string) (*pgx.Conn, error) {
+	conn, err := connectWithBackoff(ctx, id, connString, time.Now().Add(reconnectTimeout))
+	if err != nil {
+		return nil, fmt.Errorf("retried for %s: %w", reconnectTimeout, err)
+	}
+	return conn, nil
+}
+
+// reconnectWorker returns the connection of the worker, replaced by a new one if it was closed, e.g. by a database restart or a network blip,
+// and the time spent reconnecting, 0 if the connection was open. The worker retries until reconnectTimeout,
+// the closed connection is returned if no new one could be established, its operations then fail.
+func reconnectWorker(ctx context.Context, id int, conn *pgx.Conn, connString string) (*pgx.Conn, time.Duration) {
+	if !conn.IsClosed() {
+		return conn, 0
+	}
+	startTime := time.Now()
+	newConn, err := connectWithBackoff(ctx, id, connString, startTime.Add(reconnectTimeout))
+	if err != nil {
+		logger.Warn("Worker unable to reconnect to db", "id", id, "error", err)
+		return conn, time.Since(startTime)
+	}
+	logger.Info("Worker reconnected to db", "id", id, "durationSec", time.Since(startTime).Seconds())
+	failoverTracker.Reconnected(id, connEndpoint(conn), startTime, newConn)
+	return newConn, time.Since(startTime)
+}
+
+// connectWithBackoff connects until the deadline, doubling the wait between attempts up to 2s
+func connectWithBackoff(ctx context.Context, id int, connString string, deadline time.Time) (*pgx.Conn, error) {
+	backoff := 100 * time.Millisecond
+	for {
+		connectCtx, cancel := context.WithDeadline(ctx, deadline)
+		conn, err := pgx.Connect(connectCtx, connString)
+		cancel()
+		if err == nil {
+			return conn, nil
+		}
+		if ctx.Err() != nil || time.Now().Add(backoff).After(deadline) {
+			return nil, err
+		}
+		logger.Debug("Worker unable to connect to db, retrying", "id", id, "backoff", backoff, "error", err)
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, 2*time.Second)
+	}
+}
@@ -0,0 +1,1207 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"load-generator/internal/results"
+	"load-generator/internal/targets"
+	"load-generator/internal/workload"
+)
+
+type command struct {
+	Name        string
+	Description string
+	Run         func(args []string)
+}
+
+var commands []command
+
+// assigned in init as replay looks up the replayed command in the table
+func init() {
+	commands = []command{
+		{"init", "Create the tables and insert POIs and localities", runInit},
+		{"cleanup", "Drop the benchmark tables by running the down migrations", runCleanup},
+		{"insert", "Run the insert benchmark with the trip events", runInsert},
+		{"query", "Run the query benchmark with the query templates", runQuery},
+		{"verify", "Render all query templates and check they execute on the database", runVerify},
+		{"verify-schema", "Compare the tables and columns of the database with the migrations", runVerifySchema},
+		{"repl", "Interactively render and execute query templates", runRepl},
+		{"audit", "List the events of a trips file missing in the database as a trips CSV for re-insertion", runAudit},
+		{"equivalence", "Execute the same seeded queries on two databases and report where their results diverge", runEquivalence},
+		{"analyze", "Print summary statistics of results CSV files", runAnalyze},
+		{"report", "Generate a self-contained HTML report of a results CSV file", runReport},
+		{"replay", "Re-execute the identical workload of a run from its manifest", runReplay},
+		{"index-bench", "Measure build time and size of index sets and run the query workload with each", runIndexBench},
+		{"preagg-bench", "Measure refresh latency and staleness of a pre-aggregation of the events under ongoing ingest", runPreaggBench},
+		{"scenario", "Execute the phases of a scenario file sequentially under one run ID", runScenario},
+		{"generate-dataset", "Generate synthetic POIs, localities and trips for quick experiments", runGenerateDataset},
+		{"import-osm", "Convert an OpenStreetMap PBF extract into POIs and localities", runImportOSM},
+		{"scale-dataset", "Write an N times larger trips CSV by cloning the trips of an existing one", runScaleDataset},
+		{"split-dataset", "Shard a trips CSV by trip into files with balanced event counts", runSplitDataset},
+		{"merge-dataset", "Merge trips CSVs into one ordered by timestamp", runMergeDataset},
+		{"downsample-dataset", "Write a smaller trips CSV keeping every N-th complete trip", runDownsampleDataset},
+		{"import-trips", "Convert published e-scooter trip data into a trips CSV", runImportTrips},
+		{"enrich-pois", "Add POIs of the Overpass API to a POI CSV", runEnrichPOIs},
+		{"dataset-validate", "Check trips and POI CSVs for malformed lines before a run", runDatasetValidate},
+		{"coordinator", "Distribute an insert or query run over agents and merge their results", runCoordinator},
+		{"agent", "Execute the share of a distributed run assigned by the coordinator", runAgent},
+		{"mqtt-publish", "Publish trip events to an MQTT broker at a target rate", runMQTTPublish},
+		{"mqtt-ingest", "Insert the trip events of an MQTT broker and measure their end-to-end latency", runMQTTIngest},
+		{"pipeline", "Produce trip events to Kafka and insert them with a consumer per worker, measuring lag and end-to-end latency", runPipeline},
+		{"fleet-gateway", "Serve a gRPC fleet gateway API inserting the streamed trip events of the scooters", runFleetGateway},
+		{"fleet-clients", "Simulate scooters streaming trip events to a fleet gateway over gRPC", runFleetClients},
+		{"smoke", "Init, insert and query a small dataset and assert basic invariants as a sanity check", runSmoke},
+		{"env", "Start pinned-version database containers, optionally running a command against them", runEnv},
+		{"k8s-manifest", "Render Kubernetes Jobs of the coordinator and agents of a distributed run", runK8sManifest},
+	}
+}
+
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags]\n\nCommands:\n", path.Base(os.Args[0]))
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", cmd.Name, cmd.Description)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun '%s <command> -h' to list the flags of a command.\n\n", path.Base(os.Args[0]))
+	printExitCodes(os.Stderr)
+}
+
+func newFlagSet(name, description string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s [flags]\n\n%s\n\nFlags:\n", path.Base(os.Args[0]), name, description)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// explicitFlags returns the names of the flags given on the command line, as opposed to defaults
+func explicitFlags(fs *flag.FlagSet) map[string]bool {
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	return given
+}
+
+// commonOptions are the flags shared by all commands connecting to a database
+type commonOptions struct {
+	dbTargetStr   string
+	connString    string
+	logLevel      string
+	logSample     float64
+	quiet         bool
+	logDir        string
+	resultsDir    string
+	logMaxSizeMB  int64
+	logKeep       int
+	dryRun        bool
+	schemaVariant string
+	schemaPrefix  string
+	datasetTZ     *string
+
+	fs       *flag.FlagSet
+	dbTarget targets.DBTarget
+	logFile  *RotatingFile
+}
+
+func (o *commonOptions) register(fs *flag.FlagSet) {
+	o.fs = fs
+	fs.StringVar(&o.dbTargetStr, "dbTarget", "cratedb", "Target database: cratedb or mobilitydbc")
+	fs.StringVar(&o.connString, "db", envOrDefault("LOADGEN_DB_URL", defaultConnString), "Connection string to use to connect to db, defaults to LOADGEN_DB_URL. The password can be set separately with LOADGEN_DB_PASSWORD or PGPASSWORD")
+	fs.StringVar(&o.logLevel, "log", "INFO", "Set <level> for logging. Available: DEBUG, INFO, WARN")
+	fs.Float64Var(&o.logSample, "log-sample", 1, "Fraction (0-1) of per-operation events written to the log, the results CSV always contains all events")
+	fs.BoolVar(&o.quiet, "quiet", false, "Log only aggregates and errors, the results CSV still contains all events")
+	fs.StringVar(&o.logDir, "log-dir", "./logs", "Directory to write log files to, created if missing")
+	fs.StringVar(&o.resultsDir, "results-dir", "./results", "Directory to write results, summaries and other run artifacts to, created if missing")
+	fs.Int64Var(&o.logMaxSizeMB, "log-max-size", 512, "Rotate the log file once it exceeds <size> MB, 0 disables rotation")
+	fs.IntVar(&o.logKeep, "log-keep", 0, "Keep only the <N> newest rotations of the log file of this run, 0 keeps all")
+	fs.StringVar(&o.schemaVariant, "schema-variant", "", "Migration set to use, a subdirectory of -migrations, e.g. partitioned, whose files replace the migrations of the same name in -migrations. Recorded in the metadata of benchmark runs")
+	fs.StringVar(&o.schemaPrefix, "schema-prefix", "", "Prefix of all benchmark tables, e.g. run42_, rewritten in migrations, generated SQL and query templates, so several runs can share a database")
+	fs.StringVar(&inputCacheDir, "input-cache", inputCacheDir, "Directory to cache https:// and s3:// inputs in after their first download, defaults to LOADGEN_INPUT_CACHE.\nCached inputs are revalidated with their ETag or Last-Modified on every read. Empty streams them on every read, the trips are read more than once by most commands")
+	fs.BoolVar(&o.dryRun, "dry-run", false, "Load and validate the inputs and print the statements that would be executed without connecting to the database")
+	o.datasetTZ = registerDatasetTZ(fs)
+}
+
+// setup creates the run ID, the log file and the logger and parses the db target.
+// numWorkers is only used for the log filename, 0 leaves it out.
+func (o *commonOptions) setup(mode string, numWorkers int) {
+	level := slog.LevelInfo
+	switch o.logLevel {
+	case "DEBUG":
+		level = slog.LevelDebug
+	case "INFO":
+		level = slog.LevelInfo
+	case "WARN":
+		level = slog.LevelWarn
+	default:
+		fmt.Printf("Unknown logging level: %s", o.logLevel)
+		os.Exit(exitConfig)
+	}
+	if o.logSample < 0 || o.logSample > 1 {
+		fmt.Printf("Invalid log sample rate: %g, expected value between 0 and 1", o.logSample)
+		os.Exit(exitConfig)
+	}
+	if o.quiet && level < slog.LevelInfo {
+		level = slog.LevelInfo
+	}
+	eventLogSampler = NewEventLogSampler(o.logSample, o.quiet)
+
+	// the phases of a scenario share the run ID of the scenario
+	runID = envOrDefault(runIDEnv, newUUID())
+	resultsDir = o.resultsDir
+	o.connString = withPasswordFromEnv(o.connString)
+
+	// Create log filename with timestamp and CLI arguments
+	timestamp := time.Now().Format("20060102_150405")
+	workersStr := ""
+	if numWorkers > 0 {
+		workersStr = fmt.Sprintf("_%dw", numWorkers)
+	}
+	logFilename := fmt.Sprintf("load-generator_%s_%s_%s%s_%s.log",
+		mode, o.dbTargetStr, timestamp, workersStr, runID)
+	logFilePath := path.Join(o.logDir, logFilename)
+
+	// Create log file, rotated once it exceeds the configured size
+	logFile, err := NewRotatingFile(logFilePath, o.logMaxSizeMB*1024*1024, o.logKeep)
+	if err != nil {
+		fmt.Printf("Failed to create log file: %v\n", err)
+		os.Exit(exitFailure)
+	}
+	o.logFile = logFile
+
+	// Create multi-writer for both stdout and file
+	multiWriter := io.MultiWriter(os.Stdout, logFile)
+	handler := slog.NewJSONHandler(multiWriter, &slog.HandlerOptions{
+		Level: level,
+	})
+	logger = slog.New(handler).With("runId", runID)
+
+	logger.Info("Log file created", "logFile", logFilePath)
+	registerArtifact(logFilePath)
+
+	dbTarget, err := targets.Parse(o.dbTargetStr)
+	if err != nil {
+		logger.Error("Invalid CLI argument", "argument", "dbTarget", "value", o.dbTargetStr, "expected", "cratedb|mobilitydb")
+		os.Exit(exitConfig)
+	}
+	o.dbTarget = dbTarget
+
+	if err := targets.SetTablePrefix(o.schemaPrefix); err != nil {
+		logger.Error("Invalid CLI argument", "argument", "schema-prefix", "error", err)
+		os.Exit(exitConfig)
+	}
+	mustSetDatasetTZ(*o.datasetTZ)
+}
+
+func (o *commonOptions) close() {
+	if o.logFile != nil {
+		o.logFile.Close()
+	}
+}
+
+// cliParams returns the values of all flags of the command, including defaults, with credentials redacted
+func (o *commonOptions) cliParams() map[string]string {
+	params := make(map[string]string)
+	o.fs.VisitAll(func(f *flag.Flag) {
+		params[f.Name] = redactConnString(f.Value.String())
+	})
+	return params
+}
+
+// benchmarkOptions are the flags shared by the insert and query benchmarks
+type benchmarkOptions struct {
+	numWorkers      int
+	sampleInterval  time.Duration
+	dbStatsInterval time.Duration
+	statsdAddr      string
+	statsdPrefix    string
+	resultsUpload   string
+	s3Endpoint      string
+	s3Region        string
+	flushInterval   time.Duration
+	flushRecords    int
+	resultsDB       string
+	rttSamples      int
+	rttInterval     time.Duration
+	drainTimeout    time.Duration
+	maxDuration     time.Duration
+	pprofAddr       string
+	profile         bool
+	targets         targetsFlag
+	controlAddr     string
+	streamAddr      string
+	workloadRole    string
+	city            string
+	checkDuplicates bool
+	sortResults     string
+	resultShards    bool
+	// -results-granularity, the interval of the aggregates written instead of a row per operation, 0 without
+	resultsGranularity string
+	aggregateInterval  time.Duration
+	gomaxprocs         int
+	cpus               string
+}
+
+func (o *benchmarkOptions) register(fs *flag.FlagSet) {
+	fs.IntVar(&o.numWorkers, "nworkers", 24, "Number of simultanious workers for the benchmark to use")
+	fs.DurationVar(&o.sampleInterval, "sample-interval", 5*time.Second, "Interval for sampling the load-generator's own resource usage into the timeline file, 0 disables")
+	fs.DurationVar(&o.dbStatsInterval, "dbstats-interval", 0, "Interval for collecting server-side database statistics into the dbstats file, 0 disables")
+	fs.StringVar(&o.statsdAddr, "statsd-addr", "", "Address (host:port) of a StatsD daemon to export throughput and latency metrics to, empty disables")
+	fs.StringVar(&o.statsdPrefix, "statsd-prefix", "loadgen", "Prefix for exported StatsD metric names, the db target is appended")
+	fs.StringVar(&o.resultsUpload, "results-upload", "", "Upload results, summary and log file to S3 compatible storage when the run finishes, e.g. s3://bucket/prefix")
+	fs.StringVar(&o.s3Endpoint, "s3-endpoint", envOrDefault("AWS_ENDPOINT_URL", "https://s3.amazonaws.com"), "Endpoint of the S3 compatible storage used by -results-upload")
+	fs.StringVar(&o.s3Region, "s3-region", envOrDefault("AWS_REGION", "us-east-1"), "Region of the S3 compatible storage used by -results-upload")
+	fs.DurationVar(&o.flushInterval, "flush-interval", 10*time.Second, "Flush and fsync the results CSV file every <interval>, 0 disables")
+	fs.IntVar(&o.flushRecords, "flush-records", 10000, "Flush and fsync the results CSV file every <N> records, 0 disables")
+	fs.BoolVar(&o.resultShards, "result-shards", false, "Let every worker of insert and query write and record its results into a shard file of its own instead of sending them to the single CSV writer,\n"+
+		"which limits the achievable load at high worker counts. The shards are merged into the results CSV file ordered by start time when the run finishes")
+	fs.StringVar(&o.resultsGranularity, "results-granularity", "event", "Rows of the results CSV file of insert and query: event writes a row per operation, aggregate:<interval>, e.g. aggregate:10s,\n"+
+		"a row per interval and job type or template with the count, failures and estimated p50/p95/p99 latencies, keeping the results of multi-day soak runs small")
+	fs.StringVar(&o.sortResults, "sort-results", "", "Sort the results CSV file by startTime or queryIndex (query only) when the run finishes, so runs of the same workload can be diffed\n"+
+		"and analysed in a deterministic order. The whole file is read into memory, empty keeps the order the workers finished in")
+	fs.StringVar(&o.resultsDB, "results-db", os.Getenv("LOADGEN_RESULTS_DB_URL"), "Connection string of a Postgres database to additionally write the run and its events into, empty disables")
+	fs.IntVar(&o.rttSamples, "rtt-samples", 20, "Number of SELECT 1 round trips each worker measures before starting, written to the metadata file, 0 disables")
+	fs.DurationVar(&o.rttInterval, "rtt-interval", 0, "Interval for measuring the round trip time on a dedicated connection during the run, 0 disables")
+	fs.DurationVar(&o.maxDuration, "max-duration", 0, "Stop the run cleanly once it takes longer than <duration>, e.g. 2h, 0 disables")
+	fs.StringVar(&o.pprofAddr, "pprof-addr", "", "Address (host:port) to serve net/http/pprof on during the run, empty disables")
+	fs.BoolVar(&o.profile, "profile", false, "Write a CPU profile of the run and a heap profile at its end into the results directory")
+	fs.StringVar(&o.controlAddr, "control-addr", "", "Address (host:port) to serve the HTTP control API (/status, /summary, /pause, /resume, /abort) on during the run, empty disables")
+	fs.StringVar(&o.streamAddr, "stream-addr", "", "Address (host:port) to serve a WebSocket on during the run, sending the throughput and latency of every second as JSON message, e.g. for a live dashboard, empty disables")
+	fs.Var(&o.targets, "targets", "Run the identical workload sequentially against these comma separated targets, e.g. cratedb,mobilitydbc, and compare them. Repeatable, a connection string is given as target=connString at the end of a value, e.g. -targets cratedb -targets mobilitydbc=postgresql://host1,host2/db, or read from LOADGEN_DB_URL_<TARGET>. {target} in the file paths of other flags, e.g. -queries, is replaced by the target name")
+	fs.DurationVar(&o.drainTimeout, "drain-timeout", 30*time.Second, "Time in-flight operations may take to finish after an interrupt before they are cancelled")
+	fs.DurationVar(&reconnectTimeout, "reconnect-timeout", reconnectTimeout, "Time a worker of insert or query keeps connecting with backoff after failing to connect or losing its connection,\n"+
+		"the operations it reconnected before have the time spent reconnecting in the column reconnectUs of the results file")
+	fs.StringVar(&o.city, "city", "", "City profile the dataset was generated or imported for with -city, recorded in the metadata file")
+	fs.BoolVar(&o.checkDuplicates, "check-duplicates", false, "After the events were ingested, count the event IDs stored more than once, e.g. by batches retried after their connection was lost,\n"+
+		"into the summary. Scans the whole events table, ignored by query")
+	fs.IntVar(&o.gomaxprocs, "gomaxprocs", 0, "Number of OS threads executing Go code simultaneously, 0 keeps the default of the number of CPUs, or of -cpus")
+	fs.StringVar(&o.cpus, "cpus", "", "Limit the load generator to these CPUs, e.g. 0-3,6, so it doesn't compete with other processes of a shared benchmark host.\n"+
+		"Only supported on Linux, empty uses all CPUs")
+	fs.StringVar(&o.workloadRole, "workload-role", "", "Connect the workers as this role set up by init -workload-role instead of the user of -db, with the password from LOADGEN_ROLE_PASSWORD. Samplers and collectors keep using -db")
+}
+
+// workerConnString returns the connection string of the workers, connecting as -workload-role if given
+func (o *benchmarkOptions) workerConnString(connString string) string {
+	if o.workloadRole == "" {
+		return connString
+	}
+	return withWorkloadRole(connString, o.workloadRole)
+}
+
+var errMaxDurationExceeded = errors.New("max duration exceeded")
+
+// withMaxDuration returns a context cancelled once -max-duration is exceeded
+func (o *benchmarkOptions) withMaxDuration(ctx context.Context) (context.Context, context.CancelFunc) {
+	if o.maxDuration <= 0 {
+		return context.WithCancel(ctx)
+	}
+	ctx, cancel := context.WithTimeoutCause(ctx, o.maxDuration, errMaxDurationExceeded)
+	context.AfterFunc(ctx, func() {
+		if errors.Is(context.Cause(ctx), errMaxDurationExceeded) {
+			logger.Warn("Max duration exceeded, stopping the run", "maxDuration", o.maxDuration)
+		}
+	})
+	return ctx, cancel
+}
+
+// benchmarkRun holds the exporters and collectors set up around a single benchmark run
+type benchmarkRun struct {
+	ctx      context.Context
+	mode     string
+	common   *commonOptions
+	opts     *benchmarkOptions
+	metadata RunMetadata
+	uploader *S3Uploader
+	stops    []func()
+}
+
+// startBenchmarkRun sets up the exporters and samplers shared by the insert and query benchmarks.
+// finish has to be called with the summary once the benchmark returned.
+// inputs maps the flags of the input files to their paths, they are hashed into the run manifest.
+func startBenchmarkRun(ctx context.Context, mode string, common *commonOptions, opts *benchmarkOptions, inputs map[string]string, seed *int64) *benchmarkRun {
+	dbTarget := common.dbTarget
+	// the benchmark has to run with run.ctx, so it can be aborted via the control API
+	ctx, abort := context.WithCancelCause(ctx)
+	run := &benchmarkRun{ctx: ctx, mode: mode, common: common, opts: opts}
+	if opts.sortResults != "" && !slices.Contains(results.SortColumns, opts.sortResults) {
+		logger.Error("Invalid CLI argument", "argument", "sort-results", "error", fmt.Sprintf("expected one of %v", results.SortColumns))
+		os.Exit(exitConfig)
+	}
+	if opts.sortResults == "queryIndex" && mode != "query" {
+		logger.Error("Invalid CLI argument", "argument", "sort-results", "error", "only the results of query have a queryIndex")
+		os.Exit(exitConfig)
+	}
+	var err error
+	if opts.aggregateInterval, err = parseResultsGranularity(opts.resultsGranularity); err != nil {
+		logger.Error("Invalid CLI argument", "argument", "results-granularity", "error", err)
+		os.Exit(exitConfig)
+	}
+	if opts.aggregateInterval > 0 && (opts.resultShards || opts.sortResults != "") {
+		logger.Error("Invalid CLI argument", "argument", "results-granularity", "error", "aggregates can't be combined with -result-shards or -sort-results")
+		os.Exit(exitConfig)
+	}
+	cpus := opts.applyCPUControls()
+	run.stops = append(run.stops, func() { abort(nil) })
+
+	if opts.statsdAddr != "" {
+		var err error
+		statsd, err = NewStatsdClient(ctx, opts.statsdAddr, opts.statsdPrefix+"."+dbTarget.String(), time.Second)
+		if err != nil {
+			logger.Error("Unable to set up statsd export", "error", err)
+			os.Exit(exitConfig)
+		}
+		logger.Info("Exporting metrics to statsd", "addr", opts.statsdAddr, "prefix", opts.statsdPrefix)
+	}
+
+	if opts.resultsUpload != "" {
+		uploader, err := NewS3Uploader(opts.resultsUpload, opts.s3Endpoint, opts.s3Region)
+		if err != nil {
+			logger.Error("Unable to set up results upload", "error", err)
+			os.Exit(exitConfig)
+		}
+		run.uploader = uploader
+	}
+
+	run.stops = append(run.stops, startPprofServer(opts.pprofAddr))
+	run.stops = append(run.stops, startControlServer(ctx, abort, opts.controlAddr, mode, dbTarget, opts.numWorkers))
+	run.stops = append(run.stops, startStreamServer(ctx, opts.streamAddr, mode, dbTarget))
+	run.stops = append(run.stops, startProfiling(opts.profile, mode, dbTarget, opts.numWorkers))
+	run.stops = append(run.stops, startResourceSampler(ctx, opts.sampleInterval, mode, dbTarget, opts.numWorkers))
+	run.stops = append(run.stops, startDBStatsCollector(ctx, opts.dbStatsInterval, common.connString, mode, dbTarget, opts.numWorkers))
+
+	if opts.resultsDB != "" {
+		resultsWarehouse = mustOpenResultsWarehouse(ctx, opts.resultsDB, mode, dbTarget, opts.numWorkers, common.cliParams())
+	}
+
+	manifest, err := NewRunManifest(mode, common.cliParams(), inputs)
+	if err != nil {
+		logger.Error("Unable to create run manifest", "error", err)
+		os.Exit(exitConfig)
+	}
+	manifest.Seed = seed
+	writeManifestJSON(manifest, dbTarget, opts.numWorkers)
+
+	run.metadata = NewRunMetadata(mode, dbTarget, opts.numWorkers, common.cliParams())
+	run.metadata.SchemaVariant = common.schemaVariant
+	run.metadata.GOMAXPROCS = runtime.GOMAXPROCS(0)
+	run.metadata.CPUs = formatCPUList(cpus)
+	if opts.city != "" {
+		profile, err := workload.LookupCity(opts.city)
+		if err != nil {
+			logger.Error("Invalid CLI argument", "argument", "city", "error", err)
+			os.Exit(exitConfig)
+		}
+		run.metadata.City = &profile
+	}
+	if dbTarget == targets.CrateDB {
+		run.metadata.TableSettings = readCrateSettings(ctx, common.connString)
+	}
+	if opts.rttSamples > 0 {
+		rttCollector = NewRTTCollector(opts.rttSamples)
+	}
+	run.stops = append(run.stops, rttCollector.StartPeriodic(ctx, common.connString, opts.rttInterval))
+	return run
+}
+
+// addStop registers a function stopping a sampler when the run finishes
+func (r *benchmarkRun) addStop(stop func()) {
+	r.stops = append(r.stops, stop)
+}
+
+// finish stops all samplers, writes the metadata and summary files and the results to the warehouse.
+// closeResults has to flush and close the results CSV before the artifacts are uploaded.
+func (r *benchmarkRun) finish(summary RunSummary, closeResults func()) {
+	for i := len(r.stops) - 1; i >= 0; i-- {
+		r.stops[i]()
+	}
+	if summary.Aborted {
+		summary.AbortReason = "interrupted"
+		switch cause := context.Cause(r.ctx); {
+		case errors.Is(cause, errMaxDurationExceeded), errors.Is(cause, errAbortedViaControl):
+			summary.AbortReason = cause.Error()
+		}
+		logger.Warn("Run aborted, the summary contains only the operations finished before",
+			"reason", summary.AbortReason,
+			"mode", summary.Mode,
+			"durationSec", summary.DurationSec,
+			"totalOperations", summary.TotalOperations,
+			"totalSuccesses", summary.TotalSuccesses,
+			"totalFailures", summary.TotalFailures,
+		)
+	}
+	summary.Faults = faultInjector.Report()
+	summary.Failovers = failoverTracker.Report()
+	summary.Tenants = tenancy.Report()
+	summary.Fairness = workerFairness.Report()
+	if r.opts.checkDuplicates && r.mode != "query" {
+		summary.Duplicates = detectDuplicates(context.Background(), r.common.connString, r.common.dbTarget)
+	}
+	// Round(0) strips the monotonic reading, so the difference is the one of the wall clock
+	wallDuration := summary.EndTime.Round(0).Sub(summary.StartTime.Round(0))
+	if step := wallDuration - summary.EndTime.Sub(summary.StartTime); step.Abs() >= time.Millisecond {
+		summary.WallClockStepMs = float64(step) / float64(time.Millisecond)
+		logger.Warn("Wall clock was adjusted during the run, the timestamps of the results are shifted accordingly", "stepMs", summary.WallClockStepMs)
+	}
+	r.metadata.RTT = rttCollector.Report()
+	r.metadata.NetworkImpairments = networkImpairments.Report()
+	writeMetadataJSON(r.metadata)
+	writeSummaryJSON(summary)
+	resultsWarehouse.Finish(summary)
+	statsd.Close()
+
+	closeResults()
+	if r.uploader != nil {
+		uploadArtifacts(r.uploader)
+	}
+}
+
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
+	// restore the default behaviour after the first signal, so a second SIGINT terminates immediately
+	context.AfterFunc(ctx, stop)
+	return ctx, stop
+}
+
+func runInit(args []string) {
+	fs := newFlagSet("init", "Create the tables by running the migrations and insert POIs, localities and the optional context data.")
+	var common commonOptions
+	common.register(fs)
+	localitiesPath := fs.String("localities", "../escooter-trips-generator/output/berlin-localities.geojson", "Path or https:// or s3:// URL of a GeoJSON, GeoParquet (.parquet) or shapefile (.shp or .zip) file containing localities")
+	localityFields := registerLocalityFields(fs)
+	poisPath := fs.String("pois", "../escooter-trips-generator/output/berlin-pois.csv", "Path or https:// or s3:// URL of a CSV or GeoParquet (.parquet) file containing POIs")
+	noParkingZonesPath := fs.String("no-parking-zones", "", "Optional GeoJSON or GeoParquet (.parquet) file of no-parking zones with the properties zone_id and name, loaded into no_parking_zones")
+	weatherPath := fs.String("weather", "", "Optional CSV file of weather observations with the columns observed_at, temperature_c, precipitation_mm and wind_speed_ms, loaded into weather_observations")
+	migrationsDir := fs.String("migrations", "./migrations", "Directory containing migration files")
+	forceMigrations := fs.Bool("force-migrations", false, "Re-execute migrations already recorded as applied in schema_migrations")
+	var params targets.MigrationParams
+	fs.IntVar(&params.Shards, "shards", 0, "Number of shards of the events table, available as {{.Shards}} in migration files, 0 uses the default of the migration")
+	fs.StringVar(&params.Replicas, "replicas", "", "Number of replicas of the events table, e.g. 1 or 0-all for CrateDB, available as {{.Replicas}} in migration files")
+	fs.StringVar(&params.ChunkInterval, "chunk-interval", "", "Time interval of a partition or chunk, e.g. month for CrateDB or '7 days' for Timescale, available as {{.ChunkInterval}} in migration files")
+	var crateSettings targets.CrateSettings
+	fs.StringVar(&crateSettings.ColumnPolicy, "column-policy", "", "CrateDB column_policy of the events table: strict or dynamic, empty keeps the setting of the migration")
+	fs.StringVar(&crateSettings.RefreshInterval, "refresh-interval", "", "CrateDB refresh_interval of the events table, e.g. 1s, 0 disables the periodic refresh, empty keeps the setting of the migration")
+	fs.StringVar(&crateSettings.TranslogDurability, "translog-durability", "", "CrateDB translog.durability of the events table: request or async, empty keeps the setting of the migration")
+	precreatePartitions := fs.String("precreate-partitions", "", "Trip events CSV whose time range the partitions of the events table are created for at init, so the partition creation is excluded from ingest measurements. Requires a partitioned -schema-variant, the partition size is -chunk-interval")
+	workloadRole := fs.String("workload-role", "", "Create this login role, if missing, and grant it only reading and writing rows of the benchmark tables, for insert and query -workload-role. The password is read from LOADGEN_ROLE_PASSWORD")
+	analyze := fs.Bool("analyze", true, "Refresh (CrateDB) or analyze (MobilityDB) all tables after loading and record the durations in the init summary")
+	onExistingStr := fs.String("on-existing", string(targets.OnExistingFail), "Handling of reference data already in the database: fail, skip keeps it or truncate deletes it before inserting")
+	simplifyTolerance := fs.Float64("simplify-tolerance", 0, "Simplify the locality geometries with Douglas-Peucker, dropping positions closer than <tolerance> degrees to the simplified ring, e.g. 0.0001 (about 10 m), 0 disables")
+	invalidGeometries := fs.String("invalid-geometries", invalidGeometriesSkip, "Handling of localities with unclosed, too short or self-intersecting rings: fail, skip or repair.\n"+
+		"repair closes the rings, self-intersections only on MobilityDB with ST_MakeValid. Rings are always oriented by the right-hand rule of RFC 7946")
+	var tenants tenantOptions
+	tenants.register(fs)
+	fs.Parse(args)
+
+	ctx, stop := signalContext()
+	defer stop()
+	common.setup("init", 0)
+	defer common.close()
+	tenancy = tenants.mustLoad(common.dbTarget, common.schemaVariant)
+	if len(tenancy.SchemaTenants()) > 1 && (*precreatePartitions != "" || *workloadRole != "") {
+		logger.Error("Invalid CLI argument", "argument", "tenants", "error", "-precreate-partitions and -workload-role only handle the tables of a single schema, they are not supported with -tenants on cratedb")
+		os.Exit(exitConfig)
+	}
+	if err := parseInvalidGeometries(*invalidGeometries); err != nil {
+		logger.Error("Invalid CLI argument", "argument", "invalid-geometries", "error", err)
+		os.Exit(exitConfig)
+	}
+	onExisting, err := targets.ParseOnExisting(*onExistingStr)
+	if err != nil {
+		logger.Error("Invalid CLI argument", "argument", "on-existing", "error", err)
+		os.Exit(exitConfig)
+	}
+	if err := crateSettings.Validate(); err != nil {
+		logger.Error("Invalid CLI argument", "argument", "column-policy, refresh-interval or translog-durability", "error", err)
+		os.Exit(exitConfig)
+	}
+	if !crateSettings.IsZero() && common.dbTarget != targets.CrateDB {
+		logger.Error("Invalid CLI argument", "argument", "column-policy, refresh-interval or translog-durability", "error", "only supported by cratedb")
+		os.Exit(exitConfig)
+	}
+
+	localities := mustLoadLocalities(*localitiesPath, *localityFields)
+	logger.Info("Loaded and parsed localities", "count", len(localities))
+	var simplification *GeometrySimplification
+	if *simplifyTolerance < 0 {
+		logger.Error("Invalid CLI argument", "argument", "simplify-tolerance", "error", "negative tolerance")
+		os.Exit(exitConfig)
+	} else if *simplifyTolerance > 0 {
+		simplification = &GeometrySimplification{Tolerance: *simplifyTolerance}
+		localities, simplification.PositionsBefore, simplification.PositionsAfter = simplifyLocalities(localities, *simplifyTolerance)
+	}
+	localities = validateLocalities(localities, *invalidGeometries, common.dbTarget)
+	makeValid := *invalidGeometries == invalidGeometriesRepair
+
+	pois := mustLoadPOIs(*poisPath)
+	logger.Info("Loaded and parsed pois", "count", len(pois))
+
+	opts := targets.InitOptions{
+		MigrationsDir:       *migrationsDir,
+		SchemaVariant:       common.schemaVariant,
+		ForceMigrations:     *forceMigrations,
+		Params:              params,
+		MakeValidGeometries: makeValid,
+		OnExisting:          onExisting,
+		Fingerprints: map[string]targets.DatasetFingerprint{
+			"pois":       fingerprintDataset("pois", "init", *poisPath, len(pois)),
+			"localities": fingerprintDataset("localities", "init", *localitiesPath, len(localities)),
+		},
+	}
+	var partitionsFrom, partitionsTo time.Time
+	if *precreatePartitions != "" {
+		if partitionsFrom, partitionsTo, err = workload.ReadTimeRange(ctx, *precreatePartitions); err != nil {
+			logger.Error("Unable to read the time range of trip events", "filename", *precreatePartitions, "error", err)
+			os.Exit(exitConfig)
+		}
+		logger.Info("Read time range of trip events", "from", partitionsFrom, "to", partitionsTo)
+	}
+	if *noParkingZonesPath != "" {
+		opts.NoParkingZones = mustLoadNoParkingZones(*noParkingZonesPath)
+		opts.Fingerprints["no_parking_zones"] = fingerprintDataset("no_parking_zones", "init", *noParkingZonesPath, len(opts.NoParkingZones))
+		logger.Info("Loaded and parsed no-parking zones", "count", len(opts.NoParkingZones))
+	}
+	if *weatherPath != "" {
+		opts.Weather = mustLoadWeatherObservations(*weatherPath)
+		opts.Fingerprints["weather_observations"] = fingerprintDataset("weather_observations", "init", *weatherPath, len(opts.Weather))
+		logger.Info("Loaded and parsed weather observations", "count", len(opts.Weather))
+	}
+
+	// initialize tables and insert POIs and Localities
+	logger.Info("Starting load-generator with following cli arguments",
+		"mode", "init",
+		"log", common.logLevel,
+		"connString", redactConnString(common.connString),
+		"dbTarget", common.dbTarget.String(),
+		"pois", *poisPath,
+		"localities", *localitiesPath,
+		"noParkingZones", *noParkingZonesPath,
+		"weather", *weatherPath,
+		"migrations", *migrationsDir,
+		"schemaVariant", common.schemaVariant,
+		"forceMigrations", *forceMigrations,
+		"invalidGeometries", *invalidGeometries,
+		"simplifyTolerance", *simplifyTolerance,
+		"onExisting", onExisting,
+		"analyze", *analyze,
+		"precreatePartitions", *precreatePartitions,
+		"workloadRole", *workloadRole,
+		"columnPolicy", crateSettings.ColumnPolicy,
+		"refreshInterval", crateSettings.RefreshInterval,
+		"translogDurability", crateSettings.TranslogDurability,
+		"shards", params.Shards,
+		"replicas", params.Replicas,
+		"chunkInterval", params.ChunkInterval,
+	)
+	if common.dryRun {
+		if err := dryRunInit(common.dbTarget, pois, localities, opts, partitionsFrom, partitionsTo, *workloadRole, crateSettings); err != nil {
+			logger.Error("Dry run failed", "error", err)
+			os.Exit(exitConfig)
+		}
+		return
+	}
+
+	logger.Info("Initializing Database", "databaseType", common.dbTarget.String(), "connString", redactConnString(common.connString), "poiCount", len(pois), "localityCount", len(localities))
+	conn, err := pgx.Connect(ctx, common.connString)
+	if err != nil {
+		logger.Error("Unable to connect to database", "error", err)
+		os.Exit(exitConnection)
+	}
+	defer conn.Close(context.Background())
+	logger.Info("Connected to database", "db", common.dbTarget)
+
+	summary := InitSummary{DBTarget: common.dbTarget.String(), SchemaVariant: common.schemaVariant, StartTime: time.Now(), Simplification: simplification, Tenants: tenants.tenants}
+	// every tenant of cratedb gets the tables of the migrations in its own schema
+	for _, tenant := range tenancy.SchemaTenants() {
+		if tenant > 0 {
+			if err := targets.UseTenantSchema(ctx, conn, tenant); err != nil {
+				logger.Error("Unable to initialize database", "error", err)
+				os.Exit(exitFailure)
+			}
+			logger.Info("Initializing the tables of tenant", "tenant", tenant, "schema", targets.TenantSchema(tenant))
+		}
+		if err := targets.Initialize(ctx, conn, common.dbTarget, pois, localities, opts, logger); err != nil {
+			logger.Error("Unable to initialize database", "error", err)
+			os.Exit(exitFailure)
+		}
+		if common.dbTarget == targets.CrateDB {
+			if err := targets.ApplyCrateSettings(ctx, conn, crateSettings, logger); err != nil {
+				logger.Error("Unable to apply table settings", "error", err)
+				os.Exit(exitFailure)
+			}
+		}
+		if *analyze {
+			statistics, err := targets.CollectStatistics(ctx, conn, common.dbTarget, logger)
+			summary.Statistics = append(summary.Statistics, statistics...)
+			if err != nil {
+				logger.Error("Unable to collect statistics", "error", err)
+				os.Exit(exitFailure)
+			}
+		}
+	}
+	if common.dbTarget == targets.CrateDB {
+		settings, err := targets.ReadCrateSettings(ctx, conn)
+		if err != nil {
+			logger.Error("Unable to read table settings", "error", err)
+			os.Exit(exitFailure)
+		}
+		summary.TableSettings = &settings
+	}
+	if *precreatePartitions != "" {
+		partitionInterval := cmp.Or(params.ChunkInterval, "month")
+		start := time.Now()
+		created, err := targets.PrecreatePartitions(ctx, conn, common.dbTarget, partitionInterval, partitionsFrom, partitionsTo, logger)
+		if err != nil {
+			logger.Error("Unable to pre-create partitions", "error", err)
+			os.Exit(exitFailure)
+		}
+		summary.Partitions = &PrecreatedPartitions{
+			Interval:    partitionInterval,
+			From:        partitionsFrom,
+			To:          partitionsTo,
+			Created:     created,
+			DurationSec: time.Since(start).Seconds(),
+		}
+	}
+	if *workloadRole != "" {
+		if _, err := targets.SetupWorkloadRole(ctx, conn, common.dbTarget, *workloadRole, os.Getenv("LOADGEN_ROLE_PASSWORD"), logger); err != nil {
+			logger.Error("Unable to set up workload role", "error", err)
+			os.Exit(exitFailure)
+		}
+		summary.WorkloadRole = *workloadRole
+	}
+	summary.EndTime = time.Now()
+	summary.DurationSec = summary.EndTime.Sub(summary.StartTime).Seconds()
+	writeInitSummaryJSON(summary)
+}
+
+func runCleanup(args []string) {
+	fs := newFlagSet("cleanup", "Drop the benchmark tables and indexes by running the *.down.sql migrations in reverse order,\nso the next init starts from an empty database.")
+	var common commonOptions
+	common.register(fs)
+	migrationsDir := fs.String("migrations", "./migrations", "Directory containing migration files")
+	var tenants tenantOptions
+	tenants.register(fs)
+	fs.Parse(args)
+
+	ctx, stop := signalContext()
+	defer stop()
+	common.setup("cleanup", 0)
+	defer common.close()
+	tenancy = tenants.mustLoad(common.dbTarget, common.schemaVariant)
+
+	if common.dryRun {
+		if err := dryRunCleanup(common.dbTarget, *migrationsDir, common.schemaVariant); err != nil {
+			logger.Error("Dry run failed", "error", err)
+			os.Exit(exitConfig)
+		}
+		return
+	}
+
+	conn, err := pgx.Connect(ctx, common.connString)
+	if err != nil {
+		logger.Error("Unable to connect to database", "error", err)
+		os.Exit(exitConnection)
+	}
+	defer conn.Close(context.Background())
+
+	for _, tenant := range tenancy.SchemaTenants() {
+		if tenant > 0 {
+			if err := targets.UseTenantSchema(ctx, conn, tenant); err != nil {
+				logger.Error("Unable to clean up database", "error", err)
+				os.Exit(exitFailure)
+			}
+			logger.Info("Cleaning up the tables of tenant", "tenant", tenant, "schema", targets.TenantSchema(tenant))
+		}
+		if err := targets.Cleanup(ctx, conn, *migrationsDir, common.schemaVariant, logger); err != nil {
+			logger.Error("Unable to clean up database", "error", err)
+			os.Exit(exitFailure)
+		}
+	}
+	logger.Info("Cleaned up database", "dbTarget", common.dbTarget.String(), "migrations", *migrationsDir, "schemaVariant", common.schemaVariant)
+}
+
+func runInsert(args []string) {
+	fs := newFlagSet("insert", "Insert the trip events with concurrent workers and record the latency of every batch.")
+	var common commonOptions
+	common.register(fs)
+	var opts benchmarkOptions
+	opts.register(fs)
+	tripsPath := fs.String("trips", "../escooter-trips-generator/output/escooter-trips-small.csv", "Path or https:// or s3:// URL of a CSV file containing the escooter trip events")
+	source := fs.String("source", "", "Consume the trip events from a Kafka topic instead of -trips, kafka://broker:port/topic. Records are JSON objects\nor CSV lines of the trips file's columns. The run ends at the end of the topic when it started, or with ?follow=true waits for new events\nuntil interrupted or -max-duration, the trips table is then not built")
+	batchSize := fs.Int("batch-size", 1000, "Number of trip events to insert per sent request")
+	useBulkInsert := fs.Bool("bulk-insert", false, "Insert rows using UNNEST, one query with many inserts")
+	idempotentInserts := fs.Bool("idempotent-inserts", false, "Insert with ON CONFLICT DO NOTHING, so events already stored, e.g. by a retried batch or an earlier run of the same file,\n"+
+		"are skipped instead of failing or being stored twice. Compare with a run without it to measure the overhead of the conflict checks")
+	rate := fs.Float64("rate", 0, "Send at most <rate> trip events per second to the workers, 0 inserts as fast as possible")
+	storageInterval := fs.Duration("storage-interval", 0, "Interval for sampling table and WAL size during insert runs into the storage file, 0 disables")
+	canaryInterval := fs.Duration("canary-interval", 0, "Interval for executing a fixed set of canary read queries on a dedicated connection during the inserts,\n"+
+		"their latency and the number of events in the table are written to the canary file, 0 disables. With -tenants on cratedb they read the tables of tenant 1")
+	geofenceInterval := fs.Duration("geofence-interval", 0, "Interval for executing the geofence query templates of -geofence-queries on a dedicated connection during the inserts, over the events inserted\n"+
+		"since the previous round and the next locality of the localities table, e.g. to detect trips entering a locality as they arrive.\n"+
+		"Their latency and the number of trips found are written to the geofence file, 0 disables. With -tenants on cratedb they read the tables of tenant 1")
+	geofenceQueries := fs.String("geofence-queries", "./schemas/{target}-geofence-read-queries.tmpl", "Path to a file containing the query templates of -geofence-interval, {target} is replaced by -dbTarget")
+	reconcile := fs.Bool("reconcile", false, "After the inserts, count the stored events of every trip and compare them with -trips, mismatching trips are written to the reconciliation file\n"+
+		"and the run fails with exit code 5. Expects the table to contain only the events of -trips, e.g. after init")
+	checkTrips := fs.Bool("check-trips", false, "After the events are aggregated into the trips table, verify that every trip of the stored events has exactly one row containing all its events\n"+
+		"and that no row lacks events, trips with issues are written to the trip integrity file and the run fails with exit code 5. Skipped on cratedb, which has no trips table")
+	eventAttributesPath := fs.String("event-attributes", "", "JSON file mapping additional columns of the trips CSV to columns of escooter_events, e.g. schemas/extended-event-attributes.json\nwith -schema-variant wide, to measure the cost of wider rows")
+	var api apiOptions
+	api.register(fs, "The batches are sent with the request template \"insert\" of -insert-template")
+	var chaos chaosOptions
+	chaos.register(fs)
+	var impairments impairmentOptions
+	impairments.register(fs)
+	var failover failoverOptions
+	failover.register(fs)
+	insertTemplate := fs.String("insert-template", "./schemas/rest-api-insert.tmpl", "Path to a file containing the request template \"insert\" of a batch, used with -target")
+	var tenants tenantOptions
+	tenants.register(fs)
+	var badRowOpts badRowOptions
+	badRowOpts.register(fs)
+	fs.Parse(args)
+
+	if len(opts.targets) > 0 {
+		runMultiTarget("insert", args, opts.targets, common.resultsDir)
+		return
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+	common.setup("insert", opts.numWorkers)
+	defer common.close()
+	ctx, cancel := opts.withMaxDuration(ctx)
+	defer cancel()
+	dbTarget := common.dbTarget
+
+	tripsSource := *tripsPath
+	inputs := map[string]string{"trips": *tripsPath}
+	if *source != "" {
+		if !isKafkaSource(*source) {
+			logger.Error("Invalid CLI argument", "argument", "source", "error", "expected kafka://broker:port/topic, files are given with -trips")
+			os.Exit(exitConfig)
+		}
+		tripsSource, inputs = *source, nil
+		if *reconcile {
+			logger.Error("Invalid CLI argument", "argument", "reconcile", "error", "-reconcile compares the stored events with -trips, not with -source")
+			os.Exit(exitConfig)
+		}
+		if badRowOpts.policy != workload.BadRowFail {
+			logger.Error("Invalid CLI argument", "argument", "on-bad-row", "error", "-on-bad-row handles the rows of -trips, not the records of -source")
+			os.Exit(exitConfig)
+		}
+	}
+	var attributes []workload.EventAttribute
+	if *eventAttributesPath != "" {
+		if *source != "" {
+			logger.Error("Invalid CLI argument", "argument", "event-attributes", "error", "event attributes are only read from -trips files, not from -source")
+			os.Exit(exitConfig)
+		}
+		var err error
+		if attributes, err = workload.LoadEventAttributes(*eventAttributesPath); err != nil {
+			logger.Error("Invalid CLI argument", "argument", "event-attributes", "error", err)
+			os.Exit(exitConfig)
+		}
+		targets.SetEventAttributes(attributes)
+		inputs["event-attributes"] = *eventAttributesPath
+	}
+
+	tenancy = tenants.mustLoad(dbTarget, common.schemaVariant)
+	restAPI := api.mustLoadTarget(*insertTemplate, insertRequestTemplate)
+	if restAPI != nil && tenancy != nil {
+		logger.Error("Invalid CLI argument", "argument", "tenants", "error", "-tenants is not supported with -target, the REST API decides where the events are stored")
+		os.Exit(exitConfig)
+	}
+	if restAPI != nil {
+		if common.dryRun {
+			logger.Error("Invalid CLI argument", "argument", "dry-run", "error", "-dry-run prints the SQL statements, it is not supported with -target")
+			os.Exit(exitConfig)
+		}
+		if *idempotentInserts {
+			logger.Error("Invalid CLI argument", "argument", "idempotent-inserts", "error", "-idempotent-inserts changes the SQL statements, it is not supported with -target")
+			os.Exit(exitConfig)
+		}
+		if *checkTrips {
+			logger.Error("Invalid CLI argument", "argument", "check-trips", "error", "-check-trips is not supported with -target, the REST API builds the trips")
+			os.Exit(exitConfig)
+		}
+		if inputs != nil {
+			inputs["insert-template"] = *insertTemplate
+		}
+	}
+
+	if *checkTrips && dbTarget != targets.MobilityDB {
+		// skipped instead of rejected, so -targets can compare both databases with it
+		logger.Warn("Skipping -check-trips, only mobilitydb aggregates the events into a trips table", "db", dbTarget.String())
+		*checkTrips = false
+	}
+	targets.SetIdempotentInserts(*idempotentInserts)
+
+	logger.Info("Starting load-generator with following cli arguments",
+		"mode", "insert",
+		"target", api.target,
+		"log", common.logLevel,
+		"db", dbTarget.String(),
+		"nworkers", opts.numWorkers,
+		"batchSize", *batchSize,
+		"useBulkInsert", *useBulkInsert,
+		"idempotentInserts", *idempotentInserts,
+		"rate", *rate,
+		"trips", tripsSource,
+		"sampleInterval", opts.sampleInterval,
+		"dbStatsInterval", opts.dbStatsInterval,
+		"storageInterval", *storageInterval,
+		"canaryInterval", *canaryInterval,
+		"geofenceInterval", *geofenceInterval,
+		"reconcile", *reconcile,
+		"checkTrips", *checkTrips,
+		"onBadRow", badRowOpts.policy,
+		"eventAttributes", *eventAttributesPath,
+		"tenants", tenants.tenants,
+		"tenantSkew", tenants.skew,
+	)
+	if common.dryRun {
+		if err := dryRunInsert(dbTarget, tripsSource, attributes, *batchSize, *useBulkInsert); err != nil {
+			logger.Error("Dry run failed", "error", err)
+			os.Exit(exitConfig)
+		}
+		return
+	}
+
+	faultInjector = chaos.mustLoad(dbTarget, common.connString)
+	networkImpairments = impairments.mustLoad(common.connString)
+	workerConnString := failover.mustLoad(networkImpairments.WorkerConnString(opts.workerConnString(common.connString)), dbTarget)
+	run := startBenchmarkRun(ctx, "insert", &common, &opts, inputs, nil)
+	workerFairness = NewWorkerFairness(opts.numWorkers)
+	badRows = badRowOpts.mustLoad(dbTarget, opts.numWorkers)
+	run.addStop(startStorageSampler(ctx, *storageInterval, common.connString, dbTarget, opts.numWorkers))
+	run.addStop(startCanaryQueries(ctx, *canaryInterval, common.connString, dbTarget, opts.numWorkers))
+	run.addStop(startGeofenceQueries(ctx, *geofenceInterval, strings.ReplaceAll(*geofenceQueries, "{target}", common.dbTargetStr), common.connString, dbTarget, opts.numWorkers))
+	run.addStop(faultInjector.Start(run.ctx))
+	run.addStop(networkImpairments.Start(run.ctx))
+
+	csvFile := createArtifactCSV("results", "insert", dbTarget.String(), basenamePart(tripsSource), workersPart(opts.numWorkers), fmt.Sprintf("%db", *batchSize), insertMethodPart(*useBulkInsert))
+	csvWriter := results.NewCSVWriter(csvFile, opts.flushInterval, opts.flushRecords)
+	resultShards = opts.mustCreateResultShards(csvWriter, insertCSVHeader())
+	resultsAggregator = opts.mustCreateAggregator(csvWriter)
+
+	summary, err := benchmarkInserts(run.ctx, workerConnString, restAPI, opts.numWorkers, opts.drainTimeout, *batchSize, *useBulkInsert, *rate, dbTarget, tripsSource, attributes, csvWriter)
+	summary.BadRows = badRows.Close()
+	if err == nil && !summary.Aborted && *reconcile {
+		summary.Reconciliation = reconcileTrips(ctx, common.connString, dbTarget, *tripsPath, opts.numWorkers)
+	}
+	if err == nil && !summary.Aborted && *checkTrips {
+		summary.TripIntegrity = checkTripIntegrity(ctx, common.connString, dbTarget, opts.numWorkers)
+	}
+	run.finish(summary, func() {
+		resultShards.Merge()
+		closeAggregator()
+		closeResultsCSV(csvWriter, opts.sortResults)
+	})
+	if err != nil {
+		logger.Error("Insert benchmark failed", "error", err)
+		os.Exit(exitCode(err))
+	}
+	if summary.Aborted {
+		os.Exit(exitAborted)
+	}
+	if summary.Reconciliation.Mismatches() > 0 || summary.TripIntegrity.Issues() > 0 {
+		os.Exit(exitAssertion)
+	}
+	// only complete loads of a file into the database are recorded, query runs asserting the dataset expect all trip events
+	if *source != "" || restAPI != nil || tenancy != nil {
+		return
+	}
+	recordDataset(ctx, common.connString, dbTarget, fingerprintDataset("escooter_events", "insert", *tripsPath, summary.TotalSuccesses))
+}
+
+func runQuery(args []string) {
+	fs := newFlagSet("query", "Execute queries rendered from the query templates with concurrent workers and record their latency.")
+	var common commonOptions
+	common.register(fs)
+	var opts benchmarkOptions
+	opts.register(fs)
+	localitiesPath := fs.String("localities", "../escooter-trips-generator/output/berlin-localities.geojson", "Path or https:// or s3:// URL of a GeoJSON, GeoParquet (.parquet) or shapefile (.shp or .zip) file containing localities")
+	localityFields := registerLocalityFields(fs)
+	poisPath := fs.String("pois", "../escooter-trips-generator/output/berlin-pois.csv", "Path or https:// or s3:// URL of a CSV or GeoParquet (.parquet) file containing POIs")
+	tripsPath := fs.String("trips", "../escooter-trips-generator/output/escooter-trips-small.csv", "Path or https:// or s3:// URL of a CSV file containing the escooter trip events")
+	numQueries := fs.Int("nqueries", 100, "Number of queries to execute")
+	randomSeed := fs.Int64("seed", 42, "Random seed for deterministic query generation")
+	tripIDSampleSize := fs.Int("tripid-sample-size", 0, "Draw the trip IDs of the queries from a random sample of <N> trips of -trips, seeded with -seed, instead of keeping all trip IDs in memory,\n"+
+		"e.g. for the full dataset with tens of millions of trips. 0 uses all trips")
+	queriesFilepath := fs.String("queries", "./schemas/cratedb-simple-read-queries.tmpl", "Path to a file containing query templates")
+	assertDataset := fs.Bool("assert-dataset", false, "Fail before running unless -trips, -pois and -localities match the files init and insert recorded in benchmark_meta")
+	var api apiOptions
+	api.register(fs, "-queries then contains request templates, e.g. schemas/rest-api-queries.tmpl, rendered with the same fields as query templates")
+	var chaos chaosOptions
+	chaos.register(fs)
+	var impairments impairmentOptions
+	impairments.register(fs)
+	var failover failoverOptions
+	failover.register(fs)
+	var tenants tenantOptions
+	tenants.register(fs)
+	fs.Parse(args)
+
+	if len(opts.targets) > 0 {
+		runMultiTarget("query", args, opts.targets, common.resultsDir)
+		return
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+	common.setup("query", opts.numWorkers)
+	defer common.close()
+	ctx, cancel := opts.withMaxDuration(ctx)
+	defer cancel()
+	dbTarget := common.dbTarget
+	if *tripIDSampleSize < 0 {
+		logger.Error("Invalid CLI argument", "argument", "tripid-sample-size", "error", "expected 0 for all trips or a positive number of trips")
+		os.Exit(exitConfig)
+	}
+
+	localities := mustLoadLocalities(*localitiesPath, *localityFields)
+	logger.Info("Loaded and parsed localities", "count", len(localities))
+
+	pois := mustLoadPOIs(*poisPath)
+	logger.Info("Loaded and parsed pois", "count", len(pois))
+
+	logger.Info("Starting load-generator with following cli arguments",
+		"mode", "query",
+		"log", common.logLevel,
+		"connString", redactConnString(common.connString),
+		"nworkers", opts.numWorkers,
+		"dbTarget", dbTarget.String(),
+		"trips", *tripsPath,
+		"localities", *localitiesPath,
+		"pois", *poisPath,
+		"qtemplates", *queriesFilepath,
+		"numQueries", *numQueries,
+		"seed", *randomSeed,
+		"tripIdSampleSize", *tripIDSampleSize,
+		"sampleInterval", opts.sampleInterval,
+		"dbStatsInterval", opts.dbStatsInterval,
+		"tenants", tenants.tenants,
+		"tenantSkew", tenants.skew,
+	)
+	tenancy = tenants.mustLoad(dbTarget, common.schemaVariant)
+	var queryTemplates *template.Template
+	restAPI := api.mustLoadTarget(*queriesFilepath)
+	if restAPI != nil && tenancy != nil {
+		logger.Error("Invalid CLI argument", "argument", "tenants", "error", "-tenants is not supported with -target, the REST API decides where the data is queried")
+		os.Exit(exitConfig)
+	}
+	if *assertDataset && tenancy != nil {
+		logger.Error("Invalid CLI argument", "argument", "assert-dataset", "error", "insert doesn't record the datasets spread across -tenants")
+		os.Exit(exitConfig)
+	}
+	if restAPI != nil {
+		queryTemplates = restAPI.templates
+		logger.Info("Loaded request templates of the REST API", "count", len(queryTemplates.Templates()), "target", restAPI.String())
+	} else {
+		queryTemplates = mustLoadTemplates(*queriesFilepath)
+		logger.Info("Loaded read queries templates", "count", len(queryTemplates.Templates()))
+	}
+
+	if common.dryRun && restAPI != nil {
+		logger.Error("Invalid CLI argument", "argument", "dry-run", "error", "-dry-run prints the SQL statements, it is not supported with -target")
+		os.Exit(exitConfig)
+	}
+	if common.dryRun {
+		tripIds, err := workload.SampleTripIDs(ctx, *tripsPath, *tripIDSampleSize, *randomSeed)
+		if err != nil {
+			logger.Error("Unable to read trip ids", "error", err)
+			os.Exit(exitConfig)
+		}
+		generator := mustNewQueryFieldGenerator(*randomSeed, localities, pois, tripIds)
+		if err := dryRunQueries(dbTarget, queryTemplates, generator, *numQueries); err != nil {
+			logger.Error("Dry run failed", "error", err)
+			os.Exit(exitConfig)
+		}
+		return
+	}
+
+	if *assertDataset {
+		assertDatasets(ctx, common.connString, map[string]string{
+			"escooter_events": *tripsPath,
+			"pois":            *poisPath,
+			"localities":      *localitiesPath,
+		})
+	}
+	faultInjector = chaos.mustLoad(dbTarget, common.connString)
+	networkImpairments = impairments.mustLoad(common.connString)
+	workerConnString := failover.mustLoad(networkImpairments.WorkerConnString(opts.workerConnString(common.connString)), dbTarget)
+	run := startBenchmarkRun(ctx, "query", &common, &opts, map[string]string{
+		"trips":      *tripsPath,
+		"localities": *localitiesPath,
+		"pois":       *poisPath,
+		"queries":    *queriesFilepath,
+	}, randomSeed)
+	workerFairness = NewWorkerFairness(opts.numWorkers)
+	run.addStop(faultInjector.Start(run.ctx))
+	run.addStop(networkImpairments.Start(run.ctx))
+
+	csvFile := createArtifactCSV("results", "query", dbTarget.String(), basenamePart(*queriesFilepath), workersPart(opts.numWorkers), fmt.Sprintf("%dq", *numQueries))
+	csvWriter := results.NewCSVWriter(csvFile, opts.flushInterval, opts.flushRecords)
+	resultShards = opts.mustCreateResultShards(csvWriter, queryCSVHeader())
+	resultsAggregator = opts.mustCreateAggregator(csvWriter)
+
+	summary, err := benchmarkQueries(run.ctx, workerConnString, restAPI, opts.numWorkers, opts.drainTimeout, dbTarget, *tripsPath, *tripIDSampleSize, localities, pois, queryTemplates, *numQueries, *randomSeed, csvWriter)
+	run.finish(summary, func() {
+		resultShards.Merge()
+		closeAggregator()
+		closeResultsCSV(csvWriter, opts.sortResults)
+	})
+	if err != nil {
+		logger.Error("Query benchmark failed", "error", err)
+		os.Exit(exitCode(err))
+	}
+	if summary.Aborted {
+		os.Exit(exitAborted)
+	}
+}
+
+func runVerify(args []string) {
+	fs := newFlagSet("verify", "Render every query template with generated fields and execute it once against the database.")
+	var common commonOptions
+	common.register(fs)
+	localitiesPath := fs.String("localities", "../escooter-trips-generator/output/berlin-localities.geojson", "Path or https:// or s3:// URL of a GeoJSON, GeoParquet (.parquet) or shapefile (.shp or .zip) file containing localities")
+	localityFields := registerLocalityFields(fs)
+	poisPath := fs.String("pois", "../escooter-trips-generator/output/berlin-pois.csv", "Path or https:// or s3:// URL of a CSV or GeoParquet (.parquet) file containing POIs")
+	tripsPath := fs.String("trips", "../escooter-trips-generator/output/escooter-trips-small.csv", "Path or https:// or s3:// URL of a CSV file containing the escooter trip events")
+	randomSeed := fs.Int64("seed", 42, "Random seed for deterministic query generation")
+	queriesFilepath := fs.String("queries", "./schemas/cratedb-simple-read-queries.tmpl", "Path to a file containing query templates")
+	fs.Parse(args)
+
+	ctx, stop := signalContext()
+	defer stop()
+	common.setup("verify", 0)
+	defer common.close()
+
+	localities := mustLoadLocalities(*localitiesPath, *localityFields)
+	pois := mustLoadPOIs(*poisPath)
+	tripIds, err := workload.ReadTripIDs(ctx, *tripsPath)
+	if err != nil {
+		logger.Error("Unable to read trip ids", "error", err)
+		os.Exit(exitConfig)
+	}
+	queryTemplates := mustLoadTemplates(*queriesFilepath)
+
+	generator := mustNewQueryFieldGenerator(*randomSeed, localities, pois, tripIds)
+	if common.dryRun {
+		// one rendered query per template, like the validation executes them
+		if err := dryRunQueries(common.dbTarget, queryTemplates, generator, len(queryTemplates.Templates())); err != nil {
+			logger.Error("Not all templates passed the validation", "error", err)
+			os.Exit(exitValidation)
+		}
+		return
+	}
+	if err := ValidateTemplates(ctx, queryTemplates, common.connString, generator); err != nil {
+		logger.Error("Not all templates passed the validation", "error", err)
+		os.Exit(exitCode(err))
+	}
+	logger.Info("All templates passed the validation", "count", len(queryTemplates.Templates()))
+}
+
+func runAnalyze(args []string) {
+	fs := newFlagSet("analyze", "Print overall and per template/job type latency statistics of results CSV files.\nThe files are given as positional arguments.")
+	asJSON := fs.Bool("json", false, "Print the statistics as JSON instead of a table")
+	fs.Parse(args)
+
+	logger = slog.New(slog.NewJSONHandler(os.Stderr, nil))
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(exitConfig)
+	}
+
+	type analysis struct {
+		File    string                          `json:"file"`
+		Kind    string                          `json:"kind"`
+		RunID   string                          `json:"runId"`
+		Overall results.LatencyStats            `json:"overall"`
+		Groups  map[string]results.LatencyStats `json:"groups"`
+	}
+
+	var analyses []analysis
+	for _, filename := range fs.Args() {
+		data, err := results.LoadCSV(filename)
+		if err != nil {
+			logger.Error("Unable to load results", "error", err)
+			os.Exit(exitConfig)
+		}
+		a := analysis{
+			File:    filename,
+			Kind:    data.Kind,
+			RunID:   data.RunID,
+			Overall: results.ComputeLatencyStats(data.Rows),
+			Groups:  make(map[string]results.LatencyStats),
+		}
+		names, groups := results.GroupRows(data.Rows)
+		for _, name := range names {
+			a.Groups[name] = results.ComputeLatencyStats(groups[name])
+		}
+		analyses = append(analyses, a)
+	}
+
+	if *asJSON {
+		b, _ := json.MarshalIndent(analyses, "", "  ")
+		fmt.Println(string(b))
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	for _, a := range analyses {
+		fmt.Fprintf(w, "%s (%s, run %s)\n", a.File, a.Kind, a.RunID)
+		fmt.Fprintln(w, "name\trequests\tfailed\tops/s\tmean ms\tp50 ms\tp95 ms\tp99 ms\tmax ms\t")
+		printStatsRow(w, "ALL", a.Overall)
+		names := make([]string, 0, len(a.Groups))
+		for name := range a.Groups {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			printStatsRow(w, name, a.Groups[name])
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+}
+
+func printStatsRow(w io.Writer, name string, s results.LatencyStats) {
+	fmt.Fprintf(w, "%s\t%d\t%d\t%.1f\t%.3f\t%.3f\t%.3f\t%.3f\t%.3f\t\n",
+		strings.ReplaceAll(name, "\t", " "), s.Count, s.Failed, s.OpsPerSec,
+		s.MeanUs/1000, s.P50Us/1000, s.P95Us/1000, s.P99Us/1000, s.MaxUs/1000)
+}
+
+// closeResultsCSV flushes and closes the results CSV file, sorting it by the column sortBy unless empty
+func closeResultsCSV(csvWriter *results.CSVWriter, sortBy string) {
+	if err := csvWriter.Close(); err != nil {
+		logger.Error("Failed to flush results CSV file", "error", err)
+		return
+	}
+	if sortBy == "" {
+		return
+	}
+	if err := results.SortCSV(csvWriter.Name(), sortBy); err != nil {
+		logger.Error("Failed to sort results CSV file, it keeps the order the workers finished in", "filename", csvWriter.Name(), "error", err)
+		return
+	}
+	logger.Info("Sorted results CSV file", "filename", csvWriter.Name(), "by", sortBy)
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"load-generator/internal/targets"
+)
+
+var errAbortedViaControl = errors.New("aborted via control API")
+
+// RunControl exposes the progress of the active run over HTTP and lets it be paused, resumed and aborted.
+// All methods are no-ops on a nil RunControl.
+type RunControl struct {
+	mode       string
+	dbTarget   targets.DBTarget
+	numWorkers int
+	startTime  time.Time
+	ctx        context.Context
+	abort      context.CancelCauseFunc
+
+	mu      sync.Mutex
+	resumed chan struct{} // nil while running, closed on resume
+
+	scheduled atomic.Int64
+	succeeded atomic.Int64
+	failed    atomic.Int64
+}
+
+var runControl *RunControl
+
+// RunStatus is the response of /status
+type RunStatus struct {
+	RunID      string    `json:"runId"`
+	Mode       string    `json:"mode"`
+	DBTarget   string    `json:"dbTarget"`
+	NumWorkers int       `json:"numWorkers"`
+	StartTime  time.Time `json:"startTime"`
+	ElapsedSec float64   `json:"elapsedSec"`
+	Paused     bool      `json:"paused"`
+	Stopping   bool      `json:"stopping"` // interrupted, aborted or max duration exceeded, in-flight operations are drained
+	Scheduled  int64     `json:"scheduled"`
+	Succeeded  int64     `json:"succeeded"`
+	Failed     int64     `json:"failed"`
+}
+
+// startControlServer serves the control API on addr:
+//
+//	GET  /status   progress of the run
+//	GET  /summary  run summary of the operations finished so far
+//	POST /pause    stop scheduling new jobs, in-flight operations finish
+//	POST /resume   continue scheduling jobs
+//	POST /abort    stop the run like an interrupt and write the partial results
+//
+// Returned function stops the server.
+func startControlServer(ctx context.Context, abort context.CancelCauseFunc, addr string, mode string, dbTarget targets.DBTarget, numWorkers int) func() {
+	if addr == "" {
+		return func() {}
+	}
+
+	runControl = &RunControl{
+		mode:       mode,
+		dbTarget:   dbTarget,
+		numWorkers: numWorkers,
+		startTime:  time.Now(),
+		ctx:        ctx,
+		abort:      abort,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		writeControlJSON(w, runControl.Status())
+	})
+	mux.HandleFunc("GET /summary", func(w http.ResponseWriter, r *http.Request) {
+		writeControlJSON(w, runControl.Summary())
+	})
+	mux.HandleFunc("POST /pause", func(w http.ResponseWriter, r *http.Request) {
+		runControl.Pause()
+		writeControlJSON(w, runControl.Status())
+	})
+	mux.HandleFunc("POST /resume", func(w http.ResponseWriter, r *http.Request) {
+		runControl.Resume()
+		writeControlJSON(w, runControl.Status())
+	})
+	mux.HandleFunc("POST /abort", func(w http.ResponseWriter, r *http.Request) {
+		logger.Warn("Run aborted via control API", "remoteAddr", r.RemoteAddr)
+		runControl.abort(errAbortedViaControl)
+		writeControlJSON(w, runControl.Status())
+	})
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		logger.Error("Unable to listen for control API", "addr", addr, "error", err)
+		os.Exit(exitConfig)
+	}
+	server := &http.Server{Handler: mux}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Control API server failed", "error", err)
+		}
+	}()
+	logger.Info("Serving control API", "addr", listener.Addr().String())
+
+	return func() {
+		server.Close()
+	}
+}
+
+func writeControlJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func (c *RunControl) Pause() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.resumed == nil {
+		c.resumed = make(chan struct{})
+		logger.Info("Run paused via control API")
+	}
+}
+
+func (c *RunControl) Resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.resumed != nil {
+		close(c.resumed)
+		c.resumed = nil
+		logger.Info("Run resumed via control API")
+	}
+}
+
+// WaitIfPaused blocks while the run is paused and returns how long it waited.
+// ok is false if ctx is done while waiting.
+func (c *RunControl) WaitIfPaused(ctx context.Context) (waited time.Duration, ok bool) {
+	if c == nil {
+		return 0, true
+	}
+	c.mu.Lock()
+	resumed := c.resumed
+	c.mu.Unlock()
+	if resumed == nil {
+		return 0, true
+	}
+
+	pausedAt := time.Now()
+	select {
+	case <-ctx.Done():
+		return time.Since(pausedAt), false
+	case <-resumed:
+		return time.Since(pausedAt), true
+	}
+}
+
+// AddScheduled counts operations sent to the workers
+func (c *RunControl) AddScheduled(n int) {
+	if c == nil {
+		return
+	}
+	c.scheduled.Add(int64(n))
+}
+
+// AddCompleted counts operations finished by the workers
+func (c *RunControl) AddCompleted(succeeded, failed int) {
+	if c == nil {
+		return
+	}
+	c.succeeded.Add(int64(succeeded))
+	c.failed.Add(int64(failed))
+}
+
+func (c *RunControl) Status() RunStatus {
+	c.mu.Lock()
+	paused := c.resumed != nil
+	c.mu.Unlock()
+	return RunStatus{
+		RunID:      runID,
+		Mode:       c.mode,
+		DBTarget:   c.dbTarget.String(),
+		NumWorkers: c.numWorkers,
+		StartTime:  c.startTime,
+		ElapsedSec: time.Since(c.startTime).Seconds(),
+		Paused:     paused,
+		Stopping:   c.ctx.Err() != nil,
+		Scheduled:  c.scheduled.Load(),
+		Succeeded:  c.succeeded.Load(),
+		Failed:     c.failed.Load(),
+	}
+}
+
+func (c *RunControl) Summary() RunSummary {
+	now := time.Now()
+	return RunSummary{
+		RunID:           runID,
+		Mode:            c.mode,
+		DBTarget:        c.dbTarget.String(),
+		NumWorkers:      c.numWorkers,
+		StartTime:       c.startTime,
+		EndTime:         now,
+		DurationSec:     now.Sub(c.startTime).Seconds(),
+		TotalOperations: int(c.scheduled.Load()),
+		TotalSuccesses:  int(c.succeeded.Load()),
+		TotalFailures:   int(c.failed.Load()),
+		Aborted:         c.ctx.Err() != nil,
+		Artifacts:       listArtifacts(),
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"load-generator/internal/cluster"
+	"load-generator/internal/grpc"
+	"load-generator/internal/results"
+)
+
+// AgentOutcome is the outcome of one agent of a distributed run
+type AgentOutcome struct {
+	Agent       int                  `json:"agent"` // from 1 like {agent}
+	Hostname    string               `json:"hostname"`
+	ExitCode    int                  `json:"exitCode"`
+	ResultsFile string               `json:"resultsFile,omitempty"`
+	Summary     *RunSummary          `json:"summary,omitempty"`
+	Latency     results.LatencyStats `json:"latency"`
+}
+
+// DistributedSummary combines the agents of a distributed run, which share one run ID
+type DistributedSummary struct {
+	RunID       string               `json:"runId"`
+	Mode        string               `json:"mode"`
+	ResultsFile string               `json:"resultsFile,omitempty"`
+	Latency     results.LatencyStats `json:"latency"`
+	Agents      []AgentOutcome       `json:"agents"`
+}
+
+// coordinatorService hands out the assignments once all agents registered and collects their reports
+type coordinatorService struct {
+	mode      string
+	args      []string
+	numAgents int
+	seed      int64
+
+	mu         sync.Mutex
+	hostnames  []string // by agent index, empty for slots of agents which left before the run started
+	registered int
+	started    chan struct{} // closed once all agents registered
+	reports    []*cluster.AgentReport
+	reported   int
+	done       chan struct{} // closed once all agents reported
+}
+
+func (c *coordinatorService) Register(ctx context.Context, req cluster.RegisterRequest) (cluster.Assignment, error) {
+	c.mu.Lock()
+	if c.registered == c.numAgents {
+		c.mu.Unlock()
+		return cluster.Assignment{}, grpc.Errorf(grpc.CodeFailedPrecondition, "all %d agents of run %s are registered", c.numAgents, runID)
+	}
+	index := 0
+	for c.hostnames[index] != "" {
+		index++
+	}
+	c.hostnames[index] = cmp.Or(req.Hostname, "unknown")
+	c.registered++
+	logger.Info("Agent registered", "agent", index+1, "hostname", c.hostnames[index], "registered", c.registered, "agents", c.numAgents)
+	if c.registered == c.numAgents {
+		close(c.started)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-c.started:
+		return c.assignment(index), nil
+	case <-ctx.Done():
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		// the run may have started while the agent left, its slot is then lost
+		select {
+		case <-c.started:
+			return c.assignment(index), nil
+		default:
+		}
+		logger.Warn("Agent left before the run started", "agent", index+1, "hostname", c.hostnames[index])
+		c.hostnames[index] = ""
+		c.registered--
+		return cluster.Assignment{}, ctx.Err()
+	}
+}
+
+// assignment replaces {agent} and {agents} in the arguments by the 1-based agent number and the number of agents,
+// e.g. -trips ./trips-shard{agent}of{agents}.csv for the files of split-dataset, and gives every agent its own query seed
+func (c *coordinatorService) assignment(index int) cluster.Assignment {
+	args := make([]string, 0, len(c.args)+1)
+	replacer := strings.NewReplacer("{agent}", strconv.Itoa(index+1), "{agents}", strconv.Itoa(c.numAgents))
+	for _, arg := range c.args {
+		args = append(args, replacer.Replace(arg))
+	}
+	if c.mode == "query" {
+		args = append(args, "-seed="+strconv.FormatInt(c.seed+int64(index), 10))
+	}
+	return cluster.Assignment{AgentIndex: index, NumAgents: c.numAgents, RunID: runID, Command: c.mode, Args: args}
+}
+
+func (c *coordinatorService) Report(ctx context.Context, report cluster.AgentReport) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if report.AgentIndex < 0 || report.AgentIndex >= c.numAgents {
+		return grpc.Errorf(grpc.CodeInvalidArgument, "unknown agent %d", report.AgentIndex)
+	}
+	if c.reports[report.AgentIndex] != nil {
+		return grpc.Errorf(grpc.CodeFailedPrecondition, "agent %d already reported", report.AgentIndex+1)
+	}
+	c.reports[report.AgentIndex] = &report
+	c.reported++
+	logger.Info("Agent reported", "agent", report.AgentIndex+1, "hostname", report.Hostname, "exitCode", report.ExitCode,
+		"resultsBytes", len(report.ResultsCSV), "reported", c.reported, "agents", c.numAgents)
+	if c.reported == c.numAgents {
+		close(c.done)
+	}
+	return nil
+}
+
+func runCoordinator(args []string) {
+	fs := newFlagSet("coordinator", "Distribute an insert or query run over agents on several hosts, as a single host's network stack saturates\nbefore the cluster does. Agents connect with 'agent -coordinator <host:port>' and run the command with the given flags;\n{agent} and {agents} in them are replaced by the agent number from 1 and the number of agents,\ne.g. -trips ./trips-shard{agent}of{agents}.csv for the shards of split-dataset. Query agents use -seed plus their index.\nThe results of all agents are merged into one CSV with distinct worker IDs.\nUsage: coordinator [flags] insert|query [command flags]")
+	listen := fs.String("listen", ":7070", "Address to accept the agents' gRPC connections on")
+	numAgents := fs.Int("agents", 2, "Number of agents to wait for, the run starts once all registered")
+	seed := fs.Int64("seed", 42, "Seed of the first query agent, agent i uses seed+i")
+	dir := fs.String("results-dir", "./results", "Directory to write the merged results and the agents' artifacts to, created if missing")
+	fs.Parse(args)
+
+	runID = envOrDefault(runIDEnv, newUUID())
+	logger = slog.New(slog.NewJSONHandler(os.Stdout, nil)).With("runId", runID)
+	resultsDir = *dir
+
+	mode := fs.Arg(0)
+	if mode != "insert" && mode != "query" {
+		logger.Error("Invalid CLI argument", "argument", "mode", "error", fmt.Sprintf("expected insert or query after the flags, got %q", mode))
+		os.Exit(exitConfig)
+	}
+	if *numAgents < 1 {
+		logger.Error("Invalid CLI argument", "argument", "agents", "error", "expected at least one agent")
+		os.Exit(exitConfig)
+	}
+	commandArgs := withoutFlag(withoutFlag(fs.Args()[1:], "results-dir"), "seed")
+	for _, arg := range commandArgs {
+		if name, _, _ := strings.Cut(strings.TrimLeft(arg, "-"), "="); strings.HasPrefix(arg, "-") && name == "targets" {
+			logger.Error("Invalid CLI argument", "argument", "targets", "error", "multi-target runs can't be distributed, run the coordinator once per target")
+			os.Exit(exitConfig)
+		}
+	}
+	if mode == "insert" && !strings.Contains(strings.Join(commandArgs, " "), "{agent}") {
+		logger.Warn("All agents insert the same trips, use {agent} in -trips to give every agent its own shard")
+	}
+
+	c := &coordinatorService{
+		mode: mode, args: commandArgs, numAgents: *numAgents, seed: *seed,
+		hostnames: make([]string, *numAgents),
+		started:   make(chan struct{}),
+		reports:   make([]*cluster.AgentReport, *numAgents),
+		done:      make(chan struct{}),
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		logger.Error("Unable to listen for agents", "listen", *listen, "error", err)
+		os.Exit(exitConfig)
+	}
+	server := grpc.NewHTTPServer(*listen, cluster.NewHandler(c))
+	go func() {
+		if err := server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Coordinator server failed", "error", err)
+			os.Exit(exitFailure)
+		}
+	}()
+	logger.Info("Waiting for agents", "listen", ln.Addr().String(), "agents", *numAgents, "mode", mode, "args", commandArgs)
+
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		server.Close()
+		c.mu.Lock()
+		logger.Error("Coordinator interrupted before all agents reported", "registered", c.registered, "reported", c.reported)
+		os.Exit(exitAborted)
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	server.Shutdown(shutdownCtx)
+	cancel()
+
+	summary := DistributedSummary{RunID: runID, Mode: mode}
+	reports := make([]cluster.AgentReport, 0, *numAgents)
+	exitCode := 0
+	for _, report := range c.reports {
+		reports = append(reports, *report)
+		summary.Agents = append(summary.Agents, agentOutcome(mode, *report))
+		// a run ending at its -max-duration is a planned end
+		if exitCode == 0 && report.ExitCode != 0 && report.ExitCode != exitAborted {
+			exitCode = report.ExitCode
+		}
+	}
+	summary.ResultsFile, summary.Latency = writeMergedResults(mode, reports)
+	writeDistributedSummary(summary)
+	printDistributedSummary(summary)
+	if exitCode != 0 {
+		logger.Error("Distributed run finished with failed agents", "exitCode", exitCode)
+		os.Exit(exitCode)
+	}
+}
+
+// agentOutcome stores the agent's results and summary below the results directory and computes the agent's latency
+func agentOutcome(mode string, report cluster.AgentReport) AgentOutcome {
+	outcome := AgentOutcome{Agent: report.AgentIndex + 1, Hostname: report.Hostname, ExitCode: report.ExitCode}
+	agentDir := filepath.Join(resultsDir, fmt.Sprintf("distributed_%s_%s", mode, runID), fmt.Sprintf("agent%d", report.AgentIndex+1))
+	if len(report.SummaryJSON) > 0 {
+		var summary RunSummary
+		if err := json.Unmarshal(report.SummaryJSON, &summary); err != nil {
+			logger.Warn("Unable to parse agent summary", "agent", report.AgentIndex+1, "error", err)
+		} else {
+			outcome.Summary = &summary
+		}
+		if err := writeNewFile(filepath.Join(agentDir, fmt.Sprintf("summary_%s_%s.json", mode, runID)), report.SummaryJSON); err != nil {
+			logger.Warn("Unable to write agent summary", "agent", report.AgentIndex+1, "error", err)
+		}
+	}
+	if len(report.ResultsCSV) > 0 {
+		filename := filepath.Join(agentDir, filepath.Base(report.ResultsFilename))
+		if err := writeNewFile(filename, report.ResultsCSV); err != nil {
+			logger.Warn("Unable to write agent results", "agent", report.AgentIndex+1, "error", err)
+			return outcome
+		}
+		outcome.ResultsFile = filename
+		data, err := results.LoadCSV(filename)
+		if err != nil {
+			logger.Warn("Unable to load agent results", "agent", report.AgentIndex+1, "error", err)
+			return outcome
+		}
+		outcome.Latency = results.ComputeLatencyStats(data.Rows)
+	}
+	return outcome
+}
+
+func writeMergedResults(mode string, reports []cluster.AgentReport) (string, results.LatencyStats) {
+	timestamp := time.Now().Format("20060102_150405")
+	filename := fmt.Sprintf("results_%s_distributed_%da_%s_%s.csv", mode, len(reports), timestamp, runID)
+	filename = filepath.Join(resultsDir, filename)
+
+	f, err := createNewFile(filename)
+	if err != nil {
+		logger.Error("Failed to create merged results CSV file", "filename", filename, "error", err)
+		os.Exit(exitFailure)
+	}
+	rows, err := cluster.MergeResults(f, reports)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		logger.Error("Failed to merge the agents' results", "filename", filename, "error", err)
+		os.Exit(exitFailure)
+	}
+	if rows == 0 {
+		os.Remove(filename)
+		logger.Warn("No agent reported results")
+		return "", results.LatencyStats{}
+	}
+	logger.Info("Wrote merged results CSV file", "filename", filename, "rows", rows)
+
+	data, err := results.LoadCSV(filename)
+	if err != nil {
+		logger.Error("Unable to load merged results", "filename", filename, "error", err)
+		os.Exit(exitFailure)
+	}
+	return filename, results.ComputeLatencyStats(data.Rows)
+}
+
+func writeDistributedSummary(summary DistributedSummary) {
+	timestamp := time.Now().Format("20060102_150405")
+	filename := fmt.Sprintf("distributed_%s_%s_%s.json", summary.Mode, timestamp, runID)
+	filename = filepath.Join(resultsDir, filename)
+
+	b, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		logger.Error("Failed to encode distributed summary", "error", err)
+		os.Exit(exitFailure)
+	}
+	if err := writeNewFile(filename, b); err != nil {
+		logger.Error("Failed to write distributed summary", "filename", filename, "error", err)
+		os.Exit(exitFailure)
+	}
+	logger.Info("Wrote distributed summary", "filename", filename)
+}
+
+func printDistributedSummary(summary DistributedSummary) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "Distributed %s run %s\n", summary.Mode, summary.RunID)
+	fmt.Fprintln(w, "agent\trequests\tfailed\tops/s\tmean ms\tp50 ms\tp95 ms\tp99 ms\tmax ms\t")
+	for _, a := range summary.Agents {
+		printStatsRow(w, fmt.Sprintf("%d %s", a.Agent, a.Hostname), a.Latency)
+	}
+	printStatsRow(w, "all", summary.Latency)
+	w.Flush()
+}
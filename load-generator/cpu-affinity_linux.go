@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"syscall"
+	"unsafe"
+)
+
+// maxAffinityRounds bounds the rounds of setCPUAffinity, the Go runtime starts only a few threads at a time
+const maxAffinityRounds = 100
+
+// setCPUAffinity limits all threads of the process to the CPUs. sched_setaffinity applies to a single thread,
+// threads started later inherit the affinity of the thread starting them. Threads started by unpinned threads
+// while the others are pinned are pinned in the next round, until a round finds no new thread.
+// If a thread can't be limited, the threads are reset to the original CPUs of the calling thread,
+// so the process runs on all of them as reported by the caller.
+func setCPUAffinity(cpus []int) error {
+	mask := make([]uint64, cpus[len(cpus)-1]/64+1)
+	for _, cpu := range cpus {
+		mask[cpu/64] |= 1 << (cpu % 64)
+	}
+	// threads started by this one inherit the affinity set first
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	original, err := schedGetaffinity(0)
+	if err != nil {
+		return fmt.Errorf("sched_getaffinity of the current thread: %w", err)
+	}
+	if err := setThreadsAffinity(mask); err != nil {
+		if resetErr := setThreadsAffinity(original); resetErr != nil {
+			return fmt.Errorf("%w, resetting the threads to their original CPUs failed: %w", err, resetErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// setThreadsAffinity sets the affinity of the calling thread and then of all threads of the process in rounds
+func setThreadsAffinity(mask []uint64) error {
+	if err := schedSetaffinity(0, mask); err != nil {
+		return fmt.Errorf("sched_setaffinity of the current thread: %w", err)
+	}
+	pinned := make(map[int]bool)
+	for range maxAffinityRounds {
+		tasks, err := os.ReadDir("/proc/self/task")
+		if err != nil {
+			return err
+		}
+		started := false
+		for _, task := range tasks {
+			tid, err := strconv.Atoi(task.Name())
+			if err != nil || pinned[tid] {
+				continue
+			}
+			started = true
+			pinned[tid] = true
+			// ESRCH: the thread exited in the meantime
+			if err := schedSetaffinity(tid, mask); err != nil && err != syscall.ESRCH {
+				return fmt.Errorf("sched_setaffinity of thread %d: %w", tid, err)
+			}
+		}
+		if !started {
+			return nil
+		}
+	}
+	return fmt.Errorf("Threads kept being started while limiting them to the CPUs, %d threads limited", len(pinned))
+}
+
+// schedGetaffinity returns the affinity of the thread, 0 for the calling one
+func schedGetaffinity(tid int) ([]uint64, error) {
+	mask := make([]uint64, maxCPUs/64)
+	_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_GETAFFINITY, uintptr(tid), uintptr(len(mask)*8), uintptr(unsafe.Pointer(&mask[0])))
+	if errno != 0 {
+		return nil, errno
+	}
+	return mask, nil
+}
+
+// schedSetaffinity sets the affinity of the thread, 0 for the calling one
+func schedSetaffinity(tid int, mask []uint64) error {
+	_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY, uintptr(tid), uintptr(len(mask)*8), uintptr(unsafe.Pointer(&mask[0])))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// allowedCPUs returns the CPUs the thread of the status file may run on
+func allowedCPUs(t *testing.T, status string) []int {
+	t.Helper()
+	b, err := os.ReadFile(status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if list, ok := strings.CutPrefix(line, "Cpus_allowed_list:"); ok {
+			cpus, err := parseCPUList(list)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return cpus
+		}
+	}
+	t.Fatalf("%s has no Cpus_allowed_list", status)
+	return nil
+}
+
+func TestSetCPUAffinity(t *testing.T) {
+	allowed := allowedCPUs(t, "/proc/self/status")
+	t.Cleanup(func() { setCPUAffinity(allowed) })
+
+	// threads are started while the affinity is set
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runtime.LockOSThread()
+			<-stop
+		}()
+	}
+	want := allowed[:1]
+	if err := setCPUAffinity(want); err != nil {
+		t.Fatalf("setCPUAffinity failed: %v", err)
+	}
+	close(stop)
+	wg.Wait()
+
+	tasks, err := filepath.Glob("/proc/self/task/*/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range tasks {
+		if got := allowedCPUs(t, status); !reflect.DeepEqual(got, want) {
+			t.Errorf("thread %s may run on the CPUs %v, want %v", filepath.Base(filepath.Dir(status)), got, want)
+		}
+	}
+}
+
+func TestSetCPUAffinityUnavailableCPU(t *testing.T) {
+	allowed := allowedCPUs(t, "/proc/self/status")
+	t.Cleanup(func() { setCPUAffinity(allowed) })
+
+	if err := setCPUAffinity([]int{maxCPUs - 1}); err == nil {
+		t.Skipf("CPU %d is available", maxCPUs-1)
+	}
+	// the threads run on their original CPUs, as the warning of applyCPUControls reports
+	tasks, err := filepath.Glob("/proc/self/task/*/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range tasks {
+		if got := allowedCPUs(t, status); !reflect.DeepEqual(got, allowed) {
+			t.Errorf("thread %s may run on the CPUs %v, want the original %v", filepath.Base(filepath.Dir(status)), got, allowed)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// setCPUAffinity is only supported on Linux
+func setCPUAffinity(cpus []int) error {
+	return errors.New("limiting the CPUs is only supported on Linux")
+}
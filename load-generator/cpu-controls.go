@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// applyCPUControls limits the load generator to the CPUs of -cpus and sets GOMAXPROCS to -gomaxprocs,
+// or to the number of these CPUs if 0, so it doesn't compete for more cores on shared benchmark hosts.
+// Returns the CPUs the process was limited to, nil if all are used.
+func (o *benchmarkOptions) applyCPUControls() []int {
+	var cpus []int
+	if o.cpus != "" {
+		var err error
+		if cpus, err = parseCPUList(o.cpus); err != nil {
+			logger.Error("Invalid CLI argument", "argument", "cpus", "error", err)
+			os.Exit(exitConfig)
+		}
+		if err := setCPUAffinity(cpus); err != nil {
+			logger.Warn("Unable to limit the load generator to the CPUs of -cpus, it runs on all CPUs", "cpus", o.cpus, "error", err)
+			cpus = nil
+		}
+	}
+	switch {
+	case o.gomaxprocs > 0:
+		runtime.GOMAXPROCS(o.gomaxprocs)
+	case o.gomaxprocs < 0:
+		logger.Error("Invalid CLI argument", "argument", "gomaxprocs", "error", "expected 0 for the default or a positive number of threads")
+		os.Exit(exitConfig)
+	case cpus != nil:
+		// GOMAXPROCS is derived from the CPUs available at startup, before the affinity was set
+		runtime.GOMAXPROCS(len(cpus))
+	}
+	if cpus != nil || o.gomaxprocs > 0 {
+		logger.Info("Limited the CPUs of the load generator", "cpus", cpus, "gomaxprocs", runtime.GOMAXPROCS(0))
+	}
+	return cpus
+}
+
+// maxCPUs is CPU_SETSIZE, the number of CPUs of the affinity masks of Linux
+const maxCPUs = 1024
+
+// parseCPUList parses a list of CPUs like the cpuset of Linux, e.g. 0-3,6
+func parseCPUList(s string) ([]int, error) {
+	var cpus []int
+	for _, part := range strings.Split(s, ",") {
+		first, last, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		from, err := strconv.Atoi(first)
+		if err != nil || from < 0 || from >= maxCPUs {
+			return nil, fmt.Errorf("invalid CPU %q, expected a list like 0-3,6 of CPUs below %d", part, maxCPUs)
+		}
+		to := from
+		if isRange {
+			if to, err = strconv.Atoi(last); err != nil || to < from || to >= maxCPUs {
+				return nil, fmt.Errorf("invalid CPU range %q, expected a list like 0-3,6 of CPUs below %d", part, maxCPUs)
+			}
+		}
+		for cpu := from; cpu <= to; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	slices.Sort(cpus)
+	return slices.Compact(cpus), nil
+}
+
+// formatCPUList returns the CPUs as comma separated list
+func formatCPUList(cpus []int) string {
+	list := make([]string, len(cpus))
+	for i, cpu := range cpus {
+		list[i] = strconv.Itoa(cpu)
+	}
+	return strings.Join(list, ",")
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCPUList(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []int
+		wantErr string
+	}{
+		{in: "0", want: []int{0}},
+		{in: "0-3", want: []int{0, 1, 2, 3}},
+		{in: "0-3,6", want: []int{0, 1, 2, 3, 6}},
+		{in: " 6, 2-3 ", want: []int{2, 3, 6}},
+		{in: "2-3,3,1-2", want: []int{1, 2, 3}},
+		{in: "5-5", want: []int{5}},
+		{in: "64,127", want: []int{64, 127}},
+		{in: "1023", want: []int{1023}},
+		{in: "", wantErr: "invalid CPU"},
+		{in: "a", wantErr: "invalid CPU"},
+		{in: "-1", wantErr: "invalid CPU"},
+		{in: "0,,1", wantErr: "invalid CPU"},
+		{in: "3-1", wantErr: "invalid CPU range"},
+		{in: "1-", wantErr: "invalid CPU range"},
+		{in: "1-x", wantErr: "invalid CPU range"},
+		{in: "1-2-3", wantErr: "invalid CPU range"},
+		{in: "1024", wantErr: "invalid CPU"},
+		{in: "0-1024", wantErr: "invalid CPU range"},
+		{in: "0-9223372036854775807", wantErr: "invalid CPU range"},
+		{in: "99999999999999999999", wantErr: "invalid CPU"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseCPUList(tt.in)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("parseCPUList(%q) = %v, %v, want an error containing %q", tt.in, got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseCPUList(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/jackc/pgx/v5"
+
+	"load-generator/internal/targets"
+)
+
+// fingerprintDataset hashes the file loaded into the dataset table for benchmark_meta
+func fingerprintDataset(dataset, mode, filename string, rowCount int) targets.DatasetFingerprint {
+	input, err := hashManifestInput(filename)
+	if err != nil {
+		logger.Error("Unable to fingerprint dataset", "dataset", dataset, "error", err)
+		os.Exit(exitConfig)
+	}
+	return targets.DatasetFingerprint{
+		Dataset:  dataset,
+		RunID:    runID,
+		Mode:     mode,
+		Filename: filename,
+		SHA256:   input.SHA256,
+		RowCount: int64(rowCount),
+	}
+}
+
+// recordDataset writes the fingerprint of the data an insert run loaded into benchmark_meta
+func recordDataset(ctx context.Context, connString string, dbTarget targets.DBTarget, fp targets.DatasetFingerprint) {
+	conn, err := pgx.Connect(ctx, connString)
+	if err != nil {
+		logger.Error("Unable to connect to database", "error", err)
+		os.Exit(exitConnection)
+	}
+	defer conn.Close(context.Background())
+	if err := targets.RecordDatasets(ctx, conn, dbTarget, []targets.DatasetFingerprint{fp}, logger); err != nil {
+		logger.Error("Unable to record dataset", "error", err)
+		os.Exit(exitFailure)
+	}
+}
+
+// assertDatasets checks that the files, keyed by dataset table, match the latest fingerprints in benchmark_meta,
+// so a query run fails before starting against data other than it expects
+func assertDatasets(ctx context.Context, connString string, files map[string]string) {
+	conn, err := pgx.Connect(ctx, connString)
+	if err != nil {
+		logger.Error("Unable to connect to database", "error", err)
+		os.Exit(exitConnection)
+	}
+	defer conn.Close(context.Background())
+	recorded, err := targets.LatestDatasets(ctx, conn)
+	if err != nil {
+		logger.Error("Unable to read recorded datasets", "error", err)
+		os.Exit(exitFailure)
+	}
+
+	mismatches := 0
+	for _, dataset := range slices.Sorted(maps.Keys(files)) {
+		actual := fingerprintDataset(dataset, "", files[dataset], 0)
+		fp, ok := recorded[dataset]
+		switch {
+		case !ok:
+			logger.Error("Dataset was never recorded in benchmark_meta", "dataset", dataset, "filename", actual.Filename)
+			mismatches++
+		case fp.SHA256 != actual.SHA256:
+			logger.Error("Dataset differs from the one loaded into the database", "dataset", dataset,
+				"filename", actual.Filename, "sha256", actual.SHA256,
+				"loadedFilename", fp.Filename, "loadedSha256", fp.SHA256, "loadedByRun", fp.RunID)
+			mismatches++
+		default:
+			logger.Info("Dataset matches the loaded one", "dataset", dataset, "sha256", fp.SHA256, "rowCount", fp.RowCount, "loadedByRun", fp.RunID)
+		}
+	}
+	if mismatches > 0 {
+		os.Exit(exitValidation)
+	}
+}
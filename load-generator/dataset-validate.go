@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"load-generator/internal/workload"
+)
+
+func runDatasetValidate(args []string) {
+	fs := newFlagSet("dataset-validate", "Check the trips CSV and optionally the POI CSV line by line for malformed UUIDs, unparseable timestamps,\ncoordinates out of range, timestamps going back within a trip and missing columns, so bad generator output\nis caught before a long insert run. Exits with code 4 if any line is offending.")
+	tripsPath := fs.String("trips", "../escooter-trips-generator/output/escooter-trips-small.csv", "Path or https:// or s3:// URL of the trips CSV to check, empty to skip it")
+	poisPath := fs.String("pois", "", "Optional path or https:// or s3:// URL of a POI CSV to check")
+	maxLines := fs.Int("max-lines", 20, "Number of offending line numbers listed per check")
+	asJSON := fs.Bool("json", false, "Print the report as JSON instead of text")
+	datasetTZ := registerDatasetTZ(fs)
+	fs.Parse(args)
+
+	logger = slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	mustSetDatasetTZ(*datasetTZ)
+	ctx, stop := signalContext()
+	defer stop()
+
+	var reports []*workload.ValidationReport
+	if *tripsPath != "" {
+		report, err := workload.ValidateTripsCSV(ctx, *tripsPath, *maxLines)
+		if err != nil {
+			logger.Error("Unable to validate trips", "filename", *tripsPath, "error", err)
+			os.Exit(exitConfig)
+		}
+		reports = append(reports, report)
+	}
+	if *poisPath != "" {
+		report, err := workload.ValidatePOIsCSV(ctx, *poisPath, *maxLines)
+		if err != nil {
+			logger.Error("Unable to validate POIs", "filename", *poisPath, "error", err)
+			os.Exit(exitConfig)
+		}
+		reports = append(reports, report)
+	}
+	if len(reports) == 0 {
+		fs.Usage()
+		os.Exit(exitConfig)
+	}
+
+	valid := true
+	for _, report := range reports {
+		valid = valid && report.Valid()
+	}
+	if *asJSON {
+		b, _ := json.MarshalIndent(reports, "", "  ")
+		fmt.Println(string(b))
+	} else {
+		printValidationReports(reports)
+	}
+	if !valid {
+		os.Exit(exitValidation)
+	}
+}
+
+func printValidationReports(reports []*workload.ValidationReport) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, report := range reports {
+		fmt.Fprintf(w, "%s (%s, %d rows)\n", report.File, report.Kind, report.Rows)
+		fmt.Fprintln(w, "check\toffending\t")
+		for _, name := range report.CheckNames() {
+			fmt.Fprintf(w, "%s\t%d\t\n", name, report.Checks[name].Offending)
+		}
+		w.Flush()
+		for _, name := range report.CheckNames() {
+			check := report.Checks[name]
+			for _, line := range check.Lines {
+				fmt.Printf("  %s line %d: %s\n", name, line.Line, line.Problem)
+			}
+			if check.Offending > len(check.Lines) {
+				fmt.Printf("  %s: %d more offending lines\n", name, check.Offending-len(check.Lines))
+			}
+		}
+		fmt.Println()
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"load-generator/internal/targets"
+)
+
+type dbStatsQuery struct {
+	Name string
+	// first column may be a text label (e.g. node name), all other columns are metrics
+	SQL string
+	// optional queries (e.g. extensions which may not be installed) are disabled after first failure
+	Optional bool
+}
+
+var cratedbStatsQueries = []dbStatsQuery{
+	{
+		Name: "nodes",
+		SQL: `SELECT name, load['1'] AS load1, heap['used'] AS heap_used, heap['max'] AS heap_max,
+	process['cpu']['percent'] AS process_cpu_percent
+FROM sys.nodes`,
+	},
+	{
+		Name: "jobs",
+		SQL:  `SELECT count(*) AS running FROM sys.jobs`,
+	},
+	{
+		Name: "jobs_log",
+		SQL: `SELECT count(*) AS finished,
+	avg(extract(epoch FROM ended) - extract(epoch FROM started)) * 1000 AS avg_duration_ms
+FROM sys.jobs_log
+WHERE ended >= now() - '1 minute'::interval`,
+	},
+}
+
+var mobilitydbStatsQueries = []dbStatsQuery{
+	{
+		Name: "pg_stat_database",
+		SQL: `SELECT numbackends, xact_commit, xact_rollback, blks_read, blks_hit,
+	tup_returned, tup_fetched, tup_inserted, tup_updated, tup_deleted
+FROM pg_stat_database
+WHERE datname = current_database()`,
+	},
+	{
+		Name:     "pg_stat_statements",
+		SQL:      `SELECT sum(calls)::bigint AS calls, sum(total_exec_time) AS total_exec_time_ms FROM pg_stat_statements`,
+		Optional: true,
+	},
+}
+
+// startDBStatsCollector periodically queries server-side statistics of the target database
+// on a dedicated connection and writes them to the dbstats CSV file in long format.
+// Returned function stops the collector and closes the file.
+func startDBStatsCollector(ctx context.Context, interval time.Duration, connString string, mode string, dbTarget targets.DBTarget, numWorkers int) func() {
+	if interval <= 0 {
+		return func() {}
+	}
+
+	conn, err := pgx.Connect(ctx, connString)
+	if err != nil {
+		logger.Error("DB stats collector was unable to connect to database", "error", err)
+		os.Exit(exitConnection)
+	}
+
+	file := createArtifactCSV("dbstats", mode, dbTarget.String(), workersPart(numWorkers))
+	csvWriter := csv.NewWriter(file)
+
+	csvHeader := []string{"runId", "timestamp", "query", "label", "metric", "value"}
+	if err := csvWriter.Write(csvHeader); err != nil {
+		logger.Error("Failed to write dbstats CSV header", "error", err)
+		os.Exit(exitFailure)
+	}
+
+	queries := cratedbStatsQueries
+	switch dbTarget {
+	case targets.CrateDB:
+		queries = cratedbStatsQueries
+	case targets.MobilityDB:
+		queries = mobilitydbStatsQueries
+	}
+
+	collectorCtx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		collectDBStats(collectorCtx, interval, conn, queries, csvWriter)
+	}()
+
+	return func() {
+		cancel()
+		wg.Wait()
+		csvWriter.Flush()
+		file.Close()
+		conn.Close(context.Background())
+	}
+}
+
+func collectDBStats(ctx context.Context, interval time.Duration, conn *pgx.Conn, queries []dbStatsQuery, csvWriter *csv.Writer) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	disabled := make(map[string]bool)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			timestamp := now.Format(time.RFC3339)
+			for _, q := range queries {
+				if disabled[q.Name] {
+					continue
+				}
+				records, err := queryDBStats(ctx, conn, q, timestamp)
+				if err != nil {
+					if ctx.Err() != nil {
+						return
+					}
+					if q.Optional {
+						logger.Warn("Optional DB stats query failed, disabling it", "query", q.Name, "error", err)
+						disabled[q.Name] = true
+					} else {
+						logger.Warn("DB stats query failed", "query", q.Name, "error", err)
+					}
+					continue
+				}
+				for _, record := range records {
+					if err := csvWriter.Write(record); err != nil {
+						logger.Error("Failed to write dbstats CSV record", "error", err)
+					}
+				}
+			}
+			csvWriter.Flush()
+		}
+	}
+}
+
+func queryDBStats(ctx context.Context, conn *pgx.Conn, q dbStatsQuery, timestamp string) ([][]string, error) {
+	rows, err := conn.Query(ctx, q.SQL)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records [][]string
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return nil, err
+		}
+		fields := rows.FieldDescriptions()
+
+		label := ""
+		first := 0
+		if s, ok := values[0].(string); ok {
+			label = s
+			first = 1
+		}
+		for i := first; i < len(values); i++ {
+			records = append(records, []string{
+				runID,
+				timestamp,
+				q.Name,
+				label,
+				fields[i].Name,
+				fmt.Sprintf("%v", values[i]),
+			})
+		}
+	}
+	return records, rows.Err()
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"load-generator/internal/workload"
+)
+
+func runDownsampleDataset(args []string) {
+	fs := newFlagSet("downsample-dataset", "Write a smaller trips CSV keeping every N-th trip with all its events, e.g. a reproducible replacement\nfor escooter-trips-small.csv: downsample-dataset -every 5 -max-trips 10000")
+	tripsPath := fs.String("trips", "../escooter-trips-generator/output/escooter-trips.csv", "Path or https:// or s3:// URL of the CSV file containing the escooter trip events to downsample")
+	out := fs.String("out", "", "Path of the downsampled CSV file, defaults to the input with -every<N> appended, e.g. trips-every5.csv. An existing file is not overwritten")
+	every := fs.Int("every", 5, "Keep every <N>-th trip in the order of their first event")
+	maxTrips := fs.Int("max-trips", 0, "Stop after <N> trips, 0 keeps every N-th trip of the whole input")
+	datasetTZ := registerDatasetTZ(fs)
+	fs.Parse(args)
+
+	logger = slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	mustSetDatasetTZ(*datasetTZ)
+	ctx, stop := signalContext()
+	defer stop()
+
+	if *every < 1 || *maxTrips < 0 {
+		logger.Error("Invalid CLI argument", "argument", "every", "error", "expected -every of at least 1 and a non-negative -max-trips")
+		os.Exit(exitConfig)
+	}
+	if *out == "" {
+		*out = strings.TrimSuffix(*tripsPath, ".csv") + "-every" + strconv.Itoa(*every) + ".csv"
+	}
+
+	var trips, events int
+	writeDatasetFile(*out, func(f *os.File) error {
+		var err error
+		trips, events, err = workload.DownsampleTrips(ctx, *tripsPath, f, *every, *maxTrips)
+		return err
+	})
+	logger.Info("Downsampled trips", "filename", *out, "every", *every, "maxTrips", *maxTrips, "trips", trips, "events", events)
+}
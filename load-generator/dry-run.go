@@ -0,0 +1,188 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+
+	"load-generator/internal/targets"
+	"load-generator/internal/workload"
+)
+
+// longer sample statements are cut, bulk inserts of a whole batch can be megabytes
+const dryRunSampleLen = 1000
+
+// printDryRunSQL prints a sample statement that would be executed, shortened to dryRunSampleLen
+func printDryRunSQL(title, sql string) {
+	sql = strings.TrimSpace(sql)
+	if len(sql) > dryRunSampleLen {
+		sql = fmt.Sprintf("%s\n... (%d more bytes)", sql[:dryRunSampleLen], len(sql)-dryRunSampleLen)
+	}
+	fmt.Printf("-- %s\n%s\n\n", title, sql)
+}
+
+// dryRunInit prints the migrations and the reference data inserts init would execute
+func dryRunInit(dbTarget targets.DBTarget, pois []workload.POI, localities []workload.Locality, opts targets.InitOptions, partitionsFrom, partitionsTo time.Time, workloadRole string, crateSettings targets.CrateSettings) error {
+	migrationFiles, err := targets.MigrationFiles(opts.MigrationsDir, opts.SchemaVariant)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Dry run of init against %s, nothing is executed\n\n", dbTarget)
+	fmt.Printf("Migrations (%d files):\n", len(migrationFiles))
+	for _, migrationFile := range migrationFiles {
+		migrationSQL, err := targets.ReadMigration(migrationFile, opts.Params)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("  %s: %d statements\n", migrationFile, len(targets.SplitStatements(migrationSQL)))
+	}
+	fmt.Println()
+
+	fmt.Printf("1 statement inserting %d POIs\n", len(pois))
+	fmt.Printf("%d statements inserting localities, sent as one batch\n", len(localities))
+	if len(opts.NoParkingZones) > 0 {
+		fmt.Printf("%d statements inserting no-parking zones, sent as one batch\n", len(opts.NoParkingZones))
+	}
+	if len(opts.Weather) > 0 {
+		fmt.Printf("%d statements inserting weather observations, sent as one batch\n", len(opts.Weather))
+	}
+	fmt.Printf("Existing reference data: %s\n", opts.OnExisting)
+	if !partitionsFrom.IsZero() {
+		interval := cmp.Or(opts.Params.ChunkInterval, "month")
+		starts, err := targets.PartitionStarts(interval, partitionsFrom, partitionsTo)
+		switch {
+		case err == nil:
+			fmt.Printf("Pre-creating %d partitions of %s from %s to %s\n", len(starts), interval, starts[0].Format(time.RFC3339), partitionsTo.Format(time.RFC3339))
+		case dbTarget == targets.MobilityDB:
+			// create_time_partitions accepts any interval, e.g. '7 days'
+			fmt.Printf("Pre-creating partitions of %s from %s to %s\n", interval, partitionsFrom.Format(time.RFC3339), partitionsTo.Format(time.RFC3339))
+		default:
+			return err
+		}
+	}
+	if !crateSettings.IsZero() {
+		fmt.Printf("Table settings of the events table: %+v\n", crateSettings)
+	}
+	if workloadRole != "" {
+		fmt.Printf("Setting up workload role %s with row read and write grants on the benchmark tables\n", workloadRole)
+	}
+	fmt.Println()
+	printDryRunSQL("POI insert", targets.InsertPOIsSQL(dbTarget, pois))
+	printDryRunSQL("Locality insert", targets.LocalityInsertSQL(dbTarget, opts.MakeValidGeometries))
+	if len(opts.NoParkingZones) > 0 {
+		printDryRunSQL("No-parking zone insert", targets.NoParkingZoneInsertSQL(dbTarget))
+	}
+	if len(opts.Weather) > 0 {
+		printDryRunSQL("Weather observation insert", targets.WeatherInsertSQL())
+	}
+	return nil
+}
+
+// dryRunCleanup prints the down migrations cleanup would execute
+func dryRunCleanup(dbTarget targets.DBTarget, migrationsDir, schemaVariant string) error {
+	downFiles, err := targets.DownMigrationFiles(migrationsDir, schemaVariant)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Dry run of cleanup against %s, nothing is executed\n\n", dbTarget)
+	fmt.Printf("Down migrations (%d files):\n", len(downFiles))
+	for _, downFile := range downFiles {
+		downSQL, err := targets.ReadMigration(downFile, targets.MigrationParams{})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("  %s: %d statements\n", downFile, len(targets.SplitStatements(downSQL)))
+	}
+	fmt.Println()
+	printDryRunSQL("Afterwards", "DROP TABLE IF EXISTS "+targets.Table("schema_migrations"))
+	return nil
+}
+
+// dryRunInsert reads the trip events and prints how they would be batched and a sample insert statement
+func dryRunInsert(dbTarget targets.DBTarget, tripsPath string, attributes []workload.EventAttribute, batchSize int, useBulkInsert bool) error {
+	if isKafkaSource(tripsPath) {
+		fmt.Printf("Dry run of insert against %s, nothing is executed\n\n", dbTarget)
+		fmt.Printf("Trip events are consumed from %s, which a dry run doesn't connect to\n", redactConnString(tripsPath))
+		return nil
+	}
+	r, err := workload.OpenTripEventsWithAttributes(tripsPath, attributes)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	eventsCount := 0
+	var firstBatch []workload.TripEvent
+	for {
+		tripEvent, err := r.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if len(firstBatch) < batchSize {
+			firstBatch = append(firstBatch, tripEvent)
+		}
+		eventsCount++
+	}
+	batchesCount := (eventsCount + batchSize - 1) / batchSize
+
+	fmt.Printf("Dry run of insert against %s, nothing is executed\n\n", dbTarget)
+	fmt.Printf("%d trip events in %d batches of up to %d events\n", eventsCount, batchesCount, batchSize)
+	if useBulkInsert {
+		fmt.Printf("%d statements, one bulk insert per batch\n\n", batchesCount)
+		if len(firstBatch) > 0 {
+			printDryRunSQL("Bulk insert of the first batch", targets.BulkInsertEventsSQL(dbTarget, firstBatch))
+		}
+	} else {
+		fmt.Printf("%d statements, one insert per event sent as one pgx batch per batch\n\n", eventsCount)
+		if len(firstBatch) > 0 {
+			printDryRunSQL("Insert of the first event", targets.InsertEventSQL(dbTarget, firstBatch[0]))
+		}
+	}
+	if dbTarget == targets.MobilityDB {
+		printDryRunSQL("Import of the events into the trips table", targets.PrefixTables(targets.ImportTripsSQL))
+	}
+	return nil
+}
+
+// dryRunQueries renders all numQueries queries like the query benchmark schedules them
+// and prints the first rendered query of every template
+func dryRunQueries(dbTarget targets.DBTarget, queryTemplates *template.Template, generator *workload.QueryFieldGenerator, numQueries int) error {
+	queryTemplates = queryTemplates.Option("missingkey=error")
+	templateNames := workload.TemplateNames(queryTemplates)
+	if len(templateNames) == 0 {
+		return fmt.Errorf("No query templates defined")
+	}
+
+	counts := make(map[string]int, len(templateNames))
+	samples := make(map[string]string, len(templateNames))
+	for i := range numQueries {
+		tmplName := templateNames[i%len(templateNames)]
+		var query strings.Builder
+		if err := queryTemplates.ExecuteTemplate(&query, tmplName, targets.EscapeQueryFields(generator.GenerateFields(i))); err != nil {
+			return fmt.Errorf("Rendering query %d with template %s: %w", i, tmplName, err)
+		}
+		counts[tmplName]++
+		if _, ok := samples[tmplName]; !ok {
+			samples[tmplName] = targets.PrefixTables(query.String())
+		}
+	}
+
+	fmt.Printf("Dry run of %d queries against %s, nothing is executed\n\n", numQueries, dbTarget)
+	for _, name := range templateNames {
+		fmt.Printf("  %s: %d queries\n", name, counts[name])
+	}
+	fmt.Println()
+	for _, name := range templateNames {
+		if sample, ok := samples[name]; ok {
+			printDryRunSQL("Template "+name, sample)
+		}
+	}
+	return nil
+}
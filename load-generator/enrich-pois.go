@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"load-generator/internal/osm"
+	"load-generator/internal/workload"
+)
+
+func runEnrichPOIs(args []string) {
+	fs := newFlagSet("enrich-pois", "Query the Overpass API for POIs of the given categories within the bounding box of a POI CSV\nand write them merged into a new POI CSV with fresh UUIDs, to vary the POI density of the radius queries.")
+	poisPath := fs.String("pois", "../escooter-trips-generator/output/berlin-pois.csv", "Path or https:// or s3:// URL of the POI CSV to enrich")
+	out := fs.String("out", "", "Path of the enriched POI CSV, defaults to the input with -enriched appended, e.g. berlin-pois-enriched.csv. An existing file is not overwritten")
+	categories := fs.String("categories", "amenity,tourism,shop,leisure", "Comma separated categories to query, a tag key for all its values, e.g. shop, or a key and value, e.g. amenity=cafe")
+	bboxStr := fs.String("bbox", "", "Bounding box minLon,minLat,maxLon,maxLat to query, defaults to the one of the input POIs")
+	fraction := fs.Float64("fraction", 1, "Fraction (0-1) of the queried POIs added, to add POIs at a lower density")
+	seed := fs.Int64("seed", 42, "Random seed of the UUIDs and the sampled POIs")
+	overpassURL := fs.String("overpass-url", osm.DefaultOverpassURL, "Interpreter endpoint of the Overpass API")
+	timeout := fs.Duration("timeout", 3*time.Minute, "Timeout of the Overpass query")
+	fs.Parse(args)
+
+	logger = slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	ctx, stop := signalContext()
+	defer stop()
+
+	if *fraction < 0 || *fraction > 1 {
+		logger.Error("Invalid CLI argument", "argument", "fraction", "error", "expected a fraction between 0 and 1")
+		os.Exit(exitConfig)
+	}
+	if *out == "" {
+		*out = strings.TrimSuffix(*poisPath, ".csv") + "-enriched.csv"
+	}
+
+	pois := mustLoadPOIs(*poisPath)
+	bbox, err := workload.POIsBBox(pois)
+	if *bboxStr != "" {
+		bbox, err = workload.ParseBBox(*bboxStr)
+	}
+	if err != nil {
+		logger.Error("Invalid CLI argument", "argument", "bbox", "error", err)
+		os.Exit(exitConfig)
+	}
+
+	logger.Info("Querying Overpass API", "url", *overpassURL, "categories", *categories,
+		"bbox", fmt.Sprintf("%g,%g,%g,%g", bbox.MinLon, bbox.MinLat, bbox.MaxLon, bbox.MaxLat))
+	queried, err := osm.QueryOverpassPOIs(ctx, *overpassURL, strings.Split(*categories, ","), bbox, *timeout)
+	if err != nil {
+		logger.Error("Unable to query POIs", "error", err)
+		os.Exit(exitConnection)
+	}
+
+	merged, stats := workload.MergePOIs(pois, queried, *fraction, rand.New(rand.NewSource(*seed)))
+	writeDatasetFile(*out, func(f *os.File) error { return workload.WritePOIsCSV(f, merged) })
+	logger.Info("Wrote enriched POIs", "filename", *out,
+		"existing", len(pois),
+		"queried", len(queried),
+		"added", stats.Added,
+		"duplicates", stats.Duplicates,
+		"leftOut", stats.Sampled,
+		"total", len(merged),
+	)
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"load-generator/internal/targets"
+	"load-generator/internal/workload"
+)
+
+// EquivalenceResult is the outcome of one query of the equivalence run on one target
+type EquivalenceResult struct {
+	DBTarget  string `json:"dbTarget"`
+	SQL       string `json:"sql"`
+	RowsCount int    `json:"rowsCount"`
+	Checksum  string `json:"checksum,omitempty"` // of the rows normalized with -float-precision, independent of their order
+	Error     string `json:"error,omitempty"`
+}
+
+// EquivalenceDivergence is a query whose targets returned a different number of rows, different values or failed
+type EquivalenceDivergence struct {
+	QueryIndex   int                  `json:"queryIndex"`
+	TemplateName string               `json:"templateName"`
+	Fields       workload.QueryFields `json:"fields"`
+	Reason       string               `json:"reason"` // rowsCount, checksum or error
+	Results      []EquivalenceResult  `json:"results"`
+}
+
+// EquivalenceTemplate counts the divergences of the queries of a template
+type EquivalenceTemplate struct {
+	Name        string `json:"name"`
+	Queries     int    `json:"queries"`
+	Divergences int    `json:"divergences"`
+}
+
+// EquivalenceReport compares the results of the same seeded queries on two targets
+type EquivalenceReport struct {
+	RunID              string                  `json:"runId"`
+	Targets            []string                `json:"targets"`
+	Seed               int64                   `json:"seed"`
+	Queries            int                     `json:"queries"`
+	Checksums          bool                    `json:"checksums"`
+	FloatPrecision     int                     `json:"floatPrecision"`
+	RowCountMismatches int                     `json:"rowCountMismatches"`
+	ChecksumMismatches int                     `json:"checksumMismatches"`
+	Errors             int                     `json:"errors"`
+	Templates          []EquivalenceTemplate   `json:"templates"`
+	Divergences        []EquivalenceDivergence `json:"divergences"`
+}
+
+// equivalenceTarget is a database of the equivalence run with its templates
+type equivalenceTarget struct {
+	name      string
+	dbTarget  targets.DBTarget
+	conn      *pgx.Conn
+	templates *template.Template
+}
+
+func runEquivalence(args []string) {
+	fs := newFlagSet("equivalence", "Execute the same seeded queries on two databases one after another and compare their row counts and optionally checksums of their values,\n"+
+		"to establish that the targets return the same results before comparing their speed. The databases are given by -targets, -db and -dbTarget are ignored.\n"+
+		"The divergences are written to the equivalence report, the command fails with exit code 5 if there are any.")
+	var common commonOptions
+	common.register(fs)
+	var targetsSpec targetsFlag
+	fs.Var(&targetsSpec, "targets", "The two targets to compare, comma separated, defaults to cratedb,mobilitydbc. Repeatable, a connection string is given as <target>=<connString> at the end of a value, targets without connection string use LOADGEN_DB_URL_<TARGET>")
+	localitiesPath := fs.String("localities", "../escooter-trips-generator/output/berlin-localities.geojson", "Path or https:// or s3:// URL of a GeoJSON, GeoParquet (.parquet) or shapefile (.shp or .zip) file containing localities")
+	localityFields := registerLocalityFields(fs)
+	poisPath := fs.String("pois", "../escooter-trips-generator/output/berlin-pois.csv", "Path or https:// or s3:// URL of a CSV or GeoParquet (.parquet) file containing POIs")
+	tripsPath := fs.String("trips", "../escooter-trips-generator/output/escooter-trips-small.csv", "Path or https:// or s3:// URL of a CSV file containing the escooter trip events")
+	numQueries := fs.Int("nqueries", 100, "Number of queries to execute on each target")
+	randomSeed := fs.Int64("seed", 42, "Random seed for deterministic query generation")
+	queriesFilepath := fs.String("queries", "./schemas/{target}-simple-read-queries.tmpl", "Path to a file containing query templates, {target} is replaced by the target. The templates of both targets need the same names")
+	checksums := fs.Bool("checksums", false, "Also compare checksums of the returned values, not only the row counts. Geometries only match if the templates of both targets return them in the same representation")
+	floatPrecision := fs.Int("float-precision", 6, "Decimal places floats, e.g. distances and coordinates, are rounded to before computing the checksums, tolerating the different precision of the targets")
+	fs.Parse(args)
+
+	ctx, stop := signalContext()
+	defer stop()
+	common.setup("equivalence", 0)
+	defer common.close()
+
+	if len(targetsSpec) == 0 {
+		targetsSpec = targetsFlag{"cratedb,mobilitydbc"}
+	}
+	parsed, err := parseMultiTargets(targetsSpec)
+	if err != nil {
+		logger.Error("Invalid CLI argument", "argument", "targets", "error", err)
+		os.Exit(exitConfig)
+	}
+	if len(parsed) != 2 {
+		logger.Error("Invalid CLI argument", "argument", "targets", "error", "expected exactly two targets to compare")
+		os.Exit(exitConfig)
+	}
+	if *numQueries < 1 || *floatPrecision < 0 {
+		logger.Error("Invalid CLI argument", "argument", "nqueries", "error", "expected at least one query and a float precision of at least 0")
+		os.Exit(exitConfig)
+	}
+
+	localities := mustLoadLocalities(*localitiesPath, *localityFields)
+	pois := mustLoadPOIs(*poisPath)
+	tripIds, err := workload.ReadTripIDs(ctx, *tripsPath)
+	if err != nil {
+		logger.Error("Unable to read trip ids", "error", err)
+		os.Exit(exitConfig)
+	}
+
+	var eqTargets []*equivalenceTarget
+	for _, t := range parsed {
+		dbTarget, _ := targets.Parse(t.name)
+		eqTargets = append(eqTargets, &equivalenceTarget{
+			name:      t.name,
+			dbTarget:  dbTarget,
+			templates: mustLoadTemplates(strings.ReplaceAll(*queriesFilepath, "{target}", t.name)).Option("missingkey=error"),
+		})
+	}
+	templateNames := workload.TemplateNames(eqTargets[0].templates)
+	if other := workload.TemplateNames(eqTargets[1].templates); !slices.Equal(templateNames, other) {
+		logger.Error("Invalid CLI argument", "argument", "queries", "error", fmt.Sprintf("the templates of %s %v don't match the ones of %s %v", eqTargets[0].name, templateNames, eqTargets[1].name, other))
+		os.Exit(exitConfig)
+	}
+
+	logger.Info("Starting load-generator with following cli arguments",
+		"mode", "equivalence",
+		"targets", []string{eqTargets[0].name, eqTargets[1].name},
+		"trips", *tripsPath,
+		"localities", *localitiesPath,
+		"pois", *poisPath,
+		"qtemplates", *queriesFilepath,
+		"numQueries", *numQueries,
+		"seed", *randomSeed,
+		"checksums", *checksums,
+		"floatPrecision", *floatPrecision,
+	)
+	if common.dryRun {
+		generator := mustNewQueryFieldGenerator(*randomSeed, localities, pois, tripIds)
+		for _, t := range eqTargets {
+			if err := dryRunQueries(t.dbTarget, t.templates, generator, *numQueries); err != nil {
+				logger.Error("Dry run failed", "target", t.name, "error", err)
+				os.Exit(exitConfig)
+			}
+		}
+		return
+	}
+
+	for i, t := range eqTargets {
+		conn, err := pgx.Connect(ctx, withPasswordFromEnv(parsed[i].connString))
+		if err != nil {
+			logger.Error("Unable to connect to database", "target", t.name, "error", err)
+			os.Exit(exitConnection)
+		}
+		defer conn.Close(context.Background())
+		t.conn = conn
+	}
+
+	report := EquivalenceReport{
+		Targets:        []string{eqTargets[0].name, eqTargets[1].name},
+		Seed:           *randomSeed,
+		Checksums:      *checksums,
+		FloatPrecision: *floatPrecision,
+	}
+	perTemplate := make(map[string]*EquivalenceTemplate)
+	for _, name := range templateNames {
+		perTemplate[name] = &EquivalenceTemplate{Name: name}
+	}
+	generator := mustNewQueryFieldGenerator(*randomSeed, localities, pois, tripIds)
+	for i := range *numQueries {
+		if ctx.Err() != nil {
+			logger.Warn("Equivalence run interrupted, the report contains only the queries executed before", "queries", report.Queries)
+			break
+		}
+		fields := generator.GenerateFields(i)
+		templateName := templateNames[i%len(templateNames)]
+		queryResults := make([]EquivalenceResult, len(eqTargets))
+		for j, t := range eqTargets {
+			queryResults[j] = t.execute(ctx, templateName, fields, *checksums, *floatPrecision)
+		}
+		report.Queries++
+		perTemplate[templateName].Queries++
+
+		reason := ""
+		switch a, b := queryResults[0], queryResults[1]; {
+		case a.Error != "" || b.Error != "":
+			reason = "error"
+			report.Errors++
+		case a.RowsCount != b.RowsCount:
+			reason = "rowsCount"
+			report.RowCountMismatches++
+		case a.Checksum != b.Checksum:
+			reason = "checksum"
+			report.ChecksumMismatches++
+		}
+		if reason != "" {
+			perTemplate[templateName].Divergences++
+			report.Divergences = append(report.Divergences, EquivalenceDivergence{QueryIndex: i, TemplateName: templateName, Fields: fields, Reason: reason, Results: queryResults})
+			logger.Warn("Targets diverge", "queryIndex", i, "template", templateName, "reason", reason,
+				"rowsCount", []int{queryResults[0].RowsCount, queryResults[1].RowsCount})
+		}
+		if (i+1)%100 == 0 {
+			logger.Info("Equivalence progress", "queries", i+1, "divergences", len(report.Divergences))
+		}
+	}
+	for _, name := range templateNames {
+		report.Templates = append(report.Templates, *perTemplate[name])
+	}
+
+	writeEquivalenceReport(report)
+	logger.Info("Compared the targets",
+		"queries", report.Queries,
+		"rowCountMismatches", report.RowCountMismatches,
+		"checksumMismatches", report.ChecksumMismatches,
+		"errors", report.Errors,
+	)
+	if len(report.Divergences) > 0 {
+		logger.Error("Targets returned different results", "divergences", len(report.Divergences))
+		os.Exit(exitAssertion)
+	}
+}
+
+// execute renders the template with the fields and executes it, computing the checksum of the rows if requested
+func (t *equivalenceTarget) execute(ctx context.Context, templateName string, fields workload.QueryFields, checksum bool, floatPrecision int) EquivalenceResult {
+	result := EquivalenceResult{DBTarget: t.name}
+	var query strings.Builder
+	if err := t.templates.ExecuteTemplate(&query, templateName, targets.EscapeQueryFields(fields)); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.SQL = targets.PrefixTables(query.String())
+
+	rows, err := t.conn.Query(ctx, result.SQL)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer rows.Close()
+	var normalized []string
+	for rows.Next() {
+		result.RowsCount++
+		if !checksum {
+			continue
+		}
+		values, err := rows.Values()
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		var row strings.Builder
+		for i, value := range values {
+			if i > 0 {
+				row.WriteByte('|')
+			}
+			writeNormalizedValue(&row, value, floatPrecision)
+		}
+		normalized = append(normalized, row.String())
+	}
+	if err := rows.Err(); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if checksum {
+		// the targets may return rows of equal sort keys in any order
+		slices.Sort(normalized)
+		h := sha256.New()
+		for _, row := range normalized {
+			h.Write([]byte(row))
+			h.Write([]byte{'\n'})
+		}
+		result.Checksum = hex.EncodeToString(h.Sum(nil))
+	}
+	return result
+}
+
+// writeNormalizedValue writes the value in a representation independent of the target's types,
+// floats and numeric strings are rounded to precision decimal places, times are in UTC
+func writeNormalizedValue(b *strings.Builder, value any, precision int) {
+	switch v := value.(type) {
+	case nil:
+		b.WriteString("NULL")
+	case float64:
+		b.WriteString(normalizeFloat(v, precision))
+	case float32:
+		b.WriteString(normalizeFloat(float64(v), precision))
+	case int, int8, int16, int32, int64, uint8, uint16, uint32, uint64:
+		fmt.Fprint(b, v)
+	case pgtype.Numeric:
+		f, err := v.Float64Value()
+		if err != nil || !f.Valid {
+			b.WriteString("NULL")
+			return
+		}
+		b.WriteString(normalizeFloat(f.Float64, precision))
+	case time.Time:
+		b.WriteString(v.UTC().Format(time.RFC3339Nano))
+	case [16]byte: // UUIDs of MobilityDB, CrateDB returns them as text
+		fmt.Fprintf(b, "%x-%x-%x-%x-%x", v[0:4], v[4:6], v[6:8], v[8:10], v[10:16])
+	case string:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			b.WriteString(normalizeFloat(f, precision))
+		} else {
+			b.WriteString(v)
+		}
+	case []byte:
+		b.WriteString(hex.EncodeToString(v))
+	case []any:
+		b.WriteByte('[')
+		for i, e := range v {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			writeNormalizedValue(b, e, precision)
+		}
+		b.WriteByte(']')
+	case []float64:
+		b.WriteByte('[')
+		for i, e := range v {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(normalizeFloat(e, precision))
+		}
+		b.WriteByte(']')
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		b.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(k + ":")
+			writeNormalizedValue(b, v[k], precision)
+		}
+		b.WriteByte('}')
+	default:
+		fmt.Fprint(b, v)
+	}
+}
+
+// normalizeFloat rounds f to precision decimal places, integral floats are written like integers
+func normalizeFloat(f float64, precision int) string {
+	scale := math.Pow(10, float64(precision))
+	rounded := math.Round(f*scale) / scale
+	if rounded == 0 {
+		rounded = 0 // no negative zero
+	}
+	return strconv.FormatFloat(rounded, 'f', -1, 64)
+}
+
+func writeEquivalenceReport(report EquivalenceReport) string {
+	timestamp := time.Now().Format("20060102_150405")
+
+	filename := fmt.Sprintf("equivalence_%s_%s_%s_%s.json", report.Targets[0], report.Targets[1], timestamp, runID)
+	filename = path.Join(resultsDir, filename)
+
+	report.RunID = runID
+	b, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		logger.Error("Failed to encode equivalence report", "error", err)
+		os.Exit(exitFailure)
+	}
+	if err := writeNewFile(filename, b); err != nil {
+		logger.Error("Failed to write equivalence report", "filename", filename, "error", err)
+		os.Exit(exitFailure)
+	}
+
+	registerArtifact(filename)
+	logger.Info("Wrote equivalence report", "filename", filename)
+	return filename
+}
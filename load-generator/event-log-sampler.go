@@ -0,0 +1,37 @@
+package main
+
+import (
+	"math/rand"
+)
+
+// EventLogSampler decides which per-operation events are written to the log.
+// The results CSV always contains every event, only the log output is sampled.
+type EventLogSampler struct {
+	// fraction of events to log, 1 logs all events
+	rate float64
+	// quiet disables per-event logging, only failed operations are logged
+	quiet bool
+}
+
+var eventLogSampler = NewEventLogSampler(1, false)
+
+func NewEventLogSampler(rate float64, quiet bool) *EventLogSampler {
+	return &EventLogSampler{rate: rate, quiet: quiet}
+}
+
+// Sample reports whether the event should be logged, failed events are always logged in quiet mode.
+// Safe for concurrent use, the sampling of log lines doesn't have to be reproducible and uses the global source.
+func (s *EventLogSampler) Sample(failed bool) bool {
+	if s.quiet {
+		return failed
+	}
+	if s.rate >= 1 {
+		return true
+	}
+	return rand.Float64() < s.rate
+}
+
+// Quiet reports whether only aggregates and errors should be logged
+func (s *EventLogSampler) Quiet() bool {
+	return s.quiet
+}
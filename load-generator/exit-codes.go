@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Exit codes of the commands, so wrapper scripts and schedulers can react to the class of failure
+const (
+	exitFailure    = 1 // unexpected failure during the run, e.g. writing an artifact
+	exitConfig     = 2 // invalid flags or unreadable input files, same code the flag package uses
+	exitConnection = 3 // unable to connect to the target or results database, a message broker or a REST API
+	exitValidation = 4 // query templates, the inputs of a replay or query, locality geometries or the schema failed validation
+	exitAssertion  = 5 // the run finished but a check on its results failed
+	exitAborted    = 6 // the run was interrupted or exceeded -max-duration, partial results were written
+)
+
+var exitCodeDescriptions = []struct {
+	code        int
+	description string
+}{
+	{0, "success"},
+	{exitFailure, "unexpected failure during the run"},
+	{exitConfig, "invalid flags or input files"},
+	{exitConnection, "unable to connect to a database, message broker or REST API"},
+	{exitValidation, "query templates, replay or query inputs, geometries or the schema failed validation"},
+	{exitAssertion, "a check on the results failed"},
+	{exitAborted, "run interrupted or -max-duration exceeded, partial results written"},
+}
+
+// errTemplateValidation is wrapped by errors of templates failing to render or execute
+var errTemplateValidation = errors.New("Not all templates passed the validation")
+
+// errBrokerConnection is wrapped by errors of connecting to or receiving from a message broker
+var errBrokerConnection = errors.New("Message broker connection failed")
+
+// exitCode classifies an error returned by a benchmark
+func exitCode(err error) int {
+	var connectErr *pgconn.ConnectError
+	switch {
+	case errors.As(err, &connectErr), errors.Is(err, errBrokerConnection), errors.Is(err, errAPIConnection):
+		return exitConnection
+	case errors.Is(err, errTemplateValidation):
+		return exitValidation
+	default:
+		return exitFailure
+	}
+}
+
+func printExitCodes(w io.Writer) {
+	fmt.Fprintln(w, "Exit codes:")
+	for _, c := range exitCodeDescriptions {
+		fmt.Fprintf(w, "  %d  %s\n", c.code, c.description)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"flag"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"load-generator/internal/results"
+	"load-generator/internal/targets"
+)
+
+// failoverLatencyWindow is the time before the detection and after the completion of a failover
+// whose operations are compared to report its latency impact
+const failoverLatencyWindow = 30 * time.Second
+
+// FailoverReport describes the workers moving from one endpoint to another after losing their connections
+type FailoverReport struct {
+	From                string    `json:"from"` // remote address of the lost connections
+	To                  string    `json:"to"`
+	DetectedAt          time.Time `json:"detectedAt"`  // first worker noticing its connection was lost
+	CompletedAt         time.Time `json:"completedAt"` // last worker reconnected to the new endpoint
+	DurationSec         float64   `json:"durationSec"`
+	Workers             int       `json:"workers"`
+	FailedOperations    int       `json:"failedOperations"` // operations failed between the detection and the completion
+	MeanLatencyBeforeUs float64   `json:"meanLatencyBeforeUs"`
+	MeanLatencyAfterUs  float64   `json:"meanLatencyAfterUs"`
+}
+
+// failoverOptions are the flags of the insert and query benchmarks connecting the workers to standby endpoints once the primary fails
+type failoverOptions struct {
+	standbys string
+	timeout  time.Duration
+}
+
+func (o *failoverOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.standbys, "db-standby", "", "Comma separated host:port of standby endpoints the workers fail over to once their connection to -db is lost, e.g. replica1:5432,replica2:5432.\n"+
+		"Workers connect to the first endpoint accepting connections, for mobilitydbc only to one accepting writes unless -db sets target_session_attrs.\nThe failovers and their latency impact are written to the summary file")
+	fs.DurationVar(&o.timeout, "failover-timeout", time.Minute, "Time a worker keeps trying the endpoints after losing its connection before its operations fail")
+}
+
+// latencyBucket aggregates the operations ending within one second
+type latencyBucket struct {
+	durationUs int64
+	succeeded  int
+	failed     int
+}
+
+// FailoverTracker records the endpoints the workers reconnect to and the latency of their operations.
+// All methods are no-ops on a nil FailoverTracker.
+type FailoverTracker struct {
+	mu        sync.Mutex
+	endpoint  string // endpoint the workers currently fail over to
+	failovers []FailoverReport
+	buckets   map[int64]*latencyBucket // by second of the monotonic clock, see monotonicSecond
+}
+
+var failoverTracker *FailoverTracker
+
+// mustLoad returns the connection string of the workers trying the standbys after -db, and sets up the tracker.
+// Without standbys the connection string is returned unchanged.
+func (o *failoverOptions) mustLoad(connString string, dbTarget targets.DBTarget) string {
+	if o.standbys == "" {
+		return connString
+	}
+	u, err := url.Parse(connString)
+	if err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") || u.Host == "" || strings.Contains(u.Host, ",") {
+		logger.Error("Invalid CLI argument", "argument", "db-standby", "error", "-db-standby requires a URL connection string with a single host, e.g. postgresql://user@primary:5432/db")
+		os.Exit(exitConfig)
+	}
+	hosts := []string{u.Host}
+	for _, standby := range strings.Split(o.standbys, ",") {
+		standby = strings.TrimSpace(standby)
+		if standby == "" || strings.ContainsAny(standby, "/@?") {
+			logger.Error("Invalid CLI argument", "argument", "db-standby", "error", "expected comma separated host:port, got "+o.standbys)
+			os.Exit(exitConfig)
+		}
+		hosts = append(hosts, standby)
+	}
+	query := u.Query()
+	// a host accepting TCP connections but not answering must not use up the whole -failover-timeout
+	if !query.Has("connect_timeout") {
+		query.Set("connect_timeout", "5")
+	}
+	// a Postgres standby accepts connections before it is promoted
+	if dbTarget == targets.MobilityDB && !query.Has("target_session_attrs") {
+		query.Set("target_session_attrs", "read-write")
+	}
+	u.RawQuery = query.Encode()
+	// net/url can't represent multiple hosts, pgx parses them from the comma separated host list
+	const placeholder = "failover-hosts"
+	u.Host = placeholder
+	multiHost := strings.Replace(u.String(), placeholder, strings.Join(hosts, ","), 1)
+
+	reconnectTimeout = max(reconnectTimeout, o.timeout)
+	failoverTracker = &FailoverTracker{buckets: make(map[int64]*latencyBucket)}
+	logger.Info("Workers fail over to the standby endpoints", "endpoints", hosts, "failoverTimeout", o.timeout)
+	return multiHost
+}
+
+// connEndpoint returns the remote address of the connection, also after it was closed
+func connEndpoint(conn *pgx.Conn) string {
+	if netConn := conn.PgConn().Conn(); netConn != nil {
+		return netConn.RemoteAddr().String()
+	}
+	return ""
+}
+
+// Connected records the endpoint of a worker's first connection
+func (t *FailoverTracker) Connected(conn *pgx.Conn) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.endpoint == "" {
+		t.endpoint = connEndpoint(conn)
+	}
+}
+
+// Reconnected records a worker that lost its connection to from at detectedAt and reconnected to the endpoint of conn.
+// The first worker reaching another endpoint starts a failover, the others following it join the failover.
+func (t *FailoverTracker) Reconnected(id int, from string, detectedAt time.Time, conn *pgx.Conn) {
+	if t == nil {
+		return
+	}
+	to := connEndpoint(conn)
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if to == from {
+		return
+	}
+	if n := len(t.failovers); to == t.endpoint && n > 0 {
+		failover := &t.failovers[n-1]
+		failover.Workers++
+		failover.DetectedAt = minTime(failover.DetectedAt, detectedAt)
+		failover.CompletedAt = now
+		failover.DurationSec = failover.CompletedAt.Sub(failover.DetectedAt).Seconds()
+		return
+	}
+	t.endpoint = to
+	t.failovers = append(t.failovers, FailoverReport{From: from, To: to, DetectedAt: detectedAt, CompletedAt: now, DurationSec: now.Sub(detectedAt).Seconds(), Workers: 1})
+	logger.Warn("Workers failing over to another endpoint", "worker", id, "from", from, "to", to, "durationSec", now.Sub(detectedAt).Seconds())
+}
+
+// Observe records the outcome of an operation
+func (t *FailoverTracker) Observe(endTime time.Time, duration time.Duration, succeeded bool) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	bucket := t.buckets[monotonicSecond(endTime)]
+	if bucket == nil {
+		bucket = &latencyBucket{}
+		t.buckets[monotonicSecond(endTime)] = bucket
+	}
+	if succeeded {
+		bucket.durationUs += duration.Microseconds()
+		bucket.succeeded++
+	} else {
+		bucket.failed++
+	}
+}
+
+// aggregate returns the sum of the buckets of the operations ending from from to to, inclusive
+func (t *FailoverTracker) aggregate(from, to time.Time) latencyBucket {
+	var sum latencyBucket
+	for second := monotonicSecond(from); second <= monotonicSecond(to); second++ {
+		if bucket := t.buckets[second]; bucket != nil {
+			sum.durationUs += bucket.durationUs
+			sum.succeeded += bucket.succeeded
+			sum.failed += bucket.failed
+		}
+	}
+	return sum
+}
+
+// monotonicSecond returns the second of t since the start of the process, unaffected by adjustments of the wall clock
+func monotonicSecond(t time.Time) int64 {
+	return results.MonotonicUs(t) / int64(time.Second/time.Microsecond)
+}
+
+// Report returns the failovers with their latency impact, nil without standbys
+func (t *FailoverTracker) Report() []FailoverReport {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	reports := slices.Clone(t.failovers)
+	for i := range reports {
+		r := &reports[i]
+		r.FailedOperations = t.aggregate(r.DetectedAt, r.CompletedAt).failed
+		if before := t.aggregate(r.DetectedAt.Add(-failoverLatencyWindow), r.DetectedAt.Add(-time.Second)); before.succeeded > 0 {
+			r.MeanLatencyBeforeUs = float64(before.durationUs) / float64(before.succeeded)
+		}
+		if after := t.aggregate(r.CompletedAt.Add(time.Second), r.CompletedAt.Add(failoverLatencyWindow)); after.succeeded > 0 {
+			r.MeanLatencyAfterUs = float64(after.durationUs) / float64(after.succeeded)
+		}
+		logger.Info("Failover", "from", r.From, "to", r.To, "durationSec", r.DurationSec, "workers", r.Workers,
+			"failedOperations", r.FailedOperations, "meanLatencyBeforeUs", r.MeanLatencyBeforeUs, "meanLatencyAfterUs", r.MeanLatencyAfterUs)
+	}
+	return reports
+}
+
+func minTime(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
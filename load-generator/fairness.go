@@ -0,0 +1,131 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// unfairThroughputCV is the coefficient of variation of the operations per worker above which the run summary warns,
+// e.g. when the connections of a few workers are pinned to one CrateDB node answering faster than the others
+const unfairThroughputCV = 0.25
+
+// FairnessReport compares the workers of a run, a high coefficient of variation (standard deviation / mean)
+// means a few workers did most of the work or saw different latencies, biasing the results
+type FairnessReport struct {
+	Workers       int            `json:"workers"`       // all workers, including those without any operation
+	ThroughputCV  float64        `json:"throughputCv"`  // of the operations per worker, over the same duration
+	LatencyCV     float64        `json:"latencyCv"`     // of the mean latency of the successful operations per worker
+	MaxShare      float64        `json:"maxShare"`      // fraction of all operations done by the busiest worker
+	MinOperations int            `json:"minOperations"` // of the least busy worker
+	MaxOperations int            `json:"maxOperations"` // of the busiest worker
+	PerWorker     []WorkerReport `json:"perWorker"`
+}
+
+type WorkerReport struct {
+	WorkerID      int     `json:"workerId"`
+	Operations    int     `json:"operations"` // inserted events for inserts, queries for queries
+	Failures      int     `json:"failures"`
+	MeanLatencyUs float64 `json:"meanLatencyUs"`
+}
+
+// WorkerFairness aggregates the operations and latency per worker of insert and query.
+// All methods are no-ops on a nil WorkerFairness.
+type WorkerFairness struct {
+	mu         sync.Mutex
+	operations []int
+	failures   []int
+	succeeded  []int
+	latencyUs  []int64 // sum of the latencies of the successful operations
+}
+
+var workerFairness *WorkerFairness
+
+// NewWorkerFairness tracks the workers with the IDs 1 to numWorkers
+func NewWorkerFairness(numWorkers int) *WorkerFairness {
+	return &WorkerFairness{
+		operations: make([]int, numWorkers),
+		failures:   make([]int, numWorkers),
+		succeeded:  make([]int, numWorkers),
+		latencyUs:  make([]int64, numWorkers),
+	}
+}
+
+// Observe adds an operation of the worker doing the number of operations, e.g. the events of a batch
+func (f *WorkerFairness) Observe(workerID int, operations int, duration time.Duration, succeeded bool) {
+	if f == nil || workerID < 1 || workerID > len(f.operations) {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	i := workerID - 1
+	f.operations[i] += operations
+	if succeeded {
+		f.succeeded[i]++
+		f.latencyUs[i] += duration.Microseconds()
+	} else {
+		f.failures[i]++
+	}
+}
+
+// Report compares the workers, nil without any finished operation. Workers without any operation are included,
+// so starved workers raise the coefficient of variation of the throughput.
+func (f *WorkerFairness) Report() *FairnessReport {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r := &FairnessReport{}
+	var operations, latencies []float64
+	total, finished := 0, 0
+	for i := range f.operations {
+		finished += f.succeeded[i] + f.failures[i]
+		w := WorkerReport{WorkerID: i + 1, Operations: f.operations[i], Failures: f.failures[i]}
+		if f.succeeded[i] > 0 {
+			w.MeanLatencyUs = float64(f.latencyUs[i]) / float64(f.succeeded[i])
+			latencies = append(latencies, w.MeanLatencyUs)
+		}
+		if len(r.PerWorker) == 0 || w.Operations < r.MinOperations {
+			r.MinOperations = w.Operations
+		}
+		r.MaxOperations = max(r.MaxOperations, w.Operations)
+		total += w.Operations
+		operations = append(operations, float64(w.Operations))
+		r.PerWorker = append(r.PerWorker, w)
+	}
+	if finished == 0 {
+		return nil
+	}
+	r.Workers = len(r.PerWorker)
+	r.ThroughputCV = coefficientOfVariation(operations)
+	r.LatencyCV = coefficientOfVariation(latencies)
+	if total > 0 {
+		r.MaxShare = float64(r.MaxOperations) / float64(total)
+	}
+	if r.ThroughputCV > unfairThroughputCV {
+		logger.Warn("Workers did uneven shares of the operations, the results may be biased towards the busiest ones",
+			"throughputCv", r.ThroughputCV, "latencyCv", r.LatencyCV, "minOperations", r.MinOperations, "maxOperations", r.MaxOperations)
+	}
+	return r
+}
+
+// coefficientOfVariation returns the population standard deviation divided by the mean, 0 for fewer than two values or a zero mean
+func coefficientOfVariation(values []float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	if mean == 0 {
+		return 0
+	}
+	var squares float64
+	for _, v := range values {
+		squares += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(squares/float64(len(values))) / mean
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCoefficientOfVariation(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		want   float64
+	}{
+		{"no values", nil, 0},
+		{"one value", []float64{5}, 0},
+		{"equal values", []float64{3, 3, 3}, 0},
+		{"zero mean", []float64{0, 0}, 0},
+		// mean 5, population standard deviation 2
+		{"spread", []float64{2, 4, 4, 4, 5, 5, 7, 9}, 0.4},
+		{"one of two starved", []float64{10, 0}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := coefficientOfVariation(tt.values); math.Abs(got-tt.want) > 1e-12 {
+				t.Errorf("coefficientOfVariation(%v) = %g, want %g", tt.values, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorkerFairnessStarvedWorker(t *testing.T) {
+	logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	f := NewWorkerFairness(4)
+	for id := 1; id <= 3; id++ {
+		f.Observe(id, 100, time.Millisecond, true)
+	}
+	// worker 4 never got a connection
+	r := f.Report()
+	if r == nil {
+		t.Fatal("Report = nil")
+	}
+	if r.Workers != 4 || len(r.PerWorker) != 4 || r.MinOperations != 0 || r.MaxOperations != 100 {
+		t.Errorf("report of %d workers with %d-%d operations, want 4 with 0-100", r.Workers, r.MinOperations, r.MaxOperations)
+	}
+	// mean 75, standard deviation 43.3
+	if want := math.Sqrt(3) / 3; math.Abs(r.ThroughputCV-want) > 1e-12 || r.ThroughputCV <= unfairThroughputCV {
+		t.Errorf("ThroughputCV = %g, want %g", r.ThroughputCV, want)
+	}
+	if r.LatencyCV != 0 || r.MaxShare != 1.0/3 {
+		t.Errorf("LatencyCV %g and MaxShare %g, want 0 and 1/3", r.LatencyCV, r.MaxShare)
+	}
+}
+
+func TestWorkerFairnessNoOperations(t *testing.T) {
+	if r := NewWorkerFairness(2).Report(); r != nil {
+		t.Errorf("Report without operations = %+v, want nil", r)
+	}
+	var f *WorkerFairness
+	f.Observe(1, 1, time.Millisecond, true)
+	if r := f.Report(); r != nil {
+		t.Errorf("Report of a nil WorkerFairness = %+v, want nil", r)
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"load-generator/internal/benchmark"
+	"load-generator/internal/fleet"
+	"load-generator/internal/grpc"
+	"load-generator/internal/results"
+	"load-generator/internal/workload"
+)
+
+func runFleetGateway(args []string) {
+	fs := newFlagSet("fleet-gateway", "Serve the FleetGateway gRPC API of a simulated fleet backend the scooters stream their trip events to,\nand insert the events in batches with concurrent workers. Start it before fleet-clients, which simulates the scooters.\nThe results CSV contains the insert latency of every batch like mqtt-ingest and the end-to-end latency of its events\nfrom being sent by a scooter until their batch was inserted.")
+	var common commonOptions
+	common.register(fs)
+	var opts benchmarkOptions
+	opts.register(fs)
+	listen := fs.String("listen", ":50051", "Address the gRPC API listens on")
+	batchSize := fs.Int("batch-size", 500, "Insert at most <N> trip events per batch")
+	linger := fs.Duration("linger", 100*time.Millisecond, "Insert a batch once its first event waited this long, even if it isn't full")
+	useBulkInsert := fs.Bool("bulk-insert", false, "Insert rows using UNNEST, one query with many inserts")
+	idleTimeout := fs.Duration("idle-timeout", 30*time.Second, "End the run once no event arrived for this long after the first one, 0 runs until interrupted or -max-duration")
+	fs.Parse(args)
+
+	ctx, stop := signalContext()
+	defer stop()
+	common.setup("fleet-gateway", opts.numWorkers)
+	defer common.close()
+	ctx, cancel := opts.withMaxDuration(ctx)
+	defer cancel()
+	dbTarget := common.dbTarget
+
+	if len(opts.targets) > 0 || common.dryRun {
+		logger.Error("Invalid CLI argument", "argument", "targets", "error", "fleet-gateway supports neither -targets nor -dry-run, check the insert statements with insert -dry-run")
+		os.Exit(exitConfig)
+	}
+	if *batchSize < 1 {
+		logger.Error("Invalid CLI argument", "argument", "batch-size", "error", "expected a positive batch size")
+		os.Exit(exitConfig)
+	}
+
+	logger.Info("Starting load-generator with following cli arguments",
+		"mode", "fleet-gateway",
+		"db", dbTarget.String(),
+		"nworkers", opts.numWorkers,
+		"listen", *listen,
+		"batchSize", *batchSize,
+		"linger", *linger,
+		"useBulkInsert", *useBulkInsert,
+		"idleTimeout", *idleTimeout,
+	)
+
+	run := startBenchmarkRun(ctx, "fleet-gateway", &common, &opts, nil, nil)
+	csvFile := createArtifactCSV("results", "fleet-gateway", dbTarget.String(), workersPart(opts.numWorkers), fmt.Sprintf("%db", *batchSize), insertMethodPart(*useBulkInsert))
+	csvWriter := results.NewCSVWriter(csvFile, opts.flushInterval, opts.flushRecords)
+
+	serve := func(context.Context) (ingestSource, error) {
+		return listenFleetGateway(*listen)
+	}
+	ingest := ingestConfig{
+		mode:          "fleet-gateway",
+		jobType:       "gateway_ingest",
+		connString:    opts.workerConnString(common.connString),
+		numWorkers:    opts.numWorkers,
+		drainTimeout:  opts.drainTimeout,
+		batchSize:     *batchSize,
+		linger:        *linger,
+		idleTimeout:   *idleTimeout,
+		useBulkInsert: *useBulkInsert,
+		dbTarget:      dbTarget,
+	}
+	summary, err := ingest.run(run.ctx, serve, csvWriter)
+	run.finish(summary, func() { closeResultsCSV(csvWriter, opts.sortResults) })
+	if err != nil {
+		logger.Error("Fleet gateway failed", "error", err)
+		os.Exit(exitCode(err))
+	}
+	if summary.Aborted {
+		os.Exit(exitAborted)
+	}
+}
+
+// fleetGateway serves the gRPC API and hands the events of all streams to the ingest run
+type fleetGateway struct {
+	server   *http.Server
+	events   chan ingestMessage
+	serveErr chan error
+	closed   chan struct{}
+}
+
+func listenFleetGateway(addr string) (*fleetGateway, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("Listening for the fleet gateway API: %w", err)
+	}
+	g := &fleetGateway{events: make(chan ingestMessage), serveErr: make(chan error, 1), closed: make(chan struct{})}
+	g.server = grpc.NewHTTPServer(addr, fleet.NewHandler(g))
+	go func() {
+		if err := g.server.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+			g.serveErr <- err
+		}
+	}()
+	logger.Info("Fleet gateway listening for trip event streams", "address", ln.Addr().String())
+	return g, nil
+}
+
+// StreamEvents accepts the events of a scooter's stream, the stream is aborted once the run ends
+func (g *fleetGateway) StreamEvents(ctx context.Context, recv func() (fleet.TripEvent, error)) (fleet.StreamSummary, error) {
+	var summary fleet.StreamSummary
+	for {
+		event, err := recv()
+		if err == io.EOF {
+			return summary, nil
+		} else if err != nil {
+			return summary, err
+		}
+		if event.EventID == "" || event.TripID == "" {
+			return summary, grpc.Errorf(grpc.CodeInvalidArgument, "trip event %d of the stream without event_id or trip_id", summary.Accepted+1)
+		}
+		select {
+		case g.events <- ingestMessage{event: event.TripEvent, publishedAt: event.SentAt}:
+			summary.Accepted++
+		case <-ctx.Done():
+			return summary, ctx.Err()
+		case <-g.closed:
+			return summary, grpc.Errorf(grpc.CodeUnavailable, "the run of the gateway ended")
+		}
+	}
+}
+
+func (g *fleetGateway) receive(ctx context.Context, messages chan<- ingestMessage) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-g.serveErr:
+			return fmt.Errorf("Serving the fleet gateway API: %w", err)
+		case msg := <-g.events:
+			select {
+			case messages <- msg:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
+
+// Close ends the open streams and stops the server
+func (g *fleetGateway) Close() error {
+	close(g.closed)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := g.server.Shutdown(ctx); err != nil {
+		return g.server.Close()
+	}
+	return nil
+}
+
+func runFleetClients(args []string) {
+	fs := newFlagSet("fleet-clients", "Simulate the scooters of a fleet streaming their trip events to fleet-gateway, one gRPC stream per scooter.\nThe events of a trip are sent in order by the same scooter, the scooters share the target rate.")
+	gateway := fs.String("gateway", "localhost:50051", "Address host:port of the fleet gateway")
+	tripsPath := fs.String("trips", "../escooter-trips-generator/output/escooter-trips-small.csv", "Path or https:// or s3:// URL of a CSV file containing the escooter trip events")
+	numClients := fs.Int("clients", 100, "Number of scooters streaming concurrently")
+	rate := fs.Float64("rate", 1000, "Send at most <rate> trip events per second in total, 0 sends as fast as possible")
+	maxEvents := fs.Int("max-events", 0, "Stop after <N> trip events, 0 sends the whole file")
+	fs.Parse(args)
+
+	runID = envOrDefault(runIDEnv, newUUID())
+	logger = slog.New(slog.NewJSONHandler(os.Stdout, nil)).With("runId", runID)
+
+	if *numClients < 1 {
+		logger.Error("Invalid CLI argument", "argument", "clients", "error", "expected at least one client")
+		os.Exit(exitConfig)
+	}
+	ctx, stop := signalContext()
+	defer stop()
+
+	r, err := workload.OpenTripEvents(*tripsPath)
+	if err != nil {
+		logger.Error("Unable to open trip events", "error", err)
+		os.Exit(exitConfig)
+	}
+	defer r.Close()
+	client := fleet.NewClient(*gateway)
+	logger.Info("Streaming trip events", "gateway", *gateway, "trips", *tripsPath, "clients", *numClients, "rate", *rate)
+
+	// a scooter's stream ends with the run, failed streams end the scooter
+	streamCtx, cancelStreams := context.WithCancel(context.Background())
+	defer cancelStreams()
+	var mu sync.Mutex
+	accepted, failedStreams := 0, 0
+	var streamErr error
+	scooters := make([]chan fleet.TripEvent, *numClients)
+	var wg sync.WaitGroup
+	for i := range scooters {
+		scooters[i] = make(chan fleet.TripEvent, 100)
+		wg.Add(1)
+		go func(id int, events <-chan fleet.TripEvent) {
+			defer wg.Done()
+			stream := client.StreamEvents(streamCtx)
+			var err error
+			for event := range events {
+				if err == nil {
+					event.SentAt = time.Now()
+					err = stream.Send(event)
+				}
+			}
+			summary, closeErr := stream.CloseAndRecv()
+			err = cmp.Or(err, closeErr)
+			mu.Lock()
+			defer mu.Unlock()
+			accepted += summary.Accepted
+			if err != nil {
+				failedStreams++
+				streamErr = err
+				logger.Warn("Stream of scooter failed", "client", id, "error", err)
+			}
+		}(i+1, scooters[i])
+	}
+
+	startTime := time.Now()
+	sent := 0
+	for ctx.Err() == nil && (*maxEvents == 0 || sent < *maxEvents) {
+		event, err := r.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			logger.Error("Unable to read trip events", "error", err)
+			os.Exit(exitConfig)
+		}
+		if !benchmark.WaitForRate(ctx, startTime, sent, *rate) {
+			break
+		}
+		h := fnv.New32a()
+		h.Write([]byte(event.TripID))
+		select {
+		case scooters[h.Sum32()%uint32(*numClients)] <- fleet.TripEvent{TripEvent: event}:
+			sent++
+			if sent%100000 == 0 {
+				logger.Info("Stream progress", "sent", sent, "timeElapsedInSec", time.Since(startTime).Seconds())
+			}
+		case <-ctx.Done():
+		}
+	}
+	if ctx.Err() != nil {
+		cancelStreams()
+	}
+	for _, events := range scooters {
+		close(events)
+	}
+	wg.Wait()
+
+	duration := time.Since(startTime)
+	logger.Info("Streamed trip events", "sent", sent, "accepted", accepted, "failedStreams", failedStreams,
+		"durationSec", duration.Seconds(), "eventsPerSec", float64(sent)/duration.Seconds(), "interrupted", ctx.Err() != nil)
+	switch {
+	case ctx.Err() != nil:
+		os.Exit(exitAborted)
+	case grpc.Code(streamErr) == grpc.CodeUnavailable:
+		os.Exit(exitConnection)
+	case streamErr != nil:
+		os.Exit(exitFailure)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"load-generator/internal/osm"
+	"load-generator/internal/workload"
+)
+
+func runGenerateDataset(args []string) {
+	fs := newFlagSet("generate-dataset", "Generate synthetic POIs, localities and e-scooter trips in the formats init, insert and query read,\nfor quick experiments without the escooter-trips-generator.")
+	outDir := fs.String("out-dir", "./dataset", "Directory to write <name>-pois.csv, <name>-localities.geojson and <name>-trips.csv to, existing files are not overwritten")
+	name := fs.String("name", "synthetic", "Prefix of the generated file names")
+	seed := fs.Int64("seed", 42, "Random seed, the same seed and flags generate the identical dataset")
+	bboxStr := fs.String("bbox", "13.09,52.34,13.76,52.68", "Bounding box minLon,minLat,maxLon,maxLat all POIs, localities and trips lie in, defaults to Berlin")
+	numPOIs := fs.Int("pois", 500, "Number of POIs")
+	localityGrid := fs.Int("locality-grid", 4, "Split the bounding box into <N> x <N> rectangular localities")
+	numTrips := fs.Int("trips", 1000, "Number of trips")
+	startStr := fs.String("start", "2024-06-01T00:00:00Z", "Earliest trip start, RFC3339")
+	span := fs.Duration("span", 24*time.Hour, "Trips start uniformly distributed within -start and -start plus <span>")
+	distribution := fs.String("duration-distribution", "lognormal", "Distribution of the trip durations: normal, lognormal or uniform")
+	durationMean := fs.Duration("duration-mean", 12*time.Minute, "Mean trip duration")
+	durationStdDev := fs.Duration("duration-stddev", 6*time.Minute, "Standard deviation of the trip durations")
+	sampleInterval := fs.Duration("sample-interval", 10*time.Second, "Time between two events of a trip")
+	speed := fs.Float64("speed", 5, "Mean speed of the e-scooters in metres per second")
+	streetsFile := fs.String("streets", "", "OSM PBF extract whose street network the trips follow, instead of moving freely.\nThe bounding box defaults to the one of the streets unless -bbox is given")
+	highways := fs.String("highways", "primary,secondary,tertiary,unclassified,residential,living_street,service,cycleway", "Comma separated highway tag values of the ways trips are routed on")
+	noise := fs.Float64("gps-noise", 0, "Standard deviation in metres of the Gaussian noise added to the reported positions")
+	sampleJitter := fs.Float64("sample-jitter", 0, "Vary each sample interval uniformly by up to this fraction, e.g. 0.3 for 7s to 13s at -sample-interval 10s")
+	gapProbability := fs.Float64("gap-probability", 0, "Probability of a GPS drop-out starting at an event, during which a trip reports no events")
+	gapMean := fs.Duration("gap-mean", time.Minute, "Mean duration of a drop-out, exponentially distributed")
+	extendedAttributes := fs.Bool("extended-attributes", false, "Add the columns battery_level, speed_kmh and rider_hash to the trips, inserted with -event-attributes into the wide schema variant")
+	city := fs.String("city", "", "Profile of a city (berlin, munich, hamburg, cologne or vienna) whose bounding box, locality grid\nand fleet size, as number of trips, replace the defaults of -bbox, -locality-grid, -trips and -name")
+	fs.Parse(args)
+
+	logger = slog.New(slog.NewJSONHandler(os.Stderr, nil))
+
+	given := explicitFlags(fs)
+	if *city != "" {
+		profile, err := workload.LookupCity(*city)
+		if err != nil {
+			logger.Error("Invalid CLI argument", "argument", "city", "error", err)
+			os.Exit(exitConfig)
+		}
+		if !given["bbox"] {
+			b := profile.BBox
+			*bboxStr = fmt.Sprintf("%g,%g,%g,%g", b.MinLon, b.MinLat, b.MaxLon, b.MaxLat)
+			given["bbox"] = true
+		}
+		if !given["locality-grid"] {
+			*localityGrid = profile.LocalityGrid
+		}
+		if !given["trips"] {
+			*numTrips = profile.FleetSize
+		}
+		if !given["name"] {
+			*name = profile.Name
+		}
+		logger.Info("Using city profile", "city", profile.Name, "bbox", *bboxStr, "localityGrid", *localityGrid, "trips", *numTrips)
+	}
+
+	bbox, err := workload.ParseBBox(*bboxStr)
+	if err != nil {
+		logger.Error("Invalid CLI argument", "argument", "bbox", "error", err)
+		os.Exit(exitConfig)
+	}
+	var streets *workload.StreetGraph
+	if *streetsFile != "" {
+		var stats osm.StreetStats
+		streets, stats, err = osm.LoadStreets(*streetsFile, strings.Split(*highways, ","))
+		if err != nil {
+			logger.Error("Unable to load the street network", "filename", *streetsFile, "error", err)
+			os.Exit(exitConfig)
+		}
+		logger.Info("Loaded street network", "filename", *streetsFile, "ways", stats.Ways, "segments", stats.Segments,
+			"nodes", stats.Nodes, "missingNodes", stats.MissingNodes)
+		if !given["bbox"] {
+			bbox = streets.BBox()
+		}
+	}
+	start, err := time.Parse(time.RFC3339, *startStr)
+	if err != nil {
+		logger.Error("Invalid CLI argument", "argument", "start", "error", err)
+		os.Exit(exitConfig)
+	}
+	generator, err := workload.NewSyntheticGenerator(workload.SyntheticConfig{
+		Seed:                 *seed,
+		BBox:                 bbox,
+		NumPOIs:              *numPOIs,
+		LocalityGrid:         *localityGrid,
+		NumTrips:             *numTrips,
+		Start:                start,
+		Span:                 *span,
+		DurationDistribution: *distribution,
+		DurationMean:         *durationMean,
+		DurationStdDev:       *durationStdDev,
+		SampleInterval:       *sampleInterval,
+		SpeedMs:              *speed,
+		Streets:              streets,
+		NoiseMetres:          *noise,
+		SampleJitter:         *sampleJitter,
+		GapProbability:       *gapProbability,
+		GapMean:              *gapMean,
+		ExtendedAttributes:   *extendedAttributes,
+	})
+	if err != nil {
+		logger.Error("Invalid dataset configuration", "error", err)
+		os.Exit(exitConfig)
+	}
+
+	pois := generator.POIs()
+	poisFile := path.Join(*outDir, *name+"-pois.csv")
+	writeDatasetFile(poisFile, func(f *os.File) error { return workload.WritePOIsCSV(f, pois) })
+	logger.Info("Generated POIs", "filename", poisFile, "count", len(pois))
+
+	localities := generator.Localities()
+	localitiesFile := path.Join(*outDir, *name+"-localities.geojson")
+	writeDatasetFile(localitiesFile, func(f *os.File) error { return workload.WriteLocalitiesGeoJSON(f, localities) })
+	logger.Info("Generated localities", "filename", localitiesFile, "count", len(localities))
+
+	var trips, events int
+	tripsFile := path.Join(*outDir, *name+"-trips.csv")
+	writeDatasetFile(tripsFile, func(f *os.File) error {
+		trips, events, err = generator.WriteTrips(f)
+		return err
+	})
+	logger.Info("Generated trips", "filename", tripsFile, "trips", trips, "events", events)
+}
+
+// writeDatasetFile creates filename without overwriting an existing file and writes it with write
+func writeDatasetFile(filename string, write func(f *os.File) error) {
+	f, err := createNewFile(filename)
+	if err != nil {
+		logger.Error("Unable to create dataset file", "filename", filename, "error", err)
+		os.Exit(exitConfig)
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		logger.Error("Unable to write dataset file", "filename", filename, "error", err)
+		os.Exit(exitFailure)
+	}
+	if err := f.Close(); err != nil {
+		logger.Error("Unable to write dataset file", "filename", filename, "error", err)
+		os.Exit(exitFailure)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"os"
+	"strconv"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"load-generator/internal/results"
+	"load-generator/internal/targets"
+	"load-generator/internal/workload"
+)
+
+var geofenceCSVHeader = []string{"runId", "templateName", "localityId", "windowStart", "windowEnd", "startTime", "endTime", "queryDurationUs", "startMonotonicUs", "successful", "resultingRowsCount", "errorMsg"}
+
+// startGeofenceQueries executes the geofence query templates on a dedicated connection every interval while the inserts run,
+// over the window of the events inserted since the previous round, up to the latest timestamp of the table.
+// Every round queries the next locality of the localities table. Entries and exits whose previous event of the trip
+// lies in an earlier window are not detected. The latency and the number of trips found are written to the geofence file.
+// Returned function stops the queries and closes the file.
+func startGeofenceQueries(ctx context.Context, interval time.Duration, queriesFilepath string, connString string, dbTarget targets.DBTarget, numWorkers int) func() {
+	if interval <= 0 {
+		return func() {}
+	}
+	templates := mustLoadTemplates(queriesFilepath)
+
+	conn, err := pgx.Connect(ctx, connString)
+	if err != nil {
+		logger.Error("Geofence queries were unable to connect to database", "error", err)
+		os.Exit(exitConnection)
+	}
+
+	// like the canaries, the geofence queries of CrateDB's tenants read the tables of tenant 1
+	tenant := 0
+	if tenancy != nil {
+		tenant = 1
+	}
+	localityIDs, err := queryLocalityIDs(ctx, conn, tenancy.PrefixTables(tenant, `SELECT locality_id FROM localities ORDER BY locality_id`))
+	if err != nil || len(localityIDs) == 0 {
+		logger.Error("Geofence queries were unable to read the localities, init has to insert them", "error", err)
+		os.Exit(exitConfig)
+	}
+
+	file := createArtifactCSV("geofence", "insert", dbTarget.String(), workersPart(numWorkers))
+	csvWriter := csv.NewWriter(file)
+	if err := csvWriter.Write(geofenceCSVHeader); err != nil {
+		logger.Error("Failed to write geofence CSV header", "error", err)
+		os.Exit(exitFailure)
+	}
+	g := &geofenceRunner{conn: conn, templates: templates, localityIDs: localityIDs, tenant: tenant, csvWriter: csvWriter}
+
+	geofenceCtx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-geofenceCtx.Done():
+				return
+			case <-ticker.C:
+				g.round(geofenceCtx)
+			}
+		}
+	}()
+	logger.Info("Executing geofence queries during the inserts", "interval", interval, "queries", queriesFilepath, "localities", len(localityIDs))
+
+	return func() {
+		cancel()
+		wg.Wait()
+		csvWriter.Flush()
+		file.Close()
+		conn.Close(context.Background())
+	}
+}
+
+type geofenceRunner struct {
+	conn        *pgx.Conn
+	templates   *template.Template
+	localityIDs []string
+	tenant      int
+	csvWriter   *csv.Writer
+
+	rounds    int
+	watermark time.Time // latest timestamp of the events at the previous round, the start of the next window
+}
+
+// round executes every geofence template once for the next locality, over the events inserted since the previous round
+func (g *geofenceRunner) round(ctx context.Context) {
+	var latest *time.Time
+	if err := g.conn.QueryRow(ctx, g.prefix(`SELECT max(timestamp) FROM escooter_events`)).Scan(&latest); err != nil {
+		if ctx.Err() == nil {
+			logger.Warn("Geofence queries were unable to read the latest timestamp", "error", err)
+		}
+		return
+	}
+	// nothing inserted since the previous round, the first round only sets the start of the window
+	if latest == nil || !latest.After(g.watermark) {
+		return
+	}
+	windowStart := g.watermark
+	g.watermark = *latest
+	if windowStart.IsZero() {
+		return
+	}
+
+	fields := workload.QueryFields{
+		LocalityId:  g.localityIDs[g.rounds%len(g.localityIDs)],
+		WindowStart: workload.FormatTimestamp(windowStart),
+		WindowEnd:   workload.FormatTimestamp(*latest),
+	}
+	g.rounds++
+	for _, name := range workload.TemplateNames(g.templates) {
+		var sql bytes.Buffer
+		if err := g.templates.ExecuteTemplate(&sql, name, targets.EscapeQueryFields(fields)); err != nil {
+			logger.Error("Failed to render geofence query", "template", name, "error", err)
+			continue
+		}
+		startTime := time.Now()
+		rowsCount, err := g.execute(ctx, g.prefix(sql.String()))
+		endTime := time.Now()
+		if ctx.Err() != nil {
+			return
+		}
+		var errorMsg string
+		if err != nil {
+			errorMsg = err.Error()
+			logger.Warn("Geofence query failed", "template", name, "localityId", fields.LocalityId, "error", err)
+		}
+		record := []string{
+			runID,
+			name,
+			fields.LocalityId,
+			fields.WindowStart,
+			fields.WindowEnd,
+			startTime.Format(time.RFC3339Nano),
+			endTime.Format(time.RFC3339Nano),
+			strconv.FormatInt(endTime.Sub(startTime).Microseconds(), 10),
+			strconv.FormatInt(results.MonotonicUs(startTime), 10),
+			strconv.FormatBool(err == nil),
+			strconv.Itoa(rowsCount),
+			errorMsg,
+		}
+		if err := g.csvWriter.Write(record); err != nil {
+			logger.Error("Failed to write geofence CSV record", "error", err)
+		}
+		statsd.Timing("insert.geofence."+sanitizeStatsdName(name), endTime.Sub(startTime))
+	}
+	g.csvWriter.Flush()
+	logger.Debug("Executed geofence queries", "localityId", fields.LocalityId, "windowStart", fields.WindowStart, "windowEnd", fields.WindowEnd)
+}
+
+func (g *geofenceRunner) prefix(sql string) string {
+	return tenancy.PrefixTables(g.tenant, sql)
+}
+
+// execute consumes the rows of the query, returning their number
+func (g *geofenceRunner) execute(ctx context.Context, sql string) (int, error) {
+	rows, err := g.conn.Query(ctx, sql)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	rowsCount := 0
+	for rows.Next() {
+		rowsCount++
+	}
+	return rowsCount, rows.Err()
+}
+
+func queryLocalityIDs(ctx context.Context, conn *pgx.Conn, sql string) ([]string, error) {
+	rows, err := conn.Query(ctx, sql)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
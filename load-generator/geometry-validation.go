@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"load-generator/internal/targets"
+	"load-generator/internal/workload"
+)
+
+// handling of localities with invalid geometries at init, set by -invalid-geometries
+const (
+	invalidGeometriesFail   = "fail"
+	invalidGeometriesSkip   = "skip"
+	invalidGeometriesRepair = "repair"
+)
+
+func parseInvalidGeometries(mode string) error {
+	switch mode {
+	case invalidGeometriesFail, invalidGeometriesSkip, invalidGeometriesRepair:
+		return nil
+	default:
+		return fmt.Errorf("Unknown handling of invalid geometries %q, expected fail, skip or repair", mode)
+	}
+}
+
+// validateLocalities checks the closing, number of positions and self-intersections of the locality rings
+// and returns the localities to insert, with their rings oriented by the right-hand rule like those of shapefiles.
+// Invalid localities are skipped or fail the init depending on mode. repair closes the rings and leaves
+// self-intersections to ST_MakeValid, which only MobilityDB supports, so self-intersecting localities are skipped on CrateDB.
+func validateLocalities(localities []workload.Locality, mode string, dbTarget targets.DBTarget) []workload.Locality {
+	valid := make([]workload.Locality, 0, len(localities))
+	skipped, repaired := 0, 0
+	for _, locality := range localities {
+		issues, err := workload.ValidateGeometry(locality.Geometry)
+		if err == nil && issues.Valid() {
+			// FixRings parses the geometry like the validation did
+			if fixed, err := workload.FixRings(locality.Geometry); err == nil {
+				locality.Geometry = fixed
+			}
+			valid = append(valid, locality)
+			continue
+		}
+
+		reason := issues.String()
+		if err != nil {
+			reason = err.Error()
+		}
+		if mode == invalidGeometriesFail {
+			logger.Error("Invalid locality geometry, use -invalid-geometries skip or repair to continue without it",
+				"localityId", locality.LocalityID, "name", locality.Name, "issues", reason)
+			os.Exit(exitValidation)
+		}
+
+		repairable := err == nil && (issues.RepairableRings() || (issues.TooFewPositions == 0 && dbTarget == targets.MobilityDB))
+		if mode == invalidGeometriesRepair && repairable {
+			fixed, err := workload.FixRings(locality.Geometry)
+			if err == nil {
+				locality.Geometry = fixed
+				valid = append(valid, locality)
+				repaired++
+				logger.Warn("Repairing invalid locality geometry", "localityId", locality.LocalityID, "name", locality.Name, "issues", reason)
+				continue
+			}
+			reason = err.Error()
+		}
+
+		skipped++
+		logger.Warn("Skipping invalid locality", "localityId", locality.LocalityID, "name", locality.Name, "issues", reason)
+	}
+
+	logger.Info("Validated locality geometries", "valid", len(valid)-repaired, "repaired", repaired, "skipped", skipped)
+	return valid
+}
+
+// simplifyLocalities simplifies the locality geometries with -simplify-tolerance before they are validated,
+// so rings made invalid by the simplification are handled like other invalid geometries.
+// Returns the simplified localities and the number of positions before and after.
+func simplifyLocalities(localities []workload.Locality, tolerance float64) ([]workload.Locality, int, int) {
+	totalBefore, totalAfter := 0, 0
+	for i, locality := range localities {
+		simplified, before, after, err := workload.SimplifyGeometry(locality.Geometry, tolerance)
+		if err != nil {
+			// left to the validation, which skips or fails on geometries it can't parse
+			logger.Warn("Unable to simplify locality geometry", "localityId", locality.LocalityID, "name", locality.Name, "error", err)
+			continue
+		}
+		localities[i].Geometry = simplified
+		totalBefore += before
+		totalAfter += after
+		logger.Debug("Simplified locality geometry", "localityId", locality.LocalityID, "name", locality.Name, "positionsBefore", before, "positionsAfter", after)
+	}
+	logger.Info("Simplified locality geometries", "tolerance", tolerance, "positionsBefore", totalBefore, "positionsAfter", totalAfter)
+	return localities, totalBefore, totalAfter
+}
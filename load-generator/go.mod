@@ -4,7 +4,10 @@ go 1.24.0
 
 toolchain go1.24.4
 
-require github.com/jackc/pgx/v5 v5.7.5
+require (
+	github.com/jackc/pgx/v5 v5.7.5
+	github.com/testcontainers/testcontainers-go v0.38.0
+)
 
 require (
 	github.com/jackc/pgpassfile v1.0.0 // indirect
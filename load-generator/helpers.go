@@ -1,17 +1,91 @@
 package main
 
-import "strings"
-
-// Fromat list of strings to be acceptable for UNNEST argument
-func joinAndQuoteStrings(list []string) string {
-	var builder strings.Builder
-	for i, s := range list {
-		if i != 0 {
-			builder.WriteRune(',')
-		}
-		builder.WriteRune('\'')
-		builder.WriteString(s)
-		builder.WriteRune('\'')
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"load-generator/internal/targets"
+)
+
+// newUUID returns a random (version 4) UUID
+func newUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic("Failed to read random bytes: " + err.Error())
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// directory all run artifacts except the log files are written to, set by -results-dir
+var resultsDir = "results"
+
+// createNewFile creates filename and its parent directories.
+// It fails instead of truncating an existing file, so concurrent runs never overwrite each other's artifacts.
+func createNewFile(filename string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0777); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+}
+
+// createArtifactCSV creates the CSV file <kind>_<parts>_<timestamp>_<run ID>.csv in the results directory and registers it
+// as artifact of the run, e.g. createArtifactCSV("storage", "insert", "cratedb", "8w"). Exits if the file can't be created.
+func createArtifactCSV(kind string, parts ...string) *os.File {
+	return createArtifact(".csv", kind, parts...)
+}
+
+// createArtifact creates the artifact file of the kind with the extension, like createArtifactCSV
+func createArtifact(ext string, kind string, parts ...string) *os.File {
+	name := strings.Join(append(append([]string{kind}, parts...), time.Now().Format("20060102_150405"), runID), "_")
+	filename := filepath.Join(resultsDir, name+ext)
+	file, err := createNewFile(filename)
+	if err != nil {
+		logger.Error("Failed to create artifact file", "kind", kind, "filename", filename, "error", err)
+		os.Exit(exitFailure)
+	}
+	registerArtifact(filename)
+	logger.Info("Created artifact file", "kind", kind, "filename", filename)
+	return file
+}
+
+// workersPart is the part of an artifact's filename with the number of workers
+func workersPart(numWorkers int) string {
+	return fmt.Sprintf("%dw", numWorkers)
+}
+
+// insertMethodPart is the part of an artifact's filename with the way the events are inserted, bulk or batch,
+// followed by -idempotent with -idempotent-inserts
+func insertMethodPart(useBulkInsert bool) string {
+	method := "batch"
+	if useBulkInsert {
+		method = "bulk"
+	}
+	if targets.IdempotentInserts() {
+		method += "-idempotent"
+	}
+	return method
+}
+
+// basenamePart is the part of an artifact's filename with the name of an input file without its extension
+func basenamePart(filename string) string {
+	return strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+}
+
+// writeNewFile writes data to a new file created with createNewFile
+func writeNewFile(filename string, data []byte) error {
+	f, err := createNewFile(filename)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
 	}
-	return builder.String()
+	return f.Close()
 }
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestCreateArtifactCSV(t *testing.T) {
+	logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	resultsDir, runID = filepath.Join(t.TempDir(), "results"), "run"
+	t.Cleanup(func() { resultsDir, runID = "results", "" })
+
+	file := createArtifactCSV("results", "insert", "cratedb", basenamePart("/data/trips-small.csv"), workersPart(8), "1000b", insertMethodPart(true))
+	defer file.Close()
+	pattern := regexp.MustCompile(`^results_insert_cratedb_trips-small_8w_1000b_bulk_\d{8}_\d{6}_run\.csv$`)
+	if name := filepath.Base(file.Name()); !pattern.MatchString(name) {
+		t.Errorf("created %s, want a name matching %s", name, pattern)
+	}
+	if filepath.Dir(file.Name()) != resultsDir {
+		t.Errorf("created %s outside of the results directory %s", file.Name(), resultsDir)
+	}
+	if artifacts := listArtifacts(); len(artifacts) == 0 || artifacts[len(artifacts)-1] != file.Name() {
+		t.Errorf("artifacts %v don't end with %s", artifacts, file.Name())
+	}
+}
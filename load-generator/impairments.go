@@ -0,0 +1,288 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"load-generator/internal/results"
+	"load-generator/internal/toxiproxy"
+)
+
+// noImpairment is the impairment column of operations started before the first phase or during a phase without toxics
+const noImpairment = "none"
+
+// ImpairmentPhase is the network impairment of the workers' connections from its offset until the next phase
+type ImpairmentPhase struct {
+	Name      string // the phase of -impairments without its offset, e.g. latency=50ms/jitter=10ms
+	At        time.Duration
+	Latency   time.Duration
+	Jitter    time.Duration
+	Bandwidth int // KB/s in each direction, 0 is unlimited
+}
+
+// ImpairmentReport describes when a phase of -impairments was applied
+type ImpairmentReport struct {
+	Name      string    `json:"name"`
+	AtSec     float64   `json:"atSec"` // configured offset from the start of the run
+	AppliedAt time.Time `json:"appliedAt"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// impairmentOptions are the flags of the insert and query benchmarks routing the workers' connections through Toxiproxy
+type impairmentOptions struct {
+	api      string
+	listen   string
+	upstream string
+	phases   string
+}
+
+func (o *impairmentOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.api, "toxiproxy", "", "URL of the API of a Toxiproxy server, e.g. http://localhost:8474, the workers then connect through a proxy it creates for the run.\nThe samplers keep connecting to -db directly")
+	fs.StringVar(&o.listen, "toxiproxy-listen", "0.0.0.0:25432", "Address the proxy listens on inside Toxiproxy, the workers connect to its port on the host of -toxiproxy")
+	fs.StringVar(&o.upstream, "toxiproxy-upstream", "", "Address host:port Toxiproxy forwards the connections to, defaults to the host and port of -db")
+	fs.StringVar(&o.phases, "impairments", "", "Network impairment phases at offsets from the start of the run, comma separated <toxics>@<offset>, e.g. latency=50ms/jitter=10ms@0s,none@2m,bandwidth=500@5m.\n"+
+		"latency is added to every round trip, jitter varies it, bandwidth limits each direction to <N> KB/s. Requires -toxiproxy.\nThe results CSV gets the column impairment with the phase active when the operation started")
+}
+
+// NetworkImpairments routes the connections of the workers through a Toxiproxy proxy and changes its toxics at the offsets of the phases.
+// All methods are no-ops on a nil NetworkImpairments.
+type NetworkImpairments struct {
+	client     *toxiproxy.Client
+	proxy      toxiproxy.Proxy
+	apiHost    string
+	listenPort string
+	phases     []ImpairmentPhase
+
+	mu      sync.Mutex
+	reports []ImpairmentReport
+	active  []ImpairmentReport // successfully applied phases in order of their application
+}
+
+var networkImpairments *NetworkImpairments
+
+// parseImpairmentPhases parses the comma separated <toxics>@<offset> list of -impairments
+func parseImpairmentPhases(s string) ([]ImpairmentPhase, error) {
+	var phases []ImpairmentPhase
+	for _, spec := range strings.Split(s, ",") {
+		spec = strings.TrimSpace(spec)
+		toxics, at, ok := strings.Cut(spec, "@")
+		if !ok {
+			return nil, fmt.Errorf("Invalid impairment phase %q, expected <toxics>@<offset>, e.g. latency=50ms@0s", spec)
+		}
+		offset, err := time.ParseDuration(at)
+		if err != nil || offset < 0 {
+			return nil, fmt.Errorf("Invalid offset of impairment phase %q, expected a positive duration, e.g. 2m", spec)
+		}
+		phase := ImpairmentPhase{Name: toxics, At: offset}
+		if toxics != noImpairment {
+			for _, toxic := range strings.Split(toxics, "/") {
+				key, value, _ := strings.Cut(toxic, "=")
+				switch key {
+				case "latency", "jitter":
+					d, err := time.ParseDuration(value)
+					if err != nil || d < 0 {
+						return nil, fmt.Errorf("Invalid %s %q of impairment phase %q, expected a duration, e.g. 50ms", key, value, spec)
+					}
+					if key == "latency" {
+						phase.Latency = d
+					} else {
+						phase.Jitter = d
+					}
+				case "bandwidth":
+					if phase.Bandwidth, err = strconv.Atoi(value); err != nil || phase.Bandwidth < 1 {
+						return nil, fmt.Errorf("Invalid bandwidth %q of impairment phase %q, expected KB/s as positive integer", value, spec)
+					}
+				default:
+					return nil, fmt.Errorf("Unknown toxic %q of impairment phase %q, expected latency, jitter, bandwidth or none", key, spec)
+				}
+			}
+		}
+		phases = append(phases, phase)
+	}
+	slices.SortStableFunc(phases, func(a, b ImpairmentPhase) int { return cmp.Compare(a.At, b.At) })
+	return phases, nil
+}
+
+// toxics returns the toxics of Toxiproxy realizing the phase
+func (p ImpairmentPhase) toxics() []toxiproxy.Toxic {
+	var toxics []toxiproxy.Toxic
+	if p.Latency > 0 || p.Jitter > 0 {
+		toxics = append(toxics, toxiproxy.Toxic{Name: "loadgen_latency", Type: "latency", Stream: "downstream", Toxicity: 1,
+			Attributes: map[string]int{"latency": int(p.Latency.Milliseconds()), "jitter": int(p.Jitter.Milliseconds())}})
+	}
+	if p.Bandwidth > 0 {
+		for _, stream := range []string{"upstream", "downstream"} {
+			toxics = append(toxics, toxiproxy.Toxic{Name: "loadgen_bandwidth_" + stream, Type: "bandwidth", Stream: stream, Toxicity: 1,
+				Attributes: map[string]int{"rate": p.Bandwidth}})
+		}
+	}
+	return toxics
+}
+
+// mustLoad validates the impairment flags, nil without -toxiproxy
+func (o *impairmentOptions) mustLoad(connString string) *NetworkImpairments {
+	if o.api == "" {
+		if o.phases != "" {
+			logger.Error("Invalid CLI argument", "argument", "impairments", "error", "-impairments requires -toxiproxy")
+			os.Exit(exitConfig)
+		}
+		return nil
+	}
+	apiURL, err := url.Parse(o.api)
+	if err != nil || (apiURL.Scheme != "http" && apiURL.Scheme != "https") || apiURL.Hostname() == "" {
+		logger.Error("Invalid CLI argument", "argument", "toxiproxy", "error", "expected the URL of the API, e.g. http://localhost:8474")
+		os.Exit(exitConfig)
+	}
+	_, listenPort, err := net.SplitHostPort(o.listen)
+	if err != nil {
+		logger.Error("Invalid CLI argument", "argument", "toxiproxy-listen", "error", err)
+		os.Exit(exitConfig)
+	}
+	upstream := o.upstream
+	if upstream == "" {
+		u, err := url.Parse(connString)
+		if err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") || u.Hostname() == "" {
+			logger.Error("Invalid CLI argument", "argument", "toxiproxy-upstream", "error", "the upstream can only be derived from URL connection strings with a host, set it explicitly")
+			os.Exit(exitConfig)
+		}
+		upstream = net.JoinHostPort(u.Hostname(), cmp.Or(u.Port(), "5432"))
+	}
+	var phases []ImpairmentPhase
+	if o.phases != "" {
+		if phases, err = parseImpairmentPhases(o.phases); err != nil {
+			logger.Error("Invalid CLI argument", "argument", "impairments", "error", err)
+			os.Exit(exitConfig)
+		}
+	}
+	return &NetworkImpairments{
+		client:     toxiproxy.NewClient(o.api),
+		proxy:      toxiproxy.Proxy{Name: "loadgen_" + strings.ReplaceAll(runID, "-", "")[:8], Listen: o.listen, Upstream: upstream, Enabled: true},
+		apiHost:    apiURL.Hostname(),
+		phases:     phases,
+		listenPort: listenPort,
+	}
+}
+
+// WorkerConnString returns the connection string connecting through the proxy
+func (n *NetworkImpairments) WorkerConnString(connString string) string {
+	if n == nil {
+		return connString
+	}
+	u, err := url.Parse(connString)
+	if err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+		logger.Error("Invalid CLI argument", "argument", "db", "error", "-toxiproxy requires a URL connection string, e.g. postgresql://user@host/db")
+		os.Exit(exitConfig)
+	}
+	u.Host = net.JoinHostPort(n.apiHost, n.listenPort)
+	return u.String()
+}
+
+// Start creates the proxy, applies the phases at offset 0 before returning and the others in the background.
+// Returned function stops applying phases and deletes the proxy.
+func (n *NetworkImpairments) Start(ctx context.Context) func() {
+	if n == nil {
+		return func() {}
+	}
+	if err := n.client.CreateProxy(ctx, n.proxy); err != nil {
+		logger.Error("Unable to create the Toxiproxy proxy", "proxy", n.proxy.Name, "error", err)
+		os.Exit(exitConnection)
+	}
+	logger.Info("Routing the workers through Toxiproxy", "proxy", n.proxy.Name, "listen", n.proxy.Listen, "upstream", n.proxy.Upstream, "phases", len(n.phases))
+
+	startTime := time.Now()
+	pending := n.phases
+	for len(pending) > 0 && pending[0].At == 0 {
+		n.apply(ctx, pending[0])
+		pending = pending[1:]
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, phase := range pending {
+			timer := time.NewTimer(time.Until(startTime.Add(phase.At)))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			n.apply(ctx, phase)
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+		if err := n.client.DeleteProxy(context.Background(), n.proxy.Name); err != nil {
+			logger.Warn("Unable to delete the Toxiproxy proxy", "proxy", n.proxy.Name, "error", err)
+		}
+	}
+}
+
+func (n *NetworkImpairments) apply(ctx context.Context, phase ImpairmentPhase) {
+	report := ImpairmentReport{Name: phase.Name, AtSec: phase.At.Seconds()}
+	err := n.client.SetToxics(ctx, n.proxy.Name, phase.toxics())
+	report.AppliedAt = time.Now()
+	if err != nil {
+		report.Error = err.Error()
+		logger.Error("Unable to apply network impairment", "impairment", phase.Name, "error", err)
+	} else {
+		logger.Info("Applied network impairment", "impairment", phase.Name, "atSec", phase.At.Seconds())
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.reports = append(n.reports, report)
+	if err == nil {
+		n.active = append(n.active, report)
+	}
+}
+
+// ActiveAt returns the name of the phase applied at the monotonic offset us, see results.MonotonicUs, none before the first one
+func (n *NetworkImpairments) ActiveAt(us int64) string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	name := noImpairment
+	for _, report := range n.active {
+		if results.MonotonicUs(report.AppliedAt) > us {
+			break
+		}
+		name = report.Name
+	}
+	return name
+}
+
+// CSVHeader returns the header of a results CSV with the impairment column
+func (n *NetworkImpairments) CSVHeader(header []string) []string {
+	if n == nil {
+		return header
+	}
+	return append(header[:len(header):len(header)], "impairment")
+}
+
+// CSVRecord returns the record with the phase active at the start of its operation on the monotonic clock
+func (n *NetworkImpairments) CSVRecord(record []string, startMonotonicUs int64) []string {
+	if n == nil {
+		return record
+	}
+	return append(record, n.ActiveAt(startMonotonicUs))
+}
+
+// Report returns the applied phases, nil without -toxiproxy
+func (n *NetworkImpairments) Report() []ImpairmentReport {
+	if n == nil {
+		return nil
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return slices.Clone(n.reports)
+}
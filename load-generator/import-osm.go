@@ -0,0 +1,78 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+
+	"load-generator/internal/osm"
+	"load-generator/internal/workload"
+)
+
+func runImportOSM(args []string) {
+	fs := newFlagSet("import-osm", "Convert an OpenStreetMap PBF extract into the POI CSV and locality GeoJSON init reads,\nso other cities can be benchmarked. The extract is given as positional argument.")
+	outDir := fs.String("out-dir", "./dataset", "Directory to write <name>-pois.csv and <name>-localities.geojson to, existing files are not overwritten")
+	name := fs.String("name", "", "Prefix of the generated file names, defaults to the extract's file name without extension, e.g. berlin for berlin-latest.osm.pbf")
+	poiKeys := fs.String("poi-keys", "amenity,tourism,shop,leisure", "Comma separated tag keys of named nodes imported as POIs, the tag value is the category")
+	adminLevel := fs.String("admin-level", "10", "admin_level of the named administrative boundaries imported as localities, e.g. 9 for the districts or 10 for the Ortsteile of Berlin")
+	city := fs.String("city", "", "Profile of a city (berlin, munich, hamburg, cologne or vienna) whose bounding box limits the POIs and localities,\nits admin level and name replace the defaults of -admin-level and -name")
+	fs.Parse(args)
+
+	logger = slog.New(slog.NewJSONHandler(os.Stderr, nil))
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(exitConfig)
+	}
+	extract := fs.Arg(0)
+	var bbox *workload.BBox
+	if *city != "" {
+		profile, err := workload.LookupCity(*city)
+		if err != nil {
+			logger.Error("Invalid CLI argument", "argument", "city", "error", err)
+			os.Exit(exitConfig)
+		}
+		bbox = &profile.BBox
+		if !explicitFlags(fs)["admin-level"] {
+			*adminLevel = profile.AdminLevel
+		}
+		if *name == "" {
+			*name = profile.Name
+		}
+	}
+	if *name == "" {
+		*name = strings.TrimSuffix(strings.TrimSuffix(path.Base(extract), ".osm.pbf"), "-latest")
+	}
+
+	pois, localities, stats, err := osm.Extract(extract, osm.ExtractOptions{
+		POIKeys:    strings.Split(*poiKeys, ","),
+		AdminLevel: *adminLevel,
+		BBox:       bbox,
+	}, logger)
+	if err != nil {
+		logger.Error("Unable to import OSM extract", "filename", extract, "error", err)
+		os.Exit(exitConfig)
+	}
+	logger.Info("Read OSM extract", "filename", extract,
+		"pois", stats.POIs,
+		"boundaryRelations", stats.BoundaryRelations,
+		"localities", stats.Localities,
+		"skippedLocalities", stats.SkippedLocalities,
+		"outsideBBox", stats.OutsideBBox,
+		"referencedWays", stats.ReferencedWays,
+		"referencedNodes", stats.ReferencedNodes,
+		"missingMemberNodes", stats.MissingMemberNodes,
+	)
+	if len(localities) == 0 {
+		logger.Warn("No localities found, check -admin-level", "adminLevel", *adminLevel)
+	}
+
+	poisFile := path.Join(*outDir, *name+"-pois.csv")
+	writeDatasetFile(poisFile, func(f *os.File) error { return workload.WritePOIsCSV(f, pois) })
+	logger.Info("Wrote POIs", "filename", poisFile, "count", len(pois))
+
+	localitiesFile := path.Join(*outDir, *name+"-localities.geojson")
+	writeDatasetFile(localitiesFile, func(f *os.File) error { return workload.WriteLocalitiesGeoJSON(f, localities) })
+	logger.Info("Wrote localities", "filename", localitiesFile, "count", len(localities))
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/csv"
+	"log/slog"
+	"os"
+	"time"
+
+	"load-generator/internal/feeds"
+	"load-generator/internal/workload"
+)
+
+func runImportTrips(args []string) {
+	fs := newFlagSet("import-trips", "Convert published e-scooter trip data into the trips CSV insert reads, for a non-synthetic workload.\nThe exports are given as positional arguments, either MDS provider trips responses (JSON) or CSV exports\nwith one row per trip, e.g. the E-Scooter Trips of the Chicago Data Portal.")
+	out := fs.String("out", "./dataset/imported-trips.csv", "Path of the trips CSV to write, an existing file is not overwritten")
+	format := fs.String("format", "csv", "Format of the exports: mds for the JSON of the MDS provider trips endpoint, csv for trip exports")
+	sampleInterval := fs.Duration("sample-interval", 10*time.Second, "Interpolate positions between the published ones every <interval>, 0 writes only the published positions")
+	cols := feeds.ChicagoColumns
+	fs.StringVar(&cols.TripID, "trip-id-column", cols.TripID, "Column of the trip ID in CSV exports")
+	fs.StringVar(&cols.StartTime, "start-time-column", cols.StartTime, "Column of the start time in CSV exports")
+	fs.StringVar(&cols.EndTime, "end-time-column", cols.EndTime, "Column of the end time in CSV exports")
+	fs.StringVar(&cols.StartLat, "start-lat-column", cols.StartLat, "Column of the start latitude in CSV exports")
+	fs.StringVar(&cols.StartLon, "start-lon-column", cols.StartLon, "Column of the start longitude in CSV exports")
+	fs.StringVar(&cols.EndLat, "end-lat-column", cols.EndLat, "Column of the end latitude in CSV exports")
+	fs.StringVar(&cols.EndLon, "end-lon-column", cols.EndLon, "Column of the end longitude in CSV exports")
+	fs.StringVar(&cols.TimeLayout, "time-layout", cols.TimeLayout, "Go time layout of the times in CSV exports, e.g. 2006-01-02T15:04:05Z07:00 for RFC3339")
+	timezone := fs.String("timezone", "America/Chicago", "Time zone of CSV export times without an offset")
+	fs.Parse(args)
+
+	logger = slog.New(slog.NewJSONHandler(os.Stderr, nil))
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(exitConfig)
+	}
+	if *format != "mds" && *format != "csv" {
+		logger.Error("Invalid CLI argument", "argument", "format", "error", "expected mds or csv")
+		os.Exit(exitConfig)
+	}
+	location, err := time.LoadLocation(*timezone)
+	if err != nil {
+		logger.Error("Invalid CLI argument", "argument", "timezone", "error", err)
+		os.Exit(exitConfig)
+	}
+	cols.Location = location
+
+	trips, events := 0, 0
+	writeDatasetFile(*out, func(f *os.File) error {
+		cw := csv.NewWriter(f)
+		if err := cw.Write([]string{"event_id", "trip_id", "timestamp", "latitude", "longitude"}); err != nil {
+			return err
+		}
+		writeTrip := func(trip feeds.Trip) error {
+			n, err := feeds.WriteTripEvents(cw, trip, *sampleInterval)
+			trips++
+			events += n
+			return err
+		}
+		for _, filename := range fs.Args() {
+			in, err := workload.OpenInput(filename)
+			if err != nil {
+				return err
+			}
+			var skipped int
+			if *format == "mds" {
+				var mdsTrips []feeds.Trip
+				mdsTrips, skipped, err = feeds.ReadMDSTrips(in)
+				for _, trip := range mdsTrips {
+					if err == nil {
+						err = writeTrip(trip)
+					}
+				}
+			} else {
+				skipped, err = feeds.ReadCSVTrips(in, cols, writeTrip)
+			}
+			in.Close()
+			if err != nil {
+				return err
+			}
+			logger.Info("Converted trip export", "filename", filename, "skippedTrips", skipped)
+		}
+		cw.Flush()
+		return cw.Error()
+	})
+	logger.Info("Imported trips", "filename", *out, "trips", trips, "events", events)
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"load-generator/internal/results"
+	"load-generator/internal/targets"
+)
+
+// size of a table including its indexes in bytes
+const cratedbTableSizeSql = `
+SELECT coalesce(sum(size), 0)::bigint
+FROM sys.shards
+WHERE table_name = $1 AND primary = true;`
+
+const mobilitydbTableSizeSql = `SELECT citus_total_relation_size($1::regclass)::bigint;`
+
+// IndexBenchConfig defines the index sets of an index-bench run, e.g. spatial, temporal and composite
+type IndexBenchConfig struct {
+	// tables whose size is measured, defaults to escooter_events
+	Tables []string `json:"tables"`
+	// flags of the query command executed for every index set, e.g. queries and nqueries,
+	// the workload is skipped if empty
+	Query map[string]string `json:"query,omitempty"`
+	Sets  []IndexSet        `json:"sets"`
+}
+
+// IndexSet is created before its measurements and dropped afterwards, so every set is measured on its own
+type IndexSet struct {
+	Name   string   `json:"name"`
+	Create []string `json:"create"`
+	Drop   []string `json:"drop"`
+}
+
+type IndexSetResult struct {
+	Name         string           `json:"name"`
+	BuildTimeSec float64          `json:"buildTimeSec"`
+	TableBytes   map[string]int64 `json:"tableBytes"`
+	// growth of the tables compared to the baseline without any index set
+	IndexBytes  int64             `json:"indexBytes"`
+	Query       *TargetComparison `json:"query,omitempty"`
+	ResultsDir  string            `json:"resultsDir,omitempty"`
+	DropTimeSec float64           `json:"dropTimeSec"`
+}
+
+type IndexBenchSummary struct {
+	RunID            string           `json:"runId"`
+	DBTarget         string           `json:"dbTarget"`
+	SchemaVariant    string           `json:"schemaVariant,omitempty"`
+	File             string           `json:"file"`
+	QueryWorkloadRun bool             `json:"queryWorkloadRun"`
+	BaselineBytes    map[string]int64 `json:"baselineBytes"`
+	Sets             []IndexSetResult `json:"sets"`
+	Aborted          bool             `json:"aborted"`
+}
+
+// createIndexName matches the name of the index of a CREATE INDEX statement
+var createIndexName = regexp.MustCompile(`(?i)^\s*CREATE\s+(?:UNIQUE\s+)?INDEX\s+(?:CONCURRENTLY\s+)?(?:IF\s+NOT\s+EXISTS\s+)?(\w+)`)
+
+func readIndexBenchConfig(filename string) (IndexBenchConfig, error) {
+	var config IndexBenchConfig
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return config, err
+	}
+	if err := json.Unmarshal(b, &config); err != nil {
+		return config, fmt.Errorf("Parsing index sets %s: %w", filename, err)
+	}
+	if len(config.Sets) == 0 {
+		return config, fmt.Errorf("Index sets %s defines no sets", filename)
+	}
+	for i, set := range config.Sets {
+		if set.Name == "" {
+			return config, fmt.Errorf("Index set %d has no name", i+1)
+		}
+		// the indexes are prefixed with their tables, so the sets of runs with different table prefixes don't collide
+		for _, stmt := range set.Create {
+			if m := createIndexName.FindStringSubmatch(stmt); m != nil {
+				targets.AddPrefixedIdentifiers(m[1])
+			}
+		}
+	}
+	if len(config.Tables) == 0 {
+		config.Tables = []string{"escooter_events"}
+	}
+	return config, nil
+}
+
+func runIndexBench(args []string) {
+	fs := newFlagSet("index-bench", "Create and drop the index sets of a file one after another, measure their build time and the table size\nand optionally run the query workload with every set.\nUsage: index-bench [flags] indexsets.json\nThe tables have to be initialized and filled beforehand, the query workload of every set writes into its own directory below -results-dir.")
+	var common commonOptions
+	common.register(fs)
+	fs.Parse(args)
+
+	ctx, stop := signalContext()
+	defer stop()
+	common.setup("index-bench", 0)
+	defer common.close()
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(exitConfig)
+	}
+	config, err := readIndexBenchConfig(fs.Arg(0))
+	if err != nil {
+		logger.Error("Unable to read index sets", "error", err)
+		os.Exit(exitConfig)
+	}
+
+	logger.Info("Starting load-generator with following cli arguments",
+		"mode", "index-bench",
+		"log", common.logLevel,
+		"connString", redactConnString(common.connString),
+		"dbTarget", common.dbTarget.String(),
+		"indexSets", fs.Arg(0),
+		"sets", len(config.Sets),
+		"queryWorkload", len(config.Query) > 0,
+	)
+	if common.dryRun {
+		dryRunIndexBench(common.dbTarget, config)
+		return
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		logger.Error("Unable to locate the load-generator executable", "error", err)
+		os.Exit(exitFailure)
+	}
+	conn, err := pgx.Connect(ctx, common.connString)
+	if err != nil {
+		logger.Error("Unable to connect to database", "error", err)
+		os.Exit(exitConnection)
+	}
+	defer conn.Close(context.Background())
+
+	sizeSql := cratedbTableSizeSql
+	if common.dbTarget == targets.MobilityDB {
+		sizeSql = mobilitydbTableSizeSql
+	}
+
+	timestamp := time.Now().Format("20060102_150405")
+	benchDir := filepath.Join(resultsDir, fmt.Sprintf("index_bench_%s_%s_%s", common.dbTarget, timestamp, runID))
+	summary := IndexBenchSummary{
+		RunID:            runID,
+		DBTarget:         common.dbTarget.String(),
+		File:             fs.Arg(0),
+		SchemaVariant:    common.schemaVariant,
+		QueryWorkloadRun: len(config.Query) > 0,
+	}
+
+	summary.BaselineBytes, err = tableSizes(ctx, conn, sizeSql, config.Tables)
+	if err != nil {
+		logger.Error("Unable to measure table size", "error", err)
+		os.Exit(exitCode(err))
+	}
+	logger.Info("Measured baseline table size", "tableBytes", summary.BaselineBytes)
+
+	for i, set := range config.Sets {
+		result, err := benchIndexSet(ctx, conn, sizeSql, config, set, summary.BaselineBytes, func(result *IndexSetResult) int {
+			result.ResultsDir = filepath.Join(benchDir, fmt.Sprintf("%02d-%s", i+1, set.Name))
+			queryArgs := map[string]string{
+				"dbTarget":       common.dbTargetStr,
+				"db":             common.connString,
+				"schema-variant": common.schemaVariant,
+				"schema-prefix":  common.schemaPrefix,
+				"results-dir":    result.ResultsDir,
+				"log-dir":        result.ResultsDir,
+			}
+			for name, value := range config.Query {
+				queryArgs[name] = value
+			}
+			exitCode := runChildCommand(ctx, executable, "query", flagArgs(queryArgs))
+			comparison := compareTarget("query", common.dbTargetStr, exitCode, result.ResultsDir)
+			result.Query = &comparison
+			return exitCode
+		})
+		summary.Sets = append(summary.Sets, result)
+		writeIndexBenchSummary(benchDir, summary)
+		if err != nil {
+			summary.Aborted = ctx.Err() != nil
+			writeIndexBenchSummary(benchDir, summary)
+			logger.Error("Stopping index benchmark after failed index set", "set", set.Name, "error", err)
+			if summary.Aborted {
+				os.Exit(exitAborted)
+			}
+			os.Exit(exitCode(err))
+		}
+	}
+
+	printIndexBench(summary)
+}
+
+// benchIndexSet creates the index set, measures it, runs the query workload if configured and drops the set again.
+// The set is dropped even if the workload fails, so the next run starts without it.
+func benchIndexSet(ctx context.Context, conn *pgx.Conn, sizeSql string, config IndexBenchConfig, set IndexSet, baseline map[string]int64, runQueries func(*IndexSetResult) int) (IndexSetResult, error) {
+	result := IndexSetResult{Name: set.Name}
+	logger.Info("Creating index set", "set", set.Name, "statements", len(set.Create))
+
+	startTime := time.Now()
+	createErr := execStatements(ctx, conn, set.Create)
+	result.BuildTimeSec = time.Since(startTime).Seconds()
+
+	var err error
+	if createErr == nil {
+		result.TableBytes, err = tableSizes(ctx, conn, sizeSql, config.Tables)
+		if err != nil {
+			createErr = fmt.Errorf("Measuring table size: %w", err)
+		}
+		for table, bytes := range result.TableBytes {
+			result.IndexBytes += bytes - baseline[table]
+		}
+		logger.Info("Created index set", "set", set.Name, "buildTimeSec", result.BuildTimeSec, "tableBytes", result.TableBytes, "indexBytes", result.IndexBytes)
+	}
+
+	if createErr == nil && len(config.Query) > 0 {
+		// a workload ending at its -max-duration is a planned end
+		if exitCode := runQueries(&result); exitCode != 0 && (exitCode != exitAborted || ctx.Err() != nil) {
+			createErr = fmt.Errorf("Query workload exited with code %d", exitCode)
+		}
+	}
+
+	// the set is dropped with a fresh context, so an interrupted run does not leave its indexes behind
+	dropCtx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	logger.Info("Dropping index set", "set", set.Name, "statements", len(set.Drop))
+	startTime = time.Now()
+	dropErr := execStatements(dropCtx, conn, set.Drop)
+	result.DropTimeSec = time.Since(startTime).Seconds()
+
+	if createErr != nil {
+		return result, createErr
+	}
+	return result, dropErr
+}
+
+func execStatements(ctx context.Context, conn *pgx.Conn, statements []string) error {
+	for i, stmt := range statements {
+		if _, err := conn.Exec(ctx, targets.PrefixTables(stmt)); err != nil {
+			return fmt.Errorf("Executing statement %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func tableSizes(ctx context.Context, conn *pgx.Conn, sizeSql string, tables []string) (map[string]int64, error) {
+	sizes := make(map[string]int64, len(tables))
+	for _, table := range tables {
+		var size int64
+		if err := conn.QueryRow(ctx, sizeSql, targets.Table(table)).Scan(&size); err != nil {
+			return nil, fmt.Errorf("Table %s: %w", table, err)
+		}
+		sizes[table] = size
+	}
+	return sizes, nil
+}
+
+func dryRunIndexBench(dbTarget targets.DBTarget, config IndexBenchConfig) {
+	fmt.Printf("Dry run of index-bench against %s, nothing is executed\n\n", dbTarget)
+	fmt.Printf("Measured tables: %v\n", config.Tables)
+	if len(config.Query) > 0 {
+		fmt.Printf("Query workload per set: query %v\n", flagArgs(config.Query))
+	}
+	fmt.Println()
+	for _, set := range config.Sets {
+		for i, stmt := range set.Create {
+			printDryRunSQL(fmt.Sprintf("%s: create %d", set.Name, i+1), targets.PrefixTables(stmt))
+		}
+		for i, stmt := range set.Drop {
+			printDryRunSQL(fmt.Sprintf("%s: drop %d", set.Name, i+1), targets.PrefixTables(stmt))
+		}
+	}
+}
+
+// writeIndexBenchSummary rewrites the summary after every set, so it reflects the progress of an interrupted run
+func writeIndexBenchSummary(benchDir string, summary IndexBenchSummary) {
+	filename := filepath.Join(benchDir, fmt.Sprintf("index_bench_summary_%s.json", summary.RunID))
+	b, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		logger.Error("Failed to encode index benchmark summary", "error", err)
+		return
+	}
+	if err := os.MkdirAll(benchDir, 0777); err != nil {
+		logger.Error("Failed to create index benchmark directory", "dir", benchDir, "error", err)
+		return
+	}
+	if err := os.WriteFile(filename, b, 0666); err != nil {
+		logger.Error("Failed to write index benchmark summary", "filename", filename, "error", err)
+	}
+}
+
+func printIndexBench(summary IndexBenchSummary) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "Index sets of run %s against %s\n", summary.RunID, summary.DBTarget)
+	fmt.Fprintln(w, "set\tbuild s\tindex MB\tdrop s\t")
+	for _, r := range summary.Sets {
+		fmt.Fprintf(w, "%s\t%.1f\t%.1f\t%.1f\t\n", r.Name, r.BuildTimeSec, float64(r.IndexBytes)/(1<<20), r.DropTimeSec)
+	}
+	w.Flush()
+
+	if !summary.QueryWorkloadRun {
+		return
+	}
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "set\trequests\tfailed\tops/s\tmean ms\tp50 ms\tp95 ms\tp99 ms\tmax ms\t")
+	for _, r := range summary.Sets {
+		latency := results.LatencyStats{}
+		if r.Query != nil {
+			latency = r.Query.Latency
+		}
+		printStatsRow(w, r.Name, latency)
+	}
+	w.Flush()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"load-generator/internal/targets"
+)
+
+// InitSummary documents the state an init left the database in, which the following benchmarks start from
+type InitSummary struct {
+	RunID          string                     `json:"runId"`
+	DBTarget       string                     `json:"dbTarget"`
+	SchemaVariant  string                     `json:"schemaVariant,omitempty"`
+	Tenants        int                        `json:"tenants,omitempty"` // tenants of -tenants the tables were created for
+	StartTime      time.Time                  `json:"startTime"`
+	EndTime        time.Time                  `json:"endTime"`
+	DurationSec    float64                    `json:"durationSec"`
+	Partitions     *PrecreatedPartitions      `json:"partitions,omitempty"`
+	WorkloadRole   string                     `json:"workloadRole,omitempty"`
+	TableSettings  *targets.CrateSettings     `json:"tableSettings,omitempty"`
+	Simplification *GeometrySimplification    `json:"simplification,omitempty"`
+	Statistics     []targets.StatisticsTiming `json:"statistics"`
+}
+
+// GeometrySimplification records the -simplify-tolerance applied to the locality geometries
+type GeometrySimplification struct {
+	Tolerance       float64 `json:"tolerance"`
+	PositionsBefore int     `json:"positionsBefore"`
+	PositionsAfter  int     `json:"positionsAfter"`
+}
+
+// PrecreatedPartitions records the partitions created by -precreate-partitions before any events were inserted
+type PrecreatedPartitions struct {
+	Interval    string    `json:"interval"`
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	Created     int       `json:"created"`
+	DurationSec float64   `json:"durationSec"`
+}
+
+func writeInitSummaryJSON(summary InitSummary) string {
+	timestamp := summary.StartTime.Format("20060102_150405")
+
+	filename := fmt.Sprintf("init_%s_%s_%s.json", summary.DBTarget, timestamp, runID)
+	filename = path.Join(resultsDir, filename)
+
+	summary.RunID = runID
+	b, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		logger.Error("Failed to encode init summary", "error", err)
+		os.Exit(exitFailure)
+	}
+	if err := writeNewFile(filename, b); err != nil {
+		logger.Error("Failed to write init summary", "filename", filename, "error", err)
+		os.Exit(exitFailure)
+	}
+
+	registerArtifact(filename)
+	logger.Info("Wrote init summary", "filename", filename)
+	return filename
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// inputCacheDir keeps downloaded URL inputs, empty streams them on every read
+var inputCacheDir = os.Getenv("LOADGEN_INPUT_CACHE")
+
+// inputClient downloads the URL inputs. It has no overall timeout, the body is streamed while a command runs
+// for as long as the command takes to read it, so only connecting and waiting for the response are limited.
+var inputClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: time.Minute,
+	},
+}
+
+// emptyPayloadHash is the SHA-256 of an empty body, signed for GET requests
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+func isInputURL(p string) bool {
+	return strings.HasPrefix(p, "https://") || strings.HasPrefix(p, "s3://")
+}
+
+// inputValidators are the ETag and Last-Modified of a cached input, kept next to it in <cached>.validators.json
+// to revalidate it with a conditional request
+type inputValidators struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+func (v inputValidators) empty() bool {
+	return v.ETag == "" && v.LastModified == ""
+}
+
+// openInput opens a local file, or streams an https:// or s3://bucket/key URL. s3 URLs are read from
+// AWS_ENDPOINT_URL in AWS_REGION, signed if AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are set.
+// With an input cache the first read is written to the cache while streaming. Later reads revalidate the cached
+// file with its ETag and Last-Modified and open it unless the input changed, inputs served without either
+// aren't cached. If the input can't be requested the cached file is read.
+func openInput(p string) (io.ReadCloser, error) {
+	if !isInputURL(p) {
+		return os.Open(p)
+	}
+	cached := ""
+	var validators inputValidators
+	if inputCacheDir != "" {
+		hash := sha256.Sum256([]byte(p))
+		cached = filepath.Join(inputCacheDir, hex.EncodeToString(hash[:8])+"-"+path.Base(p))
+		validators = readInputValidators(cached)
+	}
+
+	body, changed, err := downloadInput(context.Background(), p, validators)
+	switch {
+	case err != nil && validators.empty():
+		return nil, err
+	case err != nil:
+		logger.Warn("Failed to revalidate cached input, reading the cached file", "url", p, "filename", cached, "error", err)
+		return os.Open(cached)
+	case body == nil:
+		logger.Debug("Reading cached input", "url", p, "filename", cached)
+		return os.Open(cached)
+	case cached == "":
+		return body, nil
+	case changed.empty():
+		logger.Warn("Not caching input without ETag or Last-Modified", "url", p)
+		return body, nil
+	}
+	if err := os.MkdirAll(inputCacheDir, 0o755); err != nil {
+		body.Close()
+		return nil, fmt.Errorf("Creating input cache directory: %w", err)
+	}
+	part, err := os.CreateTemp(inputCacheDir, path.Base(cached)+".*.part")
+	if err != nil {
+		body.Close()
+		return nil, fmt.Errorf("Creating cached input: %w", err)
+	}
+	logger.Info("Downloading input into the cache", "url", p, "filename", cached)
+	return &cachingReader{body: body, part: part, filename: cached, validators: changed}, nil
+}
+
+// readInputValidators returns the validators of the cached input, empty if it isn't cached
+func readInputValidators(cached string) inputValidators {
+	var validators inputValidators
+	if _, err := os.Stat(cached); err != nil {
+		return validators
+	}
+	b, err := os.ReadFile(cached + ".validators.json")
+	if err != nil || json.Unmarshal(b, &validators) != nil {
+		return inputValidators{}
+	}
+	return validators
+}
+
+// downloadInput requests the input, conditionally if validators of a cached copy are given.
+// The body is nil if the cached copy is still current, otherwise the validators of the response are returned with it.
+func downloadInput(ctx context.Context, p string, cached inputValidators) (io.ReadCloser, inputValidators, error) {
+	var validators inputValidators
+	var req *http.Request
+	var err error
+	if strings.HasPrefix(p, "s3://") {
+		req, err = s3GetRequest(ctx, p)
+	} else {
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, p, nil)
+	}
+	if err != nil {
+		return nil, validators, fmt.Errorf("Requesting input %s: %w", p, err)
+	}
+	// the conditional headers aren't part of the S3 signature
+	if cached.ETag != "" {
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+	if cached.LastModified != "" {
+		req.Header.Set("If-Modified-Since", cached.LastModified)
+	}
+	resp, err := inputClient.Do(req)
+	if err != nil {
+		return nil, validators, fmt.Errorf("Requesting input %s: %w", p, err)
+	}
+	if resp.StatusCode == http.StatusNotModified && !cached.empty() {
+		resp.Body.Close()
+		return nil, validators, nil
+	}
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		return nil, validators, fmt.Errorf("Requesting input %s failed with status %s: %s", p, resp.Status, body)
+	}
+	validators = inputValidators{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+	return resp.Body, validators, nil
+}
+
+// s3GetRequest builds the path-style GET request of an s3://bucket/key URL, signed if credentials are set
+func s3GetRequest(ctx context.Context, p string) (*http.Request, error) {
+	u, err := url.Parse(p)
+	if err != nil {
+		return nil, err
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || key == "" {
+		return nil, fmt.Errorf("S3 input must be in the form s3://bucket/key, got %q", p)
+	}
+	endpoint, err := url.Parse(envOrDefault("AWS_ENDPOINT_URL", "https://s3.amazonaws.com"))
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("Invalid S3 endpoint in AWS_ENDPOINT_URL")
+	}
+	objectURL := *endpoint
+	objectURL.Path = path.Join("/", endpoint.Path, u.Host, key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, objectURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	signer := &S3Uploader{
+		Region:       envOrDefault("AWS_REGION", "us-east-1"),
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	// public buckets are read without credentials
+	if signer.AccessKey != "" && signer.SecretKey != "" {
+		signer.sign(req, emptyPayloadHash, time.Now().UTC())
+	}
+	return req, nil
+}
+
+// cachingReader writes the streamed body into a partial cache file, which becomes the cached input
+// once the body was read completely
+type cachingReader struct {
+	body       io.ReadCloser
+	part       *os.File
+	filename   string
+	validators inputValidators
+	complete   bool
+}
+
+func (r *cachingReader) Read(b []byte) (int, error) {
+	n, err := r.body.Read(b)
+	if n > 0 {
+		if _, werr := r.part.Write(b[:n]); werr != nil {
+			return n, fmt.Errorf("Writing cached input: %w", werr)
+		}
+	}
+	if err == io.EOF {
+		r.complete = true
+	}
+	return n, err
+}
+
+func (r *cachingReader) Close() error {
+	r.body.Close()
+	err := r.part.Close()
+	if r.complete && err == nil {
+		// stale validators of a replaced input only cause another download
+		if err = os.Rename(r.part.Name(), r.filename); err == nil {
+			return writeInputValidators(r.filename, r.validators)
+		}
+	}
+	// a partially read input is not cached
+	os.Remove(r.part.Name())
+	return err
+}
+
+func writeInputValidators(cached string, validators inputValidators) error {
+	b, err := json.Marshal(validators)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(cached+".validators.json", b, 0o644)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsInputURL(t *testing.T) {
+	for p, want := range map[string]bool{
+		"https://example.com/trips.csv": true,
+		"s3://bucket/trips.csv":         true,
+		"http://example.com/trips.csv":  false,
+		"trips.csv":                     false,
+	} {
+		if got := isInputURL(p); got != want {
+			t.Errorf("isInputURL(%q) = %v, want %v", p, got, want)
+		}
+	}
+}
+
+func TestOpenInputCache(t *testing.T) {
+	logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	content, etag := "version 1", `"1"`
+	downloads := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads++
+		w.Header().Set("ETag", etag)
+		io.WriteString(w, content)
+	}))
+	defer server.Close()
+
+	defaultClient, defaultCacheDir := inputClient, inputCacheDir
+	inputClient, inputCacheDir = server.Client(), t.TempDir()
+	defer func() { inputClient, inputCacheDir = defaultClient, defaultCacheDir }()
+
+	read := func() string {
+		t.Helper()
+		f, err := openInput(server.URL + "/trips.csv")
+		if err != nil {
+			t.Fatalf("openInput failed: %v", err)
+		}
+		defer f.Close()
+		b, err := io.ReadAll(f)
+		if err != nil {
+			t.Fatalf("Reading input failed: %v", err)
+		}
+		return string(b)
+	}
+
+	if got := read(); got != "version 1" || downloads != 1 {
+		t.Fatalf("first read = %q after %d downloads, want version 1 after 1", got, downloads)
+	}
+	if got := read(); got != "version 1" || downloads != 1 {
+		t.Errorf("unchanged read = %q after %d downloads, want the cached version 1", got, downloads)
+	}
+
+	content, etag = "version 2", `"2"`
+	if got := read(); got != "version 2" || downloads != 2 {
+		t.Errorf("read of the changed input = %q after %d downloads, want version 2 after 2", got, downloads)
+	}
+	if got := read(); got != "version 2" || downloads != 2 {
+		t.Errorf("read after the change = %q after %d downloads, want the cached version 2", got, downloads)
+	}
+
+	// the cached file is read if the input can't be revalidated
+	server.Close()
+	if got := read(); got != "version 2" {
+		t.Errorf("read without server = %q, want the cached version 2", got)
+	}
+}
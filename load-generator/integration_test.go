@@ -0,0 +1,303 @@
+//go:build integration
+
+// End-to-end tests running init, a tiny insert and a tiny query benchmark against
+// CrateDB and Citus+MobilityDB containers started with testcontainers-go.
+//
+//	go test -tags integration -run TestEndToEnd -timeout 20m ./...
+//
+// The images can be overridden with LOADGEN_TEST_CRATEDB_IMAGE and LOADGEN_TEST_MOBILITYDB_IMAGE.
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/testcontainers/testcontainers-go"
+
+	"load-generator/internal/results"
+	"load-generator/internal/targets"
+	"load-generator/internal/workload"
+)
+
+const (
+	testTrips          = 4
+	testEventsPerTrip  = 25
+	testNumQueries     = 20
+	testContainerReady = 3 * time.Minute
+)
+
+type testTarget struct {
+	name       string // value of -dbTarget
+	image      string
+	env        map[string]string
+	cmd        []string
+	connString func(hostPort string) string
+	// statements executed once the database accepts connections, before init
+	setup []string
+}
+
+func testTargets() []testTarget {
+	return []testTarget{
+		{
+			name:       "cratedb",
+			image:      envOrDefault("LOADGEN_TEST_CRATEDB_IMAGE", "crate:5.10"),
+			cmd:        []string{"-Cdiscovery.type=single-node"},
+			env:        map[string]string{"CRATE_HEAP_SIZE": "1g"},
+			connString: func(hostPort string) string { return "postgresql://crate@" + hostPort + "/doc" },
+		},
+		{
+			name:  "mobilitydbc",
+			image: envOrDefault("LOADGEN_TEST_MOBILITYDB_IMAGE", "ghcr.io/erykksc/citus-mobilitydb:latest"),
+			env:   map[string]string{"POSTGRES_USER": "postgres", "POSTGRES_PASSWORD": "postgres", "POSTGRES_DB": "postgres", "CITUS_ROLE": "coordinator"},
+			connString: func(hostPort string) string {
+				return "postgresql://postgres:postgres@" + hostPort + "/postgres"
+			},
+			// distributed tables are placed on the coordinator as there are no workers
+			setup: []string{"SELECT citus_set_coordinator_host('localhost')"},
+		},
+	}
+}
+
+// TestEndToEnd calls the functions behind init, insert and query, which return their errors,
+// instead of the commands, which exit the process on errors
+func TestEndToEnd(t *testing.T) {
+	moduleDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	for _, target := range testTargets() {
+		t.Run(target.name, func(t *testing.T) {
+			ctx := context.Background()
+			dbTarget, err := targets.Parse(target.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			connString := target.connString(startTestContainer(t, target))
+			for _, stmt := range target.setup {
+				execTestStatement(t, connString, stmt)
+			}
+
+			workDir := t.TempDir()
+			poisPath, localitiesPath, tripsPath := writeTestDataset(t, workDir)
+			pois, err := workload.LoadPOIs(poisPath)
+			if err != nil {
+				t.Fatalf("Loading POIs: %v", err)
+			}
+			localities, _, err := workload.LoadLocalities(localitiesPath, workload.LocalityFields)
+			if err != nil {
+				t.Fatalf("Loading localities: %v", err)
+			}
+
+			conn, err := pgx.Connect(ctx, connString)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = targets.Initialize(ctx, conn, dbTarget, pois, localities, targets.InitOptions{
+				MigrationsDir: filepath.Join(moduleDir, "migrations", target.name),
+				OnExisting:    targets.OnExistingFail,
+			}, logger)
+			conn.Close(ctx)
+			if err != nil {
+				t.Fatalf("Initializing database: %v", err)
+			}
+
+			runID = newUUID()
+			insertData := runTestBenchmark(t, filepath.Join(workDir, "insert.csv"), func(csvWriter *results.CSVWriter) (RunSummary, error) {
+				return benchmarkInserts(ctx, connString, nil, 2, time.Minute, 10, true, 0, dbTarget, tripsPath, nil, csvWriter)
+			})
+			if insertData.Kind != "insert" {
+				t.Fatalf("insert results have kind %q", insertData.Kind)
+			}
+			insertStats := results.ComputeLatencyStats(insertData.Rows)
+			if insertStats.Failed != 0 {
+				t.Errorf("%d of %d insert batches failed", insertStats.Failed, insertStats.Count)
+			}
+			if want := testTrips * testEventsPerTrip; insertStats.Operations != want {
+				t.Errorf("inserted %d events, want %d", insertStats.Operations, want)
+			}
+			if insertData.RunID == "" {
+				t.Error("insert results are missing the run ID")
+			}
+
+			// CrateDB makes inserted rows visible to queries only after a refresh
+			if target.name == "cratedb" {
+				execTestStatement(t, connString, "REFRESH TABLE escooter_events")
+			}
+
+			queryTemplates, err := workload.LoadTemplates(filepath.Join(moduleDir, "schemas", target.name+"-simple-read-queries.tmpl"))
+			if err != nil {
+				t.Fatalf("Loading query templates: %v", err)
+			}
+			runID = newUUID()
+			queryData := runTestBenchmark(t, filepath.Join(workDir, "query.csv"), func(csvWriter *results.CSVWriter) (RunSummary, error) {
+				return benchmarkQueries(ctx, connString, nil, 2, time.Minute, dbTarget, tripsPath, 0, localities, pois, queryTemplates, testNumQueries, 42, csvWriter)
+			})
+			if queryData.Kind != "query" {
+				t.Fatalf("query results have kind %q", queryData.Kind)
+			}
+			queryStats := results.ComputeLatencyStats(queryData.Rows)
+			if queryStats.Count != testNumQueries {
+				t.Errorf("executed %d queries, want %d", queryStats.Count, testNumQueries)
+			}
+			if queryStats.Failed != 0 {
+				t.Errorf("%d of %d queries failed", queryStats.Failed, queryStats.Count)
+			}
+			if queryData.RunID == insertData.RunID {
+				t.Error("insert and query runs share the same run ID")
+			}
+		})
+	}
+}
+
+// runTestBenchmark runs the benchmark writing its results into the CSV file and loads them
+func runTestBenchmark(t *testing.T, filename string, benchmark func(csvWriter *results.CSVWriter) (RunSummary, error)) *results.Data {
+	t.Helper()
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csvWriter := results.NewCSVWriter(file, 0, 0)
+	summary, err := benchmark(csvWriter)
+	if closeErr := csvWriter.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		t.Fatalf("%s benchmark failed: %v", summary.Mode, err)
+	}
+	if summary.Aborted {
+		t.Fatalf("%s benchmark was aborted", summary.Mode)
+	}
+	data, err := results.LoadCSV(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// startTestContainer runs the image with a random host port for 5432 and waits until it accepts queries
+func startTestContainer(t *testing.T, target testTarget) string {
+	t.Helper()
+	ctx := context.Background()
+
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        target.image,
+			Env:          target.env,
+			Cmd:          target.cmd,
+			ExposedPorts: []string{"5432/tcp"},
+		},
+		Started: true,
+	})
+	testcontainers.CleanupContainer(t, container)
+	if err != nil {
+		t.Skipf("Unable to start a %s container, is docker available? %v", target.image, err)
+	}
+	host, err := container.Host(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := container.MappedPort(ctx, "5432/tcp")
+	if err != nil {
+		t.Fatalf("Reading port of the %s container: %v", target.image, err)
+	}
+	hostPort := host + ":" + port.Port()
+
+	deadline := time.Now().Add(testContainerReady)
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		conn, err := pgx.Connect(ctx, target.connString(hostPort))
+		if err == nil {
+			_, err = conn.Exec(ctx, "SELECT 1")
+			conn.Close(ctx)
+		}
+		cancel()
+		if err == nil {
+			return hostPort
+		}
+		if time.Now().After(deadline) {
+			var logs []byte
+			if r, logErr := container.Logs(context.Background()); logErr == nil {
+				logs, _ = io.ReadAll(r)
+				r.Close()
+			}
+			t.Fatalf("%s not ready after %s: %v\n%s", target.image, testContainerReady, err, lastLines(string(logs), 50))
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// lastLines returns the last n lines of s
+func lastLines(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	return strings.Join(lines[max(0, len(lines)-n):], "\n")
+}
+
+func execTestStatement(t *testing.T, connString, stmt string) {
+	t.Helper()
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, connString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(ctx)
+	if _, err := conn.Exec(ctx, stmt); err != nil {
+		t.Fatalf("Executing %q: %v", stmt, err)
+	}
+}
+
+// writeTestDataset writes a tiny dataset in the format of the escooter-trips-generator
+func writeTestDataset(t *testing.T, dir string) (poisPath, localitiesPath, tripsPath string) {
+	t.Helper()
+
+	poisPath = filepath.Join(dir, "pois.csv")
+	pois := "poi_id,name,category,longitude,latitude\n" +
+		"7d6c5c2e-4b4a-4e0c-9d44-8f1f0a0d6e01,Brandenburger Tor,attraction,13.377704,52.516275\n" +
+		"7d6c5c2e-4b4a-4e0c-9d44-8f1f0a0d6e02,Alexanderplatz,square,13.413215,52.521918\n" +
+		"7d6c5c2e-4b4a-4e0c-9d44-8f1f0a0d6e03,Tempelhofer Feld,park,13.401897,52.473716\n"
+	writeTestFile(t, poisPath, pois)
+
+	localitiesPath = filepath.Join(dir, "localities.geojson")
+	localities := `{"type": "FeatureCollection", "features": [
+{"type": "Feature", "properties": {"locality_id": "1", "name": "Mitte"},
+ "geometry": {"type": "Polygon", "coordinates": [[[13.35, 52.50], [13.43, 52.50], [13.43, 52.54], [13.35, 52.54], [13.35, 52.50]]]}},
+{"type": "Feature", "properties": {"locality_id": "2", "name": "Tempelhof"},
+ "geometry": {"type": "Polygon", "coordinates": [[[13.37, 52.45], [13.43, 52.45], [13.43, 52.49], [13.37, 52.49], [13.37, 52.45]]]}}
+]}`
+	writeTestFile(t, localitiesPath, localities)
+
+	tripsPath = filepath.Join(dir, "trips.csv")
+	var trips strings.Builder
+	trips.WriteString("event_id,trip_id,timestamp,latitude,longitude\n")
+	start := time.Date(2023, 6, 1, 8, 0, 0, 0, time.UTC)
+	for trip := range testTrips {
+		tripID := fmt.Sprintf("00000000-0000-4000-8000-%012d", trip+1)
+		for event := range testEventsPerTrip {
+			fmt.Fprintf(&trips, "00000000-0000-4000-9000-%012d,%s,%s,%.6f,%.6f\n",
+				trip*testEventsPerTrip+event+1,
+				tripID,
+				start.Add(time.Duration(trip)*time.Hour+time.Duration(event)*10*time.Second).Format(time.RFC3339),
+				52.50+float64(trip)*0.01+float64(event)*0.0005,
+				13.38+float64(event)*0.0005,
+			)
+		}
+	}
+	writeTestFile(t, tripsPath, trips.String())
+	return poisPath, localitiesPath, tripsPath
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,123 @@
+// Package benchmark runs the workers of the insert and query benchmarks. The database or API the operations go to
+// and everything recording the finished operations are passed in, so the scheduling, draining and counting
+// can be tested without a database.
+package benchmark
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Config is shared by the insert and query benchmarks
+type Config struct {
+	NumWorkers int
+	// once ctx is done, in-flight operations may finish for DrainTimeout before they are cancelled
+	DrainTimeout time.Duration
+	// Control pauses the scheduling and counts the scheduled operations, nil never pauses
+	Control Control
+	Logger  *slog.Logger
+}
+
+// Control pauses the scheduling of new jobs, e.g. through the control API
+type Control interface {
+	// WaitIfPaused blocks while paused, returning the time waited, false if ctx is done while waiting
+	WaitIfPaused(ctx context.Context) (time.Duration, bool)
+	AddScheduled(n int)
+}
+
+type noControl struct{}
+
+func (noControl) WaitIfPaused(ctx context.Context) (time.Duration, bool) { return 0, ctx.Err() == nil }
+func (noControl) AddScheduled(n int)                                     {}
+
+func (c Config) control() Control {
+	if c.Control == nil {
+		return noControl{}
+	}
+	return c.Control
+}
+
+// Result is the outcome of a benchmark run
+type Result struct {
+	StartTime  time.Time
+	EndTime    time.Time
+	Operations int // trip events sent to the workers for inserts, queries scheduled for queries
+	Successes  int
+	Failures   int
+	Aborted    bool // interrupted before all jobs were scheduled, the counts are partial
+}
+
+// workerTotals are the successful and failed operations of a worker
+type workerTotals struct {
+	successes int
+	failures  int
+}
+
+// DrainContext returns the context workers execute their operations with.
+// Once ctx is done, e.g. on SIGINT, it stays valid for drainTimeout so in-flight batches and queries
+// can finish and be recorded, afterwards they are cancelled.
+func DrainContext(ctx context.Context, drainTimeout time.Duration, logger *slog.Logger) (context.Context, context.CancelFunc) {
+	execCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stopAfterFunc := context.AfterFunc(ctx, func() {
+		logger.Warn("Run interrupted, stopped scheduling new jobs and waiting for in-flight operations", "drainTimeout", drainTimeout)
+		time.AfterFunc(drainTimeout, func() {
+			if execCtx.Err() == nil {
+				logger.Warn("Drain timeout exceeded, cancelling in-flight operations", "drainTimeout", drainTimeout)
+			}
+			cancel()
+		})
+	})
+	return execCtx, func() {
+		stopAfterFunc()
+		cancel()
+	}
+}
+
+// WaitForRate paces the batches so on average at most rate events per second are sent to the workers, 0 disables.
+// Returns false if ctx is done while waiting.
+func WaitForRate(ctx context.Context, startTime time.Time, sentEvents int, rate float64) bool {
+	if rate <= 0 {
+		return true
+	}
+	due := startTime.Add(time.Duration(float64(sentEvents) / rate * float64(time.Second)))
+	wait := time.Until(due)
+	if wait <= 0 {
+		return true
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// waitForWorkers waits until all workers reported ready, returning the error of a worker unable to start
+func waitForWorkers(ctx context.Context, logger *slog.Logger, numWorkers int, readyStatus <-chan int, workerErrCh <-chan error) error {
+	workersReady := 0
+	for workersReady < numWorkers {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-workerErrCh:
+			return err
+		case readyWorkerId := <-readyStatus:
+			logger.Debug("Worker reported ready", "id", readyWorkerId)
+			workersReady++
+		}
+	}
+	return nil
+}
+
+// sumTotals collects the totals of all workers once they finished
+func sumTotals(totalsCh chan workerTotals, numWorkers int) (successes int, failures int) {
+	for range numWorkers {
+		t := <-totalsCh
+		successes += t.successes
+		failures += t.failures
+	}
+	return successes, failures
+}
@@ -0,0 +1,424 @@
+package benchmark
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"load-generator/internal/results"
+	"load-generator/internal/workload"
+)
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// sliceSource yields the events of a slice, a *workload.BadRowError for events with the trip ID "bad"
+type sliceSource struct {
+	events []workload.TripEvent
+	closed bool
+}
+
+func (s *sliceSource) Next() (workload.TripEvent, error) {
+	if len(s.events) == 0 {
+		return workload.TripEvent{}, io.EOF
+	}
+	event := s.events[0]
+	s.events = s.events[1:]
+	if event.TripID == "bad" {
+		return workload.TripEvent{}, &workload.BadRowError{Reason: "bad"}
+	}
+	return event, nil
+}
+
+func (s *sliceSource) Close() error {
+	s.closed = true
+	return nil
+}
+
+// fakeTarget inserts every event of a batch but those of the trip "fail" and answers every query but those of the template "fail",
+// after delay. Workers with an ID in unreachable fail to connect.
+type fakeTarget struct {
+	delay       time.Duration
+	unreachable map[int]bool
+
+	mu       sync.Mutex
+	inserted []workload.TripEvent
+	queries  []QueryJob
+	closed   int
+}
+
+type fakeWorker struct {
+	target *fakeTarget
+}
+
+func (t *fakeTarget) NewInserter(ctx context.Context, id int) (Inserter, error) {
+	if t.unreachable[id] {
+		return nil, fmt.Errorf("connection refused")
+	}
+	return fakeWorker{t}, nil
+}
+
+func (t *fakeTarget) NewQuerier(ctx context.Context, id int) (Querier, error) {
+	if t.unreachable[id] {
+		return nil, fmt.Errorf("connection refused")
+	}
+	return fakeWorker{t}, nil
+}
+
+func (w fakeWorker) JobType() string { return "fake" }
+
+func (w fakeWorker) Close() {
+	w.target.mu.Lock()
+	defer w.target.mu.Unlock()
+	w.target.closed++
+}
+
+func (w fakeWorker) Insert(ctx context.Context, batch []workload.TripEvent) InsertOutcome {
+	outcome := InsertOutcome{Start: time.Now()}
+	time.Sleep(w.target.delay)
+	w.target.mu.Lock()
+	defer w.target.mu.Unlock()
+	for _, event := range batch {
+		if event.TripID != "fail" {
+			w.target.inserted = append(w.target.inserted, event)
+			outcome.Inserted++
+		}
+	}
+	outcome.End = time.Now()
+	return outcome
+}
+
+func (w fakeWorker) Query(ctx context.Context, job QueryJob) (QueryOutcome, error) {
+	if job.TemplateName == "unrenderable" {
+		return QueryOutcome{}, fmt.Errorf("template failed")
+	}
+	outcome := QueryOutcome{Start: time.Now(), Successful: true, Rows: 3}
+	time.Sleep(w.target.delay)
+	w.target.mu.Lock()
+	w.target.queries = append(w.target.queries, job)
+	w.target.mu.Unlock()
+	if job.TemplateName == "fail" {
+		outcome.Successful = false
+		outcome.Rows = 0
+		outcome.Err = fmt.Errorf("relation does not exist")
+	}
+	outcome.End = time.Now()
+	return outcome, nil
+}
+
+func tripEvents(tripIDs ...string) []workload.TripEvent {
+	var events []workload.TripEvent
+	for i, tripID := range tripIDs {
+		events = append(events, workload.TripEvent{EventID: fmt.Sprint(i), TripID: tripID})
+	}
+	return events
+}
+
+// tripTenant puts the trips a and b into tenant 1, the others into tenant 2
+func tripTenant(tripID string) int {
+	if tripID < "c" {
+		return 1
+	}
+	return 2
+}
+
+func TestInserts(t *testing.T) {
+	target := &fakeTarget{}
+	source := &sliceSource{events: tripEvents("a", "a", "bad", "b", "fail", "b", "c", "a", "c", "d", "b")}
+	var recorded []results.InsertEvent
+	result, err := Inserts(context.Background(), InsertConfig{
+		Config:     Config{NumWorkers: 3, DrainTimeout: time.Second, Logger: discardLogger},
+		BatchSize:  3,
+		Target:     target,
+		OpenSource: func(ctx context.Context) (workload.TripEventSource, error) { return source, nil },
+		SkipRow: func(err error) bool {
+			var badRow *workload.BadRowError
+			return errors.As(err, &badRow)
+		},
+		Tenant: tripTenant,
+		Record: func(event results.InsertEvent) { recorded = append(recorded, event) },
+	})
+	if err != nil {
+		t.Fatalf("Inserts failed: %v", err)
+	}
+	if result.Aborted {
+		t.Errorf("result is aborted")
+	}
+	if result.Operations != 10 || result.Successes != 9 || result.Failures != 1 {
+		t.Errorf("got %d operations, %d successes, %d failures, want 10, 9, 1", result.Operations, result.Successes, result.Failures)
+	}
+	if len(target.inserted) != 9 {
+		t.Errorf("inserted %d events, want 9", len(target.inserted))
+	}
+	if !source.closed {
+		t.Errorf("source was not closed")
+	}
+	if target.closed != 3 {
+		t.Errorf("closed %d inserters, want 3", target.closed)
+	}
+
+	events := 0
+	for _, event := range recorded {
+		events += event.BatchSize
+		if event.JobType != "fake" {
+			t.Errorf("job type %q, want fake", event.JobType)
+		}
+		if event.WorkerID < 1 || event.WorkerID > 3 {
+			t.Errorf("worker ID %d out of range", event.WorkerID)
+		}
+	}
+	if events != 10 {
+		t.Errorf("recorded batches of %d events, want 10", events)
+	}
+	for _, event := range target.inserted {
+		if want := tripTenant(event.TripID); event.Tenant != want {
+			t.Errorf("event of trip %s has tenant %d, want %d", event.TripID, event.Tenant, want)
+		}
+	}
+}
+
+func TestInsertsStopsAtMalformedRowWithoutSkipRow(t *testing.T) {
+	source := &sliceSource{events: tripEvents("a", "bad", "b")}
+	result, err := Inserts(context.Background(), InsertConfig{
+		Config:     Config{NumWorkers: 2, DrainTimeout: time.Second, Logger: discardLogger},
+		BatchSize:  1,
+		Target:     &fakeTarget{},
+		OpenSource: func(ctx context.Context) (workload.TripEventSource, error) { return source, nil },
+		Record:     func(event results.InsertEvent) {},
+	})
+	var badRow *workload.BadRowError
+	if !errors.As(err, &badRow) {
+		t.Fatalf("got error %v, want the malformed row", err)
+	}
+	if !result.Aborted {
+		t.Errorf("result is not aborted")
+	}
+}
+
+func TestInsertsWorkerUnableToConnect(t *testing.T) {
+	opened := false
+	_, err := Inserts(context.Background(), InsertConfig{
+		Config:    Config{NumWorkers: 3, DrainTimeout: time.Second, Logger: discardLogger},
+		BatchSize: 1,
+		Target:    &fakeTarget{unreachable: map[int]bool{2: true}},
+		OpenSource: func(ctx context.Context) (workload.TripEventSource, error) {
+			opened = true
+			return &sliceSource{}, nil
+		},
+		Record: func(event results.InsertEvent) {},
+	})
+	if err == nil || !strings.Contains(err.Error(), "Worker 2") {
+		t.Fatalf("got error %v, want the one of worker 2", err)
+	}
+	if opened {
+		t.Errorf("source was opened although a worker failed to start")
+	}
+}
+
+func TestInsertsInterrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	events := tripEvents(strings.Split(strings.Repeat("a,", 1000), ",")[:1000]...)
+	recorded := 0
+	result, err := Inserts(ctx, InsertConfig{
+		Config:     Config{NumWorkers: 2, DrainTimeout: time.Second, Logger: discardLogger},
+		BatchSize:  10,
+		Target:     &fakeTarget{delay: time.Millisecond},
+		OpenSource: func(ctx context.Context) (workload.TripEventSource, error) { return &sliceSource{events: events}, nil },
+		Record: func(event results.InsertEvent) {
+			recorded++
+			if recorded == 5 {
+				cancel()
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("Inserts failed: %v", err)
+	}
+	if !result.Aborted {
+		t.Errorf("result is not aborted")
+	}
+	if result.Operations >= len(events) {
+		t.Errorf("sent all %d events although interrupted", result.Operations)
+	}
+	// the batches in flight when interrupted are drained, not counted as failed
+	if result.Failures != 0 || result.Successes != recorded*10 {
+		t.Errorf("got %d successes and %d failures for %d recorded batches", result.Successes, result.Failures, recorded)
+	}
+}
+
+func TestQueries(t *testing.T) {
+	target := &fakeTarget{}
+	var recorded []results.QueryEvent
+	result, err := Queries(context.Background(), QueryConfig{
+		Config:        Config{NumWorkers: 4, DrainTimeout: time.Second, Logger: discardLogger},
+		NumQueries:    12,
+		TemplateNames: []string{"ok", "fail", "unrenderable"},
+		Fields:        func(i int) workload.QueryFields { return workload.QueryFields{TenantID: i} },
+		Target:        target,
+		Record:        func(event results.QueryEvent) { recorded = append(recorded, event) },
+	})
+	if err != nil {
+		t.Fatalf("Queries failed: %v", err)
+	}
+	// the unrenderable queries are scheduled, but neither executed nor recorded
+	if result.Operations != 12 || result.Successes != 4 || result.Failures != 4 {
+		t.Errorf("got %d operations, %d successes, %d failures, want 12, 4, 4", result.Operations, result.Successes, result.Failures)
+	}
+	if len(recorded) != 8 {
+		t.Fatalf("recorded %d queries, want 8", len(recorded))
+	}
+	for _, event := range recorded {
+		if event.Successful != (event.TemplateName == "ok") {
+			t.Errorf("query of template %s has successful %v", event.TemplateName, event.Successful)
+		}
+		if event.TemplateName == "fail" && event.ErrorMsg != "relation does not exist" {
+			t.Errorf("failed query has error %q", event.ErrorMsg)
+		}
+		if event.TemplateName == "ok" && event.ResultingRowsCount != 3 {
+			t.Errorf("query has %d resulting rows, want 3", event.ResultingRowsCount)
+		}
+	}
+	// the i-th query uses the i-th fields and the templates in turn
+	for _, job := range target.queries {
+		want := []string{"ok", "fail", "unrenderable"}[job.Fields.TenantID%3]
+		if job.TemplateName != want {
+			t.Errorf("query %d used template %s, want %s", job.Fields.TenantID, job.TemplateName, want)
+		}
+	}
+}
+
+func TestQueriesRecordInWorkers(t *testing.T) {
+	// the workers record their queries concurrently, run with -race
+	var mu sync.Mutex
+	recorded := make(map[int]int) // queries per worker
+	result, err := Queries(context.Background(), QueryConfig{
+		Config:          Config{NumWorkers: 4, DrainTimeout: time.Second, Logger: discardLogger},
+		NumQueries:      100,
+		TemplateNames:   []string{"ok"},
+		Fields:          func(i int) workload.QueryFields { return workload.QueryFields{} },
+		Target:          &fakeTarget{delay: 100 * time.Microsecond},
+		RecordInWorkers: true,
+		Record: func(event results.QueryEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			recorded[event.WorkerID]++
+		},
+	})
+	if err != nil {
+		t.Fatalf("Queries failed: %v", err)
+	}
+	total := 0
+	for _, n := range recorded {
+		total += n
+	}
+	if result.Successes != 100 || total != 100 {
+		t.Errorf("got %d successes and %d recorded queries, want 100", result.Successes, total)
+	}
+}
+
+// pausedControl is paused until the context is done
+type pausedControl struct {
+	scheduled int
+}
+
+func (c *pausedControl) WaitIfPaused(ctx context.Context) (time.Duration, bool) {
+	<-ctx.Done()
+	return 0, false
+}
+
+func (c *pausedControl) AddScheduled(n int) { c.scheduled += n }
+
+func TestQueriesPausedUntilInterrupted(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	control := &pausedControl{}
+	target := &fakeTarget{}
+	result, err := Queries(ctx, QueryConfig{
+		Config:        Config{NumWorkers: 2, DrainTimeout: time.Second, Control: control, Logger: discardLogger},
+		NumQueries:    10,
+		TemplateNames: []string{"ok"},
+		Fields:        func(i int) workload.QueryFields { return workload.QueryFields{} },
+		Target:        target,
+		Record:        func(event results.QueryEvent) {},
+	})
+	if err != nil {
+		t.Fatalf("Queries failed: %v", err)
+	}
+	if !result.Aborted || result.Operations != 0 || control.scheduled != 0 || len(target.queries) != 0 {
+		t.Errorf("paused run scheduled %d queries, executed %d, aborted %v", result.Operations, len(target.queries), result.Aborted)
+	}
+}
+
+// instantTarget answers every query at once, so the benchmark measures the path of the results from the workers into the CSV
+type instantTarget struct{}
+
+func (instantTarget) NewQuerier(ctx context.Context, id int) (Querier, error) {
+	return instantTarget{}, nil
+}
+func (instantTarget) JobType() string { return "query" }
+func (instantTarget) Close()          {}
+
+func (instantTarget) Query(ctx context.Context, job QueryJob) (QueryOutcome, error) {
+	now := time.Now()
+	return QueryOutcome{Start: now, End: now, Successful: true, Rows: 1}, nil
+}
+
+// BenchmarkQueriesRecording compares writing the results CSV by the single recording goroutine to every worker writing
+// a shard of its own, like -result-shards. The numbers in Documentation.md come from
+//
+//	go test ./internal/benchmark -run '^$' -bench QueriesRecording -benchtime 2000000x -cpu 1,4
+func BenchmarkQueriesRecording(b *testing.B) {
+	for _, numWorkers := range []int{24, 256} {
+		for _, inWorkers := range []bool{false, true} {
+			name := fmt.Sprintf("workers=%d/single-writer", numWorkers)
+			if inWorkers {
+				name = fmt.Sprintf("workers=%d/shards", numWorkers)
+			}
+			b.Run(name, func(b *testing.B) {
+				writers := make([]*results.CSVWriter, 1)
+				if inWorkers {
+					writers = make([]*results.CSVWriter, numWorkers)
+				}
+				for i := range writers {
+					file, err := os.Create(filepath.Join(b.TempDir(), fmt.Sprintf("results%d.csv", i)))
+					if err != nil {
+						b.Fatal(err)
+					}
+					writers[i] = results.NewCSVWriter(file, time.Second, 0)
+				}
+				cfg := QueryConfig{
+					Config:          Config{NumWorkers: numWorkers, DrainTimeout: time.Second, Logger: discardLogger},
+					NumQueries:      b.N,
+					TemplateNames:   []string{"q1", "q2"},
+					Fields:          func(i int) workload.QueryFields { return workload.QueryFields{} },
+					Target:          instantTarget{},
+					RecordInWorkers: inWorkers,
+					Record: func(event results.QueryEvent) {
+						w := writers[0]
+						if inWorkers {
+							w = writers[event.WorkerID-1]
+						}
+						if err := w.Write(event.CSVRecord("run")); err != nil {
+							b.Error(err)
+						}
+					},
+				}
+				b.ResetTimer()
+				if _, err := Queries(context.Background(), cfg); err != nil {
+					b.Fatal(err)
+				}
+				b.StopTimer()
+				for _, w := range writers {
+					w.Close()
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package benchmark
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"load-generator/internal/results"
+	"load-generator/internal/workload"
+)
+
+// InsertTarget creates the inserters of the workers, e.g. a database connection per worker
+type InsertTarget interface {
+	NewInserter(ctx context.Context, workerID int) (Inserter, error)
+}
+
+// Inserter inserts the batches of one worker
+type Inserter interface {
+	// Insert inserts the batch, the outcome's start time excludes preparations like reconnecting
+	Insert(ctx context.Context, batch []workload.TripEvent) InsertOutcome
+	JobType() string
+	Close()
+}
+
+type InsertOutcome struct {
+	Start     time.Time
+	End       time.Time
+	Inserted  int
+	Reconnect time.Duration // spent reconnecting before the insert
+}
+
+type InsertConfig struct {
+	Config
+	BatchSize     int
+	UseBulkInsert bool    // recorded in the events
+	Rate          float64 // events per second sent to the workers, 0 sends them as fast as the workers take them
+	Target        InsertTarget
+	// OpenSource opens the trip events once all workers are ready
+	OpenSource func(ctx context.Context) (workload.TripEventSource, error)
+	// SkipRow reports whether a malformed row of the source is skipped, nil stops at the first one
+	SkipRow func(err error) bool
+	// Tenant returns the tenant of a trip, the events of a batch belong to one tenant. Nil puts all events into tenant 0.
+	Tenant func(tripID string) int
+	// Record is called for every finished batch by a single goroutine the workers send it to,
+	// or by the worker which finished it with RecordInWorkers
+	Record func(event results.InsertEvent)
+	// RecordInWorkers lets the workers call Record concurrently instead of sending the events to the single recording goroutine,
+	// which limits the throughput at high worker counts
+	RecordInWorkers bool
+}
+
+// Inserts sends the events of the source in batches to the workers until all are sent or ctx is done
+func Inserts(ctx context.Context, cfg InsertConfig) (Result, error) {
+	logger := cfg.Logger
+	control := cfg.control()
+	aborted := Result{Aborted: true}
+
+	// create specified number of workers, they stop taking jobs once jobsCtx is done
+	// and finish their in-flight batches with execCtx
+	jobsCtx, stopJobs := context.WithCancel(ctx)
+	defer stopJobs()
+	execCtx, cancelWorkers := DrainContext(jobsCtx, cfg.DrainTimeout, logger)
+	defer cancelWorkers()
+	var wg sync.WaitGroup
+	readyStatus := make(chan int, cfg.NumWorkers)
+	workerErrCh := make(chan error, cfg.NumWorkers)
+	jobs := make(chan []workload.TripEvent, cfg.NumWorkers*2) // batches of events
+	totalsCh := make(chan workerTotals, cfg.NumWorkers)
+	eventCh := make(chan results.InsertEvent, cfg.NumWorkers*10)
+	for i := 1; i <= cfg.NumWorkers; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			insertWorker(jobsCtx, execCtx, id, jobs, cfg, totalsCh, eventCh, readyStatus, workerErrCh)
+		}(i)
+	}
+	logger.Info("Started worker threads", "numWorkers", cfg.NumWorkers)
+
+	// records the events of the workers, unless they record them themselves
+	var recordWg sync.WaitGroup
+	if !cfg.RecordInWorkers {
+		recordWg.Add(1)
+		go func() {
+			defer recordWg.Done()
+			for event := range eventCh {
+				cfg.Record(event)
+			}
+		}()
+	}
+
+	// stops the workers and the recording when the benchmark can't continue
+	abort := func(err error) (Result, error) {
+		cancelWorkers()
+		stopJobs()
+		wg.Wait()
+		close(eventCh)
+		recordWg.Wait()
+		return aborted, err
+	}
+
+	if err := waitForWorkers(ctx, logger, cfg.NumWorkers, readyStatus, workerErrCh); err != nil {
+		return abort(err)
+	}
+
+	r, err := cfg.OpenSource(ctx)
+	if err != nil {
+		return abort(err)
+	}
+	defer r.Close()
+
+	// read the trips and send batches to workers until all are sent or the run is interrupted
+	startTime := time.Now()
+	rateStartTime := startTime // shifted by the time the run was paused
+	tripEventsCount := 0       // events sent to the workers
+	// the events of a batch belong to one tenant, without tenants all events are of tenant 0
+	batches := make(map[int][]workload.TripEvent)
+
+Feeding:
+	for ctx.Err() == nil {
+		tripEvent, err := r.Next()
+		if err == io.EOF {
+			// Send remaining batches if not empty
+			for _, tenant := range slices.Sorted(maps.Keys(batches)) {
+				batch := batches[tenant]
+				if len(batch) == 0 || !WaitForRate(ctx, rateStartTime, tripEventsCount, cfg.Rate) {
+					continue
+				}
+				select {
+				case <-ctx.Done():
+				case jobs <- batch:
+					tripEventsCount += len(batch)
+					control.AddScheduled(len(batch))
+				}
+			}
+			break
+		} else if err != nil && cfg.SkipRow != nil && cfg.SkipRow(err) {
+			continue
+		} else if err != nil {
+			return abort(err)
+		}
+
+		if cfg.Tenant != nil {
+			tripEvent.Tenant = cfg.Tenant(tripEvent.TripID)
+		}
+		batch := append(batches[tripEvent.Tenant], tripEvent)
+		batches[tripEvent.Tenant] = batch
+
+		// Send batch when full
+		if len(batch) >= cfg.BatchSize {
+			paused, ok := control.WaitIfPaused(ctx)
+			rateStartTime = rateStartTime.Add(paused)
+			if !ok || !WaitForRate(ctx, rateStartTime, tripEventsCount, cfg.Rate) {
+				break Feeding
+			}
+			select {
+			case <-ctx.Done():
+				break Feeding
+			case jobs <- batch:
+				tripEventsCount += len(batch)
+				control.AddScheduled(len(batch))
+			}
+			batches[tripEvent.Tenant] = make([]workload.TripEvent, 0, cfg.BatchSize)
+		}
+
+		if tripEventsCount%10000 == 0 && len(batches[tripEvent.Tenant]) == 0 {
+			logger.Info("Insert progress", "totalInsertedToJobQueue", tripEventsCount, "timeElapsedInSec", time.Since(startTime).Seconds())
+		}
+	}
+
+	// workers drain their in-flight batches, jobs still in the queue are dropped if interrupted
+	close(jobs)
+	wg.Wait()
+
+	// Close event channel and wait for the recording to finish
+	close(eventCh)
+	recordWg.Wait()
+
+	totalSuccesses, totalFailures := sumTotals(totalsCh, cfg.NumWorkers)
+	return Result{
+		StartTime:  startTime,
+		EndTime:    time.Now(),
+		Operations: tripEventsCount,
+		Successes:  totalSuccesses,
+		Failures:   totalFailures,
+		Aborted:    ctx.Err() != nil,
+	}, nil
+}
+
+// each worker should measure and log all available metrics
+//   - whether the insert was sucessful
+//   - the time it took to insert (if provided in the response)
+//   - the latency of getting a response
+//   - time spend waiting for receiving the next job through channel
+func insertWorker(ctx, execCtx context.Context, id int, tripEventBatches <-chan []workload.TripEvent, cfg InsertConfig, totalsCh chan<- workerTotals, eventCh chan<- results.InsertEvent, readyStatus chan<- int, errCh chan<- error) {
+	logger := cfg.Logger
+	logger.Debug("Worker started", "id", id)
+
+	insertedByWorker := 0
+	failedInsertsByWorker := 0
+	defer func() {
+		totalsCh <- workerTotals{successes: insertedByWorker, failures: failedInsertsByWorker}
+	}()
+
+	inserter, err := cfg.Target.NewInserter(execCtx, id)
+	if err != nil {
+		errCh <- fmt.Errorf("Worker %d unable to start: %w", id, err)
+		return
+	}
+	defer inserter.Close()
+	jobType := inserter.JobType()
+
+	readyStatus <- id
+
+	defer func() {
+		logger.Info(
+			"Insert worker finished",
+			"id", id,
+			"insertedEvents", insertedByWorker,
+			"failedInserts", failedInsertsByWorker,
+			"ctxErr", ctx.Err(),
+		)
+	}()
+
+	lastJobFinishTime := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("Worker finished because the passed context is marked as done", "id", id)
+			return
+		case batch, ok := <-tripEventBatches:
+			if !ok || ctx.Err() != nil {
+				return
+			}
+
+			logger.Debug("Worker: batch received, inserting into db...", "id", id, "batchSize", len(batch))
+
+			waitedForJobTime := time.Since(lastJobFinishTime)
+			batchSize := len(batch)
+			outcome := inserter.Insert(execCtx, batch)
+
+			// Record the event or send it to the recording goroutine for logging and CSV writing
+			event := results.InsertEvent{
+				WorkerID:             id,
+				JobType:              jobType,
+				BatchSize:            batchSize,
+				UseBulkInsert:        cfg.UseBulkInsert,
+				StartTime:            outcome.Start.Format(time.RFC3339Nano),
+				EndTime:              outcome.End.Format(time.RFC3339Nano),
+				InsertDurationUs:     outcome.End.Sub(outcome.Start).Microseconds(),
+				WaitedForJobTimeUs:   waitedForJobTime.Microseconds(),
+				SuccessfullyInserted: outcome.Inserted,
+				FailedInserts:        batchSize - outcome.Inserted,
+				StartMonotonicUs:     results.MonotonicUs(outcome.Start),
+				EndMonotonicUs:       results.MonotonicUs(outcome.End),
+				ReconnectUs:          outcome.Reconnect.Microseconds(),
+				Tenant:               batch[0].Tenant,
+			}
+			if cfg.RecordInWorkers {
+				cfg.Record(event)
+			} else {
+				eventCh <- event
+			}
+
+			insertedByWorker += outcome.Inserted
+			failedInsertsByWorker += batchSize - outcome.Inserted
+
+			lastJobFinishTime = time.Now()
+		}
+	}
+}
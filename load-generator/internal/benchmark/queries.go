@@ -0,0 +1,233 @@
+package benchmark
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"load-generator/internal/results"
+	"load-generator/internal/workload"
+)
+
+type QueryJob struct {
+	TemplateName string
+	Fields       workload.QueryFields
+}
+
+// QueryTarget creates the queriers of the workers, e.g. a database connection per worker
+type QueryTarget interface {
+	NewQuerier(ctx context.Context, workerID int) (Querier, error)
+}
+
+// Querier executes the queries of one worker
+type Querier interface {
+	// Query executes the job, the outcome's start time excludes preparations like rendering the template and reconnecting.
+	// An error means the job couldn't be executed at all, e.g. as its template fails to render, it is skipped without an event.
+	Query(ctx context.Context, job QueryJob) (QueryOutcome, error)
+	JobType() string
+	Close()
+}
+
+type QueryOutcome struct {
+	Start      time.Time
+	End        time.Time
+	Successful bool
+	Rows       int           // resulting rows of the query
+	Reconnect  time.Duration // spent reconnecting before the query
+	Err        error         // of the failed query
+}
+
+type QueryConfig struct {
+	Config
+	NumQueries int
+	// the queries use the templates in turn
+	TemplateNames []string
+	// Fields returns the fields of the i-th query
+	Fields func(i int) workload.QueryFields
+	Target QueryTarget
+	// Record is called for every finished query by a single goroutine the workers send it to,
+	// or by the worker which finished it with RecordInWorkers
+	Record func(event results.QueryEvent)
+	// RecordInWorkers lets the workers call Record concurrently instead of sending the events to the single recording goroutine,
+	// which limits the throughput at high worker counts
+	RecordInWorkers bool
+}
+
+// Queries schedules the queries to the workers until all are scheduled or ctx is done
+func Queries(ctx context.Context, cfg QueryConfig) (Result, error) {
+	logger := cfg.Logger
+	control := cfg.control()
+	aborted := Result{Aborted: true}
+	if len(cfg.TemplateNames) == 0 {
+		return aborted, fmt.Errorf("No query templates")
+	}
+
+	// Start workers, they stop taking jobs once jobsCtx is done and finish their in-flight queries with execCtx
+	jobsCtx, stopJobs := context.WithCancel(ctx)
+	defer stopJobs()
+	execCtx, cancelWorkers := DrainContext(jobsCtx, cfg.DrainTimeout, logger)
+	defer cancelWorkers()
+	readyStatus := make(chan int, cfg.NumWorkers)
+	workerErrCh := make(chan error, cfg.NumWorkers)
+	jobs := make(chan QueryJob, runtime.NumCPU()*100) // larger buffer to combat workers waiting for main thread to generate the fields
+	totalsCh := make(chan workerTotals, cfg.NumWorkers)
+	eventCh := make(chan results.QueryEvent, cfg.NumWorkers*10)
+	var wg sync.WaitGroup
+	for i := 1; i <= cfg.NumWorkers; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			queryWorker(jobsCtx, execCtx, id, jobs, cfg, totalsCh, eventCh, readyStatus, workerErrCh)
+		}(i)
+	}
+	logger.Info("Started query worker threads", "numWorkers", cfg.NumWorkers)
+
+	// records the events of the workers, unless they record them themselves
+	var recordWg sync.WaitGroup
+	if !cfg.RecordInWorkers {
+		recordWg.Add(1)
+		go func() {
+			defer recordWg.Done()
+			for event := range eventCh {
+				cfg.Record(event)
+			}
+		}()
+	}
+
+	if err := waitForWorkers(ctx, logger, cfg.NumWorkers, readyStatus, workerErrCh); err != nil {
+		cancelWorkers()
+		stopJobs()
+		wg.Wait()
+		close(eventCh)
+		recordWg.Wait()
+		return aborted, err
+	}
+
+	// Schedule the queries until all are scheduled or the run is interrupted
+	startTime := time.Now()
+	scheduledQueries := 0
+Scheduling:
+	for i := range cfg.NumQueries {
+		job := QueryJob{Fields: cfg.Fields(i), TemplateName: cfg.TemplateNames[i%len(cfg.TemplateNames)]}
+		if _, ok := control.WaitIfPaused(ctx); !ok {
+			break Scheduling
+		}
+		select {
+		case <-ctx.Done():
+			break Scheduling
+		case jobs <- job:
+		}
+		scheduledQueries++
+		control.AddScheduled(1)
+
+		if i%1000 == 0 {
+			logger.Info("Query progress", "queriesAddedToQueue", i+1, "timeElapsedInSec", time.Since(startTime).Seconds())
+		}
+	}
+	// workers drain their in-flight queries, jobs still in the queue are dropped if interrupted
+	close(jobs)
+	wg.Wait()
+
+	// Close event channel and wait for the recording to finish
+	close(eventCh)
+	recordWg.Wait()
+
+	totalSuccesses, totalFailures := sumTotals(totalsCh, cfg.NumWorkers)
+	return Result{
+		StartTime:  startTime,
+		EndTime:    time.Now(),
+		Operations: scheduledQueries,
+		Successes:  totalSuccesses,
+		Failures:   totalFailures,
+		Aborted:    ctx.Err() != nil,
+	}, nil
+}
+
+// queryWorker executes queries
+func queryWorker(ctx, execCtx context.Context, id int, jobs <-chan QueryJob, cfg QueryConfig, totalsCh chan<- workerTotals, eventCh chan<- results.QueryEvent, readyStatus chan<- int, errCh chan<- error) {
+	logger := cfg.Logger
+	logger.Debug("Query worker started", "id", id)
+
+	queryIndex := -1
+	successfulQueries := 0
+	failedQueries := 0
+	defer func() {
+		totalsCh <- workerTotals{successes: successfulQueries, failures: failedQueries}
+	}()
+
+	querier, err := cfg.Target.NewQuerier(execCtx, id)
+	if err != nil {
+		errCh <- fmt.Errorf("Query worker %d unable to start: %w", id, err)
+		return
+	}
+	defer querier.Close()
+	jobType := querier.JobType()
+
+	readyStatus <- id
+
+	defer func() {
+		logger.Info(
+			"Query worker finished",
+			"id", id,
+			"executedQueries", queryIndex+1,
+			"successfulQueries", successfulQueries,
+			"failedQueries", failedQueries,
+			"ctxErr", ctx.Err(),
+			"usedTemplates", len(cfg.TemplateNames),
+		)
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job, ok := <-jobs:
+			if !ok || ctx.Err() != nil {
+				return
+			}
+			queryIndex++
+
+			outcome, err := querier.Query(execCtx, job)
+			if err != nil {
+				logger.Debug("Query worker skipped the query", "id", id, "template", job.TemplateName, "error", err)
+				continue
+			}
+			if outcome.Successful {
+				successfulQueries++
+			} else {
+				failedQueries++
+			}
+
+			// Prepare error message
+			var errorMsg string
+			if outcome.Err != nil {
+				errorMsg = outcome.Err.Error()
+			}
+
+			// Record the event or send it to the recording goroutine for logging and CSV writing
+			event := results.QueryEvent{
+				WorkerID:           id,
+				JobType:            jobType,
+				TemplateName:       job.TemplateName,
+				QueryDurationUs:    outcome.End.Sub(outcome.Start).Microseconds(),
+				StartTime:          outcome.Start.Format(time.RFC3339Nano),
+				EndTime:            outcome.End.Format(time.RFC3339Nano),
+				Successful:         outcome.Successful,
+				ResultingRowsCount: outcome.Rows,
+				QueryIndex:         queryIndex,
+				ErrorMsg:           errorMsg,
+				StartMonotonicUs:   results.MonotonicUs(outcome.Start),
+				EndMonotonicUs:     results.MonotonicUs(outcome.End),
+				ReconnectUs:        outcome.Reconnect.Microseconds(),
+				Tenant:             job.Fields.TenantID,
+			}
+			if cfg.RecordInWorkers {
+				cfg.Record(event)
+			} else {
+				eventCh <- event
+			}
+		}
+	}
+}
@@ -0,0 +1,247 @@
+// Package cluster implements the gRPC service loadgen.v1.Coordinator, which distributes a load run
+// over agents on several hosts and collects their results. It has two methods:
+//
+//	rpc Register(RegisterRequest) returns (Assignment);
+//	rpc Report(stream AgentReport) returns (ReportResponse);
+//
+// Register blocks until all agents registered and returns the agent's share of the run. The first message of Report
+// carries the report, the results CSV follows in the results_csv of further messages in chunks of at most 1 MiB.
+// The messages are encoded by hand with internal/protobuf in the proto3 encoding of the definitions on their types,
+// there are no .proto files or generated code. ReportResponse is empty.
+package cluster
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"load-generator/internal/grpc"
+	"load-generator/internal/protobuf"
+)
+
+const (
+	methodRegister = "/loadgen.v1.Coordinator/Register"
+	methodReport   = "/loadgen.v1.Coordinator/Report"
+)
+
+// reportChunkSize is the size of the chunks the results CSV of a report is streamed in
+const reportChunkSize = 1 << 20
+
+// RegisterRequest is the request of Register
+//
+//	message RegisterRequest {
+//	  string hostname = 1;
+//	}
+type RegisterRequest struct {
+	Hostname string
+}
+
+// Assignment is the share of an agent in the run, the command and its arguments to execute
+//
+//	message Assignment {
+//	  uint32 agent_index = 1; // 0-based
+//	  uint32 num_agents = 2;
+//	  string run_id = 3;
+//	  string command = 4; // insert or query
+//	  repeated string args = 5;
+//	}
+type Assignment struct {
+	AgentIndex int
+	NumAgents  int
+	RunID      string
+	Command    string
+	Args       []string
+}
+
+// AgentReport is the outcome of an agent's run, the results CSV and summary JSON are empty if the run wrote none
+//
+//	message AgentReport {
+//	  uint32 agent_index = 1;
+//	  string hostname = 2;
+//	  int32 exit_code = 3;
+//	  string results_filename = 4;
+//	  bytes results_csv = 5;
+//	  bytes summary_json = 6;
+//	}
+type AgentReport struct {
+	AgentIndex      int
+	Hostname        string
+	ExitCode        int
+	ResultsFilename string
+	ResultsCSV      []byte
+	SummaryJSON     []byte
+}
+
+func (r RegisterRequest) marshal() []byte {
+	var e protobuf.Encoder
+	e.String(1, r.Hostname)
+	return e.Message()
+}
+
+func (r *RegisterRequest) unmarshal(b []byte) error {
+	return protobuf.EachField(b, func(f protobuf.Field) error {
+		if f.Num == 1 {
+			r.Hostname = f.String()
+		}
+		return nil
+	})
+}
+
+func (a Assignment) marshal() []byte {
+	var e protobuf.Encoder
+	e.Uint(1, uint64(a.AgentIndex))
+	e.Uint(2, uint64(a.NumAgents))
+	e.String(3, a.RunID)
+	e.String(4, a.Command)
+	e.Strings(5, a.Args)
+	return e.Message()
+}
+
+func (a *Assignment) unmarshal(b []byte) error {
+	return protobuf.EachField(b, func(f protobuf.Field) error {
+		switch f.Num {
+		case 1:
+			a.AgentIndex = int(f.Uint())
+		case 2:
+			a.NumAgents = int(f.Uint())
+		case 3:
+			a.RunID = f.String()
+		case 4:
+			a.Command = f.String()
+		case 5:
+			a.Args = append(a.Args, f.String())
+		}
+		return nil
+	})
+}
+
+func (r AgentReport) marshal() []byte {
+	var e protobuf.Encoder
+	e.Uint(1, uint64(r.AgentIndex))
+	e.String(2, r.Hostname)
+	e.Int(3, int64(int32(r.ExitCode)))
+	e.String(4, r.ResultsFilename)
+	e.Bytes(5, r.ResultsCSV)
+	e.Bytes(6, r.SummaryJSON)
+	return e.Message()
+}
+
+func (r *AgentReport) unmarshal(b []byte) error {
+	return protobuf.EachField(b, func(f protobuf.Field) error {
+		switch f.Num {
+		case 1:
+			r.AgentIndex = int(f.Uint())
+		case 2:
+			r.Hostname = f.String()
+		case 3:
+			r.ExitCode = int(int32(f.Int()))
+		case 4:
+			r.ResultsFilename = f.String()
+		case 5:
+			r.ResultsCSV = f.Bytes()
+		case 6:
+			r.SummaryJSON = f.Bytes()
+		}
+		return nil
+	})
+}
+
+// Coordinator is the server side of the service
+type Coordinator interface {
+	Register(ctx context.Context, req RegisterRequest) (Assignment, error)
+	Report(ctx context.Context, report AgentReport) error
+}
+
+// NewHandler serves the methods of the coordinator
+func NewHandler(c Coordinator) http.Handler {
+	s := grpc.NewServer()
+	s.Handle(methodRegister, func(ctx context.Context, b []byte) ([]byte, error) {
+		var req RegisterRequest
+		if err := req.unmarshal(b); err != nil {
+			return nil, grpc.Errorf(grpc.CodeInvalidArgument, "%v", err)
+		}
+		a, err := c.Register(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		return a.marshal(), nil
+	})
+	s.HandleStream(methodReport, func(ctx context.Context, recv func() ([]byte, error)) ([]byte, error) {
+		var report AgentReport
+		for i := 0; ; i++ {
+			b, err := recv()
+			if err == io.EOF && i == 0 {
+				return nil, grpc.Errorf(grpc.CodeInvalidArgument, "report without message")
+			} else if err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+			var part AgentReport
+			if err := part.unmarshal(b); err != nil {
+				return nil, grpc.Errorf(grpc.CodeInvalidArgument, "%v", err)
+			}
+			if i == 0 {
+				report = part
+			} else {
+				report.ResultsCSV = append(report.ResultsCSV, part.ResultsCSV...)
+			}
+		}
+		if err := c.Report(ctx, report); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	})
+	return s
+}
+
+// Client calls the coordinator at host:port
+type Client struct {
+	conn *grpc.Client
+}
+
+func NewClient(addr string) *Client {
+	return &Client{conn: grpc.NewClient(addr)}
+}
+
+func (c *Client) Register(ctx context.Context, req RegisterRequest) (Assignment, error) {
+	var a Assignment
+	b, err := c.conn.Invoke(ctx, methodRegister, req.marshal())
+	if err != nil {
+		return a, err
+	}
+	return a, a.unmarshal(b)
+}
+
+// Report streams the report followed by the results CSV read from resultsCSV in chunks, nil if there is none.
+// The ResultsCSV of the report isn't sent.
+func (c *Client) Report(ctx context.Context, report AgentReport, resultsCSV io.Reader) error {
+	// canceling the call keeps a report whose results couldn't be read completely from being received
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream := c.conn.NewStream(ctx, methodReport)
+	report.ResultsCSV = nil
+	if err := stream.Send(report.marshal()); err != nil {
+		return err
+	}
+	if resultsCSV != nil {
+		chunk := make([]byte, reportChunkSize)
+		for {
+			n, err := io.ReadFull(resultsCSV, chunk)
+			if n > 0 {
+				if err := stream.Send(AgentReport{ResultsCSV: chunk[:n]}.marshal()); err != nil {
+					return err
+				}
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			} else if err != nil {
+				cancel()
+				stream.CloseAndRecv()
+				return err
+			}
+		}
+	}
+	_, err := stream.CloseAndRecv()
+	return err
+}
@@ -0,0 +1,192 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"load-generator/internal/grpc"
+)
+
+// The golden bytes are those protoc-generated code writes for the message definitions on the types,
+// derived field by field from the protobuf encoding specification.
+
+var goldenMessages = []struct {
+	name    string
+	message interface{ marshal() []byte }
+	bytes   []byte
+}{
+	{"RegisterRequest", RegisterRequest{Hostname: "agent-1"}, []byte{0x0a, 0x07, 'a', 'g', 'e', 'n', 't', '-', '1'}},
+	{"empty RegisterRequest", RegisterRequest{}, nil},
+	{"Assignment", Assignment{AgentIndex: 0, NumAgents: 3, RunID: "run", Command: "insert", Args: []string{"-a", "", "b"}}, []byte{
+		// agent_index 0 is omitted
+		0x10, 0x03, // num_agents
+		0x1a, 0x03, 'r', 'u', 'n', // run_id
+		0x22, 0x06, 'i', 'n', 's', 'e', 'r', 't', // command
+		0x2a, 0x02, '-', 'a', 0x2a, 0x00, 0x2a, 0x01, 'b', // args
+	}},
+	{"AgentReport", AgentReport{AgentIndex: 2, Hostname: "h1", ExitCode: -1, ResultsFilename: "r.csv", ResultsCSV: []byte("a,b\n"), SummaryJSON: []byte("{}")}, []byte{
+		0x08, 0x02, // agent_index
+		0x12, 0x02, 'h', '1', // hostname
+		0x18, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01, // exit_code, a negative int32 takes ten bytes
+		0x22, 0x05, 'r', '.', 'c', 's', 'v', // results_filename
+		0x2a, 0x04, 'a', ',', 'b', '\n', // results_csv
+		0x32, 0x02, '{', '}', // summary_json
+	}},
+}
+
+func TestMarshal(t *testing.T) {
+	for _, tt := range goldenMessages {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.message.marshal(); !bytes.Equal(got, tt.bytes) {
+				t.Errorf("marshal =\n% x\nwant\n% x", got, tt.bytes)
+			}
+		})
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	for _, tt := range goldenMessages {
+		t.Run(tt.name, func(t *testing.T) {
+			// fields of newer versions of the messages are skipped
+			b := append(bytes.Clone(tt.bytes), 0xa0, 0x06, 0x01)
+			var got any
+			var err error
+			switch tt.message.(type) {
+			case RegisterRequest:
+				var m RegisterRequest
+				err = m.unmarshal(b)
+				got = m
+			case Assignment:
+				var m Assignment
+				err = m.unmarshal(b)
+				got = m
+			case AgentReport:
+				var m AgentReport
+				err = m.unmarshal(b)
+				got = m
+			}
+			if err != nil {
+				t.Fatalf("unmarshal failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.message) {
+				t.Errorf("unmarshal = %+v, want %+v", got, tt.message)
+			}
+		})
+	}
+
+	var report AgentReport
+	if err := report.unmarshal([]byte{0x2a, 0x10, 'a'}); err == nil {
+		t.Errorf("unmarshal of a truncated report succeeded")
+	}
+}
+
+// fakeCoordinator assigns the agents in the order they register and keeps the reports
+type fakeCoordinator struct {
+	mu      sync.Mutex
+	agents  int
+	reports []AgentReport
+}
+
+func (c *fakeCoordinator) Register(ctx context.Context, req RegisterRequest) (Assignment, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.agents++
+	return Assignment{AgentIndex: c.agents - 1, NumAgents: 2, RunID: "run", Command: "insert", Args: []string{req.Hostname}}, nil
+}
+
+func (c *fakeCoordinator) Report(ctx context.Context, report AgentReport) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, r := range c.reports {
+		if r.AgentIndex == report.AgentIndex {
+			return grpc.Errorf(grpc.CodeFailedPrecondition, "agent %d already reported, 100%% done", report.AgentIndex+1)
+		}
+	}
+	c.reports = append(c.reports, report)
+	return nil
+}
+
+func startCoordinator(t *testing.T, c Coordinator) *Client {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewHTTPServer(ln.Addr().String(), NewHandler(c))
+	go server.Serve(ln)
+	t.Cleanup(func() { server.Close() })
+	return NewClient(ln.Addr().String())
+}
+
+// failingReader fails after returning its data
+type failingReader struct {
+	data []byte
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, errors.New("disk failure")
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestClient(t *testing.T) {
+	coordinator := &fakeCoordinator{}
+	client := startCoordinator(t, coordinator)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	assignment, err := client.Register(ctx, RegisterRequest{Hostname: "h1"})
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if want := (Assignment{NumAgents: 2, RunID: "run", Command: "insert", Args: []string{"h1"}}); !reflect.DeepEqual(assignment, want) {
+		t.Errorf("Register = %+v, want %+v", assignment, want)
+	}
+
+	// results larger than a message, streamed in three chunks
+	csv := []byte("workerId,latencyUs\n" + strings.Repeat("1,250\n", grpc.MaxMessageSize/6*5/8))
+	if len(csv) <= 2*reportChunkSize || len(csv) > grpc.MaxMessageSize {
+		t.Fatalf("results of %d bytes don't take three chunks", len(csv))
+	}
+	report := AgentReport{Hostname: "h1", ExitCode: 3, ResultsFilename: "results.csv", SummaryJSON: []byte("{}")}
+	if err := client.Report(ctx, report, bytes.NewReader(csv)); err != nil {
+		t.Fatalf("Report failed: %v", err)
+	}
+	if err := client.Report(ctx, AgentReport{AgentIndex: 1, Hostname: "h2"}, nil); err != nil {
+		t.Fatalf("Report without results failed: %v", err)
+	}
+	report.ResultsCSV = csv
+	coordinator.mu.Lock()
+	if len(coordinator.reports) != 2 || !reflect.DeepEqual(coordinator.reports[0], report) || coordinator.reports[1].Hostname != "h2" {
+		t.Errorf("coordinator received %d reports, want the reports of h1 with %d bytes of results and h2", len(coordinator.reports), len(csv))
+	}
+	coordinator.mu.Unlock()
+
+	err = client.Report(ctx, AgentReport{}, nil)
+	var status *grpc.Status
+	if !errors.As(err, &status) || status.Code != grpc.CodeFailedPrecondition || status.Message != "agent 1 already reported, 100% done" {
+		t.Errorf("Report error = %v, want agent 1 already reported", err)
+	}
+
+	// results which fail to be read aren't reported incompletely
+	err = client.Report(ctx, AgentReport{AgentIndex: 5}, &failingReader{data: csv[:reportChunkSize+10]})
+	if err == nil || !strings.Contains(err.Error(), "disk failure") {
+		t.Errorf("Report error = %v, want the read error", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	coordinator.mu.Lock()
+	defer coordinator.mu.Unlock()
+	if len(coordinator.reports) != 2 {
+		t.Errorf("coordinator received the report with unreadable results")
+	}
+}
@@ -0,0 +1,80 @@
+package cluster
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+)
+
+// MergeResults writes the rows of the agents' results CSVs into one CSV in the order of the reports.
+// The worker IDs of each agent are offset past the highest of the agents before it, so they stay distinct.
+// Reports without results CSV are skipped, the headers of the others have to match.
+// The monotonic clock columns are dropped, they are offsets of the clock of each agent and can't be compared across agents.
+func MergeResults(w io.Writer, reports []AgentReport) (int, error) {
+	cw := csv.NewWriter(w)
+	var header []string
+	workerColumn := -1
+	rows, offset := 0, 0
+	for _, report := range reports {
+		if len(report.ResultsCSV) == 0 {
+			continue
+		}
+		cr := csv.NewReader(bytes.NewReader(report.ResultsCSV))
+		agentHeader, err := cr.Read()
+		if err != nil {
+			return rows, fmt.Errorf("Reading results header of agent %d: %w", report.AgentIndex, err)
+		}
+		if header == nil {
+			header = agentHeader
+			workerColumn = slices.Index(header, "workerId")
+			if workerColumn < 0 {
+				return rows, fmt.Errorf("Results of agent %d have no workerId column", report.AgentIndex)
+			}
+			if err := cw.Write(withoutColumns(header, header)); err != nil {
+				return rows, err
+			}
+		} else if !slices.Equal(header, agentHeader) {
+			return rows, fmt.Errorf("Results of agent %d have the columns %v, expected %v like the other agents", report.AgentIndex, agentHeader, header)
+		}
+
+		maxWorker := -1
+		for {
+			rec, err := cr.Read()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return rows, fmt.Errorf("Reading results of agent %d: %w", report.AgentIndex, err)
+			}
+			worker, err := strconv.Atoi(rec[workerColumn])
+			if err != nil {
+				return rows, fmt.Errorf("Results of agent %d have the invalid workerId %q", report.AgentIndex, rec[workerColumn])
+			}
+			maxWorker = max(maxWorker, worker)
+			rec[workerColumn] = strconv.Itoa(worker + offset)
+			if err := cw.Write(withoutColumns(header, rec)); err != nil {
+				return rows, err
+			}
+			rows++
+		}
+		offset += maxWorker + 1
+	}
+	cw.Flush()
+	return rows, cw.Error()
+}
+
+// agentLocalColumns are the columns of the results CSVs only comparable within the results of one agent
+var agentLocalColumns = []string{"startMonotonicUs", "endMonotonicUs"}
+
+// withoutColumns returns rec of a CSV with header without the agentLocalColumns
+func withoutColumns(header, rec []string) []string {
+	kept := rec[:0:0]
+	for i, value := range rec {
+		if !slices.Contains(agentLocalColumns, header[i]) {
+			kept = append(kept, value)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,78 @@
+// Package feeds converts public micromobility trip data into trip events
+package feeds
+
+import (
+	"crypto/sha1"
+	"encoding/csv"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Point is a position of a vehicle during a trip
+type Point struct {
+	Time     time.Time
+	Lon, Lat float64
+}
+
+// Trip is a trip of a published dataset with its known positions, at least start and end
+type Trip struct {
+	ID     string
+	Points []Point
+}
+
+var uuidRe = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// tripUUID keeps IDs that are UUIDs and derives a version 5 style UUID from others
+func tripUUID(id string) string {
+	if uuidRe.MatchString(id) {
+		return id
+	}
+	return nameUUID("trip/" + id)
+}
+
+func nameUUID(name string) string {
+	b := sha1.Sum([]byte(name))
+	b[6] = (b[6] & 0x0f) | 0x50
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// WriteTripEvents writes the positions of the trip as trip events, ordered by time. With a sample interval,
+// positions are interpolated linearly between the known ones, so trips with only their start and end published
+// get the event density of the generated datasets. Event IDs are derived from the trip, so converting the same
+// data again yields the same IDs. Returns the number of events written.
+func WriteTripEvents(cw *csv.Writer, trip Trip, sampleInterval time.Duration) (int, error) {
+	points := append([]Point(nil), trip.Points...)
+	sort.SliceStable(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+	tripID := tripUUID(trip.ID)
+
+	events := 0
+	write := func(p Point) error {
+		events++
+		return cw.Write([]string{
+			nameUUID(fmt.Sprintf("event/%s/%d", tripID, events)), tripID, p.Time.UTC().Format(time.RFC3339),
+			strconv.FormatFloat(p.Lat, 'f', 6, 64), strconv.FormatFloat(p.Lon, 'f', 6, 64),
+		})
+	}
+	for i, p := range points {
+		if err := write(p); err != nil {
+			return events, err
+		}
+		if i+1 == len(points) || sampleInterval <= 0 {
+			continue
+		}
+		next := points[i+1]
+		span := next.Time.Sub(p.Time)
+		for t := sampleInterval; t < span; t += sampleInterval {
+			f := float64(t) / float64(span)
+			interpolated := Point{p.Time.Add(t), p.Lon + f*(next.Lon-p.Lon), p.Lat + f*(next.Lat-p.Lat)}
+			if err := write(interpolated); err != nil {
+				return events, err
+			}
+		}
+	}
+	return events, nil
+}
@@ -0,0 +1,62 @@
+package feeds
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ReadMDSTrips reads the trips of a Mobility Data Specification (MDS) provider trips response, either the
+// paginated {"data": {"trips": [...]}} or a plain {"trips": [...]}. The route of a trip is a FeatureCollection
+// of points with timestamps in milliseconds, as published by many cities for their e-scooter operators.
+// Trips without at least two route points are skipped and counted.
+func ReadMDSTrips(r io.Reader) ([]Trip, int, error) {
+	var response struct {
+		Data struct {
+			Trips []mdsTrip `json:"trips"`
+		} `json:"data"`
+		Trips []mdsTrip `json:"trips"`
+	}
+	if err := json.NewDecoder(r).Decode(&response); err != nil {
+		return nil, 0, fmt.Errorf("Decoding MDS trips: %w", err)
+	}
+	mdsTrips := append(response.Data.Trips, response.Trips...)
+
+	var trips []Trip
+	skipped := 0
+	for _, t := range mdsTrips {
+		trip := Trip{ID: t.TripID}
+		for _, f := range t.Route.Features {
+			if f.Geometry.Type != "Point" || len(f.Geometry.Coordinates) < 2 || f.Properties.Timestamp == 0 {
+				continue
+			}
+			trip.Points = append(trip.Points, Point{
+				Time: time.UnixMilli(f.Properties.Timestamp),
+				Lon:  f.Geometry.Coordinates[0],
+				Lat:  f.Geometry.Coordinates[1],
+			})
+		}
+		if t.TripID == "" || len(trip.Points) < 2 {
+			skipped++
+			continue
+		}
+		trips = append(trips, trip)
+	}
+	return trips, skipped, nil
+}
+
+type mdsTrip struct {
+	TripID string `json:"trip_id"`
+	Route  struct {
+		Features []struct {
+			Geometry struct {
+				Type        string    `json:"type"`
+				Coordinates []float64 `json:"coordinates"`
+			} `json:"geometry"`
+			Properties struct {
+				Timestamp int64 `json:"timestamp"`
+			} `json:"properties"`
+		} `json:"features"`
+	} `json:"route"`
+}
@@ -0,0 +1,96 @@
+package feeds
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CSVColumns names the columns of a trip export with one row per trip, e.g. the open data portals of US cities
+type CSVColumns struct {
+	TripID    string
+	StartTime string
+	EndTime   string
+	StartLat  string
+	StartLon  string
+	EndLat    string
+	EndLon    string
+	// layout of the times, see time.Parse, in the location Location
+	TimeLayout string
+	Location   *time.Location
+}
+
+// ChicagoColumns are the columns of the E-Scooter Trips datasets of the Chicago Data Portal,
+// which publish the centroids of the community areas instead of the exact positions
+var ChicagoColumns = CSVColumns{
+	TripID:     "Trip ID",
+	StartTime:  "Start Time",
+	EndTime:    "End Time",
+	StartLat:   "Start Centroid Latitude",
+	StartLon:   "Start Centroid Longitude",
+	EndLat:     "End Centroid Latitude",
+	EndLon:     "End Centroid Longitude",
+	TimeLayout: "01/02/2006 03:04:05 PM",
+}
+
+// ReadCSVTrips streams the trips of a trip export to fn. Rows with missing or invalid positions or times,
+// common in exports blurring positions for privacy, are skipped and counted.
+func ReadCSVTrips(r io.Reader, cols CSVColumns, fn func(Trip) error) (int, error) {
+	cr := csv.NewReader(r)
+	cr.ReuseRecord = true
+	header, err := cr.Read()
+	if err != nil {
+		return 0, fmt.Errorf("Reading trip export header: %w", err)
+	}
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		index[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+	names := []string{cols.TripID, cols.StartTime, cols.EndTime, cols.StartLat, cols.StartLon, cols.EndLat, cols.EndLon}
+	columns := make([]int, len(names))
+	for i, name := range names {
+		c, ok := index[name]
+		if !ok {
+			return 0, fmt.Errorf("Trip export without column %q", name)
+		}
+		columns[i] = c
+	}
+	location := cols.Location
+	if location == nil {
+		location = time.UTC
+	}
+
+	skipped := 0
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return skipped, nil
+		} else if err != nil {
+			return skipped, fmt.Errorf("Reading trip export: %w", err)
+		}
+		value := func(i int) string { return strings.TrimSpace(rec[columns[i]]) }
+		start, err1 := time.ParseInLocation(cols.TimeLayout, value(1), location)
+		end, err2 := time.ParseInLocation(cols.TimeLayout, value(2), location)
+		var coords [4]float64
+		valid := value(0) != "" && err1 == nil && err2 == nil && !end.Before(start)
+		for i := range coords {
+			if coords[i], err = strconv.ParseFloat(value(3+i), 64); err != nil {
+				valid = false
+			}
+		}
+		if !valid {
+			skipped++
+			continue
+		}
+		trip := Trip{ID: value(0), Points: []Point{
+			{Time: start, Lat: coords[0], Lon: coords[1]},
+			{Time: end, Lat: coords[2], Lon: coords[3]},
+		}}
+		if err := fn(trip); err != nil {
+			return skipped, err
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// Package fleet implements the gRPC service loadgen.v1.FleetGateway, a simulated backend API
+// the scooters of a fleet stream their trip events to. Its only method receives the events of a scooter
+// until it closes the stream:
+//
+//	rpc StreamEvents(stream TripEvent) returns (StreamSummary);
+//
+// The messages are encoded by hand with internal/protobuf in the proto3 encoding of the definitions on their types,
+// there are no .proto files or generated code.
+package fleet
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"load-generator/internal/grpc"
+	"load-generator/internal/protobuf"
+	"load-generator/internal/workload"
+)
+
+const methodStreamEvents = "/loadgen.v1.FleetGateway/StreamEvents"
+
+// TripEvent is a trip event with the time the scooter sent it, zero if unknown
+//
+//	message TripEvent {
+//	  string event_id = 1;
+//	  string trip_id = 2;
+//	  string timestamp = 3; // ISO timestamp of the event
+//	  string latitude = 4;
+//	  string longitude = 5;
+//	  int64 sent_at_unix_micros = 6; // when the scooter sent the event, for the end-to-end latency
+//	}
+type TripEvent struct {
+	workload.TripEvent
+	SentAt time.Time
+}
+
+// StreamSummary is the response to a closed stream
+//
+//	message StreamSummary {
+//	  uint64 accepted = 1; // events the gateway accepted for insertion
+//	}
+type StreamSummary struct {
+	Accepted int
+}
+
+func (e TripEvent) marshal() []byte {
+	var enc protobuf.Encoder
+	enc.String(1, e.EventID)
+	enc.String(2, e.TripID)
+	enc.String(3, e.Timestamp)
+	enc.String(4, e.Latitude)
+	enc.String(5, e.Longitude)
+	if !e.SentAt.IsZero() {
+		enc.Int(6, e.SentAt.UnixMicro())
+	}
+	return enc.Message()
+}
+
+func (e *TripEvent) unmarshal(b []byte) error {
+	return protobuf.EachField(b, func(f protobuf.Field) error {
+		switch f.Num {
+		case 1:
+			e.EventID = f.String()
+		case 2:
+			e.TripID = f.String()
+		case 3:
+			e.Timestamp = f.String()
+		case 4:
+			e.Latitude = f.String()
+		case 5:
+			e.Longitude = f.String()
+		case 6:
+			e.SentAt = time.UnixMicro(f.Int())
+		}
+		return nil
+	})
+}
+
+func (s StreamSummary) marshal() []byte {
+	var e protobuf.Encoder
+	e.Uint(1, uint64(s.Accepted))
+	return e.Message()
+}
+
+func (s *StreamSummary) unmarshal(b []byte) error {
+	return protobuf.EachField(b, func(f protobuf.Field) error {
+		if f.Num == 1 {
+			s.Accepted = int(f.Uint())
+		}
+		return nil
+	})
+}
+
+// Gateway is the server side of the service, recv returns the events of the stream in order and io.EOF at its end
+type Gateway interface {
+	StreamEvents(ctx context.Context, recv func() (TripEvent, error)) (StreamSummary, error)
+}
+
+// NewHandler serves the methods of the gateway
+func NewHandler(g Gateway) http.Handler {
+	s := grpc.NewServer()
+	s.HandleStream(methodStreamEvents, func(ctx context.Context, recv func() ([]byte, error)) ([]byte, error) {
+		summary, err := g.StreamEvents(ctx, func() (TripEvent, error) {
+			var e TripEvent
+			b, err := recv()
+			if err != nil {
+				return e, err
+			}
+			if err := e.unmarshal(b); err != nil {
+				return e, grpc.Errorf(grpc.CodeInvalidArgument, "%v", err)
+			}
+			return e, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return summary.marshal(), nil
+	})
+	return s
+}
+
+// Client calls the gateway at host:port
+type Client struct {
+	conn *grpc.Client
+}
+
+func NewClient(addr string) *Client {
+	return &Client{conn: grpc.NewClient(addr)}
+}
+
+// EventStream is the stream of a scooter's trip events
+type EventStream struct {
+	stream *grpc.ClientStream
+}
+
+// StreamEvents opens a stream, which ends with CloseAndRecv
+func (c *Client) StreamEvents(ctx context.Context) *EventStream {
+	return &EventStream{stream: c.conn.NewStream(ctx, methodStreamEvents)}
+}
+
+func (s *EventStream) Send(e TripEvent) error {
+	return s.stream.Send(e.marshal())
+}
+
+// CloseAndRecv closes the stream and returns the gateway's summary of it
+func (s *EventStream) CloseAndRecv() (StreamSummary, error) {
+	var summary StreamSummary
+	b, err := s.stream.CloseAndRecv()
+	if err != nil {
+		return summary, err
+	}
+	return summary, summary.unmarshal(b)
+}
@@ -0,0 +1,29 @@
+// Package geo has the planar computations on the rings of polygons shared by the readers of the locality formats
+// and the validation of their geometries. Positions are longitude and latitude, further coordinates are ignored.
+package geo
+
+// Position is a position of a ring, e.g. a GeoJSON position or a point of a shapefile
+type Position interface {
+	~[]float64 | ~[2]float64
+}
+
+// SignedArea is positive for counterclockwise rings (shoelace formula)
+func SignedArea[P Position](ring []P) float64 {
+	area := 0.0
+	for i := 0; i+1 < len(ring); i++ {
+		area += ring[i][0]*ring[i+1][1] - ring[i+1][0]*ring[i][1]
+	}
+	return area / 2
+}
+
+// ContainsPoint reports whether p lies inside the ring (ray casting)
+func ContainsPoint[P Position](ring []P, p P) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a, b := ring[i], ring[j]
+		if (a[1] > p[1]) != (b[1] > p[1]) && p[0] < (b[0]-a[0])*(p[1]-a[1])/(b[1]-a[1])+a[0] {
+			inside = !inside
+		}
+	}
+	return inside
+}
@@ -0,0 +1,43 @@
+package geo
+
+import "testing"
+
+var square = [][2]float64{{0, 0}, {10, 0}, {10, 10}, {0, 10}, {0, 0}}
+
+func TestSignedArea(t *testing.T) {
+	reversed := [][2]float64{{0, 0}, {0, 10}, {10, 10}, {10, 0}, {0, 0}}
+	if got := SignedArea(square); got != 100 {
+		t.Errorf("SignedArea of the counterclockwise square = %g, want 100", got)
+	}
+	if got := SignedArea(reversed); got != -100 {
+		t.Errorf("SignedArea of the clockwise square = %g, want -100", got)
+	}
+	// GeoJSON positions may have an altitude
+	withAltitude := [][]float64{{0, 0, 5}, {10, 0, 5}, {10, 10, 5}, {0, 0, 5}}
+	if got := SignedArea(withAltitude); got != 50 {
+		t.Errorf("SignedArea of the triangle = %g, want 50", got)
+	}
+}
+
+func TestContainsPoint(t *testing.T) {
+	tests := []struct {
+		p    [2]float64
+		want bool
+	}{
+		{[2]float64{5, 5}, true},
+		{[2]float64{0.1, 9.9}, true},
+		{[2]float64{-1, 5}, false},
+		{[2]float64{5, 11}, false},
+		{[2]float64{15, 5}, false},
+	}
+	for _, tt := range tests {
+		if got := ContainsPoint(square, tt.p); got != tt.want {
+			t.Errorf("ContainsPoint(%v) = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+	// concave ring, the point is in its notch
+	notched := [][2]float64{{0, 0}, {10, 0}, {10, 10}, {5, 5}, {0, 10}, {0, 0}}
+	if ContainsPoint(notched, [2]float64{5, 8}) {
+		t.Error("ContainsPoint of a point in the notch = true, want false")
+	}
+}
@@ -0,0 +1,292 @@
+// Package grpc implements unary and client-streaming gRPC calls over HTTP/2 without TLS (h2c) with the standard library:
+// length-prefixed protobuf messages and the grpc-status and grpc-message trailers, without compression and server streaming
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// status codes of gRPC
+const (
+	CodeOK                 = 0
+	CodeCanceled           = 1
+	CodeUnknown            = 2
+	CodeInvalidArgument    = 3
+	CodeDeadlineExceeded   = 4
+	CodeFailedPrecondition = 9
+	CodeUnimplemented      = 12
+	CodeInternal           = 13
+	CodeUnavailable        = 14
+)
+
+// MaxMessageSize limits received messages like gRPC does by default, large payloads are streamed in chunks
+const MaxMessageSize = 4 << 20
+
+// Status is the error of a call that didn't end with CodeOK
+type Status struct {
+	Code    int
+	Message string
+}
+
+func (s *Status) Error() string {
+	return fmt.Sprintf("gRPC status %d: %s", s.Code, s.Message)
+}
+
+func Errorf(code int, format string, args ...any) error {
+	return &Status{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Code returns the status code of err, CodeUnknown for errors which are no Status
+func Code(err error) int {
+	var s *Status
+	switch {
+	case err == nil:
+		return CodeOK
+	case errors.As(err, &s):
+		return s.Code
+	case errors.Is(err, context.Canceled):
+		return CodeCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return CodeDeadlineExceeded
+	default:
+		return CodeUnknown
+	}
+}
+
+// Handler handles the encoded request message of a method and returns the encoded response message
+type Handler func(ctx context.Context, req []byte) ([]byte, error)
+
+// StreamHandler handles a client-streaming method, recv returns the encoded request messages in order
+// and io.EOF once the client closed the stream
+type StreamHandler func(ctx context.Context, recv func() ([]byte, error)) ([]byte, error)
+
+// Server dispatches the calls by their path, /<package>.<Service>/<Method>
+type Server struct {
+	methods map[string]StreamHandler
+}
+
+func NewServer() *Server {
+	return &Server{methods: make(map[string]StreamHandler)}
+}
+
+// Handle registers the handler of the method, e.g. /loadgen.v1.Coordinator/Register
+func (s *Server) Handle(method string, h Handler) {
+	s.methods[method] = func(ctx context.Context, recv func() ([]byte, error)) ([]byte, error) {
+		req, err := recv()
+		if err == io.EOF {
+			return nil, Errorf(CodeInvalidArgument, "request without message")
+		} else if err != nil {
+			return nil, err
+		}
+		return h(ctx, req)
+	}
+}
+
+// HandleStream registers the handler of a client-streaming method
+func (s *Server) HandleStream(method string, h StreamHandler) {
+	s.methods[method] = h
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "gRPC requires POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "gRPC requires the content type application/grpc", http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+
+	var resp []byte
+	var err error
+	if h, ok := s.methods[r.URL.Path]; !ok {
+		err = Errorf(CodeUnimplemented, "unknown method %s", r.URL.Path)
+	} else {
+		resp, err = h(r.Context(), func() ([]byte, error) {
+			msg, err := readMessage(r.Body)
+			if err != nil && err != io.EOF {
+				return nil, Errorf(CodeInvalidArgument, "reading request: %v", err)
+			}
+			return msg, err
+		})
+	}
+	if err == nil {
+		w.WriteHeader(http.StatusOK)
+		_, err = w.Write(frame(resp))
+	}
+
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(Code(err)))
+	if err != nil {
+		var s *Status
+		message := err.Error()
+		if errors.As(err, &s) {
+			message = s.Message
+		}
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", encodeMessage(message))
+	}
+}
+
+// NewHTTPServer returns a server of the handler speaking HTTP/2 without TLS, as gRPC clients do for insecure connections
+func NewHTTPServer(addr string, handler http.Handler) *http.Server {
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	return &http.Server{Addr: addr, Handler: handler, Protocols: &protocols}
+}
+
+// Client calls the methods of a server at host:port
+type Client struct {
+	addr string
+	http *http.Client
+}
+
+func NewClient(addr string) *Client {
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	return &Client{addr: addr, http: &http.Client{Transport: &http.Transport{Protocols: &protocols}}}
+}
+
+// Invoke calls the method with the encoded request and returns the encoded response.
+// Errors of the connection are returned as Status with CodeUnavailable.
+func (c *Client) Invoke(ctx context.Context, method string, req []byte) ([]byte, error) {
+	return c.call(ctx, method, bytes.NewReader(frame(req)))
+}
+
+// ClientStream is a call of a client-streaming method, its messages are sent while the server receives them
+type ClientStream struct {
+	w    *io.PipeWriter
+	done chan struct{}
+	resp []byte
+	err  error
+}
+
+// NewStream starts a call of the client-streaming method, the call ends with CloseAndRecv
+func (c *Client) NewStream(ctx context.Context, method string) *ClientStream {
+	r, w := io.Pipe()
+	s := &ClientStream{w: w, done: make(chan struct{})}
+	go func() {
+		defer close(s.done)
+		s.resp, s.err = c.call(ctx, method, r)
+		// unblock Send if the call ended before the stream was closed
+		r.CloseWithError(io.ErrClosedPipe)
+	}()
+	return s
+}
+
+// Send sends the encoded message, the error of the call if it already ended
+func (s *ClientStream) Send(msg []byte) error {
+	if _, err := s.w.Write(frame(msg)); err != nil {
+		<-s.done
+		if s.err != nil {
+			return s.err
+		}
+		return Errorf(CodeInternal, "stream ended before it was closed")
+	}
+	return nil
+}
+
+// CloseAndRecv closes the stream and returns the encoded response
+func (s *ClientStream) CloseAndRecv() ([]byte, error) {
+	s.w.Close()
+	<-s.done
+	return s.resp, s.err
+}
+
+func (c *Client) call(ctx context.Context, method string, body io.Reader) ([]byte, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+c.addr+method, body)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/grpc")
+	httpReq.Header.Set("TE", "trailers")
+	httpResp, err := c.http.Do(httpReq)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, &Status{Code: CodeUnavailable, Message: err.Error()}
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(httpResp.Body, 4096))
+		return nil, Errorf(CodeUnknown, "HTTP status %s: %s", httpResp.Status, bytes.TrimSpace(body))
+	}
+
+	resp, readErr := readMessage(httpResp.Body)
+	if readErr != nil && readErr != io.EOF {
+		return nil, Errorf(CodeInternal, "reading response: %v", readErr)
+	}
+	io.Copy(io.Discard, httpResp.Body)
+
+	// a response without message carries the status in its headers
+	status, message := httpResp.Trailer.Get("Grpc-Status"), httpResp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status, message = httpResp.Header.Get("Grpc-Status"), httpResp.Header.Get("Grpc-Message")
+	}
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		return nil, Errorf(CodeInternal, "response without valid grpc-status %q", status)
+	}
+	if code != CodeOK {
+		if decoded, err := url.PathUnescape(message); err == nil {
+			message = decoded
+		}
+		return nil, &Status{Code: code, Message: message}
+	}
+	if readErr == io.EOF {
+		return nil, Errorf(CodeInternal, "response without message")
+	}
+	return resp, nil
+}
+
+// frame prefixes the message with the uncompressed flag and its length
+func frame(msg []byte) []byte {
+	b := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(b[1:], uint32(len(msg)))
+	return append(b, msg...)
+}
+
+// readMessage reads one length-prefixed message, io.EOF if there is none
+func readMessage(r io.Reader) ([]byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, errors.New("truncated message header")
+		}
+		return nil, err
+	}
+	if header[0] != 0 {
+		return nil, errors.New("compressed messages are not supported")
+	}
+	length := binary.BigEndian.Uint32(header[1:])
+	if length > MaxMessageSize {
+		return nil, fmt.Errorf("message of %d bytes exceeds the limit of %d bytes", length, MaxMessageSize)
+	}
+	msg := make([]byte, length)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, fmt.Errorf("truncated message: %w", err)
+	}
+	return msg, nil
+}
+
+// encodeMessage percent-encodes the grpc-message, bytes outside of printable ASCII and %
+func encodeMessage(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&sb, "%%%02X", c)
+		} else {
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,444 @@
+package kafka
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	fetchMaxWait      = 500 * time.Millisecond
+	fetchMaxBytes     = 16 * 1024 * 1024
+	partitionMaxBytes = 4 * 1024 * 1024
+	requestTimeout    = 30 * time.Second
+	earliestOffset    = -2
+	latestOffset      = -1
+)
+
+type partition struct {
+	id     int32
+	leader int32
+	offset int64 // next offset to consume
+	end    int64 // offset the consumer stops at unless following, the high watermark when it was created
+	high   int64 // high watermark of the last fetch
+}
+
+// Consumer reads the record values of all partitions of a topic from their earliest offset,
+// without a consumer group. Records are returned in offset order per partition, partitions are interleaved.
+type Consumer struct {
+	*client
+	follow  bool
+	pending [][]byte
+}
+
+// client holds the connections to the leaders of the partitions of a topic
+type client struct {
+	topic      string
+	addrs      map[int32]string // broker addresses by node ID
+	brokers    map[int32]*broker
+	partitions []*partition
+}
+
+// newClient connects to the bootstrap broker (host:port) and looks up the partitions of the topic
+func newClient(ctx context.Context, bootstrap, topic string) (*client, error) {
+	c := &client{topic: topic, addrs: make(map[int32]string), brokers: make(map[int32]*broker)}
+	bootstrapBroker, err := dialBroker(ctx, bootstrap)
+	if err != nil {
+		return nil, err
+	}
+	defer bootstrapBroker.close()
+	if err := c.readMetadata(ctx, bootstrapBroker); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// NewConsumer connects to the bootstrap broker (host:port) and looks up the partitions of the topic.
+// Unless follow is set, the consumer stops at the end of the partitions at the time it is created,
+// otherwise it waits for new records until the context is done.
+func NewConsumer(ctx context.Context, bootstrap, topic string, follow bool) (*Consumer, error) {
+	cl, err := newClient(ctx, bootstrap, topic)
+	if err != nil {
+		return nil, err
+	}
+	c := &Consumer{client: cl, follow: follow}
+	for _, p := range c.partitions {
+		b, err := c.broker(ctx, p.leader)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		if p.offset, err = c.listOffset(ctx, b, p.id, earliestOffset); err != nil {
+			c.Close()
+			return nil, err
+		}
+		if p.end, err = c.listOffset(ctx, b, p.id, latestOffset); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Partitions returns the number of partitions of the topic
+func (c *client) Partitions() int {
+	return len(c.partitions)
+}
+
+// Lag returns the number of records up to the end offsets, while following up to the high watermarks of the last fetch
+func (c *Consumer) Lag() int64 {
+	var lag int64
+	for _, p := range c.partitions {
+		end := p.end
+		if c.follow {
+			end = max(end, p.high)
+		}
+		lag += max(end-p.offset, 0)
+	}
+	return lag
+}
+
+// NewPartitionShare returns a following consumer of share (0-based) of shares of the partitions, starting at their
+// current end. The partitions are assigned by their ID in turn. This is no consumer group: the broker neither
+// coordinates the shares nor stores their offsets, so all shares have to be consumed by one process.
+func NewPartitionShare(ctx context.Context, bootstrap, topic string, share, shares int) (*Consumer, error) {
+	cl, err := newClient(ctx, bootstrap, topic)
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(cl.partitions, func(a, b *partition) int { return int(a.id - b.id) })
+	var assigned []*partition
+	for i, p := range cl.partitions {
+		if i%shares != share {
+			continue
+		}
+		b, err := cl.broker(ctx, p.leader)
+		if err != nil {
+			cl.Close()
+			return nil, err
+		}
+		if p.offset, err = cl.listOffset(ctx, b, p.id, latestOffset); err != nil {
+			cl.Close()
+			return nil, err
+		}
+		p.end, p.high = p.offset, p.offset
+		assigned = append(assigned, p)
+	}
+	if len(assigned) == 0 {
+		cl.Close()
+		return nil, fmt.Errorf("No partition of topic %s for share %d of %d, the topic has %d partitions", topic, share+1, shares, len(cl.partitions))
+	}
+	cl.partitions = assigned
+	return &Consumer{client: cl, follow: true}, nil
+}
+
+func (c *client) readMetadata(ctx context.Context, b *broker) error {
+	req := &encoder{}
+	req.int32(1)
+	req.string(c.topic)
+	d, err := b.request(ctx, apiMetadata, 1, req.b, requestTimeout)
+	if err != nil {
+		return err
+	}
+	return c.decodeMetadata(d)
+}
+
+func (c *client) decodeMetadata(d *decoder) error {
+	for range d.arrayLen() {
+		nodeID := d.int32()
+		host := d.string()
+		port := d.int32()
+		d.string() // rack
+		c.addrs[nodeID] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	d.int32() // controller ID
+	for range d.arrayLen() {
+		code := d.int16()
+		name := d.string()
+		d.int8() // is internal
+		if code != 0 {
+			return fmt.Errorf("Metadata of topic %s: %w", name, errorCode(code))
+		}
+		for range d.arrayLen() {
+			partitionCode := d.int16()
+			id := d.int32()
+			leader := d.int32()
+			for range d.arrayLen() {
+				d.int32() // replica
+			}
+			for range d.arrayLen() {
+				d.int32() // in-sync replica
+			}
+			if partitionCode != 0 {
+				return fmt.Errorf("Metadata of partition %d of topic %s: %w", id, name, errorCode(partitionCode))
+			}
+			c.partitions = append(c.partitions, &partition{id: id, leader: leader})
+		}
+	}
+	if d.err != nil {
+		return fmt.Errorf("Decoding Kafka metadata: %w", d.err)
+	}
+	if len(c.partitions) == 0 {
+		return fmt.Errorf("Topic %s without partitions", c.topic)
+	}
+	return nil
+}
+
+func (c *client) broker(ctx context.Context, nodeID int32) (*broker, error) {
+	if b, ok := c.brokers[nodeID]; ok {
+		return b, nil
+	}
+	addr, ok := c.addrs[nodeID]
+	if !ok {
+		return nil, fmt.Errorf("Leader %d of topic %s missing in the Kafka metadata", nodeID, c.topic)
+	}
+	b, err := dialBroker(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	c.brokers[nodeID] = b
+	return b, nil
+}
+
+func (c *client) listOffset(ctx context.Context, b *broker, partitionID int32, timestamp int64) (int64, error) {
+	req := &encoder{}
+	req.int32(-1) // replica ID of consumers
+	req.int32(1)
+	req.string(c.topic)
+	req.int32(1)
+	req.int32(partitionID)
+	req.int64(timestamp)
+	d, err := b.request(ctx, apiListOffsets, 1, req.b, requestTimeout)
+	if err != nil {
+		return 0, err
+	}
+	var offset int64 = -1
+	for range d.arrayLen() {
+		d.string() // topic
+		for range d.arrayLen() {
+			d.int32() // partition
+			code := d.int16()
+			d.int64() // timestamp
+			offset = d.int64()
+			if code != 0 {
+				return 0, fmt.Errorf("Listing offsets of partition %d of topic %s: %w", partitionID, c.topic, errorCode(code))
+			}
+		}
+	}
+	if d.err != nil {
+		return 0, fmt.Errorf("Decoding Kafka offsets: %w", d.err)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("No offset of partition %d of topic %s", partitionID, c.topic)
+	}
+	return offset, nil
+}
+
+// Next returns the value of the next record, io.EOF once the end offsets are reached unless following
+func (c *Consumer) Next(ctx context.Context) ([]byte, error) {
+	for len(c.pending) == 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if !c.follow && c.Lag() == 0 {
+			return nil, io.EOF
+		}
+		if err := c.fetch(ctx); err != nil {
+			return nil, err
+		}
+	}
+	value := c.pending[0]
+	c.pending = c.pending[1:]
+	return value, nil
+}
+
+// Poll returns up to limit record values, fetching once if none are pending.
+// While following, the result is empty if no records arrived within the fetch wait time.
+func (c *Consumer) Poll(ctx context.Context, limit int) ([][]byte, error) {
+	if len(c.pending) == 0 {
+		if !c.follow && c.Lag() == 0 {
+			return nil, io.EOF
+		}
+		if err := c.fetch(ctx); err != nil {
+			return nil, err
+		}
+	}
+	n := min(limit, len(c.pending))
+	values := c.pending[:n:n]
+	c.pending = c.pending[n:]
+	return values, nil
+}
+
+// fetch requests the records after the current offsets from the leader of every partition not yet at its end
+func (c *Consumer) fetch(ctx context.Context) error {
+	byLeader := make(map[int32][]*partition)
+	for _, p := range c.partitions {
+		if c.follow || p.offset < p.end {
+			byLeader[p.leader] = append(byLeader[p.leader], p)
+		}
+	}
+	for leader, partitions := range byLeader {
+		b, err := c.broker(ctx, leader)
+		if err != nil {
+			return err
+		}
+		req := &encoder{}
+		req.int32(-1) // replica ID of consumers
+		req.int32(int32(fetchMaxWait / time.Millisecond))
+		req.int32(1) // min bytes
+		req.int32(fetchMaxBytes)
+		req.int8(0) // read uncommitted
+		req.int32(1)
+		req.string(c.topic)
+		req.int32(int32(len(partitions)))
+		for _, p := range partitions {
+			req.int32(p.id)
+			req.int64(p.offset)
+			req.int32(partitionMaxBytes)
+		}
+		d, err := b.request(ctx, apiFetch, 4, req.b, requestTimeout+fetchMaxWait)
+		if err != nil {
+			return err
+		}
+		if err := c.decodeFetch(d, partitions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Consumer) decodeFetch(d *decoder, partitions []*partition) error {
+	byID := make(map[int32]*partition, len(partitions))
+	for _, p := range partitions {
+		byID[p.id] = p
+	}
+	d.int32() // throttle time
+	for range d.arrayLen() {
+		d.string() // topic
+		for range d.arrayLen() {
+			id := d.int32()
+			code := d.int16()
+			high := d.int64()
+			d.int64() // last stable offset
+			for range d.arrayLen() {
+				d.int64() // aborted transaction producer ID
+				d.int64() // first offset
+			}
+			records := d.bytes()
+			if d.err != nil {
+				break
+			}
+			p, ok := byID[id]
+			if !ok {
+				continue
+			}
+			if code != 0 {
+				return fmt.Errorf("Fetching partition %d of topic %s at offset %d: %w", id, c.topic, p.offset, errorCode(code))
+			}
+			p.high = high
+			if err := c.decodeRecordBatches(records, p); err != nil {
+				return fmt.Errorf("Decoding records of partition %d of topic %s: %w", id, c.topic, err)
+			}
+		}
+	}
+	if d.err != nil {
+		return fmt.Errorf("Decoding Kafka fetch response: %w", d.err)
+	}
+	return nil
+}
+
+// decodeRecordBatches appends the values of the records at or after the partition's offset to the pending values.
+// A batch truncated by the fetch size limit is left for the next fetch.
+func (c *Consumer) decodeRecordBatches(b []byte, p *partition) error {
+	for len(b) >= 12 {
+		batch := &decoder{b: b}
+		baseOffset := batch.int64()
+		length := int(batch.int32())
+		if length > len(batch.b) {
+			return nil
+		}
+		b = b[12+length:]
+		batch.b = batch.b[:length]
+		batch.int32() // partition leader epoch
+		if magic := batch.int8(); magic != 2 {
+			return fmt.Errorf("Unsupported record batch version %d, only magic 2 is supported", magic)
+		}
+		batch.int32() // crc
+		attributes := batch.int16()
+		lastOffsetDelta := batch.int32()
+		batch.take(8 + 8 + 8 + 2 + 4) // timestamps, producer ID and epoch, base sequence
+		numRecords := int(batch.int32())
+		if batch.err != nil {
+			return batch.err
+		}
+		nextOffset := baseOffset + int64(lastOffsetDelta) + 1
+		// control batches mark transaction boundaries and contain no data
+		if attributes&0x20 != 0 {
+			p.offset = max(p.offset, nextOffset)
+			continue
+		}
+
+		records, err := decompress(attributes&0x7, batch.b)
+		if err != nil {
+			return err
+		}
+		rd := &decoder{b: records}
+		for range numRecords {
+			rd.varint() // length
+			rd.int8()   // attributes
+			rd.varint() // timestamp delta
+			offset := baseOffset + rd.varint()
+			rd.varbytes() // key
+			value := rd.varbytes()
+			for range rd.varint() {
+				rd.varbytes() // header key
+				rd.varbytes() // header value
+			}
+			if rd.err != nil {
+				return rd.err
+			}
+			if offset < p.offset || (!c.follow && offset >= p.end) {
+				continue
+			}
+			c.pending = append(c.pending, value)
+			p.offset = offset + 1
+		}
+		if c.follow || nextOffset <= p.end {
+			p.offset = max(p.offset, nextOffset)
+		} else {
+			p.offset = max(p.offset, min(nextOffset, p.end))
+		}
+	}
+	return nil
+}
+
+func decompress(codec int16, b []byte) ([]byte, error) {
+	switch codec {
+	case 0:
+		return b, nil
+	case 1:
+		zr, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	default:
+		return nil, errors.New("Unsupported record compression, only none and gzip are supported, set compression.type of the producer or topic accordingly")
+	}
+}
+
+func (c *client) Close() error {
+	var errs []error
+	for _, b := range c.brokers {
+		errs = append(errs, b.close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,125 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"time"
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Record is a record to produce, the key selects the partition
+type Record struct {
+	Key   []byte
+	Value []byte
+}
+
+// Producer appends records to the partitions of a topic with Produce v3 requests, one request at a time
+type Producer struct {
+	*client
+	acks int16
+}
+
+// NewProducer connects to the bootstrap broker (host:port) and looks up the partitions of the topic.
+// acks is 1 to wait for the leader or -1 to wait for all in-sync replicas.
+func NewProducer(ctx context.Context, bootstrap, topic string, acks int16) (*Producer, error) {
+	if acks != 1 && acks != -1 {
+		return nil, fmt.Errorf("Unsupported acks %d, expected 1 or -1", acks)
+	}
+	cl, err := newClient(ctx, bootstrap, topic)
+	if err != nil {
+		return nil, err
+	}
+	return &Producer{client: cl, acks: acks}, nil
+}
+
+// Partition returns the partition of the key, the FNV-1a hash modulo the number of partitions
+func (p *Producer) Partition(key []byte) int {
+	h := fnv.New32a()
+	h.Write(key)
+	return int(h.Sum32() % uint32(len(p.partitions)))
+}
+
+// Produce appends the records as one record batch to the partition (0-based index) and waits for the acknowledgement
+func (p *Producer) Produce(ctx context.Context, partition int, records []Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	part := p.partitions[partition]
+	b, err := p.broker(ctx, part.leader)
+	if err != nil {
+		return err
+	}
+	req := &encoder{}
+	req.int16(-1) // no transactional ID
+	req.int16(p.acks)
+	req.int32(int32(requestTimeout / time.Millisecond))
+	req.int32(1)
+	req.string(p.topic)
+	req.int32(1)
+	req.int32(part.id)
+	batch := recordBatch(records, time.Now())
+	req.int32(int32(len(batch)))
+	req.b = append(req.b, batch...)
+
+	d, err := b.request(ctx, apiProduce, 3, req.b, requestTimeout)
+	if err != nil {
+		return err
+	}
+	for range d.arrayLen() {
+		d.string() // topic
+		for range d.arrayLen() {
+			id := d.int32()
+			code := d.int16()
+			d.int64() // base offset
+			d.int64() // log append time
+			if d.err == nil && code != 0 {
+				return fmt.Errorf("Producing to partition %d of topic %s: %w", id, p.topic, errorCode(code))
+			}
+		}
+	}
+	d.int32() // throttle time
+	if d.err != nil {
+		return fmt.Errorf("Decoding Kafka produce response: %w", d.err)
+	}
+	return nil
+}
+
+// recordBatch encodes the records as uncompressed record batch of magic 2 without producer ID
+func recordBatch(records []Record, now time.Time) []byte {
+	body := &encoder{}
+	for i, r := range records {
+		rec := &encoder{}
+		rec.int8(0)   // attributes
+		rec.varint(0) // timestamp delta
+		rec.varint(int64(i))
+		rec.varbytes(r.Key)
+		rec.varbytes(r.Value)
+		rec.varint(0) // headers
+		body.varint(int64(len(rec.b)))
+		body.b = append(body.b, rec.b...)
+	}
+
+	timestamp := now.UnixMilli()
+	crcPart := &encoder{}
+	crcPart.int16(0) // attributes, no compression
+	crcPart.int32(int32(len(records) - 1))
+	crcPart.int64(timestamp)
+	crcPart.int64(timestamp)
+	crcPart.int64(-1) // producer ID
+	crcPart.int16(-1) // producer epoch
+	crcPart.int32(-1) // base sequence
+	crcPart.int32(int32(len(records)))
+	crcPart.b = append(crcPart.b, body.b...)
+
+	batch := &encoder{}
+	batch.int64(0) // base offset, assigned by the broker
+	batch.int32(int32(4 + 1 + 4 + len(crcPart.b)))
+	batch.int32(-1) // partition leader epoch
+	batch.int8(2)   // magic
+	batch.int32(int32(crc32.Checksum(crcPart.b, castagnoli)))
+	batch.b = append(batch.b, crcPart.b...)
+	return batch.b
+}
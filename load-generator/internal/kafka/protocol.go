@@ -0,0 +1,231 @@
+// Package kafka consumes and produces the records of a Kafka topic using the subset of the wire protocol needed for it:
+// Metadata v1, ListOffsets v1, Fetch v4 and Produce v3 with record batches of magic 2
+package kafka
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+const (
+	apiProduce     = 0
+	apiFetch       = 1
+	apiListOffsets = 2
+	apiMetadata    = 3
+)
+
+const clientID = "load-generator"
+
+// encoder builds a request body in the big-endian wire format
+type encoder struct {
+	b []byte
+}
+
+func (e *encoder) int8(v int8)   { e.b = append(e.b, byte(v)) }
+func (e *encoder) int16(v int16) { e.b = binary.BigEndian.AppendUint16(e.b, uint16(v)) }
+func (e *encoder) int32(v int32) { e.b = binary.BigEndian.AppendUint32(e.b, uint32(v)) }
+func (e *encoder) int64(v int64) { e.b = binary.BigEndian.AppendUint64(e.b, uint64(v)) }
+func (e *encoder) string(s string) {
+	e.int16(int16(len(s)))
+	e.b = append(e.b, s...)
+}
+func (e *encoder) varint(v int64) { e.b = binary.AppendVarint(e.b, v) }
+
+// varbytes writes nullable bytes with a varint length, as in records
+func (e *encoder) varbytes(v []byte) {
+	if v == nil {
+		e.varint(-1)
+		return
+	}
+	e.varint(int64(len(v)))
+	e.b = append(e.b, v...)
+}
+
+// decoder reads a response body, the first error is kept and all later reads return zero values
+type decoder struct {
+	b   []byte
+	err error
+}
+
+var errTruncated = errors.New("Truncated Kafka response")
+
+func (d *decoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.b) {
+		d.err = errTruncated
+		return nil
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) int8() int8 {
+	if b := d.take(1); b != nil {
+		return int8(b[0])
+	}
+	return 0
+}
+
+func (d *decoder) int16() int16 {
+	if b := d.take(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (d *decoder) int32() int32 {
+	if b := d.take(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (d *decoder) int64() int64 {
+	if b := d.take(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+// string reads a nullable string, null is returned as empty string
+func (d *decoder) string() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.take(int(n)))
+}
+
+// bytes reads nullable bytes with an int32 length
+func (d *decoder) bytes() []byte {
+	n := d.int32()
+	if n < 0 {
+		return nil
+	}
+	return d.take(int(n))
+}
+
+// arrayLen reads the length of an array, null arrays have length 0
+func (d *decoder) arrayLen() int {
+	n := int(d.int32())
+	// every element takes at least one byte, a larger length means a corrupt response
+	if n > len(d.b) {
+		d.err = errTruncated
+		return 0
+	}
+	return max(n, 0)
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.err = errTruncated
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+// varbytes reads nullable bytes with a varint length, as in records
+func (d *decoder) varbytes() []byte {
+	n := d.varint()
+	if n < 0 {
+		return nil
+	}
+	return d.take(int(n))
+}
+
+// broker is a connection to a single broker, requests are sent one at a time
+type broker struct {
+	conn          net.Conn
+	r             *bufio.Reader
+	correlationID int32
+}
+
+func dialBroker(ctx context.Context, addr string) (*broker, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("Connecting to Kafka broker %s: %w", addr, err)
+	}
+	return &broker{conn: conn, r: bufio.NewReader(conn)}, nil
+}
+
+// request sends the request and returns the body of its response, timeout bounds the round trip
+func (b *broker) request(ctx context.Context, apiKey, version int16, body []byte, timeout time.Duration) (*decoder, error) {
+	b.correlationID++
+	header := &encoder{}
+	header.int32(0) // size, set below
+	header.int16(apiKey)
+	header.int16(version)
+	header.int32(b.correlationID)
+	header.string(clientID)
+	msg := append(header.b, body...)
+	binary.BigEndian.PutUint32(msg, uint32(len(msg)-4))
+
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	b.conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { b.conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	if _, err := b.conn.Write(msg); err != nil {
+		return nil, b.requestError(ctx, err)
+	}
+	var sizeBuf [4]byte
+	if _, err := io.ReadFull(b.r, sizeBuf[:]); err != nil {
+		return nil, b.requestError(ctx, err)
+	}
+	response := make([]byte, binary.BigEndian.Uint32(sizeBuf[:]))
+	if _, err := io.ReadFull(b.r, response); err != nil {
+		return nil, b.requestError(ctx, err)
+	}
+	d := &decoder{b: response}
+	if id := d.int32(); id != b.correlationID {
+		return nil, fmt.Errorf("Kafka response with correlation ID %d to request %d", id, b.correlationID)
+	}
+	return d, d.err
+}
+
+func (b *broker) requestError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return fmt.Errorf("Kafka request to %s: %w", b.conn.RemoteAddr(), err)
+}
+
+func (b *broker) close() error {
+	return b.conn.Close()
+}
+
+// errorCode describes the error codes a consumer runs into, see the Kafka protocol guide for the others
+func errorCode(code int16) error {
+	switch code {
+	case 1:
+		return errors.New("OFFSET_OUT_OF_RANGE")
+	case 3:
+		return errors.New("UNKNOWN_TOPIC_OR_PARTITION")
+	case 5:
+		return errors.New("LEADER_NOT_AVAILABLE")
+	case 6:
+		return errors.New("NOT_LEADER_OR_FOLLOWER")
+	case 29:
+		return errors.New("TOPIC_AUTHORIZATION_FAILED")
+	default:
+		return fmt.Errorf("Kafka error code %d", code)
+	}
+}
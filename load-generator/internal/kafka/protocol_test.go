@@ -0,0 +1,420 @@
+package kafka
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The golden bytes follow the Kafka protocol guide field by field, they are written out instead of
+// being built with the encoder so a mistake in the encoder can't hide in the expectation.
+
+func cat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+var (
+	topicEvents = []byte{0x00, 0x06, 'e', 'v', 'e', 'n', 't', 's'} // int16 length and "events"
+	one         = []byte{0x00, 0x00, 0x00, 0x01}                   // int32 1, e.g. an array of one element
+	zero32      = []byte{0x00, 0x00, 0x00, 0x00}
+	zero64      = []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+	minusOne32  = []byte{0xff, 0xff, 0xff, 0xff}
+	minusOne64  = []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+)
+
+// goldenBatch is the record batch of the record k=v1 produced at 2023-11-14T22:13:20Z
+var goldenBatch = []byte{
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // base offset 0
+	0x00, 0x00, 0x00, 0x3b, // batch length 59
+	0xff, 0xff, 0xff, 0xff, // partition leader epoch -1
+	0x02,                   // magic 2
+	0x0f, 0x77, 0x68, 0x85, // CRC-32C of the rest of the batch
+	0x00, 0x00, // attributes, no compression
+	0x00, 0x00, 0x00, 0x00, // last offset delta 0
+	0x00, 0x00, 0x01, 0x8b, 0xcf, 0xe5, 0x68, 0x00, // first timestamp 1700000000000
+	0x00, 0x00, 0x01, 0x8b, 0xcf, 0xe5, 0x68, 0x00, // max timestamp
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, // producer ID -1
+	0xff, 0xff, // producer epoch -1
+	0xff, 0xff, 0xff, 0xff, // base sequence -1
+	0x00, 0x00, 0x00, 0x01, // 1 record
+	0x12,      // record length 9 (zigzag varint)
+	0x00,      // attributes
+	0x00,      // timestamp delta 0
+	0x00,      // offset delta 0
+	0x02, 'k', // key length 1 and key
+	0x04, 'v', '1', // value length 2 and value
+	0x00, // no headers
+}
+
+var goldenTime = time.UnixMilli(1700000000000)
+
+func TestRecordBatch(t *testing.T) {
+	got := recordBatch([]Record{{Key: []byte("k"), Value: []byte("v1")}}, goldenTime)
+	if !bytes.Equal(got, goldenBatch) {
+		t.Errorf("recordBatch =\n% x\nwant\n% x", got, goldenBatch)
+	}
+}
+
+// metadataResponse describes broker 1 at addr leading partition 0 of the topic events
+func metadataResponse(t *testing.T, addr string) []byte {
+	t.Helper()
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var port int32
+	for _, c := range portStr {
+		port = port*10 + int32(c-'0')
+	}
+	return cat(
+		one, // 1 broker
+		one, // node ID 1
+		[]byte{0x00, byte(len(host))}, []byte(host),
+		binary.BigEndian.AppendUint32(nil, uint32(port)),
+		[]byte{0xff, 0xff}, // rack null
+		one,                // controller ID 1
+		one,                // 1 topic
+		[]byte{0x00, 0x00}, // error code
+		topicEvents,
+		[]byte{0x00},       // not internal
+		one,                // 1 partition
+		[]byte{0x00, 0x00}, // error code
+		zero32,             // partition 0
+		one,                // leader 1
+		one, one,           // replicas [1]
+		one, one, // in-sync replicas [1]
+	)
+}
+
+func TestDecodeMetadata(t *testing.T) {
+	c := &client{topic: "events", addrs: make(map[int32]string)}
+	if err := c.decodeMetadata(&decoder{b: metadataResponse(t, "broker:9092")}); err != nil {
+		t.Fatalf("decodeMetadata failed: %v", err)
+	}
+	if c.addrs[1] != "broker:9092" {
+		t.Errorf("broker 1 at %q, want broker:9092", c.addrs[1])
+	}
+	if len(c.partitions) != 1 || c.partitions[0].id != 0 || c.partitions[0].leader != 1 {
+		t.Errorf("partitions = %+v, want partition 0 led by 1", c.partitions)
+	}
+}
+
+func TestDecodeMetadataErrors(t *testing.T) {
+	full := metadataResponse(t, "broker:9092")
+	for n := range len(full) {
+		c := &client{topic: "events", addrs: make(map[int32]string)}
+		if err := c.decodeMetadata(&decoder{b: full[:n]}); err == nil {
+			t.Errorf("decodeMetadata of the first %d of %d bytes succeeded", n, len(full))
+		}
+	}
+
+	unknownTopic := cat(zero32, one, one, []byte{0x00, 0x03}, topicEvents, []byte{0x00}, zero32)
+	c := &client{topic: "events", addrs: make(map[int32]string)}
+	if err := c.decodeMetadata(&decoder{b: unknownTopic}); err == nil || !strings.Contains(err.Error(), "UNKNOWN_TOPIC_OR_PARTITION") {
+		t.Errorf("decodeMetadata error = %v, want UNKNOWN_TOPIC_OR_PARTITION", err)
+	}
+	// a huge array length must not be trusted
+	c = &client{topic: "events", addrs: make(map[int32]string)}
+	if err := c.decodeMetadata(&decoder{b: []byte{0x7f, 0xff, 0xff, 0xff, 0x00}}); err == nil {
+		t.Errorf("decodeMetadata of an array longer than the response succeeded")
+	}
+}
+
+// fetchResponse returns the records of partition 0 with the high watermark high
+func fetchResponse(high byte, records []byte) []byte {
+	return cat(
+		zero32, // throttle time
+		one,    // 1 topic
+		topicEvents,
+		one,                               // 1 partition
+		zero32,                            // partition 0
+		[]byte{0x00, 0x00},                // error code
+		[]byte{0, 0, 0, 0, 0, 0, 0, high}, // high watermark
+		[]byte{0, 0, 0, 0, 0, 0, 0, high}, // last stable offset
+		zero32,                            // no aborted transactions
+		binary.BigEndian.AppendUint32(nil, uint32(len(records))), records,
+	)
+}
+
+func newTestConsumer(follow bool, offset, end int64) (*Consumer, *partition) {
+	p := &partition{id: 0, leader: 1, offset: offset, end: end}
+	return &Consumer{client: &client{topic: "events", partitions: []*partition{p}}, follow: follow}, p
+}
+
+// batchAt returns goldenBatch with another base offset, its CRC isn't checked by the consumer
+func batchAt(baseOffset byte) []byte {
+	b := bytes.Clone(goldenBatch)
+	b[7] = baseOffset
+	return b
+}
+
+func TestDecodeFetch(t *testing.T) {
+	c, p := newTestConsumer(false, 0, 2)
+	if err := c.decodeFetch(&decoder{b: fetchResponse(2, cat(batchAt(0), batchAt(1)))}, c.partitions); err != nil {
+		t.Fatalf("decodeFetch failed: %v", err)
+	}
+	if len(c.pending) != 2 || string(c.pending[0]) != "v1" || string(c.pending[1]) != "v1" {
+		t.Errorf("pending = %q, want two v1", c.pending)
+	}
+	if p.offset != 2 || p.high != 2 {
+		t.Errorf("partition at offset %d with high watermark %d, want 2 and 2", p.offset, p.high)
+	}
+}
+
+func TestDecodeRecordBatches(t *testing.T) {
+	gzipBatch := func() []byte {
+		var compressed bytes.Buffer
+		w := gzip.NewWriter(&compressed)
+		w.Write(goldenBatch[61:]) // the records
+		w.Close()
+		b := cat(goldenBatch[:61], compressed.Bytes())
+		binary.BigEndian.PutUint32(b[8:], uint32(len(b)-12))
+		b[22] = 0x01 // attributes: gzip
+		return b
+	}()
+	controlBatch := bytes.Clone(goldenBatch)
+	controlBatch[22] = 0x20
+
+	tests := []struct {
+		name       string
+		follow     bool
+		offset     int64
+		end        int64
+		records    []byte
+		wantValues int
+		wantOffset int64
+		wantErr    string
+	}{
+		{name: "uncompressed", end: 1, records: goldenBatch, wantValues: 1, wantOffset: 1},
+		{name: "gzip", end: 1, records: gzipBatch, wantValues: 1, wantOffset: 1},
+		{name: "control batch skipped", end: 1, records: controlBatch, wantOffset: 1},
+		{name: "records before the offset skipped", offset: 1, end: 2, records: cat(batchAt(0), batchAt(1)), wantValues: 1, wantOffset: 2},
+		{name: "records after the end skipped", end: 1, records: cat(batchAt(0), batchAt(1)), wantValues: 1, wantOffset: 1},
+		{name: "records after the end kept while following", follow: true, records: cat(batchAt(0), batchAt(1)), wantValues: 2, wantOffset: 2},
+		{name: "batch truncated by the fetch size left for the next fetch", end: 2, records: cat(batchAt(0), batchAt(1)[:30]), wantValues: 1, wantOffset: 1},
+		{name: "old message format", end: 1, records: func() []byte { b := bytes.Clone(goldenBatch); b[16] = 1; return b }(), wantErr: "Unsupported record batch version 1"},
+		{name: "snappy", end: 1, records: func() []byte { b := bytes.Clone(goldenBatch); b[22] = 2; return b }(), wantErr: "Unsupported record compression"},
+		{name: "invalid gzip", end: 1, records: func() []byte { b := bytes.Clone(goldenBatch); b[22] = 1; return b }(), wantErr: "gzip"},
+		{name: "truncated record", end: 1, records: func() []byte {
+			b := bytes.Clone(goldenBatch[:len(goldenBatch)-3])
+			binary.BigEndian.PutUint32(b[8:], uint32(len(b)-12))
+			return b
+		}(), wantErr: "Truncated"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, p := newTestConsumer(tt.follow, tt.offset, tt.end)
+			err := c.decodeRecordBatches(tt.records, p)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeRecordBatches failed: %v", err)
+			}
+			if len(c.pending) != tt.wantValues || p.offset != tt.wantOffset {
+				t.Errorf("got %d values at offset %d, want %d at offset %d", len(c.pending), p.offset, tt.wantValues, tt.wantOffset)
+			}
+		})
+	}
+}
+
+func TestDecodeFetchTruncated(t *testing.T) {
+	full := fetchResponse(1, goldenBatch)
+	// cut within the fixed fields, the records themselves may be cut by the fetch size limit
+	recordsStart := len(full) - len(goldenBatch)
+	for n := range recordsStart {
+		c, _ := newTestConsumer(false, 0, 1)
+		if err := c.decodeFetch(&decoder{b: full[:n]}, c.partitions); err == nil {
+			t.Errorf("decodeFetch of the first %d of %d bytes succeeded", n, len(full))
+		}
+	}
+	c, _ := newTestConsumer(false, 0, 1)
+	errorResponse := fetchResponse(1, nil)
+	errorResponse[25] = 0x01 // error code OFFSET_OUT_OF_RANGE
+	if err := c.decodeFetch(&decoder{b: errorResponse}, c.partitions); err == nil || !strings.Contains(err.Error(), "OFFSET_OUT_OF_RANGE") {
+		t.Errorf("decodeFetch error = %v, want OFFSET_OUT_OF_RANGE", err)
+	}
+}
+
+// exchange is a request the fake broker expects and its response, both without the headers
+type exchange struct {
+	apiKey   int16
+	version  int16
+	request  []byte
+	response []byte
+	// check checks the bytes following the request if set, e.g. a batch with the current time
+	check func(t *testing.T, rest []byte)
+}
+
+// fakeBroker answers the exchanges in order, over as many connections as the client opens
+func fakeBroker(t *testing.T, exchanges func(addr string) []exchange) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	pending := exchanges(ln.Addr().String())
+	next := make(chan exchange, len(pending))
+	for _, e := range pending {
+		next <- e
+	}
+	close(next)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveFake(t, conn, next)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func serveFake(t *testing.T, conn net.Conn, next <-chan exchange) {
+	defer conn.Close()
+	var correlationID int32
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return
+		}
+		msg := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(conn, msg); err != nil {
+			t.Errorf("reading request: %v", err)
+			return
+		}
+		e, ok := <-next
+		if !ok {
+			t.Errorf("unexpected request % x", msg)
+			return
+		}
+		correlationID++
+		header := cat(
+			binary.BigEndian.AppendUint16(nil, uint16(e.apiKey)),
+			binary.BigEndian.AppendUint16(nil, uint16(e.version)),
+			binary.BigEndian.AppendUint32(nil, uint32(correlationID)),
+			[]byte{0x00, 0x0e}, []byte("load-generator"),
+		)
+		if !bytes.HasPrefix(msg, header) {
+			t.Errorf("request header % x, want % x", msg[:min(len(msg), len(header))], header)
+			return
+		}
+		body := msg[len(header):]
+		if e.check != nil {
+			if !bytes.HasPrefix(body, e.request) {
+				t.Errorf("request of API %d =\n% x\nwant prefix\n% x", e.apiKey, body, e.request)
+			}
+			e.check(t, body[min(len(e.request), len(body)):])
+		} else if !bytes.Equal(body, e.request) {
+			t.Errorf("request of API %d =\n% x\nwant\n% x", e.apiKey, body, e.request)
+		}
+		response := cat(binary.BigEndian.AppendUint32(nil, uint32(correlationID)), e.response)
+		conn.Write(cat(binary.BigEndian.AppendUint32(nil, uint32(len(response))), response))
+	}
+}
+
+var metadataRequest = cat(one, topicEvents)
+
+func listOffsetsRequest(timestamp []byte) []byte {
+	return cat(minusOne32, one, topicEvents, one, zero32, timestamp)
+}
+
+func listOffsetsResponse(offset byte) []byte {
+	return cat(one, topicEvents, one, zero32, []byte{0x00, 0x00}, minusOne64, []byte{0, 0, 0, 0, 0, 0, 0, offset})
+}
+
+func TestConsumer(t *testing.T) {
+	addr := fakeBroker(t, func(addr string) []exchange {
+		return []exchange{
+			{apiKey: apiMetadata, version: 1, request: metadataRequest, response: metadataResponse(t, addr)},
+			{apiKey: apiListOffsets, version: 1, request: listOffsetsRequest([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfe}), response: listOffsetsResponse(0)},
+			{apiKey: apiListOffsets, version: 1, request: listOffsetsRequest(minusOne64), response: listOffsetsResponse(1)},
+			{apiKey: apiFetch, version: 4, request: cat(
+				minusOne32,
+				[]byte{0x00, 0x00, 0x01, 0xf4}, // max wait 500ms
+				one,                            // min bytes
+				[]byte{0x01, 0x00, 0x00, 0x00}, // max bytes 16 MiB
+				[]byte{0x00},                   // read uncommitted
+				one, topicEvents,
+				one, zero32, zero64, // partition 0 at offset 0
+				[]byte{0x00, 0x40, 0x00, 0x00}, // partition max bytes 4 MiB
+			), response: fetchResponse(1, goldenBatch)},
+		}
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c, err := NewConsumer(ctx, addr, "events", false)
+	if err != nil {
+		t.Fatalf("NewConsumer failed: %v", err)
+	}
+	defer c.Close()
+	if c.Lag() != 1 {
+		t.Errorf("lag %d, want 1", c.Lag())
+	}
+	value, err := c.Next(ctx)
+	if err != nil || string(value) != "v1" {
+		t.Fatalf("Next = %q, %v, want v1", value, err)
+	}
+	if _, err := c.Next(ctx); err != io.EOF {
+		t.Errorf("Next at the end = %v, want io.EOF", err)
+	}
+}
+
+func TestProducer(t *testing.T) {
+	records := []Record{{Key: []byte("k"), Value: []byte("v1")}}
+	produceRequest := cat(
+		[]byte{0xff, 0xff},             // transactional ID null
+		[]byte{0xff, 0xff},             // acks -1
+		[]byte{0x00, 0x00, 0x75, 0x30}, // timeout 30s
+		one, topicEvents,
+		one, zero32, // partition 0
+		[]byte{0x00, 0x00, 0x00, byte(len(goldenBatch))},
+	)
+	checkBatch := func(t *testing.T, batch []byte) {
+		if len(batch) != len(goldenBatch) {
+			t.Fatalf("batch of %d bytes, want %d", len(batch), len(goldenBatch))
+		}
+		produced := time.UnixMilli(int64(binary.BigEndian.Uint64(batch[27:])))
+		if want := recordBatch(records, produced); !bytes.Equal(batch, want) {
+			t.Errorf("batch =\n% x\nwant\n% x", batch, want)
+		}
+		// apart from the CRC and the timestamps the batch is the golden one
+		if !bytes.Equal(batch[:17], goldenBatch[:17]) || !bytes.Equal(batch[21:27], goldenBatch[21:27]) || !bytes.Equal(batch[43:], goldenBatch[43:]) {
+			t.Errorf("batch =\n% x\ndiffers from the golden batch\n% x", batch, goldenBatch)
+		}
+	}
+	produceResponse := func(code byte) []byte {
+		return cat(one, topicEvents, one, zero32, []byte{0x00, code}, []byte{0, 0, 0, 0, 0, 0, 0, 5}, minusOne64, zero32)
+	}
+	addr := fakeBroker(t, func(addr string) []exchange {
+		return []exchange{
+			{apiKey: apiMetadata, version: 1, request: metadataRequest, response: metadataResponse(t, addr)},
+			{apiKey: apiProduce, version: 3, request: produceRequest, response: produceResponse(0), check: checkBatch},
+			{apiKey: apiProduce, version: 3, request: produceRequest, response: produceResponse(6), check: checkBatch},
+		}
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	p, err := NewProducer(ctx, addr, "events", -1)
+	if err != nil {
+		t.Fatalf("NewProducer failed: %v", err)
+	}
+	defer p.Close()
+	if err := p.Produce(ctx, 0, records); err != nil {
+		t.Errorf("Produce failed: %v", err)
+	}
+	if err := p.Produce(ctx, 0, records); err == nil || !strings.Contains(err.Error(), "NOT_LEADER_OR_FOLLOWER") {
+		t.Errorf("Produce error = %v, want NOT_LEADER_OR_FOLLOWER", err)
+	}
+}
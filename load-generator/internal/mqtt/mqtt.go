@@ -0,0 +1,375 @@
+// Package mqtt publishes and subscribes to messages of an MQTT broker using the subset of MQTT 3.1.1 needed for it:
+// clean sessions, QoS 0 and 1, and keep-alive pings
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// control packet types
+const (
+	packetConnect    = 1
+	packetConnack    = 2
+	packetPublish    = 3
+	packetPuback     = 4
+	packetSubscribe  = 8
+	packetSuback     = 9
+	packetPingreq    = 12
+	packetPingresp   = 13
+	packetDisconnect = 14
+)
+
+const (
+	keepAlive         = 30 * time.Second
+	connectTimeout    = 10 * time.Second
+	maxInflight       = 256 // unacknowledged QoS 1 messages
+	receiveBufferSize = 4096
+)
+
+var connackErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "client identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// Options of the connection, username and password are optional
+type Options struct {
+	ClientID string
+	Username string
+	Password string
+}
+
+// Client is a connection to a broker. Publish may be called concurrently,
+// received messages of subscriptions are returned by Next.
+type Client struct {
+	conn     net.Conn
+	writeMu  sync.Mutex
+	w        *bufio.Writer
+	inflight chan struct{} // a slot per unacknowledged QoS 1 message
+	acks     sync.WaitGroup
+
+	mu       sync.Mutex
+	nextID   uint16
+	pending  map[uint16]bool // packet IDs of unacknowledged QoS 1 messages
+	subacks  map[uint16]chan byte
+	messages chan []byte
+	done     chan struct{}
+	err      error // why the connection ended
+}
+
+// Dial connects to the broker at host:port
+func Dial(ctx context.Context, addr string, opts Options) (*Client, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("Connecting to MQTT broker %s: %w", addr, err)
+	}
+	c := &Client{
+		conn:     conn,
+		w:        bufio.NewWriter(conn),
+		inflight: make(chan struct{}, maxInflight),
+		pending:  make(map[uint16]bool),
+		subacks:  make(map[uint16]chan byte),
+		messages: make(chan []byte, receiveBufferSize),
+		done:     make(chan struct{}),
+	}
+
+	var payload []byte
+	payload = appendString(payload, opts.ClientID)
+	flags := byte(0x02) // clean session
+	if opts.Username != "" {
+		flags |= 0x80
+		payload = appendString(payload, opts.Username)
+		if opts.Password != "" {
+			flags |= 0x40
+			payload = appendString(payload, opts.Password)
+		}
+	}
+	header := appendString(nil, "MQTT")
+	header = append(header, 4, flags) // protocol level of 3.1.1
+	header = binary.BigEndian.AppendUint16(header, uint16(keepAlive/time.Second))
+	conn.SetDeadline(time.Now().Add(connectTimeout))
+	if err := c.write(packetConnect<<4, append(header, payload...)); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Sending MQTT CONNECT: %w", err)
+	}
+	r := bufio.NewReader(conn)
+	typ, body, err := readPacket(r)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Reading MQTT CONNACK: %w", err)
+	}
+	if typ>>4 != packetConnack || len(body) != 2 {
+		conn.Close()
+		return nil, fmt.Errorf("Expected MQTT CONNACK, got packet type %d", typ>>4)
+	}
+	if code := body[1]; code != 0 {
+		conn.Close()
+		return nil, fmt.Errorf("MQTT broker refused the connection: %s", connackErrors[code])
+	}
+	conn.SetDeadline(time.Time{})
+
+	go c.readLoop(r)
+	go c.pingLoop()
+	return c, nil
+}
+
+// Publish sends the message to the topic. QoS 1 messages are acknowledged by the broker asynchronously,
+// Publish blocks while too many are unacknowledged, Flush waits for all of them.
+func (c *Client) Publish(ctx context.Context, topic string, payload []byte, qos byte) error {
+	body := appendString(nil, topic)
+	flags := byte(packetPublish << 4)
+	if qos > 0 {
+		select {
+		case c.inflight <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.done:
+			return c.closedErr()
+		}
+		c.mu.Lock()
+		id := c.packetID()
+		c.pending[id] = true
+		c.mu.Unlock()
+		c.acks.Add(1)
+		flags |= 1 << 1
+		body = binary.BigEndian.AppendUint16(body, id)
+	}
+	return c.write(flags, append(body, payload...))
+}
+
+// Flush waits until the broker acknowledged all QoS 1 messages
+func (c *Client) Flush(ctx context.Context) error {
+	acked := make(chan struct{})
+	go func() {
+		c.acks.Wait()
+		close(acked)
+	}()
+	select {
+	case <-acked:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.done:
+		return c.closedErr()
+	}
+}
+
+// Subscribe subscribes to the topic filter, e.g. scooters/+/events, with the maximum QoS of the messages
+func (c *Client) Subscribe(ctx context.Context, filter string, qos byte) error {
+	c.mu.Lock()
+	id := c.packetID()
+	ack := make(chan byte, 1)
+	c.subacks[id] = ack
+	c.mu.Unlock()
+
+	body := binary.BigEndian.AppendUint16(nil, id)
+	body = appendString(body, filter)
+	body = append(body, qos)
+	if err := c.write(packetSubscribe<<4|0x02, body); err != nil {
+		return err
+	}
+	select {
+	case code := <-ack:
+		if code == 0x80 {
+			return fmt.Errorf("MQTT broker rejected the subscription to %s", filter)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.done:
+		return c.closedErr()
+	}
+}
+
+// Next returns the payload of the next message of the subscriptions
+func (c *Client) Next(ctx context.Context) ([]byte, error) {
+	select {
+	case msg := <-c.messages:
+		return msg, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.done:
+		// deliver the messages received before the connection ended
+		select {
+		case msg := <-c.messages:
+			return msg, nil
+		default:
+			return nil, c.closedErr()
+		}
+	}
+}
+
+// Close disconnects from the broker
+func (c *Client) Close() error {
+	c.write(packetDisconnect<<4, nil)
+	return c.conn.Close()
+}
+
+func (c *Client) closedErr() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// packetID returns the next non-zero packet identifier, c.mu has to be held
+func (c *Client) packetID() uint16 {
+	c.nextID++
+	if c.nextID == 0 {
+		c.nextID = 1
+	}
+	return c.nextID
+}
+
+func (c *Client) write(header byte, body []byte) error {
+	// the broker may have closed the connection without the write failing yet
+	select {
+	case <-c.done:
+		return c.closedErr()
+	default:
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.w.WriteByte(header)
+	c.w.Write(appendLength(nil, len(body)))
+	c.w.Write(body)
+	return c.w.Flush()
+}
+
+func (c *Client) readLoop(r *bufio.Reader) {
+	err := c.read(r)
+	c.mu.Lock()
+	if errors.Is(err, net.ErrClosed) || err == io.EOF {
+		err = errors.New("MQTT connection closed")
+	}
+	c.err = err
+	c.mu.Unlock()
+	close(c.done)
+}
+
+func (c *Client) read(r *bufio.Reader) error {
+	for {
+		typ, body, err := readPacket(r)
+		if err != nil {
+			return err
+		}
+		switch typ >> 4 {
+		case packetPublish:
+			qos := (typ >> 1) & 3
+			if len(body) < 2 {
+				return errors.New("Truncated MQTT PUBLISH")
+			}
+			topicLen := int(binary.BigEndian.Uint16(body))
+			payloadStart := 2 + topicLen
+			if qos > 0 {
+				payloadStart += 2
+			}
+			if payloadStart > len(body) {
+				return errors.New("Truncated MQTT PUBLISH")
+			}
+			c.messages <- body[payloadStart:]
+			if qos > 0 {
+				c.write(packetPuback<<4, body[2+topicLen:payloadStart])
+			}
+		case packetPuback:
+			if len(body) < 2 {
+				return errors.New("Truncated MQTT PUBACK")
+			}
+			id := binary.BigEndian.Uint16(body)
+			c.mu.Lock()
+			acked := c.pending[id]
+			delete(c.pending, id)
+			c.mu.Unlock()
+			if acked {
+				<-c.inflight
+				c.acks.Done()
+			}
+		case packetSuback:
+			if len(body) < 3 {
+				return errors.New("Truncated MQTT SUBACK")
+			}
+			id := binary.BigEndian.Uint16(body)
+			c.mu.Lock()
+			ack, ok := c.subacks[id]
+			delete(c.subacks, id)
+			c.mu.Unlock()
+			if ok {
+				ack <- body[2]
+			}
+		case packetPingresp:
+		default:
+			return fmt.Errorf("Unexpected MQTT packet type %d", typ>>4)
+		}
+	}
+}
+
+func (c *Client) pingLoop() {
+	ticker := time.NewTicker(keepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.write(packetPingreq<<4, nil)
+		}
+	}
+}
+
+// readPacket reads the fixed header byte and the body of a packet
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	typ, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		if i == 4 {
+			return 0, nil, errors.New("Invalid MQTT remaining length")
+		}
+		length += int(b&0x7f) * multiplier
+		multiplier *= 128
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return typ, body, nil
+}
+
+// appendLength appends the variable length encoding of the remaining length
+func appendLength(b []byte, n int) []byte {
+	for {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if n == 0 {
+			return b
+		}
+	}
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
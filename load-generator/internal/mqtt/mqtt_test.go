@@ -0,0 +1,242 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The golden packets follow the MQTT 3.1.1 specification byte by byte
+
+func TestAppendLength(t *testing.T) {
+	for n, want := range map[int][]byte{
+		0:         {0x00},
+		127:       {0x7f},
+		128:       {0x80, 0x01},
+		16383:     {0xff, 0x7f},
+		16384:     {0x80, 0x80, 0x01},
+		268435455: {0xff, 0xff, 0xff, 0x7f},
+	} {
+		if got := appendLength(nil, n); !bytes.Equal(got, want) {
+			t.Errorf("appendLength(%d) = % x, want % x", n, got, want)
+		}
+	}
+}
+
+func TestReadPacket(t *testing.T) {
+	long := bytes.Repeat([]byte{'x'}, 200)
+	tests := []struct {
+		name     string
+		input    []byte
+		wantTyp  byte
+		wantBody []byte
+		wantErr  string
+	}{
+		{name: "PINGRESP", input: []byte{0xd0, 0x00}, wantTyp: 0xd0, wantBody: []byte{}},
+		{name: "PUBACK", input: []byte{0x40, 0x02, 0x00, 0x07}, wantTyp: 0x40, wantBody: []byte{0x00, 0x07}},
+		{name: "two length bytes", input: append([]byte{0x30, 0xc8, 0x01}, long...), wantTyp: 0x30, wantBody: long},
+		{name: "empty", input: nil, wantErr: "EOF"},
+		{name: "without length", input: []byte{0x30}, wantErr: "EOF"},
+		{name: "unterminated length", input: []byte{0x30, 0x80}, wantErr: "EOF"},
+		{name: "length of five bytes", input: []byte{0x30, 0xff, 0xff, 0xff, 0xff, 0x01}, wantErr: "Invalid MQTT remaining length"},
+		{name: "truncated body", input: []byte{0x30, 0x05, 0x00, 0x01}, wantErr: "unexpected EOF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			typ, body, err := readPacket(bufio.NewReader(bytes.NewReader(tt.input)))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("readPacket error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || typ != tt.wantTyp || !bytes.Equal(body, tt.wantBody) {
+				t.Errorf("readPacket = %#x, % x, %v, want %#x, % x", typ, body, err, tt.wantTyp, tt.wantBody)
+			}
+		})
+	}
+}
+
+// fakeBroker accepts one connection and hands it to serve
+func fakeBroker(t *testing.T, serve func(conn net.Conn)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+		serve(conn)
+	}()
+	return ln.Addr().String()
+}
+
+// expect reads the packet the client has to send next
+func expect(t *testing.T, conn net.Conn, name string, want []byte) bool {
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(conn, got); err != nil {
+		t.Errorf("reading %s: %v", name, err)
+		return false
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s =\n% x\nwant\n% x", name, got, want)
+		return false
+	}
+	return true
+}
+
+var (
+	connect = []byte{
+		0x10, 0x0f, // CONNECT of 15 bytes
+		0x00, 0x04, 'M', 'Q', 'T', 'T', 0x04, // protocol name and level 3.1.1
+		0x02,       // clean session
+		0x00, 0x1e, // keep alive 30s
+		0x00, 0x03, 'g', 'e', 'n', // client ID
+	}
+	connack = []byte{0x20, 0x02, 0x00, 0x00}
+)
+
+func TestClient(t *testing.T) {
+	addr := fakeBroker(t, func(conn net.Conn) {
+		if !expect(t, conn, "CONNECT", []byte{
+			0x10, 0x15,
+			0x00, 0x04, 'M', 'Q', 'T', 'T', 0x04,
+			0xc2, // user name, password and clean session
+			0x00, 0x1e,
+			0x00, 0x03, 'g', 'e', 'n',
+			0x00, 0x01, 'u', // user name
+			0x00, 0x01, 'p', // password
+		}) {
+			return
+		}
+		conn.Write(connack)
+		if !expect(t, conn, "SUBSCRIBE", []byte{0x82, 0x08, 0x00, 0x01, 0x00, 0x03, 's', '/', '+', 0x01}) {
+			return
+		}
+		conn.Write([]byte{0x90, 0x03, 0x00, 0x01, 0x01}) // granted QoS 1
+		conn.Write([]byte{0x32, 0x07, 0x00, 0x01, 't', 0x00, 0x07, 'h', 'i'})
+		if !expect(t, conn, "PUBACK", []byte{0x40, 0x02, 0x00, 0x07}) {
+			return
+		}
+		conn.Write([]byte{0x30, 0x05, 0x00, 0x01, 't', 'q', '0'})
+		if !expect(t, conn, "PUBLISH", []byte{0x32, 0x07, 0x00, 0x01, 't', 0x00, 0x02, 'o', 'k'}) {
+			return
+		}
+		conn.Write([]byte{0x40, 0x02, 0x00, 0x02})
+		if !expect(t, conn, "PUBLISH", []byte{0x30, 0x05, 0x00, 0x01, 't', 'q', '0'}) {
+			return
+		}
+		expect(t, conn, "DISCONNECT", []byte{0xe0, 0x00})
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c, err := Dial(ctx, addr, Options{ClientID: "gen", Username: "u", Password: "p"})
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if err := c.Subscribe(ctx, "s/+", 1); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	for _, want := range []string{"hi", "q0"} {
+		if msg, err := c.Next(ctx); err != nil || string(msg) != want {
+			t.Errorf("Next = %q, %v, want %q", msg, err, want)
+		}
+	}
+	if err := c.Publish(ctx, "t", []byte("ok"), 1); err != nil {
+		t.Errorf("Publish failed: %v", err)
+	}
+	if err := c.Flush(ctx); err != nil {
+		t.Errorf("Flush failed: %v", err)
+	}
+	if err := c.Publish(ctx, "t", []byte("q0"), 0); err != nil {
+		t.Errorf("Publish failed: %v", err)
+	}
+	c.Close()
+}
+
+func TestDialRefused(t *testing.T) {
+	tests := []struct {
+		name    string
+		reply   []byte
+		wantErr string
+	}{
+		{"not authorized", []byte{0x20, 0x02, 0x00, 0x05}, "refused the connection: not authorized"},
+		{"no CONNACK", []byte{0xd0, 0x00}, "Expected MQTT CONNACK, got packet type 13"},
+		{"CONNACK too long", []byte{0x20, 0x03, 0x00, 0x00, 0x00}, "Expected MQTT CONNACK"},
+		{"truncated CONNACK", []byte{0x20, 0x02, 0x00}, "Reading MQTT CONNACK"},
+		{"closed", nil, "Reading MQTT CONNACK"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := fakeBroker(t, func(conn net.Conn) {
+				if expect(t, conn, "CONNECT", connect) {
+					conn.Write(tt.reply)
+				}
+			})
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			c, err := Dial(ctx, addr, Options{ClientID: "gen"})
+			if err == nil {
+				c.Close()
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Dial error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReadMalformed(t *testing.T) {
+	tests := []struct {
+		name    string
+		packet  []byte
+		wantErr string
+	}{
+		{"PUBLISH without topic length", []byte{0x30, 0x01, 0x00}, "Truncated MQTT PUBLISH"},
+		{"PUBLISH topic beyond the packet", []byte{0x30, 0x03, 0x00, 0x05, 't'}, "Truncated MQTT PUBLISH"},
+		{"QoS 1 PUBLISH without packet ID", []byte{0x32, 0x03, 0x00, 0x01, 't'}, "Truncated MQTT PUBLISH"},
+		{"truncated PUBACK", []byte{0x40, 0x01, 0x00}, "Truncated MQTT PUBACK"},
+		{"truncated SUBACK", []byte{0x90, 0x02, 0x00, 0x01}, "Truncated MQTT SUBACK"},
+		{"CONNECT from the broker", []byte{0x10, 0x00}, "Unexpected MQTT packet type 1"},
+		{"invalid remaining length", []byte{0x30, 0xff, 0xff, 0xff, 0xff, 0x01}, "Invalid MQTT remaining length"},
+		{"truncated packet", []byte{0x30, 0x05, 0x00}, "unexpected EOF"},
+		{"closed", nil, "MQTT connection closed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := fakeBroker(t, func(conn net.Conn) {
+				if expect(t, conn, "CONNECT", connect) {
+					conn.Write(connack)
+					conn.Write(tt.packet)
+				}
+			})
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			c, err := Dial(ctx, addr, Options{ClientID: "gen"})
+			if err != nil {
+				t.Fatalf("Dial failed: %v", err)
+			}
+			defer c.Close()
+			msg, err := c.Next(ctx)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Next = %q, %v, want an error containing %q", msg, err, tt.wantErr)
+			}
+			// the other calls fail with the error of the connection too
+			if err := c.Publish(ctx, "t", nil, 1); err == nil {
+				t.Errorf("Publish on the ended connection succeeded")
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package osm
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"load-generator/internal/geo"
+	"load-generator/internal/workload"
+)
+
+// ExtractOptions selects the elements of an extract converted to POIs and localities
+type ExtractOptions struct {
+	// tag keys of nodes that are POIs, the value is the category, e.g. amenity=restaurant
+	POIKeys []string
+	// admin_level of the boundary relations that are localities, e.g. 10 for the Ortsteile of Berlin
+	AdminLevel string
+	// only POIs and localities within the bounding box are extracted if set, for extracts of a larger region
+	BBox *workload.BBox
+}
+
+// ExtractStats counts the elements found and skipped by Extract
+type ExtractStats struct {
+	POIs               int
+	Localities         int
+	SkippedLocalities  int // boundaries whose member ways don't form closed rings, e.g. cut off by the extract
+	OutsideBBox        int // POIs and boundaries outside of the bounding box
+	BoundaryRelations  int
+	ReferencedWays     int
+	ReferencedNodes    int
+	MissingMemberNodes int
+}
+
+// Extract reads the named nodes with one of the POI keys as POIs and the named administrative boundaries
+// of the admin level as localities from a PBF extract. The file is read three times: for the nodes and relations,
+// for the ways of the boundaries and for the coordinates of their nodes. IDs are UUIDs derived from the OSM IDs,
+// so extracting the same file again yields the same IDs.
+func Extract(filename string, opts ExtractOptions, logger *slog.Logger) ([]workload.POI, []workload.Locality, ExtractStats, error) {
+	var stats ExtractStats
+	var pois []workload.POI
+	var boundaries []Relation
+	memberWays := make(map[int64][]int64)
+
+	err := readFile(filename, Handler{
+		Node: func(n Node) {
+			name, ok := n.Tags["name"]
+			if !ok {
+				return
+			}
+			if opts.BBox != nil && !opts.BBox.Contains(n.Lon, n.Lat) {
+				stats.OutsideBBox++
+				return
+			}
+			for _, key := range opts.POIKeys {
+				category, ok := n.Tags[key]
+				if !ok {
+					continue
+				}
+				if category == "yes" {
+					category = key
+				}
+				pois = append(pois, workload.POI{
+					POIID:     elementUUID("node", n.ID),
+					Name:      name,
+					Category:  category,
+					Longitude: strconv.FormatFloat(n.Lon, 'f', 7, 64),
+					Latitude:  strconv.FormatFloat(n.Lat, 'f', 7, 64),
+				})
+				return
+			}
+		},
+		Relation: func(r Relation) {
+			if r.Tags["boundary"] != "administrative" || r.Tags["admin_level"] != opts.AdminLevel || r.Tags["name"] == "" {
+				return
+			}
+			boundaries = append(boundaries, r)
+			for _, m := range r.Members {
+				if m.Type == MemberWay {
+					memberWays[m.ID] = nil
+				}
+			}
+		},
+	})
+	if err != nil {
+		return nil, nil, stats, err
+	}
+	stats.POIs = len(pois)
+	stats.BoundaryRelations = len(boundaries)
+	stats.ReferencedWays = len(memberWays)
+
+	nodes := make(map[int64][2]float64)
+	if len(boundaries) > 0 {
+		needed := make(map[int64]bool)
+		err = readFile(filename, Handler{Way: func(w Way) {
+			if _, ok := memberWays[w.ID]; ok {
+				memberWays[w.ID] = w.Refs
+				for _, ref := range w.Refs {
+					needed[ref] = true
+				}
+			}
+		}})
+		if err != nil {
+			return nil, nil, stats, err
+		}
+		err = readFile(filename, Handler{Node: func(n Node) {
+			if needed[n.ID] {
+				nodes[n.ID] = [2]float64{n.Lon, n.Lat}
+			}
+		}})
+		if err != nil {
+			return nil, nil, stats, err
+		}
+		stats.ReferencedNodes = len(needed)
+		stats.MissingMemberNodes = len(needed) - len(nodes)
+	}
+
+	var localities []workload.Locality
+	for _, boundary := range boundaries {
+		// boundaries are judged by the first node of their first way, their coordinates are only known now
+		if opts.BBox != nil {
+			if refs := memberWays[firstMemberWay(boundary)]; len(refs) > 0 {
+				if c, ok := nodes[refs[0]]; ok && !opts.BBox.Contains(c[0], c[1]) {
+					stats.OutsideBBox++
+					continue
+				}
+			}
+		}
+		geometry, err := boundaryGeometry(boundary, memberWays, nodes)
+		if err != nil {
+			stats.SkippedLocalities++
+			logger.Warn("Skipping boundary", "relationId", boundary.ID, "name", boundary.Tags["name"], "error", err)
+			continue
+		}
+		localities = append(localities, workload.Locality{
+			LocalityID: elementUUID("relation", boundary.ID),
+			Name:       boundary.Tags["name"],
+			Geometry:   geometry,
+		})
+	}
+	stats.Localities = len(localities)
+	return pois, localities, stats, nil
+}
+
+func firstMemberWay(r Relation) int64 {
+	for _, m := range r.Members {
+		if m.Type == MemberWay {
+			return m.ID
+		}
+	}
+	return 0
+}
+
+func readFile(filename string, h Handler) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("Opening OSM extract: %w", err)
+	}
+	defer f.Close()
+	if err := Read(f, h); err != nil {
+		return fmt.Errorf("Reading OSM extract %s: %w", filename, err)
+	}
+	return nil
+}
+
+// elementUUID derives a version 5 style UUID from the element type and ID
+func elementUUID(elementType string, id int64) string {
+	b := sha1.Sum([]byte(fmt.Sprintf("openstreetmap.org/%s/%d", elementType, id)))
+	b[6] = (b[6] & 0x0f) | 0x50
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// boundaryGeometry joins the outer and inner member ways of the boundary to rings and returns a GeoJSON MultiPolygon,
+// with each inner ring assigned to the outer ring containing it and the rings oriented following RFC 7946
+func boundaryGeometry(boundary Relation, memberWays map[int64][]int64, nodes map[int64][2]float64) (json.RawMessage, error) {
+	var outerWays, innerWays [][]int64
+	for _, m := range boundary.Members {
+		if m.Type != MemberWay {
+			continue
+		}
+		refs := memberWays[m.ID]
+		if len(refs) < 2 {
+			return nil, fmt.Errorf("Member way %d is missing in the extract", m.ID)
+		}
+		switch m.Role {
+		case "outer", "":
+			outerWays = append(outerWays, refs)
+		case "inner":
+			innerWays = append(innerWays, refs)
+		}
+	}
+	outerRings, err := joinRings(outerWays, nodes)
+	if err != nil {
+		return nil, err
+	}
+	if len(outerRings) == 0 {
+		return nil, fmt.Errorf("Boundary %d without outer ways", boundary.ID)
+	}
+	innerRings, err := joinRings(innerWays, nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	polygons := make([][][][2]float64, len(outerRings))
+	for i, outer := range outerRings {
+		polygons[i] = [][][2]float64{outer}
+	}
+	for _, inner := range innerRings {
+		for i, outer := range outerRings {
+			if geo.ContainsPoint(outer, inner[0]) {
+				polygons[i] = append(polygons[i], inner)
+				break
+			}
+		}
+	}
+	geometry, err := json.Marshal(map[string]any{"type": "MultiPolygon", "coordinates": polygons})
+	if err != nil {
+		return nil, err
+	}
+	return workload.FixRings(geometry)
+}
+
+// joinRings joins ways sharing end nodes to closed rings of coordinates
+func joinRings(ways [][]int64, nodes map[int64][2]float64) ([][][2]float64, error) {
+	remaining := append([][]int64(nil), ways...)
+	var rings [][][2]float64
+	for len(remaining) > 0 {
+		ring := append([]int64(nil), remaining[0]...)
+		remaining = remaining[1:]
+		for ring[0] != ring[len(ring)-1] {
+			joined := false
+			for i, way := range remaining {
+				last := ring[len(ring)-1]
+				switch last {
+				case way[0]:
+					ring = append(ring, way[1:]...)
+				case way[len(way)-1]:
+					for j := len(way) - 2; j >= 0; j-- {
+						ring = append(ring, way[j])
+					}
+				default:
+					continue
+				}
+				remaining = append(remaining[:i], remaining[i+1:]...)
+				joined = true
+				break
+			}
+			if !joined {
+				return nil, fmt.Errorf("Ring starting at node %d is not closed", ring[0])
+			}
+		}
+		if len(ring) < 4 {
+			return nil, fmt.Errorf("Ring starting at node %d has less than 4 nodes", ring[0])
+		}
+
+		coordinates := make([][2]float64, len(ring))
+		for i, ref := range ring {
+			c, ok := nodes[ref]
+			if !ok {
+				return nil, fmt.Errorf("Node %d is missing in the extract", ref)
+			}
+			coordinates[i] = c
+		}
+		rings = append(rings, coordinates)
+	}
+	return rings, nil
+}
@@ -0,0 +1,102 @@
+package osm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"load-generator/internal/workload"
+)
+
+// DefaultOverpassURL is the interpreter endpoint of the main public Overpass API instance
+const DefaultOverpassURL = "https://overpass-api.de/api/interpreter"
+
+// OverpassQuery builds the Overpass QL query of the named nodes, ways and relations with one of the categories
+// within the bounding box. A category is a tag key, e.g. shop, or a tag key and value, e.g. amenity=cafe.
+func OverpassQuery(categories []string, bbox workload.BBox, timeout time.Duration) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "[out:json][timeout:%d];\n(\n", int(timeout.Seconds()))
+	for _, category := range categories {
+		key, value, hasValue := strings.Cut(category, "=")
+		filter := strconv.Quote(key)
+		if hasValue {
+			filter += "=" + strconv.Quote(value)
+		}
+		fmt.Fprintf(&sb, "  nwr[%s][\"name\"](%g,%g,%g,%g);\n", filter, bbox.MinLat, bbox.MinLon, bbox.MaxLat, bbox.MaxLon)
+	}
+	sb.WriteString(");\nout center;\n")
+	return sb.String()
+}
+
+// QueryOverpassPOIs runs the query of OverpassQuery and returns the elements as POIs, ways and relations at their center.
+// The category of a POI is the value of the first matching key, or the key for the value yes like Extract.
+// The POIs have no IDs yet.
+func QueryOverpassPOIs(ctx context.Context, endpoint string, categories []string, bbox workload.BBox, timeout time.Duration) ([]workload.POI, error) {
+	query := OverpassQuery(categories, bbox, timeout)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(url.Values{"data": {query}}.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", "load-generator enrich-pois")
+	client := &http.Client{Timeout: timeout + 30*time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Querying Overpass API: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("Overpass API responded with status %s, 429 and 504 mean the instance is busy, retry later: %s", resp.Status, body)
+	}
+
+	var result struct {
+		Remark   string `json:"remark"`
+		Elements []struct {
+			Type   string                      `json:"type"`
+			Lat    float64                     `json:"lat"`
+			Lon    float64                     `json:"lon"`
+			Center *struct{ Lat, Lon float64 } `json:"center"`
+			Tags   map[string]string           `json:"tags"`
+		} `json:"elements"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("Parsing Overpass API response: %w", err)
+	}
+	// runtime errors such as timeouts are reported as remark of an otherwise successful response
+	if strings.Contains(result.Remark, "error") {
+		return nil, fmt.Errorf("Overpass API query failed: %s", result.Remark)
+	}
+
+	pois := make([]workload.POI, 0, len(result.Elements))
+	for _, e := range result.Elements {
+		lat, lon := e.Lat, e.Lon
+		if e.Center != nil {
+			lat, lon = e.Center.Lat, e.Center.Lon
+		}
+		for _, category := range categories {
+			key, _, _ := strings.Cut(category, "=")
+			value, ok := e.Tags[key]
+			if !ok {
+				continue
+			}
+			if value == "yes" {
+				value = key
+			}
+			pois = append(pois, workload.POI{
+				Name:      e.Tags["name"],
+				Category:  value,
+				Longitude: strconv.FormatFloat(lon, 'f', 7, 64),
+				Latitude:  strconv.FormatFloat(lat, 'f', 7, 64),
+			})
+			break
+		}
+	}
+	return pois, nil
+}
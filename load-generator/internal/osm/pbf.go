@@ -0,0 +1,390 @@
+// Package osm reads OpenStreetMap PBF extracts
+package osm
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"load-generator/internal/protobuf"
+)
+
+type Node struct {
+	ID       int64
+	Lat, Lon float64
+	Tags     map[string]string
+}
+
+type Way struct {
+	ID   int64
+	Refs []int64 // IDs of the nodes of the way
+	Tags map[string]string
+}
+
+type MemberType int
+
+const (
+	MemberNode MemberType = iota
+	MemberWay
+	MemberRelation
+)
+
+type Member struct {
+	ID   int64
+	Type MemberType
+	Role string
+}
+
+type Relation struct {
+	ID      int64
+	Members []Member
+	Tags    map[string]string
+}
+
+// Handler receives the elements of an extract, elements without a handler are not decoded
+type Handler struct {
+	Node     func(Node)
+	Way      func(Way)
+	Relation func(Relation)
+}
+
+// maximum sizes of the format specification
+const (
+	maxBlobHeaderSize = 64 * 1024
+	maxBlobSize       = 32 * 1024 * 1024
+)
+
+// Read decodes the PBF extract of r and passes its elements to h in file order
+func Read(r io.Reader, h Handler) error {
+	var sizeBuf [4]byte
+	for {
+		if _, err := io.ReadFull(r, sizeBuf[:]); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("Reading blob header size: %w", err)
+		}
+		headerSize := binary.BigEndian.Uint32(sizeBuf[:])
+		if headerSize > maxBlobHeaderSize {
+			return fmt.Errorf("Blob header of %d bytes exceeds the maximum, no PBF file?", headerSize)
+		}
+		header := make([]byte, headerSize)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return fmt.Errorf("Reading blob header: %w", err)
+		}
+		blobType, blobSize, err := parseBlobHeader(header)
+		if err != nil {
+			return err
+		}
+		if blobSize > maxBlobSize {
+			return fmt.Errorf("Blob of %d bytes exceeds the maximum", blobSize)
+		}
+		blob := make([]byte, blobSize)
+		if _, err := io.ReadFull(r, blob); err != nil {
+			return fmt.Errorf("Reading blob: %w", err)
+		}
+		// the OSMHeader blob only describes the file
+		if blobType != "OSMData" {
+			continue
+		}
+		data, err := decompressBlob(blob)
+		if err != nil {
+			return err
+		}
+		if err := decodePrimitiveBlock(data, h); err != nil {
+			return err
+		}
+	}
+}
+
+func parseBlobHeader(b []byte) (string, int, error) {
+	var blobType string
+	blobSize := -1
+	err := protobuf.EachField(b, func(f protobuf.Field) error {
+		switch f.Num {
+		case 1:
+			blobType = string(f.Bytes())
+		case 3:
+			blobSize = int(f.Uint())
+		}
+		return nil
+	})
+	if err == nil && blobSize < 0 {
+		err = errors.New("Blob header without data size")
+	}
+	return blobType, blobSize, err
+}
+
+func decompressBlob(b []byte) ([]byte, error) {
+	var raw, zlibData []byte
+	rawSize := 0
+	err := protobuf.EachField(b, func(f protobuf.Field) error {
+		switch f.Num {
+		case 1:
+			raw = f.Bytes()
+		case 2:
+			rawSize = int(f.Uint())
+		case 3:
+			zlibData = f.Bytes()
+		case 4, 5, 6, 7:
+			return fmt.Errorf("Unsupported blob compression (field %d), only raw and zlib are supported", f.Num)
+		}
+		return nil
+	})
+	if err != nil || raw != nil {
+		return raw, err
+	}
+	if zlibData == nil {
+		return nil, errors.New("Blob without data")
+	}
+	if rawSize < 0 || rawSize > maxBlobSize {
+		return nil, fmt.Errorf("Blob of %d bytes uncompressed exceeds the maximum", rawSize)
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(zlibData))
+	if err != nil {
+		return nil, fmt.Errorf("Decompressing blob: %w", err)
+	}
+	defer zr.Close()
+	buf := bytes.NewBuffer(make([]byte, 0, rawSize))
+	// the declared size can't be trusted, a blob decompressing to more than the maximum is rejected
+	if _, err := io.Copy(buf, io.LimitReader(zr, maxBlobSize+1)); err != nil {
+		return nil, fmt.Errorf("Decompressing blob: %w", err)
+	}
+	if buf.Len() > maxBlobSize {
+		return nil, errors.New("Blob decompresses to more than the maximum")
+	}
+	return buf.Bytes(), nil
+}
+
+// primitiveBlock holds the string table and the coordinate encoding of a block
+type primitiveBlock struct {
+	strings     []string
+	granularity int64
+	latOffset   int64
+	lonOffset   int64
+}
+
+func (b *primitiveBlock) coordinate(offset, value int64) float64 {
+	return float64(offset+b.granularity*value) / 1e9
+}
+
+func (b *primitiveBlock) tags(keys, vals []uint64) (map[string]string, error) {
+	if len(keys) != len(vals) {
+		return nil, errors.New("Different number of tag keys and values")
+	}
+	tags := make(map[string]string, len(keys))
+	for i := range keys {
+		if keys[i] >= uint64(len(b.strings)) || vals[i] >= uint64(len(b.strings)) {
+			return nil, errors.New("Tag refers to a string outside of the string table")
+		}
+		tags[b.strings[keys[i]]] = b.strings[vals[i]]
+	}
+	return tags, nil
+}
+
+func decodePrimitiveBlock(data []byte, h Handler) error {
+	block := &primitiveBlock{granularity: 100}
+	var groups [][]byte
+	err := protobuf.EachField(data, func(f protobuf.Field) error {
+		switch f.Num {
+		case 1:
+			return protobuf.EachField(f.Bytes(), func(s protobuf.Field) error {
+				if s.Num == 1 {
+					block.strings = append(block.strings, string(s.Bytes()))
+				}
+				return nil
+			})
+		case 2:
+			groups = append(groups, f.Bytes())
+		case 17:
+			block.granularity = int64(f.Uint())
+		case 19:
+			block.latOffset = int64(f.Uint())
+		case 20:
+			block.lonOffset = int64(f.Uint())
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Decoding primitive block: %w", err)
+	}
+
+	// the groups are decoded once the string table and offsets are known
+	for _, group := range groups {
+		err := protobuf.EachField(group, func(f protobuf.Field) error {
+			switch {
+			case f.Num == 1 && h.Node != nil:
+				return block.decodeNode(f.Bytes(), h.Node)
+			case f.Num == 2 && h.Node != nil:
+				return block.decodeDenseNodes(f.Bytes(), h.Node)
+			case f.Num == 3 && h.Way != nil:
+				return block.decodeWay(f.Bytes(), h.Way)
+			case f.Num == 4 && h.Relation != nil:
+				return block.decodeRelation(f.Bytes(), h.Relation)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("Decoding primitive group: %w", err)
+		}
+	}
+	return nil
+}
+
+func (b *primitiveBlock) decodeNode(data []byte, handle func(Node)) error {
+	var node Node
+	var keys, vals []uint64
+	var lat, lon int64
+	err := protobuf.EachField(data, func(f protobuf.Field) error {
+		var err error
+		switch f.Num {
+		case 1:
+			node.ID = protobuf.Zigzag(f.Uint())
+		case 2:
+			keys, err = f.Packed()
+		case 3:
+			vals, err = f.Packed()
+		case 8:
+			lat = protobuf.Zigzag(f.Uint())
+		case 9:
+			lon = protobuf.Zigzag(f.Uint())
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if node.Tags, err = b.tags(keys, vals); err != nil {
+		return err
+	}
+	node.Lat, node.Lon = b.coordinate(b.latOffset, lat), b.coordinate(b.lonOffset, lon)
+	handle(node)
+	return nil
+}
+
+func (b *primitiveBlock) decodeDenseNodes(data []byte, handle func(Node)) error {
+	var ids, lats, lons, keysVals []uint64
+	err := protobuf.EachField(data, func(f protobuf.Field) error {
+		var err error
+		switch f.Num {
+		case 1:
+			ids, err = f.Packed()
+		case 8:
+			lats, err = f.Packed()
+		case 9:
+			lons, err = f.Packed()
+		case 10:
+			keysVals, err = f.Packed()
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if len(lats) != len(ids) || len(lons) != len(ids) {
+		return errors.New("Dense nodes with different numbers of IDs and coordinates")
+	}
+
+	var id, lat, lon int64
+	kv := 0
+	for i := range ids {
+		id += protobuf.Zigzag(ids[i])
+		lat += protobuf.Zigzag(lats[i])
+		lon += protobuf.Zigzag(lons[i])
+		node := Node{ID: id, Lat: b.coordinate(b.latOffset, lat), Lon: b.coordinate(b.lonOffset, lon)}
+		// keys_vals holds key and value string IDs of each node terminated by 0, empty if no node has tags
+		if len(keysVals) > 0 {
+			var keys, vals []uint64
+			for kv < len(keysVals) && keysVals[kv] != 0 {
+				if kv+1 >= len(keysVals) {
+					return errors.New("Dense node tag without a value")
+				}
+				keys, vals = append(keys, keysVals[kv]), append(vals, keysVals[kv+1])
+				kv += 2
+			}
+			kv++
+			if node.Tags, err = b.tags(keys, vals); err != nil {
+				return err
+			}
+		}
+		handle(node)
+	}
+	return nil
+}
+
+func (b *primitiveBlock) decodeWay(data []byte, handle func(Way)) error {
+	var way Way
+	var keys, vals, refs []uint64
+	err := protobuf.EachField(data, func(f protobuf.Field) error {
+		var err error
+		switch f.Num {
+		case 1:
+			way.ID = int64(f.Uint())
+		case 2:
+			keys, err = f.Packed()
+		case 3:
+			vals, err = f.Packed()
+		case 8:
+			refs, err = f.Packed()
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if way.Tags, err = b.tags(keys, vals); err != nil {
+		return err
+	}
+	way.Refs = make([]int64, len(refs))
+	var ref int64
+	for i := range refs {
+		ref += protobuf.Zigzag(refs[i])
+		way.Refs[i] = ref
+	}
+	handle(way)
+	return nil
+}
+
+func (b *primitiveBlock) decodeRelation(data []byte, handle func(Relation)) error {
+	var relation Relation
+	var keys, vals, roles, memberIDs, types []uint64
+	err := protobuf.EachField(data, func(f protobuf.Field) error {
+		var err error
+		switch f.Num {
+		case 1:
+			relation.ID = int64(f.Uint())
+		case 2:
+			keys, err = f.Packed()
+		case 3:
+			vals, err = f.Packed()
+		case 8:
+			roles, err = f.Packed()
+		case 9:
+			memberIDs, err = f.Packed()
+		case 10:
+			types, err = f.Packed()
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if relation.Tags, err = b.tags(keys, vals); err != nil {
+		return err
+	}
+	if len(roles) != len(memberIDs) || len(types) != len(memberIDs) {
+		return errors.New("Relation with different numbers of member IDs, roles and types")
+	}
+	var memberID int64
+	for i := range memberIDs {
+		memberID += protobuf.Zigzag(memberIDs[i])
+		if roles[i] >= uint64(len(b.strings)) {
+			return errors.New("Member role outside of the string table")
+		}
+		relation.Members = append(relation.Members, Member{ID: memberID, Type: MemberType(types[i]), Role: b.strings[roles[i]]})
+	}
+	handle(relation)
+	return nil
+}
@@ -0,0 +1,201 @@
+package osm
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// wire types of the protobuf fields the messages are built of
+const (
+	wireVarint = 0
+	wireLen    = 2
+)
+
+// message encodes protobuf fields, the way osmium and osmosis write them
+type message []byte
+
+func (m message) varint(num int, v uint64) message {
+	m = binary.AppendUvarint(m, uint64(num)<<3|wireVarint)
+	return binary.AppendUvarint(m, v)
+}
+
+func (m message) bytes(num int, b []byte) message {
+	m = binary.AppendUvarint(m, uint64(num)<<3|wireLen)
+	m = binary.AppendUvarint(m, uint64(len(b)))
+	return append(m, b...)
+}
+
+func packed(values ...uint64) []byte {
+	var b []byte
+	for _, v := range values {
+		b = binary.AppendUvarint(b, v)
+	}
+	return b
+}
+
+// zz zigzag encodes the signed values of sint64 fields
+func zz(values ...int64) []uint64 {
+	encoded := make([]uint64, len(values))
+	for i, v := range values {
+		encoded[i] = uint64(v<<1) ^ uint64(v>>63)
+	}
+	return encoded
+}
+
+// fileBlock frames a blob with its header as in a PBF file
+func fileBlock(blobType string, blob []byte) []byte {
+	header := message(nil).bytes(1, []byte(blobType)).varint(3, uint64(len(blob)))
+	b := binary.BigEndian.AppendUint32(nil, uint32(len(header)))
+	return append(append(b, header...), blob...)
+}
+
+func zlibBlob(data []byte) []byte {
+	var compressed bytes.Buffer
+	w := zlib.NewWriter(&compressed)
+	w.Write(data)
+	w.Close()
+	return message(nil).varint(2, uint64(len(data))).bytes(3, compressed.Bytes())
+}
+
+// testBlock is a primitive block with a tagged node, two dense nodes, a way and a relation.
+// The string table is "", "amenity", "bench", "highway", "residential", "outer".
+func testBlock() []byte {
+	stringTable := message(nil)
+	for _, s := range []string{"", "amenity", "bench", "highway", "residential", "outer"} {
+		stringTable = stringTable.bytes(1, []byte(s))
+	}
+	node := message(nil).varint(1, zz(-7)[0]).bytes(2, packed(1)).bytes(3, packed(2)).
+		varint(8, zz(525_000_000)[0]).varint(9, zz(134_000_000)[0])
+	// dense nodes 10 and 12, the second tagged amenity=bench
+	dense := message(nil).bytes(1, packed(zz(10, 2)...)).
+		bytes(8, packed(zz(525_100_000, 100)...)).
+		bytes(9, packed(zz(134_100_000, -100)...)).
+		bytes(10, packed(0, 1, 2, 0))
+	way := message(nil).varint(1, 20).bytes(2, packed(3)).bytes(3, packed(4)).bytes(8, packed(zz(10, 2, -5)...))
+	relation := message(nil).varint(1, 30).bytes(8, packed(5, 0)).bytes(9, packed(zz(20, -8)...)).bytes(10, packed(1, 0))
+	group := message(nil).bytes(1, node).bytes(2, dense).bytes(3, way).bytes(4, relation)
+	return message(nil).bytes(1, stringTable).bytes(2, group)
+}
+
+type collected struct {
+	nodes     []Node
+	ways      []Way
+	relations []Relation
+}
+
+func (c *collected) handler() Handler {
+	return Handler{
+		Node:     func(n Node) { c.nodes = append(c.nodes, n) },
+		Way:      func(w Way) { c.ways = append(c.ways, w) },
+		Relation: func(r Relation) { c.relations = append(c.relations, r) },
+	}
+}
+
+func TestRead(t *testing.T) {
+	for name, blob := range map[string][]byte{
+		"raw":  message(nil).bytes(1, testBlock()),
+		"zlib": zlibBlob(testBlock()),
+	} {
+		t.Run(name, func(t *testing.T) {
+			file := append(fileBlock("OSMHeader", message(nil).bytes(1, []byte("ignored"))), fileBlock("OSMData", blob)...)
+			var c collected
+			if err := Read(bytes.NewReader(file), c.handler()); err != nil {
+				t.Fatalf("Read failed: %v", err)
+			}
+			wantNodes := []Node{
+				{ID: -7, Lat: 52.5, Lon: 13.4, Tags: map[string]string{"amenity": "bench"}},
+				{ID: 10, Lat: 52.51, Lon: 13.41},
+				{ID: 12, Lat: 52.51001, Lon: 13.40999, Tags: map[string]string{"amenity": "bench"}},
+			}
+			if len(c.nodes) != len(wantNodes) {
+				t.Fatalf("got %d nodes, want %d", len(c.nodes), len(wantNodes))
+			}
+			for i, want := range wantNodes {
+				got := c.nodes[i]
+				if got.ID != want.ID || !near(got.Lat, want.Lat) || !near(got.Lon, want.Lon) || len(got.Tags) != len(want.Tags) || got.Tags["amenity"] != want.Tags["amenity"] {
+					t.Errorf("node %d = %+v, want %+v", i, got, want)
+				}
+			}
+			wantWays := []Way{{ID: 20, Refs: []int64{10, 12, 7}, Tags: map[string]string{"highway": "residential"}}}
+			if !reflect.DeepEqual(c.ways, wantWays) {
+				t.Errorf("ways = %+v, want %+v", c.ways, wantWays)
+			}
+			wantRelations := []Relation{{ID: 30, Tags: map[string]string{}, Members: []Member{
+				{ID: 20, Type: MemberWay, Role: "outer"},
+				{ID: 12, Type: MemberNode, Role: ""},
+			}}}
+			if !reflect.DeepEqual(c.relations, wantRelations) {
+				t.Errorf("relations = %+v, want %+v", c.relations, wantRelations)
+			}
+		})
+	}
+}
+
+func near(a, b float64) bool {
+	return a-b < 1e-9 && b-a < 1e-9
+}
+
+func TestReadMalformed(t *testing.T) {
+	valid := fileBlock("OSMData", message(nil).bytes(1, testBlock()))
+	block := func(group message) []byte {
+		data := message(nil).bytes(1, message(nil).bytes(1, nil).bytes(1, []byte("k")).bytes(1, []byte("v"))).bytes(2, group)
+		return fileBlock("OSMData", message(nil).bytes(1, data))
+	}
+	oversizedHeader := binary.BigEndian.AppendUint32(nil, maxBlobHeaderSize+1)
+
+	tests := []struct {
+		name    string
+		input   []byte
+		wantErr string
+	}{
+		{"truncated header size", valid[:2], "blob header size"},
+		{"oversized header", oversizedHeader, "exceeds the maximum"},
+		{"truncated header", valid[:6], "Reading blob header"},
+		{"header without data size", func() []byte {
+			header := message(nil).bytes(1, []byte("OSMData"))
+			return append(binary.BigEndian.AppendUint32(nil, uint32(len(header))), header...)
+		}(), "without data size"},
+		{"truncated blob", valid[:len(valid)-3], "Reading blob"},
+		{"blob length beyond header", func() []byte {
+			header := message(nil).bytes(1, []byte("OSMData")).varint(3, maxBlobSize+1)
+			return append(binary.BigEndian.AppendUint32(nil, uint32(len(header))), header...)
+		}(), "exceeds the maximum"},
+		{"field length beyond message", fileBlock("OSMData", []byte{1<<3 | wireLen, 100, 1}), "Invalid length"},
+		{"unterminated varint", fileBlock("OSMData", []byte{2<<3 | wireVarint, 0x80}), "Invalid varint"},
+		{"unsupported wire type", fileBlock("OSMData", []byte{1<<3 | 3}), "Unsupported wire type"},
+		{"lzma compression", fileBlock("OSMData", message(nil).bytes(4, []byte{1})), "Unsupported blob compression"},
+		{"blob without data", fileBlock("OSMData", message(nil).varint(2, 10)), "without data"},
+		{"invalid zlib", fileBlock("OSMData", message(nil).varint(2, 10).bytes(3, []byte("not zlib"))), "Decompressing blob"},
+		{"truncated zlib", func() []byte {
+			blob := zlibBlob(testBlock())
+			return fileBlock("OSMData", message(nil).varint(2, 10).bytes(3, blob[len(blob)-20:len(blob)-5]))
+		}(), "Decompressing blob"},
+		{"oversized raw size", fileBlock("OSMData", message(nil).varint(2, 1<<62).bytes(3, []byte{0x78, 0x9c})), "exceeds the maximum"},
+		{"tag outside of string table", block(message(nil).bytes(1, message(nil).varint(1, 2).bytes(2, packed(1)).bytes(3, packed(9)))), "outside of the string table"},
+		{"tag keys without values", block(message(nil).bytes(1, message(nil).varint(1, 2).bytes(2, packed(1, 2)).bytes(3, packed(1)))), "number of tag keys"},
+		{"invalid packed varint", block(message(nil).bytes(3, message(nil).varint(1, 2).bytes(8, []byte{0x80}))), "Invalid varint in packed field"},
+		{"dense nodes without coordinates", block(message(nil).bytes(2, message(nil).bytes(1, packed(2, 2)).bytes(8, packed(0)))), "different numbers of IDs"},
+		{"dense node tag without value", block(message(nil).bytes(2, message(nil).bytes(1, packed(2)).bytes(8, packed(0)).bytes(9, packed(0)).bytes(10, packed(1)))), "without a value"},
+		{"relation members without roles", block(message(nil).bytes(4, message(nil).varint(1, 3).bytes(9, packed(2)).bytes(10, packed(0)))), "different numbers of member IDs"},
+		{"member role outside of string table", block(message(nil).bytes(4, message(nil).varint(1, 3).bytes(8, packed(7)).bytes(9, packed(2)).bytes(10, packed(0)))), "outside of the string table"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c collected
+			err := Read(bytes.NewReader(tt.input), c.handler())
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Read error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReadEmpty(t *testing.T) {
+	if err := Read(bytes.NewReader(nil), Handler{}); err != nil {
+		t.Errorf("Read of an empty file failed: %v", err)
+	}
+}
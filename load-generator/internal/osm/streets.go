@@ -0,0 +1,88 @@
+package osm
+
+import (
+	"fmt"
+	"slices"
+
+	"load-generator/internal/workload"
+)
+
+// StreetStats counts the elements read by LoadStreets
+type StreetStats struct {
+	Ways         int
+	Segments     int
+	Nodes        int // nodes of the largest connected component trips are routed on
+	MissingNodes int // nodes of street ways missing in the extract, e.g. cut off by it
+}
+
+// LoadStreets reads the ways whose highway tag is one of the highway types as a street graph, honouring oneway tags.
+// The file is read twice: for the ways and for the coordinates of their nodes.
+func LoadStreets(filename string, highways []string) (*workload.StreetGraph, StreetStats, error) {
+	var stats StreetStats
+	var ways []Way
+	index := make(map[int64]int)
+	err := readFile(filename, Handler{Way: func(w Way) {
+		if !slices.Contains(highways, w.Tags["highway"]) || len(w.Refs) < 2 {
+			return
+		}
+		ways = append(ways, w)
+		for _, ref := range w.Refs {
+			if _, ok := index[ref]; !ok {
+				index[ref] = len(index)
+			}
+		}
+	}})
+	if err != nil {
+		return nil, stats, err
+	}
+	stats.Ways = len(ways)
+	if len(ways) == 0 {
+		return nil, stats, fmt.Errorf("No ways with highway %v in the extract", highways)
+	}
+
+	coords := make([][2]float64, len(index))
+	found := make([]bool, len(index))
+	err = readFile(filename, Handler{Node: func(n Node) {
+		if i, ok := index[n.ID]; ok {
+			coords[i] = [2]float64{n.Lon, n.Lat}
+			found[i] = true
+		}
+	}})
+	if err != nil {
+		return nil, stats, err
+	}
+
+	var segments [][2]int
+	var oneway []bool
+	for _, w := range ways {
+		refs := w.Refs
+		switch w.Tags["oneway"] {
+		case "-1", "reverse":
+			refs = slices.Clone(refs)
+			slices.Reverse(refs)
+		}
+		isOneway := w.Tags["oneway"] != "" && w.Tags["oneway"] != "no"
+		for i := 1; i < len(refs); i++ {
+			a, b := index[refs[i-1]], index[refs[i]]
+			// a segment with a node missing in the extract is left out, splitting the way
+			if !found[a] || !found[b] {
+				continue
+			}
+			segments = append(segments, [2]int{a, b})
+			oneway = append(oneway, isOneway)
+		}
+	}
+	for _, ok := range found {
+		if !ok {
+			stats.MissingNodes++
+		}
+	}
+	stats.Segments = len(segments)
+
+	graph, err := workload.NewStreetGraph(coords, segments, oneway)
+	if err != nil {
+		return nil, stats, err
+	}
+	stats.Nodes = graph.NumNodes()
+	return graph, stats, nil
+}
@@ -0,0 +1,200 @@
+package parquet
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// GeometryColumn returns the primary geometry column of a GeoParquet file, geometry without geo metadata
+func (f *File) GeometryColumn() (string, error) {
+	geo, ok := f.Metadata["geo"]
+	if !ok {
+		return "geometry", nil
+	}
+	var meta struct {
+		PrimaryColumn string `json:"primary_column"`
+		Columns       map[string]struct {
+			Encoding string `json:"encoding"`
+		} `json:"columns"`
+	}
+	if err := json.Unmarshal([]byte(geo), &meta); err != nil {
+		return "", fmt.Errorf("Parsing GeoParquet metadata: %w", err)
+	}
+	if meta.PrimaryColumn == "" {
+		meta.PrimaryColumn = "geometry"
+	}
+	if c, ok := meta.Columns[meta.PrimaryColumn]; ok && c.Encoding != "" && c.Encoding != "WKB" {
+		return "", fmt.Errorf("Unsupported GeoParquet geometry encoding %s, only WKB is supported", c.Encoding)
+	}
+	return meta.PrimaryColumn, nil
+}
+
+// WKB geometry types
+const (
+	wkbPoint           = 1
+	wkbLineString      = 2
+	wkbPolygon         = 3
+	wkbMultiPoint      = 4
+	wkbMultiLineString = 5
+	wkbMultiPolygon    = 6
+)
+
+var errWKBTruncated = errors.New("Truncated WKB geometry")
+
+type wkbReader struct {
+	b     []byte
+	pos   int
+	order binary.ByteOrder
+	dims  int
+}
+
+// WKBToGeoJSON converts a WKB geometry, ISO or extended (PostGIS) WKB with optional Z and M values,
+// into a GeoJSON geometry of its X and Y coordinates
+func WKBToGeoJSON(b []byte) (json.RawMessage, error) {
+	r := &wkbReader{b: b}
+	typ, coords, err := r.geometry()
+	if err != nil {
+		return nil, err
+	}
+	if r.pos != len(b) {
+		return nil, errors.New("Trailing bytes after WKB geometry")
+	}
+	return json.RawMessage(`{"type":"` + typ + `","coordinates":` + string(coords) + `}`), nil
+}
+
+func (r *wkbReader) geometry() (string, []byte, error) {
+	if r.pos+5 > len(r.b) {
+		return "", nil, errWKBTruncated
+	}
+	if r.b[r.pos] == 0 {
+		r.order = binary.BigEndian
+	} else {
+		r.order = binary.LittleEndian
+	}
+	typ := r.order.Uint32(r.b[r.pos+1:])
+	r.pos += 5
+
+	// extended WKB flags Z, M and SRID in the high bits, ISO WKB adds 1000, 2000 or 3000
+	r.dims = 2
+	if typ&0x80000000 != 0 {
+		r.dims++
+	}
+	if typ&0x40000000 != 0 {
+		r.dims++
+	}
+	if typ&0x20000000 != 0 {
+		r.pos += 4
+	}
+	typ &= 0x0fffffff
+	switch typ / 1000 {
+	case 1, 2:
+		r.dims = 3
+	case 3:
+		r.dims = 4
+	}
+	typ %= 1000
+
+	var coords []byte
+	var err error
+	switch typ {
+	case wkbPoint:
+		coords, err = r.point()
+		return "Point", coords, err
+	case wkbLineString:
+		coords, err = r.points()
+		return "LineString", coords, err
+	case wkbPolygon:
+		coords, err = r.rings()
+		return "Polygon", coords, err
+	case wkbMultiPoint, wkbMultiLineString, wkbMultiPolygon:
+		n, err := r.count()
+		if err != nil {
+			return "", nil, err
+		}
+		coords = append(coords, '[')
+		for i := range n {
+			if i > 0 {
+				coords = append(coords, ',')
+			}
+			_, part, err := r.geometry()
+			if err != nil {
+				return "", nil, err
+			}
+			coords = append(coords, part...)
+		}
+		coords = append(coords, ']')
+		return [...]string{wkbMultiPoint: "MultiPoint", wkbMultiLineString: "MultiLineString", wkbMultiPolygon: "MultiPolygon"}[typ], coords, nil
+	default:
+		return "", nil, fmt.Errorf("Unsupported WKB geometry type %d", typ)
+	}
+}
+
+func (r *wkbReader) count() (int, error) {
+	if r.pos+4 > len(r.b) {
+		return 0, errWKBTruncated
+	}
+	n := int(r.order.Uint32(r.b[r.pos:]))
+	r.pos += 4
+	if n > (len(r.b)-r.pos)/4 {
+		return 0, errWKBTruncated
+	}
+	return n, nil
+}
+
+func (r *wkbReader) point() ([]byte, error) {
+	if r.pos+8*r.dims > len(r.b) {
+		return nil, errWKBTruncated
+	}
+	x := math.Float64frombits(r.order.Uint64(r.b[r.pos:]))
+	y := math.Float64frombits(r.order.Uint64(r.b[r.pos+8:]))
+	r.pos += 8 * r.dims
+	if math.IsNaN(x) || math.IsNaN(y) {
+		return nil, errors.New("Empty WKB point")
+	}
+	coords := append([]byte{'['}, strconv.FormatFloat(x, 'f', -1, 64)...)
+	coords = append(coords, ',')
+	coords = append(coords, strconv.FormatFloat(y, 'f', -1, 64)...)
+	return append(coords, ']'), nil
+}
+
+func (r *wkbReader) points() ([]byte, error) {
+	n, err := r.count()
+	if err != nil {
+		return nil, err
+	}
+	coords := []byte{'['}
+	for i := range n {
+		if i > 0 {
+			coords = append(coords, ',')
+		}
+		point, err := r.point()
+		if err != nil {
+			return nil, err
+		}
+		coords = append(coords, point...)
+	}
+	return append(coords, ']'), nil
+}
+
+func (r *wkbReader) rings() ([]byte, error) {
+	n, err := r.count()
+	if err != nil {
+		return nil, err
+	}
+	coords := []byte{'['}
+	for i := range n {
+		if i > 0 {
+			coords = append(coords, ',')
+		}
+		ring, err := r.points()
+		if err != nil {
+			return nil, err
+		}
+		coords = append(coords, ring...)
+	}
+	return append(coords, ']'), nil
+}
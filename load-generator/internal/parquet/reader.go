@@ -0,0 +1,439 @@
+// Package parquet reads flat Parquet files into memory: required and optional columns of the primitive types,
+// PLAIN and dictionary encoded, in data pages v1 and v2, uncompressed, snappy or gzip compressed.
+// This covers the GeoParquet files of POIs and localities written by GeoPandas, GDAL and DuckDB.
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// physical types
+const (
+	typeBoolean           = 0
+	typeInt32             = 1
+	typeInt64             = 2
+	typeInt96             = 3
+	typeFloat             = 4
+	typeDouble            = 5
+	typeByteArray         = 6
+	typeFixedLenByteArray = 7
+)
+
+// encodings
+const (
+	encodingPlain           = 0
+	encodingPlainDictionary = 2
+	encodingRLE             = 3
+	encodingRLEDictionary   = 8
+)
+
+// page types
+const (
+	pageData       = 0
+	pageDictionary = 2
+	pageDataV2     = 3
+)
+
+// compression codecs
+const (
+	codecUncompressed = 0
+	codecSnappy       = 1
+	codecGzip         = 2
+)
+
+var magic = []byte("PAR1")
+
+// File is a Parquet file read into memory. Values are nil for nulls, []byte for BYTE_ARRAY and
+// FIXED_LEN_BYTE_ARRAY, int32, int64, float32, float64 or bool otherwise.
+type File struct {
+	NumRows  int
+	Columns  []string
+	Values   map[string][]any
+	Metadata map[string]string // key-value metadata of the footer, e.g. geo for GeoParquet
+}
+
+type column struct {
+	name       string
+	typ        int64
+	typeLength int
+	optional   bool
+}
+
+// Read decodes the Parquet file b
+func Read(b []byte) (*File, error) {
+	if len(b) < 12 || !bytes.Equal(b[:4], magic) || !bytes.Equal(b[len(b)-4:], magic) {
+		return nil, errors.New("No Parquet file, the PAR1 magic is missing")
+	}
+	footerLength := int(binary.LittleEndian.Uint32(b[len(b)-8:]))
+	if footerLength > len(b)-12 {
+		return nil, errors.New("Parquet footer length exceeds the file")
+	}
+	footer := &thriftReader{b: b[len(b)-8-footerLength : len(b)-8]}
+	meta, err := footer.readStruct()
+	if err != nil {
+		return nil, fmt.Errorf("Decoding Parquet footer: %w", err)
+	}
+
+	f := &File{NumRows: int(meta.int(3)), Values: make(map[string][]any), Metadata: make(map[string]string)}
+	for _, kv := range meta.structs(5) {
+		f.Metadata[kv.string(1)] = kv.string(2)
+	}
+	schema := meta.structs(2)
+	if len(schema) == 0 {
+		return nil, errors.New("Parquet file without schema")
+	}
+	var columns []column
+	for _, element := range schema[1:] {
+		if element.int(5) > 0 || element.int(3) == 2 {
+			return nil, fmt.Errorf("Nested or repeated column %q, only flat schemas are supported", element.string(4))
+		}
+		columns = append(columns, column{
+			name:       element.string(4),
+			typ:        element.int(1),
+			typeLength: int(element.int(2)),
+			optional:   element.int(3) == 1,
+		})
+		f.Columns = append(f.Columns, element.string(4))
+	}
+
+	rowGroups := meta.structs(4)
+	rows := int64(0)
+	for _, rowGroup := range rowGroups {
+		if rowGroup.int(3) < 0 {
+			return nil, errors.New("Row group with a negative number of rows")
+		}
+		rows += rowGroup.int(3)
+	}
+	if rows != int64(f.NumRows) {
+		return nil, fmt.Errorf("Row groups with %d rows for %d rows of the file", rows, f.NumRows)
+	}
+	for _, rowGroup := range rowGroups {
+		chunks := rowGroup.structs(1)
+		if len(chunks) != len(columns) {
+			return nil, fmt.Errorf("Row group with %d column chunks for %d columns", len(chunks), len(columns))
+		}
+		for i, chunk := range chunks {
+			values, err := readColumnChunk(b, chunk.strct(3), columns[i], int(rowGroup.int(3)))
+			if err != nil {
+				return nil, fmt.Errorf("Reading column %q: %w", columns[i].name, err)
+			}
+			f.Values[columns[i].name] = append(f.Values[columns[i].name], values...)
+		}
+	}
+	for _, c := range columns {
+		if len(f.Values[c.name]) != f.NumRows {
+			return nil, fmt.Errorf("Column %q with %d values for %d rows", c.name, len(f.Values[c.name]), f.NumRows)
+		}
+	}
+	return f, nil
+}
+
+// readColumnChunk reads the values of a column of a row group of rows rows, a value per row as the schema is flat
+func readColumnChunk(b []byte, meta tstruct, c column, rows int) ([]any, error) {
+	start := meta.int(9)
+	if meta.has(11) && meta.int(11) > 0 && meta.int(11) < start {
+		start = meta.int(11)
+	}
+	end := start + meta.int(7)
+	if start < 4 || end < start || end > int64(len(b)) {
+		return nil, errors.New("Column chunk outside of the file")
+	}
+	codec := meta.int(4)
+	numValues := int(meta.int(5))
+	if numValues != rows {
+		return nil, fmt.Errorf("Column chunk with %d values for %d rows", numValues, rows)
+	}
+
+	r := &thriftReader{b: b[:end], pos: int(start)}
+	var dictionary []any
+	values := make([]any, 0, numValues)
+	for len(values) < numValues {
+		header, err := r.readStruct()
+		if err != nil {
+			return nil, fmt.Errorf("Decoding page header: %w", err)
+		}
+		size := int(header.int(3))
+		if size < 0 || r.pos+size > len(r.b) {
+			return nil, errors.New("Page exceeds the column chunk")
+		}
+		if header.int(2) < 0 {
+			return nil, errors.New("Page with a negative uncompressed size")
+		}
+		page := r.b[r.pos : r.pos+size]
+		r.pos += size
+
+		switch header.int(1) {
+		case pageDictionary:
+			data, err := decompress(codec, page, int(header.int(2)))
+			if err != nil {
+				return nil, err
+			}
+			dictHeader := header.strct(7)
+			if dictionary, _, err = decodePlain(data, c, int(dictHeader.int(1))); err != nil {
+				return nil, fmt.Errorf("Decoding dictionary: %w", err)
+			}
+		case pageData:
+			data, err := decompress(codec, page, int(header.int(2)))
+			if err != nil {
+				return nil, err
+			}
+			dataHeader := header.strct(5)
+			n := int(dataHeader.int(1))
+			if n < 0 || n > numValues-len(values) {
+				return nil, errors.New("Page with more values than the column chunk")
+			}
+			var defLevels []int
+			if c.optional {
+				if len(data) < 4 {
+					return nil, errors.New("Truncated definition levels")
+				}
+				length := int(binary.LittleEndian.Uint32(data))
+				if 4+length > len(data) {
+					return nil, errors.New("Truncated definition levels")
+				}
+				if defLevels, err = decodeHybrid(data[4:4+length], 1, n); err != nil {
+					return nil, err
+				}
+				data = data[4+length:]
+			}
+			pageValues, err := decodeValues(data, c, int(dataHeader.int(2)), n, defLevels, dictionary)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, pageValues...)
+		case pageDataV2:
+			v2 := header.strct(8)
+			n := int(v2.int(1))
+			if n < 0 || n > numValues-len(values) {
+				return nil, errors.New("Page with more values than the column chunk")
+			}
+			defLength, repLength := int(v2.int(5)), int(v2.int(6))
+			if defLength < 0 || repLength < 0 || defLength+repLength > min(len(page), int(header.int(2))) {
+				return nil, errors.New("Truncated levels")
+			}
+			var defLevels []int
+			if c.optional {
+				if defLevels, err = decodeHybrid(page[repLength:repLength+defLength], 1, n); err != nil {
+					return nil, err
+				}
+			}
+			data := page[repLength+defLength:]
+			if v2.bool(7, true) {
+				if data, err = decompress(codec, data, int(header.int(2))-repLength-defLength); err != nil {
+					return nil, err
+				}
+			}
+			pageValues, err := decodeValues(data, c, int(v2.int(4)), n, defLevels, dictionary)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, pageValues...)
+		}
+	}
+	return values, nil
+}
+
+func decompress(codec int64, b []byte, size int) ([]byte, error) {
+	switch codec {
+	case codecUncompressed:
+		return b, nil
+	case codecSnappy:
+		return decodeSnappy(b)
+	case codecGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, fmt.Errorf("Decompressing gzip page: %w", err)
+		}
+		defer zr.Close()
+		// DEFLATE expands at most 1032:1, a larger size is no reason to allocate
+		out := bytes.NewBuffer(make([]byte, 0, min(size, 1032*len(b))))
+		if _, err = io.Copy(out, zr); err != nil {
+			return nil, fmt.Errorf("Decompressing gzip page: %w", err)
+		}
+		return out.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("Unsupported compression codec %d, only uncompressed, snappy and gzip are supported", codec)
+	}
+}
+
+// decodeValues decodes the n values of a data page, nulls where the definition level is 0
+func decodeValues(data []byte, c column, encoding, n int, defLevels []int, dictionary []any) ([]any, error) {
+	present := n
+	if defLevels != nil {
+		present = 0
+		for _, level := range defLevels {
+			present += level
+		}
+	}
+	var decoded []any
+	var err error
+	switch encoding {
+	case encodingPlain:
+		decoded, _, err = decodePlain(data, c, present)
+	case encodingPlainDictionary, encodingRLEDictionary:
+		if len(data) < 1 {
+			return nil, errors.New("Dictionary indices without bit width")
+		}
+		var indices []int
+		if indices, err = decodeHybrid(data[1:], int(data[0]), present); err != nil {
+			return nil, err
+		}
+		decoded = make([]any, present)
+		for i, index := range indices {
+			if index >= len(dictionary) {
+				return nil, errors.New("Dictionary index out of range")
+			}
+			decoded[i] = dictionary[index]
+		}
+	default:
+		return nil, fmt.Errorf("Unsupported encoding %d", encoding)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if defLevels == nil {
+		return decoded, nil
+	}
+	values := make([]any, n)
+	next := 0
+	for i, level := range defLevels {
+		if level > 0 {
+			values[i] = decoded[next]
+			next++
+		}
+	}
+	return values, nil
+}
+
+// decodePlain decodes n PLAIN encoded values and returns the number of bytes consumed
+func decodePlain(b []byte, c column, n int) ([]any, int, error) {
+	// every value takes at least a bit
+	if n < 0 || n > 8*len(b) {
+		return nil, 0, errors.New("Truncated PLAIN values")
+	}
+	values := make([]any, n)
+	pos := 0
+	need := func(size int) error {
+		if pos+size > len(b) {
+			return errors.New("Truncated PLAIN values")
+		}
+		return nil
+	}
+	for i := range values {
+		switch c.typ {
+		case typeBoolean:
+			if err := need(0); err != nil || i/8 >= len(b) {
+				return nil, 0, errors.New("Truncated PLAIN values")
+			}
+			values[i] = b[i/8]>>(i%8)&1 == 1
+		case typeInt32:
+			if err := need(4); err != nil {
+				return nil, 0, err
+			}
+			values[i] = int32(binary.LittleEndian.Uint32(b[pos:]))
+			pos += 4
+		case typeInt64:
+			if err := need(8); err != nil {
+				return nil, 0, err
+			}
+			values[i] = int64(binary.LittleEndian.Uint64(b[pos:]))
+			pos += 8
+		case typeInt96:
+			if err := need(12); err != nil {
+				return nil, 0, err
+			}
+			values[i] = b[pos : pos+12]
+			pos += 12
+		case typeFloat:
+			if err := need(4); err != nil {
+				return nil, 0, err
+			}
+			values[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[pos:]))
+			pos += 4
+		case typeDouble:
+			if err := need(8); err != nil {
+				return nil, 0, err
+			}
+			values[i] = math.Float64frombits(binary.LittleEndian.Uint64(b[pos:]))
+			pos += 8
+		case typeByteArray:
+			if err := need(4); err != nil {
+				return nil, 0, err
+			}
+			length := int(binary.LittleEndian.Uint32(b[pos:]))
+			pos += 4
+			if err := need(length); err != nil {
+				return nil, 0, err
+			}
+			values[i] = b[pos : pos+length]
+			pos += length
+		case typeFixedLenByteArray:
+			if err := need(c.typeLength); err != nil {
+				return nil, 0, err
+			}
+			values[i] = b[pos : pos+c.typeLength]
+			pos += c.typeLength
+		default:
+			return nil, 0, fmt.Errorf("Unsupported physical type %d", c.typ)
+		}
+	}
+	if c.typ == typeBoolean {
+		pos = (n + 7) / 8
+	}
+	return values, pos, nil
+}
+
+// decodeHybrid decodes n values of the RLE/bit-packing hybrid encoding of levels and dictionary indices
+func decodeHybrid(b []byte, bitWidth, n int) ([]int, error) {
+	if bitWidth > 32 {
+		return nil, fmt.Errorf("Invalid bit width %d", bitWidth)
+	}
+	values := make([]int, 0, n)
+	byteWidth := (bitWidth + 7) / 8
+	for len(values) < n {
+		header, size := binary.Uvarint(b)
+		if size <= 0 {
+			return nil, errors.New("Truncated RLE/bit-packed values")
+		}
+		b = b[size:]
+		if header&1 == 0 {
+			// run of one repeated value
+			count := int(header >> 1)
+			if len(b) < byteWidth {
+				return nil, errors.New("Truncated RLE run")
+			}
+			var buf [4]byte
+			copy(buf[:], b[:byteWidth])
+			value := int(binary.LittleEndian.Uint32(buf[:]))
+			b = b[byteWidth:]
+			for range min(count, n-len(values)) {
+				values = append(values, value)
+			}
+			continue
+		}
+		// groups of 8 bit-packed values
+		count := int(header>>1) * 8
+		bytesNeeded := int(header>>1) * bitWidth
+		if len(b) < bytesNeeded {
+			return nil, errors.New("Truncated bit-packed run")
+		}
+		for i := 0; i < count && len(values) < n; i++ {
+			value := 0
+			for bit := 0; bit < bitWidth; bit++ {
+				pos := i*bitWidth + bit
+				if b[pos/8]>>(pos%8)&1 == 1 {
+					value |= 1 << bit
+				}
+			}
+			values = append(values, value)
+		}
+		b = b[bytesNeeded:]
+	}
+	return values, nil
+}
@@ -0,0 +1,536 @@
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The fixture files are built field by field after the Parquet format specification, with an own Thrift compact
+// protocol and snappy encoder, the way pyarrow lays them out: a dictionary page before the data pages of a chunk,
+// the column metadata in the footer.
+
+type thriftField struct {
+	id    int16
+	typ   byte
+	value []byte
+}
+
+func zigzag(v int64) []byte {
+	return binary.AppendUvarint(nil, uint64(v<<1)^uint64(v>>63))
+}
+
+func thriftStruct(fields ...thriftField) []byte {
+	var b []byte
+	var last int16
+	for _, f := range fields {
+		if delta := f.id - last; delta > 0 && delta <= 15 {
+			b = append(b, byte(delta)<<4|f.typ)
+		} else {
+			b = append(append(b, f.typ), zigzag(int64(f.id))...)
+		}
+		b = append(b, f.value...)
+		last = f.id
+	}
+	return append(b, 0)
+}
+
+func thriftBinary(s string) []byte {
+	return append(binary.AppendUvarint(nil, uint64(len(s))), s...)
+}
+
+func i32Field(id int16, v int64) thriftField     { return thriftField{id, tI32, zigzag(v)} }
+func i64Field(id int16, v int64) thriftField     { return thriftField{id, tI64, zigzag(v)} }
+func binaryField(id int16, s string) thriftField { return thriftField{id, tBinary, thriftBinary(s)} }
+func structField(id int16, fields ...thriftField) thriftField {
+	return thriftField{id, tStruct, thriftStruct(fields...)}
+}
+
+func boolField(id int16, v bool) thriftField {
+	if v {
+		return thriftField{id, tBoolTrue, nil}
+	}
+	return thriftField{id, tBoolFalse, nil}
+}
+
+func listField(id int16, elemType byte, elems ...[]byte) thriftField {
+	var b []byte
+	if len(elems) < 15 {
+		b = []byte{byte(len(elems))<<4 | elemType}
+	} else {
+		b = binary.AppendUvarint([]byte{0xf0 | elemType}, uint64(len(elems)))
+	}
+	return thriftField{id, tList, append(b, bytes.Join(elems, nil)...)}
+}
+
+// snappyEncode compresses greedily with copies of the longest earlier match of at least 4 bytes
+func snappyEncode(src []byte) []byte {
+	dst := binary.AppendUvarint(nil, uint64(len(src)))
+	literal := 0
+	flush := func(end int) {
+		for literal < end {
+			n := min(end-literal, 256)
+			if n <= 60 {
+				dst = append(dst, byte(n-1)<<2)
+			} else {
+				dst = append(dst, 60<<2, byte(n-1))
+			}
+			dst = append(dst, src[literal:literal+n]...)
+			literal += n
+		}
+	}
+	for i := 0; i < len(src); {
+		bestOffset, bestLength := 0, 0
+		for j := max(0, i-2047); j < i; j++ {
+			length := 0
+			for i+length < len(src) && length < 64 && src[j+length] == src[i+length] {
+				length++
+			}
+			if length > bestLength {
+				bestOffset, bestLength = i-j, length
+			}
+		}
+		if bestLength < 4 {
+			i++
+			continue
+		}
+		flush(i)
+		if bestLength <= 11 {
+			dst = append(dst, byte(bestOffset>>8)<<5|byte(bestLength-4)<<2|1, byte(bestOffset))
+		} else {
+			dst = binary.LittleEndian.AppendUint16(append(dst, byte(bestLength-1)<<2|2), uint16(bestOffset))
+		}
+		i += bestLength
+		literal = i
+	}
+	flush(len(src))
+	return dst
+}
+
+func compress(codec int64, b []byte) []byte {
+	switch codec {
+	case codecSnappy:
+		return snappyEncode(b)
+	case codecGzip:
+		var compressed bytes.Buffer
+		w := gzip.NewWriter(&compressed)
+		w.Write(b)
+		w.Close()
+		return compressed.Bytes()
+	default:
+		return b
+	}
+}
+
+// rleRuns encodes the values as runs of the RLE/bit-packing hybrid, as writers do for definition levels
+func rleRuns(bitWidth int, values []int) []byte {
+	var b []byte
+	for i := 0; i < len(values); {
+		n := 1
+		for i+n < len(values) && values[i+n] == values[i] {
+			n++
+		}
+		b = binary.AppendUvarint(b, uint64(n)<<1)
+		b = append(b, binary.LittleEndian.AppendUint32(nil, uint32(values[i]))[:(bitWidth+7)/8]...)
+		i += n
+	}
+	return b
+}
+
+// bitPacked encodes the values as groups of 8 bit-packed values of the RLE/bit-packing hybrid
+func bitPacked(bitWidth int, values []int) []byte {
+	groups := (len(values) + 7) / 8
+	b := binary.AppendUvarint(nil, uint64(groups)<<1|1)
+	packed := make([]byte, groups*bitWidth)
+	for i, v := range values {
+		for bit := range bitWidth {
+			if v>>bit&1 == 1 {
+				pos := i*bitWidth + bit
+				packed[pos/8] |= 1 << (pos % 8)
+			}
+		}
+	}
+	return append(b, packed...)
+}
+
+func plainByteArrays(values ...[]byte) []byte {
+	var b []byte
+	for _, v := range values {
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(v)))
+		b = append(b, v...)
+	}
+	return b
+}
+
+func pageHeader(typ int64, uncompressed, compressed int, header thriftField) []byte {
+	return thriftStruct(i32Field(1, typ), i32Field(2, int64(uncompressed)), i32Field(3, int64(compressed)), header)
+}
+
+func dictionaryPage(codec int64, n int, values []byte) []byte {
+	data := compress(codec, values)
+	header := pageHeader(pageDictionary, len(values), len(data), structField(7, i32Field(1, int64(n)), i32Field(2, encodingPlain)))
+	return append(header, data...)
+}
+
+func dataPage(codec, encoding int64, n int, values []byte) []byte {
+	data := compress(codec, values)
+	header := pageHeader(pageData, len(values), len(data), structField(5,
+		i32Field(1, int64(n)), i32Field(2, encoding), i32Field(3, encodingRLE), i32Field(4, encodingRLE)))
+	return append(header, data...)
+}
+
+// dataPageV2 compresses only the values, the levels are stored uncompressed in front of them
+func dataPageV2(codec, encoding int64, n, nulls int, defLevels, values []byte) []byte {
+	data := compress(codec, values)
+	header := pageHeader(pageDataV2, len(defLevels)+len(values), len(defLevels)+len(data), structField(8,
+		i32Field(1, int64(n)), i32Field(2, int64(nulls)), i32Field(3, int64(n)), i32Field(4, encoding),
+		i32Field(5, int64(len(defLevels))), i32Field(6, 0), boolField(7, true)))
+	return append(append(header, defLevels...), data...)
+}
+
+type testColumn struct {
+	name     string
+	typ      int64
+	optional bool
+}
+
+func (c testColumn) schemaElement() []byte {
+	repetition := int64(0)
+	if c.optional {
+		repetition = 1
+	}
+	return thriftStruct(i32Field(1, c.typ), i32Field(3, repetition), binaryField(4, c.name))
+}
+
+// testChunk is a column chunk of a row group, the dictionary page if any first
+type testChunk struct {
+	codec      int64
+	numValues  int
+	dictionary []byte
+	pages      [][]byte
+}
+
+// parquetFile lays out the row groups and writes the footer
+func parquetFile(columns []testColumn, numRows int, rowGroups [][]testChunk, metadata map[string]string) []byte {
+	file := bytes.Clone(magic)
+	schema := [][]byte{thriftStruct(binaryField(4, "schema"), i32Field(5, int64(len(columns))))}
+	for _, c := range columns {
+		schema = append(schema, c.schemaElement())
+	}
+	var groups [][]byte
+	for _, chunks := range rowGroups {
+		var columnChunks [][]byte
+		groupRows := 0
+		for i, chunk := range chunks {
+			start := len(file)
+			meta := []thriftField{
+				i32Field(1, columns[i].typ),
+				listField(2, tI32, zigzag(encodingPlain), zigzag(encodingRLE), zigzag(encodingRLEDictionary)),
+				listField(3, tBinary, thriftBinary(columns[i].name)),
+				i32Field(4, chunk.codec),
+				i64Field(5, int64(chunk.numValues)),
+			}
+			file = append(file, chunk.dictionary...)
+			dataOffset := len(file)
+			for _, page := range chunk.pages {
+				file = append(file, page...)
+			}
+			meta = append(meta,
+				i64Field(6, int64(len(file)-start)), // uncompressed size, not used by the reader
+				i64Field(7, int64(len(file)-start)),
+				i64Field(9, int64(dataOffset)))
+			if chunk.dictionary != nil {
+				meta = append(meta, i64Field(11, int64(start)))
+			}
+			columnChunks = append(columnChunks, thriftStruct(i64Field(2, int64(start)), structField(3, meta...)))
+			groupRows = chunk.numValues
+		}
+		groups = append(groups, thriftStruct(listField(1, tStruct, columnChunks...), i64Field(2, 0), i64Field(3, int64(groupRows))))
+	}
+	var keyValues [][]byte
+	for key, value := range metadata {
+		keyValues = append(keyValues, thriftStruct(binaryField(1, key), binaryField(2, value)))
+	}
+	footer := thriftStruct(
+		i32Field(1, 2),
+		listField(2, tStruct, schema...),
+		i64Field(3, int64(numRows)),
+		listField(4, tStruct, groups...),
+		listField(5, tStruct, keyValues...),
+		binaryField(6, "parquet-cpp-arrow version 17.0.0"),
+	)
+	file = append(file, footer...)
+	file = binary.LittleEndian.AppendUint32(file, uint32(len(footer)))
+	return append(file, magic...)
+}
+
+func pointWKB(x, y float64) []byte {
+	b := binary.LittleEndian.AppendUint32([]byte{1}, wkbPoint)
+	b = binary.LittleEndian.AppendUint64(b, math.Float64bits(x))
+	return binary.LittleEndian.AppendUint64(b, math.Float64bits(y))
+}
+
+// the rows of the fixture
+var (
+	cityColumns = []testColumn{
+		{name: "name", typ: typeByteArray, optional: true},
+		{name: "population", typ: typeInt64},
+		{name: "geometry", typ: typeByteArray, optional: true},
+		{name: "visited", typ: typeBoolean},
+	}
+	cityNames       = []any{[]byte("Berlin"), nil, []byte("Potsdam"), []byte("Berlin")}
+	cityPopulations = []any{int64(3_700_000), int64(0), int64(180_000), int64(3_700_000)}
+	cityGeometries  = []any{pointWKB(13.4, 52.5), pointWKB(13.06, 52.4), nil, nil}
+	cityVisited     = []any{true, false, true, true}
+)
+
+// cityRowGroup encodes the rows [from, to): the names dictionary encoded and snappy compressed with nulls,
+// the populations PLAIN and snappy compressed, the geometries in a gzip compressed data page v2 with nulls,
+// the visited flags uncompressed
+func cityRowGroup(from, to int) []testChunk {
+	n := to - from
+
+	var dictionary [][]byte
+	var indices, nameLevels []int
+	for _, name := range cityNames[from:to] {
+		if name == nil {
+			nameLevels = append(nameLevels, 0)
+			continue
+		}
+		nameLevels = append(nameLevels, 1)
+		index := len(dictionary)
+		for i, value := range dictionary {
+			if bytes.Equal(value, name.([]byte)) {
+				index = i
+			}
+		}
+		if index == len(dictionary) {
+			dictionary = append(dictionary, name.([]byte))
+		}
+		indices = append(indices, index)
+	}
+	levels := rleRuns(1, nameLevels)
+	names := append(binary.LittleEndian.AppendUint32(nil, uint32(len(levels))), levels...)
+	names = append(append(names, 1), bitPacked(1, indices)...)
+
+	var populations []byte
+	for _, population := range cityPopulations[from:to] {
+		populations = binary.LittleEndian.AppendUint64(populations, uint64(population.(int64)))
+	}
+
+	var geometries [][]byte
+	var geometryLevels []int
+	for _, geometry := range cityGeometries[from:to] {
+		if geometry == nil {
+			geometryLevels = append(geometryLevels, 0)
+			continue
+		}
+		geometryLevels = append(geometryLevels, 1)
+		geometries = append(geometries, geometry.([]byte))
+	}
+
+	visited := make([]byte, (n+7)/8)
+	for i, v := range cityVisited[from:to] {
+		if v.(bool) {
+			visited[i/8] |= 1 << (i % 8)
+		}
+	}
+
+	return []testChunk{
+		{codec: codecSnappy, numValues: n,
+			dictionary: dictionaryPage(codecSnappy, len(dictionary), plainByteArrays(dictionary...)),
+			pages:      [][]byte{dataPage(codecSnappy, encodingRLEDictionary, n, names)}},
+		{codec: codecSnappy, numValues: n, pages: [][]byte{dataPage(codecSnappy, encodingPlain, n, populations)}},
+		{codec: codecGzip, numValues: n, pages: [][]byte{
+			dataPageV2(codecGzip, encodingPlain, n, n-len(geometries), rleRuns(1, geometryLevels), plainByteArrays(geometries...)),
+		}},
+		{codec: codecUncompressed, numValues: n, pages: [][]byte{dataPage(codecUncompressed, encodingPlain, n, visited)}},
+	}
+}
+
+func cityFile() []byte {
+	geo := `{"version":"1.1.0","primary_column":"geometry","columns":{"geometry":{"encoding":"WKB","geometry_types":["Point"]}}}`
+	return parquetFile(cityColumns, 4, [][]testChunk{cityRowGroup(0, 3), cityRowGroup(3, 4)}, map[string]string{"geo": geo})
+}
+
+func TestRead(t *testing.T) {
+	f, err := Read(cityFile())
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if f.NumRows != 4 {
+		t.Errorf("got %d rows, want 4", f.NumRows)
+	}
+	if want := []string{"name", "population", "geometry", "visited"}; !reflect.DeepEqual(f.Columns, want) {
+		t.Errorf("columns = %v, want %v", f.Columns, want)
+	}
+	for column, want := range map[string][]any{
+		"name":       cityNames,
+		"population": cityPopulations,
+		"geometry":   cityGeometries,
+		"visited":    cityVisited,
+	} {
+		if got := f.Values[column]; !reflect.DeepEqual(got, want) {
+			t.Errorf("column %s = %v, want %v", column, got, want)
+		}
+	}
+
+	geometryColumn, err := f.GeometryColumn()
+	if err != nil || geometryColumn != "geometry" {
+		t.Fatalf("GeometryColumn = %q, %v, want geometry", geometryColumn, err)
+	}
+	geometry, err := WKBToGeoJSON(f.Values[geometryColumn][0].([]byte))
+	if want := `{"type":"Point","coordinates":[13.4,52.5]}`; err != nil || string(geometry) != want {
+		t.Errorf("WKBToGeoJSON = %s, %v, want %s", geometry, err, want)
+	}
+}
+
+func TestDecodeSnappy(t *testing.T) {
+	long := strings.Repeat("0123456789", 7)
+	tests := []struct {
+		name    string
+		input   []byte
+		want    string
+		wantErr bool
+	}{
+		{name: "literal", input: []byte{0x03, 0x08, 'a', 'b', 'c'}, want: "abc"},
+		{name: "copy with 1 byte offset", input: []byte{0x0c, 0x08, 'a', 'b', 'c', 0x15, 0x03}, want: "abcabcabcabc"},
+		{name: "overlapping copy", input: []byte{0x0a, 0x00, 'a', 0x15, 0x01}, want: "aaaaaaaaaa"},
+		{name: "copy with 2 byte offset", input: []byte{0x08, 0x0c, 'a', 'b', 'c', 'd', 0x0e, 0x04, 0x00}, want: "abcdabcd"},
+		{name: "copy with 4 byte offset", input: []byte{0x08, 0x0c, 'a', 'b', 'c', 'd', 0x0f, 0x04, 0x00, 0x00, 0x00}, want: "abcdabcd"},
+		{name: "literal with 1 byte length", input: append([]byte{70, 60 << 2, 69}, long...), want: long},
+		{name: "empty", input: []byte{0x00}, want: ""},
+		{name: "without length", input: nil, wantErr: true},
+		{name: "truncated literal", input: []byte{0x03, 0x08, 'a', 'b'}, wantErr: true},
+		{name: "truncated literal length", input: []byte{0x46, 61 << 2, 0x45}, wantErr: true},
+		{name: "copy before the start", input: []byte{0x08, 0x0c, 'a', 'b', 'c', 'd', 0x0e, 0x05, 0x00}, wantErr: true},
+		{name: "copy with offset 0", input: []byte{0x08, 0x0c, 'a', 'b', 'c', 'd', 0x0e, 0x00, 0x00}, wantErr: true},
+		{name: "truncated copy", input: []byte{0x08, 0x0c, 'a', 'b', 'c', 'd', 0x0e, 0x04}, wantErr: true},
+		{name: "shorter than the length", input: []byte{0x04, 0x08, 'a', 'b', 'c'}, wantErr: true},
+		{name: "longer than the length", input: []byte{0x02, 0x08, 'a', 'b', 'c'}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeSnappy(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("decodeSnappy = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil || string(got) != tt.want {
+				t.Errorf("decodeSnappy = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+
+	// the encoder of the fixtures round-trips, with copies of both offset sizes
+	input := []byte(strings.Repeat("Berlin Potsdam ", 200) + long)
+	if got, err := decodeSnappy(snappyEncode(input)); err != nil || !bytes.Equal(got, input) {
+		t.Errorf("decodeSnappy(snappyEncode) = %v, %v", len(got), err)
+	}
+}
+
+func TestReadMalformed(t *testing.T) {
+	valid := cityFile()
+	population := []testColumn{{name: "population", typ: typeInt64}}
+	populationFile := func(codec int64, numRows int, page []byte) []byte {
+		return parquetFile(population, numRows, [][]testChunk{{{codec: codec, numValues: 1, pages: [][]byte{page}}}}, nil)
+	}
+	int64Page := dataPage(codecUncompressed, encodingPlain, 1, binary.LittleEndian.AppendUint64(nil, 7))
+	withFooterLength := func(length uint32) []byte {
+		b := bytes.Clone(valid)
+		binary.LittleEndian.PutUint32(b[len(b)-8:], length)
+		return b
+	}
+	withFooter := func(footer []byte) []byte {
+		b := append(bytes.Clone(magic), footer...)
+		return append(binary.LittleEndian.AppendUint32(b, uint32(len(footer))), magic...)
+	}
+
+	tests := []struct {
+		name    string
+		input   []byte
+		wantErr string
+	}{
+		{"empty", nil, "PAR1 magic"},
+		{"missing trailing magic", valid[:len(valid)-1], "PAR1 magic"},
+		{"footer length beyond file", withFooterLength(uint32(len(valid))), "footer length exceeds"},
+		{"truncated footer", withFooterLength(20), "Decoding Parquet footer"},
+		{"unknown Thrift type", withFooter([]byte{0x1d, 0x00}), "Unknown Thrift type"},
+		{"without schema", withFooter(thriftStruct(i64Field(3, 0))), "without schema"},
+		{"nested column", withFooter(thriftStruct(listField(2, tStruct,
+			thriftStruct(binaryField(4, "schema"), i32Field(5, 1)),
+			thriftStruct(i32Field(3, 1), binaryField(4, "bbox"), i32Field(5, 2)),
+		))), "Nested or repeated column \"bbox\""},
+		{"repeated column", withFooter(thriftStruct(listField(2, tStruct,
+			thriftStruct(binaryField(4, "schema"), i32Field(5, 1)),
+			thriftStruct(i32Field(1, typeInt64), i32Field(3, 2), binaryField(4, "refs")),
+		))), "Nested or repeated column \"refs\""},
+		{"missing column chunk", parquetFile(append(cityColumns, testColumn{name: "extra", typ: typeInt32}), 4,
+			[][]testChunk{cityRowGroup(0, 4)}, nil), "4 column chunks for 5 columns"},
+		{"fewer rows in the row groups than in the file", populationFile(codecUncompressed, 2, int64Page), "Row groups with 1 rows for 2 rows"},
+		{"fewer values than rows", parquetFile(append(population, testColumn{name: "visited", typ: typeBoolean}), 2, [][]testChunk{{
+			{codec: codecUncompressed, numValues: 1, pages: [][]byte{int64Page}},
+			{codec: codecUncompressed, numValues: 2, pages: [][]byte{dataPage(codecUncompressed, encodingPlain, 2, []byte{0x01})}},
+		}}, nil), "Column chunk with 1 values for 2 rows"},
+		{"more values in a page than in the chunk", populationFile(codecUncompressed, 1,
+			dataPage(codecUncompressed, encodingPlain, 2, binary.LittleEndian.AppendUint64(nil, 7))), "Page with more values than the column chunk"},
+		{"unsupported codec", populationFile(3, 1, int64Page), "Unsupported compression codec 3"},
+		{"corrupt snappy page", populationFile(codecSnappy, 1, int64Page), "Corrupt snappy block"},
+		{"corrupt gzip page", populationFile(codecGzip, 1, int64Page), "Decompressing gzip page"},
+		{"page beyond chunk", populationFile(codecUncompressed, 1, int64Page[:len(int64Page)-1]), "Page exceeds the column chunk"},
+		{"truncated page header", populationFile(codecUncompressed, 1, int64Page[:4]), "Decoding page header"},
+		{"truncated values", populationFile(codecUncompressed, 1,
+			dataPage(codecUncompressed, encodingPlain, 1, []byte{7, 0, 0})), "Truncated PLAIN values"},
+		{"unsupported encoding", populationFile(codecUncompressed, 1,
+			dataPage(codecUncompressed, 5, 1, binary.LittleEndian.AppendUint64(nil, 7))), "Unsupported encoding 5"},
+		{"dictionary index out of range", populationFile(codecUncompressed, 1,
+			dataPage(codecUncompressed, encodingRLEDictionary, 1, append([]byte{1}, rleRuns(1, []int{1})...))), "Dictionary index out of range"},
+		{"dictionary indices without bit width", populationFile(codecUncompressed, 1,
+			dataPage(codecUncompressed, encodingRLEDictionary, 1, nil)), "without bit width"},
+		{"invalid bit width", populationFile(codecUncompressed, 1,
+			dataPage(codecUncompressed, encodingRLEDictionary, 1, []byte{33, 2, 0})), "Invalid bit width"},
+		{"truncated bit-packed run", populationFile(codecUncompressed, 1,
+			dataPage(codecUncompressed, encodingRLEDictionary, 1, []byte{1, 0x03})), "Truncated bit-packed run"},
+		{"truncated definition levels", parquetFile([]testColumn{{name: "name", typ: typeByteArray, optional: true}}, 1,
+			[][]testChunk{{{codec: codecUncompressed, numValues: 1, pages: [][]byte{
+				dataPage(codecUncompressed, encodingPlain, 1, []byte{9, 0, 0, 0, 2}),
+			}}}}, nil), "Truncated definition levels"},
+		{"truncated dictionary", parquetFile(population, 1, [][]testChunk{{{codec: codecUncompressed, numValues: 1,
+			dictionary: dictionaryPage(codecUncompressed, 2, binary.LittleEndian.AppendUint64(nil, 7)),
+			pages:      [][]byte{dataPage(codecUncompressed, encodingRLEDictionary, 1, append([]byte{1}, rleRuns(1, []int{0})...))},
+		}}}, nil), "Decoding dictionary"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := Read(tt.input)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Read = %v, %v, want an error containing %q", f, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestReadCorrupted overwrites every byte of the fixture, Read may decode garbage but must not panic
+func TestReadCorrupted(t *testing.T) {
+	valid := cityFile()
+	for i := range len(valid) {
+		for _, value := range []byte{0x00, 0x7f, 0xff} {
+			b := bytes.Clone(valid)
+			b[i] = value
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						t.Errorf("Read panicked with byte %d set to %#x: %v", i, value, r)
+					}
+				}()
+				Read(b)
+			}()
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package parquet
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var errSnappyCorrupt = errors.New("Corrupt snappy block")
+
+// decodeSnappy decompresses a block of the snappy format (not the framing format), the default codec of most writers
+func decodeSnappy(src []byte) ([]byte, error) {
+	length, n := binary.Uvarint(src)
+	// a copy of at most 64 bytes takes at least 3 bytes, so a block expands less than 22 times
+	if n <= 0 || length > 22*uint64(len(src)) {
+		return nil, errSnappyCorrupt
+	}
+	src = src[n:]
+	dst := make([]byte, 0, length)
+	for len(src) > 0 {
+		tag := src[0]
+		switch tag & 3 {
+		case 0: // literal
+			size := int(tag>>2) + 1
+			src = src[1:]
+			if size > 60 {
+				extra := size - 60
+				if len(src) < extra {
+					return nil, errSnappyCorrupt
+				}
+				var buf [4]byte
+				copy(buf[:], src[:extra])
+				size = int(binary.LittleEndian.Uint32(buf[:])) + 1
+				src = src[extra:]
+			}
+			if size > len(src) {
+				return nil, errSnappyCorrupt
+			}
+			dst = append(dst, src[:size]...)
+			src = src[size:]
+			continue
+		case 1: // copy with a 1 byte offset
+			if len(src) < 2 {
+				return nil, errSnappyCorrupt
+			}
+			size := 4 + int(tag>>2)&7
+			offset := int(tag&0xe0)<<3 | int(src[1])
+			src = src[2:]
+			if dst, n = copyBack(dst, offset, size); n < 0 {
+				return nil, errSnappyCorrupt
+			}
+		case 2: // copy with a 2 byte offset
+			if len(src) < 3 {
+				return nil, errSnappyCorrupt
+			}
+			size := int(tag>>2) + 1
+			offset := int(binary.LittleEndian.Uint16(src[1:]))
+			src = src[3:]
+			if dst, n = copyBack(dst, offset, size); n < 0 {
+				return nil, errSnappyCorrupt
+			}
+		case 3: // copy with a 4 byte offset
+			if len(src) < 5 {
+				return nil, errSnappyCorrupt
+			}
+			size := int(tag>>2) + 1
+			offset := int(binary.LittleEndian.Uint32(src[1:]))
+			src = src[5:]
+			if dst, n = copyBack(dst, offset, size); n < 0 {
+				return nil, errSnappyCorrupt
+			}
+		}
+	}
+	if uint64(len(dst)) != length {
+		return nil, errSnappyCorrupt
+	}
+	return dst, nil
+}
+
+// copyBack appends size bytes starting offset bytes before the end of dst, the ranges may overlap.
+// Returns -1 for an invalid offset.
+func copyBack(dst []byte, offset, size int) ([]byte, int) {
+	if offset <= 0 || offset > len(dst) {
+		return dst, -1
+	}
+	start := len(dst) - offset
+	for i := range size {
+		dst = append(dst, dst[start+i])
+	}
+	return dst, size
+}
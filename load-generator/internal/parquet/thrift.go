@@ -0,0 +1,206 @@
+package parquet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// the types of the Thrift compact protocol
+const (
+	tBoolTrue  = 1
+	tBoolFalse = 2
+	tByte      = 3
+	tI16       = 4
+	tI32       = 5
+	tI64       = 6
+	tDouble    = 7
+	tBinary    = 8
+	tList      = 9
+	tSet       = 10
+	tMap       = 11
+	tStruct    = 12
+)
+
+// tstruct is a decoded Thrift struct by field ID. Integers are int64, binaries []byte,
+// lists []any and nested structs tstruct.
+type tstruct map[int16]any
+
+func (s tstruct) int(id int16) int64 {
+	v, _ := s[id].(int64)
+	return v
+}
+
+func (s tstruct) has(id int16) bool {
+	_, ok := s[id]
+	return ok
+}
+
+func (s tstruct) string(id int16) string {
+	v, _ := s[id].([]byte)
+	return string(v)
+}
+
+func (s tstruct) bool(id int16, defaultValue bool) bool {
+	if v, ok := s[id].(bool); ok {
+		return v
+	}
+	return defaultValue
+}
+
+func (s tstruct) structs(id int16) []tstruct {
+	list, _ := s[id].([]any)
+	structs := make([]tstruct, 0, len(list))
+	for _, v := range list {
+		if st, ok := v.(tstruct); ok {
+			structs = append(structs, st)
+		}
+	}
+	return structs
+}
+
+func (s tstruct) strct(id int16) tstruct {
+	v, _ := s[id].(tstruct)
+	return v
+}
+
+// thriftReader decodes the Thrift compact protocol Parquet uses for its metadata
+type thriftReader struct {
+	b   []byte
+	pos int
+}
+
+var errThriftTruncated = errors.New("Truncated Thrift metadata")
+
+func (r *thriftReader) byte() (byte, error) {
+	if r.pos >= len(r.b) {
+		return 0, errThriftTruncated
+	}
+	r.pos++
+	return r.b[r.pos-1], nil
+}
+
+func (r *thriftReader) uvarint() (uint64, error) {
+	v, n := binary.Uvarint(r.b[r.pos:])
+	if n <= 0 {
+		return 0, errThriftTruncated
+	}
+	r.pos += n
+	return v, nil
+}
+
+func (r *thriftReader) varint() (int64, error) {
+	v, err := r.uvarint()
+	return int64(v>>1) ^ -int64(v&1), err
+}
+
+func (r *thriftReader) readStruct() (tstruct, error) {
+	s := make(tstruct)
+	var id int16
+	for {
+		header, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		typ := header & 0x0f
+		if typ == 0 {
+			return s, nil
+		}
+		if delta := header >> 4; delta != 0 {
+			id += int16(delta)
+		} else {
+			v, err := r.varint()
+			if err != nil {
+				return nil, err
+			}
+			id = int16(v)
+		}
+		var value any
+		switch typ {
+		case tBoolTrue:
+			value = true
+		case tBoolFalse:
+			value = false
+		default:
+			if value, err = r.readValue(typ); err != nil {
+				return nil, fmt.Errorf("Field %d: %w", id, err)
+			}
+		}
+		s[id] = value
+	}
+}
+
+func (r *thriftReader) readValue(typ byte) (any, error) {
+	switch typ {
+	case tBoolTrue, tBoolFalse:
+		// booleans in collections take a byte
+		b, err := r.byte()
+		return b == 1, err
+	case tByte:
+		b, err := r.byte()
+		return int64(int8(b)), err
+	case tI16, tI32, tI64:
+		return r.varint()
+	case tDouble:
+		if r.pos+8 > len(r.b) {
+			return nil, errThriftTruncated
+		}
+		r.pos += 8
+		return math.Float64frombits(binary.LittleEndian.Uint64(r.b[r.pos-8:])), nil
+	case tBinary:
+		n, err := r.uvarint()
+		if err != nil {
+			return nil, err
+		}
+		if n > uint64(len(r.b)-r.pos) {
+			return nil, errThriftTruncated
+		}
+		r.pos += int(n)
+		return r.b[r.pos-int(n) : r.pos], nil
+	case tList, tSet:
+		header, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		size := uint64(header >> 4)
+		if size == 15 {
+			if size, err = r.uvarint(); err != nil {
+				return nil, err
+			}
+		}
+		if size > uint64(len(r.b)-r.pos) {
+			return nil, errThriftTruncated
+		}
+		list := make([]any, size)
+		for i := range list {
+			if list[i], err = r.readValue(header & 0x0f); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	case tMap:
+		size, err := r.uvarint()
+		if err != nil || size == 0 {
+			return nil, err
+		}
+		types, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		for range size {
+			if _, err := r.readValue(types >> 4); err != nil {
+				return nil, err
+			}
+			if _, err := r.readValue(types & 0x0f); err != nil {
+				return nil, err
+			}
+		}
+		// no map of the Parquet metadata is needed
+		return nil, nil
+	case tStruct:
+		return r.readStruct()
+	default:
+		return nil, fmt.Errorf("Unknown Thrift type %d", typ)
+	}
+}
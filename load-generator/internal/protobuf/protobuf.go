@@ -0,0 +1,156 @@
+// Package protobuf implements the subset of the protobuf wire format used by the messages of the gRPC services
+// and the OSM PBF files: encoding varint and length-delimited fields and decoding the fields of a message
+package protobuf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// wire types of the protobuf encoding
+const (
+	wireVarint = 0
+	wireI64    = 1
+	wireLen    = 2
+	wireI32    = 5
+)
+
+// Encoder appends the fields of a protobuf message, zero values are omitted like proto3 does
+type Encoder struct {
+	b []byte
+}
+
+func (e *Encoder) key(num, wire int) {
+	e.b = binary.AppendUvarint(e.b, uint64(num)<<3|uint64(wire))
+}
+
+func (e *Encoder) Uint(num int, v uint64) {
+	if v == 0 {
+		return
+	}
+	e.key(num, wireVarint)
+	e.b = binary.AppendUvarint(e.b, v)
+}
+
+// Int encodes an int32 or int64 field, negative values take ten bytes
+func (e *Encoder) Int(num int, v int64) {
+	e.Uint(num, uint64(v))
+}
+
+func (e *Encoder) Bytes(num int, v []byte) {
+	if len(v) == 0 {
+		return
+	}
+	e.key(num, wireLen)
+	e.b = binary.AppendUvarint(e.b, uint64(len(v)))
+	e.b = append(e.b, v...)
+}
+
+func (e *Encoder) String(num int, v string) {
+	e.Bytes(num, []byte(v))
+}
+
+// Strings encodes a repeated string field, empty elements are kept
+func (e *Encoder) Strings(num int, v []string) {
+	for _, s := range v {
+		e.key(num, wireLen)
+		e.b = binary.AppendUvarint(e.b, uint64(len(s)))
+		e.b = append(e.b, s...)
+	}
+}
+
+// Message returns the encoded message
+func (e *Encoder) Message() []byte {
+	return e.b
+}
+
+// Field is a decoded field of a protobuf message
+type Field struct {
+	Num    int
+	wire   int
+	varint uint64 // value of varint and fixed fields
+	bytes  []byte // value of length-delimited fields
+}
+
+func (f Field) Uint() uint64 {
+	return f.varint
+}
+
+func (f Field) Int() int64 {
+	return int64(f.varint)
+}
+
+func (f Field) Bytes() []byte {
+	return f.bytes
+}
+
+func (f Field) String() string {
+	return string(f.bytes)
+}
+
+// Packed decodes a packed repeated varint field, an unpacked single value is returned as one element
+func (f Field) Packed() ([]uint64, error) {
+	if f.wire == wireVarint {
+		return []uint64{f.varint}, nil
+	}
+	values := make([]uint64, 0, len(f.bytes))
+	for b := f.bytes; len(b) > 0; {
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errors.New("Invalid varint in packed field")
+		}
+		values = append(values, v)
+		b = b[n:]
+	}
+	return values, nil
+}
+
+// Zigzag decodes the value of a sint32 or sint64 field
+func Zigzag(v uint64) int64 {
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+// EachField calls fn for every field of the message b in order, fields of unknown numbers can be skipped by fn
+func EachField(b []byte, fn func(Field) error) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errors.New("Invalid field key")
+		}
+		b = b[n:]
+		f := Field{Num: int(key >> 3), wire: int(key & 7)}
+		switch f.wire {
+		case wireVarint:
+			if f.varint, n = binary.Uvarint(b); n <= 0 {
+				return fmt.Errorf("Invalid varint of field %d", f.Num)
+			}
+			b = b[n:]
+		case wireLen:
+			length, n := binary.Uvarint(b)
+			if n <= 0 || length > uint64(len(b)-n) {
+				return fmt.Errorf("Invalid length of field %d", f.Num)
+			}
+			f.bytes = b[n : n+int(length)]
+			b = b[n+int(length):]
+		case wireI64:
+			if len(b) < 8 {
+				return fmt.Errorf("Truncated field %d", f.Num)
+			}
+			f.varint = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case wireI32:
+			if len(b) < 4 {
+				return fmt.Errorf("Truncated field %d", f.Num)
+			}
+			f.varint = uint64(binary.LittleEndian.Uint32(b))
+			b = b[4:]
+		default:
+			return fmt.Errorf("Unsupported wire type %d of field %d", f.wire, f.Num)
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
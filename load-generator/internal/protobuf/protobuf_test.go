@@ -0,0 +1,114 @@
+package protobuf
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The golden bytes are those protoc-generated code writes for the fields, derived from the encoding
+// specification: the key is the field number shifted by three ORed with the wire type.
+
+func TestEncoder(t *testing.T) {
+	var e Encoder
+	e.Uint(1, 150)
+	e.Uint(2, 0) // omitted
+	e.Int(3, -1)
+	e.String(4, "testing")
+	e.Bytes(5, nil) // omitted
+	e.Strings(6, []string{"a", ""})
+	want := []byte{
+		0x08, 0x96, 0x01, // field 1 varint 150
+		0x18, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01, // field 3 varint -1, sign extended to ten bytes
+		0x22, 0x07, 't', 'e', 's', 't', 'i', 'n', 'g', // field 4 length 7
+		0x32, 0x01, 'a', // field 6 length 1
+		0x32, 0x00, // field 6 empty, kept as an element
+	}
+	if got := e.Message(); !bytes.Equal(got, want) {
+		t.Errorf("Message =\n% x\nwant\n% x", got, want)
+	}
+}
+
+func TestEachField(t *testing.T) {
+	b := []byte{
+		0x08, 0x96, 0x01, // field 1 varint 150
+		0x11, 1, 2, 3, 4, 5, 6, 7, 8, // field 2 fixed64
+		0x1d, 1, 2, 3, 4, // field 3 fixed32
+		0xa2, 0x06, 0x02, 'h', 'i', // field 100 length 2
+	}
+	var got []Field
+	err := EachField(b, func(f Field) error {
+		got = append(got, f)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("EachField failed: %v", err)
+	}
+	want := []Field{
+		{Num: 1, wire: wireVarint, varint: 150},
+		{Num: 2, wire: wireI64, varint: 0x0807060504030201},
+		{Num: 3, wire: wireI32, varint: 0x04030201},
+		{Num: 100, wire: wireLen, bytes: []byte("hi")},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("fields = %+v, want %+v", got, want)
+	}
+	if got[0].Int() != 150 || got[3].String() != "hi" {
+		t.Errorf("got %d and %q, want 150 and hi", got[0].Int(), got[3].String())
+	}
+}
+
+func TestEachFieldMalformed(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   []byte
+		wantErr string
+	}{
+		{"unterminated key", []byte{0x80}, "Invalid field key"},
+		{"unterminated varint", []byte{0x08, 0x96}, "Invalid varint of field 1"},
+		{"missing varint", []byte{0x08}, "Invalid varint of field 1"},
+		{"length beyond message", []byte{0x12, 0x05, 'a'}, "Invalid length of field 2"},
+		{"huge length", []byte{0x12, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}, "Invalid length of field 2"},
+		{"truncated fixed64", []byte{0x11, 1, 2, 3}, "Truncated field 2"},
+		{"truncated fixed32", []byte{0x1d, 1, 2, 3}, "Truncated field 3"},
+		{"group", []byte{0x0b, 0x0c}, "Unsupported wire type 3 of field 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := EachField(tt.input, func(Field) error { return nil })
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("EachField error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPacked(t *testing.T) {
+	// field 1 packed 3, 270 and 86942, the example of the encoding specification, followed by field 2 varint 5
+	b := []byte{0x0a, 0x06, 0x03, 0x8e, 0x02, 0x9e, 0xa7, 0x05, 0x10, 0x05}
+	var got [][]uint64
+	err := EachField(b, func(f Field) error {
+		values, err := f.Packed()
+		got = append(got, values)
+		return err
+	})
+	if want := [][]uint64{{3, 270, 86942}, {5}}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Packed = %v, %v, want %v", got, err, want)
+	}
+	err = EachField([]byte{0x0a, 0x01, 0x80}, func(f Field) error {
+		_, err := f.Packed()
+		return err
+	})
+	if err == nil || !strings.Contains(err.Error(), "Invalid varint in packed field") {
+		t.Errorf("Packed of an unterminated varint = %v", err)
+	}
+}
+
+func TestZigzag(t *testing.T) {
+	for encoded, want := range map[uint64]int64{0: 0, 1: -1, 2: 1, 3: -2, 4294967294: 2147483647, 4294967295: -2147483648} {
+		if got := Zigzag(encoded); got != want {
+			t.Errorf("Zigzag(%d) = %d, want %d", encoded, got, want)
+		}
+	}
+}
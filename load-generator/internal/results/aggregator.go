@@ -0,0 +1,124 @@
+package results
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// AggregateCSVHeader is the header of results CSVs with a row per interval and operation name instead of per operation
+var AggregateCSVHeader = []string{"runId", "name", "startTime", "endTime", "count", "failed", "operations", "meanUs", "p50Us", "p95Us", "p99Us", "maxUs"}
+
+// Aggregator writes the operations as aggregates per interval and name (template or job type) to a results CSV,
+// keeping the results of multi-day runs small. The latency statistics are of the successful operations,
+// the percentiles are estimated by a LatencySketch. Operations are aggregated into the interval they ended in.
+// All methods are no-ops on a nil Aggregator.
+type Aggregator struct {
+	w          *CSVWriter
+	runID      string
+	intervalUs int64
+	// intervals not written yet, by their index on the monotonic clock
+	open    map[int64]map[string]*aggregate
+	written int64 // intervals before it are written, later operations of them are added to the first open one
+}
+
+type aggregate struct {
+	count      int64
+	failed     int64
+	operations int64
+	latencies  *LatencySketch
+}
+
+// NewAggregator writes the header of the aggregates to w
+func NewAggregator(w *CSVWriter, runID string, interval time.Duration) (*Aggregator, error) {
+	if err := w.Write(AggregateCSVHeader); err != nil {
+		return nil, err
+	}
+	return &Aggregator{w: w, runID: runID, intervalUs: interval.Microseconds(), open: make(map[int64]map[string]*aggregate)}, nil
+}
+
+// Observe adds an operation which ended at endMonotonicUs, see MonotonicUs. Intervals older than the one before
+// the operation's are written, operations finishing in a different order than their workers report them stay in their interval.
+func (a *Aggregator) Observe(name string, endMonotonicUs, durationUs int64, successful bool, operations int) error {
+	if a == nil {
+		return nil
+	}
+	index := max(endMonotonicUs/a.intervalUs, a.written)
+	names := a.open[index]
+	if names == nil {
+		names = make(map[string]*aggregate)
+		a.open[index] = names
+	}
+	agg := names[name]
+	if agg == nil {
+		agg = &aggregate{latencies: NewLatencySketch()}
+		names[name] = agg
+	}
+	agg.count++
+	agg.operations += int64(operations)
+	if successful {
+		agg.latencies.Add(float64(durationUs))
+	} else {
+		agg.failed++
+	}
+	return a.writeBefore(index - 1)
+}
+
+// Close writes the open intervals, the CSVWriter stays open
+func (a *Aggregator) Close() error {
+	if a == nil {
+		return nil
+	}
+	last := a.written
+	for index := range a.open {
+		last = max(last, index+1)
+	}
+	return a.writeBefore(last)
+}
+
+// writeBefore writes the intervals before the index
+func (a *Aggregator) writeBefore(index int64) error {
+	if index <= a.written {
+		return nil
+	}
+	var indexes []int64
+	for i := range a.open {
+		if i < index {
+			indexes = append(indexes, i)
+		}
+	}
+	slices.Sort(indexes)
+	for _, i := range indexes {
+		start := processStart.Add(time.Duration(i*a.intervalUs) * time.Microsecond).UTC()
+		end := start.Add(time.Duration(a.intervalUs) * time.Microsecond)
+		names := a.open[i]
+		for _, name := range slices.Sorted(maps.Keys(names)) {
+			agg := names[name]
+			record := []string{
+				a.runID,
+				name,
+				start.Format(time.RFC3339Nano),
+				end.Format(time.RFC3339Nano),
+				strconv.FormatInt(agg.count, 10),
+				strconv.FormatInt(agg.failed, 10),
+				strconv.FormatInt(agg.operations, 10),
+				formatUs(agg.latencies.Mean()),
+				formatUs(agg.latencies.Quantile(0.50)),
+				formatUs(agg.latencies.Quantile(0.95)),
+				formatUs(agg.latencies.Quantile(0.99)),
+				formatUs(agg.latencies.Max()),
+			}
+			if err := a.w.Write(record); err != nil {
+				return err
+			}
+		}
+		delete(a.open, i)
+	}
+	a.written = index
+	return nil
+}
+
+func formatUs(us float64) string {
+	return strconv.FormatFloat(us, 'f', 0, 64)
+}
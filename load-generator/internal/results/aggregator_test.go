@@ -0,0 +1,111 @@
+package results
+
+import (
+	"encoding/csv"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestAggregator(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "results.csv")
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewCSVWriter(file, 0, 0)
+	a, err := NewAggregator(w, "run", 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const s = int64(time.Second / time.Microsecond)
+	for _, o := range []struct {
+		name       string
+		endUs      int64
+		durationUs int64
+		successful bool
+		operations int
+	}{
+		{"q", 5 * s, 100, true, 1},
+		{"q", 15 * s, 300, true, 1},
+		// finished before the previous one but reported after it, stays in the first interval
+		{"q", 9 * s, 200, true, 1},
+		// writes the first interval
+		{"q", 25 * s, 500, true, 1},
+		// of the written first interval, added to the first open one
+		{"q", 3 * s, 900, false, 1},
+		// writes the second interval
+		{"i", 31 * s, 1000, true, 5},
+		{"i", 32 * s, 2000, false, 5},
+	} {
+		if err := a.Observe(o.name, o.endUs, o.durationUs, o.successful, o.operations); err != nil {
+			t.Fatalf("Observe failed: %v", err)
+		}
+	}
+	// the open third and fourth intervals are written on close
+	if err := a.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	interval := func(i int) (string, string) {
+		start := processStart.Add(time.Duration(i) * 10 * time.Second).UTC()
+		return start.Format(time.RFC3339Nano), start.Add(10 * time.Second).Format(time.RFC3339Nano)
+	}
+	row := func(name string, i int, count, failed, operations, mean, p50, p95, p99, max string) []string {
+		start, end := interval(i)
+		return []string{"run", name, start, end, count, failed, operations, mean, p50, p95, p99, max}
+	}
+	want := [][]string{
+		AggregateCSVHeader,
+		row("q", 0, "2", "0", "2", "150", "100", "200", "200", "200"),
+		row("q", 1, "2", "1", "2", "300", "300", "300", "300", "300"),
+		row("q", 2, "1", "0", "1", "500", "500", "500", "500", "500"),
+		row("i", 3, "2", "1", "10", "1000", "1000", "1000", "1000", "1000"),
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("got %d rows, want %d:\n%v", len(rows), len(want), rows)
+	}
+	for i := range want {
+		got := slices.Clone(rows[i])
+		if i > 0 {
+			// the percentiles are estimates within 1% of the latencies, rounded to whole microseconds
+			for _, column := range []int{8, 9, 10} {
+				estimate, err := strconv.ParseFloat(got[column], 64)
+				exact, _ := strconv.ParseFloat(want[i][column], 64)
+				if err == nil && math.Abs(estimate-exact) <= sketchAccuracy*exact+0.5 {
+					got[column] = want[i][column]
+				}
+			}
+		}
+		if !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("row %d =\n%v\nwant\n%v", i, rows[i], want[i])
+		}
+	}
+}
+
+func TestAggregatorNil(t *testing.T) {
+	var a *Aggregator
+	if err := a.Observe("q", 1, 1, true, 1); err != nil {
+		t.Errorf("Observe of a nil Aggregator failed: %v", err)
+	}
+	if err := a.Close(); err != nil {
+		t.Errorf("Close of a nil Aggregator failed: %v", err)
+	}
+}
@@ -0,0 +1,202 @@
+package results
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Row is a single operation of a results CSV, independent of the benchmark mode
+type Row struct {
+	RunID      string
+	WorkerID   int
+	Name       string // template name for queries, job type for inserts
+	StartTime  time.Time
+	StartUs    int64 // start on the monotonic clock, the startTime of CSVs without startMonotonicUs, only differences between rows are meaningful
+	DurationUs int64
+	Successful bool
+	Operations int // inserted events for inserts, 1 for queries
+}
+
+type Data struct {
+	Kind  string // insert or query
+	RunID string
+	Rows  []Row
+}
+
+type LatencyStats struct {
+	Count       int     `json:"count"`
+	Failed      int     `json:"failed"`
+	Operations  int     `json:"operations"`
+	DurationSec float64 `json:"durationSec"`
+	OpsPerSec   float64 `json:"opsPerSec"`
+	MeanUs      float64 `json:"meanUs"`
+	P50Us       float64 `json:"p50Us"`
+	P90Us       float64 `json:"p90Us"`
+	P95Us       float64 `json:"p95Us"`
+	P99Us       float64 `json:"p99Us"`
+	MaxUs       float64 `json:"maxUs"`
+}
+
+// LoadCSV reads a results CSV produced by the insert or query mode
+func LoadCSV(filename string) (*Data, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("Reading header of %s: %w", filename, err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[name] = i
+	}
+
+	data := &Data{}
+	var durationColumn, nameColumn string
+	switch {
+	case hasColumns(columns, "insertDurationUs", "jobType", "successfullyInserted", "failedInserts"):
+		data.Kind = "insert"
+		durationColumn, nameColumn = "insertDurationUs", "jobType"
+	case hasColumns(columns, "queryDurationUs", "templateName", "successful"):
+		data.Kind = "query"
+		durationColumn, nameColumn = "queryDurationUs", "templateName"
+	default:
+		return nil, fmt.Errorf("%s is not a results CSV of the insert or query mode", filename)
+	}
+	if !hasColumns(columns, "workerId", "startTime") {
+		return nil, fmt.Errorf("%s is missing the workerId or startTime column", filename)
+	}
+
+	for line := 2; ; line++ {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("Reading %s: %w", filename, err)
+		}
+
+		row := Row{Name: rec[columns[nameColumn]]}
+		if i, ok := columns["runId"]; ok {
+			row.RunID = rec[i]
+		}
+		if row.WorkerID, err = strconv.Atoi(rec[columns["workerId"]]); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid workerId: %w", filename, line, err)
+		}
+		if row.StartTime, err = time.Parse(time.RFC3339Nano, rec[columns["startTime"]]); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid startTime: %w", filename, line, err)
+		}
+		row.StartUs = row.StartTime.UnixMicro()
+		if i, ok := columns["startMonotonicUs"]; ok {
+			if row.StartUs, err = strconv.ParseInt(rec[i], 10, 64); err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid startMonotonicUs: %w", filename, line, err)
+			}
+		}
+		if row.DurationUs, err = strconv.ParseInt(rec[columns[durationColumn]], 10, 64); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid %s: %w", filename, line, durationColumn, err)
+		}
+
+		switch data.Kind {
+		case "insert":
+			failed, err := strconv.Atoi(rec[columns["failedInserts"]])
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid failedInserts: %w", filename, line, err)
+			}
+			if row.Operations, err = strconv.Atoi(rec[columns["successfullyInserted"]]); err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid successfullyInserted: %w", filename, line, err)
+			}
+			row.Successful = failed == 0
+		case "query":
+			row.Successful = rec[columns["successful"]] == "true"
+			row.Operations = 1
+		}
+
+		if data.RunID == "" {
+			data.RunID = row.RunID
+		}
+		data.Rows = append(data.Rows, row)
+	}
+	return data, nil
+}
+
+func hasColumns(columns map[string]int, names ...string) bool {
+	for _, name := range names {
+		if _, ok := columns[name]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// ComputeLatencyStats aggregates the rows, latency percentiles only consider successful operations
+func ComputeLatencyStats(rows []Row) LatencyStats {
+	stats := LatencyStats{Count: len(rows)}
+	if len(rows) == 0 {
+		return stats
+	}
+
+	durations := make([]float64, 0, len(rows))
+	first, last := rows[0].StartUs, rows[0].StartUs
+	total := 0.0
+	for _, row := range rows {
+		first = min(first, row.StartUs)
+		last = max(last, row.StartUs+row.DurationUs)
+		stats.Operations += row.Operations
+		if !row.Successful {
+			stats.Failed++
+			continue
+		}
+		durations = append(durations, float64(row.DurationUs))
+		total += float64(row.DurationUs)
+	}
+
+	stats.DurationSec = float64(last-first) / 1e6
+	if stats.DurationSec > 0 {
+		stats.OpsPerSec = float64(stats.Operations) / stats.DurationSec
+	}
+	if len(durations) == 0 {
+		return stats
+	}
+
+	sort.Float64s(durations)
+	stats.MeanUs = total / float64(len(durations))
+	stats.P50Us = Percentile(durations, 0.50)
+	stats.P90Us = Percentile(durations, 0.90)
+	stats.P95Us = Percentile(durations, 0.95)
+	stats.P99Us = Percentile(durations, 0.99)
+	stats.MaxUs = durations[len(durations)-1]
+	return stats
+}
+
+// Percentile expects sorted values and uses the nearest-rank method
+func Percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	rank = max(0, min(rank, len(sorted)-1))
+	return sorted[rank]
+}
+
+// GroupRows groups the rows by their name (template or job type), sorted by name
+func GroupRows(rows []Row) ([]string, map[string][]Row) {
+	groups := make(map[string][]Row)
+	for _, row := range rows {
+		groups[row.Name] = append(groups[row.Name], row)
+	}
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, groups
+}
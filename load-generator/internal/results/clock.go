@@ -0,0 +1,13 @@
+package results
+
+import "time"
+
+// processStart is the reference of the monotonic offsets in the results,
+// adjustments of the wall clock during the run, e.g. by NTP, don't change them
+var processStart = time.Now()
+
+// MonotonicUs returns the microseconds from the start of the process to t on the monotonic clock.
+// t has to be a reading of time.Now of this process, parsed or serialized times have no monotonic reading.
+func MonotonicUs(t time.Time) int64 {
+	return t.Sub(processStart).Microseconds()
+}
@@ -0,0 +1,122 @@
+// Package results contains the per-operation events of the benchmarks,
+// writing them to results CSV files and computing statistics from these files.
+package results
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// CSVWriter wraps a csv.Writer and periodically flushes and fsyncs the underlying file,
+// every flushInterval or every flushRecords records, so a crash or SIGKILL near the end of
+// a long run loses at most the last few seconds of results.
+type CSVWriter struct {
+	mu           sync.Mutex
+	file         *os.File
+	writer       *csv.Writer
+	flushRecords int // 0 disables record based flushing
+	pending      int
+	flushErr     error // error of the last periodic flush, returned by the next call
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewCSVWriter takes ownership of the file, it is closed by Close
+func NewCSVWriter(file *os.File, flushInterval time.Duration, flushRecords int) *CSVWriter {
+	w := &CSVWriter{
+		file:         file,
+		writer:       csv.NewWriter(file),
+		flushRecords: flushRecords,
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+
+	go func() {
+		defer close(w.done)
+		if flushInterval <= 0 {
+			<-w.stop
+			return
+		}
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+				w.mu.Lock()
+				if err := w.flushLocked(); err != nil {
+					w.flushErr = fmt.Errorf("Flushing %s: %w", file.Name(), err)
+				}
+				w.mu.Unlock()
+			}
+		}
+	}()
+	return w
+}
+
+func (w *CSVWriter) Write(record []string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.takeFlushErr(); err != nil {
+		return err
+	}
+
+	if err := w.writer.Write(record); err != nil {
+		return err
+	}
+	w.pending++
+	if w.flushRecords > 0 && w.pending >= w.flushRecords {
+		return w.flushLocked()
+	}
+	return nil
+}
+
+// Flush writes buffered records to the file and syncs it to stable storage
+func (w *CSVWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.takeFlushErr(); err != nil {
+		return err
+	}
+	return w.flushLocked()
+}
+
+func (w *CSVWriter) takeFlushErr() error {
+	err := w.flushErr
+	w.flushErr = nil
+	return err
+}
+
+func (w *CSVWriter) flushLocked() error {
+	if w.pending == 0 {
+		return nil
+	}
+	w.writer.Flush()
+	if err := w.writer.Error(); err != nil {
+		return err
+	}
+	w.pending = 0
+	return w.file.Sync()
+}
+
+// Close stops the periodic flushing, flushes the remaining records and closes the file
+func (w *CSVWriter) Close() error {
+	close(w.stop)
+	<-w.done
+
+	if err := w.Flush(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+// Name returns the name of the file
+func (w *CSVWriter) Name() string {
+	return w.file.Name()
+}
@@ -0,0 +1,148 @@
+package results
+
+import "strconv"
+
+type InsertEvent struct {
+	WorkerID             int
+	JobType              string
+	BatchSize            int
+	UseBulkInsert        bool
+	StartTime            string
+	EndTime              string
+	InsertDurationUs     int64
+	WaitedForJobTimeUs   int64
+	SuccessfullyInserted int
+	FailedInserts        int
+	StartMonotonicUs     int64 // StartTime and EndTime on the monotonic clock, see MonotonicUs
+	EndMonotonicUs       int64
+	ReconnectUs          int64 // time the worker spent reconnecting before the batch, 0 if its connection was open
+	Tenant               int   // tenant of the batch with -tenants, not part of the CSV record
+}
+
+var InsertCSVHeader = []string{"runId", "workerId", "jobType", "batchSize", "useBulkInsert", "startTime", "endTime", "insertDurationUs", "waitedForJobTimeUs", "successfullyInserted", "failedInserts", "startMonotonicUs", "endMonotonicUs", "reconnectUs"}
+
+// CSVRecord returns the event as row of the insert results CSV, matching InsertCSVHeader
+func (event InsertEvent) CSVRecord(runID string) []string {
+	return []string{
+		runID,
+		strconv.Itoa(event.WorkerID),
+		event.JobType,
+		strconv.Itoa(event.BatchSize),
+		strconv.FormatBool(event.UseBulkInsert),
+		event.StartTime,
+		event.EndTime,
+		strconv.FormatInt(event.InsertDurationUs, 10),
+		strconv.FormatInt(event.WaitedForJobTimeUs, 10),
+		strconv.Itoa(event.SuccessfullyInserted),
+		strconv.Itoa(event.FailedInserts),
+		strconv.FormatInt(event.StartMonotonicUs, 10),
+		strconv.FormatInt(event.EndMonotonicUs, 10),
+		strconv.FormatInt(event.ReconnectUs, 10),
+	}
+}
+
+// IngestEvent is a batch of a pipeline benchmark, an insert with the end-to-end latency of its events
+// from being published until their batch was inserted
+type IngestEvent struct {
+	InsertEvent
+	E2EMinUs  int64
+	E2EMeanUs int64
+	E2EMaxUs  int64
+}
+
+var IngestCSVHeader = append(InsertCSVHeader[:len(InsertCSVHeader):len(InsertCSVHeader)], "e2eMinUs", "e2eMeanUs", "e2eMaxUs")
+
+// CSVRecord returns the event as row of the ingest results CSV, matching IngestCSVHeader.
+// The results can be analyzed like the ones of inserts.
+func (event IngestEvent) CSVRecord(runID string) []string {
+	return append(event.InsertEvent.CSVRecord(runID),
+		strconv.FormatInt(event.E2EMinUs, 10),
+		strconv.FormatInt(event.E2EMeanUs, 10),
+		strconv.FormatInt(event.E2EMaxUs, 10),
+	)
+}
+
+// PipelineEvent is a batch a consumer of the pipeline benchmark inserted, with the records left in its partitions after polling it
+type PipelineEvent struct {
+	IngestEvent
+	ConsumerLag int64
+}
+
+var PipelineCSVHeader = append(IngestCSVHeader[:len(IngestCSVHeader):len(IngestCSVHeader)], "consumerLag")
+
+// CSVRecord returns the event as row of the pipeline results CSV, matching PipelineCSVHeader
+func (event PipelineEvent) CSVRecord(runID string) []string {
+	return append(event.IngestEvent.CSVRecord(runID), strconv.FormatInt(event.ConsumerLag, 10))
+}
+
+// ProduceEvent is a batch of trip events the pipeline benchmark produced to a partition of a Kafka topic
+type ProduceEvent struct {
+	ProducerID        int
+	Partition         int
+	BatchSize         int
+	StartTime         string
+	EndTime           string
+	ProduceDurationUs int64
+	Successful        bool
+	ErrorMsg          string
+	StartMonotonicUs  int64
+	EndMonotonicUs    int64
+}
+
+var ProduceCSVHeader = []string{"runId", "producerId", "partition", "batchSize", "startTime", "endTime", "produceDurationUs", "successful", "errorMsg", "startMonotonicUs", "endMonotonicUs"}
+
+// CSVRecord returns the event as row of the produce results CSV, matching ProduceCSVHeader
+func (event ProduceEvent) CSVRecord(runID string) []string {
+	return []string{
+		runID,
+		strconv.Itoa(event.ProducerID),
+		strconv.Itoa(event.Partition),
+		strconv.Itoa(event.BatchSize),
+		event.StartTime,
+		event.EndTime,
+		strconv.FormatInt(event.ProduceDurationUs, 10),
+		strconv.FormatBool(event.Successful),
+		event.ErrorMsg,
+		strconv.FormatInt(event.StartMonotonicUs, 10),
+		strconv.FormatInt(event.EndMonotonicUs, 10),
+	}
+}
+
+type QueryEvent struct {
+	WorkerID           int
+	JobType            string
+	TemplateName       string
+	QueryDurationUs    int64
+	StartTime          string
+	EndTime            string
+	Successful         bool
+	ResultingRowsCount int
+	QueryIndex         int
+	ErrorMsg           string
+	StartMonotonicUs   int64 // StartTime and EndTime on the monotonic clock, see MonotonicUs
+	EndMonotonicUs     int64
+	ReconnectUs        int64 // time the worker spent reconnecting before the query, 0 if its connection was open
+	Tenant             int   // tenant of the query with -tenants, not part of the CSV record
+}
+
+var QueryCSVHeader = []string{"runId", "workerId", "jobType", "templateName", "queryDurationUs", "startTime", "endTime", "successful", "resultingRowsCount", "queryIndex", "errorMsg", "startMonotonicUs", "endMonotonicUs", "reconnectUs"}
+
+// CSVRecord returns the event as row of the query results CSV, matching QueryCSVHeader
+func (event QueryEvent) CSVRecord(runID string) []string {
+	return []string{
+		runID,
+		strconv.Itoa(event.WorkerID),
+		event.JobType,
+		event.TemplateName,
+		strconv.FormatInt(event.QueryDurationUs, 10),
+		event.StartTime,
+		event.EndTime,
+		strconv.FormatBool(event.Successful),
+		strconv.Itoa(event.ResultingRowsCount),
+		strconv.Itoa(event.QueryIndex),
+		event.ErrorMsg,
+		strconv.FormatInt(event.StartMonotonicUs, 10),
+		strconv.FormatInt(event.EndMonotonicUs, 10),
+		strconv.FormatInt(event.ReconnectUs, 10),
+	}
+}
@@ -0,0 +1,114 @@
+package results
+
+import (
+	"container/heap"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+)
+
+// MergeShards appends the rows of the shard CSV files to w ordered by their start time, the startMonotonicUs column.
+// The rows of a shard have to be ordered by start time already, as the rows of a worker are, so the shards are streamed
+// and only one row of each is held in memory. The shards have to have the header of w, which is not repeated.
+func MergeShards(w *CSVWriter, shardNames []string) error {
+	var shards shardHeap
+	defer func() {
+		for _, s := range shards {
+			s.file.Close()
+		}
+	}()
+	var header []string
+	startColumn := -1
+	for _, name := range shardNames {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		s := &shardReader{name: name, file: f, reader: csv.NewReader(f)}
+		shards = append(shards, s)
+		h, err := s.reader.Read()
+		if err != nil {
+			return fmt.Errorf("Reading header of %s: %w", name, err)
+		}
+		if header == nil {
+			header = h
+			startColumn = slices.Index(header, "startMonotonicUs")
+			if startColumn < 0 {
+				return fmt.Errorf("%s has no column startMonotonicUs", name)
+			}
+		} else if !slices.Equal(h, header) {
+			return fmt.Errorf("%s has another header than %s", name, shardNames[0])
+		}
+	}
+
+	// only the shards with rows remain in the heap
+	pending := shards[:0:0]
+	for _, s := range shards {
+		ok, err := s.next(startColumn)
+		if err != nil {
+			return err
+		}
+		if ok {
+			pending = append(pending, s)
+		}
+	}
+	heap.Init(&pending)
+	for pending.Len() > 0 {
+		s := pending[0]
+		if err := w.Write(s.record); err != nil {
+			return err
+		}
+		ok, err := s.next(startColumn)
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Fix(&pending, 0)
+		} else {
+			heap.Pop(&pending)
+		}
+	}
+	return nil
+}
+
+type shardReader struct {
+	name    string
+	file    *os.File
+	reader  *csv.Reader
+	line    int
+	record  []string
+	startUs int64
+}
+
+// next reads the next row of the shard, false at its end
+func (s *shardReader) next(startColumn int) (bool, error) {
+	record, err := s.reader.Read()
+	if err == io.EOF {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("Reading %s: %w", s.name, err)
+	}
+	s.line++
+	if s.startUs, err = strconv.ParseInt(record[startColumn], 10, 64); err != nil {
+		return false, fmt.Errorf("%s:%d: invalid startMonotonicUs: %w", s.name, s.line+1, err)
+	}
+	s.record = record
+	return true, nil
+}
+
+// shardHeap orders the shards by the start time of their current row
+type shardHeap []*shardReader
+
+func (h shardHeap) Len() int           { return len(h) }
+func (h shardHeap) Less(i, j int) bool { return h[i].startUs < h[j].startUs }
+func (h shardHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *shardHeap) Push(x any)        { *h = append(*h, x.(*shardReader)) }
+func (h *shardHeap) Pop() any {
+	old := *h
+	s := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return s
+}
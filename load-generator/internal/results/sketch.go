@@ -0,0 +1,78 @@
+package results
+
+import (
+	"math"
+	"slices"
+)
+
+// sketchAccuracy is the relative error of the quantiles of a LatencySketch
+const sketchAccuracy = 0.01
+
+var sketchGamma = (1 + sketchAccuracy) / (1 - sketchAccuracy)
+
+// LatencySketch estimates quantiles of latencies in constant memory by counting them in logarithmic buckets,
+// each quantile is within 1% of the exact value. The buckets of latencies from 1µs to a day are fewer than 1500.
+type LatencySketch struct {
+	buckets map[int]int64
+	zeros   int64 // latencies below 1µs
+	count   int64
+	sum     float64
+	max     float64
+}
+
+func NewLatencySketch() *LatencySketch {
+	return &LatencySketch{buckets: make(map[int]int64)}
+}
+
+// Add counts a latency in microseconds
+func (s *LatencySketch) Add(us float64) {
+	s.count++
+	s.sum += us
+	s.max = max(s.max, us)
+	if us < 1 {
+		s.zeros++
+		return
+	}
+	s.buckets[int(math.Ceil(math.Log(us)/math.Log(sketchGamma)))]++
+}
+
+func (s *LatencySketch) Count() int64 {
+	return s.count
+}
+
+func (s *LatencySketch) Mean() float64 {
+	if s.count == 0 {
+		return 0
+	}
+	return s.sum / float64(s.count)
+}
+
+func (s *LatencySketch) Max() float64 {
+	return s.max
+}
+
+// Quantile returns the estimated q-quantile with the nearest-rank method, like Percentile, 0 without latencies
+func (s *LatencySketch) Quantile(q float64) float64 {
+	if s.count == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(q*float64(s.count))) - 1
+	rank = max(0, min(rank, s.count-1))
+	if rank < s.zeros {
+		return 0
+	}
+	seen := s.zeros
+	keys := make([]int, 0, len(s.buckets))
+	for k := range s.buckets {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		seen += s.buckets[k]
+		if seen > rank {
+			// the value of the bucket's center, within the relative accuracy of all latencies of the bucket
+			return min(2*math.Pow(sketchGamma, float64(k))/(sketchGamma+1), s.max)
+		}
+	}
+	return s.max
+}
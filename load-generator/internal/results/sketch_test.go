@@ -0,0 +1,62 @@
+package results
+
+import (
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestLatencySketchQuantile(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	distributions := []struct {
+		name   string
+		sample func() float64
+	}{
+		{"constant", func() float64 { return 1234 }},
+		{"uniform", func() float64 { return 1 + rng.Float64()*100000 }},
+		{"exponential", func() float64 { return rng.ExpFloat64() * 5000 }},
+		{"log-normal", func() float64 { return math.Exp(8 + 2*rng.NormFloat64()) }},
+		{"integer microseconds", func() float64 { return float64(rng.Intn(2000)) }},
+		{"below 1µs and a long tail", func() float64 {
+			if rng.Intn(10) == 0 {
+				return 0.5
+			}
+			return math.Pow(10, rng.Float64()*10)
+		}},
+	}
+	quantiles := []float64{0, 0.001, 0.1, 0.25, 0.5, 0.75, 0.9, 0.95, 0.99, 0.999, 1}
+	for _, d := range distributions {
+		t.Run(d.name, func(t *testing.T) {
+			for _, n := range []int{1, 7, 1000, 100000} {
+				s := NewLatencySketch()
+				values := make([]float64, n)
+				for i := range values {
+					values[i] = d.sample()
+					s.Add(values[i])
+				}
+				slices.Sort(values)
+				for _, q := range quantiles {
+					exact := Percentile(values, q)
+					if exact < 1 {
+						exact = 0 // latencies below 1µs are estimated as 0
+					}
+					got := s.Quantile(q)
+					if math.Abs(got-exact) > sketchAccuracy*exact+1e-9 {
+						t.Errorf("%d values: Quantile(%g) = %g, exact %g, more than %g%% apart", n, q, got, exact, sketchAccuracy*100)
+					}
+				}
+				if s.Count() != int64(n) || s.Max() != values[n-1] {
+					t.Errorf("%d values: count %d and max %g, want %d and %g", n, s.Count(), s.Max(), n, values[n-1])
+				}
+			}
+		})
+	}
+}
+
+func TestLatencySketchEmpty(t *testing.T) {
+	s := NewLatencySketch()
+	if s.Quantile(0.5) != 0 || s.Mean() != 0 || s.Max() != 0 || s.Count() != 0 {
+		t.Errorf("empty sketch has quantile %g, mean %g, max %g and count %d, want 0", s.Quantile(0.5), s.Mean(), s.Max(), s.Count())
+	}
+}
@@ -0,0 +1,130 @@
+package results
+
+import (
+	"cmp"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// SortColumns are the columns SortCSV sorts by
+var SortColumns = []string{"startTime", "queryIndex"}
+
+type sortedRow struct {
+	primary int64
+	startUs int64
+	worker  int
+	record  []string
+}
+
+// SortCSV sorts the rows of the results CSV by the column, ties are ordered by the start time and then by the worker,
+// so the rows of runs of the same workload are in the same order however the workers interleaved.
+// The sorted rows replace the file atomically, all rows have to fit into memory.
+func SortCSV(filename, column string) error {
+	if !slices.Contains(SortColumns, column) {
+		return fmt.Errorf("Unable to sort by %q, expected one of %v", column, SortColumns)
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	records, err := csv.NewReader(f).ReadAll()
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("Reading %s: %w", filename, err)
+	}
+	if len(records) == 0 {
+		return fmt.Errorf("%s has no header", filename)
+	}
+	header := records[0]
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[name] = i
+	}
+	if _, ok := columns[column]; !ok {
+		return fmt.Errorf("%s has no column %s", filename, column)
+	}
+
+	rows := make([]sortedRow, len(records)-1)
+	for i, record := range records[1:] {
+		if rows[i], err = newSortedRow(columns, column, record); err != nil {
+			return fmt.Errorf("%s:%d: %w", filename, i+2, err)
+		}
+	}
+	slices.SortStableFunc(rows, func(a, b sortedRow) int {
+		return cmp.Or(cmp.Compare(a.primary, b.primary), cmp.Compare(a.startUs, b.startUs), cmp.Compare(a.worker, b.worker))
+	})
+
+	sorted, err := os.CreateTemp(filepath.Dir(filename), ".sorting-*.csv")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(sorted.Name())
+	w := csv.NewWriter(sorted)
+	w.Write(header)
+	for _, row := range rows {
+		w.Write(row.record)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		sorted.Close()
+		return fmt.Errorf("Writing sorted %s: %w", filename, err)
+	}
+	if err := sorted.Chmod(info.Mode().Perm()); err != nil {
+		sorted.Close()
+		return err
+	}
+	if err := sorted.Sync(); err != nil {
+		sorted.Close()
+		return err
+	}
+	if err := sorted.Close(); err != nil {
+		return err
+	}
+	return os.Rename(sorted.Name(), filename)
+}
+
+// newSortedRow reads the sort keys of the record. The start time is startMonotonicUs if the CSV has it, as the wall clock may step during a run,
+// the worker is workerId or producerId
+func newSortedRow(columns map[string]int, column string, record []string) (sortedRow, error) {
+	row := sortedRow{record: record}
+	if i, ok := columns["startMonotonicUs"]; ok {
+		startUs, err := strconv.ParseInt(record[i], 10, 64)
+		if err != nil {
+			return row, fmt.Errorf("invalid startMonotonicUs: %w", err)
+		}
+		row.startUs = startUs
+	} else if i, ok := columns["startTime"]; ok {
+		start, err := time.Parse(time.RFC3339Nano, record[i])
+		if err != nil {
+			return row, fmt.Errorf("invalid startTime: %w", err)
+		}
+		row.startUs = start.UnixMicro()
+	}
+	for _, name := range []string{"workerId", "producerId"} {
+		if i, ok := columns[name]; ok {
+			worker, err := strconv.Atoi(record[i])
+			if err != nil {
+				return row, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			row.worker = worker
+			break
+		}
+	}
+	if column == "queryIndex" {
+		index, err := strconv.ParseInt(record[columns[column]], 10, 64)
+		if err != nil {
+			return row, fmt.Errorf("invalid queryIndex: %w", err)
+		}
+		row.primary = index
+	}
+	return row, nil
+}
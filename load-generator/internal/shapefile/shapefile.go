@@ -0,0 +1,224 @@
+// Package shapefile reads the polygons of an ESRI shapefile (.shp) with their attributes (.dbf),
+// the format official administrative boundaries are often distributed in.
+package shapefile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"load-generator/internal/geo"
+)
+
+// shape types
+const (
+	shapeNull     = 0
+	shapePolygon  = 5
+	shapePolygonZ = 15
+	shapePolygonM = 25
+)
+
+// Record is a shape with its attributes. Rings is nil for null shapes.
+// Exterior rings are clockwise, holes counterclockwise, both closed.
+type Record struct {
+	Attributes map[string]string
+	Rings      [][][2]float64
+}
+
+// Read decodes the polygons of shp and the attributes of dbf, the records of both files correspond by position
+func Read(shp, dbf []byte) ([]Record, error) {
+	rings, err := readShapes(shp)
+	if err != nil {
+		return nil, err
+	}
+	attributes, err := readAttributes(dbf)
+	if err != nil {
+		return nil, err
+	}
+	if len(rings) != len(attributes) {
+		return nil, fmt.Errorf("Shapefile with %d shapes but %d attribute records", len(rings), len(attributes))
+	}
+	records := make([]Record, 0, len(rings))
+	for i := range rings {
+		if attributes[i] != nil {
+			records = append(records, Record{Attributes: attributes[i], Rings: rings[i]})
+		}
+	}
+	return records, nil
+}
+
+// Geometry returns the rings as a GeoJSON MultiPolygon, each hole assigned to the exterior ring containing it.
+// The rings keep the clockwise exterior orientation of shapefiles.
+func (r Record) Geometry() (json.RawMessage, error) {
+	if r.Rings == nil {
+		return nil, errors.New("Null shape without geometry")
+	}
+	var polygons [][][][2]float64
+	var holes [][][2]float64
+	for _, ring := range r.Rings {
+		if geo.SignedArea(ring) <= 0 {
+			polygons = append(polygons, [][][2]float64{ring})
+		} else {
+			holes = append(holes, ring)
+		}
+	}
+	if len(polygons) == 0 {
+		return nil, errors.New("Polygon without clockwise exterior ring")
+	}
+	for _, hole := range holes {
+		for i, polygon := range polygons {
+			if len(hole) > 0 && geo.ContainsPoint(polygon[0], hole[0]) {
+				polygons[i] = append(polygons[i], hole)
+				break
+			}
+		}
+	}
+	return json.Marshal(map[string]any{"type": "MultiPolygon", "coordinates": polygons})
+}
+
+func readShapes(b []byte) ([][][][2]float64, error) {
+	if len(b) < 100 || binary.BigEndian.Uint32(b) != 9994 {
+		return nil, errors.New("No shapefile, the file code 9994 is missing")
+	}
+	if length := int(binary.BigEndian.Uint32(b[24:])) * 2; length < 100 {
+		return nil, errors.New("Invalid shapefile length, shorter than its header")
+	} else if length < len(b) {
+		b = b[:length]
+	}
+	switch shapeType := binary.LittleEndian.Uint32(b[32:]); shapeType {
+	case shapeNull, shapePolygon, shapePolygonZ, shapePolygonM:
+	default:
+		return nil, fmt.Errorf("Unsupported shape type %d, only polygons are supported", shapeType)
+	}
+
+	var shapes [][][][2]float64
+	for pos := 100; pos < len(b); {
+		if pos+8 > len(b) {
+			return nil, errors.New("Truncated shapefile record header")
+		}
+		length := int(binary.BigEndian.Uint32(b[pos+4:])) * 2
+		pos += 8
+		if length < 4 || pos+length > len(b) {
+			return nil, fmt.Errorf("Truncated shapefile record %d", len(shapes)+1)
+		}
+		content := b[pos : pos+length]
+		pos += length
+
+		switch shapeType := binary.LittleEndian.Uint32(content); shapeType {
+		case shapeNull:
+			shapes = append(shapes, nil)
+		case shapePolygon, shapePolygonZ, shapePolygonM:
+			rings, err := readPolygon(content)
+			if err != nil {
+				return nil, fmt.Errorf("Shapefile record %d: %w", len(shapes)+1, err)
+			}
+			shapes = append(shapes, rings)
+		default:
+			return nil, fmt.Errorf("Shapefile record %d has the unsupported shape type %d", len(shapes)+1, shapeType)
+		}
+	}
+	return shapes, nil
+}
+
+// readPolygon decodes the X and Y coordinates of a polygon record, the Z and M values following them are ignored
+func readPolygon(content []byte) ([][][2]float64, error) {
+	if len(content) < 44 {
+		return nil, errors.New("Truncated polygon")
+	}
+	numParts := int(binary.LittleEndian.Uint32(content[36:]))
+	numPoints := int(binary.LittleEndian.Uint32(content[40:]))
+	pointsStart := 44 + 4*numParts
+	if numParts < 0 || numPoints < 0 || pointsStart+16*numPoints > len(content) {
+		return nil, errors.New("Truncated polygon")
+	}
+	rings := make([][][2]float64, numParts)
+	for i := range rings {
+		start := int(binary.LittleEndian.Uint32(content[44+4*i:]))
+		end := numPoints
+		if i+1 < numParts {
+			end = int(binary.LittleEndian.Uint32(content[44+4*(i+1):]))
+		}
+		if start > end || end > numPoints {
+			return nil, errors.New("Invalid polygon part offsets")
+		}
+		ring := make([][2]float64, end-start)
+		for j := range ring {
+			p := pointsStart + 16*(start+j)
+			ring[j] = [2]float64{
+				math.Float64frombits(binary.LittleEndian.Uint64(content[p:])),
+				math.Float64frombits(binary.LittleEndian.Uint64(content[p+8:])),
+			}
+		}
+		rings[i] = ring
+	}
+	return rings, nil
+}
+
+// readAttributes decodes the records of a dBASE table, nil for deleted ones.
+// Values are trimmed, texts not valid UTF-8 are decoded as ISO 8859-1.
+func readAttributes(b []byte) ([]map[string]string, error) {
+	if len(b) < 32 {
+		return nil, errors.New("Truncated dBASE header")
+	}
+	numRecords := int(binary.LittleEndian.Uint32(b[4:]))
+	headerLength := int(binary.LittleEndian.Uint16(b[8:]))
+	recordLength := int(binary.LittleEndian.Uint16(b[10:]))
+	if headerLength > len(b) {
+		return nil, errors.New("Truncated dBASE header")
+	}
+	if recordLength < 1 {
+		return nil, errors.New("dBASE records without deletion flag")
+	}
+
+	type field struct {
+		name   string
+		offset int
+		length int
+	}
+	var fields []field
+	offset := 1 // deletion flag
+	for pos := 32; pos+32 <= headerLength && b[pos] != 0x0d; pos += 32 {
+		name, _, _ := bytes.Cut(b[pos:pos+11], []byte{0})
+		length := int(b[pos+16])
+		fields = append(fields, field{name: string(name), offset: offset, length: length})
+		offset += length
+	}
+	if offset > recordLength {
+		return nil, errors.New("dBASE fields exceed the record length")
+	}
+
+	records := make([]map[string]string, 0, min(numRecords, (len(b)-headerLength)/recordLength))
+	for i := range numRecords {
+		start := headerLength + i*recordLength
+		if start+recordLength > len(b) {
+			return nil, fmt.Errorf("Truncated dBASE record %d", i+1)
+		}
+		record := b[start : start+recordLength]
+		if record[0] == '*' {
+			records = append(records, nil)
+			continue
+		}
+		attributes := make(map[string]string, len(fields))
+		for _, f := range fields {
+			attributes[f.name] = decodeText(bytes.TrimSpace(record[f.offset : f.offset+f.length]))
+		}
+		records = append(records, attributes)
+	}
+	return records, nil
+}
+
+func decodeText(b []byte) string {
+	if utf8.Valid(b) {
+		return string(b)
+	}
+	var sb strings.Builder
+	for _, c := range b {
+		sb.WriteRune(rune(c))
+	}
+	return sb.String()
+}
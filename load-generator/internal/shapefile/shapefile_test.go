@@ -0,0 +1,219 @@
+package shapefile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// shpFile frames the record contents with the file and record headers of a polygon shapefile
+func shpFile(contents ...[]byte) []byte {
+	b := make([]byte, 100)
+	binary.BigEndian.PutUint32(b, 9994)
+	binary.LittleEndian.PutUint32(b[28:], 1000)
+	binary.LittleEndian.PutUint32(b[32:], shapePolygon)
+	for i, content := range contents {
+		b = binary.BigEndian.AppendUint32(b, uint32(i+1))
+		b = binary.BigEndian.AppendUint32(b, uint32(len(content)/2))
+		b = append(b, content...)
+	}
+	binary.BigEndian.PutUint32(b[24:], uint32(len(b)/2))
+	return b
+}
+
+// polygon encodes a polygon record of the rings, the bounding box is left empty as the reader ignores it
+func polygon(rings ...[][2]float64) []byte {
+	b := binary.LittleEndian.AppendUint32(nil, shapePolygon)
+	b = append(b, make([]byte, 32)...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(rings)))
+	numPoints := 0
+	for _, ring := range rings {
+		numPoints += len(ring)
+	}
+	b = binary.LittleEndian.AppendUint32(b, uint32(numPoints))
+	start := 0
+	for _, ring := range rings {
+		b = binary.LittleEndian.AppendUint32(b, uint32(start))
+		start += len(ring)
+	}
+	for _, ring := range rings {
+		for _, p := range ring {
+			b = binary.LittleEndian.AppendUint64(b, math.Float64bits(p[0]))
+			b = binary.LittleEndian.AppendUint64(b, math.Float64bits(p[1]))
+		}
+	}
+	return b
+}
+
+var nullShape = binary.LittleEndian.AppendUint32(nil, shapeNull)
+
+type dbfField struct {
+	name   string
+	length int
+}
+
+// dbfFile encodes a dBASE III table of character fields, records starting with * are deleted
+func dbfFile(fields []dbfField, records ...string) []byte {
+	recordLength := 1
+	for _, f := range fields {
+		recordLength += f.length
+	}
+	b := make([]byte, 32)
+	b[0] = 0x03
+	binary.LittleEndian.PutUint32(b[4:], uint32(len(records)))
+	binary.LittleEndian.PutUint16(b[8:], uint16(32+32*len(fields)+1))
+	binary.LittleEndian.PutUint16(b[10:], uint16(recordLength))
+	for _, f := range fields {
+		descriptor := make([]byte, 32)
+		copy(descriptor, f.name)
+		descriptor[11] = 'C'
+		descriptor[16] = byte(f.length)
+		b = append(b, descriptor...)
+	}
+	b = append(b, 0x0d)
+	for _, record := range records {
+		b = append(b, record...)
+	}
+	return append(b, 0x1a)
+}
+
+// the clockwise exterior ring of a square with a counterclockwise hole and a second square
+var (
+	square      = [][2]float64{{0, 0}, {0, 10}, {10, 10}, {10, 0}, {0, 0}}
+	hole        = [][2]float64{{2, 2}, {4, 2}, {4, 4}, {2, 4}, {2, 2}}
+	otherSquare = [][2]float64{{20, 0}, {20, 1}, {21, 1}, {21, 0}, {20, 0}}
+	fields      = []dbfField{{"NAME", 10}, {"AGS", 8}}
+)
+
+func TestRead(t *testing.T) {
+	shp := shpFile(polygon(square, hole, otherSquare), nullShape, polygon(otherSquare))
+	dbf := dbfFile(fields,
+		" Berlin    11000000",
+		" Ma\xdfen     09479145", // ISO 8859-1
+		"*Deleted   00000000",
+	)
+	records, err := Read(shp, dbf)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	want := []Record{
+		{Attributes: map[string]string{"NAME": "Berlin", "AGS": "11000000"}, Rings: [][][2]float64{square, hole, otherSquare}},
+		{Attributes: map[string]string{"NAME": "Maßen", "AGS": "09479145"}},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Fatalf("Read = %v, want %v", records, want)
+	}
+
+	geometry, err := records[0].Geometry()
+	if err != nil {
+		t.Fatalf("Geometry failed: %v", err)
+	}
+	var got struct {
+		Type        string
+		Coordinates [][][][2]float64
+	}
+	if err := json.Unmarshal(geometry, &got); err != nil {
+		t.Fatal(err)
+	}
+	wantCoordinates := [][][][2]float64{{square, hole}, {otherSquare}}
+	if got.Type != "MultiPolygon" || !reflect.DeepEqual(got.Coordinates, wantCoordinates) {
+		t.Errorf("Geometry = %s, want a MultiPolygon of %v", geometry, wantCoordinates)
+	}
+	if _, err := records[1].Geometry(); err == nil {
+		t.Errorf("Geometry of a null shape succeeded")
+	}
+}
+
+func TestReadMalformed(t *testing.T) {
+	shp := shpFile(polygon(square))
+	dbf := dbfFile(fields, " Berlin    11000000")
+	withUint32 := func(b []byte, at int, order binary.ByteOrder, v uint32) []byte {
+		b = bytes.Clone(b)
+		order.PutUint32(b[at:], v)
+		return b
+	}
+	withUint16 := func(b []byte, at int, v uint16) []byte {
+		b = bytes.Clone(b)
+		binary.LittleEndian.PutUint16(b[at:], v)
+		return b
+	}
+	// offsets into the first record: its header at 100, the content at 108 with the parts at 152
+	tests := []struct {
+		name    string
+		shp     []byte
+		dbf     []byte
+		wantErr string
+	}{
+		{"empty shapefile", nil, dbf, "file code 9994"},
+		{"no shapefile", dbf, dbf, "file code 9994"},
+		{"truncated shapefile header", shp[:99], dbf, "file code 9994"},
+		{"file length shorter than the header", withUint32(shp, 24, binary.BigEndian, 10), dbf, "Invalid shapefile length"},
+		{"point shapefile", withUint32(shp, 32, binary.LittleEndian, 1), dbf, "Unsupported shape type 1"},
+		{"truncated record header", withUint32(append(bytes.Clone(shp), 0, 0, 0, 2), 24, binary.BigEndian, uint32(len(shp)+4)/2), dbf, "Truncated shapefile record header"},
+		{"truncated record", shp[:len(shp)-1], dbf, "Truncated shapefile record 1"},
+		{"record length beyond the file", withUint32(shp, 104, binary.BigEndian, 1<<30), dbf, "Truncated shapefile record 1"},
+		{"record shorter than its shape type", withUint32(shp, 104, binary.BigEndian, 1), dbf, "Truncated shapefile record 1"},
+		{"point record", withUint32(shp, 108, binary.LittleEndian, 1), dbf, "unsupported shape type 1"},
+		{"truncated polygon", shpFile(polygon(square)[:40]), dbf, "Truncated polygon"},
+		{"more parts than bytes", withUint32(shp, 144, binary.LittleEndian, 1<<30), dbf, "Truncated polygon"},
+		{"more points than bytes", withUint32(shp, 148, binary.LittleEndian, 6), dbf, "Truncated polygon"},
+		{"negative number of points", withUint32(shp, 148, binary.LittleEndian, math.MaxUint32), dbf, "Truncated polygon"},
+		{"part beyond the points", withUint32(shpFile(polygon(square, hole)), 156, binary.LittleEndian, 11), dbf, "Invalid polygon part offsets"},
+		{"parts out of order", withUint32(shpFile(polygon(square, hole)), 152, binary.LittleEndian, 7), dbf, "Invalid polygon part offsets"},
+		{"truncated dBASE header", shp, dbf[:31], "Truncated dBASE header"},
+		{"header length beyond the file", shp, withUint16(dbf, 8, 1000), "Truncated dBASE header"},
+		{"fields beyond the record length", shp, withUint16(dbf, 10, 18), "dBASE fields exceed the record length"},
+		{"records without deletion flag", shp, withUint16(dbfFile(nil), 10, 0), "dBASE records without deletion flag"},
+		{"truncated record", shp, dbf[:len(dbf)-3], "Truncated dBASE record 1"},
+		{"more records than bytes", shp, withUint32(dbf, 4, binary.LittleEndian, math.MaxUint32), "Truncated dBASE record 2"},
+		{"fewer attribute records than shapes", shpFile(polygon(square), nullShape), dbf, "2 shapes but 1 attribute records"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := Read(tt.shp, tt.dbf)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Read = %v, %v, want an error containing %q", records, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGeometryWithoutExteriorRing(t *testing.T) {
+	if _, err := (Record{Rings: [][][2]float64{hole}}).Geometry(); err == nil || !strings.Contains(err.Error(), "without clockwise exterior ring") {
+		t.Errorf("Geometry error = %v, want the missing exterior ring", err)
+	}
+}
+
+// TestReadCorrupted overwrites every byte of both files, Read may decode garbage but must not panic
+func TestReadCorrupted(t *testing.T) {
+	shp := shpFile(polygon(square, hole), nullShape)
+	dbf := dbfFile(fields, " Berlin    11000000", "*Deleted   00000000")
+	for _, corruptShp := range []bool{true, false} {
+		valid := dbf
+		if corruptShp {
+			valid = shp
+		}
+		for i := range len(valid) {
+			for _, value := range []byte{0x00, 0x7f, 0xff} {
+				b := bytes.Clone(valid)
+				b[i] = value
+				func() {
+					defer func() {
+						if r := recover(); r != nil {
+							t.Errorf("Read panicked with byte %d of the shapefile (%v) set to %#x: %v", i, corruptShp, value, r)
+						}
+					}()
+					if corruptShp {
+						Read(b, dbf)
+					} else {
+						Read(shp, b)
+					}
+				}()
+			}
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package targets
+
+import (
+	"strings"
+
+	"load-generator/internal/workload"
+)
+
+// eventAttributes are the additional columns of escooter_events inserted with every event, set for the wide schema variants
+var eventAttributes []workload.EventAttribute
+
+// SetEventAttributes sets the additional columns the insert statements of the trip events fill
+func SetEventAttributes(attributes []workload.EventAttribute) {
+	eventAttributes = attributes
+}
+
+// attributeSQLType is the column type of an event attribute, identical for both targets
+func attributeSQLType(a workload.EventAttribute) string {
+	switch a.Type {
+	case workload.AttributeInteger:
+		return "INTEGER"
+	case workload.AttributeDouble:
+		return "DOUBLE PRECISION"
+	default:
+		return "TEXT"
+	}
+}
+
+// attributeLiteral returns the SQL literal of an attribute value, empty values are NULL.
+// Numbers are validated when the events are read.
+func attributeLiteral(a workload.EventAttribute, value string) string {
+	if value == "" {
+		return "NULL"
+	}
+	if a.Type == workload.AttributeText {
+		return QuoteLiteral(value)
+	}
+	return value
+}
+
+// attributeColumns returns the column names of the attributes each prefixed with sep, empty without attributes
+func attributeColumns(sep string) string {
+	var sb strings.Builder
+	for _, a := range eventAttributes {
+		sb.WriteString(sep)
+		sb.WriteString(a.Column)
+	}
+	return sb.String()
+}
+
+// attributeValues returns the literals of the event's attribute values prefixed with a comma
+func attributeValues(event workload.TripEvent) string {
+	var sb strings.Builder
+	for i, a := range eventAttributes {
+		sb.WriteString(", ")
+		sb.WriteString(attributeLiteral(a, attributeValue(event, i)))
+	}
+	return sb.String()
+}
+
+func attributeValue(event workload.TripEvent, i int) string {
+	if i < len(event.Attributes) {
+		return event.Attributes[i]
+	}
+	return ""
+}
+
+// attributeArrays returns an UNNEST array argument of every attribute prefixed with a comma, of the column type
+func attributeArrays(d Dialect, events []workload.TripEvent) string {
+	var sb strings.Builder
+	for i, a := range eventAttributes {
+		literals := make([]string, len(events))
+		for j, event := range events {
+			literals[j] = attributeLiteral(a, attributeValue(event, i))
+		}
+		sb.WriteString(",\n\t" + d.Array(literals, attributeSQLType(a)))
+	}
+	return sb.String()
+}
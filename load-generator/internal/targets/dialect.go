@@ -0,0 +1,91 @@
+package targets
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Dialect builds the parts of SQL statements whose syntax differs between CrateDB and MobilityDB's Postgres,
+// so the statements are written once for both targets
+type Dialect struct {
+	target DBTarget
+}
+
+// Dialect returns the SQL dialect of the target
+func (target DBTarget) Dialect() Dialect {
+	return Dialect{target: target}
+}
+
+// the Postgres types of the array elements and parameters, CrateDB infers them from the columns
+const (
+	uuidType        = "UUID"
+	timestamptzType = "TIMESTAMPTZ"
+	pointType       = "geometry(Point, 4326)"
+	integerType     = "INTEGER"
+)
+
+// Placeholder returns the n-th positional parameter, counting from 1, both targets use $n
+func (d Dialect) Placeholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+// TypedPlaceholder returns the n-th parameter cast to sqlType on Postgres, which can't infer it e.g. from a Go slice of strings,
+// and the plain parameter on CrateDB
+func (d Dialect) TypedPlaceholder(n int, sqlType string) string {
+	if d.target == MobilityDB {
+		return d.Placeholder(n) + "::" + sqlType
+	}
+	return d.Placeholder(n)
+}
+
+// Array returns the array of the SQL literals, [...] on CrateDB and ARRAY[...] cast to sqlType[] on Postgres,
+// an empty sqlType leaves the element type to Postgres
+func (d Dialect) Array(literals []string, sqlType string) string {
+	if d.target != MobilityDB {
+		return "[" + strings.Join(literals, ",") + "]"
+	}
+	array := "ARRAY[" + strings.Join(literals, ",") + "]"
+	if sqlType != "" {
+		array += "::" + sqlType + "[]"
+	}
+	return array
+}
+
+// StringArray returns the array of the values as escaped string literals, see Array
+func (d Dialect) StringArray(values []string, sqlType string) string {
+	literals := make([]string, len(values))
+	for i, v := range values {
+		literals[i] = QuoteLiteral(v)
+	}
+	return d.Array(literals, sqlType)
+}
+
+// Point returns the string literal of a WGS 84 point, WKT on CrateDB and EWKT with SRID 4326 on Postgres
+func (d Dialect) Point(longitude, latitude string) string {
+	if d.target == MobilityDB {
+		return QuoteLiteral("SRID=4326;POINT(" + longitude + " " + latitude + ")")
+	}
+	return QuoteLiteral("POINT( " + longitude + " " + latitude + " )")
+}
+
+// GeometryFromGeoJSON returns the expression converting the GeoJSON of expr into a geometry, CrateDB stores GeoJSON objects as they are
+func (d Dialect) GeometryFromGeoJSON(expr string) string {
+	if d.target == MobilityDB {
+		return "ST_GeomFromGeoJSON(" + expr + ")"
+	}
+	return expr
+}
+
+// Text returns expr as text, needed for the UUID columns of Postgres, CrateDB stores the IDs as text
+func (d Dialect) Text(expr string) string {
+	if d.target == MobilityDB {
+		return expr + "::text"
+	}
+	return expr
+}
+
+// QuoteIdent quotes an identifier, both targets use double quotes. NUL characters are removed like from literals.
+func (d Dialect) QuoteIdent(name string) string {
+	name = strings.ReplaceAll(name, "\x00", "")
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
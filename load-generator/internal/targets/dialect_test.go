@@ -0,0 +1,113 @@
+package targets
+
+import (
+	"strings"
+	"testing"
+
+	"load-generator/internal/workload"
+)
+
+func TestDialect(t *testing.T) {
+	tests := []struct {
+		name           string
+		sql            func(d Dialect) string
+		wantCrateDB    string
+		wantMobilityDB string
+	}{
+		{"placeholder", func(d Dialect) string { return d.Placeholder(3) }, "$3", "$3"},
+		{"typed placeholder", func(d Dialect) string { return d.TypedPlaceholder(1, uuidType) }, "$1", "$1::UUID"},
+		{"array", func(d Dialect) string { return d.Array([]string{"1", "2"}, integerType) }, "[1,2]", "ARRAY[1,2]::INTEGER[]"},
+		{"array without type", func(d Dialect) string { return d.Array([]string{"1", "2"}, "") }, "[1,2]", "ARRAY[1,2]"},
+		{"empty array", func(d Dialect) string { return d.Array(nil, timestamptzType) }, "[]", "ARRAY[]::TIMESTAMPTZ[]"},
+		{"string array", func(d Dialect) string { return d.StringArray([]string{"a", "O'Brien"}, uuidType) },
+			"['a','O''Brien']", "ARRAY['a','O''Brien']::UUID[]"},
+		{"point", func(d Dialect) string { return d.Point("13.4", "52.5") }, "'POINT( 13.4 52.5 )'", "'SRID=4326;POINT(13.4 52.5)'"},
+		{"geometry from GeoJSON", func(d Dialect) string { return d.GeometryFromGeoJSON("$1") }, "$1", "ST_GeomFromGeoJSON($1)"},
+		{"text", func(d Dialect) string { return d.Text("trip_id") }, "trip_id", "trip_id::text"},
+		{"identifier", func(d Dialect) string { return d.QuoteIdent("battery") }, `"battery"`, `"battery"`},
+		{"identifier with quotes and NUL", func(d Dialect) string { return d.QuoteIdent("a\"b\x00c") }, `"a""bc"`, `"a""bc"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.sql(CrateDB.Dialect()); got != tt.wantCrateDB {
+				t.Errorf("CrateDB: %s, want %s", got, tt.wantCrateDB)
+			}
+			if got := tt.sql(MobilityDB.Dialect()); got != tt.wantMobilityDB {
+				t.Errorf("MobilityDB: %s, want %s", got, tt.wantMobilityDB)
+			}
+		})
+	}
+}
+
+// normalizeSQL collapses the whitespace of the statement, which only formats it
+func normalizeSQL(sql string) string {
+	return strings.Join(strings.Fields(sql), " ")
+}
+
+func TestStatementsPerTarget(t *testing.T) {
+	events := []workload.TripEvent{
+		{EventID: "e1", TripID: "t1", Timestamp: "2024-01-01T00:00:00Z", Latitude: "52.5", Longitude: "13.4"},
+		{EventID: "e2", TripID: "t1", Timestamp: "2024-01-01T00:00:10Z", Latitude: "52.6", Longitude: "13.4"},
+	}
+	tests := []struct {
+		name           string
+		idempotent     bool
+		sql            func(target DBTarget) string
+		wantCrateDB    string
+		wantMobilityDB string
+	}{
+		{
+			name: "insert event",
+			sql:  func(target DBTarget) string { return InsertEventSQL(target, events[0]) },
+			wantCrateDB: "INSERT INTO escooter_events ( event_id, trip_id, timestamp, geo_point ) " +
+				"VALUES ( 'e1', 't1', '2024-01-01T00:00:00Z', 'POINT( 13.4 52.5 )' );",
+			wantMobilityDB: "INSERT INTO escooter_events ( event_id, trip_id, timestamp, geo_point ) " +
+				"VALUES ( 'e1', 't1', '2024-01-01T00:00:00Z', 'SRID=4326;POINT(13.4 52.5)' );",
+		},
+		{
+			name:       "idempotent insert event",
+			idempotent: true,
+			sql:        func(target DBTarget) string { return InsertEventSQL(target, events[0]) },
+			wantCrateDB: "INSERT INTO escooter_events ( event_id, trip_id, timestamp, geo_point ) " +
+				"VALUES ( 'e1', 't1', '2024-01-01T00:00:00Z', 'POINT( 13.4 52.5 )' ) ON CONFLICT DO NOTHING;",
+			wantMobilityDB: "INSERT INTO escooter_events ( event_id, trip_id, timestamp, geo_point ) " +
+				"VALUES ( 'e1', 't1', '2024-01-01T00:00:00Z', 'SRID=4326;POINT(13.4 52.5)' ) ON CONFLICT DO NOTHING;",
+		},
+		{
+			name: "bulk insert events",
+			sql:  func(target DBTarget) string { return BulkInsertEventsSQL(target, events) },
+			wantCrateDB: "INSERT INTO escooter_events ( event_id, trip_id, timestamp, geo_point ) (SELECT * FROM UNNEST( " +
+				"['e1','e2'], ['t1','t1'], ['2024-01-01T00:00:00Z','2024-01-01T00:00:10Z'], " +
+				"['POINT( 13.4 52.5 )','POINT( 13.4 52.6 )'] ) );",
+			wantMobilityDB: "INSERT INTO escooter_events ( event_id, trip_id, timestamp, geo_point ) (SELECT * FROM UNNEST( " +
+				"ARRAY['e1','e2']::UUID[], ARRAY['t1','t1']::UUID[], ARRAY['2024-01-01T00:00:00Z','2024-01-01T00:00:10Z']::TIMESTAMPTZ[], " +
+				"ARRAY['SRID=4326;POINT(13.4 52.5)','SRID=4326;POINT(13.4 52.6)']::geometry(Point, 4326)[] ) );",
+		},
+		{
+			name:           "insert locality",
+			sql:            func(target DBTarget) string { return LocalityInsertSQL(target, false) },
+			wantCrateDB:    "INSERT INTO localities ( locality_id, name, geo_shape) VALUES ( $1, $2, $3);",
+			wantMobilityDB: "INSERT INTO localities ( locality_id, name, geo_shape) VALUES ( $1, $2, ST_GeomFromGeoJSON($3));",
+		},
+		// CrateDB doesn't support ST_MakeValid
+		{
+			name:        "insert repaired locality",
+			sql:         func(target DBTarget) string { return LocalityInsertSQL(target, true) },
+			wantCrateDB: "INSERT INTO localities ( locality_id, name, geo_shape) VALUES ( $1, $2, $3);",
+			wantMobilityDB: "INSERT INTO localities ( locality_id, name, geo_shape) " +
+				"VALUES ( $1, $2, ST_Multi(ST_CollectionExtract(ST_MakeValid(ST_GeomFromGeoJSON($3)), 3)));",
+		},
+	}
+	defer SetIdempotentInserts(IdempotentInserts())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetIdempotentInserts(tt.idempotent)
+			if got := normalizeSQL(tt.sql(CrateDB)); got != tt.wantCrateDB {
+				t.Errorf("CrateDB:\n%s\nwant\n%s", got, tt.wantCrateDB)
+			}
+			if got := normalizeSQL(tt.sql(MobilityDB)); got != tt.wantMobilityDB {
+				t.Errorf("MobilityDB:\n%s\nwant\n%s", got, tt.wantMobilityDB)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package targets
+
+import (
+	"strings"
+
+	"load-generator/internal/workload"
+)
+
+// Values of the dataset are interpolated into the generated SQL as string literals.
+// CrateDB and MobilityDB both use standard conforming string literals, in which a backslash has no special meaning,
+// so doubling the single quotes is the complete escaping for both dialects. The syntax around the literals,
+// e.g. of arrays and geometries, differs and is built by Dialect.
+// Neither database stores NUL characters or invalid UTF-8 in text, they would fail the whole statement of a batch,
+// so NUL characters are removed and invalid UTF-8 is replaced by U+FFFD.
+
+// QuoteLiteral returns the value as SQL string literal of both targets
+func QuoteLiteral(s string) string {
+	return "'" + escapeString(s) + "'"
+}
+
+// escapeString escapes the value for the inside of a string literal
+func escapeString(s string) string {
+	s = strings.ToValidUTF8(s, "\uFFFD")
+	s = strings.ReplaceAll(s, "\x00", "")
+	return strings.ReplaceAll(s, "'", "''")
+}
+
+// EscapeQueryFields returns the fields with their strings escaped for the inside of the string literals of SQL query templates,
+// e.g. trip_id = '{{.TripID}}' or tstzspan '[{{.StartTime}}, {{.EndTime}}]'. Request templates of REST APIs get the fields as they are.
+func EscapeQueryFields(fields workload.QueryFields) workload.QueryFields {
+	fields.LocalityId = escapeString(fields.LocalityId)
+	fields.POIID = escapeString(fields.POIID)
+	fields.TripID = escapeString(fields.TripID)
+	fields.StartTime = escapeString(fields.StartTime)
+	fields.EndTime = escapeString(fields.EndTime)
+	fields.Timestamp = escapeString(fields.Timestamp)
+	fields.BucketInterval = escapeString(fields.BucketInterval)
+	fields.QueryPointWKT = escapeString(fields.QueryPointWKT)
+	fields.RouteWKT = escapeString(fields.RouteWKT)
+	fields.WindowStart = escapeString(fields.WindowStart)
+	fields.WindowEnd = escapeString(fields.WindowEnd)
+	return fields
+}
@@ -0,0 +1,154 @@
+package targets
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+
+	"load-generator/internal/workload"
+)
+
+// hostileValues try to break out of a string literal, the payload DROP TABLE must stay inside of one
+var hostileValues = []string{
+	`'); DROP TABLE escooter_events; --`,
+	`''); DROP TABLE escooter_events; --`,
+	`\'); DROP TABLE escooter_events; --`,
+	`O'Brien's Café`,
+	"nul\x00'); DROP TABLE escooter_events; --",
+	"invalid utf-8 \xff'); DROP TABLE escooter_events; --",
+	`/* '); DROP TABLE escooter_events; -- */`,
+	`$$'); DROP TABLE escooter_events; --$$`,
+}
+
+// literals splits the statement into the contents of its string literals, unescaped, and the SQL outside of them
+func literals(t *testing.T, sql string) (values []string, outside string) {
+	t.Helper()
+	var out, value strings.Builder
+	inLiteral := false
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case !inLiteral && c == '\'':
+			inLiteral = true
+			value.Reset()
+		case inLiteral && c == '\'' && i+1 < len(sql) && sql[i+1] == '\'':
+			value.WriteByte('\'')
+			i++
+		case inLiteral && c == '\'':
+			inLiteral = false
+			values = append(values, value.String())
+		case inLiteral:
+			value.WriteByte(c)
+		default:
+			out.WriteByte(c)
+		}
+	}
+	if inLiteral {
+		t.Fatalf("unterminated string literal in %s", sql)
+	}
+	return values, out.String()
+}
+
+func assertContained(t *testing.T, sql string) []string {
+	t.Helper()
+	values, outside := literals(t, sql)
+	if strings.Contains(outside, "DROP") {
+		t.Errorf("value broke out of its string literal:\n%s", sql)
+	}
+	if strings.ContainsRune(sql, 0) {
+		t.Errorf("statement contains a NUL character:\n%q", sql)
+	}
+	return values
+}
+
+func TestQuoteLiteral(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"", "''"},
+		{"abc", "'abc'"},
+		{"O'Brien", "'O''Brien'"},
+		{"''", "''''''"},
+		// backslashes have no special meaning in standard conforming strings
+		{`C:\path\`, `'C:\path\'`},
+		{"a\x00b", "'ab'"},
+		{"a\xffb", "'a\uFFFDb'"},
+	}
+	for _, tt := range tests {
+		if got := QuoteLiteral(tt.in); got != tt.want {
+			t.Errorf("QuoteLiteral(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	for _, v := range hostileValues {
+		values := assertContained(t, QuoteLiteral(v))
+		if len(values) != 1 {
+			t.Errorf("QuoteLiteral(%q) contains %d literals, want 1", v, len(values))
+		}
+	}
+}
+
+func hostileEvents() []workload.TripEvent {
+	events := make([]workload.TripEvent, len(hostileValues))
+	for i, v := range hostileValues {
+		events[i] = workload.TripEvent{
+			EventID:    v,
+			TripID:     v,
+			Timestamp:  v,
+			Latitude:   v,
+			Longitude:  v,
+			Attributes: []string{v},
+		}
+	}
+	return events
+}
+
+func TestInsertEventSQLEscapesValues(t *testing.T) {
+	SetEventAttributes([]workload.EventAttribute{{Column: "vehicle_type", Type: workload.AttributeText}})
+	t.Cleanup(func() { SetEventAttributes(nil) })
+
+	for _, target := range []DBTarget{CrateDB, MobilityDB} {
+		for _, event := range hostileEvents() {
+			values := assertContained(t, InsertEventSQL(target, event))
+			// the values arrive unchanged apart from the characters neither database can store
+			if !strings.Contains(event.EventID, "\x00") && !strings.Contains(event.EventID, "\xff") && values[0] != event.EventID {
+				t.Errorf("%s insert stores event_id %q, want %q", target, values[0], event.EventID)
+			}
+		}
+		assertContained(t, BulkInsertEventsSQL(target, hostileEvents()))
+	}
+}
+
+func TestInsertPOIsSQLEscapesValues(t *testing.T) {
+	pois := make([]workload.POI, len(hostileValues))
+	for i, v := range hostileValues {
+		pois[i] = workload.POI{POIID: v, Name: v, Category: v, Latitude: v, Longitude: v}
+	}
+	for _, target := range []DBTarget{CrateDB, MobilityDB} {
+		assertContained(t, InsertPOIsSQL(target, pois))
+	}
+}
+
+func TestEscapeQueryFields(t *testing.T) {
+	templates := template.Must(template.New("").Parse(`
+{{define "trip"}}SELECT * FROM escooter_events WHERE trip_id = '{{.TripID}}' AND poi_id = '{{.POIID}}' AND locality_id = '{{.LocalityId}}'{{end}}
+{{define "span"}}SELECT * FROM trips WHERE trip && tstzspan '[{{.StartTime}}, {{.EndTime}}]' AND '{{.Timestamp}}' < now(){{end}}`))
+
+	for _, v := range hostileValues {
+		fields := workload.QueryFields{LocalityId: v, POIID: v, TripID: v, StartTime: v, EndTime: v, Timestamp: v, Limit: 5}
+		for _, name := range []string{"trip", "span"} {
+			var query strings.Builder
+			if err := templates.ExecuteTemplate(&query, name, EscapeQueryFields(fields)); err != nil {
+				t.Fatal(err)
+			}
+			assertContained(t, query.String())
+		}
+	}
+
+	// values without quotes are rendered unchanged
+	fields := workload.QueryFields{TripID: "6178c823-1dab-4b82-8c97-8360b302244a", StartTime: "2024-06-01T21:40:19Z", Radius: 1500}
+	if escaped := EscapeQueryFields(fields); escaped != fields {
+		t.Errorf("EscapeQueryFields(%+v) = %+v", fields, escaped)
+	}
+}
@@ -0,0 +1,491 @@
+package targets
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"load-generator/internal/workload"
+)
+
+// ImportTripsSQL aggregates the inserted escooter events into one temporal point sequence per trip (MobilityDB only)
+const ImportTripsSQL = `
+INSERT INTO trips
+SELECT trip_id, tgeogpointseq(array_agg(tgeogpoint(geo_point, timestamp) ORDER BY timestamp)) AS trip
+FROM escooter_events
+GROUP BY trip_id
+ON CONFLICT (trip_id) DO UPDATE
+	SET trip = EXCLUDED.trip;`
+
+// ImportTenantTripsSQL is ImportTripsSQL for the tenants schema variant, keeping the tenant of the trips
+const ImportTenantTripsSQL = `
+INSERT INTO trips
+SELECT tenant_id, trip_id, tgeogpointseq(array_agg(tgeogpoint(geo_point, timestamp) ORDER BY timestamp)) AS trip
+FROM escooter_events
+GROUP BY tenant_id, trip_id
+ON CONFLICT (tenant_id, trip_id) DO UPDATE
+	SET trip = EXCLUDED.trip;`
+
+// schemaMigrationsSQL creates the table recording the applied migration files, valid for both targets
+const schemaMigrationsSQL = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+	filename   TEXT PRIMARY KEY,
+	checksum   TEXT,
+	applied_at TIMESTAMP WITH TIME ZONE
+)`
+
+// InitOptions configures Initialize
+type InitOptions struct {
+	MigrationsDir string
+	// subdirectory of MigrationsDir with an alternative migration set, e.g. partitioned, empty uses MigrationsDir itself
+	SchemaVariant string
+	// re-execute migrations which are already recorded as applied
+	ForceMigrations bool
+	Params          MigrationParams
+	// insert the localities with ST_MakeValid (MobilityDB only)
+	MakeValidGeometries bool
+	// handling of POIs, localities and context data already in the database
+	OnExisting OnExisting
+	// optional context tables, only loaded if not empty
+	NoParkingZones []workload.NoParkingZone
+	Weather        []workload.WeatherObservation
+	// fingerprints of the input files keyed by table, recorded in benchmark_meta for the tables data was inserted into
+	Fingerprints map[string]DatasetFingerprint
+}
+
+// OnExisting decides what init does with reference data already in the database,
+// which would otherwise fail with duplicate keys or be doubled
+type OnExisting string
+
+const (
+	OnExistingFail     OnExisting = "fail"     // abort the init
+	OnExistingSkip     OnExisting = "skip"     // keep the existing rows and don't insert the table's data
+	OnExistingTruncate OnExisting = "truncate" // delete the existing rows before inserting
+)
+
+// ParseOnExisting returns the handling for its CLI name
+func ParseOnExisting(name string) (OnExisting, error) {
+	switch onExisting := OnExisting(name); onExisting {
+	case OnExistingFail, OnExistingSkip, OnExistingTruncate:
+		return onExisting, nil
+	}
+	return "", fmt.Errorf("Unknown handling of existing data %q, expected fail, skip or truncate", name)
+}
+
+// MigrationParams are the parameters of migration files, which are Go templates,
+// e.g. CLUSTERED BY (trip_id) INTO {{.Shards | default 24}} SHARDS.
+// Zero values leave the choice to the default written in the migration file.
+type MigrationParams struct {
+	Shards        int
+	Replicas      string
+	ChunkInterval string
+}
+
+var migrationFuncs = template.FuncMap{
+	// default returns fallback if value is the zero value of its type
+	"default": func(fallback, value any) any {
+		if value == nil || reflect.ValueOf(value).IsZero() {
+			return fallback
+		}
+		return value
+	},
+}
+
+// ReadMigration reads the migration file and renders it with params
+func ReadMigration(filename string, params MigrationParams) (string, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return "", fmt.Errorf("Reading migration file: %w", err)
+	}
+	tmpl, err := template.New(filepath.Base(filename)).Funcs(migrationFuncs).Parse(string(b))
+	if err != nil {
+		return "", fmt.Errorf("Parsing migration file: %w", err)
+	}
+	var sql strings.Builder
+	if err := tmpl.Execute(&sql, params); err != nil {
+		return "", fmt.Errorf("Rendering migration file: %w", err)
+	}
+	return PrefixTables(sql.String()), nil
+}
+
+// Initialize runs the pending migrations of the migrations directory in lexical order and inserts the POIs and localities
+func Initialize(ctx context.Context, conn *pgx.Conn, target DBTarget, pois []workload.POI, localities []workload.Locality, opts InitOptions, logger *slog.Logger) error {
+	if err := RunMigrations(ctx, conn, target, opts, logger); err != nil {
+		return err
+	}
+
+	// both tables are checked before inserting, so a failing check leaves the database unchanged
+	insertPOIs, err := prepareReferenceTable(ctx, conn, target, "pois", opts.OnExisting, logger)
+	if err != nil {
+		return err
+	}
+	insertLocalities, err := prepareReferenceTable(ctx, conn, target, "localities", opts.OnExisting, logger)
+	if err != nil {
+		return err
+	}
+	insertZones, insertWeather := false, false
+	if len(opts.NoParkingZones) > 0 {
+		if insertZones, err = prepareReferenceTable(ctx, conn, target, "no_parking_zones", opts.OnExisting, logger); err != nil {
+			return err
+		}
+	}
+	if len(opts.Weather) > 0 {
+		if insertWeather, err = prepareReferenceTable(ctx, conn, target, "weather_observations", opts.OnExisting, logger); err != nil {
+			return err
+		}
+	}
+
+	if insertPOIs {
+		startTime := time.Now()
+		if _, err := conn.Exec(ctx, InsertPOIsSQL(target, pois)); err != nil {
+			return fmt.Errorf("Inserting POIs into %s: %w", target, err)
+		}
+		logger.Info("Inserted all POIs into database", "dbTarget", target.String(), "poiCount", len(pois), "timeElapsedInSec", time.Since(startTime).Seconds())
+	}
+
+	if insertLocalities {
+		if err := insertLocalitiesBatch(ctx, conn, target, localities, opts.MakeValidGeometries, logger); err != nil {
+			return err
+		}
+	}
+
+	if insertZones {
+		rows := make([][]any, len(opts.NoParkingZones))
+		for i, zone := range opts.NoParkingZones {
+			rows[i] = []any{zone.ZoneID, zone.Name, zone.Geometry}
+		}
+		if err := insertBatch(ctx, conn, "no_parking_zones", NoParkingZoneInsertSQL(target), rows, logger); err != nil {
+			return err
+		}
+	}
+	if insertWeather {
+		rows := make([][]any, len(opts.Weather))
+		for i, o := range opts.Weather {
+			rows[i] = []any{o.ObservedAt, o.TemperatureC, o.PrecipitationMm, o.WindSpeedMs}
+		}
+		if err := insertBatch(ctx, conn, "weather_observations", WeatherInsertSQL(), rows, logger); err != nil {
+			return err
+		}
+	}
+
+	var inserted []DatasetFingerprint
+	for table, insert := range map[string]bool{"pois": insertPOIs, "localities": insertLocalities, "no_parking_zones": insertZones, "weather_observations": insertWeather} {
+		if fp, ok := opts.Fingerprints[table]; ok && insert {
+			inserted = append(inserted, fp)
+		}
+	}
+	if len(inserted) == 0 {
+		return nil
+	}
+	return RecordDatasets(ctx, conn, target, inserted, logger)
+}
+
+// StatisticsTiming is the duration of a statement collecting optimizer statistics or making rows visible
+type StatisticsTiming struct {
+	Table       string  `json:"table,omitempty"` // empty for statements covering all tables
+	Statement   string  `json:"statement"`
+	DurationSec float64 `json:"durationSec"`
+}
+
+// CollectStatistics refreshes (CrateDB) or analyzes (MobilityDB) every table of the current schema and returns the durations,
+// so the query benchmark starts from a documented state with up to date optimizer statistics
+func CollectStatistics(ctx context.Context, conn *pgx.Conn, target DBTarget, logger *slog.Logger) ([]StatisticsTiming, error) {
+	tables, err := listTables(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	var timings []StatisticsTiming
+	exec := func(table, stmt string) error {
+		startTime := time.Now()
+		if _, err := conn.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("Executing %s: %w", stmt, err)
+		}
+		timing := StatisticsTiming{Table: table, Statement: stmt, DurationSec: time.Since(startTime).Seconds()}
+		timings = append(timings, timing)
+		logger.Info("Collected statistics", "table", table, "statement", stmt, "durationSec", timing.DurationSec)
+		return nil
+	}
+
+	for _, table := range tables {
+		stmt := "ANALYZE " + table
+		if target == CrateDB {
+			stmt = "REFRESH TABLE " + table
+		}
+		if err := exec(table, stmt); err != nil {
+			return timings, err
+		}
+	}
+	if target == CrateDB {
+		// CrateDB analyzes all tables at once
+		if err := exec("", "ANALYZE"); err != nil {
+			return timings, err
+		}
+	}
+	return timings, nil
+}
+
+// insertBatch executes the insert statement once per row in one batch
+func insertBatch(ctx context.Context, conn *pgx.Conn, table, sql string, rows [][]any, logger *slog.Logger) error {
+	startTime := time.Now()
+	pgxBatch := &pgx.Batch{}
+	for _, args := range rows {
+		pgxBatch.Queue(sql, args...)
+	}
+	batchResults := conn.SendBatch(ctx, pgxBatch)
+	defer batchResults.Close()
+	for i := range rows {
+		if _, err := batchResults.Exec(); err != nil {
+			return fmt.Errorf("Inserting row %d into %s: %w", i+1, table, err)
+		}
+	}
+	if err := batchResults.Close(); err != nil {
+		return fmt.Errorf("Inserting into %s: %w", table, err)
+	}
+	logger.Info("Inserted all rows into table", "table", table, "rowCount", len(rows), "timeElapsedInSec", time.Since(startTime).Seconds())
+	return nil
+}
+
+// prepareReferenceTable applies onExisting to the rows already in the table and returns whether its data is inserted
+func prepareReferenceTable(ctx context.Context, conn *pgx.Conn, target DBTarget, table string, onExisting OnExisting, logger *slog.Logger) (bool, error) {
+	table = Table(table)
+	if target == CrateDB {
+		// rows inserted by a previous init are only counted after a refresh
+		if _, err := conn.Exec(ctx, "REFRESH TABLE "+table); err != nil {
+			return false, fmt.Errorf("Refreshing %s: %w", table, err)
+		}
+	}
+	var count int64
+	if err := conn.QueryRow(ctx, "SELECT count(*) FROM "+table).Scan(&count); err != nil {
+		return false, fmt.Errorf("Counting existing rows of %s: %w", table, err)
+	}
+	if count == 0 {
+		return true, nil
+	}
+
+	switch onExisting {
+	case OnExistingSkip:
+		logger.Info("Skipping insert into table with existing rows", "table", table, "rows", count)
+		return false, nil
+	case OnExistingTruncate:
+		// CrateDB has no TRUNCATE
+		truncateSQL := "TRUNCATE " + table
+		if target == CrateDB {
+			truncateSQL = "DELETE FROM " + table
+		}
+		if _, err := conn.Exec(ctx, truncateSQL); err != nil {
+			return false, fmt.Errorf("Truncating %s: %w", table, err)
+		}
+		logger.Info("Truncated table with existing rows", "table", table, "rows", count)
+		return true, nil
+	default:
+		return false, fmt.Errorf("Table %s already contains %d rows, use -on-existing skip or truncate to re-run init", table, count)
+	}
+}
+
+func insertLocalitiesBatch(ctx context.Context, conn *pgx.Conn, target DBTarget, localities []workload.Locality, makeValid bool, logger *slog.Logger) error {
+	startTime := time.Now()
+	pgxBatch := &pgx.Batch{}
+	for _, locality := range localities {
+		pgxBatch.Queue(LocalityInsertSQL(target, makeValid), locality.LocalityID, locality.Name, locality.Geometry)
+	}
+	batchResults := conn.SendBatch(ctx, pgxBatch)
+	defer batchResults.Close()
+	for _, locality := range localities {
+		if _, err := batchResults.Exec(); err != nil {
+			return fmt.Errorf("Inserting locality %s: %w", locality.String(), err)
+		}
+	}
+	if err := batchResults.Close(); err != nil {
+		return fmt.Errorf("Inserting localities: %w", err)
+	}
+	logger.Info("Inserted all localities into database", "dbTarget", target.String(), "localityCount", len(localities), "timeElapsedInSec", time.Since(startTime).Seconds())
+	return nil
+}
+
+// suffix of the files reverting the migration of the same name, e.g. 001_create_tables.down.sql
+const downMigrationSuffix = ".down.sql"
+
+// MigrationFiles returns the .sql files of the schema variant in the order they are executed, down migrations are left out.
+// A variant only contains the migrations differing from the base migrations in migrationsDir,
+// the files it doesn't override by name are read from migrationsDir.
+func MigrationFiles(migrationsDir, schemaVariant string) ([]string, error) {
+	if schemaVariant != "" {
+		if _, err := os.Stat(VariantDir(migrationsDir, schemaVariant)); err != nil {
+			return nil, fmt.Errorf("Reading migrations of schema variant %s: %w", schemaVariant, err)
+		}
+	}
+	byName := make(map[string]string)
+	for _, dir := range []string{migrationsDir, VariantDir(migrationsDir, schemaVariant)} {
+		files, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+		if err != nil {
+			return nil, fmt.Errorf("Reading migration files: %w", err)
+		}
+		for _, file := range files {
+			if !strings.HasSuffix(file, downMigrationSuffix) {
+				byName[filepath.Base(file)] = file
+			}
+		}
+	}
+	migrationFiles := make([]string, 0, len(byName))
+	for _, name := range slices.Sorted(maps.Keys(byName)) {
+		migrationFiles = append(migrationFiles, byName[name])
+	}
+	return migrationFiles, nil
+}
+
+// DownMigrationFiles returns the existing down migrations of the schema variant in the order they are executed,
+// which is the reverse order of the migrations they revert. Like the migrations they fall back to the ones of migrationsDir.
+func DownMigrationFiles(migrationsDir, schemaVariant string) ([]string, error) {
+	migrationFiles, err := MigrationFiles(migrationsDir, schemaVariant)
+	if err != nil {
+		return nil, err
+	}
+	var downFiles []string
+	for i := len(migrationFiles) - 1; i >= 0; i-- {
+		name := strings.TrimSuffix(filepath.Base(migrationFiles[i]), ".sql") + downMigrationSuffix
+		for _, dir := range []string{VariantDir(migrationsDir, schemaVariant), migrationsDir} {
+			if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+				downFiles = append(downFiles, filepath.Join(dir, name))
+				break
+			}
+		}
+	}
+	return downFiles, nil
+}
+
+// Cleanup executes the down migrations of the schema variant and drops schema_migrations,
+// so the next init starts from an empty database
+func Cleanup(ctx context.Context, conn *pgx.Conn, migrationsDir, schemaVariant string, logger *slog.Logger) error {
+	downFiles, err := DownMigrationFiles(migrationsDir, schemaVariant)
+	if err != nil {
+		return err
+	}
+	if len(downFiles) == 0 {
+		return fmt.Errorf("No down migrations (*%s) found in %s", downMigrationSuffix, VariantDir(migrationsDir, schemaVariant))
+	}
+
+	for _, downFile := range downFiles {
+		logger.Info("Running down migration", "file", downFile)
+		downSQL, err := ReadMigration(downFile, MigrationParams{})
+		if err != nil {
+			return err
+		}
+		for i, stmt := range SplitStatements(downSQL) {
+			if _, err := conn.Exec(ctx, stmt); err != nil {
+				return fmt.Errorf("Executing statement %d of %s: %w", i, downFile, err)
+			}
+		}
+	}
+
+	if _, err := conn.Exec(ctx, "DROP TABLE IF EXISTS "+Table("schema_migrations")); err != nil {
+		return fmt.Errorf("Dropping schema_migrations: %w", err)
+	}
+	return nil
+}
+
+// VariantDir returns the directory of the migrations of the schema variant
+func VariantDir(migrationsDir, schemaVariant string) string {
+	return filepath.Join(migrationsDir, schemaVariant)
+}
+
+// RunMigrations executes the statements of the .sql files of the schema variant sorted by name.
+// Applied files are recorded with their variant and checksum in schema_migrations and skipped on later runs
+// unless ForceMigrations is set. A recorded file whose rendered content changed is an error, as the schema no longer matches the file.
+func RunMigrations(ctx context.Context, conn *pgx.Conn, target DBTarget, opts InitOptions, logger *slog.Logger) error {
+	migrationFiles, err := MigrationFiles(opts.MigrationsDir, opts.SchemaVariant)
+	if err != nil {
+		return err
+	}
+
+	applied, err := appliedMigrations(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	for _, migrationFile := range migrationFiles {
+		migrationSQL, err := ReadMigration(migrationFile, opts.Params)
+		if err != nil {
+			return err
+		}
+		checksum := fmt.Sprintf("%x", sha256.Sum256([]byte(migrationSQL)))
+		filename := filepath.Join(opts.SchemaVariant, filepath.Base(migrationFile))
+
+		if appliedChecksum, ok := applied[filename]; ok && !opts.ForceMigrations {
+			if appliedChecksum != checksum {
+				return fmt.Errorf("Migration %s was modified or rendered with other parameters after it was applied, use -force-migrations to re-execute it", migrationFile)
+			}
+			logger.Info("Skipping applied migration", "file", migrationFile)
+			continue
+		}
+
+		logger.Info("Running migration", "file", migrationFile)
+		for i, stmt := range SplitStatements(migrationSQL) {
+			if _, err := conn.Exec(ctx, stmt); err != nil {
+				return fmt.Errorf("Executing statement %d of %s: %w", i, migrationFile, err)
+			}
+		}
+
+		_, err = conn.Exec(ctx, PrefixTables(`
+			INSERT INTO schema_migrations (filename, checksum, applied_at) VALUES ($1, $2, $3)
+			ON CONFLICT (filename) DO UPDATE SET checksum = excluded.checksum, applied_at = excluded.applied_at`),
+			filename, checksum, time.Now())
+		if err != nil {
+			return fmt.Errorf("Recording migration %s: %w", migrationFile, err)
+		}
+		logger.Info("Migration completed successfully", "file", migrationFile)
+	}
+
+	if target == CrateDB {
+		// make the recorded migrations visible to the next init
+		if _, err := conn.Exec(ctx, "REFRESH TABLE "+Table("schema_migrations")); err != nil {
+			return fmt.Errorf("Refreshing schema_migrations: %w", err)
+		}
+	}
+	return nil
+}
+
+// appliedMigrations returns the checksums of the applied migrations by file name
+func appliedMigrations(ctx context.Context, conn *pgx.Conn) (map[string]string, error) {
+	if _, err := conn.Exec(ctx, PrefixTables(schemaMigrationsSQL)); err != nil {
+		return nil, fmt.Errorf("Creating schema_migrations table: %w", err)
+	}
+	rows, err := conn.Query(ctx, "SELECT filename, checksum FROM "+Table("schema_migrations"))
+	if err != nil {
+		return nil, fmt.Errorf("Reading applied migrations: %w", err)
+	}
+	applied := make(map[string]string)
+	for rows.Next() {
+		var filename, checksum string
+		if err := rows.Scan(&filename, &checksum); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("Reading applied migrations: %w", err)
+		}
+		applied[filename] = checksum
+	}
+	return applied, rows.Err()
+}
+
+// SplitStatements splits a migration by semicolons and drops empty statements
+func SplitStatements(sql string) []string {
+	var statements []string
+	for _, stmt := range strings.Split(sql, ";") {
+		stmt = strings.TrimSpace(stmt)
+		if stmt == "" {
+			continue // Skip empty statements
+		}
+		statements = append(statements, stmt)
+	}
+	return statements
+}
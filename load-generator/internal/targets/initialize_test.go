@@ -0,0 +1,80 @@
+package targets
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeMigrations creates the files in dir, relative to it
+func writeMigrations(t *testing.T, dir string, files ...string) {
+	t.Helper()
+	for _, file := range files {
+		filename := filepath.Join(dir, file)
+		if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte("SELECT 1;"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMigrationFilesOfVariant(t *testing.T) {
+	dir := t.TempDir()
+	writeMigrations(t, dir,
+		"001_create_tables.sql", "001_create_tables.down.sql",
+		"002_create_context_tables.sql", "002_create_context_tables.down.sql",
+		"partitioned/001_create_tables.sql",
+		"wide/001_create_tables.sql", "wide/001_create_tables.down.sql", "wide/004_add_columns.sql",
+	)
+	tests := []struct {
+		variant   string
+		want      []string
+		wantDown  []string
+		wantError string
+	}{
+		{
+			variant:  "",
+			want:     []string{"001_create_tables.sql", "002_create_context_tables.sql"},
+			wantDown: []string{"002_create_context_tables.down.sql", "001_create_tables.down.sql"},
+		},
+		{
+			variant:  "partitioned",
+			want:     []string{"partitioned/001_create_tables.sql", "002_create_context_tables.sql"},
+			wantDown: []string{"002_create_context_tables.down.sql", "001_create_tables.down.sql"},
+		},
+		{
+			variant:  "wide",
+			want:     []string{"wide/001_create_tables.sql", "002_create_context_tables.sql", "wide/004_add_columns.sql"},
+			wantDown: []string{"002_create_context_tables.down.sql", "wide/001_create_tables.down.sql"},
+		},
+		{variant: "partitoned", wantError: "schema variant partitoned"},
+	}
+	relative := func(files []string) []string {
+		for i, file := range files {
+			files[i], _ = filepath.Rel(dir, file)
+		}
+		return files
+	}
+	for _, tt := range tests {
+		t.Run(tt.variant, func(t *testing.T) {
+			files, err := MigrationFiles(dir, tt.variant)
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Errorf("MigrationFiles error = %v, want one containing %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(relative(files), tt.want) {
+				t.Errorf("MigrationFiles = %v, %v, want %v", files, err, tt.want)
+			}
+			downFiles, err := DownMigrationFiles(dir, tt.variant)
+			if err != nil || !reflect.DeepEqual(relative(downFiles), tt.wantDown) {
+				t.Errorf("DownMigrationFiles = %v, %v, want %v", downFiles, err, tt.wantDown)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package targets
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DatasetFingerprint identifies the data loaded into a table, recorded in benchmark_meta
+type DatasetFingerprint struct {
+	Dataset  string `json:"dataset"` // table the data was loaded into, without the table prefix
+	RunID    string `json:"runId"`
+	Mode     string `json:"mode"`
+	Filename string `json:"filename"`
+	SHA256   string `json:"sha256"`
+	RowCount int64  `json:"rowCount"`
+}
+
+// RecordDatasets writes the fingerprints into benchmark_meta, replacing the ones of the same dataset and run
+func RecordDatasets(ctx context.Context, conn *pgx.Conn, target DBTarget, fingerprints []DatasetFingerprint, logger *slog.Logger) error {
+	table := Table("benchmark_meta")
+	pgxBatch := &pgx.Batch{}
+	for _, fp := range fingerprints {
+		pgxBatch.Queue(fmt.Sprintf(`
+			INSERT INTO %s (dataset, run_id, mode, filename, sha256, row_count, recorded_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT (dataset, run_id) DO UPDATE
+				SET mode = excluded.mode, filename = excluded.filename, sha256 = excluded.sha256,
+					row_count = excluded.row_count, recorded_at = excluded.recorded_at`, table),
+			fp.Dataset, fp.RunID, fp.Mode, fp.Filename, fp.SHA256, fp.RowCount, time.Now())
+	}
+	if err := conn.SendBatch(ctx, pgxBatch).Close(); err != nil {
+		return fmt.Errorf("Recording datasets in %s: %w", table, err)
+	}
+	// make the rows visible to the next run right away
+	if target == CrateDB {
+		if _, err := conn.Exec(ctx, "REFRESH TABLE "+table); err != nil {
+			return fmt.Errorf("Refreshing %s: %w", table, err)
+		}
+	}
+	for _, fp := range fingerprints {
+		logger.Info("Recorded dataset", "dataset", fp.Dataset, "filename", fp.Filename, "sha256", fp.SHA256, "rowCount", fp.RowCount)
+	}
+	return nil
+}
+
+// LatestDatasets returns the most recently recorded fingerprint of every dataset
+func LatestDatasets(ctx context.Context, conn *pgx.Conn) (map[string]DatasetFingerprint, error) {
+	rows, err := conn.Query(ctx, fmt.Sprintf(`
+		SELECT dataset, run_id, mode, filename, sha256, row_count
+		FROM %s
+		ORDER BY recorded_at`, Table("benchmark_meta")))
+	if err != nil {
+		return nil, fmt.Errorf("Reading %s: %w", Table("benchmark_meta"), err)
+	}
+	fingerprints, err := pgx.CollectRows(rows, pgx.RowToStructByPos[DatasetFingerprint])
+	if err != nil {
+		return nil, fmt.Errorf("Reading %s: %w", Table("benchmark_meta"), err)
+	}
+	latest := make(map[string]DatasetFingerprint)
+	for _, fp := range fingerprints {
+		latest[fp.Dataset] = fp
+	}
+	return latest, nil
+}
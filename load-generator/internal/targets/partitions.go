@@ -0,0 +1,140 @@
+package targets
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// sentinel row inserted into every partition to make CrateDB create it, deleted right away
+const partitionSentinelID = "partition-sentinel"
+
+// PartitionStarts returns the start of every partition of the interval covering start to end.
+// interval is a date_trunc unit with an optional leading 1, e.g. month or "1 week", the same unit as -chunk-interval.
+func PartitionStarts(interval string, start, end time.Time) ([]time.Time, error) {
+	unit := strings.TrimPrefix(strings.TrimSpace(interval), "1 ")
+	unit = strings.TrimSuffix(unit, "s")
+	start, end = start.UTC(), end.UTC()
+
+	var truncate func(time.Time) time.Time
+	var next func(time.Time) time.Time
+	switch unit {
+	case "hour":
+		truncate = func(t time.Time) time.Time { return t.Truncate(time.Hour) }
+		next = func(t time.Time) time.Time { return t.Add(time.Hour) }
+	case "day":
+		truncate = func(t time.Time) time.Time { return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC) }
+		next = func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+	case "week":
+		// weeks start on Monday like date_trunc('week', ...)
+		truncate = func(t time.Time) time.Time {
+			daysSinceMonday := (int(t.Weekday()) + 6) % 7
+			return time.Date(t.Year(), t.Month(), t.Day()-daysSinceMonday, 0, 0, 0, 0, time.UTC)
+		}
+		next = func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }
+	case "month":
+		truncate = func(t time.Time) time.Time { return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC) }
+		next = func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }
+	case "quarter":
+		truncate = func(t time.Time) time.Time {
+			return time.Date(t.Year(), t.Month()-(t.Month()-1)%3, 1, 0, 0, 0, 0, time.UTC)
+		}
+		next = func(t time.Time) time.Time { return t.AddDate(0, 3, 0) }
+	case "year":
+		truncate = func(t time.Time) time.Time { return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, time.UTC) }
+		next = func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }
+	default:
+		return nil, fmt.Errorf("Unsupported partition interval %q, expected hour, day, week, month, quarter or year", interval)
+	}
+
+	var starts []time.Time
+	for t := truncate(start); !t.After(end); t = next(t) {
+		starts = append(starts, t)
+	}
+	return starts, nil
+}
+
+// PrecreatePartitions creates the partitions of the partitioned events table covering start to end,
+// so creating them is not part of the ingest measurement. Returns the number of created partitions.
+// CrateDB creates a partition on the first insert into it, so a sentinel row is inserted into each and deleted again.
+// MobilityDB uses create_time_partitions of Citus.
+func PrecreatePartitions(ctx context.Context, conn *pgx.Conn, target DBTarget, interval string, start, end time.Time, logger *slog.Logger) (int, error) {
+	table := Table("escooter_events")
+	if target == MobilityDB {
+		return precreateMobilitydbPartitions(ctx, conn, table, interval, start, end)
+	}
+
+	var partitionedBy []string
+	err := conn.QueryRow(ctx, `
+		SELECT partitioned_by FROM information_schema.tables
+		WHERE table_schema = CURRENT_SCHEMA AND table_name = $1`, table).Scan(&partitionedBy)
+	if err != nil {
+		return 0, fmt.Errorf("Reading partitioning of %s: %w", table, err)
+	}
+	if len(partitionedBy) == 0 {
+		return 0, fmt.Errorf("Table %s is not partitioned, use a partitioned -schema-variant", table)
+	}
+
+	starts, err := PartitionStarts(interval, start, end)
+	if err != nil {
+		return 0, err
+	}
+	pgxBatch := &pgx.Batch{}
+	for i, partitionStart := range starts {
+		pgxBatch.Queue(fmt.Sprintf("INSERT INTO %s (event_id, trip_id, timestamp, geo_point) VALUES ($1, $2, $3, [0, 0])", table),
+			fmt.Sprintf("%s-%d", partitionSentinelID, i), partitionSentinelID, partitionStart)
+	}
+	if err := conn.SendBatch(ctx, pgxBatch).Close(); err != nil {
+		return 0, fmt.Errorf("Inserting partition sentinels: %w", err)
+	}
+	// deleting by a non-partition column keeps the emptied partitions
+	for _, stmt := range []string{
+		"REFRESH TABLE " + table,
+		fmt.Sprintf("DELETE FROM %s WHERE trip_id = '%s'", table, partitionSentinelID),
+		"REFRESH TABLE " + table,
+	} {
+		if _, err := conn.Exec(ctx, stmt); err != nil {
+			return 0, fmt.Errorf("Removing partition sentinels: %w", err)
+		}
+	}
+	logger.Info("Pre-created partitions", "table", table, "interval", interval, "partitions", len(starts), "from", starts[0], "to", end)
+	return len(starts), nil
+}
+
+func precreateMobilitydbPartitions(ctx context.Context, conn *pgx.Conn, table, interval string, start, end time.Time) (int, error) {
+	var partitioned bool
+	if err := conn.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM pg_partitioned_table WHERE partrelid = $1::regclass)", table).Scan(&partitioned); err != nil {
+		return 0, fmt.Errorf("Reading partitioning of %s: %w", table, err)
+	}
+	if !partitioned {
+		return 0, fmt.Errorf("Table %s is not partitioned, use a partitioned -schema-variant", table)
+	}
+
+	countPartitions := func() (int, error) {
+		var count int
+		err := conn.QueryRow(ctx, "SELECT count(*) FROM pg_inherits WHERE inhparent = $1::regclass", table).Scan(&count)
+		return count, err
+	}
+	before, err := countPartitions()
+	if err != nil {
+		return 0, fmt.Errorf("Counting partitions of %s: %w", table, err)
+	}
+	// a bare unit like month is no valid interval
+	if !strings.ContainsAny(interval[:1], "0123456789") {
+		interval = "1 " + interval
+	}
+	_, err = conn.Exec(ctx, "SELECT create_time_partitions(table_name := $1::regclass, partition_interval := $2::interval, end_at := $3, start_from := $4)",
+		table, interval, end, start)
+	if err != nil {
+		return 0, fmt.Errorf("Creating time partitions of %s: %w", table, err)
+	}
+	after, err := countPartitions()
+	if err != nil {
+		return 0, fmt.Errorf("Counting partitions of %s: %w", table, err)
+	}
+	return after - before, nil
+}
@@ -0,0 +1,109 @@
+package targets
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// CountTripEvents returns the number of stored events of every trip in the events table of the tenant,
+// CrateDB's table is refreshed first so all inserted events are counted
+func CountTripEvents(ctx context.Context, conn *pgx.Conn, target DBTarget, tenant int) (map[string]int64, error) {
+	if err := RefreshEvents(ctx, conn, target, tenant); err != nil {
+		return nil, err
+	}
+	table := eventsTable(target, tenant)
+	rows, err := conn.Query(ctx, fmt.Sprintf("SELECT %s, count(*) FROM %s GROUP BY trip_id", target.Dialect().Text("trip_id"), table))
+	if err != nil {
+		return nil, fmt.Errorf("Counting the events per trip of %s: %w", table, err)
+	}
+	defer rows.Close()
+	counts := make(map[string]int64)
+	var id string
+	var count int64
+	_, err = pgx.ForEachRow(rows, []any{&id, &count}, func() error {
+		counts[id] = count
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Counting the events per trip of %s: %w", table, err)
+	}
+	return counts, nil
+}
+
+// StoredEventIDs returns the ones of the event IDs stored in the events table of the tenant,
+// the caller has to refresh CrateDB's table beforehand, e.g. with RefreshEvents
+func StoredEventIDs(ctx context.Context, conn *pgx.Conn, target DBTarget, tenant int, eventIDs []string) (map[string]bool, error) {
+	table := eventsTable(target, tenant)
+	d := target.Dialect()
+	rows, err := conn.Query(ctx, fmt.Sprintf("SELECT %s FROM %s WHERE event_id = ANY(%s)", d.Text("event_id"), table, d.TypedPlaceholder(1, uuidType+"[]")), eventIDs)
+	if err != nil {
+		return nil, fmt.Errorf("Looking up event IDs in %s: %w", table, err)
+	}
+	defer rows.Close()
+	stored := make(map[string]bool, len(eventIDs))
+	var id string
+	_, err = pgx.ForEachRow(rows, []any{&id}, func() error {
+		stored[id] = true
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Looking up event IDs in %s: %w", table, err)
+	}
+	return stored, nil
+}
+
+// RefreshEvents makes all inserted events of the tenant visible to queries, a no-op on MobilityDB
+func RefreshEvents(ctx context.Context, conn *pgx.Conn, target DBTarget, tenant int) error {
+	if target != CrateDB {
+		return nil
+	}
+	table := eventsTable(target, tenant)
+	if _, err := conn.Exec(ctx, "REFRESH TABLE "+table); err != nil {
+		return fmt.Errorf("Refreshing %s: %w", table, err)
+	}
+	return nil
+}
+
+// CountDuplicateEvents returns the number of event IDs stored more than once in the events table of the tenant
+// and the number of rows beyond the first of each, CrateDB's table is refreshed first
+func CountDuplicateEvents(ctx context.Context, conn *pgx.Conn, target DBTarget, tenant int) (eventIDs, surplusRows int64, err error) {
+	if err := RefreshEvents(ctx, conn, target, tenant); err != nil {
+		return 0, 0, err
+	}
+	table := eventsTable(target, tenant)
+	err = conn.QueryRow(ctx, fmt.Sprintf(`SELECT count(*), coalesce(sum(copies - 1), 0)
+FROM (SELECT event_id, count(*) AS copies FROM %s GROUP BY event_id HAVING count(*) > 1) duplicates`, table)).Scan(&eventIDs, &surplusRows)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Counting the duplicate events of %s: %w", table, err)
+	}
+	return eventIDs, surplusRows, nil
+}
+
+// TripRows are the rows of a trip in the trips table and the instants of their temporal points
+type TripRows struct {
+	Rows     int64
+	Instants int64
+}
+
+// CountTripRows returns the rows and instants of every trip in the trips table, which MobilityDB aggregates from the events after the inserts
+func CountTripRows(ctx context.Context, conn *pgx.Conn) (map[string]TripRows, error) {
+	table := Table("trips")
+	rows, err := conn.Query(ctx, fmt.Sprintf("SELECT trip_id::text, count(*), coalesce(sum(numInstants(trip)), 0) FROM %s GROUP BY trip_id", table))
+	if err != nil {
+		return nil, fmt.Errorf("Counting the rows per trip of %s: %w", table, err)
+	}
+	defer rows.Close()
+	counts := make(map[string]TripRows)
+	var id string
+	var trip TripRows
+	_, err = pgx.ForEachRow(rows, []any{&id, &trip.Rows, &trip.Instants}, func() error {
+		counts[id] = trip
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Counting the rows per trip of %s: %w", table, err)
+	}
+	return counts, nil
+}
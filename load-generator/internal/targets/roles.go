@@ -0,0 +1,95 @@
+package targets
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// listTables returns the benchmark tables of this run existing in the current schema
+func listTables(ctx context.Context, conn *pgx.Conn) ([]string, error) {
+	rows, err := conn.Query(ctx, `
+		SELECT table_name FROM information_schema.tables
+		WHERE table_schema = CURRENT_SCHEMA AND table_type = 'BASE TABLE'
+		ORDER BY table_name`)
+	if err != nil {
+		return nil, fmt.Errorf("Listing tables: %w", err)
+	}
+	allTables, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("Listing tables: %w", err)
+	}
+	var tables []string
+	for _, table := range allTables {
+		if isBenchmarkTable(table) {
+			tables = append(tables, table)
+		}
+	}
+	return tables, nil
+}
+
+// SetupWorkloadRole creates the login role the insert and query workers connect as, if it doesn't exist yet,
+// and grants it reading and writing rows of the benchmark tables only, so templates can't alter or drop any table.
+// An empty password creates the role without one. Returns the granted tables.
+func SetupWorkloadRole(ctx context.Context, conn *pgx.Conn, target DBTarget, role, password string, logger *slog.Logger) ([]string, error) {
+	existsSQL := "SELECT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = $1)"
+	if target == CrateDB {
+		existsSQL = "SELECT EXISTS (SELECT 1 FROM sys.users WHERE name = $1)"
+	}
+	var exists bool
+	if err := conn.QueryRow(ctx, existsSQL, role).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("Looking up role %s: %w", role, err)
+	}
+
+	d := target.Dialect()
+	identifier := d.QuoteIdent(role)
+	var stmts []string
+	if !exists {
+		switch {
+		case target == CrateDB && password != "":
+			stmts = append(stmts, fmt.Sprintf("CREATE USER %s WITH (password = %s)", identifier, QuoteLiteral(password)))
+		case target == CrateDB:
+			stmts = append(stmts, "CREATE USER "+identifier)
+		case password != "":
+			stmts = append(stmts, fmt.Sprintf("CREATE ROLE %s LOGIN PASSWORD %s", identifier, QuoteLiteral(password)))
+		default:
+			stmts = append(stmts, fmt.Sprintf("CREATE ROLE %s LOGIN", identifier))
+		}
+	}
+
+	tables, err := listTables(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	var granted []string
+	if target == MobilityDB {
+		var schema string
+		if err := conn.QueryRow(ctx, "SELECT CURRENT_SCHEMA").Scan(&schema); err != nil {
+			return nil, fmt.Errorf("Reading current schema: %w", err)
+		}
+		stmts = append(stmts, fmt.Sprintf("GRANT USAGE ON SCHEMA %s TO %s", d.QuoteIdent(schema), identifier))
+	}
+	for _, table := range tables {
+		// the migrations are bookkeeping of init, the workload has no business with them
+		if table == Table("schema_migrations") {
+			continue
+		}
+		if target == CrateDB {
+			stmts = append(stmts, fmt.Sprintf("GRANT DQL, DML ON TABLE %s TO %s", d.QuoteIdent(table), identifier))
+		} else {
+			stmts = append(stmts, fmt.Sprintf("GRANT SELECT, INSERT, UPDATE, DELETE ON TABLE %s TO %s", d.QuoteIdent(table), identifier))
+		}
+		granted = append(granted, table)
+	}
+
+	for _, stmt := range stmts {
+		if _, err := conn.Exec(ctx, stmt); err != nil {
+			// the statement isn't logged, as it may contain the password
+			return nil, fmt.Errorf("Setting up role %s: %w", role, err)
+		}
+	}
+	logger.Info("Set up workload role", "role", role, "created", !exists, "tables", granted)
+	return granted, nil
+}
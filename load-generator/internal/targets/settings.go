@@ -0,0 +1,85 @@
+package targets
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// CrateSettings are table settings of the CrateDB events table. Set by init, empty values keep the settings of the migration.
+type CrateSettings struct {
+	ColumnPolicy       string `json:"columnPolicy,omitempty"`       // strict or dynamic
+	RefreshInterval    string `json:"refreshInterval,omitempty"`    // duration, e.g. 1s, 0 disables the periodic refresh
+	TranslogDurability string `json:"translogDurability,omitempty"` // request or async
+}
+
+func (s CrateSettings) IsZero() bool {
+	return s == CrateSettings{}
+}
+
+// assignments returns the SET assignments of ALTER TABLE, an error for invalid values
+func (s CrateSettings) assignments() ([]string, error) {
+	var assignments []string
+	switch s.ColumnPolicy {
+	case "":
+	case "strict", "dynamic":
+		assignments = append(assignments, fmt.Sprintf(`"column_policy" = '%s'`, s.ColumnPolicy))
+	default:
+		return nil, fmt.Errorf("Invalid column policy %q, expected strict or dynamic", s.ColumnPolicy)
+	}
+	if s.RefreshInterval != "" {
+		interval, err := time.ParseDuration(s.RefreshInterval)
+		if err != nil || interval < 0 {
+			return nil, fmt.Errorf("Invalid refresh interval %q, expected a duration like 1s, 0 disables it", s.RefreshInterval)
+		}
+		assignments = append(assignments, fmt.Sprintf(`"refresh_interval" = %d`, interval.Milliseconds()))
+	}
+	switch s.TranslogDurability {
+	case "":
+	case "request", "async":
+		assignments = append(assignments, fmt.Sprintf(`"translog.durability" = '%s'`, s.TranslogDurability))
+	default:
+		return nil, fmt.Errorf("Invalid translog durability %q, expected request or async", s.TranslogDurability)
+	}
+	return assignments, nil
+}
+
+// Validate checks the values of the settings
+func (s CrateSettings) Validate() error {
+	_, err := s.assignments()
+	return err
+}
+
+// ApplyCrateSettings alters the settings of the events table, including all its partitions
+func ApplyCrateSettings(ctx context.Context, conn *pgx.Conn, settings CrateSettings, logger *slog.Logger) error {
+	assignments, err := settings.assignments()
+	if err != nil || len(assignments) == 0 {
+		return err
+	}
+	stmt := fmt.Sprintf("ALTER TABLE %s SET (%s)", Table("escooter_events"), strings.Join(assignments, ", "))
+	if _, err := conn.Exec(ctx, stmt); err != nil {
+		return fmt.Errorf("Executing %s: %w", stmt, err)
+	}
+	logger.Info("Applied table settings", "table", Table("escooter_events"), "statement", stmt)
+	return nil
+}
+
+// ReadCrateSettings returns the current settings of the events table, so runs record the settings they ran with
+func ReadCrateSettings(ctx context.Context, conn *pgx.Conn) (CrateSettings, error) {
+	var settings CrateSettings
+	var refreshIntervalMs int64
+	err := conn.QueryRow(ctx, `
+		SELECT column_policy, settings['refresh_interval'], settings['translog']['durability']
+		FROM information_schema.tables
+		WHERE table_schema = CURRENT_SCHEMA AND table_name = $1`, Table("escooter_events")).
+		Scan(&settings.ColumnPolicy, &refreshIntervalMs, &settings.TranslogDurability)
+	if err != nil {
+		return settings, fmt.Errorf("Reading settings of %s: %w", Table("escooter_events"), err)
+	}
+	settings.RefreshInterval = (time.Duration(refreshIntervalMs) * time.Millisecond).String()
+	return settings, nil
+}
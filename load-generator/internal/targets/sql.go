@@ -0,0 +1,151 @@
+package targets
+
+import (
+	"fmt"
+
+	"load-generator/internal/workload"
+)
+
+// idempotentInserts makes the statements inserting trip events skip events already stored
+var idempotentInserts bool
+
+// SetIdempotentInserts adds ON CONFLICT DO NOTHING to the statements inserting trip events,
+// so retried batches and replayed runs don't fail on or duplicate stored events
+func SetIdempotentInserts(idempotent bool) {
+	idempotentInserts = idempotent
+}
+
+// IdempotentInserts reports whether the statements inserting trip events skip stored events
+func IdempotentInserts() bool {
+	return idempotentInserts
+}
+
+// onConflict returns the conflict clause of the event inserts, prefixed with a newline.
+// An event conflicts only if its whole primary key matches a stored one, (trip_id, timestamp, event_id) on CrateDB
+// and (event_id, trip_id) on MobilityDB, extended by the partition or tenant column in those schema variants.
+// A replayed event has the same key, an event reusing only the event_id of another is inserted.
+func onConflict() string {
+	if !idempotentInserts {
+		return ""
+	}
+	return "\nON CONFLICT DO NOTHING"
+}
+
+// InsertEventSQL returns the statement inserting a single trip event
+func InsertEventSQL(target DBTarget, tEvent workload.TripEvent) string {
+	d := target.Dialect()
+	return fmt.Sprintf(`
+INSERT INTO %s (
+	event_id, trip_id, timestamp, geo_point%s%s
+)
+VALUES (
+	%s, %s, %s, %s%s%s
+)%s;`, eventsTable(target, tEvent.Tenant), attributeColumns(", "), tenantColumn(target, tEvent.Tenant, ", "),
+		QuoteLiteral(tEvent.EventID), QuoteLiteral(tEvent.TripID), QuoteLiteral(tEvent.Timestamp),
+		d.Point(tEvent.Longitude, tEvent.Latitude), attributeValues(tEvent), tenantValue(target, tEvent.Tenant), onConflict())
+}
+
+// BulkInsertEventsSQL returns a single statement inserting all events using UNNEST, the events have to belong to the same tenant
+func BulkInsertEventsSQL(target DBTarget, events []workload.TripEvent) string {
+	d := target.Dialect()
+	eventIds := make([]string, len(events))
+	tripIds := make([]string, len(events))
+	timestamps := make([]string, len(events))
+	points := make([]string, len(events))
+	for i, tEvent := range events {
+		eventIds[i] = tEvent.EventID
+		tripIds[i] = tEvent.TripID
+		timestamps[i] = tEvent.Timestamp
+		points[i] = d.Point(tEvent.Longitude, tEvent.Latitude)
+	}
+
+	return fmt.Sprintf(`
+INSERT INTO %s (
+	event_id,
+	trip_id,
+	timestamp,
+	geo_point%s%s
+)
+(SELECT *
+	FROM  UNNEST(
+	%s,
+	%s,
+	%s,
+	%s%s%s
+	)
+)%s;`,
+		eventsTable(target, events[0].Tenant),
+		attributeColumns(",\n\t"),
+		tenantColumn(target, events[0].Tenant, ",\n\t"),
+		d.StringArray(eventIds, uuidType),
+		d.StringArray(tripIds, uuidType),
+		d.StringArray(timestamps, timestamptzType),
+		d.Array(points, pointType),
+		attributeArrays(d, events),
+		tenantArray(d, events),
+		onConflict(),
+	)
+}
+
+// InsertPOIsSQL returns a single statement inserting all POIs using UNNEST
+func InsertPOIsSQL(target DBTarget, pois []workload.POI) string {
+	d := target.Dialect()
+	poiIds := make([]string, len(pois))
+	names := make([]string, len(pois))
+	categories := make([]string, len(pois))
+	points := make([]string, len(pois))
+	for i, poi := range pois {
+		poiIds[i] = poi.POIID
+		names[i] = poi.Name
+		categories[i] = poi.Category
+		points[i] = d.Point(poi.Longitude, poi.Latitude)
+	}
+
+	return fmt.Sprintf(`
+	INSERT INTO %s (
+		poi_id,
+		name,
+		category,
+		geo_point
+	)
+	(SELECT *
+		FROM  UNNEST(
+		%s,
+		%s,
+		%s,
+		%s
+		)
+	);`,
+		Table("pois"),
+		d.StringArray(poiIds, uuidType),
+		d.StringArray(names, ""),
+		d.StringArray(categories, ""),
+		d.Array(points, pointType),
+	)
+}
+
+// LocalityInsertSQL returns the statement inserting a locality with the parameters id, name and GeoJSON geometry.
+// makeValid repairs invalid geometries with ST_MakeValid, which CrateDB does not support.
+func LocalityInsertSQL(target DBTarget, makeValid bool) string {
+	d := target.Dialect()
+	geometry := d.GeometryFromGeoJSON(d.Placeholder(3))
+	if target == MobilityDB && makeValid {
+		geometry = "ST_Multi(ST_CollectionExtract(ST_MakeValid(" + geometry + "), 3))"
+	}
+	return PrefixTables(fmt.Sprintf(`INSERT INTO localities ( locality_id, name, geo_shape)
+		VALUES ( %s, %s, %s);`, d.Placeholder(1), d.Placeholder(2), geometry))
+}
+
+// NoParkingZoneInsertSQL returns the statement inserting a no-parking zone with the parameters id, name and GeoJSON geometry
+func NoParkingZoneInsertSQL(target DBTarget) string {
+	d := target.Dialect()
+	return PrefixTables(fmt.Sprintf(`INSERT INTO no_parking_zones (zone_id, name, geo_shape)
+		VALUES (%s, %s, %s);`, d.Placeholder(1), d.Placeholder(2), d.GeometryFromGeoJSON(d.Placeholder(3))))
+}
+
+// WeatherInsertSQL returns the statement inserting a weather observation with the parameters
+// observed_at, temperature_c, precipitation_mm and wind_speed_ms, valid for both targets
+func WeatherInsertSQL() string {
+	return PrefixTables(`INSERT INTO weather_observations (observed_at, temperature_c, precipitation_mm, wind_speed_ms)
+		VALUES ($1, $2, $3, $4);`)
+}
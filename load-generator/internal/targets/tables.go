@@ -0,0 +1,92 @@
+package targets
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// tablePrefix is prepended to the benchmark tables, so several runs can coexist in one database
+var tablePrefix string
+
+// benchmarkTables are the tables of the migrations and init, without the table prefix
+var benchmarkTables = []string{"escooter_events", "trips", "pois", "localities", "no_parking_zones", "weather_observations", "benchmark_meta", "schema_migrations"}
+
+// benchmarkIdentifiers are the indexes, partitions and tables named after the benchmark tables,
+// which are prefixed with them, e.g. the index trips_trip_gist and the pre-aggregation table of preagg-bench
+var benchmarkIdentifiers = []string{
+	"escooter_events_timestamp_idx", "escooter_events_default", "escooter_events_per_hour",
+	"trips_trip_gist", "trips_trip_spgist",
+	"pois_geo_point_gist", "pois_geo_point_spgist",
+	"localities_geo_shape_gist", "localities_geo_shape_spgist",
+	"no_parking_zones_geo_shape_gist",
+}
+
+// tableNamePattern matches the string literals and comments, which are skipped, and the benchmark tables and identifiers
+// as whole identifiers, so neither trips_per_hour nor an alias like trips_t is rewritten
+var tableNamePattern = namePattern()
+
+func namePattern() *regexp.Regexp {
+	names := append(slices.Clone(benchmarkTables), benchmarkIdentifiers...)
+	return regexp.MustCompile(`'(?:[^']|'')*'|--[^\n]*|/\*[\s\S]*?\*/|\b(?:` + strings.Join(names, "|") + `)\b`)
+}
+
+// AddPrefixedIdentifiers adds identifiers named after the benchmark tables, e.g. the indexes of index-bench,
+// which PrefixTables prefixes like the tables
+func AddPrefixedIdentifiers(names ...string) {
+	for _, name := range names {
+		if !slices.Contains(benchmarkTables, name) && !slices.Contains(benchmarkIdentifiers, name) {
+			benchmarkIdentifiers = append(benchmarkIdentifiers, name)
+		}
+	}
+	tableNamePattern = namePattern()
+}
+
+var validTablePrefix = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// SetTablePrefix sets the prefix of the benchmark tables, e.g. run42_, empty uses the plain names
+func SetTablePrefix(prefix string) error {
+	if prefix != "" && !validTablePrefix.MatchString(prefix) {
+		return fmt.Errorf("Invalid table prefix %q, expected lowercase letters, digits and underscores starting with a letter", prefix)
+	}
+	tablePrefix = prefix
+	return nil
+}
+
+// Table returns the name of the benchmark table with the table prefix
+func Table(name string) string {
+	return tablePrefix + name
+}
+
+// isBenchmarkTable reports whether table is one of the benchmark tables with the table prefix,
+// other tables of the schema, e.g. of other applications sharing the database, are not
+func isBenchmarkTable(table string) bool {
+	return slices.ContainsFunc(benchmarkTables, func(name string) bool { return table == Table(name) })
+}
+
+// PrefixTables rewrites the names of the benchmark tables and of the identifiers named after them in sql,
+// e.g. in migrations and rendered query templates. A string literal is only rewritten if it is a name as a whole,
+// e.g. 'escooter_events' as a function argument, comments are left as they are.
+func PrefixTables(sql string) string {
+	return prefixTables(tablePrefix, sql)
+}
+
+func prefixTables(prefix, sql string) string {
+	if prefix == "" {
+		return sql
+	}
+	return tableNamePattern.ReplaceAllStringFunc(sql, func(match string) string {
+		switch {
+		case strings.HasPrefix(match, "'"):
+			name := match[1 : len(match)-1]
+			if slices.Contains(benchmarkTables, name) || slices.Contains(benchmarkIdentifiers, name) {
+				return "'" + prefix + name + "'"
+			}
+			return match
+		case strings.HasPrefix(match, "--"), strings.HasPrefix(match, "/*"):
+			return match
+		}
+		return prefix + match
+	})
+}
@@ -0,0 +1,58 @@
+package targets
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestPrefixTables(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want string
+	}{
+		{"table", "SELECT * FROM trips", "SELECT * FROM run1_trips"},
+		{"qualified column", "SELECT trips.trip_id FROM trips", "SELECT run1_trips.trip_id FROM run1_trips"},
+		{"alias", "SELECT trips_t.trip_id FROM trips AS trips_t JOIN pois p ON true",
+			"SELECT trips_t.trip_id FROM run1_trips AS trips_t JOIN run1_pois p ON true"},
+		{"CTE", "WITH trips_per_hour AS (SELECT date_trunc('hour', timestamp) AS hour, count(*) FROM escooter_events GROUP BY 1) SELECT * FROM trips_per_hour",
+			"WITH trips_per_hour AS (SELECT date_trunc('hour', timestamp) AS hour, count(*) FROM run1_escooter_events GROUP BY 1) SELECT * FROM trips_per_hour"},
+		{"column named after a table", "SELECT pois_count FROM localities", "SELECT pois_count FROM run1_localities"},
+		{"index", "CREATE INDEX IF NOT EXISTS trips_trip_gist ON trips USING GIST (trip)",
+			"CREATE INDEX IF NOT EXISTS run1_trips_trip_gist ON run1_trips USING GIST (trip)"},
+		{"quoted identifier", `SELECT * FROM "escooter_events"`, `SELECT * FROM "run1_escooter_events"`},
+		{"table name literal", "SELECT create_reference_table('pois')", "SELECT create_reference_table('run1_pois')"},
+		{"other literal", "SELECT * FROM pois WHERE name = 'trips and pois' OR name = 'O''Brien''s trips'",
+			"SELECT * FROM run1_pois WHERE name = 'trips and pois' OR name = 'O''Brien''s trips'"},
+		{"comment", "-- the trips' events\nSELECT * FROM trips /* trips */", "-- the trips' events\nSELECT * FROM run1_trips /* trips */"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := prefixTables("run1_", tt.sql); got != tt.want {
+				t.Errorf("prefixTables =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+	if got := prefixTables("", "SELECT * FROM trips"); got != "SELECT * FROM trips" {
+		t.Errorf("prefixTables without prefix = %s", got)
+	}
+}
+
+func TestAddPrefixedIdentifiers(t *testing.T) {
+	defer func(identifiers []string) {
+		benchmarkIdentifiers = identifiers
+		tableNamePattern = namePattern()
+	}(slices.Clone(benchmarkIdentifiers))
+
+	sql := "CREATE INDEX escooter_events_geo_point_gist ON escooter_events USING GIST (geo_point)"
+	if got, want := prefixTables("run1_", sql), "CREATE INDEX escooter_events_geo_point_gist ON run1_escooter_events USING GIST (geo_point)"; got != want {
+		t.Errorf("prefixTables of an unknown index =\n%s\nwant\n%s", got, want)
+	}
+	AddPrefixedIdentifiers("escooter_events_geo_point_gist", "trips")
+	if got, want := prefixTables("run1_", sql), "CREATE INDEX run1_escooter_events_geo_point_gist ON run1_escooter_events USING GIST (geo_point)"; got != want {
+		t.Errorf("prefixTables of an added index =\n%s\nwant\n%s", got, want)
+	}
+	if slices.Contains(benchmarkIdentifiers, "trips") {
+		t.Errorf("the table trips was added as identifier")
+	}
+}
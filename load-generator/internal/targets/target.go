@@ -0,0 +1,33 @@
+// Package targets contains the database specific parts of the benchmark:
+// the supported targets, the SQL statements they require and their initialization.
+package targets
+
+import "fmt"
+
+type DBTarget int
+
+const (
+	CrateDB    DBTarget = 0
+	MobilityDB DBTarget = 1
+)
+
+func (target DBTarget) String() string {
+	switch target {
+	case CrateDB:
+		return "crateDB"
+	case MobilityDB:
+		return "mobilityDB"
+	}
+	return fmt.Sprintf("DBTarget(%d)", int(target))
+}
+
+// Parse returns the target for its CLI name
+func Parse(name string) (DBTarget, error) {
+	switch name {
+	case "cratedb":
+		return CrateDB, nil
+	case "mobilitydbc":
+		return MobilityDB, nil
+	}
+	return 0, fmt.Errorf("Unknown db target %q, expected cratedb or mobilitydbc", name)
+}
@@ -0,0 +1,74 @@
+package targets
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+
+	"load-generator/internal/workload"
+)
+
+// TenantSchemaVariant is the MobilityDB schema variant whose events and trips have the column tenant_id,
+// CrateDB's tenants get a schema each instead
+const TenantSchemaVariant = "tenants"
+
+// TenantSchema returns the CrateDB schema with the tables of the tenant, tenants are numbered from 1
+func TenantSchema(tenant int) string {
+	return fmt.Sprintf("tenant_%d", tenant)
+}
+
+// UseTenantSchema makes the unqualified tables of the connection's statements, e.g. of the migrations, the tables of the tenant (CrateDB only)
+func UseTenantSchema(ctx context.Context, conn *pgx.Conn, tenant int) error {
+	if _, err := conn.Exec(ctx, "SET search_path TO "+TenantSchema(tenant)); err != nil {
+		return fmt.Errorf("Switching to the schema of tenant %d: %w", tenant, err)
+	}
+	return nil
+}
+
+// TenantTables is PrefixTables qualifying the tables with the schema of the tenant on CrateDB.
+// MobilityDB's tenants share the tables, their queries filter by tenant_id. Tenant 0 leaves the tables unqualified.
+func TenantTables(target DBTarget, tenant int, sql string) string {
+	if target != CrateDB || tenant == 0 {
+		return PrefixTables(sql)
+	}
+	return prefixTables(TenantSchema(tenant)+"."+tablePrefix, sql)
+}
+
+// eventsTable returns the events table the events of the tenant are inserted into
+func eventsTable(target DBTarget, tenant int) string {
+	if target == CrateDB && tenant > 0 {
+		return TenantSchema(tenant) + "." + Table("escooter_events")
+	}
+	return Table("escooter_events")
+}
+
+// tenantColumn returns the tenant_id column of MobilityDB prefixed with sep for the events of a tenant,
+// empty without tenant and on CrateDB, whose tenants have their own tables
+func tenantColumn(target DBTarget, tenant int, sep string) string {
+	if target != MobilityDB || tenant == 0 {
+		return ""
+	}
+	return sep + "tenant_id"
+}
+
+// tenantValue returns the tenant prefixed with a comma for the column of tenantColumn, empty without tenant
+func tenantValue(target DBTarget, tenant int) string {
+	if target != MobilityDB || tenant == 0 {
+		return ""
+	}
+	return fmt.Sprintf(", %d", tenant)
+}
+
+// tenantArray returns the UNNEST array of the tenants of the events for the column of tenantColumn prefixed with a comma, empty without tenants
+func tenantArray(d Dialect, events []workload.TripEvent) string {
+	if d.target != MobilityDB || events[0].Tenant == 0 {
+		return ""
+	}
+	tenants := make([]string, len(events))
+	for i, event := range events {
+		tenants[i] = strconv.Itoa(event.Tenant)
+	}
+	return ",\n\t" + d.Array(tenants, integerType)
+}
@@ -0,0 +1,242 @@
+package targets
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Schema maps the tables to their columns and normalized column types
+type Schema map[string]map[string]string
+
+var (
+	createTableRe = regexp.MustCompile(`(?is)^CREATE\s+TABLE\s+(?:IF\s+NOT\s+EXISTS\s+)?"?(\w+)"?\s*(\()?`)
+	dropTableRe   = regexp.MustCompile(`(?is)^DROP\s+TABLE\s+(?:IF\s+EXISTS\s+)?"?(\w+)"?`)
+	addColumnRe   = regexp.MustCompile(`(?is)^ALTER\s+TABLE\s+"?(\w+)"?\s+ADD\s+(?:COLUMN\s+)?(?:IF\s+NOT\s+EXISTS\s+)?(.+)$`)
+	columnEndRe   = regexp.MustCompile(`(?i)\s+(PRIMARY|NOT|NULL|DEFAULT|GENERATED|AS|INDEX|STORAGE|REFERENCES|UNIQUE|CHECK|CONSTRAINT)\b`)
+	typeParamsRe  = regexp.MustCompile(`\s*\(.*\)$`)
+	sqlCommentRe  = regexp.MustCompile(`(?m)--.*$`)
+	constraintRe  = regexp.MustCompile(`(?i)^(PRIMARY\s+KEY|CONSTRAINT|UNIQUE|CHECK|FOREIGN\s+KEY|INDEX)\b`)
+	typeSynonyms  = map[string]string{
+		"string":      "text",
+		"varchar":     "character varying",
+		"timestamptz": "timestamp with time zone",
+		"timestamp":   "timestamp without time zone",
+		"int":         "integer",
+		"int4":        "integer",
+		"int8":        "bigint",
+		"long":        "bigint",
+		"int2":        "smallint",
+		"short":       "smallint",
+		"float8":      "double precision",
+		"double":      "double precision",
+		"float4":      "real",
+		"float":       "real",
+		"bool":        "boolean",
+		"decimal":     "numeric",
+	}
+)
+
+// normalizeType maps a column type of the DDL or of information_schema to one spelling, dropping type parameters,
+// e.g. geometry(Point, 4326) becomes geometry and TIMESTAMPTZ timestamp with time zone
+func normalizeType(columnType string) string {
+	t := strings.ToLower(strings.Join(strings.Fields(columnType), " "))
+	if strings.HasSuffix(t, "[]") || strings.HasPrefix(t, "array") || strings.HasSuffix(t, "_array") {
+		return "array"
+	}
+	t = typeParamsRe.ReplaceAllString(t, "")
+	if synonym, ok := typeSynonyms[t]; ok {
+		return synonym
+	}
+	return t
+}
+
+// splitTopLevel splits s at the commas outside of parentheses and quotes
+func splitTopLevel(s string) []string {
+	var parts []string
+	depth, start, quoted := 0, 0, false
+	for i, r := range s {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case quoted:
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case r == ',' && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// parseColumn returns the name and normalized type of a column definition, ok is false for table constraints
+func parseColumn(definition string) (string, string, bool) {
+	definition = strings.TrimSpace(definition)
+	if definition == "" || constraintRe.MatchString(definition) {
+		return "", "", false
+	}
+	name, rest, _ := strings.Cut(definition, " ")
+	if loc := columnEndRe.FindStringIndex(" " + rest); loc != nil {
+		rest = (" " + rest)[:loc[0]]
+	}
+	return strings.ToLower(strings.Trim(name, `"`)), normalizeType(rest), true
+}
+
+// ExpectedSchema returns the tables and columns the migrations of the schema variant create, rendered with the params of opts.
+// Tables without a column list, e.g. partitions created with PARTITION OF, are expected without columns.
+func ExpectedSchema(opts InitOptions) (Schema, error) {
+	migrationFiles, err := MigrationFiles(opts.MigrationsDir, opts.SchemaVariant)
+	if err != nil {
+		return nil, err
+	}
+	if len(migrationFiles) == 0 {
+		return nil, fmt.Errorf("No migration files in %s", VariantDir(opts.MigrationsDir, opts.SchemaVariant))
+	}
+
+	schema := Schema{}
+	for _, migrationFile := range migrationFiles {
+		migrationSQL, err := ReadMigration(migrationFile, opts.Params)
+		if err != nil {
+			return nil, err
+		}
+		for _, stmt := range SplitStatements(sqlCommentRe.ReplaceAllString(migrationSQL, "")) {
+			stmt = strings.TrimSpace(stmt)
+			if m := dropTableRe.FindStringSubmatch(stmt); m != nil {
+				delete(schema, strings.ToLower(m[1]))
+			} else if m := createTableRe.FindStringSubmatchIndex(stmt); m != nil {
+				table := strings.ToLower(stmt[m[2]:m[3]])
+				schema[table] = map[string]string{}
+				if m[4] < 0 {
+					continue
+				}
+				body := stmt[m[5]:]
+				if end := closingParen(body); end >= 0 {
+					body = body[:end]
+				}
+				for _, definition := range splitTopLevel(body) {
+					if name, columnType, ok := parseColumn(definition); ok {
+						schema[table][name] = columnType
+					}
+				}
+			} else if m := addColumnRe.FindStringSubmatch(stmt); m != nil {
+				if columns, ok := schema[strings.ToLower(m[1])]; ok {
+					if name, columnType, ok := parseColumn(m[2]); ok {
+						columns[name] = columnType
+					}
+				}
+			}
+		}
+	}
+	return schema, nil
+}
+
+// closingParen returns the index of the parenthesis closing the already opened one, -1 if there is none
+func closingParen(s string) int {
+	depth := 1
+	for i, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// LiveSchema reads the tables and columns of the current schema, with a table prefix only the tables of this run.
+// Nested object columns of CrateDB are left out.
+func LiveSchema(ctx context.Context, conn *pgx.Conn, target DBTarget) (Schema, error) {
+	typeColumn := "data_type"
+	if target == MobilityDB {
+		// extension types like geometry and tgeogpoint are reported as USER-DEFINED
+		typeColumn = "CASE WHEN data_type = 'USER-DEFINED' THEN udt_name ELSE data_type END"
+	}
+	rows, err := conn.Query(ctx, fmt.Sprintf(`
+		SELECT c.table_name, c.column_name, %s
+		FROM information_schema.columns c
+		JOIN information_schema.tables t ON t.table_schema = c.table_schema AND t.table_name = c.table_name
+		WHERE c.table_schema = CURRENT_SCHEMA AND t.table_type = 'BASE TABLE'`, typeColumn))
+	if err != nil {
+		return nil, fmt.Errorf("Reading columns: %w", err)
+	}
+	defer rows.Close()
+
+	schema := Schema{}
+	for rows.Next() {
+		var table, column, columnType string
+		if err := rows.Scan(&table, &column, &columnType); err != nil {
+			return nil, fmt.Errorf("Reading columns: %w", err)
+		}
+		if !strings.HasPrefix(table, tablePrefix) || strings.Contains(column, "[") {
+			continue
+		}
+		if schema[table] == nil {
+			schema[table] = map[string]string{}
+		}
+		schema[table][column] = normalizeType(columnType)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Reading columns: %w", err)
+	}
+	return schema, nil
+}
+
+// DiffSchemas returns the differences of the live schema to the expected one as readable lines, none if they match.
+// schema_migrations is created by init itself and tables named after an expected table, e.g. partitions, are not reported as unexpected.
+func DiffSchemas(expected, live Schema) []string {
+	var diffs []string
+	for _, table := range slices.Sorted(maps.Keys(expected)) {
+		liveColumns, ok := live[table]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("missing table %s", table))
+			continue
+		}
+		for _, column := range slices.Sorted(maps.Keys(expected[table])) {
+			liveType, ok := liveColumns[column]
+			switch {
+			case !ok:
+				diffs = append(diffs, fmt.Sprintf("missing column %s.%s %s", table, column, expected[table][column]))
+			case liveType != expected[table][column]:
+				diffs = append(diffs, fmt.Sprintf("column %s.%s has type %s, expected %s", table, column, liveType, expected[table][column]))
+			}
+		}
+		// tables without a column list in the DDL only have to exist
+		if len(expected[table]) == 0 {
+			continue
+		}
+		for _, column := range slices.Sorted(maps.Keys(liveColumns)) {
+			if _, ok := expected[table][column]; !ok {
+				diffs = append(diffs, fmt.Sprintf("unexpected column %s.%s %s", table, column, liveColumns[column]))
+			}
+		}
+	}
+
+	for _, table := range slices.Sorted(maps.Keys(live)) {
+		if _, ok := expected[table]; ok || table == Table("schema_migrations") || namedAfterAny(table, expected) {
+			continue
+		}
+		diffs = append(diffs, fmt.Sprintf("unexpected table %s", table))
+	}
+	return diffs
+}
+
+func namedAfterAny(table string, schema Schema) bool {
+	for expected := range schema {
+		if strings.HasPrefix(table, expected+"_") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,152 @@
+// Package toxiproxy configures proxies and their toxics, e.g. latency and bandwidth limits,
+// over the HTTP API of a Toxiproxy server
+package toxiproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrConnection is wrapped by errors of requests that didn't reach the Toxiproxy API
+var ErrConnection = errors.New("Toxiproxy API connection failed")
+
+// Proxy forwards the connections of Listen to Upstream
+type Proxy struct {
+	Name     string `json:"name"`
+	Listen   string `json:"listen"`
+	Upstream string `json:"upstream"`
+	Enabled  bool   `json:"enabled"`
+}
+
+// Toxic impairs the data flowing through a proxy in one direction, the stream upstream or downstream
+type Toxic struct {
+	Name       string         `json:"name"`
+	Type       string         `json:"type"` // e.g. latency or bandwidth
+	Stream     string         `json:"stream"`
+	Toxicity   float64        `json:"toxicity"` // probability the toxic applies to a connection
+	Attributes map[string]int `json:"attributes"`
+}
+
+// Client talks to the API of a Toxiproxy server, e.g. http://localhost:8474
+type Client struct {
+	baseURL string
+	http    *http.Client
+}
+
+func NewClient(baseURL string) *Client {
+	return &Client{baseURL: strings.TrimSuffix(baseURL, "/"), http: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// CreateProxy creates the proxy, replacing a proxy of the same name left over from an earlier run
+func (c *Client) CreateProxy(ctx context.Context, proxy Proxy) error {
+	err := c.do(ctx, http.MethodPost, "/proxies", proxy, http.StatusCreated)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict {
+		if err := c.DeleteProxy(ctx, proxy.Name); err != nil {
+			return err
+		}
+		err = c.do(ctx, http.MethodPost, "/proxies", proxy, http.StatusCreated)
+	}
+	return err
+}
+
+func (c *Client) DeleteProxy(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, "/proxies/"+name, nil, http.StatusNoContent)
+}
+
+// SetToxics replaces the toxics of the proxy
+func (c *Client) SetToxics(ctx context.Context, proxy string, toxics []Toxic) error {
+	var existing []Toxic
+	if err := c.get(ctx, "/proxies/"+proxy+"/toxics", &existing); err != nil {
+		return err
+	}
+	for _, toxic := range existing {
+		if err := c.do(ctx, http.MethodDelete, "/proxies/"+proxy+"/toxics/"+toxic.Name, nil, http.StatusNoContent); err != nil {
+			return err
+		}
+	}
+	for _, toxic := range toxics {
+		if err := c.do(ctx, http.MethodPost, "/proxies/"+proxy+"/toxics", toxic, http.StatusOK); err != nil {
+			return fmt.Errorf("Adding toxic %s: %w", toxic.Name, err)
+		}
+	}
+	return nil
+}
+
+// APIError is a response of the API with an unexpected status code
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("Toxiproxy API returned %d: %s", e.StatusCode, e.Message)
+}
+
+func (c *Client) get(ctx context.Context, path string, v any) error {
+	resp, err := c.request(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body any, wantStatus int) error {
+	resp, err := c.request(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// older servers answer toxic creation and deletion with 200
+	if resp.StatusCode != wantStatus && resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+func (c *Client) request(ctx context.Context, method, path string, body any) (*http.Response, error) {
+	var reqBody io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrConnection, err)
+	}
+	return resp, nil
+}
+
+func responseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	var msg struct {
+		Error string `json:"error"`
+	}
+	message := strings.TrimSpace(string(body))
+	if json.Unmarshal(body, &msg) == nil && msg.Error != "" {
+		message = msg.Error
+	}
+	return &APIError{StatusCode: resp.StatusCode, Message: message}
+}
@@ -0,0 +1,216 @@
+// Package websocket accepts WebSocket connections of an HTTP server and sends text messages over them
+// using the subset of RFC 6455 needed for it: unfragmented server messages, pings and the closing handshake
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// opcodes of the frames
+const (
+	opText  = 0x1
+	opClose = 0x8
+	opPing  = 0x9
+	opPong  = 0xA
+)
+
+// appended to the key of the client to compute the accept header of the handshake
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// control frames of the client are at most 125 bytes, data frames are discarded in chunks
+const maxControlPayload = 125
+
+// ErrClosed is returned when writing to a connection that was closed by either side
+var ErrClosed = errors.New("websocket connection closed")
+
+// Conn is a server side WebSocket connection, messages of the client are discarded
+type Conn struct {
+	conn net.Conn
+	rw   *bufio.ReadWriter
+
+	mu     sync.Mutex // serializes the writes
+	closed bool
+	done   chan struct{} // closed once the client closed the connection or reading failed
+}
+
+// Upgrade performs the opening handshake of the request and takes over its connection
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if r.Method != http.MethodGet || !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "expected a WebSocket upgrade request", http.StatusUpgradeRequired)
+		return nil, errors.New("Not a WebSocket upgrade request")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("Unsupported WebSocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("Missing Sec-WebSocket-Key")
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "connection can't be upgraded", http.StatusInternalServerError)
+		return nil, errors.New("ResponseWriter doesn't support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("Hijacking connection: %w", err)
+	}
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(sum[:]))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Writing handshake: %w", err)
+	}
+	c := &Conn{conn: conn, rw: rw, done: make(chan struct{})}
+	go c.readLoop()
+	return c, nil
+}
+
+func headerContains(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, v := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Done is closed once the client closed the connection
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// WriteText sends msg as a text message, failing if it can't be written within timeout
+func (c *Conn) WriteText(msg []byte, timeout time.Duration) error {
+	return c.writeFrame(opText, msg, timeout)
+}
+
+// Close sends a normal closure and closes the connection
+func (c *Conn) Close() error {
+	c.writeFrame(opClose, []byte{0x03, 0xE8}, time.Second) // 1000 normal closure
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return c.conn.Close()
+}
+
+func (c *Conn) writeFrame(opcode byte, payload []byte, timeout time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	header := []byte{0x80 | opcode} // FIN, servers don't mask
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, byte(n))
+	case n <= 0xFFFF:
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(timeout))
+	c.rw.Write(header)
+	c.rw.Write(payload)
+	if err := c.rw.Flush(); err != nil {
+		c.closed = true
+		c.conn.Close()
+		return err
+	}
+	return nil
+}
+
+// readLoop discards the messages of the client, answers pings and its closing handshake
+func (c *Conn) readLoop() {
+	defer close(c.done)
+	for {
+		opcode, payload, err := c.readFrame()
+		if err != nil {
+			c.mu.Lock()
+			c.closed = true
+			c.conn.Close()
+			c.mu.Unlock()
+			return
+		}
+		switch opcode {
+		case opPing:
+			c.writeFrame(opPong, payload, time.Second)
+		case opClose:
+			c.writeFrame(opClose, payload, time.Second)
+			c.mu.Lock()
+			c.closed = true
+			c.conn.Close()
+			c.mu.Unlock()
+			return
+		}
+	}
+}
+
+// readFrame returns the opcode of the next frame, the payload only for control frames.
+// Frames of the client have to be masked.
+func (c *Conn) readFrame() (byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.rw, head[:]); err != nil {
+		return 0, nil, err
+	}
+	opcode := head[0] & 0x0F
+	if head[1]&0x80 == 0 {
+		return 0, nil, errors.New("Unmasked frame of the client")
+	}
+	length := uint64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.rw, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.rw, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+		if length > 1<<63-1 {
+			return 0, nil, errors.New("Frame length with the most significant bit set")
+		}
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(c.rw, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	if opcode < opClose {
+		_, err := io.CopyN(io.Discard, c.rw, int64(length))
+		return opcode, nil, err
+	}
+	if length > maxControlPayload {
+		return 0, nil, fmt.Errorf("Control frame of %d bytes exceeds %d bytes", length, maxControlPayload)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.rw, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return opcode, payload, nil
+}
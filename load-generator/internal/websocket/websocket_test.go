@@ -0,0 +1,194 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The golden frames and the handshake are the examples of RFC 6455
+
+// the sample key of the client and the accept value of the server of RFC 6455 section 1.3
+const (
+	sampleKey    = "dGhlIHNhbXBsZSBub25jZQ=="
+	sampleAccept = "s3pPLMBiTxaQ9kYGzzhZRbK+xOo="
+)
+
+// upgradeServer hands the connections it upgrades to the returned channel
+func upgradeServer(t *testing.T) (*httptest.Server, <-chan *Conn) {
+	t.Helper()
+	conns := make(chan *Conn, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if conn, err := Upgrade(w, r); err == nil {
+			conns <- conn
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, conns
+}
+
+// dial performs the opening handshake as client and returns the connection and the server's side of it
+func dial(t *testing.T) (net.Conn, *bufio.Reader, *Conn) {
+	t.Helper()
+	server, conns := upgradeServer(t)
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	io.WriteString(conn, "GET /stream HTTP/1.1\r\nHost: localhost\r\nUpgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n"+
+		"Sec-WebSocket-Key: "+sampleKey+"\r\nSec-WebSocket-Version: 13\r\n\r\n")
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatalf("reading handshake: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != sampleAccept {
+		t.Fatalf("handshake %s with accept %q, want 101 with %q", resp.Status, resp.Header.Get("Sec-WebSocket-Accept"), sampleAccept)
+	}
+	select {
+	case c := <-conns:
+		t.Cleanup(func() { c.Close() })
+		return conn, r, c
+	case <-time.After(10 * time.Second):
+		t.Fatal("connection wasn't upgraded")
+		return nil, nil, nil
+	}
+}
+
+// expectFrame reads the frame the server has to send next
+func expectFrame(t *testing.T, r io.Reader, want []byte) {
+	t.Helper()
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(r, got); err != nil {
+		t.Fatalf("reading frame: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("frame =\n% x\nwant\n% x", got, want)
+	}
+}
+
+func expectDone(t *testing.T, c *Conn) {
+	t.Helper()
+	select {
+	case <-c.Done():
+	case <-time.After(10 * time.Second):
+		t.Fatal("connection wasn't closed")
+	}
+	if err := c.WriteText([]byte("late"), time.Second); err != ErrClosed {
+		t.Errorf("WriteText after closing = %v, want ErrClosed", err)
+	}
+}
+
+func TestUpgradeRejected(t *testing.T) {
+	server, _ := upgradeServer(t)
+	tests := []struct {
+		name       string
+		method     string
+		header     map[string]string
+		wantStatus int
+	}{
+		{"no upgrade", http.MethodGet, map[string]string{"Sec-WebSocket-Version": "13", "Sec-WebSocket-Key": sampleKey}, http.StatusUpgradeRequired},
+		{"POST", http.MethodPost, map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "13", "Sec-WebSocket-Key": sampleKey}, http.StatusUpgradeRequired},
+		{"old version", http.MethodGet, map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "8", "Sec-WebSocket-Key": sampleKey}, http.StatusUpgradeRequired},
+		{"without key", http.MethodGet, map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "13"}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, server.URL, nil)
+			for name, value := range tt.header {
+				req.Header.Set(name, value)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.name == "old version" && resp.Header.Get("Sec-WebSocket-Version") != "13" {
+				t.Errorf("response doesn't announce version 13")
+			}
+		})
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	conn, r, c := dial(t)
+	defer conn.Close()
+	medium := bytes.Repeat([]byte{'m'}, 256)
+	long := bytes.Repeat([]byte{'l'}, 65536)
+	for _, tt := range []struct {
+		msg    []byte
+		header []byte
+	}{
+		{[]byte("Hello"), []byte{0x81, 0x05}},
+		{medium, []byte{0x81, 0x7e, 0x01, 0x00}},
+		{long, []byte{0x81, 0x7f, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00}},
+	} {
+		errCh := make(chan error, 1)
+		go func() { errCh <- c.WriteText(tt.msg, 5*time.Second) }()
+		expectFrame(t, r, append(tt.header, tt.msg...))
+		if err := <-errCh; err != nil {
+			t.Errorf("WriteText failed: %v", err)
+		}
+	}
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- c.Close() }()
+	expectFrame(t, r, []byte{0x88, 0x02, 0x03, 0xe8})
+	<-errCh
+	if err := c.WriteText([]byte("late"), time.Second); err != ErrClosed {
+		t.Errorf("WriteText after Close = %v, want ErrClosed", err)
+	}
+}
+
+func TestPingAndClose(t *testing.T) {
+	conn, r, c := dial(t)
+	// a masked text frame of 300 bytes is discarded
+	text := append([]byte{0x81, 0xfe, 0x01, 0x2c, 1, 2, 3, 4}, bytes.Repeat([]byte{'x'}, 300)...)
+	conn.Write(text)
+	// the masked ping "Hello" of RFC 6455 section 5.7 is answered with an unmasked pong
+	conn.Write([]byte{0x89, 0x85, 0x37, 0xfa, 0x21, 0x3d, 0x7f, 0x9f, 0x4d, 0x51, 0x58})
+	expectFrame(t, r, []byte{0x8a, 0x05, 'H', 'e', 'l', 'l', 'o'})
+	// a close with status 1001 going away, masked with zeros, is echoed
+	conn.Write([]byte{0x88, 0x82, 0, 0, 0, 0, 0x03, 0xe9})
+	expectFrame(t, r, []byte{0x88, 0x02, 0x03, 0xe9})
+	expectDone(t, c)
+}
+
+func TestReadMalformed(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame []byte
+	}{
+		{"truncated header", []byte{0x81}},
+		{"unmasked frame", []byte{0x81, 0x02, 'h', 'i'}},
+		{"truncated 16 bit length", []byte{0x81, 0xfe, 0x01}},
+		{"truncated 64 bit length", []byte{0x81, 0xff, 0x00, 0x00, 0x00}},
+		{"64 bit length with the most significant bit set", []byte{0x81, 0xff, 0x80, 0, 0, 0, 0, 0, 0, 0, 1, 2, 3, 4}},
+		{"truncated mask", []byte{0x81, 0x82, 1, 2}},
+		{"truncated data", []byte{0x81, 0x85, 1, 2, 3, 4, 'h'}},
+		{"control frame over 125 bytes", append([]byte{0x89, 0xfe, 0x00, 0x7e, 1, 2, 3, 4}, make([]byte, 126)...)},
+		{"truncated control frame", []byte{0x89, 0x85, 1, 2, 3, 4, 'h'}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, _, c := dial(t)
+			conn.Write(tt.frame)
+			// the truncated frames end with the connection
+			if strings.HasPrefix(tt.name, "truncated") {
+				conn.(*net.TCPConn).CloseWrite()
+			}
+			expectDone(t, c)
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package workload
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// What insert does with a malformed row of the trips file
+const (
+	BadRowFail       = "fail"       // abort the run
+	BadRowSkip       = "skip"       // log the row and continue
+	BadRowDeadLetter = "deadletter" // write the row to the dead-letter file and continue
+)
+
+// BadRowError is a row of a trip events CSV which can't be parsed or, with a strict reader, has invalid values.
+// The reader continues with the next row.
+type BadRowError struct {
+	Line   int
+	Reason string
+	Record []string // fields of the row, empty if it couldn't be split into fields
+}
+
+func (e *BadRowError) Error() string {
+	return fmt.Sprintf("Malformed trip event on line %d: %s", e.Line, e.Reason)
+}
+
+// ParseBadRowPolicy validates the value of -on-bad-row
+func ParseBadRowPolicy(s string) (string, error) {
+	switch s {
+	case BadRowFail, BadRowSkip, BadRowDeadLetter:
+		return s, nil
+	}
+	return "", fmt.Errorf("Unknown bad row policy %q, expected %s, %s or %s", s, BadRowFail, BadRowSkip, BadRowDeadLetter)
+}
+
+// validateTripEvent returns why the event can't be inserted, empty if it can
+func validateTripEvent(event TripEvent) string {
+	if event.EventID == "" || event.TripID == "" {
+		return "empty event_id or trip_id"
+	}
+	if _, err := ParseTimestamp(event.Timestamp); err != nil {
+		return fmt.Sprintf("unparseable timestamp %q", event.Timestamp)
+	}
+	lat, err1 := strconv.ParseFloat(event.Latitude, 64)
+	lon, err2 := strconv.ParseFloat(event.Longitude, 64)
+	switch {
+	case err1 != nil || err2 != nil:
+		return fmt.Sprintf("unparseable latitude %q or longitude %q", event.Latitude, event.Longitude)
+	case lat < -90 || lat > 90 || lon < -180 || lon > 180:
+		return fmt.Sprintf("latitude %s or longitude %s out of range", event.Latitude, event.Longitude)
+	}
+	return ""
+}
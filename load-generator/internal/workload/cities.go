@@ -0,0 +1,71 @@
+package workload
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// CityProfile describes a city datasets are generated or imported for
+type CityProfile struct {
+	Name         string `json:"name"`
+	BBox         BBox   `json:"bbox"`
+	Extract      string `json:"extract"`      // Geofabrik extract containing the city, the source of import-osm
+	AdminLevel   string `json:"adminLevel"`   // admin_level of the boundaries import-osm reads as localities
+	LocalityGrid int    `json:"localityGrid"` // localities of generate-dataset
+	FleetSize    int    `json:"fleetSize"`    // approximate number of shared e-scooters, one generated trip each by default
+}
+
+// CityProfiles are the cities known to -city
+var CityProfiles = map[string]CityProfile{
+	"berlin": {
+		Name:         "berlin",
+		BBox:         BBox{13.09, 52.34, 13.76, 52.68},
+		Extract:      "https://download.geofabrik.de/europe/germany/berlin-latest.osm.pbf",
+		AdminLevel:   "10",
+		LocalityGrid: 10,
+		FleetSize:    30000,
+	},
+	"munich": {
+		Name:         "munich",
+		BBox:         BBox{11.36, 48.06, 11.72, 48.25},
+		Extract:      "https://download.geofabrik.de/europe/germany/bayern/oberbayern-latest.osm.pbf",
+		AdminLevel:   "9",
+		LocalityGrid: 5,
+		FleetSize:    12000,
+	},
+	"hamburg": {
+		Name:         "hamburg",
+		BBox:         BBox{9.73, 53.39, 10.33, 53.74},
+		Extract:      "https://download.geofabrik.de/europe/germany/hamburg-latest.osm.pbf",
+		AdminLevel:   "10",
+		LocalityGrid: 10,
+		FleetSize:    18000,
+	},
+	"cologne": {
+		Name:         "cologne",
+		BBox:         BBox{6.77, 50.83, 7.17, 51.09},
+		Extract:      "https://download.geofabrik.de/europe/germany/nordrhein-westfalen/koeln-regbez-latest.osm.pbf",
+		AdminLevel:   "10",
+		LocalityGrid: 9,
+		FleetSize:    10000,
+	},
+	"vienna": {
+		Name:         "vienna",
+		BBox:         BBox{16.18, 48.12, 16.58, 48.33},
+		Extract:      "https://download.geofabrik.de/europe/austria-latest.osm.pbf",
+		AdminLevel:   "9",
+		LocalityGrid: 5,
+		FleetSize:    9000,
+	},
+}
+
+// LookupCity returns the profile of the named city
+func LookupCity(name string) (CityProfile, error) {
+	profile, ok := CityProfiles[strings.ToLower(name)]
+	if !ok {
+		return CityProfile{}, fmt.Errorf("Unknown city %q, expected one of %s", name, strings.Join(slices.Sorted(maps.Keys(CityProfiles)), ", "))
+	}
+	return profile, nil
+}
@@ -0,0 +1,68 @@
+package workload
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+)
+
+// DownsampleTrips writes every every-th trip of the input CSV with all its events, up to maxTrips trips (0 for no limit),
+// so the smaller file keeps complete trips spread over the whole input. Trips are counted in the order of their first event,
+// the events need not be grouped by trip. Additional columns, e.g. event attributes, are copied.
+// Returns the number of trips and events written.
+func DownsampleTrips(ctx context.Context, tripEventsCSV string, w io.Writer, every, maxTrips int) (int, int, error) {
+	if every < 1 {
+		return 0, 0, fmt.Errorf("Keeping every %d. trip, expected at least 1", every)
+	}
+	f, err := OpenInput(tripEventsCSV)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Opening trip events file: %w", err)
+	}
+	defer f.Close()
+	cr := csv.NewReader(f)
+	cr.ReuseRecord = true
+	cw := csv.NewWriter(w)
+
+	header, err := cr.Read()
+	if err != nil {
+		return 0, 0, fmt.Errorf("Reading trip events header of %s: %w", tripEventsCSV, err)
+	}
+	if err := cw.Write(header); err != nil {
+		return 0, 0, err
+	}
+
+	// kept by trip ID, for every trip seen
+	kept := make(map[string]bool)
+	seen, trips, events := 0, 0, 0
+	for ctx.Err() == nil {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return trips, events, fmt.Errorf("Reading trip events: %w", err)
+		}
+		tripID := rec[1]
+		keep, ok := kept[tripID]
+		if !ok {
+			keep = seen%every == 0 && (maxTrips == 0 || trips < maxTrips)
+			kept[tripID] = keep
+			seen++
+			if keep {
+				trips++
+			}
+		}
+		if !keep {
+			continue
+		}
+		if err := cw.Write(rec); err != nil {
+			return trips, events, err
+		}
+		events++
+	}
+	if err := ctx.Err(); err != nil {
+		return trips, events, err
+	}
+	cw.Flush()
+	return trips, events, cw.Error()
+}
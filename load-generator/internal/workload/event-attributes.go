@@ -0,0 +1,89 @@
+package workload
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+)
+
+// types of event attributes
+const (
+	AttributeText    = "text"
+	AttributeInteger = "integer"
+	AttributeDouble  = "double"
+)
+
+// EventAttribute maps a column of the trips CSV to an additional column of escooter_events,
+// e.g. the battery level, for the wide-row schema variants
+type EventAttribute struct {
+	Column string `json:"column"` // column of escooter_events
+	Source string `json:"source"` // column of the trips CSV, defaults to Column
+	Type   string `json:"type"`   // text, integer or double
+}
+
+var attributeColumnPattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+var coreEventColumns = []string{"event_id", "trip_id", "timestamp", "latitude", "longitude", "geo_point"}
+
+// LoadEventAttributes reads the column mapping of the additional event attributes, a JSON object
+// with the list attributes of objects with column, source and type
+func LoadEventAttributes(path string) ([]EventAttribute, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Reading event attributes: %w", err)
+	}
+	var config struct {
+		Attributes []EventAttribute `json:"attributes"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&config); err != nil {
+		return nil, fmt.Errorf("Parsing event attributes %s: %w", path, err)
+	}
+	seen := make(map[string]bool)
+	for _, column := range coreEventColumns {
+		seen[column] = true
+	}
+	for i, a := range config.Attributes {
+		if !attributeColumnPattern.MatchString(a.Column) {
+			return nil, fmt.Errorf("Event attribute %d has the invalid column %q, expected lowercase letters, digits and underscores", i+1, a.Column)
+		}
+		if seen[a.Column] {
+			return nil, fmt.Errorf("Event attribute column %s is defined twice or is a column of every event", a.Column)
+		}
+		seen[a.Column] = true
+		switch a.Type {
+		case AttributeText, AttributeInteger, AttributeDouble:
+		default:
+			return nil, fmt.Errorf("Event attribute %s has the unknown type %q, expected text, integer or double", a.Column, a.Type)
+		}
+		if a.Source == "" {
+			config.Attributes[i].Source = a.Column
+		}
+	}
+	if len(config.Attributes) == 0 {
+		return nil, fmt.Errorf("No event attributes in %s", path)
+	}
+	return config.Attributes, nil
+}
+
+// parseAttribute checks a value of the attribute, empty values are NULL
+func parseAttribute(a EventAttribute, value string) error {
+	if value == "" {
+		return nil
+	}
+	var err error
+	switch a.Type {
+	case AttributeInteger:
+		_, err = strconv.ParseInt(value, 10, 64)
+	case AttributeDouble:
+		_, err = strconv.ParseFloat(value, 64)
+	}
+	if err != nil {
+		return fmt.Errorf("Invalid %s value %q of %s", a.Type, value, a.Source)
+	}
+	return nil
+}
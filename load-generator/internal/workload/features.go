@@ -0,0 +1,210 @@
+package workload
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// DefaultMaxGeometryBytes is the default limit of the GeoJSON size of a single geometry, larger geometries are skipped
+const DefaultMaxGeometryBytes = 4 << 20
+
+// FeatureFields names the properties (GeoJSON), columns (GeoParquet) or attributes (shapefile) holding the ID and name of features
+type FeatureFields struct {
+	ID   string
+	Name string
+	// MaxGeometryBytes skips features whose geometry is larger as GeoJSON, e.g. a coastline mistakenly exported as locality, 0 disables
+	MaxGeometryBytes int
+}
+
+// LocalityFields are the fields of the localities generate-dataset and import-osm write
+var LocalityFields = FeatureFields{ID: "locality_id", Name: "name", MaxGeometryBytes: DefaultMaxGeometryBytes}
+
+// LoadLocalities reads a GeoJSON FeatureCollection, a GeoParquet file or a shapefile (.shp or .zip) of localities,
+// malformed features are skipped and listed in the report
+func LoadLocalities(path string, fields FeatureFields) ([]Locality, *FeatureReport, error) {
+	features, report, err := loadNamedFeatures(path, "localities", fields)
+	if err != nil {
+		return nil, nil, err
+	}
+	var localities []Locality
+	for _, feat := range features {
+		localities = append(localities, Locality{
+			LocalityID: feat.id,
+			Name:       feat.name,
+			Geometry:   feat.geometry,
+		})
+	}
+	return localities, report, nil
+}
+
+// LoadNoParkingZones reads a GeoJSON FeatureCollection with the properties zone_id and name,
+// malformed features are skipped and listed in the report
+func LoadNoParkingZones(path string) ([]NoParkingZone, *FeatureReport, error) {
+	features, report, err := loadNamedFeatures(path, "no-parking zones", FeatureFields{ID: "zone_id", Name: "name", MaxGeometryBytes: DefaultMaxGeometryBytes})
+	if err != nil {
+		return nil, nil, err
+	}
+	var zones []NoParkingZone
+	for _, feat := range features {
+		zones = append(zones, NoParkingZone{
+			ZoneID:   feat.id,
+			Name:     feat.name,
+			Geometry: feat.geometry,
+		})
+	}
+	return zones, report, nil
+}
+
+// FeatureReport lists the features of a localities or no-parking zones file which were skipped
+type FeatureReport struct {
+	Path      string
+	Kind      string
+	Loaded    int
+	Malformed []MalformedFeature
+}
+
+// MalformedFeature is a skipped feature, Index counts from 0 in the order of the file
+type MalformedFeature struct {
+	Index  int
+	ID     string // empty if the feature has none
+	Reason string
+}
+
+type namedFeature struct {
+	id       string
+	name     string
+	geometry json.RawMessage
+}
+
+// loadNamedFeatures reads a GeoJSON FeatureCollection whose features have the ID and name properties of fields,
+// a GeoParquet file or a shapefile with these columns or attributes and a geometry
+func loadNamedFeatures(path, kind string, fields FeatureFields) ([]namedFeature, *FeatureReport, error) {
+	report := &FeatureReport{Path: path, Kind: kind}
+	var features []namedFeature
+	var err error
+	switch {
+	case isParquet(path):
+		features, err = loadParquetFeatures(path, kind, fields)
+	case isShapefile(path):
+		features, err = loadShapefileFeatures(path, kind, fields)
+	default:
+		features, report.Malformed, err = loadGeoJSONFeatures(path, kind, fields)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the GeoJSON features were checked while streaming them
+	if fields.MaxGeometryBytes > 0 && (isParquet(path) || isShapefile(path)) {
+		kept := features[:0]
+		for i, feat := range features {
+			if len(feat.geometry) > fields.MaxGeometryBytes {
+				report.Malformed = append(report.Malformed, MalformedFeature{Index: i, ID: feat.id, Reason: geometryTooLarge(len(feat.geometry), fields.MaxGeometryBytes)})
+				continue
+			}
+			kept = append(kept, feat)
+		}
+		features = kept
+	}
+	report.Loaded = len(features)
+	return features, report, nil
+}
+
+// loadGeoJSONFeatures decodes the features of a GeoJSON FeatureCollection one at a time,
+// so only the features which are kept are held in memory
+func loadGeoJSONFeatures(path, kind string, fields FeatureFields) ([]namedFeature, []MalformedFeature, error) {
+	f, err := OpenInput(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Reading %s GeoJSON: %w", kind, err)
+	}
+	defer f.Close()
+	dec := json.NewDecoder(bufio.NewReader(f))
+
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, nil, fmt.Errorf("Parsing %s GeoJSON: expected a FeatureCollection: %w", kind, err)
+	}
+	var features []namedFeature
+	var malformed []MalformedFeature
+	hasFeatures := false
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return nil, nil, fmt.Errorf("Parsing %s GeoJSON: %w", kind, err)
+		}
+		if key != "features" {
+			var skipped json.RawMessage
+			if err := dec.Decode(&skipped); err != nil {
+				return nil, nil, fmt.Errorf("Parsing %s GeoJSON: %w", kind, err)
+			}
+			continue
+		}
+		hasFeatures = true
+		if err := expectDelim(dec, '['); err != nil {
+			return nil, nil, fmt.Errorf("Parsing %s GeoJSON: features is not an array: %w", kind, err)
+		}
+		for i := 0; dec.More(); i++ {
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return nil, nil, fmt.Errorf("Parsing feature %d of %s: %w", i, path, err)
+			}
+			feat, reason := parseNamedFeature(raw, fields)
+			if reason != "" {
+				malformed = append(malformed, MalformedFeature{Index: i, ID: feat.id, Reason: reason})
+				continue
+			}
+			features = append(features, feat)
+		}
+		if err := expectDelim(dec, ']'); err != nil {
+			return nil, nil, fmt.Errorf("Parsing %s GeoJSON: %w", kind, err)
+		}
+	}
+	if !hasFeatures {
+		return nil, nil, fmt.Errorf("Parsing %s GeoJSON: %s is not a FeatureCollection, it has no features", kind, path)
+	}
+	return features, malformed, nil
+}
+
+// parseNamedFeature returns the feature or the reason it is malformed, with the ID if it has one
+func parseNamedFeature(raw json.RawMessage, fields FeatureFields) (namedFeature, string) {
+	var feat struct {
+		Properties map[string]any  `json:"properties"`
+		Geometry   json.RawMessage `json:"geometry"`
+	}
+	if err := json.Unmarshal(raw, &feat); err != nil {
+		return namedFeature{}, fmt.Sprintf("not a GeoJSON feature: %v", err)
+	}
+	id, ok := feat.Properties[fields.ID].(string)
+	if !ok {
+		return namedFeature{}, fmt.Sprintf("the %s property is missing or not a string", fields.ID)
+	}
+	name, ok := feat.Properties[fields.Name].(string)
+	if !ok {
+		return namedFeature{id: id}, fmt.Sprintf("the %s property is missing or not a string", fields.Name)
+	}
+	if len(feat.Geometry) == 0 || string(feat.Geometry) == "null" {
+		return namedFeature{id: id}, "the geometry is missing"
+	}
+	if fields.MaxGeometryBytes > 0 && len(feat.Geometry) > fields.MaxGeometryBytes {
+		return namedFeature{id: id}, geometryTooLarge(len(feat.Geometry), fields.MaxGeometryBytes)
+	}
+	return namedFeature{id: id, name: name, geometry: feat.Geometry}, ""
+}
+
+func geometryTooLarge(size, limit int) string {
+	return fmt.Sprintf("the geometry has %d bytes as GeoJSON, more than the limit of %d bytes", size, limit)
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	} else if err != nil {
+		return err
+	}
+	if tok != delim {
+		return fmt.Errorf("expected %s, got %v", delim, tok)
+	}
+	return nil
+}
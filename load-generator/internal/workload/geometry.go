@@ -0,0 +1,282 @@
+package workload
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"load-generator/internal/geo"
+)
+
+// GeometryIssues counts the invalid rings of a GeoJSON Polygon or MultiPolygon.
+// Rings not following the right-hand rule of RFC 7946 are no issue, both databases accept them and FixRings reorients them.
+type GeometryIssues struct {
+	TooFewPositions  int // rings with less than 4 positions, not repairable
+	Unclosed         int // rings whose last position differs from the first
+	SelfIntersecting int // rings with crossing or touching segments, only repairable by the database
+}
+
+func (i GeometryIssues) Valid() bool {
+	return i == GeometryIssues{}
+}
+
+// RepairableRings reports whether FixRings repairs all issues
+func (i GeometryIssues) RepairableRings() bool {
+	return i.TooFewPositions == 0 && i.SelfIntersecting == 0
+}
+
+func (i GeometryIssues) String() string {
+	var parts []string
+	for _, issue := range []struct {
+		count int
+		name  string
+	}{
+		{i.TooFewPositions, "too few positions"},
+		{i.Unclosed, "unclosed"},
+		{i.SelfIntersecting, "self-intersecting"},
+	} {
+		if issue.count > 0 {
+			parts = append(parts, fmt.Sprintf("%d rings %s", issue.count, issue.name))
+		}
+	}
+	if len(parts) == 0 {
+		return "valid"
+	}
+	return strings.Join(parts, ", ")
+}
+
+type position []float64
+
+type geoJSONGeometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+// polygons parses the coordinates of a Polygon or MultiPolygon
+func polygons(geometry json.RawMessage) (string, [][][]position, error) {
+	var g geoJSONGeometry
+	if err := json.Unmarshal(geometry, &g); err != nil {
+		return "", nil, fmt.Errorf("Parsing geometry: %w", err)
+	}
+	var polygons [][][]position
+	switch g.Type {
+	case "Polygon":
+		var polygon [][]position
+		if err := json.Unmarshal(g.Coordinates, &polygon); err != nil {
+			return "", nil, fmt.Errorf("Parsing polygon coordinates: %w", err)
+		}
+		polygons = append(polygons, polygon)
+	case "MultiPolygon":
+		if err := json.Unmarshal(g.Coordinates, &polygons); err != nil {
+			return "", nil, fmt.Errorf("Parsing multipolygon coordinates: %w", err)
+		}
+	default:
+		return "", nil, fmt.Errorf("Unsupported geometry type %q, expected Polygon or MultiPolygon", g.Type)
+	}
+	for _, polygon := range polygons {
+		for _, ring := range polygon {
+			for _, p := range ring {
+				if len(p) < 2 {
+					return "", nil, fmt.Errorf("Position with %d coordinates", len(p))
+				}
+			}
+		}
+	}
+	return g.Type, polygons, nil
+}
+
+// ValidateGeometry checks the closing, number of positions and self-intersections of the rings of a GeoJSON Polygon or MultiPolygon,
+// an error is returned if it is no polygon or can't be parsed
+func ValidateGeometry(geometry json.RawMessage) (GeometryIssues, error) {
+	var issues GeometryIssues
+	_, polygons, err := polygons(geometry)
+	if err != nil {
+		return issues, err
+	}
+	for _, polygon := range polygons {
+		for _, ring := range polygon {
+			if len(ring) < 4 {
+				issues.TooFewPositions++
+				continue
+			}
+			if !samePosition(ring[0], ring[len(ring)-1]) {
+				issues.Unclosed++
+				ring = append(ring, ring[0])
+			}
+			if selfIntersecting(ring) {
+				issues.SelfIntersecting++
+			}
+		}
+	}
+	return issues, nil
+}
+
+// FixRings closes unclosed rings and reverses rings not following the right-hand rule of RFC 7946,
+// exterior rings counterclockwise and holes clockwise. The exterior ring is the first ring of a polygon.
+func FixRings(geometry json.RawMessage) (json.RawMessage, error) {
+	geometryType, polygons, err := polygons(geometry)
+	if err != nil {
+		return nil, err
+	}
+	for _, polygon := range polygons {
+		for i, ring := range polygon {
+			if len(ring) > 0 && !samePosition(ring[0], ring[len(ring)-1]) {
+				ring = append(ring, ring[0])
+			}
+			if counterclockwise := geo.SignedArea(ring) > 0; counterclockwise != (i == 0) {
+				for l, r := 0, len(ring)-1; l < r; l, r = l+1, r-1 {
+					ring[l], ring[r] = ring[r], ring[l]
+				}
+			}
+			polygon[i] = ring
+		}
+	}
+	return marshalPolygons(geometryType, polygons)
+}
+
+// SimplifyGeometry simplifies the rings of a Polygon or MultiPolygon with the Douglas-Peucker algorithm,
+// dropping positions closer than tolerance (in coordinate units, i.e. degrees) to the simplified ring.
+// Rings simplified below 4 positions are kept unchanged. Simplifying may introduce self-intersections.
+// Returns the simplified geometry and the number of positions before and after.
+func SimplifyGeometry(geometry json.RawMessage, tolerance float64) (json.RawMessage, int, int, error) {
+	geometryType, polygons, err := polygons(geometry)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	before, after := 0, 0
+	for _, polygon := range polygons {
+		for i, ring := range polygon {
+			before += len(ring)
+			if len(ring) >= 4 {
+				if simplified := simplifyRing(ring, tolerance); len(simplified) >= 4 {
+					polygon[i] = simplified
+				}
+			}
+			after += len(polygon[i])
+		}
+	}
+	simplified, err := marshalPolygons(geometryType, polygons)
+	return simplified, before, after, err
+}
+
+// simplifyRing splits the ring at the position farthest from its start, as the distance to the segment
+// from the first to the last position is undefined for closed rings, and simplifies both halves
+func simplifyRing(ring []position, tolerance float64) []position {
+	farthest, maxDistance := 0, -1.0
+	for i, p := range ring {
+		if d := math.Hypot(p[0]-ring[0][0], p[1]-ring[0][1]); d > maxDistance {
+			farthest, maxDistance = i, d
+		}
+	}
+	if farthest == 0 || farthest == len(ring)-1 {
+		return douglasPeucker(ring, tolerance)
+	}
+	first := douglasPeucker(ring[:farthest+1], tolerance)
+	second := douglasPeucker(ring[farthest:], tolerance)
+	return append(first[:len(first)-1:len(first)-1], second...)
+}
+
+// douglasPeucker keeps the first and last position and recursively the positions farther than tolerance from the simplified line
+func douglasPeucker(line []position, tolerance float64) []position {
+	if len(line) < 3 {
+		return line
+	}
+	index, maxDistance := 0, 0.0
+	for i := 1; i < len(line)-1; i++ {
+		if d := segmentDistance(line[i], line[0], line[len(line)-1]); d > maxDistance {
+			index, maxDistance = i, d
+		}
+	}
+	if maxDistance <= tolerance {
+		return []position{line[0], line[len(line)-1]}
+	}
+	left := douglasPeucker(line[:index+1], tolerance)
+	right := douglasPeucker(line[index:], tolerance)
+	return append(left[:len(left)-1:len(left)-1], right...)
+}
+
+// segmentDistance is the distance of p to the segment from a to b
+func segmentDistance(p, a, b position) float64 {
+	dx, dy := b[0]-a[0], b[1]-a[1]
+	if dx == 0 && dy == 0 {
+		return math.Hypot(p[0]-a[0], p[1]-a[1])
+	}
+	t := ((p[0]-a[0])*dx + (p[1]-a[1])*dy) / (dx*dx + dy*dy)
+	t = max(0, min(1, t))
+	return math.Hypot(p[0]-(a[0]+t*dx), p[1]-(a[1]+t*dy))
+}
+
+func marshalPolygons(geometryType string, polygons [][][]position) (json.RawMessage, error) {
+	var coordinates any = polygons
+	if geometryType == "Polygon" {
+		coordinates = polygons[0]
+	}
+	return json.Marshal(struct {
+		Type        string `json:"type"`
+		Coordinates any    `json:"coordinates"`
+	}{geometryType, coordinates})
+}
+
+func samePosition(a, b position) bool {
+	return a[0] == b[0] && a[1] == b[1]
+}
+
+// selfIntersecting reports whether two non-adjacent segments of the closed ring touch or cross.
+// Segments are swept by their minimum x, so only segments with overlapping x ranges are compared.
+func selfIntersecting(ring []position) bool {
+	// repeated positions are valid, but their zero-length segment would touch the following segment
+	deduplicated := ring[:1:1]
+	for _, p := range ring[1:] {
+		if !samePosition(p, deduplicated[len(deduplicated)-1]) {
+			deduplicated = append(deduplicated, p)
+		}
+	}
+	ring = deduplicated
+
+	n := len(ring) - 1 // number of segments, the last position repeats the first
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	minX := func(i int) float64 { return min(ring[i][0], ring[i+1][0]) }
+	maxX := func(i int) float64 { return max(ring[i][0], ring[i+1][0]) }
+	sort.Slice(order, func(a, b int) bool { return minX(order[a]) < minX(order[b]) })
+
+	for a := 0; a < n; a++ {
+		i := order[a]
+		for b := a + 1; b < n && minX(order[b]) <= maxX(i); b++ {
+			j := order[b]
+			if adjacent := j == (i+1)%n || i == (j+1)%n; adjacent {
+				continue
+			}
+			if segmentsIntersect(ring[i], ring[i+1], ring[j], ring[j+1]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func segmentsIntersect(p1, p2, q1, q2 position) bool {
+	d1 := orientation(q1, q2, p1)
+	d2 := orientation(q1, q2, p2)
+	d3 := orientation(p1, p2, q1)
+	d4 := orientation(p1, p2, q2)
+	if ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) && ((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0)) {
+		return true
+	}
+	return (d1 == 0 && onSegment(q1, q2, p1)) || (d2 == 0 && onSegment(q1, q2, p2)) ||
+		(d3 == 0 && onSegment(p1, p2, q1)) || (d4 == 0 && onSegment(p1, p2, q2))
+}
+
+// orientation is positive if c is left of the line from a to b, negative if right and 0 if collinear
+func orientation(a, b, c position) float64 {
+	return (b[0]-a[0])*(c[1]-a[1]) - (b[1]-a[1])*(c[0]-a[0])
+}
+
+// onSegment reports whether c, collinear with a and b, lies between them
+func onSegment(a, b, c position) bool {
+	return min(a[0], b[0]) <= c[0] && c[0] <= max(a[0], b[0]) && min(a[1], b[1]) <= c[1] && c[1] <= max(a[1], b[1])
+}
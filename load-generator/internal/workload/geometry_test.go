@@ -0,0 +1,234 @@
+package workload
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// rings of a counterclockwise square, a clockwise hole inside it and both in the other orientation
+const (
+	ccwSquare = "[[0,0],[10,0],[10,10],[0,10],[0,0]]"
+	cwSquare  = "[[0,0],[0,10],[10,10],[10,0],[0,0]]"
+	cwHole    = "[[2,2],[2,4],[4,4],[4,2],[2,2]]"
+	ccwHole   = "[[2,2],[4,2],[4,4],[2,4],[2,2]]"
+)
+
+func polygonJSON(rings ...string) json.RawMessage {
+	return json.RawMessage(`{"type":"Polygon","coordinates":[` + strings.Join(rings, ",") + `]}`)
+}
+
+func TestValidateGeometry(t *testing.T) {
+	tests := []struct {
+		name     string
+		geometry json.RawMessage
+		want     GeometryIssues
+		wantErr  string
+	}{
+		{name: "right-hand rule", geometry: polygonJSON(ccwSquare, cwHole)},
+		// accepted by PostGIS and CrateDB, reoriented by FixRings
+		{name: "clockwise exterior ring", geometry: polygonJSON(cwSquare, ccwHole)},
+		{name: "multipolygon", geometry: json.RawMessage(`{"type":"MultiPolygon","coordinates":[[` + ccwSquare + `],[` + cwSquare + `]]}`)},
+		{name: "unclosed", geometry: polygonJSON("[[0,0],[10,0],[10,10],[0,10]]"), want: GeometryIssues{Unclosed: 1}},
+		{name: "too few positions", geometry: polygonJSON("[[0,0],[10,0],[0,0]]", cwHole), want: GeometryIssues{TooFewPositions: 1}},
+		{name: "bowtie", geometry: polygonJSON("[[0,0],[10,10],[10,0],[0,10],[0,0]]"), want: GeometryIssues{SelfIntersecting: 1}},
+		{name: "unclosed bowtie", geometry: polygonJSON("[[0,0],[10,10],[10,0],[0,10]]"), want: GeometryIssues{Unclosed: 1, SelfIntersecting: 1}},
+		{name: "point", geometry: json.RawMessage(`{"type":"Point","coordinates":[1,2]}`), wantErr: "Unsupported geometry type"},
+		{name: "position without latitude", geometry: polygonJSON("[[0],[10,0],[10,10],[0,0]]"), wantErr: "Position with 1 coordinates"},
+		{name: "no JSON", geometry: json.RawMessage(`{`), wantErr: "Parsing geometry"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ValidateGeometry(tt.geometry)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ValidateGeometry error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ValidateGeometry = %+v, %v, want %+v", got, err, tt.want)
+			}
+			if got.Valid() != (tt.want == GeometryIssues{}) {
+				t.Errorf("Valid() = %v for %+v", got.Valid(), got)
+			}
+		})
+	}
+}
+
+func TestFixRings(t *testing.T) {
+	tests := []struct {
+		name     string
+		geometry json.RawMessage
+		want     string
+	}{
+		{"right-hand rule unchanged", polygonJSON(ccwSquare, cwHole), `{"type":"Polygon","coordinates":[` + ccwSquare + `,` + cwHole + `]}`},
+		{"reoriented", polygonJSON(cwSquare, ccwHole), `{"type":"Polygon","coordinates":[[[0,0],[10,0],[10,10],[0,10],[0,0]],[[2,2],[2,4],[4,4],[4,2],[2,2]]]}`},
+		{"closed", polygonJSON("[[0,0],[10,0],[10,10],[0,10]]"), `{"type":"Polygon","coordinates":[` + ccwSquare + `]}`},
+		{"multipolygon", json.RawMessage(`{"type":"MultiPolygon","coordinates":[[` + cwSquare + `]]}`), `{"type":"MultiPolygon","coordinates":[[` + ccwSquare + `]]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FixRings(tt.geometry)
+			if err != nil {
+				t.Fatalf("FixRings failed: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("FixRings =\n%s\nwant\n%s", got, tt.want)
+			}
+			if issues, err := ValidateGeometry(got); err != nil || !issues.Valid() {
+				t.Errorf("fixed geometry has issues %v, %v", issues, err)
+			}
+		})
+	}
+}
+
+func TestSelfIntersecting(t *testing.T) {
+	tests := []struct {
+		name string
+		ring string
+		want bool
+	}{
+		{"square", ccwSquare, false},
+		{"repeated positions", "[[0,0],[10,0],[10,0],[10,10],[0,10],[0,0],[0,0]]", false},
+		{"concave", "[[0,0],[10,0],[5,5],[10,10],[0,10],[0,0]]", false},
+		{"bowtie", "[[0,0],[10,10],[10,0],[0,10],[0,0]]", true},
+		{"touching vertex", "[[0,0],[10,0],[5,5],[10,10],[0,10],[5,5],[0,0]]", true},
+		{"collinear overlap", "[[0,0],[10,0],[10,5],[5,0],[5,-5],[0,-5],[0,0]]", true},
+		{"spike back along its segment", "[[0,0],[10,0],[10,10],[10,5],[0,5],[0,0]]", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ring []position
+			if err := json.Unmarshal([]byte(tt.ring), &ring); err != nil {
+				t.Fatal(err)
+			}
+			if got := selfIntersecting(ring); got != tt.want {
+				t.Errorf("selfIntersecting(%s) = %v, want %v", tt.ring, got, tt.want)
+			}
+			// the result doesn't depend on the starting position of the ring
+			rotated := append(append([]position{}, ring[1:]...), ring[1])
+			if got := selfIntersecting(rotated); got != tt.want {
+				t.Errorf("selfIntersecting of the rotated ring = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// noisySquare is ccwSquare with a position 0.1 off its bottom edge
+const noisySquare = "[[0,0],[5,0.1],[10,0],[10,10],[0,10],[0,0]]"
+
+func parseRing(t *testing.T, ring string) []position {
+	t.Helper()
+	var positions []position
+	if err := json.Unmarshal([]byte(ring), &positions); err != nil {
+		t.Fatal(err)
+	}
+	return positions
+}
+
+func TestSimplifyGeometry(t *testing.T) {
+	tests := []struct {
+		name       string
+		geometry   json.RawMessage
+		tolerance  float64
+		want       string
+		wantBefore int
+		wantAfter  int
+		wantErr    string
+	}{
+		{name: "position within tolerance", geometry: polygonJSON(noisySquare), tolerance: 0.5,
+			want: `{"type":"Polygon","coordinates":[` + ccwSquare + `]}`, wantBefore: 6, wantAfter: 5},
+		{name: "position beyond tolerance", geometry: polygonJSON(noisySquare), tolerance: 0.05,
+			want: `{"type":"Polygon","coordinates":[` + noisySquare + `]}`, wantBefore: 6, wantAfter: 6},
+		{name: "hole", geometry: polygonJSON(noisySquare, cwHole), tolerance: 0.5,
+			want: `{"type":"Polygon","coordinates":[` + ccwSquare + `,` + cwHole + `]}`, wantBefore: 11, wantAfter: 10},
+		// simplifying would leave 3 positions, so the ring is kept
+		{name: "ring below minimum positions", geometry: polygonJSON("[[0,0],[10,0.1],[20,0],[0,0]]"), tolerance: 1,
+			want: `{"type":"Polygon","coordinates":[[[0,0],[10,0.1],[20,0],[0,0]]]}`, wantBefore: 4, wantAfter: 4},
+		{name: "collapsing ring", geometry: polygonJSON("[[0,0],[10,0.1],[20,0],[10,-0.1],[0,0]]"), tolerance: 1,
+			want: `{"type":"Polygon","coordinates":[[[0,0],[10,0.1],[20,0],[10,-0.1],[0,0]]]}`, wantBefore: 5, wantAfter: 5},
+		{name: "multipolygon", geometry: json.RawMessage(`{"type":"MultiPolygon","coordinates":[[` + noisySquare + `],[` + cwHole + `]]}`), tolerance: 0.5,
+			want: `{"type":"MultiPolygon","coordinates":[[` + ccwSquare + `],[` + cwHole + `]]}`, wantBefore: 11, wantAfter: 10},
+		{name: "point", geometry: json.RawMessage(`{"type":"Point","coordinates":[1,2]}`), wantErr: "Unsupported geometry type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, before, after, err := SimplifyGeometry(tt.geometry, tt.tolerance)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("SimplifyGeometry error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SimplifyGeometry failed: %v", err)
+			}
+			if string(got) != tt.want || before != tt.wantBefore || after != tt.wantAfter {
+				t.Errorf("SimplifyGeometry = %s, %d, %d, want %s, %d, %d", got, before, after, tt.want, tt.wantBefore, tt.wantAfter)
+			}
+		})
+	}
+}
+
+func TestSimplifyRing(t *testing.T) {
+	tests := []struct {
+		name      string
+		ring      string
+		tolerance float64
+		want      string
+	}{
+		{"square unchanged", ccwSquare, 0, ccwSquare},
+		{"collinear positions", "[[0,0],[5,0],[10,0],[10,5],[10,10],[0,10],[0,0]]", 0, ccwSquare},
+		{"position within tolerance", noisySquare, 0.5, ccwSquare},
+		// the farthest position from the start is the split, the positions around it are simplified separately
+		{"position next to the split", "[[0,0],[10,0],[10,9.9],[10,10],[0,10],[0,0]]", 0.5, ccwSquare},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ring := parseRing(t, tt.ring)
+			got := simplifyRing(ring, tt.tolerance)
+			if want := parseRing(t, tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("simplifyRing = %v, want %v", got, want)
+			}
+			if !samePosition(got[0], got[len(got)-1]) {
+				t.Errorf("simplifyRing = %v isn't closed", got)
+			}
+		})
+	}
+}
+
+func TestDouglasPeucker(t *testing.T) {
+	tests := []struct {
+		name      string
+		line      string
+		tolerance float64
+		want      string
+	}{
+		{"two positions", "[[0,0],[1,1]]", 1, "[[0,0],[1,1]]"},
+		{"collinear", "[[0,0],[1,0],[2,0]]", 0, "[[0,0],[2,0]]"},
+		{"beyond tolerance", "[[0,0],[1,1],[2,0]]", 0.5, "[[0,0],[1,1],[2,0]]"},
+		// a distance equal to the tolerance is dropped
+		{"at tolerance", "[[0,0],[1,1],[2,0]]", 1, "[[0,0],[2,0]]"},
+		{"recursive", "[[0,0],[1,0.9],[2,2],[3,0.9],[4,0]]", 0.5, "[[0,0],[2,2],[4,0]]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := douglasPeucker(parseRing(t, tt.line), tt.tolerance)
+			if want := parseRing(t, tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("douglasPeucker = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestGeometryIssuesString(t *testing.T) {
+	issues := GeometryIssues{TooFewPositions: 1, SelfIntersecting: 2}
+	if got, want := issues.String(), "1 rings too few positions, 2 rings self-intersecting"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if (GeometryIssues{}).String() != "valid" {
+		t.Errorf("String() of no issues = %q, want valid", GeometryIssues{}.String())
+	}
+}
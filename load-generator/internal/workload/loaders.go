@@ -0,0 +1,532 @@
+package workload
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"load-generator/internal/parquet"
+)
+
+// OpenInput opens the input files the loaders read, replaced to read URLs as well
+var OpenInput = func(path string) (io.ReadCloser, error) {
+	return os.Open(path)
+}
+
+// LoadPOIs reads a CSV with the columns poi_id, name, category, longitude and latitude
+// or a GeoParquet file with the columns poi_id, name, category and a point geometry
+func LoadPOIs(path string) ([]POI, error) {
+	if isParquet(path) {
+		return loadParquetPOIs(path)
+	}
+	f, err := OpenInput(path)
+	if err != nil {
+		return nil, fmt.Errorf("Opening POIs file: %w", err)
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	// read header
+	if _, err := r.Read(); err != nil {
+		return nil, fmt.Errorf("Reading POIs header: %w", err)
+	}
+	var pois []POI
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("Reading POIs record: %w", err)
+		}
+
+		var p POI
+		p.POIID = rec[0]
+		p.Name = rec[1]
+		p.Category = rec[2]
+		p.Longitude = rec[3]
+		p.Latitude = rec[4]
+
+		pois = append(pois, p)
+	}
+	return pois, nil
+}
+
+func isParquet(path string) bool {
+	return inputExt(path) == ".parquet" || inputExt(path) == ".geoparquet"
+}
+
+// inputExt returns the lowercase extension of a path or URL
+func inputExt(path string) string {
+	path, _, _ = strings.Cut(path, "?")
+	return strings.ToLower(filepath.Ext(path))
+}
+
+func readParquet(path, kind string) (*parquet.File, error) {
+	f, err := OpenInput(path)
+	if err != nil {
+		return nil, fmt.Errorf("Reading %s GeoParquet: %w", kind, err)
+	}
+	b, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("Reading %s GeoParquet: %w", kind, err)
+	}
+	pf, err := parquet.Read(b)
+	if err != nil {
+		return nil, fmt.Errorf("Parsing %s GeoParquet: %w", kind, err)
+	}
+	return pf, nil
+}
+
+// parquetStrings returns the values of a string column, an error for missing columns or null values
+func parquetStrings(pf *parquet.File, path, column string) ([]string, error) {
+	values, ok := pf.Values[column]
+	if !ok {
+		return nil, fmt.Errorf("%s has no column %s", path, column)
+	}
+	strs := make([]string, len(values))
+	for i, v := range values {
+		switch v := v.(type) {
+		case []byte:
+			strs[i] = string(v)
+		case int32, int64:
+			strs[i] = fmt.Sprint(v)
+		default:
+			return nil, fmt.Errorf("Row %d of %s has no %s", i, path, column)
+		}
+	}
+	return strs, nil
+}
+
+func loadParquetPOIs(path string) ([]POI, error) {
+	pf, err := readParquet(path, "POIs")
+	if err != nil {
+		return nil, err
+	}
+	var columns [3][]string
+	for i, column := range []string{"poi_id", "name", "category"} {
+		if columns[i], err = parquetStrings(pf, path, column); err != nil {
+			return nil, err
+		}
+	}
+	geometryColumn, err := pf.GeometryColumn()
+	if err != nil {
+		return nil, err
+	}
+	lons, lats := pf.Values["longitude"], pf.Values["latitude"]
+	geometries, hasGeometry := pf.Values[geometryColumn]
+	if !hasGeometry && (lons == nil || lats == nil) {
+		return nil, fmt.Errorf("%s has neither a %s column nor longitude and latitude columns", path, geometryColumn)
+	}
+	pois := make([]POI, pf.NumRows)
+	for i := range pois {
+		pois[i] = POI{POIID: columns[0][i], Name: columns[1][i], Category: columns[2][i]}
+		if hasGeometry {
+			wkb, _ := geometries[i].([]byte)
+			var point struct {
+				Type        string     `json:"type"`
+				Coordinates [2]float64 `json:"coordinates"`
+			}
+			geometry, err := parquet.WKBToGeoJSON(wkb)
+			if err == nil {
+				err = json.Unmarshal(geometry, &point)
+			}
+			if err != nil || point.Type != "Point" {
+				return nil, fmt.Errorf("Row %d of %s has no point geometry: %v", i, path, err)
+			}
+			pois[i].Longitude = strconv.FormatFloat(point.Coordinates[0], 'f', -1, 64)
+			pois[i].Latitude = strconv.FormatFloat(point.Coordinates[1], 'f', -1, 64)
+			continue
+		}
+		lon, ok1 := lons[i].(float64)
+		lat, ok2 := lats[i].(float64)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("Row %d of %s has no longitude or latitude", i, path)
+		}
+		pois[i].Longitude = strconv.FormatFloat(lon, 'f', -1, 64)
+		pois[i].Latitude = strconv.FormatFloat(lat, 'f', -1, 64)
+	}
+	return pois, nil
+}
+
+func loadParquetFeatures(path, kind string, fields FeatureFields) ([]namedFeature, error) {
+	pf, err := readParquet(path, kind)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := parquetStrings(pf, path, fields.ID)
+	if err != nil {
+		return nil, err
+	}
+	names, err := parquetStrings(pf, path, fields.Name)
+	if err != nil {
+		return nil, err
+	}
+	geometryColumn, err := pf.GeometryColumn()
+	if err != nil {
+		return nil, err
+	}
+	geometries, ok := pf.Values[geometryColumn]
+	if !ok {
+		return nil, fmt.Errorf("%s has no geometry column %s", path, geometryColumn)
+	}
+	features := make([]namedFeature, pf.NumRows)
+	for i := range features {
+		wkb, _ := geometries[i].([]byte)
+		geometry, err := parquet.WKBToGeoJSON(wkb)
+		if err != nil {
+			return nil, fmt.Errorf("Row %d of %s: %w", i, path, err)
+		}
+		features[i] = namedFeature{id: ids[i], name: names[i], geometry: geometry}
+	}
+	return features, nil
+}
+
+// LoadWeatherObservations reads a CSV with the columns observed_at (RFC3339), temperature_c, precipitation_mm and wind_speed_ms
+func LoadWeatherObservations(path string) ([]WeatherObservation, error) {
+	f, err := OpenInput(path)
+	if err != nil {
+		return nil, fmt.Errorf("Opening weather observations file: %w", err)
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = 4
+	// read header
+	if _, err := r.Read(); err != nil {
+		return nil, fmt.Errorf("Reading weather observations header: %w", err)
+	}
+	var observations []WeatherObservation
+	for line := 2; ; line++ {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("Reading weather observations record: %w", err)
+		}
+
+		var o WeatherObservation
+		if o.ObservedAt, err = ParseTimestamp(rec[0]); err != nil {
+			return nil, fmt.Errorf("Line %d of %s: %w", line, path, err)
+		}
+		values := []*float64{&o.TemperatureC, &o.PrecipitationMm, &o.WindSpeedMs}
+		for i, value := range values {
+			if *value, err = strconv.ParseFloat(rec[i+1], 64); err != nil {
+				return nil, fmt.Errorf("Line %d of %s: %w", line, path, err)
+			}
+		}
+		observations = append(observations, o)
+	}
+	return observations, nil
+}
+
+// LoadTemplates parses the query templates defined in the file, the template of the file itself is left out.
+// References to fields QueryFields doesn't have are returned as *TemplateLintError. The templates can call QueryTemplateFuncs.
+func LoadTemplates(templatesFilepath string) (*template.Template, error) {
+	allTemplates, err := template.New(filepath.Base(templatesFilepath)).Funcs(QueryTemplateFuncs).ParseFiles(templatesFilepath)
+	if err != nil {
+		return nil, err
+	}
+	// linted before re-parsing, so the lines are the ones of the file
+	if issues := LintTemplates(allTemplates); len(issues) > 0 {
+		return nil, &TemplateLintError{Filename: templatesFilepath, Issues: issues}
+	}
+
+	// filter out the tempate with the file name
+	queryTemplates := template.New("").Funcs(QueryTemplateFuncs).Option("missingkey=error")
+	for _, tmpl := range allTemplates.Templates() {
+		if tmpl.Name() == filepath.Base(templatesFilepath) {
+			continue
+		}
+		// Re-parse the content of each template into the new set
+		if _, err := queryTemplates.New(tmpl.Name()).Parse(tmpl.Root.String()); err != nil {
+			return nil, fmt.Errorf("Parsing template %s: %w", tmpl.Name(), err)
+		}
+	}
+	return queryTemplates, nil
+}
+
+// TemplateNames returns the sorted names of the query templates.
+// The order of Templates() is random, the queries of a seed are only identical across runs with a fixed order.
+func TemplateNames(templates *template.Template) []string {
+	names := make([]string, 0, len(templates.Templates()))
+	for _, tmpl := range templates.Templates() {
+		names = append(names, tmpl.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ReadTripIDs returns the trip IDs of a trip events CSV, the events are expected to be grouped by trip
+func ReadTripIDs(ctx context.Context, tripEventsCSV string) ([]string, error) {
+	return SampleTripIDs(ctx, tripEventsCSV, 0, 0)
+}
+
+// SampleTripIDs returns a uniform random sample of sampleSize trip IDs of a trip events CSV with reservoir sampling,
+// holding at most sampleSize IDs in memory. The sample only depends on the file and the seed, sampleSize 0 returns all trip IDs.
+// The events are expected to be grouped by trip.
+func SampleTripIDs(ctx context.Context, tripEventsCSV string, sampleSize int, seed int64) ([]string, error) {
+	r, err := OpenTripEvents(tripEventsCSV)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	rng := rand.New(rand.NewSource(seed))
+	tripIds := make([]string, 0, sampleSize)
+	lastTripId := "" // used to pass only unique values
+	trips := 0
+	for ctx.Err() == nil {
+		event, err := r.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if event.TripID == lastTripId {
+			continue
+		}
+		lastTripId = event.TripID
+		trips++
+
+		// the n-th trip replaces a sampled one with probability sampleSize/n
+		if sampleSize <= 0 || len(tripIds) < sampleSize {
+			tripIds = append(tripIds, event.TripID)
+		} else if i := rng.Intn(trips); i < sampleSize {
+			tripIds[i] = event.TripID
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return tripIds, nil
+}
+
+// ReadTripEventCounts returns the number of events of every trip of a trip events CSV
+func ReadTripEventCounts(ctx context.Context, tripEventsCSV string) (map[string]int64, error) {
+	r, err := OpenTripEvents(tripEventsCSV)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	counts := make(map[string]int64)
+	for ctx.Err() == nil {
+		event, err := r.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		counts[event.TripID]++
+	}
+	return counts, ctx.Err()
+}
+
+// ReadTimeRange returns the earliest and latest event timestamp of a trip events CSV
+func ReadTimeRange(ctx context.Context, tripEventsCSV string) (time.Time, time.Time, error) {
+	r, err := OpenTripEvents(tripEventsCSV)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	defer r.Close()
+
+	var first, last time.Time
+	for ctx.Err() == nil {
+		event, err := r.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+
+		timestamp, err := ParseTimestamp(event.Timestamp)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("Parsing timestamp of event %s: %w", event.EventID, err)
+		}
+		if first.IsZero() || timestamp.Before(first) {
+			first = timestamp
+		}
+		if timestamp.After(last) {
+			last = timestamp
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if first.IsZero() {
+		return time.Time{}, time.Time{}, fmt.Errorf("No trip events in %s", tripEventsCSV)
+	}
+	return first, last, nil
+}
+
+// TripEventSource yields trip events until io.EOF, e.g. a TripEventReader
+type TripEventSource interface {
+	Next() (TripEvent, error)
+	Close() error
+}
+
+// ParseTripEventMessage decodes a trip event encoded as JSON object with the CSV column names as keys,
+// coordinates as numbers or strings, or as CSV line in the column order of the trip events file
+func ParseTripEventMessage(b []byte) (TripEvent, error) {
+	b = bytes.TrimSpace(b)
+	if bytes.HasPrefix(b, []byte("{")) {
+		var msg struct {
+			EventID   string      `json:"event_id"`
+			TripID    string      `json:"trip_id"`
+			Timestamp string      `json:"timestamp"`
+			Latitude  json.Number `json:"latitude"`
+			Longitude json.Number `json:"longitude"`
+		}
+		if err := json.Unmarshal(b, &msg); err != nil {
+			return TripEvent{}, fmt.Errorf("Decoding JSON trip event: %w", err)
+		}
+		if msg.EventID == "" || msg.TripID == "" || msg.Timestamp == "" {
+			return TripEvent{}, fmt.Errorf("JSON trip event without event_id, trip_id or timestamp: %s", b)
+		}
+		return normalizeEventTimestamp(TripEvent{EventID: msg.EventID, TripID: msg.TripID, Timestamp: msg.Timestamp, Latitude: msg.Latitude.String(), Longitude: msg.Longitude.String()}), nil
+	}
+	rec, err := csv.NewReader(bytes.NewReader(b)).Read()
+	if err != nil {
+		return TripEvent{}, fmt.Errorf("Decoding CSV trip event: %w", err)
+	}
+	if len(rec) != 5 {
+		return TripEvent{}, fmt.Errorf("CSV trip event with %d columns, expected event_id,trip_id,timestamp,latitude,longitude", len(rec))
+	}
+	return normalizeEventTimestamp(TripEvent{EventID: rec[0], TripID: rec[1], Timestamp: rec[2], Latitude: rec[3], Longitude: rec[4]}), nil
+}
+
+// normalizeEventTimestamp returns the event with its timestamp as RFC3339 in UTC,
+// unparseable timestamps are passed through and fail their insert or are returned as BadRowError by a strict reader
+func normalizeEventTimestamp(event TripEvent) TripEvent {
+	if timestamp, err := NormalizeTimestamp(event.Timestamp); err == nil {
+		event.Timestamp = timestamp
+	}
+	return event
+}
+
+// TripEventReader reads the trip events CSV produced by the escooter-trips-generator
+type TripEventReader struct {
+	file       io.ReadCloser
+	r          *csv.Reader
+	attributes []EventAttribute
+	columns    []int // columns of the attributes
+	numColumns int   // of the header, every row needs as many
+	header     []string
+	strict     bool
+}
+
+func OpenTripEvents(filename string) (*TripEventReader, error) {
+	return OpenTripEventsWithAttributes(filename, nil)
+}
+
+// OpenTripEventsWithAttributes reads the trip events with the values of the attributes from the columns named by their sources
+func OpenTripEventsWithAttributes(filename string, attributes []EventAttribute) (*TripEventReader, error) {
+	f, err := OpenInput(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Opening trip events file: %w", err)
+	}
+	r := csv.NewReader(f)
+	// rows with another number of fields than the header are returned as BadRowError
+	r.FieldsPerRecord = -1
+
+	// read header of csv
+	header, err := r.Read()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("Reading trip events header of %s: %w", filename, err)
+	}
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		index[strings.TrimSpace(name)] = i
+	}
+	columns := make([]int, len(attributes))
+	for i, a := range attributes {
+		c, ok := index[a.Source]
+		if !ok {
+			f.Close()
+			return nil, fmt.Errorf("Trip events file %s has no column %s of the event attribute %s", filename, a.Source, a.Column)
+		}
+		columns[i] = c
+	}
+	if len(header) < 5 {
+		f.Close()
+		return nil, fmt.Errorf("Trip events file %s has %d columns, expected event_id,trip_id,timestamp,latitude,longitude", filename, len(header))
+	}
+	return &TripEventReader{file: f, r: r, attributes: attributes, columns: columns, numColumns: len(header), header: header}, nil
+}
+
+// KeepColumns makes Next return the values of all columns after the five base columns as Attributes,
+// instead of those of the attributes the reader was opened with, so tools writing trip events copy them.
+// Returns the header of the file.
+func (r *TripEventReader) KeepColumns() []string {
+	extra := r.header[5:]
+	r.attributes = make([]EventAttribute, len(extra))
+	r.columns = make([]int, len(extra))
+	for i, name := range extra {
+		r.attributes[i] = EventAttribute{Column: name, Source: name, Type: AttributeText}
+		r.columns[i] = 5 + i
+	}
+	return r.header
+}
+
+// Strict makes Next also return the rows with empty IDs, unparseable timestamps or coordinates out of range as BadRowError,
+// instead of leaving them to fail their insert
+func (r *TripEventReader) Strict() {
+	r.strict = true
+}
+
+// Next returns the next trip event, or io.EOF after the last one.
+// Malformed rows are returned as *BadRowError, the next call continues after them.
+func (r *TripEventReader) Next() (TripEvent, error) {
+	rec, err := r.r.Read()
+	var parseErr *csv.ParseError
+	if err == io.EOF {
+		return TripEvent{}, err
+	} else if errors.As(err, &parseErr) {
+		return TripEvent{}, &BadRowError{Line: parseErr.Line, Reason: parseErr.Err.Error()}
+	} else if err != nil {
+		return TripEvent{}, fmt.Errorf("Reading trip events: %w", err)
+	}
+	line, _ := r.r.FieldPos(0)
+	if len(rec) != r.numColumns {
+		return TripEvent{}, &BadRowError{Line: line, Reason: fmt.Sprintf("%d columns, expected %d", len(rec), r.numColumns), Record: rec}
+	}
+	event := TripEvent{
+		EventID:   rec[0],
+		TripID:    rec[1],
+		Timestamp: rec[2],
+		Latitude:  rec[3],
+		Longitude: rec[4],
+	}
+	if len(r.attributes) > 0 {
+		event.Attributes = make([]string, len(r.attributes))
+		for i, a := range r.attributes {
+			event.Attributes[i] = rec[r.columns[i]]
+			if err := parseAttribute(a, event.Attributes[i]); err != nil {
+				return TripEvent{}, &BadRowError{Line: line, Reason: err.Error(), Record: rec}
+			}
+		}
+	}
+	event = normalizeEventTimestamp(event)
+	if r.strict {
+		if reason := validateTripEvent(event); reason != "" {
+			return TripEvent{}, &BadRowError{Line: line, Reason: reason, Record: rec}
+		}
+	}
+	return event, nil
+}
+
+func (r *TripEventReader) Close() error {
+	return r.file.Close()
+}
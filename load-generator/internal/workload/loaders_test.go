@@ -0,0 +1,82 @@
+package workload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// writeTrips writes a trip events CSV of trips trips t0, t1, ... with two events each
+func writeTrips(t *testing.T, trips int) string {
+	t.Helper()
+	rows := [][]string{wideHeader[:5]}
+	for i := range trips {
+		tripID := fmt.Sprintf("t%d", i)
+		rows = append(rows,
+			[]string{tripID + "-e1", tripID, "2024-01-01T00:00:00Z", "52.5", "13.4"},
+			[]string{tripID + "-e2", tripID, "2024-01-01T00:00:10Z", "52.6", "13.4"},
+		)
+	}
+	return writeTripEvents(t, rows...)
+}
+
+func TestSampleTripIDs(t *testing.T) {
+	trips := writeTrips(t, 100)
+	tests := []struct {
+		name       string
+		sampleSize int
+		wantSize   int
+	}{
+		{"sample", 10, 10},
+		{"sample of all trips", 100, 100},
+		{"sample larger than the trips", 1000, 100},
+		{"no sample", 0, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SampleTripIDs(context.Background(), trips, tt.sampleSize, 42)
+			if err != nil {
+				t.Fatalf("SampleTripIDs failed: %v", err)
+			}
+			if len(got) != tt.wantSize {
+				t.Errorf("SampleTripIDs returned %d trip IDs, want %d", len(got), tt.wantSize)
+			}
+			sorted := slices.Sorted(slices.Values(got))
+			if len(slices.Compact(sorted)) != len(got) {
+				t.Errorf("SampleTripIDs returned duplicate trip IDs %v", got)
+			}
+
+			again, err := SampleTripIDs(context.Background(), trips, tt.sampleSize, 42)
+			if err != nil || !reflect.DeepEqual(again, got) {
+				t.Errorf("SampleTripIDs with the same seed = %v, %v, want %v", again, err, got)
+			}
+		})
+	}
+}
+
+func TestSampleTripIDsSeed(t *testing.T) {
+	trips := writeTrips(t, 100)
+	first, err := SampleTripIDs(context.Background(), trips, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := SampleTripIDs(context.Background(), trips, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reflect.DeepEqual(first, second) {
+		t.Errorf("SampleTripIDs returned the same sample %v for different seeds", first)
+	}
+}
+
+func TestSampleTripIDsCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	got, err := SampleTripIDs(ctx, writeTrips(t, 10), 5, 42)
+	if !errors.Is(err, context.Canceled) || got != nil {
+		t.Errorf("SampleTripIDs of a canceled context = %v, %v, want nil, %v", got, err, context.Canceled)
+	}
+}
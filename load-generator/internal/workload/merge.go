@@ -0,0 +1,183 @@
+package workload
+
+import (
+	"container/heap"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timedEvent is a trip event with its parsed timestamp, seq keeps the input order of events with equal timestamps
+type timedEvent struct {
+	event     TripEvent
+	timestamp time.Time
+	seq       int
+}
+
+// MergeByTimestamp writes the trip events of all inputs ordered by timestamp, events with equal timestamps
+// keep their input order. It sorts chunks of at most chunkEvents events in memory into temporary runs in tmpDir,
+// which are then merged, so the inputs may be larger than the memory. Additional columns, e.g. event attributes, are copied,
+// all inputs need the same header. Returns the number of events and runs.
+func MergeByTimestamp(ctx context.Context, inputs []string, w io.Writer, chunkEvents int, tmpDir string) (int, int, error) {
+	if chunkEvents < 1 {
+		return 0, 0, fmt.Errorf("Chunk size %d, expected at least 1 event", chunkEvents)
+	}
+	runDir, err := os.MkdirTemp(tmpDir, "merge-dataset-")
+	if err != nil {
+		return 0, 0, fmt.Errorf("Creating directory of the sorted runs: %w", err)
+	}
+	defer os.RemoveAll(runDir)
+
+	var runs []string
+	chunk := make([]timedEvent, 0, min(chunkEvents, 1<<20))
+	seq := 0
+	flush := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		slices.SortStableFunc(chunk, func(a, b timedEvent) int { return a.timestamp.Compare(b.timestamp) })
+		filename := path.Join(runDir, fmt.Sprintf("run-%06d.csv", len(runs)))
+		if err := writeRun(filename, chunk); err != nil {
+			return err
+		}
+		runs = append(runs, filename)
+		chunk = chunk[:0]
+		return nil
+	}
+	var header []string
+	for _, input := range inputs {
+		inputHeader, err := eachTripEvent(ctx, input, func(event TripEvent, _ bool) error {
+			timestamp, err := ParseTimestamp(event.Timestamp)
+			if err != nil {
+				return fmt.Errorf("Parsing timestamp of event %s in %s: %w", event.EventID, input, err)
+			}
+			chunk = append(chunk, timedEvent{event, timestamp, seq})
+			seq++
+			if len(chunk) == chunkEvents {
+				return flush()
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, len(runs), err
+		}
+		if header == nil {
+			header = inputHeader
+		} else if !slices.Equal(inputHeader, header) {
+			return 0, len(runs), fmt.Errorf("%s has the columns %s, the first input %s", input, strings.Join(inputHeader, ","), strings.Join(header, ","))
+		}
+	}
+	if err := flush(); err != nil {
+		return 0, len(runs), err
+	}
+
+	events, err := mergeRuns(ctx, runs, header, w)
+	return events, len(runs), err
+}
+
+// writeRun writes a sorted chunk including the sequence numbers after the base columns, so equal timestamps stay in input order across runs
+func writeRun(filename string, chunk []timedEvent) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("Creating sorted run: %w", err)
+	}
+	defer f.Close()
+	cw := csv.NewWriter(f)
+	for _, e := range chunk {
+		cw.Write(append([]string{e.event.EventID, e.event.TripID, e.event.Timestamp, e.event.Latitude, e.event.Longitude, strconv.Itoa(e.seq)}, e.event.Attributes...))
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("Writing sorted run: %w", err)
+	}
+	return f.Close()
+}
+
+type runReader struct {
+	r       *csv.Reader
+	current timedEvent
+}
+
+func (r *runReader) next() error {
+	rec, err := r.r.Read()
+	if err != nil {
+		return err
+	}
+	r.current.event = TripEvent{EventID: rec[0], TripID: rec[1], Timestamp: rec[2], Latitude: rec[3], Longitude: rec[4], Attributes: rec[6:]}
+	if r.current.timestamp, err = ParseTimestamp(rec[2]); err != nil {
+		return err
+	}
+	r.current.seq, err = strconv.Atoi(rec[5])
+	return err
+}
+
+type runHeap []*runReader
+
+func (h runHeap) Len() int { return len(h) }
+func (h runHeap) Less(i, j int) bool {
+	if c := h[i].current.timestamp.Compare(h[j].current.timestamp); c != 0 {
+		return c < 0
+	}
+	return h[i].current.seq < h[j].current.seq
+}
+func (h runHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x any)   { *h = append(*h, x.(*runReader)) }
+func (h *runHeap) Pop() any {
+	old := *h
+	r := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return r
+}
+
+// mergeRuns k-way merges the sorted runs into w, a trip events CSV with the header
+func mergeRuns(ctx context.Context, runs []string, header []string, w io.Writer) (int, error) {
+	h := &runHeap{}
+	for _, run := range runs {
+		f, err := os.Open(run)
+		if err != nil {
+			return 0, fmt.Errorf("Opening sorted run: %w", err)
+		}
+		defer f.Close()
+		r := &runReader{r: csv.NewReader(f)}
+		if err := r.next(); err == io.EOF {
+			continue
+		} else if err != nil {
+			return 0, fmt.Errorf("Reading sorted run %s: %w", run, err)
+		}
+		*h = append(*h, r)
+	}
+	heap.Init(h)
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return 0, err
+	}
+	events := 0
+	for h.Len() > 0 {
+		if err := ctx.Err(); err != nil {
+			return events, err
+		}
+		r := (*h)[0]
+		e := r.current.event
+		if err := cw.Write(eventRecord(e)); err != nil {
+			return events, err
+		}
+		events++
+		if err := r.next(); err == io.EOF {
+			heap.Pop(h)
+		} else if err != nil {
+			return events, fmt.Errorf("Reading sorted run: %w", err)
+		} else {
+			heap.Fix(h, 0)
+		}
+	}
+	cw.Flush()
+	return events, cw.Error()
+}
@@ -0,0 +1,71 @@
+package workload
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// wideHeader is the header of a trip events file with the additional columns of event attributes
+var wideHeader = []string{"event_id", "trip_id", "timestamp", "latitude", "longitude", "battery", "vehicle_type"}
+
+// writeTripEvents writes the rows as trip events CSV to a temporary file
+func writeTripEvents(t *testing.T, rows ...[]string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "trips.csv")
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	w.WriteAll(rows)
+	if err := os.WriteFile(filename, b.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func readCSV(t *testing.T, s string) [][]string {
+	t.Helper()
+	rows, err := csv.NewReader(strings.NewReader(s)).ReadAll()
+	if err != nil {
+		t.Fatalf("reading output: %v", err)
+	}
+	return rows
+}
+
+func TestMergeByTimestampKeepsColumns(t *testing.T) {
+	first := writeTripEvents(t, wideHeader,
+		[]string{"e1", "t1", "2024-01-01T00:00:00Z", "52.5", "13.4", "90", "scooter"},
+		[]string{"e2", "t1", "2024-01-01T00:00:20Z", "52.6", "13.4", "", "scooter"},
+	)
+	second := writeTripEvents(t, wideHeader,
+		[]string{"e3", "t2", "2024-01-01T00:00:10Z", "52.5", "13.5", "40", "bike"},
+	)
+	var out strings.Builder
+	// one event per run, so the columns also pass through the sorted runs
+	events, _, err := MergeByTimestamp(context.Background(), []string{first, second}, &out, 1, t.TempDir())
+	if err != nil {
+		t.Fatalf("MergeByTimestamp failed: %v", err)
+	}
+	want := [][]string{
+		wideHeader,
+		{"e1", "t1", "2024-01-01T00:00:00Z", "52.5", "13.4", "90", "scooter"},
+		{"e3", "t2", "2024-01-01T00:00:10Z", "52.5", "13.5", "40", "bike"},
+		{"e2", "t1", "2024-01-01T00:00:20Z", "52.6", "13.4", "", "scooter"},
+	}
+	if got := readCSV(t, out.String()); events != 3 || !reflect.DeepEqual(got, want) {
+		t.Errorf("merged %d events\n%v\nwant 3\n%v", events, got, want)
+	}
+}
+
+func TestMergeByTimestampDifferentColumns(t *testing.T) {
+	wide := writeTripEvents(t, wideHeader, []string{"e1", "t1", "2024-01-01T00:00:00Z", "52.5", "13.4", "90", "scooter"})
+	base := writeTripEvents(t, wideHeader[:5], []string{"e2", "t2", "2024-01-01T00:00:00Z", "52.5", "13.4"})
+	_, _, err := MergeByTimestamp(context.Background(), []string{wide, base}, &strings.Builder{}, 10, t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "has the columns") {
+		t.Errorf("MergeByTimestamp error = %v, want one about the columns", err)
+	}
+}
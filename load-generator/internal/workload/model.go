@@ -0,0 +1,54 @@
+// Package workload contains the data the benchmarks operate on: the generated POIs, localities
+// and trip events, the query templates and the deterministic generation of query parameters.
+package workload
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type POI struct {
+	POIID     string //UUID
+	Name      string
+	Category  string
+	Longitude string // stored as strings in order not to lose precision compared to CSV file
+	Latitude  string
+}
+
+type Locality struct {
+	LocalityID string          `json:"locality_id"`
+	Name       string          `json:"name"`
+	Geometry   json.RawMessage `json:"geometry"`
+}
+
+func (d Locality) String() string {
+	return fmt.Sprintf("Locality(LocalityID=%s, Name=%s, len(Geometry)=%d)", d.LocalityID, d.Name, len(d.Geometry))
+}
+
+// NoParkingZone is an optional reference polygon, e.g. for queries on events parked inside a zone
+type NoParkingZone struct {
+	ZoneID   string          `json:"zone_id"`
+	Name     string          `json:"name"`
+	Geometry json.RawMessage `json:"geometry"`
+}
+
+// WeatherObservation is an optional hourly or finer observation, e.g. for correlating trips with rain
+type WeatherObservation struct {
+	ObservedAt      time.Time
+	TemperatureC    float64
+	PrecipitationMm float64
+	WindSpeedMs     float64
+}
+
+// not parsed to correct data types to increase performance
+type TripEvent struct {
+	EventID   string // UUID
+	TripID    string // UUID
+	Timestamp string // ISO timestamp
+	Latitude  string
+	Longitude string
+	// values of the EventAttributes the events were read with, in their order, empty for NULL
+	Attributes []string
+	Tenant     int // tenant of the trip with -tenants, numbered from 1, 0 without tenants
+}
@@ -0,0 +1,66 @@
+package workload
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+)
+
+// POIsBBox returns the bounding box of the POIs
+func POIsBBox(pois []POI) (BBox, error) {
+	if len(pois) == 0 {
+		return BBox{}, errors.New("No POIs to derive a bounding box from")
+	}
+	b := BBox{MinLon: math.Inf(1), MinLat: math.Inf(1), MaxLon: math.Inf(-1), MaxLat: math.Inf(-1)}
+	for _, p := range pois {
+		lon, err1 := strconv.ParseFloat(p.Longitude, 64)
+		lat, err2 := strconv.ParseFloat(p.Latitude, 64)
+		if err1 != nil || err2 != nil {
+			return BBox{}, fmt.Errorf("POI %s has invalid coordinates %s,%s", p.POIID, p.Longitude, p.Latitude)
+		}
+		b.MinLon, b.MaxLon = min(b.MinLon, lon), max(b.MaxLon, lon)
+		b.MinLat, b.MaxLat = min(b.MinLat, lat), max(b.MaxLat, lat)
+	}
+	return b, nil
+}
+
+// MergeStats counts the POIs of MergePOIs
+type MergeStats struct {
+	Added      int
+	Duplicates int // same name and category as an existing POI within about 10 m
+	Sampled    int // left out by the fraction
+}
+
+// MergePOIs appends the fraction of added POIs that don't duplicate existing ones, drawn from rng,
+// to the existing POIs with fresh UUIDs
+func MergePOIs(existing, added []POI, fraction float64, rng *rand.Rand) ([]POI, MergeStats) {
+	var stats MergeStats
+	key := func(p POI) string {
+		lon, _ := strconv.ParseFloat(p.Longitude, 64)
+		lat, _ := strconv.ParseFloat(p.Latitude, 64)
+		return fmt.Sprintf("%s|%s|%.4f|%.4f", p.Name, p.Category, lon, lat)
+	}
+	seen := make(map[string]bool, len(existing)+len(added))
+	for _, p := range existing {
+		seen[key(p)] = true
+	}
+	merged := append([]POI(nil), existing...)
+	for _, p := range added {
+		k := key(p)
+		if seen[k] {
+			stats.Duplicates++
+			continue
+		}
+		seen[k] = true
+		if rng.Float64() >= fraction {
+			stats.Sampled++
+			continue
+		}
+		p.POIID = randomUUID(rng)
+		merged = append(merged, p)
+		stats.Added++
+	}
+	return merged, stats
+}
@@ -0,0 +1,254 @@
+package workload
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// QueryFieldGenerator generates random query parameters in a seeded, deterministic manner
+type QueryFieldGenerator struct {
+	baseSeed int64
+
+	// Real data pools from loaded files
+	localities []Locality
+	pois       []POI
+	tripIDs    []string
+	// trips of each tenant, the query of a tenant selects one of its own trips
+	tenants       *TenantDistribution
+	tenantTripIDs [][]string
+
+	// Time bounds for realistic queries
+	minTime time.Time
+	maxTime time.Time
+
+	// bounding box of the POIs, the area of the points of kNN queries
+	minLon, minLat, maxLon, maxLat float64
+}
+
+// QueryFields contains all possible template parameters
+type QueryFields struct {
+	LocalityId string
+	EndTime    string // RFC3339 string in UTC
+	Limit      int
+	POIID      string
+	Radius     float64
+	StartTime  string // RFC3339 string in UTC
+	Timestamp  string // RFC3339 string in UTC
+	TripID     string
+	TenantID   int // tenant the query is executed for with -tenants, numbered from 1
+	// time buckets of aggregations over StartTime to EndTime, e.g. events per 5 minutes
+	BucketInterval string // SQL interval, e.g. 5 minutes
+	BucketCount    int    // buckets of BucketInterval covering StartTime to EndTime
+	// k-nearest-neighbor queries, e.g. the K events closest to the point
+	QueryPointWKT string // WKT of a point inside the bounding box of the POIs, e.g. POINT(13.4 52.5)
+	K             int
+	// trajectory similarity queries comparing the trips to a route, iterated with routePoints
+	RouteWKT string // WKT of a route starting inside the bounding box of the POIs, e.g. LINESTRING(13.4 52.5, 13.401 52.502)
+	// geofence queries, e.g. the trips entering the locality LocalityId during a window of 5-30 minutes within StartTime to EndTime
+	WindowStart string // RFC3339 string in UTC
+	WindowEnd   string // RFC3339 string in UTC
+}
+
+// bucketIntervals are the widths of the time buckets of the generated aggregations, as on downsampling dashboards
+var bucketIntervals = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute, time.Hour}
+
+// bucketOrigin is the start of the first time bucket, so the buckets of all queries are aligned
+const bucketOrigin = "2000-01-01T00:00:00Z"
+
+// QueryTemplateFuncs are the functions available in the query templates
+var QueryTemplateFuncs = template.FuncMap{
+	// dateBin returns the start of the time bucket of the timestamp expression, date_bin exists on CrateDB and Postgres 14+
+	"dateBin": func(interval, expr string) string {
+		return fmt.Sprintf("date_bin(INTERVAL '%s', %s, CAST('%s' AS TIMESTAMP WITH TIME ZONE))", interval, expr, bucketOrigin)
+	},
+	// routePoints returns the points of the route, e.g. {{range $i, $p := routePoints .RouteWKT .StartTime}},
+	// the points are timestamped routePointInterval apart from the start time
+	"routePoints": RoutePoints,
+}
+
+// the routes of trajectory similarity queries, walks of routePointCount points with steps of 100-300 m
+const (
+	routePointCount    = 10
+	routePointInterval = 10 * time.Second
+	metersPerDegree    = 111_320.0
+)
+
+// RoutePoint is a point of the route of a trajectory similarity query
+type RoutePoint struct {
+	Longitude string
+	Latitude  string
+	Timestamp string // RFC3339 string in UTC
+}
+
+// RoutePoints returns the points of the WKT LINESTRING, timestamped routePointInterval apart from the RFC3339 start time
+func RoutePoints(wkt, start string) ([]RoutePoint, error) {
+	startTime, err := time.Parse(time.RFC3339, start)
+	if err != nil {
+		return nil, fmt.Errorf("Parsing start time of route: %w", err)
+	}
+	coordinates, ok := strings.CutPrefix(strings.TrimSpace(wkt), "LINESTRING(")
+	if !ok || !strings.HasSuffix(coordinates, ")") {
+		return nil, fmt.Errorf("Route %q is no WKT LINESTRING", wkt)
+	}
+	var points []RoutePoint
+	for i, position := range strings.Split(strings.TrimSuffix(coordinates, ")"), ",") {
+		lonLat := strings.Fields(position)
+		if len(lonLat) != 2 {
+			return nil, fmt.Errorf("Position %d of route %q has no longitude and latitude", i+1, wkt)
+		}
+		points = append(points, RoutePoint{
+			Longitude: lonLat[0],
+			Latitude:  lonLat[1],
+			Timestamp: FormatTimestamp(startTime.Add(time.Duration(i) * routePointInterval)),
+		})
+	}
+	return points, nil
+}
+
+// formatInterval returns the duration as SQL interval understood by CrateDB and Postgres, e.g. 5 minutes
+func formatInterval(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%d hours", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%d minutes", d/time.Minute)
+	default:
+		return fmt.Sprintf("%d seconds", d/time.Second)
+	}
+}
+
+// NewQueryFieldGenerator creates a new seeded field generator, failing if the dataset time zone can't be loaded
+func NewQueryFieldGenerator(seed int64, localities []Locality, pois []POI, tripIds []string) (*QueryFieldGenerator, error) {
+	location, err := DatasetLocation()
+	if err != nil {
+		return nil, err
+	}
+	// Set realistic time bounds (adjust based on your dataset) in the time zone of the dataset
+	minTime := time.Date(2020, 1, 1, 0, 0, 0, 0, location)
+	maxTime := time.Date(2025, 12, 31, 23, 59, 59, 0, location)
+
+	g := &QueryFieldGenerator{
+		baseSeed:   seed,
+		localities: localities,
+		pois:       pois,
+		tripIDs:    tripIds,
+		minTime:    minTime,
+		maxTime:    maxTime,
+	}
+	g.setPOIBounds()
+	return g, nil
+}
+
+// setPOIBounds sets the bounding box of the POIs, POIs with unparsable coordinates are left out
+func (g *QueryFieldGenerator) setPOIBounds() {
+	first := true
+	for _, poi := range g.pois {
+		lon, errLon := strconv.ParseFloat(poi.Longitude, 64)
+		lat, errLat := strconv.ParseFloat(poi.Latitude, 64)
+		if errLon != nil || errLat != nil {
+			continue
+		}
+		if first {
+			g.minLon, g.maxLon, g.minLat, g.maxLat = lon, lon, lat, lat
+			first = false
+			continue
+		}
+		g.minLon, g.maxLon = min(g.minLon, lon), max(g.maxLon, lon)
+		g.minLat, g.maxLat = min(g.minLat, lat), max(g.maxLat, lat)
+	}
+}
+
+// GenerateFields generates all query fields for a specific worker and query index
+func (g *QueryFieldGenerator) GenerateFields(queryIndex int) QueryFields {
+	// Create single deterministic seed for this specific query
+	hash := sha256.New()
+	binary.Write(hash, binary.LittleEndian, g.baseSeed)
+	binary.Write(hash, binary.LittleEndian, queryIndex)
+
+	hashBytes := hash.Sum(nil)
+	seed := int64(binary.LittleEndian.Uint64(hashBytes[:8]))
+
+	// Create single RNG for all fields in this query
+	rng := rand.New(rand.NewSource(seed))
+
+	// Generate start time first
+	minDuration := int64(3600 * 1)
+	maxDuration := int64(3600 * 2)
+
+	timeRange := g.maxTime.Unix() - g.minTime.Unix()
+	startOffset := rng.Int63n(timeRange - maxDuration)
+	startTime := time.Unix(g.minTime.Unix()+startOffset, 0)
+
+	duration := minDuration + rng.Int63n(maxDuration-minDuration)
+	endTime := startTime.Add(time.Duration(duration) * time.Second)
+
+	// Generate single timestamp within reasonable bounds
+	timestampOffset := rng.Int63n(timeRange)
+	timestamp := time.Unix(g.minTime.Unix()+timestampOffset, 0)
+
+	fields := QueryFields{
+		LocalityId: g.localities[rng.Intn(len(g.localities))].LocalityID,
+		Limit:      5 + rng.Intn(95),
+		POIID:      g.pois[rng.Intn(len(g.pois))].POIID,
+		Radius:     1000 + rng.Float64()*4000, // 1000-5000 meters
+		StartTime:  FormatTimestamp(startTime),
+		EndTime:    FormatTimestamp(endTime),
+		Timestamp:  FormatTimestamp(timestamp),
+		TripID:     g.tripIDs[rng.Intn(len(g.tripIDs))],
+	}
+	// drawn last, so the other fields stay the same as without tenants
+	if g.tenants != nil {
+		fields.TenantID = g.tenants.Pick(rng.Float64())
+		if tripIDs := g.tenantTripIDs[fields.TenantID-1]; len(tripIDs) > 0 {
+			fields.TripID = tripIDs[rng.Intn(len(tripIDs))]
+		}
+	}
+	// drawn after the tenant, so the other fields stay the same as before the buckets and kNN points
+	bucketInterval := bucketIntervals[rng.Intn(len(bucketIntervals))]
+	fields.BucketInterval = formatInterval(bucketInterval)
+	fields.BucketCount = int((endTime.Sub(startTime) + bucketInterval - 1) / bucketInterval)
+	lon := g.minLon + rng.Float64()*(g.maxLon-g.minLon)
+	lat := g.minLat + rng.Float64()*(g.maxLat-g.minLat)
+	fields.QueryPointWKT = "POINT(" + strconv.FormatFloat(lon, 'f', 6, 64) + " " + strconv.FormatFloat(lat, 'f', 6, 64) + ")"
+	fields.K = 1 + rng.Intn(50)
+	fields.RouteWKT = g.generateRoute(rng)
+	window := time.Duration(5+rng.Intn(26)) * time.Minute
+	windowStart := startTime.Add(time.Duration(rng.Int63n(int64(endTime.Sub(startTime)-window)/int64(time.Second))) * time.Second)
+	fields.WindowStart = FormatTimestamp(windowStart)
+	fields.WindowEnd = FormatTimestamp(windowStart.Add(window))
+	return fields
+}
+
+// generateRoute returns a WKT LINESTRING walking from a point inside the bounding box of the POIs,
+// turning by up to 45° at every point like a vehicle following streets
+func (g *QueryFieldGenerator) generateRoute(rng *rand.Rand) string {
+	lon := g.minLon + rng.Float64()*(g.maxLon-g.minLon)
+	lat := g.minLat + rng.Float64()*(g.maxLat-g.minLat)
+	heading := rng.Float64() * 2 * math.Pi
+	positions := make([]string, routePointCount)
+	for i := range positions {
+		positions[i] = strconv.FormatFloat(lon, 'f', 6, 64) + " " + strconv.FormatFloat(lat, 'f', 6, 64)
+		step := 100 + rng.Float64()*200
+		heading += (rng.Float64() - 0.5) * math.Pi / 2
+		lat += step * math.Cos(heading) / metersPerDegree
+		lon += step * math.Sin(heading) / (metersPerDegree * math.Cos(lat*math.Pi/180))
+	}
+	return "LINESTRING(" + strings.Join(positions, ", ") + ")"
+}
+
+// SetTenants makes the generated queries target the tenants of the distribution
+func (g *QueryFieldGenerator) SetTenants(tenants *TenantDistribution) {
+	g.tenants = tenants
+	g.tenantTripIDs = make([][]string, tenants.Tenants())
+	for _, tripID := range g.tripIDs {
+		tenant := tenants.TripTenant(tripID)
+		g.tenantTripIDs[tenant-1] = append(g.tenantTripIDs[tenant-1], tripID)
+	}
+}
@@ -0,0 +1,112 @@
+package workload
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+// ScaleConfig configures ScaleTrips
+type ScaleConfig struct {
+	Factor       int           // the output contains the input and Factor-1 copies of it
+	TimeShift    time.Duration // copy k is shifted by k*TimeShift
+	JitterMetres float64       // standard deviation of the offset each copied trip is moved by
+	Seed         int64
+}
+
+// ScaleTrips writes the trip events of the input CSV followed by Factor-1 copies with new trip and event UUIDs,
+// shifted timestamps and each trip moved by a random offset, so the shape of the trajectories is kept.
+// Additional columns, e.g. event attributes, are copied. The input is read once per copy instead of being held in memory.
+// Returns the number of trips and events written.
+func ScaleTrips(ctx context.Context, tripEventsCSV string, w io.Writer, cfg ScaleConfig) (int, int, error) {
+	if cfg.Factor < 1 {
+		return 0, 0, fmt.Errorf("Scale factor %d, expected at least 1", cfg.Factor)
+	}
+	if cfg.JitterMetres < 0 {
+		return 0, 0, fmt.Errorf("Negative jitter %g", cfg.JitterMetres)
+	}
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	cw := csv.NewWriter(w)
+
+	trips, events := 0, 0
+	for k := 0; k < cfg.Factor; k++ {
+		r, err := OpenTripEvents(tripEventsCSV)
+		if err != nil {
+			return trips, events, err
+		}
+		header := r.KeepColumns()
+		if k == 0 {
+			if err := cw.Write(header); err != nil {
+				r.Close()
+				return 0, 0, err
+			}
+		}
+		shift := time.Duration(k) * cfg.TimeShift
+		var sourceTripID, tripID string
+		var dLat, dLon float64
+		for ctx.Err() == nil {
+			event, err := r.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				r.Close()
+				return trips, events, err
+			}
+			// the events of a trip are consecutive, as in the generated files
+			if event.TripID != sourceTripID {
+				sourceTripID = event.TripID
+				trips++
+				tripID = event.TripID
+				if k > 0 {
+					tripID = randomUUID(rng)
+					dLat, dLon = rng.NormFloat64()*cfg.JitterMetres, rng.NormFloat64()*cfg.JitterMetres
+				}
+			}
+			if k > 0 {
+				if event, err = shiftEvent(event, shift, dLat, dLon); err != nil {
+					r.Close()
+					return trips, events, err
+				}
+				event.EventID, event.TripID = randomUUID(rng), tripID
+			}
+			if err := cw.Write(eventRecord(event)); err != nil {
+				r.Close()
+				return trips, events, err
+			}
+			events++
+		}
+		r.Close()
+		if err := ctx.Err(); err != nil {
+			return trips, events, err
+		}
+	}
+	cw.Flush()
+	return trips, events, cw.Error()
+}
+
+// shiftEvent returns the event shifted in time and moved by the offset in metres
+func shiftEvent(event TripEvent, shift time.Duration, dLat, dLon float64) (TripEvent, error) {
+	timestamp, err := ParseTimestamp(event.Timestamp)
+	if err != nil {
+		return event, fmt.Errorf("Parsing timestamp of event %s: %w", event.EventID, err)
+	}
+	lat, err := strconv.ParseFloat(event.Latitude, 64)
+	if err != nil {
+		return event, fmt.Errorf("Parsing latitude of event %s: %w", event.EventID, err)
+	}
+	lon, err := strconv.ParseFloat(event.Longitude, 64)
+	if err != nil {
+		return event, fmt.Errorf("Parsing longitude of event %s: %w", event.EventID, err)
+	}
+	lat += dLat / metresPerDegree
+	lon += dLon / (metresPerDegree * math.Cos(lat*math.Pi/180))
+	event.Timestamp = FormatTimestamp(timestamp.Add(shift))
+	event.Latitude = strconv.FormatFloat(lat, 'f', 6, 64)
+	event.Longitude = strconv.FormatFloat(lon, 'f', 6, 64)
+	return event, nil
+}
@@ -0,0 +1,37 @@
+package workload
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScaleTripsKeepsColumns(t *testing.T) {
+	input := writeTripEvents(t, wideHeader,
+		[]string{"e1", "t1", "2024-01-01T00:00:00Z", "52.5", "13.4", "90", "scooter"},
+		[]string{"e2", "t1", "2024-01-01T00:00:20Z", "52.6", "13.4", "", "scooter"},
+	)
+	var out strings.Builder
+	trips, events, err := ScaleTrips(context.Background(), input, &out, ScaleConfig{Factor: 2, TimeShift: time.Hour, Seed: 1})
+	if err != nil {
+		t.Fatalf("ScaleTrips failed: %v", err)
+	}
+	rows := readCSV(t, out.String())
+	if trips != 2 || events != 4 || len(rows) != 5 {
+		t.Fatalf("scaled to %d trips and %d events in %d rows, want 2, 4 and 5", trips, events, len(rows))
+	}
+	if !reflect.DeepEqual(rows[0], wideHeader) {
+		t.Errorf("header %v, want %v", rows[0], wideHeader)
+	}
+	for i, row := range rows[1:] {
+		source := rows[1+i%2]
+		if !reflect.DeepEqual(row[5:], source[5:]) {
+			t.Errorf("row %d has the attributes %v, want %v", i+1, row[5:], source[5:])
+		}
+	}
+	if rows[3][2] != "2024-01-01T01:00:00Z" || rows[3][1] == "t1" {
+		t.Errorf("copied event %v isn't shifted to a new trip", rows[3])
+	}
+}
@@ -0,0 +1,141 @@
+package workload
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"load-generator/internal/shapefile"
+)
+
+func isShapefile(path string) bool {
+	return inputExt(path) == ".shp" || inputExt(path) == ".zip"
+}
+
+func readInputFile(path string) ([]byte, error) {
+	f, err := OpenInput(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// siblingPath replaces the extension of a path or URL, keeping its case and the query of URLs
+func siblingPath(p, ext string) string {
+	base, query, hasQuery := strings.Cut(p, "?")
+	oldExt := path.Ext(base)
+	if oldExt == strings.ToUpper(oldExt) {
+		ext = strings.ToUpper(ext)
+	}
+	base = strings.TrimSuffix(base, oldExt) + ext
+	if hasQuery {
+		return base + "?" + query
+	}
+	return base
+}
+
+// readShapefileComponents reads the .shp, .dbf and optional .prj of a shapefile, either next to each other
+// or in a ZIP archive containing a single shapefile
+func readShapefileComponents(p string) (shp, dbf, prj []byte, err error) {
+	if inputExt(p) == ".shp" {
+		if shp, err = readInputFile(p); err != nil {
+			return nil, nil, nil, err
+		}
+		if dbf, err = readInputFile(siblingPath(p, ".dbf")); err != nil {
+			return nil, nil, nil, fmt.Errorf("Reading attributes: %w", err)
+		}
+		// the projection is optional
+		prj, _ = readInputFile(siblingPath(p, ".prj"))
+		return shp, dbf, prj, nil
+	}
+
+	b, err := readInputFile(p)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("Opening ZIP archive: %w", err)
+	}
+	files := make(map[string]*zip.File)
+	var shapefiles []string
+	for _, f := range zr.File {
+		name := strings.ToLower(f.Name)
+		if strings.HasPrefix(name, "__macosx/") {
+			continue
+		}
+		files[name] = f
+		if path.Ext(name) == ".shp" {
+			shapefiles = append(shapefiles, name)
+		}
+	}
+	if len(shapefiles) != 1 {
+		return nil, nil, nil, fmt.Errorf("ZIP archive with %d shapefiles %v, expected one", len(shapefiles), shapefiles)
+	}
+	readEntry := func(ext string) ([]byte, error) {
+		f, ok := files[strings.TrimSuffix(shapefiles[0], ".shp")+ext]
+		if !ok {
+			return nil, fmt.Errorf("ZIP archive without %s file", ext)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+	if shp, err = readEntry(".shp"); err != nil {
+		return nil, nil, nil, err
+	}
+	if dbf, err = readEntry(".dbf"); err != nil {
+		return nil, nil, nil, err
+	}
+	prj, _ = readEntry(".prj")
+	return shp, dbf, prj, nil
+}
+
+// loadShapefileFeatures reads the polygons of a shapefile whose attributes contain the fields.
+// The coordinates must be WGS 84 longitudes and latitudes, shapefiles in projected coordinate systems are rejected.
+func loadShapefileFeatures(p, kind string, fields FeatureFields) ([]namedFeature, error) {
+	shp, dbf, prj, err := readShapefileComponents(p)
+	if err != nil {
+		return nil, fmt.Errorf("Reading %s shapefile: %w", kind, err)
+	}
+	if wkt := strings.TrimSpace(string(prj)); strings.HasPrefix(wkt, "PROJCS") || strings.HasPrefix(wkt, "PROJCRS") {
+		name, _, _ := strings.Cut(strings.TrimLeft(wkt[strings.Index(wkt, "[")+1:], `"`), `"`)
+		return nil, fmt.Errorf("The %s shapefile uses the projected coordinate system %s, reproject it to WGS 84 first, e.g. with ogr2ogr -t_srs EPSG:4326", kind, name)
+	}
+	records, err := shapefile.Read(shp, dbf)
+	if err != nil {
+		return nil, fmt.Errorf("Parsing %s shapefile: %w", kind, err)
+	}
+
+	features := make([]namedFeature, 0, len(records))
+	for i, record := range records {
+		id, ok1 := record.Attributes[fields.ID]
+		name, ok2 := record.Attributes[fields.Name]
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("Record %d of %s is missing the %s or %s attribute", i+1, p, fields.ID, fields.Name)
+		}
+		for _, ring := range record.Rings {
+			for _, c := range ring {
+				if c[0] < -180 || c[0] > 180 || c[1] < -90 || c[1] > 90 {
+					return nil, fmt.Errorf("Record %d of %s has coordinates outside of WGS 84 longitudes and latitudes, reproject it first, e.g. with ogr2ogr -t_srs EPSG:4326", i+1, p)
+				}
+			}
+		}
+		geometry, err := record.Geometry()
+		if err == nil {
+			geometry, err = FixRings(geometry)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Record %d of %s: %w", i+1, p, err)
+		}
+		features = append(features, namedFeature{id: id, name: name, geometry: geometry})
+	}
+	return features, nil
+}
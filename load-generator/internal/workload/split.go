@@ -0,0 +1,119 @@
+package workload
+
+import (
+	"cmp"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"slices"
+)
+
+// trips are hashed into bucketsPerShard buckets per shard, which are then assigned to the shards by their event counts
+const bucketsPerShard = 64
+
+// ShardStats counts the trips and events written to a shard by SplitTrips
+type ShardStats struct {
+	Trips  int `json:"trips"`
+	Events int `json:"events"`
+}
+
+// SplitTrips shards the trip events of the CSV into one CSV per writer. Trips are hashed by their trip_id into buckets,
+// which are assigned to the shards largest first, always to the shard with the fewest events, balancing the event counts.
+// All events of a trip end up in the same shard in their input order. Additional columns, e.g. event attributes, are copied.
+// The input is read twice.
+func SplitTrips(ctx context.Context, tripEventsCSV string, writers []io.Writer) ([]ShardStats, error) {
+	if len(writers) < 1 {
+		return nil, fmt.Errorf("Splitting into %d shards, expected at least 1", len(writers))
+	}
+	bucketEvents := make([]int, len(writers)*bucketsPerShard)
+	header, err := eachTripEvent(ctx, tripEventsCSV, func(event TripEvent, _ bool) error {
+		bucketEvents[tripBucket(event.TripID, len(bucketEvents))]++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := make([]int, len(bucketEvents))
+	for i := range buckets {
+		buckets[i] = i
+	}
+	slices.SortStableFunc(buckets, func(a, b int) int { return cmp.Compare(bucketEvents[b], bucketEvents[a]) })
+	shardOf := make([]int, len(bucketEvents))
+	planned := make([]int, len(writers))
+	for _, bucket := range buckets {
+		shard := 0
+		for i := range planned {
+			if planned[i] < planned[shard] {
+				shard = i
+			}
+		}
+		shardOf[bucket] = shard
+		planned[shard] += bucketEvents[bucket]
+	}
+
+	csvWriters := make([]*csv.Writer, len(writers))
+	for i, w := range writers {
+		csvWriters[i] = csv.NewWriter(w)
+		if err := csvWriters[i].Write(header); err != nil {
+			return nil, err
+		}
+	}
+	stats := make([]ShardStats, len(writers))
+	_, err = eachTripEvent(ctx, tripEventsCSV, func(event TripEvent, newTrip bool) error {
+		shard := shardOf[tripBucket(event.TripID, len(bucketEvents))]
+		if newTrip {
+			stats[shard].Trips++
+		}
+		stats[shard].Events++
+		return csvWriters[shard].Write(eventRecord(event))
+	})
+	if err != nil {
+		return stats, err
+	}
+	for _, cw := range csvWriters {
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
+
+func tripBucket(tripID string, buckets int) int {
+	h := fnv.New32a()
+	h.Write([]byte(tripID))
+	return int(h.Sum32() % uint32(buckets))
+}
+
+// eachTripEvent calls fn for every event of the CSV, newTrip is set for the first event of each consecutive run of a trip.
+// The events have the values of the additional columns as Attributes, see KeepColumns. Returns the header of the CSV.
+func eachTripEvent(ctx context.Context, tripEventsCSV string, fn func(event TripEvent, newTrip bool) error) ([]string, error) {
+	r, err := OpenTripEvents(tripEventsCSV)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	header := r.KeepColumns()
+	previousTripID := ""
+	for ctx.Err() == nil {
+		event, err := r.Next()
+		if err == io.EOF {
+			return header, nil
+		} else if err != nil {
+			return header, err
+		}
+		if err := fn(event, event.TripID != previousTripID); err != nil {
+			return header, err
+		}
+		previousTripID = event.TripID
+	}
+	return header, ctx.Err()
+}
+
+// eventRecord returns the event as row of a trip events CSV with the header of the file it was read from with KeepColumns
+func eventRecord(event TripEvent) []string {
+	return append([]string{event.EventID, event.TripID, event.Timestamp, event.Latitude, event.Longitude}, event.Attributes...)
+}
@@ -0,0 +1,34 @@
+package workload
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitTripsKeepsColumns(t *testing.T) {
+	input := writeTripEvents(t, wideHeader,
+		[]string{"e1", "t1", "2024-01-01T00:00:00Z", "52.5", "13.4", "90", "scooter"},
+		[]string{"e2", "t1", "2024-01-01T00:00:20Z", "52.6", "13.4", "", "scooter"},
+		[]string{"e3", "t2", "2024-01-01T00:00:10Z", "52.5", "13.5", "40", "bike"},
+	)
+	shards := []*strings.Builder{{}, {}}
+	if _, err := SplitTrips(context.Background(), input, []io.Writer{shards[0], shards[1]}); err != nil {
+		t.Fatalf("SplitTrips failed: %v", err)
+	}
+	rows := map[string][]string{}
+	for i, shard := range shards {
+		got := readCSV(t, shard.String())
+		if !reflect.DeepEqual(got[0], wideHeader) {
+			t.Errorf("shard %d has the header %v, want %v", i, got[0], wideHeader)
+		}
+		for _, row := range got[1:] {
+			rows[row[0]] = row
+		}
+	}
+	if want := []string{"e2", "t1", "2024-01-01T00:00:20Z", "52.6", "13.4", "", "scooter"}; !reflect.DeepEqual(rows["e2"], want) || len(rows) != 3 {
+		t.Errorf("shards have %d events, e2 = %v, want 3 and %v", len(rows), rows["e2"], want)
+	}
+}
@@ -0,0 +1,216 @@
+package workload
+
+import (
+	"container/heap"
+	"errors"
+	"math"
+	"math/rand"
+)
+
+// StreetGraph is a street network trips are routed on, reduced to its largest connected component
+type StreetGraph struct {
+	coords [][2]float64 // lon, lat of each node
+	edges  [][]streetEdge
+}
+
+type streetEdge struct {
+	to     int32
+	length float64 // metres
+}
+
+// NewStreetGraph builds the graph of the nodes (lon, lat) and the street segments between two node indices,
+// traversable in both directions unless oneway. Nodes outside of the largest connected component are dropped,
+// so a route exists between every two nodes.
+func NewStreetGraph(coords [][2]float64, segments [][2]int, oneway []bool) (*StreetGraph, error) {
+	edges := make([][]streetEdge, len(coords))
+	// undirected adjacency only for finding the connected components
+	undirected := make([][]int32, len(coords))
+	for i, s := range segments {
+		a, b := s[0], s[1]
+		length := distanceMetres(coords[a], coords[b])
+		edges[a] = append(edges[a], streetEdge{int32(b), length})
+		if !oneway[i] {
+			edges[b] = append(edges[b], streetEdge{int32(a), length})
+		}
+		undirected[a] = append(undirected[a], int32(b))
+		undirected[b] = append(undirected[b], int32(a))
+	}
+
+	component := make([]int, len(coords))
+	for i := range component {
+		component[i] = -1
+	}
+	largest, largestSize := -1, 0
+	for start := range coords {
+		if component[start] >= 0 || len(undirected[start]) == 0 {
+			continue
+		}
+		size := 0
+		stack := []int32{int32(start)}
+		component[start] = start
+		for len(stack) > 0 {
+			n := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			size++
+			for _, m := range undirected[n] {
+				if component[m] < 0 {
+					component[m] = start
+					stack = append(stack, m)
+				}
+			}
+		}
+		if size > largestSize {
+			largest, largestSize = start, size
+		}
+	}
+	if largestSize < 2 {
+		return nil, errors.New("Street network without any connected segments")
+	}
+
+	index := make([]int32, len(coords))
+	g := &StreetGraph{}
+	for i := range coords {
+		index[i] = -1
+		if component[i] == largest {
+			index[i] = int32(len(g.coords))
+			g.coords = append(g.coords, coords[i])
+		}
+	}
+	g.edges = make([][]streetEdge, len(g.coords))
+	for i, nodeEdges := range edges {
+		if index[i] < 0 {
+			continue
+		}
+		for _, e := range nodeEdges {
+			g.edges[index[i]] = append(g.edges[index[i]], streetEdge{index[e.to], e.length})
+		}
+	}
+	return g, nil
+}
+
+// NumNodes returns the number of street nodes, i.e. intersections and the vertices of curved streets
+func (g *StreetGraph) NumNodes() int {
+	return len(g.coords)
+}
+
+// BBox returns the bounding box of the street nodes
+func (g *StreetGraph) BBox() BBox {
+	b := BBox{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, c := range g.coords {
+		b.MinLon, b.MaxLon = min(b.MinLon, c[0]), max(b.MaxLon, c[0])
+		b.MinLat, b.MaxLat = min(b.MinLat, c[1]), max(b.MaxLat, c[1])
+	}
+	return b
+}
+
+// route returns the nodes of the shortest path from one node to another (Dijkstra), nil if there is none,
+// e.g. because of one-way streets
+func (g *StreetGraph) route(from, to int32) []int32 {
+	dist := make(map[int32]float64, 1024)
+	prev := make(map[int32]int32, 1024)
+	dist[from] = 0
+	queue := &routeQueue{{from, 0}}
+	for queue.Len() > 0 {
+		item := heap.Pop(queue).(routeItem)
+		if item.dist > dist[item.node] {
+			continue
+		}
+		if item.node == to {
+			path := []int32{to}
+			for n := to; n != from; {
+				n = prev[n]
+				path = append(path, n)
+			}
+			for l, r := 0, len(path)-1; l < r; l, r = l+1, r-1 {
+				path[l], path[r] = path[r], path[l]
+			}
+			return path
+		}
+		for _, e := range g.edges[item.node] {
+			d := item.dist + e.length
+			if known, ok := dist[e.to]; !ok || d < known {
+				dist[e.to] = d
+				prev[e.to] = item.node
+				heap.Push(queue, routeItem{e.to, d})
+			}
+		}
+	}
+	return nil
+}
+
+// maximum number of destinations drawn for a trip until its route is long enough
+const maxRouteLegs = 20
+
+// randomPath returns the coordinates of a path of at least length metres along the streets,
+// chaining the shortest routes to random destinations. It may be shorter if no further destination is reachable.
+func (g *StreetGraph) randomPath(rng *rand.Rand, length float64) [][2]float64 {
+	current := int32(rng.Intn(len(g.coords)))
+	path := [][2]float64{g.coords[current]}
+	total := 0.0
+	for leg := 0; leg < maxRouteLegs && total < length; leg++ {
+		route := g.route(current, int32(rng.Intn(len(g.coords))))
+		if len(route) < 2 {
+			continue
+		}
+		for _, n := range route[1:] {
+			total += distanceMetres(path[len(path)-1], g.coords[n])
+			path = append(path, g.coords[n])
+		}
+		current = route[len(route)-1]
+	}
+	return path
+}
+
+// pathWalker interpolates the positions along a path of coordinates
+type pathWalker struct {
+	path     [][2]float64
+	segment  int     // index of the segment start in path
+	traveled float64 // metres traveled along the current segment
+}
+
+// advance moves the walker distance metres along the path and returns its position,
+// staying at the end once the path is exhausted
+func (w *pathWalker) advance(distance float64) [2]float64 {
+	for w.segment+1 < len(w.path) {
+		a, b := w.path[w.segment], w.path[w.segment+1]
+		length := distanceMetres(a, b)
+		if w.traveled+distance <= length {
+			w.traveled += distance
+			t := 0.0
+			if length > 0 {
+				t = w.traveled / length
+			}
+			return [2]float64{a[0] + t*(b[0]-a[0]), a[1] + t*(b[1]-a[1])}
+		}
+		distance -= length - w.traveled
+		w.segment++
+		w.traveled = 0
+	}
+	return w.path[len(w.path)-1]
+}
+
+// distanceMetres approximates the distance of two lon, lat positions with an equirectangular projection,
+// precise enough within a city
+func distanceMetres(a, b [2]float64) float64 {
+	dx := (b[0] - a[0]) * metresPerDegree * math.Cos((a[1]+b[1])/2*math.Pi/180)
+	dy := (b[1] - a[1]) * metresPerDegree
+	return math.Hypot(dx, dy)
+}
+
+type routeItem struct {
+	node int32
+	dist float64
+}
+
+type routeQueue []routeItem
+
+func (q routeQueue) Len() int           { return len(q) }
+func (q routeQueue) Less(i, j int) bool { return q[i].dist < q[j].dist }
+func (q routeQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *routeQueue) Push(x any)        { *q = append(*q, x.(routeItem)) }
+func (q *routeQueue) Pop() any {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
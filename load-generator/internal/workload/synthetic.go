@@ -0,0 +1,333 @@
+package workload
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// metres per degree of latitude, used to move trips by their speed
+const metresPerDegree = 111_320
+
+var poiCategories = []string{"restaurant", "cafe", "bar", "museum", "park", "shop", "station", "attraction"}
+
+// BBox is a bounding box in WGS 84 degrees
+type BBox struct {
+	MinLon float64 `json:"minLon"`
+	MinLat float64 `json:"minLat"`
+	MaxLon float64 `json:"maxLon"`
+	MaxLat float64 `json:"maxLat"`
+}
+
+// ParseBBox parses minLon,minLat,maxLon,maxLat
+func ParseBBox(s string) (BBox, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return BBox{}, fmt.Errorf("Invalid bounding box %q, expected minLon,minLat,maxLon,maxLat", s)
+	}
+	var values [4]float64
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return BBox{}, fmt.Errorf("Invalid bounding box %q: %w", s, err)
+		}
+		values[i] = v
+	}
+	b := BBox{values[0], values[1], values[2], values[3]}
+	if b.MinLon >= b.MaxLon || b.MinLat >= b.MaxLat || b.MinLon < -180 || b.MaxLon > 180 || b.MinLat < -90 || b.MaxLat > 90 {
+		return BBox{}, fmt.Errorf("Invalid bounding box %q, expected minLon < maxLon and minLat < maxLat within WGS 84 bounds", s)
+	}
+	return b, nil
+}
+
+// Contains reports whether the position lies within the bounding box
+func (b BBox) Contains(lon, lat float64) bool {
+	return lon >= b.MinLon && lon <= b.MaxLon && lat >= b.MinLat && lat <= b.MaxLat
+}
+
+// SyntheticConfig configures the dataset of a SyntheticGenerator
+type SyntheticConfig struct {
+	Seed         int64
+	BBox         BBox
+	NumPOIs      int
+	LocalityGrid int // the bounding box is split into LocalityGrid x LocalityGrid localities
+	NumTrips     int
+	Start        time.Time     // earliest trip start
+	Span         time.Duration // trips start uniformly distributed within Start and Start+Span
+	// distribution of the trip durations: normal, lognormal or uniform, with the given mean and standard deviation
+	DurationDistribution string
+	DurationMean         time.Duration
+	DurationStdDev       time.Duration
+	SampleInterval       time.Duration // time between two events of a trip
+	SpeedMs              float64       // mean speed of the e-scooters in metres per second
+	Streets              *StreetGraph  // trips follow the streets if set, instead of moving freely
+	// imperfections of real telemetry, all disabled by their zero values
+	NoiseMetres    float64       // standard deviation of the Gaussian noise added to the reported positions
+	SampleJitter   float64       // each sample interval varies uniformly by up to this fraction, in [0, 1)
+	GapProbability float64       // probability of a drop-out starting at an event, during which no events are reported
+	GapMean        time.Duration // mean duration of a drop-out, exponentially distributed
+	// adds the columns battery_level, speed_kmh and rider_hash read by the wide schema variants
+	ExtendedAttributes bool
+}
+
+func (c SyntheticConfig) validate() error {
+	switch {
+	case c.NumPOIs < 0 || c.NumTrips < 0:
+		return fmt.Errorf("Negative number of POIs or trips")
+	case c.LocalityGrid < 1:
+		return fmt.Errorf("Locality grid %d, expected at least 1", c.LocalityGrid)
+	case c.SampleInterval <= 0:
+		return fmt.Errorf("Sample interval %s, expected a positive duration", c.SampleInterval)
+	case c.DurationMean < c.SampleInterval:
+		return fmt.Errorf("Mean trip duration %s is shorter than the sample interval %s", c.DurationMean, c.SampleInterval)
+	case c.DurationStdDev < 0 || c.Span < 0 || c.SpeedMs <= 0:
+		return fmt.Errorf("Negative duration deviation or span, or non-positive speed")
+	case c.NoiseMetres < 0:
+		return fmt.Errorf("Negative GPS noise %g", c.NoiseMetres)
+	case c.SampleJitter < 0 || c.SampleJitter >= 1:
+		return fmt.Errorf("Sample jitter %g, expected at least 0 and less than 1", c.SampleJitter)
+	case c.GapProbability < 0 || c.GapProbability > 1:
+		return fmt.Errorf("Gap probability %g, expected between 0 and 1", c.GapProbability)
+	case c.GapProbability > 0 && c.GapMean <= 0:
+		return fmt.Errorf("Mean gap duration %s, expected a positive duration", c.GapMean)
+	}
+	switch c.DurationDistribution {
+	case "normal", "lognormal", "uniform":
+		return nil
+	default:
+		return fmt.Errorf("Unknown duration distribution %q, expected normal, lognormal or uniform", c.DurationDistribution)
+	}
+}
+
+// SyntheticGenerator generates POIs, localities and e-scooter trips in the formats the loaders read,
+// deterministic for a seed
+type SyntheticGenerator struct {
+	cfg SyntheticConfig
+	rng *rand.Rand
+}
+
+func NewSyntheticGenerator(cfg SyntheticConfig) (*SyntheticGenerator, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return &SyntheticGenerator{cfg: cfg, rng: rand.New(rand.NewSource(cfg.Seed))}, nil
+}
+
+// uuid returns a version 4 UUID drawn from the generator's random source
+func (g *SyntheticGenerator) uuid() string {
+	return randomUUID(g.rng)
+}
+
+// randomUUID returns a version 4 UUID drawn from rng, deterministic for its seed
+func randomUUID(rng *rand.Rand) string {
+	var b [16]byte
+	rng.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+func (g *SyntheticGenerator) randomPoint() (float64, float64) {
+	b := g.cfg.BBox
+	return b.MinLon + g.rng.Float64()*(b.MaxLon-b.MinLon), b.MinLat + g.rng.Float64()*(b.MaxLat-b.MinLat)
+}
+
+// POIs returns uniformly distributed POIs of random categories
+func (g *SyntheticGenerator) POIs() []POI {
+	pois := make([]POI, g.cfg.NumPOIs)
+	for i := range pois {
+		lon, lat := g.randomPoint()
+		category := poiCategories[g.rng.Intn(len(poiCategories))]
+		pois[i] = POI{
+			POIID:     g.uuid(),
+			Name:      fmt.Sprintf("%s %d", category, i+1),
+			Category:  category,
+			Longitude: strconv.FormatFloat(lon, 'f', 6, 64),
+			Latitude:  strconv.FormatFloat(lat, 'f', 6, 64),
+		}
+	}
+	return pois
+}
+
+// Localities returns the cells of a grid covering the bounding box as polygons
+func (g *SyntheticGenerator) Localities() []Locality {
+	b, n := g.cfg.BBox, g.cfg.LocalityGrid
+	width, height := (b.MaxLon-b.MinLon)/float64(n), (b.MaxLat-b.MinLat)/float64(n)
+	var localities []Locality
+	for row := 0; row < n; row++ {
+		for col := 0; col < n; col++ {
+			minLon, minLat := b.MinLon+float64(col)*width, b.MinLat+float64(row)*height
+			maxLon, maxLat := minLon+width, minLat+height
+			// exterior ring counterclockwise following RFC 7946
+			ring := [][]float64{{minLon, minLat}, {maxLon, minLat}, {maxLon, maxLat}, {minLon, maxLat}, {minLon, minLat}}
+			geometry, _ := json.Marshal(map[string]any{"type": "Polygon", "coordinates": [][][]float64{ring}})
+			localities = append(localities, Locality{
+				LocalityID: g.uuid(),
+				Name:       fmt.Sprintf("Locality %d-%d", row+1, col+1),
+				Geometry:   geometry,
+			})
+		}
+	}
+	return localities
+}
+
+// tripDuration draws a duration of the configured distribution, at least one sample interval
+func (g *SyntheticGenerator) tripDuration() time.Duration {
+	mean, stdDev := float64(g.cfg.DurationMean), float64(g.cfg.DurationStdDev)
+	var d float64
+	switch g.cfg.DurationDistribution {
+	case "normal":
+		d = mean + g.rng.NormFloat64()*stdDev
+	case "lognormal":
+		// parameters of the underlying normal distribution giving the mean and deviation
+		sigma2 := math.Log(1 + stdDev*stdDev/(mean*mean))
+		mu := math.Log(mean) - sigma2/2
+		d = math.Exp(mu + g.rng.NormFloat64()*math.Sqrt(sigma2))
+	case "uniform":
+		halfWidth := stdDev * math.Sqrt(3)
+		d = mean - halfWidth + g.rng.Float64()*2*halfWidth
+	}
+	return max(time.Duration(d), g.cfg.SampleInterval)
+}
+
+// WriteTrips writes the trip events as CSV grouped by trip, as ReadTripIDs expects.
+// The e-scooters start at a random position and time and move with a randomly changing heading,
+// reflecting at the bounding box, or along the shortest routes between random street nodes if Streets is set.
+// Noise, sample jitter and drop-outs only affect the reported events, not the movement.
+// Returns the number of trips and events written.
+func (g *SyntheticGenerator) WriteTrips(w io.Writer) (int, int, error) {
+	cw := csv.NewWriter(w)
+	header := []string{"event_id", "trip_id", "timestamp", "latitude", "longitude"}
+	if g.cfg.ExtendedAttributes {
+		header = append(header, "battery_level", "speed_kmh", "rider_hash")
+	}
+	if err := cw.Write(header); err != nil {
+		return 0, 0, err
+	}
+	b := g.cfg.BBox
+	events := 0
+	for trip := 0; trip < g.cfg.NumTrips; trip++ {
+		tripID := g.uuid()
+		start := g.cfg.Start.Add(time.Duration(g.rng.Int63n(int64(g.cfg.Span) + 1))).Truncate(time.Second)
+		duration := g.tripDuration()
+		lon, lat := g.randomPoint()
+		heading := g.rng.Float64() * 2 * math.Pi
+		speed := g.cfg.SpeedMs * (0.8 + 0.4*g.rng.Float64())
+		var walker *pathWalker
+		if g.cfg.Streets != nil {
+			walker = &pathWalker{path: g.cfg.Streets.randomPath(g.rng, speed*duration.Seconds())}
+			lon, lat = walker.path[0][0], walker.path[0][1]
+		}
+		// drawn only for extended attributes, so the other columns stay identical to datasets without them
+		var battery float64
+		var riderHash string
+		if g.cfg.ExtendedAttributes {
+			battery = 20 + 80*g.rng.Float64()
+			// riders take about three trips each
+			riderHash = fmt.Sprintf("%x", sha256.Sum256([]byte(strconv.Itoa(g.rng.Intn(g.cfg.NumTrips/3+1)))))
+		}
+
+		var gapEnd time.Duration
+		for elapsed := time.Duration(0); elapsed <= duration; {
+			// the first event is always reported, so that every trip has at least one
+			if elapsed > 0 && elapsed >= gapEnd && g.cfg.GapProbability > 0 && g.rng.Float64() < g.cfg.GapProbability {
+				gapEnd = elapsed + time.Duration(g.rng.ExpFloat64()*float64(g.cfg.GapMean))
+			}
+			if elapsed >= gapEnd {
+				reportedLon, reportedLat := g.addNoise(lon, lat)
+				record := []string{
+					g.uuid(), tripID, start.Add(elapsed).UTC().Format(time.RFC3339),
+					strconv.FormatFloat(reportedLat, 'f', 6, 64), strconv.FormatFloat(reportedLon, 'f', 6, 64),
+				}
+				if g.cfg.ExtendedAttributes {
+					record = append(record, strconv.Itoa(int(battery)), strconv.FormatFloat(speed*3.6, 'f', 1, 64), riderHash)
+				}
+				if err := cw.Write(record); err != nil {
+					return trip, events, err
+				}
+				events++
+			}
+
+			step := g.sampleStep()
+			elapsed += step
+			distance := speed * step.Seconds()
+			// about 1 % of the charge per kilometre
+			battery = max(0, battery-distance/1000)
+			if walker != nil {
+				position := walker.advance(distance)
+				lon, lat = position[0], position[1]
+				continue
+			}
+			heading += g.rng.NormFloat64() * 0.3
+			lat += distance * math.Cos(heading) / metresPerDegree
+			lon += distance * math.Sin(heading) / (metresPerDegree * math.Cos(lat*math.Pi/180))
+			if lon < b.MinLon || lon > b.MaxLon {
+				lon = max(b.MinLon, min(b.MaxLon, lon))
+				heading = -heading
+			}
+			if lat < b.MinLat || lat > b.MaxLat {
+				lat = max(b.MinLat, min(b.MaxLat, lat))
+				heading = math.Pi - heading
+			}
+		}
+	}
+	cw.Flush()
+	return g.cfg.NumTrips, events, cw.Error()
+}
+
+// sampleStep returns the time until the next event, the sample interval varied by the sample jitter
+func (g *SyntheticGenerator) sampleStep() time.Duration {
+	if g.cfg.SampleJitter == 0 {
+		return g.cfg.SampleInterval
+	}
+	return time.Duration(float64(g.cfg.SampleInterval) * (1 + g.cfg.SampleJitter*(2*g.rng.Float64()-1)))
+}
+
+// addNoise returns the position displaced by Gaussian noise of the configured deviation in metres
+func (g *SyntheticGenerator) addNoise(lon, lat float64) (float64, float64) {
+	if g.cfg.NoiseMetres == 0 {
+		return lon, lat
+	}
+	lat += g.rng.NormFloat64() * g.cfg.NoiseMetres / metresPerDegree
+	lon += g.rng.NormFloat64() * g.cfg.NoiseMetres / (metresPerDegree * math.Cos(lat*math.Pi/180))
+	return lon, lat
+}
+
+// WritePOIsCSV writes the POIs in the format LoadPOIs reads
+func WritePOIsCSV(w io.Writer, pois []POI) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"poi_id", "name", "category", "longitude", "latitude"})
+	for _, p := range pois {
+		cw.Write([]string{p.POIID, p.Name, p.Category, p.Longitude, p.Latitude})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteLocalitiesGeoJSON writes the localities as a FeatureCollection in the format LoadLocalities reads
+func WriteLocalitiesGeoJSON(w io.Writer, localities []Locality) error {
+	type feature struct {
+		Type       string            `json:"type"`
+		Properties map[string]string `json:"properties"`
+		Geometry   json.RawMessage   `json:"geometry"`
+	}
+	collection := struct {
+		Type     string    `json:"type"`
+		Features []feature `json:"features"`
+	}{Type: "FeatureCollection", Features: []feature{}}
+	for _, l := range localities {
+		collection.Features = append(collection.Features, feature{
+			Type:       "Feature",
+			Properties: map[string]string{"locality_id": l.LocalityID, "name": l.Name},
+			Geometry:   l.Geometry,
+		})
+	}
+	return json.NewEncoder(w).Encode(collection)
+}
@@ -0,0 +1,202 @@
+package workload
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// TemplateIssue is a reference of a query template to a field QueryFields doesn't have
+type TemplateIssue struct {
+	Template string
+	Line     int
+	Field    string // the reference, e.g. .TripId or $.TripId
+	Message  string
+}
+
+func (i TemplateIssue) String() string {
+	return fmt.Sprintf("template %s line %d: %s: %s", i.Template, i.Line, i.Field, i.Message)
+}
+
+// TemplateLintError lists the issues of the query templates of a file
+type TemplateLintError struct {
+	Filename string
+	Issues   []TemplateIssue
+}
+
+func (e *TemplateLintError) Error() string {
+	issues := make([]string, len(e.Issues))
+	for i, issue := range e.Issues {
+		issues[i] = issue.String()
+	}
+	return fmt.Sprintf("Query templates of %s reference unknown fields: %s", e.Filename, strings.Join(issues, "; "))
+}
+
+// benchmarkOnlyFields are the fields of QueryFields which are used by the benchmark and not by templates
+var benchmarkOnlyFields = []string{"TenantID"}
+
+// LintTemplates checks every field referenced with dot or $ in the templates against QueryFields,
+// before the first query is rendered. Fields referenced inside range and with, where dot is another value, are not checked,
+// except the fields of the variables of ranges over template functions like routePoints.
+func LintTemplates(templates *template.Template) []TemplateIssue {
+	var issues []TemplateIssue
+	for _, name := range TemplateNames(templates) {
+		tree := templates.Lookup(name).Tree
+		if tree == nil || tree.Root == nil {
+			continue
+		}
+		l := templateLinter{tree: tree, template: name}
+		l.walk(tree.Root, true)
+		issues = append(issues, l.issues...)
+	}
+	return issues
+}
+
+// UnusedQueryFields returns the fields of QueryFields no template references, which the generator generates in vain
+func UnusedQueryFields(templates *template.Template) []string {
+	used := make(map[string]bool)
+	for _, tmpl := range templates.Templates() {
+		if tmpl.Tree == nil || tmpl.Tree.Root == nil {
+			continue
+		}
+		l := templateLinter{tree: tmpl.Tree, template: tmpl.Name(), used: used}
+		l.walk(tmpl.Tree.Root, true)
+	}
+	var unused []string
+	for _, field := range reflect.VisibleFields(reflect.TypeFor[QueryFields]()) {
+		if !used[field.Name] && !slices.Contains(benchmarkOnlyFields, field.Name) {
+			unused = append(unused, field.Name)
+		}
+	}
+	return unused
+}
+
+type templateLinter struct {
+	tree     *parse.Tree
+	template string
+	issues   []TemplateIssue
+	used     map[string]bool
+	// types of the elements of the variables ranging over template functions, e.g. $p of range $i, $p := routePoints
+	vars map[string]reflect.Type
+}
+
+// rangeFuncElements are the element types of the template functions returning slices to range over
+var rangeFuncElements = map[string]reflect.Type{
+	"routePoints": reflect.TypeFor[RoutePoint](),
+}
+
+// walk checks the fields of the node, dotIsFields is false inside range and with
+func (l *templateLinter) walk(node parse.Node, dotIsFields bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			l.walk(child, dotIsFields)
+		}
+	case *parse.ActionNode:
+		l.walk(n.Pipe, dotIsFields)
+	case *parse.TemplateNode:
+		l.walk(n.Pipe, dotIsFields)
+	case *parse.IfNode:
+		l.walkBranch(&n.BranchNode, dotIsFields, dotIsFields)
+	case *parse.RangeNode:
+		l.declareRangeVar(n.Pipe)
+		l.walkBranch(&n.BranchNode, dotIsFields, false)
+	case *parse.WithNode:
+		l.walkBranch(&n.BranchNode, dotIsFields, false)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			l.walk(cmd, dotIsFields)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			l.walk(arg, dotIsFields)
+		}
+	case *parse.ChainNode:
+		l.walk(n.Node, dotIsFields)
+	case *parse.FieldNode:
+		if dotIsFields {
+			l.check(n, n.Ident, "."+strings.Join(n.Ident, "."))
+		}
+	case *parse.VariableNode:
+		// $ is always the fields, other variables are assigned inside the template
+		if n.Ident[0] == "$" && len(n.Ident) > 1 {
+			l.check(n, n.Ident[1:], n.String())
+		}
+		if element, ok := l.vars[n.Ident[0]]; ok && len(n.Ident) > 1 && l.used == nil {
+			if _, ok := element.FieldByName(n.Ident[1]); !ok {
+				l.issue(n, n.String(), fmt.Sprintf("%s has no field %s", element.Name(), n.Ident[1]))
+			}
+		}
+	}
+}
+
+// declareRangeVar records the element type of the variable of a range over a template function of rangeFuncElements
+func (l *templateLinter) declareRangeVar(pipe *parse.PipeNode) {
+	if pipe == nil || len(pipe.Decl) == 0 || len(pipe.Cmds) != 1 || len(pipe.Cmds[0].Args) == 0 {
+		return
+	}
+	function, ok := pipe.Cmds[0].Args[0].(*parse.IdentifierNode)
+	if !ok {
+		return
+	}
+	element, ok := rangeFuncElements[function.Ident]
+	if !ok {
+		return
+	}
+	if l.vars == nil {
+		l.vars = make(map[string]reflect.Type)
+	}
+	// the element is the last variable, range $p := or range $i, $p :=
+	l.vars[pipe.Decl[len(pipe.Decl)-1].Ident[0]] = element
+}
+
+// walkBranch checks the pipeline with the dot of the enclosing node, the list with the dot of the branch
+func (l *templateLinter) walkBranch(n *parse.BranchNode, dotIsFields, listDotIsFields bool) {
+	l.walk(n.Pipe, dotIsFields)
+	l.walk(n.List, listDotIsFields)
+	l.walk(n.ElseList, dotIsFields)
+}
+
+// check reports the reference to the field ident if QueryFields doesn't have it, or marks the field as used
+func (l *templateLinter) check(node parse.Node, ident []string, reference string) {
+	if l.used != nil {
+		l.used[ident[0]] = true
+		return
+	}
+	field, ok := reflect.TypeFor[QueryFields]().FieldByName(ident[0])
+	switch {
+	case !ok:
+		l.issue(node, reference, fmt.Sprintf("QueryFields has no field %s%s", ident[0], suggestField(ident[0])))
+	case len(ident) > 1:
+		l.issue(node, reference, fmt.Sprintf("%s is a %s without fields", ident[0], field.Type))
+	}
+}
+
+func (l *templateLinter) issue(node parse.Node, field, message string) {
+	location, _ := l.tree.ErrorContext(node)
+	// the location is template:line:column
+	line := 0
+	if parts := strings.Split(location, ":"); len(parts) >= 3 {
+		fmt.Sscanf(parts[len(parts)-2], "%d", &line)
+	}
+	l.issues = append(l.issues, TemplateIssue{Template: l.template, Line: line, Field: field, Message: message})
+}
+
+// suggestField returns a hint to the field differing only in case, e.g. TripId for TripID
+func suggestField(name string) string {
+	for _, field := range reflect.VisibleFields(reflect.TypeFor[QueryFields]()) {
+		if strings.EqualFold(field.Name, name) {
+			return fmt.Sprintf(", did you mean %s?", field.Name)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,90 @@
+package workload
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestLintTemplates(t *testing.T) {
+	tests := []struct {
+		name      string
+		templates string
+		want      []TemplateIssue
+	}{
+		{name: "known fields", templates: `{{define "trip"}}SELECT * FROM trips WHERE trip_id = '{{.TripID}}' LIMIT {{$.Limit}}{{end}}`},
+		{name: "unknown field", templates: "{{define \"trip\"}}SELECT *\nFROM trips WHERE trip_id = '{{.TripId}}'{{end}}",
+			want: []TemplateIssue{{Template: "trip", Line: 2, Field: ".TripId", Message: "QueryFields has no field TripId, did you mean TripID?"}}},
+		{name: "unknown field of $", templates: "{{define \"poi\"}}\n\nSELECT {{$.Poi}}{{end}}",
+			want: []TemplateIssue{{Template: "poi", Line: 3, Field: "$.Poi", Message: "QueryFields has no field Poi"}}},
+		{name: "field of a field", templates: `{{define "trip"}}{{.TripID.Value}}{{end}}`,
+			want: []TemplateIssue{{Template: "trip", Line: 1, Field: ".TripID.Value", Message: "TripID is a string without fields"}}},
+		// dot is the element inside range, only the ranged over field is checked
+		{name: "range", templates: `{{define "trips"}}{{range .Trips}}{{.Unchecked}}{{end}}{{end}}`,
+			want: []TemplateIssue{{Template: "trips", Line: 1, Field: ".Trips", Message: "QueryFields has no field Trips"}}},
+		{name: "range over routePoints", templates: "{{define \"route\"}}{{range $i, $p := routePoints .RouteWKT}}\n{{$p.Latitude}} {{$p.Lat}}{{end}}{{end}}",
+			want: []TemplateIssue{{Template: "route", Line: 2, Field: "$p.Lat", Message: "RoutePoint has no field Lat"}}},
+		{name: "issues of several templates", templates: `{{define "b"}}{{.B}}{{end}}{{define "a"}}{{.A}}{{end}}`,
+			want: []TemplateIssue{
+				{Template: "a", Line: 1, Field: ".A", Message: "QueryFields has no field A"},
+				{Template: "b", Line: 1, Field: ".B", Message: "QueryFields has no field B"},
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			templates := template.Must(template.New("queries.tmpl").Funcs(QueryTemplateFuncs).Parse(tt.templates))
+			if got := LintTemplates(templates); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LintTemplates =\n%v\nwant\n%v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadTemplates(t *testing.T) {
+	tests := []struct {
+		name       string
+		templates  string
+		wantIssues []TemplateIssue
+		wantErr    string
+	}{
+		{name: "valid", templates: "{{define \"trip\"}}\nSELECT * FROM trips WHERE trip_id = '{{.TripID}}'\n{{end}}"},
+		{name: "unknown field", templates: "{{define \"trip\"}}\nSELECT * FROM trips WHERE trip_id = '{{.TripId}}'\n{{end}}",
+			wantIssues: []TemplateIssue{{Template: "trip", Line: 2, Field: ".TripId", Message: "QueryFields has no field TripId, did you mean TripID?"}},
+			wantErr:    "queries.tmpl reference unknown fields: template trip line 2: .TripId: QueryFields has no field TripId, did you mean TripID?"},
+		{name: "parse error", templates: "{{define \"trip\"}}\nSELECT {{.TripID}\n{{end}}", wantErr: "queries.tmpl:2: bad character"},
+		{name: "unknown function", templates: "{{define \"trip\"}}\n\nSELECT {{quote .TripID}}\n{{end}}", wantErr: `queries.tmpl:3: function "quote" not defined`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			filename := filepath.Join(dir, "queries.tmpl")
+			if err := os.WriteFile(filename, []byte(tt.templates), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			templates, err := LoadTemplates(filename)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("LoadTemplates failed: %v", err)
+				}
+				if names := TemplateNames(templates); !reflect.DeepEqual(names, []string{"trip"}) {
+					t.Errorf("TemplateNames = %v, want [trip]", names)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("LoadTemplates error = %v, want one containing %q", err, tt.wantErr)
+			}
+			var lintErr *TemplateLintError
+			if errors.As(err, &lintErr) != (tt.wantIssues != nil) {
+				t.Fatalf("LoadTemplates error %T, want a *TemplateLintError %v", err, tt.wantIssues != nil)
+			}
+			if lintErr != nil && (lintErr.Filename != filename || !reflect.DeepEqual(lintErr.Issues, tt.wantIssues)) {
+				t.Errorf("TemplateLintError of %s = %v, want %s, %v", lintErr.Filename, lintErr.Issues, filename, tt.wantIssues)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package workload
+
+import (
+	"hash/fnv"
+	"math"
+	"sort"
+)
+
+// TenantDistribution spreads trips and queries across tenants numbered from 1,
+// tenant i gets a share proportional to 1/i^skew, so skew 0 spreads them evenly
+type TenantDistribution struct {
+	cumulative []float64 // upper bound of the share of each tenant in [0, 1]
+}
+
+func NewTenantDistribution(tenants int, skew float64) *TenantDistribution {
+	weights := make([]float64, tenants)
+	total := 0.0
+	for i := range weights {
+		weights[i] = 1 / math.Pow(float64(i+1), skew)
+		total += weights[i]
+	}
+	cumulative := make([]float64, tenants)
+	sum := 0.0
+	for i, w := range weights {
+		sum += w / total
+		cumulative[i] = sum
+	}
+	cumulative[tenants-1] = 1
+	return &TenantDistribution{cumulative: cumulative}
+}
+
+// Tenants returns the number of tenants
+func (d *TenantDistribution) Tenants() int {
+	return len(d.cumulative)
+}
+
+// Share returns the fraction of the trips and queries going to the tenant
+func (d *TenantDistribution) Share(tenant int) float64 {
+	if tenant == 1 {
+		return d.cumulative[0]
+	}
+	return d.cumulative[tenant-1] - d.cumulative[tenant-2]
+}
+
+// Pick returns the tenant of u uniformly distributed in [0, 1)
+func (d *TenantDistribution) Pick(u float64) int {
+	i := sort.SearchFloat64s(d.cumulative, u)
+	// u equal to a bound belongs to the next tenant
+	if i < len(d.cumulative)-1 && d.cumulative[i] == u {
+		i++
+	}
+	return min(i, len(d.cumulative)-1) + 1
+}
+
+// TripTenant returns the tenant owning the trip, all events of a trip belong to the same tenant in every run
+func (d *TenantDistribution) TripTenant(tripID string) int {
+	h := fnv.New64a()
+	h.Write([]byte(tripID))
+	return d.Pick(float64(h.Sum64()>>11) / (1 << 53))
+}
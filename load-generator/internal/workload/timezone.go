@@ -0,0 +1,79 @@
+package workload
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultDatasetTimezone is the time zone of the e-scooter datasets, which were recorded in Berlin
+const DefaultDatasetTimezone = "Europe/Berlin"
+
+// datasetLocation is the time zone of dataset timestamps without an offset and of the time bounds of generated queries,
+// nil until SetDatasetLocation. It is read by the workers concurrently, so it is set before they start.
+var datasetLocation atomic.Pointer[time.Location]
+
+// defaultDatasetLocation loads DefaultDatasetTimezone once for all workers
+var defaultDatasetLocation = sync.OnceValues(func() (*time.Location, error) {
+	location, err := time.LoadLocation(DefaultDatasetTimezone)
+	if err != nil {
+		return nil, fmt.Errorf("Loading the default dataset time zone %s: %w", DefaultDatasetTimezone, err)
+	}
+	return location, nil
+})
+
+// SetDatasetLocation sets the time zone of dataset timestamps without an offset and of the time bounds of generated queries,
+// nil restores DefaultDatasetTimezone
+func SetDatasetLocation(location *time.Location) {
+	datasetLocation.Store(location)
+}
+
+// DatasetLocation returns the time zone set by SetDatasetLocation, DefaultDatasetTimezone if none was set.
+// It fails only if none was set and the time zone database lacks DefaultDatasetTimezone.
+func DatasetLocation() (*time.Location, error) {
+	if location := datasetLocation.Load(); location != nil {
+		return location, nil
+	}
+	return defaultDatasetLocation()
+}
+
+// timestampLayouts are the accepted layouts of timestamps with an offset, e.g. RFC3339 or the text output of Postgres
+var timestampLayouts = []string{time.RFC3339, "2006-01-02 15:04:05Z07:00", "2006-01-02 15:04:05Z07"}
+
+// localTimestampLayouts are the accepted layouts of timestamps without an offset, which are in the dataset time zone
+var localTimestampLayouts = []string{"2006-01-02T15:04:05", "2006-01-02 15:04:05"}
+
+// ParseTimestamp parses a dataset timestamp, timestamps without an offset are in the time zone of DatasetLocation.
+// Fractional seconds are accepted in all layouts.
+func ParseTimestamp(s string) (time.Time, error) {
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	location, err := DatasetLocation()
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, layout := range localTimestampLayouts {
+		if t, err := time.ParseInLocation(layout, s, location); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Unparseable timestamp %q, expected RFC3339 or 2006-01-02 15:04:05 in %s", s, location)
+}
+
+// FormatTimestamp formats the time as RFC3339 in UTC, the form of all timestamps sent to the databases
+func FormatTimestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// NormalizeTimestamp returns the dataset timestamp as RFC3339 in UTC, see ParseTimestamp
+func NormalizeTimestamp(s string) (string, error) {
+	t, err := ParseTimestamp(s)
+	if err != nil {
+		return "", err
+	}
+	return FormatTimestamp(t), nil
+}
@@ -0,0 +1,207 @@
+package workload
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func setDatasetTimezone(t *testing.T, name string) {
+	t.Helper()
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("Loading time zone %s: %v", name, err)
+	}
+	SetDatasetLocation(location)
+	t.Cleanup(func() { SetDatasetLocation(nil) })
+}
+
+func TestNormalizeTimestamp(t *testing.T) {
+	setDatasetTimezone(t, "Europe/Berlin")
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"2024-06-01T21:40:19Z", "2024-06-01T21:40:19Z"},
+		{"2024-06-01T23:40:19+02:00", "2024-06-01T21:40:19Z"},
+		{"2024-06-01T21:40:19.25Z", "2024-06-01T21:40:19.25Z"},
+		{"2024-06-01 21:40:19+00", "2024-06-01T21:40:19Z"},
+		// without an offset in the dataset time zone, summer and winter time
+		{"2024-06-01T21:40:19", "2024-06-01T19:40:19Z"},
+		{"2024-06-01 21:40:19", "2024-06-01T19:40:19Z"},
+		{"2024-01-15 08:00:00.5", "2024-01-15T07:00:00.5Z"},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeTimestamp(tt.in)
+		if err != nil {
+			t.Errorf("NormalizeTimestamp(%q) failed: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("NormalizeTimestamp(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "notatime", "2024-06-01", "01.06.2024 21:40"} {
+		if got, err := NormalizeTimestamp(in); err == nil {
+			t.Errorf("NormalizeTimestamp(%q) = %q, want error", in, got)
+		}
+	}
+}
+
+func TestNormalizeTimestampDatasetTimezone(t *testing.T) {
+	setDatasetTimezone(t, "UTC")
+	if got, _ := NormalizeTimestamp("2024-06-01 21:40:19"); got != "2024-06-01T21:40:19Z" {
+		t.Errorf("timestamp without offset in UTC normalized to %q", got)
+	}
+	setDatasetTimezone(t, "America/Chicago")
+	if got, _ := NormalizeTimestamp("2024-06-01 21:40:19"); got != "2024-06-02T02:40:19Z" {
+		t.Errorf("timestamp without offset in America/Chicago normalized to %q", got)
+	}
+	// timestamps with an offset don't depend on the dataset time zone
+	if got, _ := NormalizeTimestamp("2024-06-01T21:40:19Z"); got != "2024-06-01T21:40:19Z" {
+		t.Errorf("timestamp with offset normalized to %q", got)
+	}
+}
+
+func TestDatasetLocationConcurrently(t *testing.T) {
+	SetDatasetLocation(nil)
+	// the workers load the default time zone concurrently, run with -race
+	var wg sync.WaitGroup
+	locations := make([]*time.Location, 8)
+	for i := range locations {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			location, err := DatasetLocation()
+			if err != nil {
+				t.Errorf("DatasetLocation failed: %v", err)
+			}
+			locations[i] = location
+		}()
+	}
+	wg.Wait()
+	for _, location := range locations {
+		if location != locations[0] || location.String() != DefaultDatasetTimezone {
+			t.Errorf("DatasetLocation = %v, want the single %s", location, DefaultDatasetTimezone)
+		}
+	}
+}
+
+func TestTripEventReaderNormalizesTimestamps(t *testing.T) {
+	setDatasetTimezone(t, "Europe/Berlin")
+	filename := filepath.Join(t.TempDir(), "trips.csv")
+	content := "event_id,trip_id,timestamp,latitude,longitude\n" +
+		"e1,t1,2024-06-01 10:00:00,52.5,13.4\n" +
+		"e2,t1,2024-06-01T08:00:10Z,52.5,13.4\n" +
+		"e3,t1,notatime,52.5,13.4\n"
+	if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := OpenTripEvents(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for _, want := range []string{"2024-06-01T08:00:00Z", "2024-06-01T08:00:10Z", "notatime"} {
+		event, err := r.Next()
+		if err != nil {
+			t.Fatalf("Next failed: %v", err)
+		}
+		if event.Timestamp != want {
+			t.Errorf("event %s has timestamp %q, want %q", event.EventID, event.Timestamp, want)
+		}
+	}
+}
+
+func TestStrictTripEventReaderRejectsUnparseableTimestamps(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "trips.csv")
+	content := "event_id,trip_id,timestamp,latitude,longitude\n" +
+		"e1,t1,2024-06-01 10:00:00,52.5,13.4\n" +
+		"e2,t1,notatime,52.5,13.4\n"
+	if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := OpenTripEvents(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.Strict()
+
+	if _, err := r.Next(); err != nil {
+		t.Fatalf("timestamp without offset rejected: %v", err)
+	}
+	_, err = r.Next()
+	badRow, ok := err.(*BadRowError)
+	if !ok || badRow.Line != 3 || !strings.Contains(badRow.Reason, "timestamp") {
+		t.Errorf("unparseable timestamp returned %v, want BadRowError of line 3", err)
+	}
+}
+
+func TestParseTripEventMessageNormalizesTimestamps(t *testing.T) {
+	setDatasetTimezone(t, "Europe/Berlin")
+	for _, msg := range []string{
+		`{"event_id":"e1","trip_id":"t1","timestamp":"2024-06-01 10:00:00","latitude":52.5,"longitude":13.4}`,
+		`e1,t1,2024-06-01T10:00:00+02:00,52.5,13.4`,
+	} {
+		event, err := ParseTripEventMessage([]byte(msg))
+		if err != nil {
+			t.Fatalf("ParseTripEventMessage(%s) failed: %v", msg, err)
+		}
+		if event.Timestamp != "2024-06-01T08:00:00Z" {
+			t.Errorf("ParseTripEventMessage(%s) has timestamp %q", msg, event.Timestamp)
+		}
+	}
+}
+
+func TestQueryFieldsIndependentOfLocalTimezone(t *testing.T) {
+	setDatasetTimezone(t, "Europe/Berlin")
+	localities := []Locality{{LocalityID: "l1"}}
+	pois := []POI{{POIID: "p1"}}
+	tripIDs := []string{"t1"}
+
+	local := time.Local
+	t.Cleanup(func() { time.Local = local })
+	generate := func(localName string) QueryFields {
+		location, err := time.LoadLocation(localName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		time.Local = location
+		g, err := NewQueryFieldGenerator(42, localities, pois, tripIDs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return g.GenerateFields(7)
+	}
+
+	utc := generate("UTC")
+	for _, name := range []string{"America/Chicago", "Asia/Tokyo"} {
+		if fields := generate(name); fields != utc {
+			t.Errorf("fields with local time zone %s = %+v, want %+v", name, fields, utc)
+		}
+	}
+	for _, ts := range []string{utc.StartTime, utc.EndTime, utc.Timestamp} {
+		if !strings.HasSuffix(ts, "Z") {
+			t.Errorf("generated timestamp %q is not in UTC", ts)
+		}
+	}
+
+	// the time bounds are in the dataset time zone, the same seed shifts by its offset
+	setDatasetTimezone(t, "UTC")
+	g, err := NewQueryFieldGenerator(42, localities, pois, tripIDs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shifted := g.GenerateFields(7)
+	berlinStart, _ := time.Parse(time.RFC3339, utc.StartTime)
+	utcStart, _ := time.Parse(time.RFC3339, shifted.StartTime)
+	if diff := utcStart.Sub(berlinStart); diff != time.Hour {
+		t.Errorf("start time with dataset time zone UTC is %s after Europe/Berlin, want 1h", diff)
+	}
+}
@@ -0,0 +1,235 @@
+package workload
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// the checks of ValidateTripsCSV and ValidatePOIsCSV
+const (
+	CheckMissingColumns = "missing-columns"
+	CheckSyntax         = "csv-syntax"
+	CheckColumnCount    = "column-count"
+	CheckUUID           = "uuid"
+	CheckTimestamp      = "timestamp"
+	CheckCoordinates    = "coordinates"
+	CheckMonotonic      = "monotonic"
+)
+
+// ValidationCheck is the result of one check of a dataset file: the number of offending lines
+// and the first of them with a description of the problem
+type ValidationCheck struct {
+	Offending int              `json:"offending"`
+	Lines     []ValidationLine `json:"lines"`
+}
+
+type ValidationLine struct {
+	Line    int    `json:"line"`
+	Problem string `json:"problem"`
+}
+
+// ValidationReport lists the offending lines of a dataset file by check
+type ValidationReport struct {
+	File   string                      `json:"file"`
+	Kind   string                      `json:"kind"`
+	Rows   int                         `json:"rows"`
+	Checks map[string]*ValidationCheck `json:"checks"`
+
+	maxLines int
+}
+
+func newValidationReport(file, kind string, maxLines int, checks ...string) *ValidationReport {
+	r := &ValidationReport{File: file, Kind: kind, Checks: make(map[string]*ValidationCheck), maxLines: maxLines}
+	for _, check := range checks {
+		r.Checks[check] = &ValidationCheck{Lines: []ValidationLine{}}
+	}
+	return r
+}
+
+func (r *ValidationReport) add(check string, line int, format string, args ...any) {
+	c := r.Checks[check]
+	c.Offending++
+	if len(c.Lines) < r.maxLines {
+		c.Lines = append(c.Lines, ValidationLine{Line: line, Problem: fmt.Sprintf(format, args...)})
+	}
+}
+
+// Valid reports whether no check found offending lines
+func (r *ValidationReport) Valid() bool {
+	for _, c := range r.Checks {
+		if c.Offending > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckNames returns the names of the checks in a fixed order
+func (r *ValidationReport) CheckNames() []string {
+	names := make([]string, 0, len(r.Checks))
+	for name := range r.Checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateColumns checks the header for the expected columns in their order and returns whether the rows can be checked
+func (r *ValidationReport) validateColumns(header, expected []string) bool {
+	for i := range header {
+		header[i] = strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff"))
+	}
+	var missing []string
+	for i, column := range expected {
+		if i >= len(header) || header[i] != column {
+			missing = append(missing, column)
+		}
+	}
+	if len(missing) > 0 {
+		r.add(CheckMissingColumns, 1, "expected the columns %s, missing or misplaced: %s",
+			strings.Join(expected, ","), strings.Join(missing, ","))
+		return false
+	}
+	return true
+}
+
+// validateCoordinates checks that the latitude and longitude parse and lie in the WGS 84 ranges
+func (r *ValidationReport) validateCoordinates(line int, latitude, longitude string) {
+	lat, err1 := strconv.ParseFloat(latitude, 64)
+	lon, err2 := strconv.ParseFloat(longitude, 64)
+	switch {
+	case err1 != nil || err2 != nil:
+		r.add(CheckCoordinates, line, "unparseable latitude %q or longitude %q", latitude, longitude)
+	case lat < -90 || lat > 90 || lon < -180 || lon > 180:
+		r.add(CheckCoordinates, line, "latitude %s or longitude %s out of range", latitude, longitude)
+	}
+}
+
+// ValidateTripsCSV checks every line of a trip events CSV: the columns, the UUIDs of events and trips,
+// RFC 3339 timestamps, coordinate ranges and timestamps not decreasing within a trip.
+// Up to maxLines offending lines are listed per check.
+func ValidateTripsCSV(ctx context.Context, path string, maxLines int) (*ValidationReport, error) {
+	f, err := OpenInput(path)
+	if err != nil {
+		return nil, fmt.Errorf("Opening trip events file: %w", err)
+	}
+	defer f.Close()
+	report := newValidationReport(path, "trips", maxLines,
+		CheckMissingColumns, CheckSyntax, CheckColumnCount, CheckUUID, CheckTimestamp, CheckCoordinates, CheckMonotonic)
+
+	cr := csv.NewReader(f)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err == io.EOF {
+		report.add(CheckMissingColumns, 1, "empty file")
+		return report, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Reading trip events header: %w", err)
+	}
+	columns := []string{"event_id", "trip_id", "timestamp", "latitude", "longitude"}
+	if !report.validateColumns(header, columns) {
+		return report, nil
+	}
+
+	lastTimestamps := make(map[string]time.Time)
+	for ctx.Err() == nil {
+		rec, err := cr.Read()
+		var parseErr *csv.ParseError
+		if err == io.EOF {
+			break
+		} else if errors.As(err, &parseErr) {
+			report.Rows++
+			report.add(CheckSyntax, parseErr.Line, "%v", parseErr.Err)
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("Reading trip events: %w", err)
+		}
+		line, _ := cr.FieldPos(0)
+		report.Rows++
+		if len(rec) != len(columns) {
+			report.add(CheckColumnCount, line, "%d columns, expected %d", len(rec), len(columns))
+			continue
+		}
+
+		event := TripEvent{EventID: rec[0], TripID: rec[1], Timestamp: rec[2], Latitude: rec[3], Longitude: rec[4]}
+		if !uuidPattern.MatchString(event.EventID) {
+			report.add(CheckUUID, line, "invalid event_id %q", event.EventID)
+		}
+		if !uuidPattern.MatchString(event.TripID) {
+			report.add(CheckUUID, line, "invalid trip_id %q", event.TripID)
+		}
+		report.validateCoordinates(line, event.Latitude, event.Longitude)
+		timestamp, err := ParseTimestamp(event.Timestamp)
+		if err != nil {
+			report.add(CheckTimestamp, line, "unparseable timestamp %q", event.Timestamp)
+			continue
+		}
+		if last, ok := lastTimestamps[event.TripID]; ok && timestamp.Before(last) {
+			report.add(CheckMonotonic, line, "timestamp %s of trip %s before the previous event at %s",
+				event.Timestamp, event.TripID, last.Format(time.RFC3339))
+		} else {
+			lastTimestamps[event.TripID] = timestamp
+		}
+	}
+	return report, ctx.Err()
+}
+
+// ValidatePOIsCSV checks every line of a POI CSV: the columns, the UUIDs and coordinate ranges.
+// Up to maxLines offending lines are listed per check.
+func ValidatePOIsCSV(ctx context.Context, path string, maxLines int) (*ValidationReport, error) {
+	f, err := OpenInput(path)
+	if err != nil {
+		return nil, fmt.Errorf("Opening POIs file: %w", err)
+	}
+	defer f.Close()
+	report := newValidationReport(path, "pois", maxLines, CheckMissingColumns, CheckSyntax, CheckColumnCount, CheckUUID, CheckCoordinates)
+
+	cr := csv.NewReader(f)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err == io.EOF {
+		report.add(CheckMissingColumns, 1, "empty file")
+		return report, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Reading POIs header: %w", err)
+	}
+	columns := []string{"poi_id", "name", "category", "longitude", "latitude"}
+	if !report.validateColumns(header, columns) {
+		return report, nil
+	}
+
+	for ctx.Err() == nil {
+		rec, err := cr.Read()
+		var parseErr *csv.ParseError
+		if err == io.EOF {
+			break
+		} else if errors.As(err, &parseErr) {
+			report.Rows++
+			report.add(CheckSyntax, parseErr.Line, "%v", parseErr.Err)
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("Reading POIs: %w", err)
+		}
+		line, _ := cr.FieldPos(0)
+		report.Rows++
+		if len(rec) != len(columns) {
+			report.add(CheckColumnCount, line, "%d columns, expected %d", len(rec), len(columns))
+			continue
+		}
+		if !uuidPattern.MatchString(rec[0]) {
+			report.add(CheckUUID, line, "invalid poi_id %q", rec[0])
+		}
+		report.validateCoordinates(line, rec[4], rec[3])
+	}
+	return report, ctx.Err()
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// directories the data volume and the config map are mounted at in the agent pods
+const (
+	k8sDataDir   = "/data"
+	k8sConfigDir = "/config"
+)
+
+var k8sNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// k8sManifest are the values of the manifest template
+type k8sManifest struct {
+	Name            string
+	Namespace       string
+	Image           string
+	RunID           string
+	Agents          int
+	Port            int
+	CoordinatorArgs []string
+	AgentArgs       []string
+	DataPVC         string
+	ResultsPVC      string
+	ConfigFiles     map[string]string // file name to content
+	DBSecret        string
+	AgentCPU        string
+	AgentMemory     string
+	CollectTimeout  int // seconds the collector keeps the results available
+}
+
+var k8sManifestTemplate = template.Must(template.New("manifest").Funcs(template.FuncMap{
+	"quote":  strconv.Quote,
+	"indent": func(n int, s string) string { return strings.ReplaceAll(s, "\n", "\n"+strings.Repeat(" ", n)) },
+}).Parse(`# Distributed {{index .CoordinatorArgs 0}} run {{.RunID}} with {{.Agents}} agents, apply with: kubectl apply -f <file>
+# The collector container of the coordinator pod keeps the results for {{.CollectTimeout}}s after the run, copy them with:
+# kubectl cp -n {{.Namespace}} -c collector $(kubectl get pod -n {{.Namespace}} -l job-name={{.Name}}-coordinator -o name | cut -d/ -f2):/results ./results
+{{- if .ConfigFiles}}
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{.Name}}-config
+  namespace: {{.Namespace}}
+  labels:
+    app.kubernetes.io/name: load-generator
+    app.kubernetes.io/instance: {{.Name}}
+data:
+{{- range $file, $content := .ConfigFiles}}
+  {{quote $file}}: |
+    {{indent 4 $content}}
+{{- end}}
+{{- end}}
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: {{.Name}}-coordinator
+  namespace: {{.Namespace}}
+  labels:
+    app.kubernetes.io/name: load-generator
+    app.kubernetes.io/instance: {{.Name}}
+spec:
+  selector:
+    app.kubernetes.io/instance: {{.Name}}
+    app.kubernetes.io/component: coordinator
+  ports:
+    - name: grpc
+      port: {{.Port}}
+      targetPort: {{.Port}}
+---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: {{.Name}}-coordinator
+  namespace: {{.Namespace}}
+  labels:
+    app.kubernetes.io/name: load-generator
+    app.kubernetes.io/instance: {{.Name}}
+    app.kubernetes.io/component: coordinator
+spec:
+  backoffLimit: 0
+  template:
+    metadata:
+      labels:
+        app.kubernetes.io/name: load-generator
+        app.kubernetes.io/instance: {{.Name}}
+        app.kubernetes.io/component: coordinator
+    spec:
+      restartPolicy: Never
+      containers:
+        - name: coordinator
+          image: {{quote .Image}}
+          args:
+            - coordinator
+            - -listen=:{{.Port}}
+            - -agents={{.Agents}}
+            - -results-dir=/results
+{{- range .CoordinatorArgs}}
+            - {{quote .}}
+{{- end}}
+          env:
+            - name: LOADGEN_RUN_ID
+              value: {{quote .RunID}}
+          ports:
+            - name: grpc
+              containerPort: {{.Port}}
+          volumeMounts:
+            - name: results
+              mountPath: /results
+        - name: collector
+          image: busybox:1.36
+          command: ["sh", "-c"]
+          args:
+            - |
+              until ls /results/distributed_*.json >/dev/null 2>&1; do sleep 5; done
+              echo "Results of run {{.RunID}} are ready in /results for {{.CollectTimeout}}s"
+              sleep {{.CollectTimeout}}
+          volumeMounts:
+            - name: results
+              mountPath: /results
+      volumes:
+        - name: results
+{{- if .ResultsPVC}}
+          persistentVolumeClaim:
+            claimName: {{.ResultsPVC}}
+{{- else}}
+          emptyDir: {}
+{{- end}}
+---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: {{.Name}}-agents
+  namespace: {{.Namespace}}
+  labels:
+    app.kubernetes.io/name: load-generator
+    app.kubernetes.io/instance: {{.Name}}
+    app.kubernetes.io/component: agent
+spec:
+  # an agent can't rejoin a started run, failed agents are reported to the coordinator instead
+  backoffLimit: 0
+  parallelism: {{.Agents}}
+  completions: {{.Agents}}
+  template:
+    metadata:
+      labels:
+        app.kubernetes.io/name: load-generator
+        app.kubernetes.io/instance: {{.Name}}
+        app.kubernetes.io/component: agent
+    spec:
+      restartPolicy: Never
+      affinity:
+        # one agent per node, so their network stacks don't share a host
+        podAntiAffinity:
+          preferredDuringSchedulingIgnoredDuringExecution:
+            - weight: 100
+              podAffinityTerm:
+                topologyKey: kubernetes.io/hostname
+                labelSelector:
+                  matchLabels:
+                    app.kubernetes.io/instance: {{.Name}}
+                    app.kubernetes.io/component: agent
+      containers:
+        - name: agent
+          image: {{quote .Image}}
+          args:
+{{- range .AgentArgs}}
+            - {{quote .}}
+{{- end}}
+{{- if .DBSecret}}
+          env:
+            - name: LOADGEN_DB_URL
+              valueFrom:
+                secretKeyRef:
+                  name: {{.DBSecret}}
+                  key: url
+{{- end}}
+{{- if or .AgentCPU .AgentMemory}}
+          resources:
+            requests:
+{{- if .AgentCPU}}
+              cpu: {{quote .AgentCPU}}
+{{- end}}
+{{- if .AgentMemory}}
+              memory: {{quote .AgentMemory}}
+{{- end}}
+{{- end}}
+          volumeMounts:
+            - name: results
+              mountPath: /results
+{{- if .DataPVC}}
+            - name: data
+              mountPath: ` + k8sDataDir + `
+              readOnly: true
+{{- end}}
+{{- if .ConfigFiles}}
+            - name: config
+              mountPath: ` + k8sConfigDir + `
+{{- end}}
+      volumes:
+        - name: results
+          emptyDir: {}
+{{- if .DataPVC}}
+        - name: data
+          persistentVolumeClaim:
+            claimName: {{.DataPVC}}
+            readOnly: true
+{{- end}}
+{{- if .ConfigFiles}}
+        - name: config
+          configMap:
+            name: {{.Name}}-config
+{{- end}}
+`))
+
+func runK8sManifest(args []string) {
+	fs := newFlagSet("k8s-manifest", "Render the Kubernetes manifests of a distributed run: a Job of the coordinator with a Service and a result collector,\na Job of the agents and a ConfigMap of the query templates or other config files.\nThe command flags are passed to the coordinator like for 'coordinator', paths of the data volume start with "+k8sDataDir+",\nthe config files are mounted at "+k8sConfigDir+", e.g.\nk8s-manifest -agents 8 -data-pvc trips -config-files schemas/cratedb-simple-read-queries.tmpl query -queries "+k8sConfigDir+"/cratedb-simple-read-queries.tmpl\nUsage: k8s-manifest [flags] insert|query [command flags]")
+	name := fs.String("name", "loadgen", "Name prefix of the Kubernetes objects, lowercase letters, digits and dashes")
+	namespace := fs.String("namespace", "default", "Namespace of the Kubernetes objects")
+	image := fs.String("image", "load-generator:latest", "Container image of the load-generator")
+	numAgents := fs.Int("agents", 2, "Number of agent pods")
+	port := fs.Int("port", 7070, "Port of the coordinator's gRPC service")
+	dataPVC := fs.String("data-pvc", "", "PersistentVolumeClaim with the datasets, mounted read-only at "+k8sDataDir+" in the agent pods")
+	resultsPVC := fs.String("results-pvc", "", "PersistentVolumeClaim the coordinator writes the merged results to, an emptyDir collected with kubectl cp if empty")
+	configFiles := fs.String("config-files", "", "Comma separated files put into the ConfigMap and mounted at "+k8sConfigDir+" in the agent pods, e.g. query templates")
+	dbSecret := fs.String("db-secret", "", "Secret with the connection string of the database in the key url, set as LOADGEN_DB_URL of the agents")
+	agentCPU := fs.String("agent-cpu", "", "CPU request of an agent pod, e.g. 2")
+	agentMemory := fs.String("agent-memory", "", "Memory request of an agent pod, e.g. 2Gi")
+	collectTimeout := fs.Duration("collect-timeout", time.Hour, "How long the collector keeps the results available for kubectl cp after the run")
+	out := fs.String("out", "-", "File to write the manifests to, - writes to stdout. An existing file is not overwritten")
+	fs.Parse(args)
+
+	logger = slog.New(slog.NewJSONHandler(os.Stderr, nil))
+
+	mode := fs.Arg(0)
+	if mode != "insert" && mode != "query" {
+		logger.Error("Invalid CLI argument", "argument", "mode", "error", fmt.Sprintf("expected insert or query after the flags, got %q", mode))
+		os.Exit(exitConfig)
+	}
+	if !k8sNamePattern.MatchString(*name) || len(*name) > 40 {
+		logger.Error("Invalid CLI argument", "argument", "name", "error", "expected at most 40 lowercase letters, digits and dashes")
+		os.Exit(exitConfig)
+	}
+	if *numAgents < 1 {
+		logger.Error("Invalid CLI argument", "argument", "agents", "error", "expected at least one agent")
+		os.Exit(exitConfig)
+	}
+
+	manifest := k8sManifest{
+		Name:            *name,
+		Namespace:       *namespace,
+		Image:           *image,
+		RunID:           envOrDefault(runIDEnv, newUUID()),
+		Agents:          *numAgents,
+		Port:            *port,
+		CoordinatorArgs: append([]string{mode}, withoutFlag(fs.Args()[1:], "results-dir")...),
+		AgentArgs:       []string{"agent", fmt.Sprintf("-coordinator=%s-coordinator:%d", *name, *port), "-wait=10m", "-results-dir=/results"},
+		DataPVC:         *dataPVC,
+		ResultsPVC:      *resultsPVC,
+		DBSecret:        *dbSecret,
+		AgentCPU:        *agentCPU,
+		AgentMemory:     *agentMemory,
+		CollectTimeout:  int(collectTimeout.Seconds()),
+	}
+	if *configFiles != "" {
+		manifest.ConfigFiles = make(map[string]string)
+		for _, file := range strings.Split(*configFiles, ",") {
+			b, err := os.ReadFile(strings.TrimSpace(file))
+			if err != nil {
+				logger.Error("Unable to read config file", "filename", file, "error", err)
+				os.Exit(exitConfig)
+			}
+			manifest.ConfigFiles[filepath.Base(strings.TrimSpace(file))] = strings.TrimRight(string(b), "\n")
+		}
+	}
+
+	render := func(w io.Writer) error {
+		return k8sManifestTemplate.Execute(w, manifest)
+	}
+	if *out == "-" {
+		if err := render(os.Stdout); err != nil {
+			logger.Error("Unable to render manifests", "error", err)
+			os.Exit(exitFailure)
+		}
+		return
+	}
+	writeDatasetFile(*out, func(f *os.File) error { return render(f) })
+	logger.Info("Wrote Kubernetes manifests", "filename", *out, "runId", manifest.RunID, "agents", *numAgents)
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"load-generator/internal/targets"
+)
+
+const manifestVersion = 1
+
+// connection specific flags, they are redacted in the manifest and taken from the replaying environment
+var replayExcludedParams = map[string]bool{"db": true, "results-db": true}
+
+// RunManifest captures everything needed to re-execute the identical workload of a run
+type RunManifest struct {
+	Version   int                      `json:"version"`
+	RunID     string                   `json:"runId"`
+	Command   string                   `json:"command"`
+	CreatedAt time.Time                `json:"createdAt"`
+	Seed      *int64                   `json:"seed,omitempty"`
+	Params    map[string]string        `json:"params"`
+	Inputs    map[string]ManifestInput `json:"inputs"` // keyed by the flag the file was passed with
+}
+
+type ManifestInput struct {
+	Path      string `json:"path"`
+	SHA256    string `json:"sha256"`
+	SizeBytes int64  `json:"sizeBytes"`
+}
+
+// NewRunManifest hashes the input files, inputs maps flag names to file paths
+func NewRunManifest(command string, params map[string]string, inputs map[string]string) (RunManifest, error) {
+	manifest := RunManifest{
+		Version:   manifestVersion,
+		RunID:     runID,
+		Command:   command,
+		CreatedAt: time.Now(),
+		Params:    params,
+		Inputs:    make(map[string]ManifestInput, len(inputs)),
+	}
+	for flagName, filename := range inputs {
+		input, err := hashManifestInput(filename)
+		if err != nil {
+			return manifest, err
+		}
+		manifest.Inputs[flagName] = input
+	}
+	return manifest, nil
+}
+
+func hashManifestInput(filename string) (ManifestInput, error) {
+	f, err := openInput(filename)
+	if err != nil {
+		return ManifestInput{}, fmt.Errorf("Hashing input file: %w", err)
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return ManifestInput{}, fmt.Errorf("Hashing input file %s: %w", filename, err)
+	}
+	return ManifestInput{Path: filename, SHA256: hex.EncodeToString(hash.Sum(nil)), SizeBytes: size}, nil
+}
+
+func writeManifestJSON(manifest RunManifest, dbTarget targets.DBTarget, numWorkers int) string {
+	timestamp := manifest.CreatedAt.Format("20060102_150405")
+
+	filename := fmt.Sprintf("manifest_%s_%s_%dw_%s_%s.json",
+		manifest.Command, dbTarget.String(), numWorkers, timestamp, runID)
+	filename = path.Join(resultsDir, filename)
+
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		logger.Error("Failed to encode run manifest", "error", err)
+		os.Exit(exitFailure)
+	}
+	if err := writeNewFile(filename, b); err != nil {
+		logger.Error("Failed to write run manifest", "filename", filename, "error", err)
+		os.Exit(exitFailure)
+	}
+
+	registerArtifact(filename)
+	logger.Info("Wrote run manifest", "filename", filename)
+	return filename
+}
+
+func readManifestJSON(filename string) (RunManifest, error) {
+	var manifest RunManifest
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return manifest, err
+	}
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		return manifest, fmt.Errorf("Parsing manifest %s: %w", filename, err)
+	}
+	if manifest.Version != manifestVersion {
+		return manifest, fmt.Errorf("Unsupported manifest version %d, expected %d", manifest.Version, manifestVersion)
+	}
+	return manifest, nil
+}
+
+// verifyInputs checks that the input files passed to the replay match the hashes of the manifest
+func (m RunManifest) verifyInputs(params map[string]string) error {
+	for flagName, input := range m.Inputs {
+		filename := params[flagName]
+		actual, err := hashManifestInput(filename)
+		if err != nil {
+			return err
+		}
+		if actual.SHA256 != input.SHA256 {
+			return fmt.Errorf("Input -%s %s has hash %s, the manifest expects %s", flagName, filename, actual.SHA256, input.SHA256)
+		}
+	}
+	return nil
+}
+
+// replayArgs returns the CLI arguments reproducing the run, followed by the overrides
+func (m RunManifest) replayArgs(overrides []string) []string {
+	names := make([]string, 0, len(m.Params))
+	for name := range m.Params {
+		if !replayExcludedParams[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	args := make([]string, 0, len(names)+len(overrides))
+	for _, name := range names {
+		args = append(args, "-"+name+"="+m.Params[name])
+	}
+	// later flags take precedence over earlier ones
+	return append(args, overrides...)
+}
+
+func runReplay(args []string) {
+	fs := newFlagSet("replay", "Re-execute the identical workload of a run from its manifest.\nUsage: replay [flags] manifest.json [flags of the replayed command, e.g. -db]\nThe connection strings are not part of the manifest and default to LOADGEN_DB_URL.")
+	skipVerify := fs.Bool("skip-verify", false, "Replay even if the input files don't match the hashes of the manifest")
+	fs.Parse(args)
+
+	logger = slog.New(slog.NewJSONHandler(os.Stderr, nil))
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(exitConfig)
+	}
+	manifest, err := readManifestJSON(fs.Arg(0))
+	if err != nil {
+		logger.Error("Unable to read manifest", "error", err)
+		os.Exit(exitConfig)
+	}
+
+	var run func([]string)
+	for _, cmd := range commands {
+		if cmd.Name == manifest.Command {
+			run = cmd.Run
+		}
+	}
+	if run == nil || manifest.Command == "replay" {
+		logger.Error("Manifest contains an unknown command", "command", manifest.Command)
+		os.Exit(exitConfig)
+	}
+
+	replayArgs := manifest.replayArgs(fs.Args()[1:])
+	if !*skipVerify {
+		// parse the arguments like the replayed command to verify the files it will actually read
+		params := maps.Clone(manifest.Params)
+		for i := 0; i < len(replayArgs); i++ {
+			name, value, ok := strings.Cut(strings.TrimLeft(replayArgs[i], "-"), "=")
+			if !ok {
+				// only input files are relevant, other flags may be booleans without a value
+				if _, isInput := manifest.Inputs[name]; !isInput || i+1 == len(replayArgs) {
+					continue
+				}
+				value = replayArgs[i+1]
+				i++
+			}
+			params[name] = value
+		}
+		if err := manifest.verifyInputs(params); err != nil {
+			logger.Error("Input files differ from the manifest, use -skip-verify to replay anyway", "error", err)
+			os.Exit(exitValidation)
+		}
+	}
+
+	logger.Info("Replaying run", "runId", manifest.RunID, "command", manifest.Command)
+	run(replayArgs)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+
+	"load-generator/internal/workload"
+)
+
+func runMergeDataset(args []string) {
+	fs := newFlagSet("merge-dataset", "Merge trips CSVs into one ordered by timestamp, as replaying the events in time order requires,\nwhile the generated files are ordered by trip. The inputs are given as positional arguments\nand sorted externally, so they may be larger than the memory.")
+	out := fs.String("out", "./trips-by-time.csv", "Path of the merged CSV file, an existing file is not overwritten")
+	chunkEvents := fs.Int("chunk-events", 1_000_000, "Number of events sorted in memory at a time into a temporary run")
+	tmpDir := fs.String("tmp-dir", os.TempDir(), "Directory for the temporary sorted runs, needs space for the size of all inputs")
+	datasetTZ := registerDatasetTZ(fs)
+	fs.Parse(args)
+
+	logger = slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	mustSetDatasetTZ(*datasetTZ)
+	ctx, stop := signalContext()
+	defer stop()
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(exitConfig)
+	}
+
+	var events, runs int
+	writeDatasetFile(*out, func(f *os.File) error {
+		var err error
+		events, runs, err = workload.MergeByTimestamp(ctx, fs.Args(), f, *chunkEvents, *tmpDir)
+		return err
+	})
+	logger.Info("Merged trips by timestamp", "filename", *out, "inputs", fs.NArg(), "events", events, "sortedRuns", runs)
+}
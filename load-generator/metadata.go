@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"runtime"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"load-generator/internal/targets"
+	"load-generator/internal/workload"
+)
+
+// RunMetadata describes the environment and parameters a run was executed with
+type RunMetadata struct {
+	RunID              string                 `json:"runId"`
+	Mode               string                 `json:"mode"`
+	DBTarget           string                 `json:"dbTarget"`
+	NumWorkers         int                    `json:"numWorkers"`
+	SchemaVariant      string                 `json:"schemaVariant,omitempty"` // migration set given by -schema-variant
+	StartedAt          time.Time              `json:"startedAt"`
+	Hostname           string                 `json:"hostname"`
+	NumCPU             int                    `json:"numCPU"`
+	GOMAXPROCS         int                    `json:"gomaxprocs"`
+	CPUs               string                 `json:"cpus,omitempty"` // CPUs the load generator was limited to with -cpus
+	GoVersion          string                 `json:"goVersion"`
+	Params             map[string]string      `json:"params"`
+	RTT                *RTTReport             `json:"rtt,omitempty"`
+	TableSettings      *targets.CrateSettings `json:"tableSettings,omitempty"` // settings of the CrateDB events table, refresh_interval alone changes ingest throughput considerably
+	City               *workload.CityProfile  `json:"city,omitempty"`
+	Environment        *EnvironmentInfo       `json:"environment,omitempty"`        // database started by env run
+	NetworkImpairments []ImpairmentReport     `json:"networkImpairments,omitempty"` // phases of -impairments applied to the workers' connections
+}
+
+func NewRunMetadata(mode string, dbTarget targets.DBTarget, numWorkers int, params map[string]string) RunMetadata {
+	hostname, _ := os.Hostname()
+	return RunMetadata{
+		RunID:       runID,
+		Mode:        mode,
+		DBTarget:    dbTarget.String(),
+		NumWorkers:  numWorkers,
+		StartedAt:   time.Now(),
+		Hostname:    hostname,
+		NumCPU:      runtime.NumCPU(),
+		GoVersion:   runtime.Version(),
+		Params:      params,
+		Environment: environmentFromEnv(),
+	}
+}
+
+// readCrateSettings reads the settings of the events table, nil if they can't be read, e.g. before init
+func readCrateSettings(ctx context.Context, connString string) *targets.CrateSettings {
+	conn, err := pgx.Connect(ctx, connString)
+	if err != nil {
+		logger.Warn("Unable to connect to read table settings", "error", err)
+		return nil
+	}
+	defer conn.Close(context.Background())
+	settings, err := targets.ReadCrateSettings(ctx, conn)
+	if err != nil {
+		logger.Warn("Unable to read table settings", "error", err)
+		return nil
+	}
+	return &settings
+}
+
+func writeMetadataJSON(metadata RunMetadata) string {
+	timestamp := metadata.StartedAt.Format("20060102_150405")
+
+	filename := fmt.Sprintf("metadata_%s_%s_%dw_%s_%s.json",
+		metadata.Mode, metadata.DBTarget, metadata.NumWorkers, timestamp, runID)
+	filename = path.Join(resultsDir, filename)
+
+	b, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		logger.Error("Failed to encode run metadata", "error", err)
+		os.Exit(exitFailure)
+	}
+	if err := writeNewFile(filename, b); err != nil {
+		logger.Error("Failed to write run metadata", "filename", filename, "error", err)
+		os.Exit(exitFailure)
+	}
+
+	registerArtifact(filename)
+	logger.Info("Wrote run metadata", "filename", filename)
+	return filename
+}
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS escooter_events;
+DROP TABLE IF EXISTS pois;
+DROP TABLE IF EXISTS localities;
@@ -9,8 +9,8 @@ CREATE TABLE IF NOT EXISTS escooter_events (
     geo_point   GEO_POINT,
     PRIMARY KEY (trip_id, timestamp, event_id)
 )
-CLUSTERED BY (trip_id) INTO 24 SHARDS
-WITH ("number_of_replicas" = 0);
+CLUSTERED BY (trip_id) INTO {{.Shards | default 24}} SHARDS
+WITH ("number_of_replicas" = '{{.Replicas | default "0"}}');
 
 
 CREATE TABLE IF NOT EXISTS pois (
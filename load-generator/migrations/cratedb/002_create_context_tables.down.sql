@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS weather_observations;
+DROP TABLE IF EXISTS no_parking_zones;
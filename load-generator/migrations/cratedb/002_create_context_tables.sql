@@ -0,0 +1,18 @@
+-- optional reference data loaded by init with -weather and -no-parking-zones
+CREATE TABLE IF NOT EXISTS weather_observations (
+    observed_at      TIMESTAMP PRIMARY KEY,
+    temperature_c    DOUBLE PRECISION,
+    precipitation_mm DOUBLE PRECISION,
+    wind_speed_ms    DOUBLE PRECISION
+)
+CLUSTERED INTO 1 SHARDS
+WITH ("number_of_replicas" = '0-all');
+
+
+CREATE TABLE IF NOT EXISTS no_parking_zones (
+    zone_id   TEXT PRIMARY KEY,
+    name      TEXT,
+    geo_shape GEO_SHAPE
+)
+CLUSTERED INTO 1 SHARDS
+WITH ("number_of_replicas" = '0-all');
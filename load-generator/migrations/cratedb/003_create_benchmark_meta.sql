@@ -0,0 +1,13 @@
+-- fingerprints of the datasets loaded by init and insert, so query runs can check which data they run against
+CREATE TABLE IF NOT EXISTS benchmark_meta (
+    dataset     TEXT,
+    run_id      TEXT,
+    mode        TEXT,
+    filename    TEXT,
+    sha256      TEXT,
+    row_count   BIGINT,
+    recorded_at TIMESTAMP,
+    PRIMARY KEY (dataset, run_id)
+)
+CLUSTERED INTO 1 SHARDS
+WITH ("number_of_replicas" = '0-all');
@@ -0,0 +1,35 @@
+DROP TABLE IF EXISTS escooter_events;
+DROP TABLE IF EXISTS pois;
+DROP TABLE IF EXISTS localities;
+
+-- escooter events partitioned by month or -chunk-interval, the partition column has to be part of the primary key
+CREATE TABLE IF NOT EXISTS escooter_events (
+    event_id    TEXT,
+    trip_id     TEXT,
+    timestamp   TIMESTAMP,
+    geo_point   GEO_POINT,
+    period      TIMESTAMP GENERATED ALWAYS AS date_trunc('{{.ChunkInterval | default "month"}}', timestamp),
+    PRIMARY KEY (trip_id, timestamp, event_id, period)
+)
+CLUSTERED BY (trip_id) INTO {{.Shards | default 6}} SHARDS
+PARTITIONED BY (period)
+WITH ("number_of_replicas" = '{{.Replicas | default "0"}}');
+
+
+CREATE TABLE IF NOT EXISTS pois (
+    poi_id    TEXT PRIMARY KEY,
+    name      TEXT,
+    category  TEXT,
+    geo_point GEO_POINT
+)
+CLUSTERED INTO 1 SHARDS
+WITH ("number_of_replicas" = '0-all');
+
+
+CREATE TABLE IF NOT EXISTS localities (
+    locality_id TEXT PRIMARY KEY,
+    name        TEXT,
+    geo_shape   GEO_SHAPE
+)
+CLUSTERED INTO 1 SHARDS
+WITH ("number_of_replicas" = '0-all');
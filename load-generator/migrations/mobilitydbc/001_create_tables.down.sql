@@ -0,0 +1,5 @@
+-- dropping the tables drops their indexes and distributed shards as well
+DROP TABLE IF EXISTS escooter_events;
+DROP TABLE IF EXISTS trips;
+DROP TABLE IF EXISTS pois;
+DROP TABLE IF EXISTS localities;
@@ -15,7 +15,7 @@ SELECT create_distributed_table(
     'escooter_events',
     'trip_id',
     'hash',
-    shard_count => 32,
+    shard_count => {{.Shards | default 32}},
     colocate_with => 'none'
 );
 
@@ -31,7 +31,7 @@ SELECT create_distributed_table(
     'trips',
     'trip_id',
     'hash',
-    shard_count => 32,
+    shard_count => {{.Shards | default 32}},
     colocate_with => 'none'
 );
 
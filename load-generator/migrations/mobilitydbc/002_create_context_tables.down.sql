@@ -0,0 +1,3 @@
+-- dropping the tables drops their indexes as well
+DROP TABLE IF EXISTS weather_observations;
+DROP TABLE IF EXISTS no_parking_zones;
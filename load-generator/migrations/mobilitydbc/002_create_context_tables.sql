@@ -0,0 +1,20 @@
+-- optional reference data loaded by init with -weather and -no-parking-zones
+CREATE TABLE IF NOT EXISTS weather_observations (
+    observed_at      TIMESTAMPTZ PRIMARY KEY,
+    temperature_c    DOUBLE PRECISION,
+    precipitation_mm DOUBLE PRECISION,
+    wind_speed_ms    DOUBLE PRECISION
+);
+
+SELECT create_reference_table('weather_observations');
+
+
+CREATE TABLE IF NOT EXISTS no_parking_zones (
+    zone_id   TEXT PRIMARY KEY,
+    name      TEXT,
+    geo_shape geometry(Geometry, 4326)
+);
+
+SELECT create_reference_table('no_parking_zones');
+
+CREATE INDEX IF NOT EXISTS no_parking_zones_geo_shape_gist ON no_parking_zones USING GIST (geo_shape);
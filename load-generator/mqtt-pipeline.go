@@ -0,0 +1,577 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"load-generator/internal/benchmark"
+	"load-generator/internal/mqtt"
+	"load-generator/internal/results"
+	"load-generator/internal/targets"
+	"load-generator/internal/workload"
+)
+
+// publishedTripEvent is the JSON message of a trip event published to MQTT or Kafka, readable as trip event message
+// of ParseTripEventMessage, with the time it was published for measuring the end-to-end latency
+type publishedTripEvent struct {
+	EventID     string `json:"event_id"`
+	TripID      string `json:"trip_id"`
+	Timestamp   string `json:"timestamp"`
+	Latitude    string `json:"latitude"`
+	Longitude   string `json:"longitude"`
+	PublishedAt string `json:"published_at,omitempty"`
+}
+
+// ingestMessage is a received trip event, publishedAt is zero for messages without published_at
+type ingestMessage struct {
+	event       workload.TripEvent
+	publishedAt time.Time
+}
+
+// parseMQTTURL splits mqtt://[user[:password]@]host[:port]/topic into the broker address, the topic and the credentials.
+// The topic may contain the wildcards + and #, which url.Parse would take for a fragment.
+func parseMQTTURL(raw string) (string, string, mqtt.Options, error) {
+	var opts mqtt.Options
+	rest, ok := strings.CutPrefix(raw, "mqtt://")
+	host, topic, hasTopic := strings.Cut(rest, "/")
+	if !ok || !hasTopic || host == "" || topic == "" {
+		return "", "", opts, fmt.Errorf("MQTT broker must be in the form mqtt://[user[:password]@]host[:port]/topic, got %q", raw)
+	}
+	if i := strings.LastIndex(host, "@"); i >= 0 {
+		opts.Username, opts.Password, _ = strings.Cut(host[:i], ":")
+		host = host[i+1:]
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "1883")
+	}
+	return host, topic, opts, nil
+}
+
+func runMQTTPublish(args []string) {
+	fs := newFlagSet("mqtt-publish", "Publish the trip events as JSON messages to an MQTT broker at a target rate, the way scooter fleets deliver telemetry.\nEvery message carries the time it was published, mqtt-ingest measures the end-to-end latency until its insert with it.\nThe clocks of the hosts publishing and ingesting have to be synchronized, e.g. with NTP.")
+	broker := fs.String("broker", "mqtt://localhost:1883/scooters/{trip}/events", "Broker and topic, mqtt://[user[:password]@]host[:port]/topic. {trip} in the topic is replaced by the trip ID")
+	tripsPath := fs.String("trips", "../escooter-trips-generator/output/escooter-trips-small.csv", "Path or https:// or s3:// URL of a CSV file containing the escooter trip events")
+	rate := fs.Float64("rate", 1000, "Publish at most <rate> trip events per second, 0 publishes as fast as possible")
+	qos := fs.Int("qos", 1, "QoS of the messages, 0 (at most once) or 1 (at least once)")
+	maxEvents := fs.Int("max-events", 0, "Stop after <N> trip events, 0 publishes the whole file")
+	fs.Parse(args)
+
+	runID = envOrDefault(runIDEnv, newUUID())
+	logger = slog.New(slog.NewJSONHandler(os.Stdout, nil)).With("runId", runID)
+
+	addr, topic, opts, err := parseMQTTURL(*broker)
+	if err != nil {
+		logger.Error("Invalid CLI argument", "argument", "broker", "error", err)
+		os.Exit(exitConfig)
+	}
+	if *qos != 0 && *qos != 1 {
+		logger.Error("Invalid CLI argument", "argument", "qos", "error", "expected 0 or 1")
+		os.Exit(exitConfig)
+	}
+	ctx, stop := signalContext()
+	defer stop()
+
+	r, err := workload.OpenTripEvents(*tripsPath)
+	if err != nil {
+		logger.Error("Unable to open trip events", "error", err)
+		os.Exit(exitConfig)
+	}
+	defer r.Close()
+	opts.ClientID = "loadgen-publish-" + runID[:8]
+	client, err := mqtt.Dial(ctx, addr, opts)
+	if err != nil {
+		logger.Error("Unable to connect to MQTT broker", "broker", addr, "error", err)
+		os.Exit(exitConnection)
+	}
+	defer client.Close()
+	logger.Info("Publishing trip events", "broker", addr, "topic", topic, "trips", *tripsPath, "rate", *rate, "qos", *qos)
+
+	startTime := time.Now()
+	published := 0
+	for ctx.Err() == nil && (*maxEvents == 0 || published < *maxEvents) {
+		event, err := r.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			logger.Error("Unable to read trip events", "error", err)
+			os.Exit(exitConfig)
+		}
+		if !benchmark.WaitForRate(ctx, startTime, published, *rate) {
+			break
+		}
+		payload, _ := json.Marshal(publishedTripEvent{
+			EventID:     event.EventID,
+			TripID:      event.TripID,
+			Timestamp:   event.Timestamp,
+			Latitude:    event.Latitude,
+			Longitude:   event.Longitude,
+			PublishedAt: time.Now().UTC().Format(time.RFC3339Nano),
+		})
+		if err := client.Publish(ctx, strings.ReplaceAll(topic, "{trip}", event.TripID), payload, byte(*qos)); err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			logger.Error("Unable to publish trip event", "error", err)
+			os.Exit(exitConnection)
+		}
+		published++
+		if published%100000 == 0 {
+			logger.Info("Publish progress", "published", published, "timeElapsedInSec", time.Since(startTime).Seconds())
+		}
+	}
+
+	flushCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := client.Flush(flushCtx); err != nil {
+		logger.Warn("Not all messages were acknowledged by the broker", "error", err)
+	}
+	duration := time.Since(startTime)
+	logger.Info("Published trip events", "published", published, "durationSec", duration.Seconds(),
+		"eventsPerSec", float64(published)/duration.Seconds(), "interrupted", ctx.Err() != nil)
+	if ctx.Err() != nil {
+		os.Exit(exitAborted)
+	}
+}
+
+func runMQTTIngest(args []string) {
+	fs := newFlagSet("mqtt-ingest", "Subscribe to the trip events mqtt-publish sends to an MQTT broker and insert them in batches with concurrent workers.\nThe results CSV contains the insert latency of every batch like insert and the minimum, mean and maximum end-to-end latency\nof its events from being published until their batch was inserted. Start it before the publisher, the session is not persistent.")
+	var common commonOptions
+	common.register(fs)
+	var opts benchmarkOptions
+	opts.register(fs)
+	broker := fs.String("broker", "mqtt://localhost:1883/scooters/+/events", "Broker and topic filter, mqtt://[user[:password]@]host[:port]/topic, the wildcards + and # are allowed")
+	qos := fs.Int("qos", 1, "Maximum QoS of the received messages, 0 or 1")
+	batchSize := fs.Int("batch-size", 500, "Insert at most <N> trip events per batch")
+	linger := fs.Duration("linger", 100*time.Millisecond, "Insert a batch once its first event waited this long, even if it isn't full")
+	useBulkInsert := fs.Bool("bulk-insert", false, "Insert rows using UNNEST, one query with many inserts")
+	idleTimeout := fs.Duration("idle-timeout", 30*time.Second, "End the run once no event arrived for this long after the first one, 0 runs until interrupted or -max-duration")
+	fs.Parse(args)
+
+	ctx, stop := signalContext()
+	defer stop()
+	common.setup("mqtt-ingest", opts.numWorkers)
+	defer common.close()
+	ctx, cancel := opts.withMaxDuration(ctx)
+	defer cancel()
+	dbTarget := common.dbTarget
+
+	if len(opts.targets) > 0 || common.dryRun {
+		logger.Error("Invalid CLI argument", "argument", "targets", "error", "mqtt-ingest supports neither -targets nor -dry-run, check the insert statements with insert -dry-run")
+		os.Exit(exitConfig)
+	}
+	addr, topic, mqttOpts, err := parseMQTTURL(*broker)
+	if err != nil {
+		logger.Error("Invalid CLI argument", "argument", "broker", "error", err)
+		os.Exit(exitConfig)
+	}
+	if (*qos != 0 && *qos != 1) || *batchSize < 1 {
+		logger.Error("Invalid CLI argument", "argument", "qos", "error", "expected -qos 0 or 1 and a positive -batch-size")
+		os.Exit(exitConfig)
+	}
+	mqttOpts.ClientID = "loadgen-ingest-" + runID[:8]
+
+	logger.Info("Starting load-generator with following cli arguments",
+		"mode", "mqtt-ingest",
+		"db", dbTarget.String(),
+		"nworkers", opts.numWorkers,
+		"broker", addr,
+		"topic", topic,
+		"qos", *qos,
+		"batchSize", *batchSize,
+		"linger", *linger,
+		"useBulkInsert", *useBulkInsert,
+		"idleTimeout", *idleTimeout,
+	)
+
+	run := startBenchmarkRun(ctx, "mqtt-ingest", &common, &opts, nil, nil)
+	csvFile := createArtifactCSV("results", "mqtt-ingest", dbTarget.String(), workersPart(opts.numWorkers), fmt.Sprintf("%db", *batchSize), insertMethodPart(*useBulkInsert))
+	csvWriter := results.NewCSVWriter(csvFile, opts.flushInterval, opts.flushRecords)
+
+	subscribe := func(ctx context.Context) (ingestSource, error) {
+		client, err := mqtt.Dial(ctx, addr, mqttOpts)
+		if err == nil {
+			err = client.Subscribe(ctx, topic, byte(*qos))
+			if err != nil {
+				client.Close()
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w, subscribing to MQTT broker: %w", errBrokerConnection, err)
+		}
+		logger.Info("Subscribed to MQTT broker", "broker", addr, "topic", topic)
+		return mqttSource{client}, nil
+	}
+	ingest := ingestConfig{
+		mode:          "mqtt-ingest",
+		jobType:       "mqtt_ingest",
+		connString:    opts.workerConnString(common.connString),
+		numWorkers:    opts.numWorkers,
+		drainTimeout:  opts.drainTimeout,
+		batchSize:     *batchSize,
+		linger:        *linger,
+		idleTimeout:   *idleTimeout,
+		useBulkInsert: *useBulkInsert,
+		dbTarget:      dbTarget,
+	}
+	summary, err := ingest.run(run.ctx, subscribe, csvWriter)
+	run.finish(summary, func() { closeResultsCSV(csvWriter, opts.sortResults) })
+	if err != nil {
+		logger.Error("MQTT ingest failed", "error", err)
+		os.Exit(exitCode(err))
+	}
+	if summary.Aborted {
+		os.Exit(exitAborted)
+	}
+}
+
+// ingestSource delivers the received trip events to messages until ctx is done or receiving fails
+type ingestSource interface {
+	receive(ctx context.Context, messages chan<- ingestMessage) error
+	Close() error
+}
+
+// mqttSource receives the trip events of the subscriptions of an MQTT client, invalid messages are logged and skipped
+type mqttSource struct {
+	client *mqtt.Client
+}
+
+func (s mqttSource) receive(ctx context.Context, messages chan<- ingestMessage) error {
+	for {
+		b, err := s.client.Next(ctx)
+		if ctx.Err() != nil {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("%w, receiving MQTT messages: %w", errBrokerConnection, err)
+		}
+		msg, err := parseIngestMessage(b)
+		if err != nil {
+			logger.Warn("Skipping invalid trip event message", "error", err)
+			continue
+		}
+		select {
+		case messages <- msg:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (s mqttSource) Close() error {
+	return s.client.Close()
+}
+
+// ingestConfig is an ingest run, trip events arriving from a source are batched and inserted by concurrent workers
+type ingestConfig struct {
+	mode          string
+	jobType       string
+	connString    string
+	numWorkers    int
+	drainTimeout  time.Duration
+	batchSize     int
+	linger        time.Duration
+	idleTimeout   time.Duration
+	useBulkInsert bool
+	dbTarget      targets.DBTarget
+}
+
+// run receives the trip events of the source opened by open, batches them and inserts the batches with concurrent workers
+// until the source was idle for idleTimeout after the first event or ctx is done
+func (c ingestConfig) run(ctx context.Context, open func(context.Context) (ingestSource, error), csvWriter *results.CSVWriter) (RunSummary, error) {
+	aborted := RunSummary{Mode: c.mode, DBTarget: c.dbTarget.String(), NumWorkers: c.numWorkers, Aborted: true}
+	if err := csvWriter.Write(results.IngestCSVHeader); err != nil {
+		return aborted, fmt.Errorf("Writing CSV header: %w", err)
+	}
+
+	// the workers are connected before opening the source, so no event waits for a connection
+	jobsCtx, stopJobs := context.WithCancel(ctx)
+	defer stopJobs()
+	execCtx, cancelWorkers := benchmark.DrainContext(jobsCtx, c.drainTimeout, logger)
+	defer cancelWorkers()
+	conns := make([]*pgx.Conn, c.numWorkers)
+	for i := range conns {
+		conn, err := pgx.Connect(execCtx, c.connString)
+		if err != nil {
+			for _, conn := range conns[:i] {
+				conn.Close(context.Background())
+			}
+			return aborted, fmt.Errorf("Worker %d unable to connect to database: %w", i+1, err)
+		}
+		conns[i] = conn
+	}
+	source, err := open(ctx)
+	if err != nil {
+		for _, conn := range conns {
+			conn.Close(context.Background())
+		}
+		return aborted, err
+	}
+	defer source.Close()
+	logger.Info("Waiting for trip events", "numWorkers", c.numWorkers)
+
+	jobs := make(chan []ingestMessage, c.numWorkers*2)
+	eventCh := make(chan ingestResult, c.numWorkers*10)
+	var wg sync.WaitGroup
+	for i, conn := range conns {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			defer conn.Close(context.Background())
+			c.worker(jobsCtx, execCtx, id, conn, jobs, eventCh)
+		}(i + 1)
+	}
+
+	var e2eUs []float64
+	totalSuccesses, totalFailures := 0, 0
+	var csvWg sync.WaitGroup
+	csvWg.Add(1)
+	go func() {
+		defer csvWg.Done()
+		for result := range eventCh {
+			event := result.event
+			if eventLogSampler.Sample(event.FailedInserts > 0) {
+				logger.Debug("Worker finished ingest batch",
+					"workerId", event.WorkerID,
+					"batchSize", event.BatchSize,
+					"insertDurationUs", event.InsertDurationUs,
+					"e2eMeanUs", event.E2EMeanUs,
+					"e2eMaxUs", event.E2EMaxUs,
+					"successfullyInserted", event.SuccessfullyInserted,
+					"failedInserts", event.FailedInserts,
+				)
+			}
+			if err := csvWriter.Write(event.CSVRecord(runID)); err != nil {
+				logger.Error("Failed to write CSV record", "error", err)
+			}
+			e2eUs = append(e2eUs, result.e2eUs...)
+			totalSuccesses += event.SuccessfullyInserted
+			totalFailures += event.FailedInserts
+
+			resultsWarehouse.AddInsertEvent(event.InsertEvent)
+			runControl.AddCompleted(event.SuccessfullyInserted, event.FailedInserts)
+			statsd.Timing("ingest.batch_duration", time.Duration(event.InsertDurationUs)*time.Microsecond)
+			statsd.Timing("ingest.e2e_max", time.Duration(event.E2EMaxUs)*time.Microsecond)
+			statsd.Count("ingest.events.successful", int64(event.SuccessfullyInserted))
+			statsd.Count("ingest.events.failed", int64(event.FailedInserts))
+		}
+	}()
+
+	messages := make(chan ingestMessage, c.batchSize)
+	receiveErr := make(chan error, 1)
+	go func() {
+		defer close(messages)
+		if err := source.receive(jobsCtx, messages); err != nil {
+			receiveErr <- err
+		}
+	}()
+
+	var startTime time.Time
+	received := 0
+	batch := make([]ingestMessage, 0, c.batchSize)
+	lingerTimer := time.NewTimer(c.linger)
+	lingerTimer.Stop()
+	idleTicker := time.NewTicker(time.Second)
+	defer idleTicker.Stop()
+	lastMessage := time.Now()
+	var runErr error
+
+	flush := func() bool {
+		if len(batch) == 0 {
+			return true
+		}
+		lingerTimer.Stop()
+		if paused, ok := runControl.WaitIfPaused(ctx); !ok {
+			return false
+		} else if paused > 0 {
+			lastMessage = lastMessage.Add(paused)
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case jobs <- batch:
+			runControl.AddScheduled(len(batch))
+		}
+		batch = make([]ingestMessage, 0, c.batchSize)
+		return true
+	}
+
+Receiving:
+	for {
+		select {
+		case <-ctx.Done():
+			break Receiving
+		case runErr = <-receiveErr:
+			break Receiving
+		case msg, ok := <-messages:
+			if !ok {
+				break Receiving
+			}
+			if received == 0 {
+				startTime = time.Now()
+				logger.Info("Received first trip event")
+			}
+			received++
+			lastMessage = time.Now()
+			batch = append(batch, msg)
+			if len(batch) == 1 {
+				lingerTimer.Reset(c.linger)
+			}
+			if len(batch) >= c.batchSize && !flush() {
+				break Receiving
+			}
+			if received%10000 == 0 {
+				logger.Info("Ingest progress", "received", received, "timeElapsedInSec", time.Since(startTime).Seconds())
+			}
+		case <-lingerTimer.C:
+			if !flush() {
+				break Receiving
+			}
+		case <-idleTicker.C:
+			if c.idleTimeout > 0 && received > 0 && time.Since(lastMessage) > c.idleTimeout {
+				logger.Info("No trip events arrived within the idle timeout, ending the run", "idleTimeout", c.idleTimeout)
+				flush()
+				break Receiving
+			}
+		}
+	}
+	if ctx.Err() == nil && runErr == nil {
+		flush()
+	}
+
+	// workers drain their in-flight batches
+	close(jobs)
+	wg.Wait()
+	stopJobs()
+	close(eventCh)
+	csvWg.Wait()
+	if runErr != nil {
+		return aborted, runErr
+	}
+
+	endTime := time.Now()
+	if received == 0 {
+		startTime = endTime
+	}
+	summary := RunSummary{
+		Mode:            c.mode,
+		DBTarget:        c.dbTarget.String(),
+		NumWorkers:      c.numWorkers,
+		StartTime:       startTime,
+		EndTime:         endTime,
+		DurationSec:     endTime.Sub(startTime).Seconds(),
+		TotalOperations: received,
+		TotalSuccesses:  totalSuccesses,
+		TotalFailures:   totalFailures,
+		Aborted:         ctx.Err() != nil,
+	}
+	logE2ELatency(e2eUs)
+	return summary, nil
+}
+
+// ingestResult is a finished batch with the end-to-end latencies of its events which carried a publish time
+type ingestResult struct {
+	event results.IngestEvent
+	e2eUs []float64
+}
+
+func (c ingestConfig) worker(ctx, execCtx context.Context, id int, conn *pgx.Conn, jobs <-chan []ingestMessage, eventCh chan<- ingestResult) {
+	lastJobFinishTime := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case batch, ok := <-jobs:
+			if !ok {
+				return
+			}
+			eventCh <- ingestBatch(execCtx, conn, id, c.dbTarget, c.jobType, c.useBulkInsert, batch, time.Since(lastJobFinishTime))
+			lastJobFinishTime = time.Now()
+		}
+	}
+}
+
+// ingestBatch inserts the trip events of the batch and measures the end-to-end latency of the ones carrying a publish time
+func ingestBatch(ctx context.Context, conn *pgx.Conn, id int, dbTarget targets.DBTarget, jobType string, useBulkInsert bool, batch []ingestMessage, waitedForJobTime time.Duration) ingestResult {
+	events := make([]workload.TripEvent, len(batch))
+	for i, msg := range batch {
+		events[i] = msg.event
+	}
+
+	startTime := time.Now()
+	inserted := insertBatch(ctx, conn, id, dbTarget, events, useBulkInsert)
+	endTime := time.Now()
+
+	result := ingestResult{event: results.IngestEvent{InsertEvent: results.InsertEvent{
+		WorkerID:             id,
+		JobType:              jobType,
+		BatchSize:            len(batch),
+		UseBulkInsert:        useBulkInsert,
+		StartTime:            startTime.Format(time.RFC3339Nano),
+		EndTime:              endTime.Format(time.RFC3339Nano),
+		InsertDurationUs:     endTime.Sub(startTime).Microseconds(),
+		WaitedForJobTimeUs:   waitedForJobTime.Microseconds(),
+		SuccessfullyInserted: inserted,
+		FailedInserts:        len(batch) - inserted,
+		StartMonotonicUs:     results.MonotonicUs(startTime),
+		EndMonotonicUs:       results.MonotonicUs(endTime),
+	}}}
+	var sum int64
+	for _, msg := range batch {
+		if msg.publishedAt.IsZero() {
+			continue
+		}
+		e2e := endTime.Sub(msg.publishedAt).Microseconds()
+		if len(result.e2eUs) == 0 || e2e < result.event.E2EMinUs {
+			result.event.E2EMinUs = e2e
+		}
+		result.event.E2EMaxUs = max(result.event.E2EMaxUs, e2e)
+		sum += e2e
+		result.e2eUs = append(result.e2eUs, float64(e2e))
+	}
+	if len(result.e2eUs) > 0 {
+		result.event.E2EMeanUs = sum / int64(len(result.e2eUs))
+	}
+	return result
+}
+
+func parseIngestMessage(b []byte) (ingestMessage, error) {
+	event, err := workload.ParseTripEventMessage(b)
+	if err != nil {
+		return ingestMessage{}, err
+	}
+	msg := ingestMessage{event: event}
+	var published struct {
+		PublishedAt string `json:"published_at"`
+	}
+	if json.Unmarshal(b, &published) == nil && published.PublishedAt != "" {
+		if msg.publishedAt, err = time.Parse(time.RFC3339Nano, published.PublishedAt); err != nil {
+			return ingestMessage{}, fmt.Errorf("Invalid published_at %q", published.PublishedAt)
+		}
+	}
+	return msg, nil
+}
+
+// logE2ELatency logs the distribution of the end-to-end latencies of all events
+func logE2ELatency(e2eUs []float64) {
+	if len(e2eUs) == 0 {
+		logger.Warn("No trip event carried published_at, the end-to-end latency is unknown")
+		return
+	}
+	slices.Sort(e2eUs)
+	ms := func(p float64) string {
+		return strconv.FormatFloat(results.Percentile(e2eUs, p)/1000, 'f', 3, 64)
+	}
+	logger.Info("End-to-end latency of the trip events", "events", len(e2eUs),
+		"p50Ms", ms(0.5), "p95Ms", ms(0.95), "p99Ms", ms(0.99), "maxMs", ms(1))
+}
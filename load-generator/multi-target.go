@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"load-generator/internal/results"
+	"load-generator/internal/targets"
+)
+
+// TargetComparison is the outcome of one target of a multi-target run
+type TargetComparison struct {
+	DBTarget    string               `json:"dbTarget"`
+	ExitCode    int                  `json:"exitCode"`
+	ResultsFile string               `json:"resultsFile,omitempty"`
+	Summary     *RunSummary          `json:"summary,omitempty"`
+	Latency     results.LatencyStats `json:"latency"`
+}
+
+// ComparisonSummary compares the targets which executed the identical workload of a multi-target run
+type ComparisonSummary struct {
+	RunID   string             `json:"runId"`
+	Mode    string             `json:"mode"`
+	Targets []TargetComparison `json:"targets"`
+}
+
+type multiTarget struct {
+	name       string // CLI name, e.g. mobilitydbc
+	connString string
+}
+
+// targetsFlag is the repeatable -targets flag, each value lists comma separated targets, the last one
+// optionally with its connection string, e.g. -targets cratedb -targets mobilitydbc=postgresql://host1,host2/db.
+// The connection string extends to the end of the value, so it may contain commas, e.g. of multi-host DSNs.
+type targetsFlag []string
+
+func (f *targetsFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return strings.Join(*f, " ")
+}
+
+func (f *targetsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// parseMultiTargets parses the values of -targets, see targetsFlag.
+// Targets without a connection string use LOADGEN_DB_URL_<TARGET>, e.g. LOADGEN_DB_URL_CRATEDB.
+func parseMultiTargets(specs []string) ([]multiTarget, error) {
+	var parsed []multiTarget
+	for _, spec := range specs {
+		namesList, lastConnString, hasConnString := strings.Cut(spec, "=")
+		names := strings.Split(namesList, ",")
+		for i, name := range names {
+			name = strings.TrimSpace(name)
+			if _, err := targets.Parse(name); err != nil {
+				return nil, err
+			}
+			connString := ""
+			if i == len(names)-1 && hasConnString {
+				connString = lastConnString
+			} else {
+				envName := "LOADGEN_DB_URL_" + strings.ToUpper(name)
+				connString = os.Getenv(envName)
+				if connString == "" {
+					return nil, fmt.Errorf("No connection string for target %s, use %s=<connString> or set %s", name, name, envName)
+				}
+			}
+			parsed = append(parsed, multiTarget{name: name, connString: connString})
+		}
+	}
+	return parsed, nil
+}
+
+// targetPathFlags are the flags with file paths, {target} is only replaced in their values
+var targetPathFlags = []string{
+	"trips", "pois", "localities", "no-parking-zones", "weather", "event-attributes",
+	"queries", "geofence-queries", "insert-template", "migrations",
+	"results-dir", "log-dir", "results-upload",
+}
+
+// withTargetPaths replaces {target} in the values of targetPathFlags by the target name,
+// other values, e.g. connection strings, are passed on unchanged
+func withTargetPaths(args []string, target string) []string {
+	replaced := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		flagName, value, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		switch {
+		case !strings.HasPrefix(args[i], "-") || !slices.Contains(targetPathFlags, flagName):
+			replaced = append(replaced, args[i])
+		case hasValue:
+			replaced = append(replaced, "-"+flagName+"="+strings.ReplaceAll(value, "{target}", target))
+		case i+1 < len(args):
+			replaced = append(replaced, args[i], strings.ReplaceAll(args[i+1], "{target}", target))
+			i++
+		default:
+			replaced = append(replaced, args[i])
+		}
+	}
+	return replaced
+}
+
+// withoutFlag removes all occurrences of the flag and its value from args
+func withoutFlag(args []string, name string) []string {
+	var filtered []string
+	for i := 0; i < len(args); i++ {
+		flagName, _, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		if strings.HasPrefix(args[i], "-") && flagName == name {
+			if !hasValue {
+				i++
+			}
+			continue
+		}
+		filtered = append(filtered, args[i])
+	}
+	return filtered
+}
+
+// runMultiTarget executes the command with identical arguments sequentially against every target
+// and writes a comparison of their results. {target} in the file paths of targetPathFlags is replaced by the target name,
+// e.g. -queries ./schemas/{target}-simple-read-queries.tmpl.
+// All targets share one run ID, so their artifacts can be joined.
+func runMultiTarget(mode string, args []string, specs targetsFlag, resultsDir string) {
+	runID = envOrDefault(runIDEnv, newUUID())
+	logger = slog.New(slog.NewJSONHandler(os.Stdout, nil)).With("runId", runID)
+
+	multiTargets, err := parseMultiTargets(specs)
+	if err != nil {
+		logger.Error("Invalid CLI argument", "argument", "targets", "error", err)
+		os.Exit(exitConfig)
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		logger.Error("Unable to locate the load-generator executable", "error", err)
+		os.Exit(exitFailure)
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	args = withoutFlag(args, "targets")
+	comparison := ComparisonSummary{RunID: runID, Mode: mode}
+	for _, target := range multiTargets {
+		targetArgs := withTargetPaths(args, target.name)
+		// later flags take precedence over the ones given by the user
+		targetArgs = append(targetArgs, "-dbTarget="+target.name, "-db="+target.connString)
+
+		logger.Info("Starting run against target", "mode", mode, "dbTarget", target.name)
+		exitCode := runChildCommand(ctx, executable, mode, targetArgs)
+		comparison.Targets = append(comparison.Targets, compareTarget(mode, target.name, exitCode, resultsDir))
+
+		// a run ending at its -max-duration is a planned end, the next target is run
+		if exitCode != 0 && (exitCode != exitAborted || ctx.Err() != nil) {
+			writeComparisonJSON(comparison, resultsDir)
+			logger.Error("Stopping multi-target run after failed target", "dbTarget", target.name, "exitCode", exitCode)
+			os.Exit(exitCode)
+		}
+	}
+
+	writeComparisonJSON(comparison, resultsDir)
+	printComparison(comparison)
+}
+
+// compareTarget reads the summary and the results of the target's run
+func compareTarget(mode, name string, exitCode int, resultsDir string) TargetComparison {
+	dbTarget, _ := targets.Parse(name)
+	c := TargetComparison{DBTarget: dbTarget.String(), ExitCode: exitCode}
+
+	pattern := fmt.Sprintf("*_%s_%s_*%s.*", mode, dbTarget.String(), runID)
+	matches, _ := filepath.Glob(filepath.Join(resultsDir, pattern))
+	for _, match := range matches {
+		switch {
+		case strings.HasPrefix(filepath.Base(match), "summary_"):
+			b, err := os.ReadFile(match)
+			if err != nil {
+				logger.Warn("Unable to read summary", "filename", match, "error", err)
+				continue
+			}
+			var summary RunSummary
+			if err := json.Unmarshal(b, &summary); err != nil {
+				logger.Warn("Unable to parse summary", "filename", match, "error", err)
+				continue
+			}
+			c.Summary = &summary
+		case strings.HasPrefix(filepath.Base(match), "results_"):
+			data, err := results.LoadCSV(match)
+			if err != nil {
+				logger.Warn("Unable to load results", "filename", match, "error", err)
+				continue
+			}
+			c.ResultsFile = match
+			c.Latency = results.ComputeLatencyStats(data.Rows)
+		}
+	}
+	return c
+}
+
+func writeComparisonJSON(comparison ComparisonSummary, resultsDir string) string {
+	timestamp := time.Now().Format("20060102_150405")
+
+	filename := fmt.Sprintf("comparison_%s_%s_%s.json", comparison.Mode, timestamp, runID)
+	filename = filepath.Join(resultsDir, filename)
+
+	b, err := json.MarshalIndent(comparison, "", "  ")
+	if err != nil {
+		logger.Error("Failed to encode comparison summary", "error", err)
+		os.Exit(exitFailure)
+	}
+	if err := writeNewFile(filename, b); err != nil {
+		logger.Error("Failed to write comparison summary", "filename", filename, "error", err)
+		os.Exit(exitFailure)
+	}
+
+	logger.Info("Wrote comparison summary", "filename", filename)
+	return filename
+}
+
+func printComparison(comparison ComparisonSummary) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "Comparison of %s run %s\n", comparison.Mode, comparison.RunID)
+	fmt.Fprintln(w, "target\trequests\tfailed\tops/s\tmean ms\tp50 ms\tp95 ms\tp99 ms\tmax ms\t")
+	for _, c := range comparison.Targets {
+		printStatsRow(w, c.DBTarget, c.Latency)
+	}
+	w.Flush()
+}
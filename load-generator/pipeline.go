@@ -0,0 +1,473 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"load-generator/internal/benchmark"
+	"load-generator/internal/kafka"
+	"load-generator/internal/results"
+	"load-generator/internal/targets"
+	"load-generator/internal/workload"
+)
+
+// a partition's batch of the producer is sent once its first event waited this long, even if it isn't full
+const producerLinger = 10 * time.Millisecond
+
+func runPipeline(args []string) {
+	fs := newFlagSet("pipeline", "Produce the trip events to a Kafka topic at a target rate and insert them with a consumer\nper worker with its own database connection, each reading its share of the partitions assigned in turn by partition ID.\nThis is no Kafka consumer group, the broker neither coordinates the consumers nor stores their offsets.\nThe results CSV contains the insert latency, the end-to-end latency of the events from being produced until their batch\nwas inserted and the consumer lag of every consumed batch, a second CSV the latency of every produced batch.")
+	var common commonOptions
+	common.register(fs)
+	var opts benchmarkOptions
+	opts.register(fs)
+	broker := fs.String("broker", "kafka://localhost:9092/trip-events", "Broker and topic, kafka://host[:port]/topic. The topic needs at least -nworkers partitions")
+	tripsPath := fs.String("trips", "../escooter-trips-generator/output/escooter-trips-small.csv", "Path or https:// or s3:// URL of a CSV file containing the escooter trip events")
+	rate := fs.Float64("rate", 1000, "Produce at most <rate> trip events per second, 0 produces as fast as possible")
+	maxEvents := fs.Int("max-events", 0, "Stop producing after <N> trip events, 0 produces the whole file")
+	producerBatch := fs.Int("producer-batch", 100, "Produce at most <N> trip events per record batch of a partition")
+	acks := fs.String("acks", "1", "Acknowledgement of produced batches, 1 (leader) or all (in-sync replicas)")
+	batchSize := fs.Int("batch-size", 500, "Insert at most <N> trip events a consumer polled per batch")
+	useBulkInsert := fs.Bool("bulk-insert", false, "Insert rows using UNNEST, one query with many inserts")
+	idleTimeout := fs.Duration("idle-timeout", 30*time.Second, "End the run once the consumers made no progress for this long after the producer finished")
+	fs.Parse(args)
+
+	ctx, stop := signalContext()
+	defer stop()
+	common.setup("pipeline", opts.numWorkers)
+	defer common.close()
+	ctx, cancel := opts.withMaxDuration(ctx)
+	defer cancel()
+	dbTarget := common.dbTarget
+
+	if len(opts.targets) > 0 || common.dryRun {
+		logger.Error("Invalid CLI argument", "argument", "targets", "error", "pipeline supports neither -targets nor -dry-run, check the insert statements with insert -dry-run")
+		os.Exit(exitConfig)
+	}
+	brokerAddr, topic, _, err := parseKafkaURL(*broker)
+	if err != nil {
+		logger.Error("Invalid CLI argument", "argument", "broker", "error", err)
+		os.Exit(exitConfig)
+	}
+	var requiredAcks int16
+	switch *acks {
+	case "1":
+		requiredAcks = 1
+	case "all", "-1":
+		requiredAcks = -1
+	default:
+		logger.Error("Invalid CLI argument", "argument", "acks", "error", "expected 1 or all")
+		os.Exit(exitConfig)
+	}
+	if *producerBatch < 1 || *batchSize < 1 {
+		logger.Error("Invalid CLI argument", "argument", "batch-size", "error", "expected a positive -batch-size and -producer-batch")
+		os.Exit(exitConfig)
+	}
+	source, err := workload.OpenTripEvents(*tripsPath)
+	if err != nil {
+		logger.Error("Unable to open trip events", "error", err)
+		os.Exit(exitConfig)
+	}
+	defer source.Close()
+
+	logger.Info("Starting load-generator with following cli arguments",
+		"mode", "pipeline",
+		"db", dbTarget.String(),
+		"nworkers", opts.numWorkers,
+		"broker", brokerAddr,
+		"topic", topic,
+		"trips", *tripsPath,
+		"rate", *rate,
+		"maxEvents", *maxEvents,
+		"producerBatch", *producerBatch,
+		"acks", *acks,
+		"batchSize", *batchSize,
+		"useBulkInsert", *useBulkInsert,
+		"idleTimeout", *idleTimeout,
+	)
+
+	run := startBenchmarkRun(ctx, "pipeline", &common, &opts, nil, nil)
+	csvFile := createArtifactCSV("results", "pipeline", dbTarget.String(), workersPart(opts.numWorkers), fmt.Sprintf("%db", *batchSize), insertMethodPart(*useBulkInsert))
+	csvWriter := results.NewCSVWriter(csvFile, opts.flushInterval, opts.flushRecords)
+	produceFile := createArtifactCSV("results", "pipeline-produce", fmt.Sprintf("%db", *producerBatch))
+	produceWriter := results.NewCSVWriter(produceFile, opts.flushInterval, opts.flushRecords)
+
+	p := pipelineConfig{
+		connString:    opts.workerConnString(common.connString),
+		numWorkers:    opts.numWorkers,
+		drainTimeout:  opts.drainTimeout,
+		broker:        brokerAddr,
+		topic:         topic,
+		acks:          requiredAcks,
+		rate:          *rate,
+		maxEvents:     *maxEvents,
+		producerBatch: *producerBatch,
+		batchSize:     *batchSize,
+		useBulkInsert: *useBulkInsert,
+		idleTimeout:   *idleTimeout,
+		dbTarget:      dbTarget,
+	}
+	summary, err := p.run(run.ctx, source, csvWriter, produceWriter)
+	run.finish(summary, func() {
+		closeResultsCSV(csvWriter, opts.sortResults)
+		closeResultsCSV(produceWriter, opts.sortResults)
+	})
+	if err != nil {
+		logger.Error("Pipeline failed", "error", err)
+		os.Exit(exitCode(err))
+	}
+	if summary.Aborted {
+		os.Exit(exitAborted)
+	}
+}
+
+type pipelineConfig struct {
+	connString    string
+	numWorkers    int
+	drainTimeout  time.Duration
+	broker        string
+	topic         string
+	acks          int16
+	rate          float64
+	maxEvents     int
+	producerBatch int
+	batchSize     int
+	useBulkInsert bool
+	idleTimeout   time.Duration
+	dbTarget      targets.DBTarget
+}
+
+// pipelineResult is a batch a consumer inserted
+type pipelineResult struct {
+	event results.PipelineEvent
+	e2eUs []float64
+}
+
+// run produces the trip events of the source while the consumers insert them, until all produced events were consumed,
+// the consumers were idle for idleTimeout after the producer finished or ctx is done
+func (p pipelineConfig) run(ctx context.Context, source workload.TripEventSource, csvWriter, produceWriter *results.CSVWriter) (RunSummary, error) {
+	aborted := RunSummary{Mode: "pipeline", DBTarget: p.dbTarget.String(), NumWorkers: p.numWorkers, Aborted: true}
+	if err := csvWriter.Write(results.PipelineCSVHeader); err != nil {
+		return aborted, fmt.Errorf("Writing CSV header: %w", err)
+	}
+	if err := produceWriter.Write(results.ProduceCSVHeader); err != nil {
+		return aborted, fmt.Errorf("Writing produce CSV header: %w", err)
+	}
+
+	producer, err := kafka.NewProducer(ctx, p.broker, p.topic, p.acks)
+	if err != nil {
+		return aborted, fmt.Errorf("%w, connecting producer: %w", errBrokerConnection, err)
+	}
+	defer producer.Close()
+	if producer.Partitions() < p.numWorkers {
+		return aborted, fmt.Errorf("Topic %s has %d partitions, fewer than the %d consumers", p.topic, producer.Partitions(), p.numWorkers)
+	}
+
+	// the consumers start at the end of the partitions, so they are created before producing
+	jobsCtx, stopJobs := context.WithCancel(ctx)
+	defer stopJobs()
+	execCtx, cancelWorkers := benchmark.DrainContext(jobsCtx, p.drainTimeout, logger)
+	defer cancelWorkers()
+	conns := make([]*pgx.Conn, p.numWorkers)
+	consumers := make([]*kafka.Consumer, p.numWorkers)
+	closeAll := func() {
+		for i := range conns {
+			if conns[i] != nil {
+				conns[i].Close(context.Background())
+			}
+			if consumers[i] != nil {
+				consumers[i].Close()
+			}
+		}
+	}
+	for i := range conns {
+		conn, err := pgx.Connect(execCtx, p.connString)
+		if err != nil {
+			closeAll()
+			return aborted, fmt.Errorf("Worker %d unable to connect to database: %w", i+1, err)
+		}
+		conns[i] = conn
+		consumer, err := kafka.NewPartitionShare(ctx, p.broker, p.topic, i, p.numWorkers)
+		if err != nil {
+			closeAll()
+			return aborted, fmt.Errorf("%w, connecting consumer %d: %w", errBrokerConnection, i+1, err)
+		}
+		consumers[i] = consumer
+	}
+	logger.Info("Connected consumers", "numWorkers", p.numWorkers, "partitions", producer.Partitions())
+
+	eventCh := make(chan pipelineResult, p.numWorkers*10)
+	consumeErr := make(chan error, p.numWorkers)
+	var consumed atomic.Int64
+	var wg sync.WaitGroup
+	for i := range conns {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			defer conns[id-1].Close(context.Background())
+			defer consumers[id-1].Close()
+			if err := p.consume(jobsCtx, execCtx, id, conns[id-1], consumers[id-1], &consumed, eventCh); err != nil {
+				consumeErr <- err
+			}
+		}(i + 1)
+	}
+
+	var e2eUs []float64
+	totalSuccesses, totalFailures := 0, 0
+	var csvWg sync.WaitGroup
+	csvWg.Add(1)
+	go func() {
+		defer csvWg.Done()
+		for result := range eventCh {
+			event := result.event
+			if eventLogSampler.Sample(event.FailedInserts > 0) {
+				logger.Debug("Consumer finished pipeline batch",
+					"workerId", event.WorkerID,
+					"batchSize", event.BatchSize,
+					"insertDurationUs", event.InsertDurationUs,
+					"e2eMeanUs", event.E2EMeanUs,
+					"e2eMaxUs", event.E2EMaxUs,
+					"consumerLag", event.ConsumerLag,
+					"successfullyInserted", event.SuccessfullyInserted,
+					"failedInserts", event.FailedInserts,
+				)
+			}
+			if err := csvWriter.Write(event.CSVRecord(runID)); err != nil {
+				logger.Error("Failed to write CSV record", "error", err)
+			}
+			e2eUs = append(e2eUs, result.e2eUs...)
+			totalSuccesses += event.SuccessfullyInserted
+			totalFailures += event.FailedInserts
+
+			resultsWarehouse.AddInsertEvent(event.InsertEvent)
+			runControl.AddCompleted(event.SuccessfullyInserted, event.FailedInserts)
+			statsd.Timing("pipeline.batch_duration", time.Duration(event.InsertDurationUs)*time.Microsecond)
+			statsd.Timing("pipeline.e2e_max", time.Duration(event.E2EMaxUs)*time.Microsecond)
+			statsd.Gauge("pipeline.consumer_lag", float64(event.ConsumerLag))
+			statsd.Count("pipeline.events.successful", int64(event.SuccessfullyInserted))
+			statsd.Count("pipeline.events.failed", int64(event.FailedInserts))
+		}
+	}()
+
+	startTime := time.Now()
+	var produced atomic.Int64
+	producerDone := make(chan error, 1)
+	var produceUs []float64
+	go func() {
+		producerDone <- p.produce(jobsCtx, producer, source, &produced, produceWriter, &produceUs)
+	}()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	producing := true
+	lastProgress, lastConsumed := time.Now(), int64(0)
+	var runErr error
+Consuming:
+	for {
+		select {
+		case <-ctx.Done():
+			break Consuming
+		case runErr = <-consumeErr:
+			break Consuming
+		case err := <-producerDone:
+			producing = false
+			if err != nil {
+				runErr = err
+				break Consuming
+			}
+			logger.Info("Producer finished, waiting for the consumers", "produced", produced.Load(), "consumed", consumed.Load())
+			lastProgress = time.Now()
+		case <-ticker.C:
+			n := consumed.Load()
+			if n != lastConsumed {
+				lastConsumed, lastProgress = n, time.Now()
+			}
+			if producing {
+				continue
+			}
+			if n >= produced.Load() {
+				break Consuming
+			}
+			if p.idleTimeout > 0 && time.Since(lastProgress) > p.idleTimeout {
+				logger.Warn("Consumers made no progress within the idle timeout, ending the run", "idleTimeout", p.idleTimeout, "produced", produced.Load(), "consumed", n)
+				break Consuming
+			}
+		}
+	}
+
+	// consumers drain their in-flight batches
+	stopJobs()
+	if producing {
+		<-producerDone
+	}
+	wg.Wait()
+	close(eventCh)
+	csvWg.Wait()
+	if runErr != nil {
+		return aborted, runErr
+	}
+
+	endTime := time.Now()
+	summary := RunSummary{
+		Mode:            "pipeline",
+		DBTarget:        p.dbTarget.String(),
+		NumWorkers:      p.numWorkers,
+		StartTime:       startTime,
+		EndTime:         endTime,
+		DurationSec:     endTime.Sub(startTime).Seconds(),
+		TotalOperations: int(consumed.Load()),
+		TotalSuccesses:  totalSuccesses,
+		TotalFailures:   totalFailures,
+		Aborted:         ctx.Err() != nil,
+	}
+	logger.Info("Pipeline finished", "produced", produced.Load(), "consumed", consumed.Load())
+	logProduceLatency(produceUs)
+	logE2ELatency(e2eUs)
+	return summary, nil
+}
+
+// produce sends the trip events keyed by trip ID, so the events of a trip stay in order in their partition,
+// and batches them per partition
+func (p pipelineConfig) produce(ctx context.Context, producer *kafka.Producer, source workload.TripEventSource, produced *atomic.Int64, produceWriter *results.CSVWriter, produceUs *[]float64) error {
+	batches := make([][]kafka.Record, producer.Partitions())
+	firstBuffered := make([]time.Time, producer.Partitions())
+	send := func(partition int) {
+		batch := batches[partition]
+		if len(batch) == 0 {
+			return
+		}
+		batches[partition] = nil
+		startTime := time.Now()
+		err := producer.Produce(ctx, partition, batch)
+		endTime := time.Now()
+		if ctx.Err() != nil {
+			return
+		}
+		event := results.ProduceEvent{
+			ProducerID:        1,
+			Partition:         partition,
+			BatchSize:         len(batch),
+			StartTime:         startTime.Format(time.RFC3339Nano),
+			EndTime:           endTime.Format(time.RFC3339Nano),
+			ProduceDurationUs: endTime.Sub(startTime).Microseconds(),
+			Successful:        err == nil,
+			StartMonotonicUs:  results.MonotonicUs(startTime),
+			EndMonotonicUs:    results.MonotonicUs(endTime),
+		}
+		if err != nil {
+			event.ErrorMsg = err.Error()
+			logger.Warn("Unable to produce trip events", "partition", partition, "batchSize", len(batch), "error", err)
+		} else {
+			produced.Add(int64(len(batch)))
+			*produceUs = append(*produceUs, float64(event.ProduceDurationUs))
+		}
+		if err := produceWriter.Write(event.CSVRecord(runID)); err != nil {
+			logger.Error("Failed to write produce CSV record", "error", err)
+		}
+		statsd.Timing("pipeline.produce_duration", endTime.Sub(startTime))
+	}
+
+	startTime := time.Now()
+	read := 0
+	for ctx.Err() == nil && (p.maxEvents == 0 || read < p.maxEvents) {
+		if paused, ok := runControl.WaitIfPaused(ctx); !ok {
+			break
+		} else if paused > 0 {
+			startTime = startTime.Add(paused)
+		}
+		event, err := source.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("Reading trip events: %w", err)
+		}
+		if !benchmark.WaitForRate(ctx, startTime, read, p.rate) {
+			break
+		}
+		read++
+		runControl.AddScheduled(1)
+		value, _ := json.Marshal(publishedTripEvent{
+			EventID:     event.EventID,
+			TripID:      event.TripID,
+			Timestamp:   event.Timestamp,
+			Latitude:    event.Latitude,
+			Longitude:   event.Longitude,
+			PublishedAt: time.Now().UTC().Format(time.RFC3339Nano),
+		})
+		key := []byte(event.TripID)
+		partition := producer.Partition(key)
+		if len(batches[partition]) == 0 {
+			firstBuffered[partition] = time.Now()
+		}
+		batches[partition] = append(batches[partition], kafka.Record{Key: key, Value: value})
+		for i := range batches {
+			if len(batches[i]) >= p.producerBatch || (len(batches[i]) > 0 && time.Since(firstBuffered[i]) >= producerLinger) {
+				send(i)
+			}
+		}
+		if read%100000 == 0 {
+			logger.Info("Produce progress", "read", read, "produced", produced.Load(), "timeElapsedInSec", time.Since(startTime).Seconds())
+		}
+	}
+	for i := range batches {
+		send(i)
+	}
+	return nil
+}
+
+// consume polls the partitions of the consumer and inserts the polled trip events as one batch until ctx is done
+func (p pipelineConfig) consume(ctx, execCtx context.Context, id int, conn *pgx.Conn, consumer *kafka.Consumer, consumed *atomic.Int64, eventCh chan<- pipelineResult) error {
+	lastJobFinishTime := time.Now()
+	for {
+		values, err := consumer.Poll(ctx, p.batchSize)
+		if ctx.Err() != nil {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("%w, consumer %d polling: %w", errBrokerConnection, id, err)
+		}
+		if len(values) == 0 {
+			continue
+		}
+		batch := make([]ingestMessage, 0, len(values))
+		for _, value := range values {
+			msg, err := parseIngestMessage(value)
+			if err != nil {
+				logger.Warn("Skipping invalid trip event record", "workerId", id, "error", err)
+				continue
+			}
+			batch = append(batch, msg)
+		}
+		if len(batch) > 0 {
+			result := ingestBatch(execCtx, conn, id, p.dbTarget, "pipeline_ingest", p.useBulkInsert, batch, time.Since(lastJobFinishTime))
+			eventCh <- pipelineResult{
+				event: results.PipelineEvent{IngestEvent: result.event, ConsumerLag: consumer.Lag()},
+				e2eUs: result.e2eUs,
+			}
+			lastJobFinishTime = time.Now()
+		}
+		// skipped records count as consumed, so the run still ends once the consumers caught up
+		consumed.Add(int64(len(values)))
+	}
+}
+
+// logProduceLatency logs the distribution of the latencies of the produced batches
+func logProduceLatency(produceUs []float64) {
+	if len(produceUs) == 0 {
+		return
+	}
+	slices.Sort(produceUs)
+	ms := func(p float64) string {
+		return strconv.FormatFloat(results.Percentile(produceUs, p)/1000, 'f', 3, 64)
+	}
+	logger.Info("Produce latency of the batches", "batches", len(produceUs),
+		"p50Ms", ms(0.5), "p95Ms", ms(0.95), "p99Ms", ms(0.99), "maxMs", ms(1))
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"load-generator/internal/results"
+	"load-generator/internal/targets"
+)
+
+// PreaggStatements create, refresh and drop the pre-aggregation of a target, the events per hour.
+// Its name starts with escooter_events, so it gets the table prefix of the benchmark tables.
+type PreaggStatements struct {
+	Create  []string
+	Refresh []string
+	Drop    []string
+}
+
+// preaggStatements returns the pre-aggregation of the target. CrateDB has no materialized views,
+// the aggregation is upserted by an INSERT-from-SELECT the benchmark schedules instead.
+func preaggStatements(dbTarget targets.DBTarget) PreaggStatements {
+	if dbTarget == targets.MobilityDB {
+		return PreaggStatements{
+			Create: []string{`CREATE MATERIALIZED VIEW IF NOT EXISTS escooter_events_per_hour AS
+SELECT date_trunc('hour', timestamp) AS hour, count(*) AS event_count, count(DISTINCT trip_id) AS trip_count
+FROM escooter_events
+GROUP BY 1
+WITH NO DATA`},
+			Refresh: []string{`REFRESH MATERIALIZED VIEW escooter_events_per_hour`},
+			Drop:    []string{`DROP MATERIALIZED VIEW IF EXISTS escooter_events_per_hour`},
+		}
+	}
+	return PreaggStatements{
+		Create: []string{`CREATE TABLE IF NOT EXISTS escooter_events_per_hour (
+    hour        TIMESTAMP PRIMARY KEY,
+    event_count BIGINT,
+    trip_count  BIGINT
+)`},
+		Refresh: []string{
+			`INSERT INTO escooter_events_per_hour (hour, event_count, trip_count)
+SELECT date_trunc('hour', timestamp), count(*), count(DISTINCT trip_id)
+FROM escooter_events
+GROUP BY 1
+ON CONFLICT (hour) DO UPDATE SET event_count = excluded.event_count, trip_count = excluded.trip_count`,
+			// makes the upserted rows visible to the staleness measurement
+			`REFRESH TABLE escooter_events_per_hour`,
+		},
+		Drop: []string{`DROP TABLE IF EXISTS escooter_events_per_hour`},
+	}
+}
+
+const (
+	preaggBaseEventsSQL = `SELECT count(*) FROM escooter_events`
+	preaggEventsSQL     = `SELECT coalesce(sum(event_count), 0)::bigint FROM escooter_events_per_hour`
+)
+
+var preaggCSVHeader = []string{"runId", "refresh", "startTime", "endTime", "refreshDurationUs", "startMonotonicUs", "successful", "baseEvents", "preaggEvents", "missingEvents", "stalenessMs", "errorMsg"}
+
+type PreaggSummary struct {
+	RunID    string `json:"runId"`
+	DBTarget string `json:"dbTarget"`
+	// latency of the refreshes, the operations are the refreshes
+	Refresh results.LatencyStats `json:"refresh"`
+	// events of the table not yet in the pre-aggregation before a refresh, and the time since the refresh before started
+	MaxMissingEvents int64   `json:"maxMissingEvents"`
+	MaxStalenessSec  float64 `json:"maxStalenessSec"`
+	// exit code of the insert started with -insert-trips
+	InsertExitCode *int `json:"insertExitCode,omitempty"`
+	Aborted        bool `json:"aborted"`
+}
+
+func runPreaggBench(args []string) {
+	fs := newFlagSet("preagg-bench", "Create a pre-aggregation of the events per hour, a materialized view on mobilitydbc and a table filled by a scheduled INSERT-from-SELECT on cratedb,\n"+
+		"refresh it every -refresh-interval and measure the refresh latency and how stale it is before every refresh, while events are inserted by -insert-trips or another load-generator.")
+	var common commonOptions
+	common.register(fs)
+	refreshInterval := fs.Duration("refresh-interval", 30*time.Second, "Interval between the starts of the refreshes, a refresh taking longer delays the next one")
+	duration := fs.Duration("duration", 10*time.Minute, "Stop refreshing after <duration>, 0 refreshes until interrupted or until the insert of -insert-trips finished")
+	insertTrips := fs.String("insert-trips", "", "Insert the trips CSV with an insert command during the refreshes, its results and logs are written into a directory below -results-dir.\n"+
+		"Empty expects the events to be inserted by another load-generator")
+	insertWorkers := fs.Int("insert-nworkers", 4, "Number of workers of the insert of -insert-trips")
+	keep := fs.Bool("keep", false, "Keep the pre-aggregation when the benchmark finishes")
+	fs.Parse(args)
+
+	ctx, stop := signalContext()
+	defer stop()
+	common.setup("preagg-bench", 0)
+	defer common.close()
+	if *refreshInterval <= 0 {
+		logger.Error("Invalid CLI argument", "argument", "refresh-interval", "error", "expected a positive interval")
+		os.Exit(exitConfig)
+	}
+
+	dbTarget := common.dbTarget
+	statements := preaggStatements(dbTarget)
+	logger.Info("Starting load-generator with following cli arguments",
+		"mode", "preagg-bench",
+		"log", common.logLevel,
+		"connString", redactConnString(common.connString),
+		"dbTarget", dbTarget.String(),
+		"refreshInterval", *refreshInterval,
+		"duration", *duration,
+		"insertTrips", *insertTrips,
+		"keep", *keep,
+	)
+	if common.dryRun {
+		fmt.Printf("Dry run of preagg-bench against %s, nothing is executed\n\n", dbTarget)
+		for i, stmt := range statements.Create {
+			printDryRunSQL(fmt.Sprintf("create %d", i+1), targets.PrefixTables(stmt))
+		}
+		for i, stmt := range statements.Refresh {
+			printDryRunSQL(fmt.Sprintf("refresh %d", i+1), targets.PrefixTables(stmt))
+		}
+		for i, stmt := range statements.Drop {
+			printDryRunSQL(fmt.Sprintf("drop %d", i+1), targets.PrefixTables(stmt))
+		}
+		return
+	}
+
+	conn, err := pgx.Connect(ctx, common.connString)
+	if err != nil {
+		logger.Error("Unable to connect to database", "error", err)
+		os.Exit(exitConnection)
+	}
+	defer conn.Close(context.Background())
+
+	file := createArtifactCSV("preagg", dbTarget.String())
+	csvWriter := csv.NewWriter(file)
+	if err := csvWriter.Write(preaggCSVHeader); err != nil {
+		logger.Error("Failed to write pre-aggregation CSV header", "error", err)
+		os.Exit(exitFailure)
+	}
+
+	if err := execStatements(ctx, conn, statements.Create); err != nil {
+		logger.Error("Unable to create the pre-aggregation", "error", err)
+		os.Exit(exitCode(err))
+	}
+	logger.Info("Created the pre-aggregation", "table", targets.Table("escooter_events_per_hour"))
+
+	refreshCtx, stopRefreshing := context.WithCancel(ctx)
+	defer stopRefreshing()
+	if *duration > 0 {
+		refreshCtx, stopRefreshing = context.WithTimeout(refreshCtx, *duration)
+		defer stopRefreshing()
+	}
+
+	summary := PreaggSummary{RunID: runID, DBTarget: dbTarget.String()}
+	var insertWg sync.WaitGroup
+	if *insertTrips != "" {
+		executable, err := os.Executable()
+		if err != nil {
+			logger.Error("Unable to locate the load-generator executable", "error", err)
+			os.Exit(exitFailure)
+		}
+		insertDir := filepath.Join(resultsDir, fmt.Sprintf("preagg_insert_%s", runID))
+		insertArgs := map[string]string{
+			"dbTarget":       common.dbTargetStr,
+			"db":             common.connString,
+			"schema-variant": common.schemaVariant,
+			"schema-prefix":  common.schemaPrefix,
+			"results-dir":    insertDir,
+			"log-dir":        insertDir,
+			"trips":          *insertTrips,
+			"nworkers":       strconv.Itoa(*insertWorkers),
+		}
+		insertWg.Add(1)
+		go func() {
+			defer insertWg.Done()
+			exitCode := runChildCommand(ctx, executable, "insert", flagArgs(insertArgs))
+			summary.InsertExitCode = &exitCode
+			logger.Info("Insert finished", "exitCode", exitCode)
+			// without a duration the refreshes end with the ingest, after a last refresh catching up
+			if *duration <= 0 {
+				stopRefreshing()
+			}
+		}()
+	}
+
+	b := &preaggBench{conn: conn, statements: statements, csvWriter: csvWriter}
+	rows := b.run(refreshCtx, *refreshInterval)
+	// a last refresh catching up after -duration or the end of the insert, unless interrupted
+	if ctx.Err() == nil {
+		rows = append(rows, b.refresh(ctx))
+	}
+	csvWriter.Flush()
+	file.Close()
+	insertWg.Wait()
+	if !*keep {
+		// dropped with a fresh context, so an interrupted run does not leave it behind
+		dropCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		if err := execStatements(dropCtx, conn, statements.Drop); err != nil {
+			logger.Error("Unable to drop the pre-aggregation", "error", err)
+		}
+		cancel()
+	}
+
+	summary.Refresh = results.ComputeLatencyStats(rows)
+	summary.MaxMissingEvents = b.maxMissingEvents
+	summary.MaxStalenessSec = b.maxStaleness.Seconds()
+	summary.Aborted = ctx.Err() != nil
+	writePreaggSummary(summary)
+	printPreaggBench(summary)
+	if summary.Aborted {
+		os.Exit(exitAborted)
+	}
+}
+
+type preaggBench struct {
+	conn       *pgx.Conn
+	statements PreaggStatements
+	csvWriter  *csv.Writer
+
+	refreshes        int
+	lastRefreshStart time.Time // the pre-aggregation contains the events stored before it
+	maxMissingEvents int64
+	maxStaleness     time.Duration
+}
+
+// run refreshes the pre-aggregation every interval until ctx is done, returning the refreshes as rows
+func (b *preaggBench) run(ctx context.Context, interval time.Duration) []results.Row {
+	var rows []results.Row
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		row := b.refresh(ctx)
+		if ctx.Err() != nil {
+			return rows
+		}
+		rows = append(rows, row)
+		select {
+		case <-ctx.Done():
+			return rows
+		case <-ticker.C:
+		}
+	}
+}
+
+// refresh measures the staleness of the pre-aggregation, refreshes it and writes the refresh to the CSV file
+func (b *preaggBench) refresh(ctx context.Context) results.Row {
+	b.refreshes++
+	// before the first successful refresh the materialized view of Postgres can't be read
+	populated := !b.lastRefreshStart.IsZero()
+	var baseEvents, preaggEvents int64
+	var staleness time.Duration
+	var err error
+	if populated {
+		err = b.conn.QueryRow(ctx, targets.PrefixTables(preaggBaseEventsSQL)).Scan(&baseEvents)
+		if err == nil {
+			err = b.conn.QueryRow(ctx, targets.PrefixTables(preaggEventsSQL)).Scan(&preaggEvents)
+		}
+		if err == nil {
+			staleness = time.Since(b.lastRefreshStart)
+			b.maxStaleness = max(b.maxStaleness, staleness)
+			b.maxMissingEvents = max(b.maxMissingEvents, baseEvents-preaggEvents)
+		}
+	}
+
+	startTime := time.Now()
+	if err == nil {
+		err = execStatements(ctx, b.conn, b.statements.Refresh)
+	}
+	endTime := time.Now()
+	if err == nil {
+		b.lastRefreshStart = startTime
+	}
+
+	var errorMsg string
+	if err != nil && ctx.Err() == nil {
+		errorMsg = err.Error()
+		logger.Warn("Refreshing the pre-aggregation failed", "refresh", b.refreshes, "error", err)
+	}
+	stalenessMs := ""
+	if populated {
+		stalenessMs = strconv.FormatInt(staleness.Milliseconds(), 10)
+	}
+	record := []string{
+		runID,
+		strconv.Itoa(b.refreshes),
+		startTime.Format(time.RFC3339Nano),
+		endTime.Format(time.RFC3339Nano),
+		strconv.FormatInt(endTime.Sub(startTime).Microseconds(), 10),
+		strconv.FormatInt(results.MonotonicUs(startTime), 10),
+		strconv.FormatBool(err == nil),
+		strconv.FormatInt(baseEvents, 10),
+		strconv.FormatInt(preaggEvents, 10),
+		strconv.FormatInt(baseEvents-preaggEvents, 10),
+		stalenessMs,
+		errorMsg,
+	}
+	if ctx.Err() == nil {
+		if err := b.csvWriter.Write(record); err != nil {
+			logger.Error("Failed to write pre-aggregation CSV record", "error", err)
+		}
+		b.csvWriter.Flush()
+		logger.Info("Refreshed the pre-aggregation", "refresh", b.refreshes, "refreshDurationUs", endTime.Sub(startTime).Microseconds(), "missingEvents", baseEvents-preaggEvents, "stalenessMs", staleness.Milliseconds())
+	}
+	return results.Row{
+		RunID:      runID,
+		Name:       "refresh",
+		StartTime:  startTime,
+		StartUs:    results.MonotonicUs(startTime),
+		DurationUs: endTime.Sub(startTime).Microseconds(),
+		Successful: err == nil,
+		Operations: 1,
+	}
+}
+
+func writePreaggSummary(summary PreaggSummary) {
+	filename := filepath.Join(resultsDir, fmt.Sprintf("preagg_summary_%s.json", summary.RunID))
+	b, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		logger.Error("Failed to encode pre-aggregation summary", "error", err)
+		return
+	}
+	if err := writeNewFile(filename, b); err != nil {
+		logger.Error("Failed to write pre-aggregation summary", "filename", filename, "error", err)
+		return
+	}
+	registerArtifact(filename)
+}
+
+func printPreaggBench(summary PreaggSummary) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "Pre-aggregation refreshes of run %s against %s\n", summary.RunID, summary.DBTarget)
+	fmt.Fprintln(w, "\trefreshes\tfailed\tops/s\tmean ms\tp50 ms\tp95 ms\tp99 ms\tmax ms\t")
+	printStatsRow(w, "refresh", summary.Refresh)
+	w.Flush()
+	fmt.Printf("\nMax missing events before a refresh: %d, max staleness: %.1f s\n", summary.MaxMissingEvents, summary.MaxStalenessSec)
+}
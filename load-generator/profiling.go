@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	runtimepprof "runtime/pprof"
+
+	"load-generator/internal/targets"
+)
+
+// startPprofServer serves the net/http/pprof handlers on addr, so the load-generator can be
+// profiled live with `go tool pprof` while a run is in progress.
+// Returned function stops the server.
+func startPprofServer(addr string) func() {
+	if addr == "" {
+		return func() {}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		logger.Error("Unable to listen for pprof", "addr", addr, "error", err)
+		os.Exit(exitConfig)
+	}
+	server := &http.Server{Handler: mux}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("pprof server failed", "error", err)
+		}
+	}()
+	logger.Info("Serving pprof", "addr", listener.Addr().String())
+
+	return func() {
+		server.Close()
+	}
+}
+
+// startProfiling writes a CPU profile of the whole run and a heap profile at its end into the results directory.
+// Returned function stops the CPU profile and writes the heap profile.
+func startProfiling(enabled bool, mode string, dbTarget targets.DBTarget, numWorkers int) func() {
+	if !enabled {
+		return func() {}
+	}
+
+	cpuFile := createArtifact(".pprof", "cpu", mode, dbTarget.String(), workersPart(numWorkers))
+	if err := runtimepprof.StartCPUProfile(cpuFile); err != nil {
+		logger.Error("Unable to start CPU profile", "error", err)
+		os.Exit(exitFailure)
+	}
+
+	return func() {
+		runtimepprof.StopCPUProfile()
+		cpuFile.Close()
+
+		heapFile := createArtifact(".pprof", "heap", mode, dbTarget.String(), workersPart(numWorkers))
+		defer heapFile.Close()
+		// up-to-date statistics of the allocations of the run
+		runtime.GC()
+		if err := runtimepprof.WriteHeapProfile(heapFile); err != nil {
+			logger.Error("Failed to write heap profile", "error", err)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"load-generator/internal/targets"
+	"load-generator/internal/workload"
+)
+
+// ReconciliationReport compares the events stored per trip with the events of the trips file after an insert run
+type ReconciliationReport struct {
+	Trips           int    `json:"trips"` // of the trips file
+	ExpectedEvents  int64  `json:"expectedEvents"`
+	StoredEvents    int64  `json:"storedEvents"`
+	MissingTrips    int    `json:"missingTrips"`    // trips of the file without any stored event
+	IncompleteTrips int    `json:"incompleteTrips"` // trips with fewer stored events than in the file
+	ExcessTrips     int    `json:"excessTrips"`     // trips with more stored events than in the file, e.g. of an earlier run
+	UnexpectedTrips int    `json:"unexpectedTrips"` // stored trips not in the file
+	File            string `json:"file,omitempty"`  // CSV listing the mismatching trips
+}
+
+// Mismatches returns the number of trips whose stored events don't match the file
+func (r *ReconciliationReport) Mismatches() int {
+	if r == nil {
+		return 0
+	}
+	return r.MissingTrips + r.IncompleteTrips + r.ExcessTrips + r.UnexpectedTrips
+}
+
+// reconcileTrips counts the stored events of every trip and compares them with the trips file,
+// writing the mismatching trips to the reconciliation CSV file
+func reconcileTrips(ctx context.Context, connString string, dbTarget targets.DBTarget, tripsPath string, numWorkers int) *ReconciliationReport {
+	expected, err := workload.ReadTripEventCounts(ctx, tripsPath)
+	if err != nil {
+		logger.Error("Unable to count the events per trip of the trips file", "trips", tripsPath, "error", err)
+		os.Exit(exitFailure)
+	}
+
+	conn, err := pgx.Connect(ctx, connString)
+	if err != nil {
+		logger.Error("Unable to connect to database", "error", err)
+		os.Exit(exitConnection)
+	}
+	defer conn.Close(context.Background())
+	stored := make(map[string]int64)
+	for _, tenant := range tenancy.SchemaTenants() {
+		counts, err := targets.CountTripEvents(ctx, conn, dbTarget, tenant)
+		if err != nil {
+			logger.Error("Unable to count the stored events per trip", "error", err)
+			os.Exit(exitFailure)
+		}
+		for tripID, count := range counts {
+			stored[tripID] += count
+		}
+	}
+
+	report := &ReconciliationReport{Trips: len(expected)}
+	var mismatches [][]string
+	for _, tripID := range slices.Sorted(maps.Keys(expected)) {
+		want, got := expected[tripID], stored[tripID]
+		report.ExpectedEvents += want
+		switch {
+		case got == 0:
+			report.MissingTrips++
+		case got < want:
+			report.IncompleteTrips++
+		case got > want:
+			report.ExcessTrips++
+		default:
+			continue
+		}
+		mismatches = append(mismatches, reconciliationRecord(tripID, want, got))
+	}
+	for _, tripID := range slices.Sorted(maps.Keys(stored)) {
+		report.StoredEvents += stored[tripID]
+		if _, ok := expected[tripID]; !ok {
+			report.UnexpectedTrips++
+			mismatches = append(mismatches, reconciliationRecord(tripID, 0, stored[tripID]))
+		}
+	}
+
+	if len(mismatches) > 0 {
+		report.File = writeReconciliationCSV(dbTarget, numWorkers, mismatches)
+		logger.Error("Stored events don't match the trips file",
+			"missingTrips", report.MissingTrips,
+			"incompleteTrips", report.IncompleteTrips,
+			"excessTrips", report.ExcessTrips,
+			"unexpectedTrips", report.UnexpectedTrips,
+			"expectedEvents", report.ExpectedEvents,
+			"storedEvents", report.StoredEvents,
+			"filename", report.File,
+		)
+	} else {
+		logger.Info("Stored events match the trips file", "trips", report.Trips, "events", report.StoredEvents)
+	}
+	return report
+}
+
+func reconciliationRecord(tripID string, expected, stored int64) []string {
+	return []string{
+		runID,
+		tripID,
+		strconv.FormatInt(expected, 10),
+		strconv.FormatInt(stored, 10),
+		strconv.FormatInt(stored-expected, 10),
+	}
+}
+
+func writeReconciliationCSV(dbTarget targets.DBTarget, numWorkers int, records [][]string) string {
+	timestamp := time.Now().Format("20060102_150405")
+
+	filename := fmt.Sprintf("reconciliation_insert_%s_%dw_%s_%s.csv",
+		dbTarget.String(), numWorkers, timestamp, runID)
+	filename = path.Join(resultsDir, filename)
+
+	file, err := createNewFile(filename)
+	if err != nil {
+		logger.Error("Failed to create reconciliation CSV file", "filename", filename, "error", err)
+		os.Exit(exitFailure)
+	}
+	defer file.Close()
+	csvWriter := csv.NewWriter(file)
+	csvWriter.Write([]string{"runId", "tripId", "expectedEvents", "storedEvents", "difference"})
+	csvWriter.WriteAll(records)
+	if err := csvWriter.Error(); err != nil {
+		logger.Error("Failed to write reconciliation CSV file", "filename", filename, "error", err)
+		os.Exit(exitFailure)
+	}
+
+	registerArtifact(filename)
+	return filename
+}
+
+// DuplicateReport counts the events stored more than once after an ingesting run
+type DuplicateReport struct {
+	EventIDs    int64 `json:"eventIds"`    // event IDs stored more than once
+	SurplusRows int64 `json:"surplusRows"` // rows beyond the first of each duplicated event ID
+}
+
+// detectDuplicates counts the event IDs stored more than once, e.g. by batches retried after their connection was lost
+func detectDuplicates(ctx context.Context, connString string, dbTarget targets.DBTarget) *DuplicateReport {
+	conn, err := pgx.Connect(ctx, connString)
+	if err != nil {
+		logger.Warn("Unable to connect to database to detect duplicate events", "error", err)
+		return nil
+	}
+	defer conn.Close(context.Background())
+	report := &DuplicateReport{}
+	for _, tenant := range tenancy.SchemaTenants() {
+		eventIDs, surplusRows, err := targets.CountDuplicateEvents(ctx, conn, dbTarget, tenant)
+		if err != nil {
+			logger.Warn("Unable to detect duplicate events", "error", err)
+			return nil
+		}
+		report.EventIDs += eventIDs
+		report.SurplusRows += surplusRows
+	}
+	if report.EventIDs > 0 {
+		logger.Warn("Events are stored more than once", "eventIds", report.EventIDs, "surplusRows", report.SurplusRows)
+	} else {
+		logger.Info("No event is stored more than once")
+	}
+	return report
+}
+
+// TripIntegrityReport compares the trips table aggregated after an insert run with the stored events
+type TripIntegrityReport struct {
+	EventTrips     int    `json:"eventTrips"`     // distinct trips of the stored events
+	Trips          int    `json:"trips"`          // distinct trips of the trips table
+	MissingTrips   int    `json:"missingTrips"`   // trips of the events without a row in trips
+	OrphanTrips    int    `json:"orphanTrips"`    // trips without any stored event
+	DuplicateTrips int    `json:"duplicateTrips"` // trips with more than one row
+	StaleTrips     int    `json:"staleTrips"`     // trips with another number of instants than stored events, e.g. of events inserted during the aggregation
+	File           string `json:"file,omitempty"` // CSV listing the trips with issues
+}
+
+// Issues returns the number of trips which don't have exactly one row with all their events
+func (r *TripIntegrityReport) Issues() int {
+	if r == nil {
+		return 0
+	}
+	return r.MissingTrips + r.OrphanTrips + r.DuplicateTrips + r.StaleTrips
+}
+
+// checkTripIntegrity verifies that every trip of the stored events has exactly one row in trips containing all its events
+// and that trips has no rows without events, writing the trips with issues to the trip integrity CSV file
+func checkTripIntegrity(ctx context.Context, connString string, dbTarget targets.DBTarget, numWorkers int) *TripIntegrityReport {
+	conn, err := pgx.Connect(ctx, connString)
+	if err != nil {
+		logger.Error("Unable to connect to database", "error", err)
+		os.Exit(exitConnection)
+	}
+	defer conn.Close(context.Background())
+	events, err := targets.CountTripEvents(ctx, conn, dbTarget, 0)
+	if err != nil {
+		logger.Error("Unable to count the stored events per trip", "error", err)
+		os.Exit(exitFailure)
+	}
+	trips, err := targets.CountTripRows(ctx, conn)
+	if err != nil {
+		logger.Error("Unable to count the rows per trip of the trips table", "error", err)
+		os.Exit(exitFailure)
+	}
+
+	report := &TripIntegrityReport{EventTrips: len(events), Trips: len(trips)}
+	var issues [][]string
+	for _, tripID := range slices.Sorted(maps.Keys(events)) {
+		trip, ok := trips[tripID]
+		var issue string
+		switch {
+		case !ok:
+			report.MissingTrips++
+			issue = "missing"
+		case trip.Rows > 1:
+			report.DuplicateTrips++
+			issue = "duplicate"
+		case trip.Instants != events[tripID]:
+			report.StaleTrips++
+			issue = "stale"
+		default:
+			continue
+		}
+		issues = append(issues, tripIntegrityRecord(tripID, issue, events[tripID], trip))
+	}
+	for _, tripID := range slices.Sorted(maps.Keys(trips)) {
+		if _, ok := events[tripID]; !ok {
+			report.OrphanTrips++
+			issues = append(issues, tripIntegrityRecord(tripID, "orphan", 0, trips[tripID]))
+		}
+	}
+
+	if len(issues) > 0 {
+		report.File = writeTripIntegrityCSV(dbTarget, numWorkers, issues)
+		logger.Error("Trips table doesn't match the stored events",
+			"missingTrips", report.MissingTrips,
+			"orphanTrips", report.OrphanTrips,
+			"duplicateTrips", report.DuplicateTrips,
+			"staleTrips", report.StaleTrips,
+			"eventTrips", report.EventTrips,
+			"trips", report.Trips,
+			"filename", report.File,
+		)
+	} else {
+		logger.Info("Trips table matches the stored events", "trips", report.Trips)
+	}
+	return report
+}
+
+func tripIntegrityRecord(tripID, issue string, events int64, trip targets.TripRows) []string {
+	return []string{
+		runID,
+		tripID,
+		issue,
+		strconv.FormatInt(events, 10),
+		strconv.FormatInt(trip.Rows, 10),
+		strconv.FormatInt(trip.Instants, 10),
+	}
+}
+
+func writeTripIntegrityCSV(dbTarget targets.DBTarget, numWorkers int, records [][]string) string {
+	timestamp := time.Now().Format("20060102_150405")
+
+	filename := fmt.Sprintf("trip_integrity_insert_%s_%dw_%s_%s.csv",
+		dbTarget.String(), numWorkers, timestamp, runID)
+	filename = path.Join(resultsDir, filename)
+
+	file, err := createNewFile(filename)
+	if err != nil {
+		logger.Error("Failed to create trip integrity CSV file", "filename", filename, "error", err)
+		os.Exit(exitFailure)
+	}
+	defer file.Close()
+	csvWriter := csv.NewWriter(file)
+	csvWriter.Write([]string{"runId", "tripId", "issue", "storedEvents", "tripRows", "tripInstants"})
+	csvWriter.WriteAll(records)
+	if err := csvWriter.Error(); err != nil {
+		logger.Error("Failed to write trip integrity CSV file", "filename", filename, "error", err)
+		os.Exit(exitFailure)
+	}
+
+	registerArtifact(filename)
+	return filename
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"load-generator/internal/targets"
+	"load-generator/internal/workload"
+)
+
+const replMaxPrintedRows = 10
+
+const replHelp = `Commands:
+  list              list the loaded templates
+  use <name|number> select a template
+  index <n>         generate the fields for query index n
+  fields            print the generated fields
+  show              print the rendered SQL of the selected template
+  exec              execute the rendered SQL and print its timing and first rows
+  reload            re-read the templates file
+  help              print this help
+  quit              exit, as does Ctrl-D`
+
+// repl renders and executes query templates interactively, the database is only connected on the first exec
+type repl struct {
+	connString      string
+	queriesFilepath string
+	generator       *workload.QueryFieldGenerator
+
+	templates  *template.Template
+	names      []string
+	selected   string
+	queryIndex int
+	fields     workload.QueryFields
+	conn       *pgx.Conn
+}
+
+func runRepl(args []string) {
+	fs := newFlagSet("repl", "Interactively render query templates with generated fields and optionally execute them, for developing new templates.")
+	var common commonOptions
+	common.register(fs)
+	localitiesPath := fs.String("localities", "../escooter-trips-generator/output/berlin-localities.geojson", "Path or https:// or s3:// URL of a GeoJSON, GeoParquet (.parquet) or shapefile (.shp or .zip) file containing localities")
+	localityFields := registerLocalityFields(fs)
+	poisPath := fs.String("pois", "../escooter-trips-generator/output/berlin-pois.csv", "Path or https:// or s3:// URL of a CSV or GeoParquet (.parquet) file containing POIs")
+	tripsPath := fs.String("trips", "../escooter-trips-generator/output/escooter-trips-small.csv", "Path or https:// or s3:// URL of a CSV file containing the escooter trip events")
+	randomSeed := fs.Int64("seed", 42, "Random seed for deterministic query generation")
+	queriesFilepath := fs.String("queries", "./schemas/cratedb-simple-read-queries.tmpl", "Path to a file containing query templates")
+	fs.Parse(args)
+
+	common.setup("repl", 0)
+	defer common.close()
+
+	localities := mustLoadLocalities(*localitiesPath, *localityFields)
+	pois := mustLoadPOIs(*poisPath)
+	tripIds, err := workload.ReadTripIDs(context.Background(), *tripsPath)
+	if err != nil {
+		logger.Error("Unable to read trip ids", "error", err)
+		os.Exit(exitConfig)
+	}
+
+	r := &repl{
+		connString:      common.connString,
+		queriesFilepath: *queriesFilepath,
+		generator:       mustNewQueryFieldGenerator(*randomSeed, localities, pois, tripIds),
+	}
+	r.setTemplates(mustLoadTemplates(*queriesFilepath))
+	r.fields = r.generator.GenerateFields(r.queryIndex)
+	defer func() {
+		if r.conn != nil {
+			r.conn.Close(context.Background())
+		}
+	}()
+
+	fmt.Println(replHelp)
+	fmt.Println()
+	r.list(os.Stdout)
+	r.loop(os.Stdin, os.Stdout)
+}
+
+func (r *repl) setTemplates(templates *template.Template) {
+	r.templates = templates.Option("missingkey=error")
+	r.names = workload.TemplateNames(templates)
+	if r.templates.Lookup(r.selected) == nil {
+		r.selected = ""
+	}
+}
+
+func (r *repl) loop(in io.Reader, out io.Writer) {
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprintf(out, "%s[%d]> ", r.selected, r.queryIndex)
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return
+		}
+		command, arg, _ := strings.Cut(strings.TrimSpace(scanner.Text()), " ")
+		arg = strings.TrimSpace(arg)
+
+		var err error
+		switch command {
+		case "":
+		case "list", "ls":
+			r.list(out)
+		case "use":
+			err = r.use(arg)
+			if err == nil {
+				err = r.show(out)
+			}
+		case "index":
+			err = r.setIndex(arg)
+			if err == nil && r.selected != "" {
+				err = r.show(out)
+			}
+		case "fields":
+			b, _ := json.MarshalIndent(r.fields, "", "  ")
+			fmt.Fprintln(out, string(b))
+		case "show":
+			err = r.show(out)
+		case "exec", "run":
+			err = r.exec(out)
+		case "reload":
+			var templates *template.Template
+			templates, err = workload.LoadTemplates(r.queriesFilepath)
+			if err == nil {
+				r.setTemplates(templates)
+				fmt.Fprintf(out, "Reloaded %d templates\n", len(r.names))
+			}
+		case "help", "?":
+			fmt.Fprintln(out, replHelp)
+		case "quit", "exit", "q":
+			return
+		default:
+			err = fmt.Errorf("Unknown command %q, type help to list the commands", command)
+		}
+		if err != nil {
+			fmt.Fprintln(out, "Error:", err)
+		}
+	}
+}
+
+func (r *repl) list(out io.Writer) {
+	for i, name := range r.names {
+		fmt.Fprintf(out, "  %2d  %s\n", i+1, name)
+	}
+}
+
+func (r *repl) use(arg string) error {
+	if n, err := strconv.Atoi(arg); err == nil {
+		if n < 1 || n > len(r.names) {
+			return fmt.Errorf("No template with number %d", n)
+		}
+		arg = r.names[n-1]
+	}
+	if r.templates.Lookup(arg) == nil {
+		return fmt.Errorf("No template named %q", arg)
+	}
+	r.selected = arg
+	return nil
+}
+
+func (r *repl) setIndex(arg string) error {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 0 {
+		return fmt.Errorf("Invalid query index %q", arg)
+	}
+	r.queryIndex = n
+	r.fields = r.generator.GenerateFields(n)
+	return nil
+}
+
+func (r *repl) render() (string, error) {
+	if r.selected == "" {
+		return "", fmt.Errorf("No template selected, select one with use <name|number>")
+	}
+	var query strings.Builder
+	if err := r.templates.ExecuteTemplate(&query, r.selected, targets.EscapeQueryFields(r.fields)); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(targets.PrefixTables(query.String())), nil
+}
+
+func (r *repl) show(out io.Writer) error {
+	query, err := r.render()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, query)
+	return nil
+}
+
+func (r *repl) exec(out io.Writer) error {
+	query, err := r.render()
+	if err != nil {
+		return err
+	}
+
+	// Ctrl-C cancels the running query instead of exiting the repl
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if r.conn == nil {
+		conn, err := pgx.Connect(ctx, r.connString)
+		if err != nil {
+			return fmt.Errorf("Unable to connect to database: %w", err)
+		}
+		r.conn = conn
+	}
+
+	startTime := time.Now()
+	rows, err := r.conn.Query(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns := make([]string, len(rows.FieldDescriptions()))
+	for i, fd := range rows.FieldDescriptions() {
+		columns[i] = fd.Name
+	}
+	var printed [][]any
+	rowsCount := 0
+	for rows.Next() {
+		rowsCount++
+		if len(printed) < replMaxPrintedRows {
+			values, err := rows.Values()
+			if err != nil {
+				return err
+			}
+			printed = append(printed, values)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	duration := time.Since(startTime)
+
+	fmt.Fprintln(out, strings.Join(columns, " | "))
+	for _, values := range printed {
+		strs := make([]string, len(values))
+		for i, v := range values {
+			strs[i] = fmt.Sprint(v)
+		}
+		fmt.Fprintln(out, strings.Join(strs, " | "))
+	}
+	if rowsCount > len(printed) {
+		fmt.Fprintf(out, "... %d more rows\n", rowsCount-len(printed))
+	}
+	fmt.Fprintf(out, "%d rows in %.3f ms\n", rowsCount, float64(duration.Microseconds())/1000)
+	return nil
+}
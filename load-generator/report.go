@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"load-generator/internal/results"
+)
+
+const (
+	chartWidth  = 720
+	chartHeight = 240
+	chartMargin = 40
+)
+
+type reportGroup struct {
+	Name  string
+	Stats results.LatencyStats
+}
+
+type reportData struct {
+	Title           string
+	GeneratedAt     string
+	ResultsFile     string
+	Kind            string
+	RunID           string
+	Overall         results.LatencyStats
+	Groups          []reportGroup
+	LatencyChart    template.HTML
+	ThroughputChart template.HTML
+	Metadata        string
+	Summary         string
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"ms": func(us float64) string { return fmt.Sprintf("%.3f", us/1000) },
+	"f1": func(v float64) string { return fmt.Sprintf("%.1f", v) },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em auto; max-width: 960px; color: #222; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+pre { background: #f5f5f5; padding: 1em; overflow-x: auto; }
+svg { background: #fafafa; border: 1px solid #ddd; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>Run <code>{{.RunID}}</code>, {{.Kind}} benchmark, results from <code>{{.ResultsFile}}</code>, generated {{.GeneratedAt}}</p>
+
+<h2>Summary</h2>
+<table>
+<tr><th>Operations</th><th>Requests</th><th>Failed</th><th>Duration [s]</th><th>Throughput [ops/s]</th><th>Mean [ms]</th><th>p50 [ms]</th><th>p90 [ms]</th><th>p95 [ms]</th><th>p99 [ms]</th><th>Max [ms]</th></tr>
+<tr><td>{{.Overall.Operations}}</td><td>{{.Overall.Count}}</td><td>{{.Overall.Failed}}</td><td>{{f1 .Overall.DurationSec}}</td><td>{{f1 .Overall.OpsPerSec}}</td><td>{{ms .Overall.MeanUs}}</td><td>{{ms .Overall.P50Us}}</td><td>{{ms .Overall.P90Us}}</td><td>{{ms .Overall.P95Us}}</td><td>{{ms .Overall.P99Us}}</td><td>{{ms .Overall.MaxUs}}</td></tr>
+</table>
+
+<h2>Per {{if eq .Kind "query"}}template{{else}}job type{{end}}</h2>
+<table>
+<tr><th>Name</th><th>Requests</th><th>Failed</th><th>Mean [ms]</th><th>p50 [ms]</th><th>p95 [ms]</th><th>p99 [ms]</th><th>Max [ms]</th></tr>
+{{range .Groups}}<tr><td>{{.Name}}</td><td>{{.Stats.Count}}</td><td>{{.Stats.Failed}}</td><td>{{ms .Stats.MeanUs}}</td><td>{{ms .Stats.P50Us}}</td><td>{{ms .Stats.P95Us}}</td><td>{{ms .Stats.P99Us}}</td><td>{{ms .Stats.MaxUs}}</td></tr>
+{{end}}</table>
+
+<h2>Latency distribution</h2>
+{{.LatencyChart}}
+
+<h2>Throughput over time</h2>
+{{.ThroughputChart}}
+
+{{if .Summary}}<h2>Run summary</h2>
+<pre>{{.Summary}}</pre>{{end}}
+{{if .Metadata}}<h2>Run metadata</h2>
+<pre>{{.Metadata}}</pre>{{end}}
+</body>
+</html>
+`))
+
+// runReport bundles summary statistics, charts and the run metadata into a single HTML file
+func runReport(args []string) {
+	fs := newFlagSet("report", "Generate a self-contained HTML report with statistics, charts and the run metadata of a results CSV file.")
+	resultsPath := fs.String("results", "", "Path to a results CSV produced by the insert or query mode")
+	outPath := fs.String("out", "", "Path of the HTML report, defaults to the results path with .html extension")
+	fs.Parse(args)
+
+	logger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+	if *resultsPath == "" {
+		logger.Error("Missing CLI argument", "argument", "results")
+		os.Exit(exitConfig)
+	}
+	if *outPath == "" {
+		*outPath = strings.TrimSuffix(*resultsPath, filepath.Ext(*resultsPath)) + ".html"
+	}
+
+	data, err := results.LoadCSV(*resultsPath)
+	if err != nil {
+		logger.Error("Unable to load results", "error", err)
+		os.Exit(exitConfig)
+	}
+
+	report := reportData{
+		Title:       fmt.Sprintf("Load-generator %s report", data.Kind),
+		GeneratedAt: time.Now().Format(time.RFC3339),
+		ResultsFile: filepath.Base(*resultsPath),
+		Kind:        data.Kind,
+		RunID:       data.RunID,
+		Overall:     results.ComputeLatencyStats(data.Rows),
+	}
+	names, groups := results.GroupRows(data.Rows)
+	for _, name := range names {
+		report.Groups = append(report.Groups, reportGroup{Name: name, Stats: results.ComputeLatencyStats(groups[name])})
+	}
+	report.LatencyChart = latencyHistogramSVG(data.Rows)
+	report.ThroughputChart = throughputSVG(data.Rows)
+
+	// metadata and summary files of the same run are located next to the results
+	if data.RunID != "" {
+		report.Metadata = readRunArtifact(filepath.Dir(*resultsPath), "metadata_", data.RunID)
+		report.Summary = readRunArtifact(filepath.Dir(*resultsPath), "summary_", data.RunID)
+	}
+
+	f, err := os.Create(*outPath)
+	if err != nil {
+		logger.Error("Unable to create report file", "filename", *outPath, "error", err)
+		os.Exit(exitFailure)
+	}
+	defer f.Close()
+	if err := reportTemplate.Execute(f, report); err != nil {
+		logger.Error("Unable to render report", "error", err)
+		os.Exit(exitFailure)
+	}
+	logger.Info("Wrote HTML report", "filename", *outPath, "rows", len(data.Rows))
+}
+
+// readRunArtifact returns the pretty-printed JSON artifact of the run, or empty string if none exists
+func readRunArtifact(dir, prefix, runID string) string {
+	matches, _ := filepath.Glob(filepath.Join(dir, prefix+"*"+runID+".json"))
+	if len(matches) == 0 {
+		return ""
+	}
+	b, err := os.ReadFile(matches[0])
+	if err != nil {
+		logger.Warn("Unable to read run artifact", "filename", matches[0], "error", err)
+		return ""
+	}
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return string(b)
+	}
+	pretty, _ := json.MarshalIndent(v, "", "  ")
+	return string(pretty)
+}
+
+// latencyHistogramSVG draws a histogram of successful latencies up to the 99th percentile
+func latencyHistogramSVG(rows []results.Row) template.HTML {
+	var durations []float64
+	for _, row := range rows {
+		if row.Successful {
+			durations = append(durations, float64(row.DurationUs)/1000)
+		}
+	}
+	if len(durations) == 0 {
+		return "<p>No successful operations.</p>"
+	}
+	sort.Float64s(durations)
+	upper := results.Percentile(durations, 0.99)
+	if upper <= 0 {
+		upper = durations[len(durations)-1] + 1
+	}
+
+	const numBins = 50
+	bins := make([]int, numBins)
+	for _, d := range durations {
+		if d > upper {
+			continue // outliers above p99 are left out
+		}
+		bins[min(int(d/upper*numBins), numBins-1)]++
+	}
+	maxCount := 0
+	for _, c := range bins {
+		maxCount = max(maxCount, c)
+	}
+
+	var b strings.Builder
+	writeChartStart(&b, "latency [ms]", "count", upper, float64(maxCount))
+	barWidth := float64(chartWidth-2*chartMargin) / numBins
+	for i, c := range bins {
+		h := float64(c) / float64(maxCount) * float64(chartHeight-2*chartMargin)
+		fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="#4a7fb5"/>`,
+			chartMargin+float64(i)*barWidth, float64(chartHeight-chartMargin)-h, math.Max(barWidth-1, 1), h)
+	}
+	b.WriteString("</svg>")
+	return template.HTML(b.String())
+}
+
+// throughputSVG draws the number of completed operations per second
+func throughputSVG(rows []results.Row) template.HTML {
+	if len(rows) == 0 {
+		return "<p>No operations.</p>"
+	}
+	first := rows[0].StartUs
+	for _, row := range rows {
+		first = min(first, row.StartUs)
+	}
+	perSecond := make(map[int]int)
+	lastSecond := 0
+	for _, row := range rows {
+		second := int((row.StartUs + row.DurationUs - first) / 1e6)
+		perSecond[second] += row.Operations
+		lastSecond = max(lastSecond, second)
+	}
+	maxOps := 0
+	for _, ops := range perSecond {
+		maxOps = max(maxOps, ops)
+	}
+	if maxOps == 0 {
+		maxOps = 1
+	}
+
+	var b strings.Builder
+	writeChartStart(&b, "time [s]", "ops/s", float64(lastSecond+1), float64(maxOps))
+	b.WriteString(`<polyline fill="none" stroke="#c0504d" stroke-width="1.5" points="`)
+	for s := 0; s <= lastSecond; s++ {
+		x := chartMargin + float64(s)/float64(lastSecond+1)*float64(chartWidth-2*chartMargin)
+		y := float64(chartHeight-chartMargin) - float64(perSecond[s])/float64(maxOps)*float64(chartHeight-2*chartMargin)
+		fmt.Fprintf(&b, "%.1f,%.1f ", x, y)
+	}
+	b.WriteString(`"/></svg>`)
+	return template.HTML(b.String())
+}
+
+func writeChartStart(b *strings.Builder, xLabel, yLabel string, xMax, yMax float64) {
+	fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-size="11">`, chartWidth, chartHeight)
+	// axes
+	fmt.Fprintf(b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#333"/>`, chartMargin, chartHeight-chartMargin, chartWidth-chartMargin, chartHeight-chartMargin)
+	fmt.Fprintf(b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#333"/>`, chartMargin, chartMargin, chartMargin, chartHeight-chartMargin)
+	// axis labels and maximum values
+	fmt.Fprintf(b, `<text x="%d" y="%d" text-anchor="end">%s</text>`, chartWidth-chartMargin, chartHeight-8, template.HTMLEscapeString(xLabel))
+	fmt.Fprintf(b, `<text x="4" y="%d">%s</text>`, chartMargin-8, template.HTMLEscapeString(yLabel))
+	fmt.Fprintf(b, `<text x="%d" y="%d" text-anchor="end">%.3g</text>`, chartWidth-chartMargin, chartHeight-chartMargin+14, xMax)
+	fmt.Fprintf(b, `<text x="%d" y="%d" text-anchor="end">%.3g</text>`, chartMargin-4, chartMargin+4, yMax)
+	fmt.Fprintf(b, `<text x="%d" y="%d" text-anchor="end">0</text>`, chartMargin-4, chartHeight-chartMargin)
+}
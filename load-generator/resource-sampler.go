@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"load-generator/internal/targets"
+)
+
+type ResourceSample struct {
+	Timestamp      string
+	CPUUserSec     float64
+	CPUSystemSec   float64
+	CPUPercent     float64 // percent of a single core, like top
+	RSSBytes       int64
+	Goroutines     int
+	NumGC          uint32
+	GCPauseTotalMs float64
+}
+
+// startResourceSampler periodically samples the load-generator's own resource usage
+// and writes it to the timeline CSV file, so runs bounded by the client can be detected.
+// Returned function stops the sampler and closes the file.
+func startResourceSampler(ctx context.Context, interval time.Duration, mode string, dbTarget targets.DBTarget, numWorkers int) func() {
+	if interval <= 0 {
+		return func() {}
+	}
+
+	file := createArtifactCSV("timeline", mode, dbTarget.String(), workersPart(numWorkers))
+	csvWriter := csv.NewWriter(file)
+
+	csvHeader := []string{"runId", "timestamp", "cpuUserSec", "cpuSystemSec", "cpuPercent", "rssBytes", "goroutines", "numGC", "gcPauseTotalMs"}
+	if err := csvWriter.Write(csvHeader); err != nil {
+		logger.Error("Failed to write timeline CSV header", "error", err)
+		os.Exit(exitFailure)
+	}
+
+	samplerCtx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		sampleResources(samplerCtx, interval, csvWriter)
+	}()
+
+	return func() {
+		cancel()
+		wg.Wait()
+		csvWriter.Flush()
+		file.Close()
+	}
+}
+
+func sampleResources(ctx context.Context, interval time.Duration, csvWriter *csv.Writer) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	numCPU := runtime.NumCPU()
+	lastWall := time.Now()
+	lastCPU := 0.0
+	if sample, err := takeResourceSample(); err == nil {
+		lastCPU = sample.CPUUserSec + sample.CPUSystemSec
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			sample, err := takeResourceSample()
+			if err != nil {
+				logger.Warn("Failed to sample client resource usage", "error", err)
+				continue
+			}
+
+			cpu := sample.CPUUserSec + sample.CPUSystemSec
+			if wall := now.Sub(lastWall).Seconds(); wall > 0 {
+				sample.CPUPercent = (cpu - lastCPU) / wall * 100
+			}
+			lastWall = now
+			lastCPU = cpu
+
+			logger.Debug("Client resource usage",
+				"cpuPercent", sample.CPUPercent,
+				"rssBytes", sample.RSSBytes,
+				"goroutines", sample.Goroutines,
+				"gcPauseTotalMs", sample.GCPauseTotalMs,
+			)
+			// results are bounded by the generator rather than the database
+			if sample.CPUPercent >= float64(numCPU)*90 {
+				logger.Warn("Load-generator is close to CPU saturation, results may be client-bound",
+					"cpuPercent", sample.CPUPercent,
+					"numCPU", numCPU,
+				)
+			}
+
+			statsd.Gauge("client.cpu_percent", sample.CPUPercent)
+			statsd.Gauge("client.rss_bytes", float64(sample.RSSBytes))
+			statsd.Gauge("client.goroutines", float64(sample.Goroutines))
+
+			record := []string{
+				runID,
+				sample.Timestamp,
+				fmt.Sprintf("%.3f", sample.CPUUserSec),
+				fmt.Sprintf("%.3f", sample.CPUSystemSec),
+				fmt.Sprintf("%.1f", sample.CPUPercent),
+				fmt.Sprintf("%d", sample.RSSBytes),
+				fmt.Sprintf("%d", sample.Goroutines),
+				fmt.Sprintf("%d", sample.NumGC),
+				fmt.Sprintf("%.3f", sample.GCPauseTotalMs),
+			}
+			if err := csvWriter.Write(record); err != nil {
+				logger.Error("Failed to write timeline CSV record", "error", err)
+			}
+			csvWriter.Flush()
+		}
+	}
+}
+
+func takeResourceSample() (ResourceSample, error) {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return ResourceSample{}, err
+	}
+
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+
+	return ResourceSample{
+		Timestamp:      time.Now().Format(time.RFC3339),
+		CPUUserSec:     time.Duration(usage.Utime.Nano()).Seconds(),
+		CPUSystemSec:   time.Duration(usage.Stime.Nano()).Seconds(),
+		RSSBytes:       readRSSBytes(usage),
+		Goroutines:     runtime.NumGoroutine(),
+		NumGC:          memStats.NumGC,
+		GCPauseTotalMs: float64(memStats.PauseTotalNs) / 1e6,
+	}, nil
+}
+
+// readRSSBytes returns the current resident set size,
+// falling back to the peak RSS where /proc is not available
+func readRSSBytes(usage syscall.Rusage) int64 {
+	statm, err := os.ReadFile("/proc/self/statm")
+	if err == nil {
+		fields := strings.Fields(string(statm))
+		if len(fields) >= 2 {
+			pages, err := strconv.ParseInt(fields[1], 10, 64)
+			if err == nil {
+				return pages * int64(os.Getpagesize())
+			}
+		}
+	}
+	return int64(usage.Maxrss) * 1024
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"load-generator/internal/workload"
+)
+
+// errAPIConnection is wrapped by errors of requests that didn't reach the REST API
+var errAPIConnection = errors.New("REST API connection failed")
+
+// insertRequestTemplate is the name of the template rendering the request of an insert batch
+const insertRequestTemplate = "insert"
+
+// restTarget sends the inserts and queries of a benchmark as HTTP requests to a REST facade in front of the database.
+// A request template renders the request line, e.g. POST /events, optional header lines, an empty line and the body.
+type restTarget struct {
+	baseURL   *url.URL
+	client    *http.Client
+	templates *template.Template
+}
+
+// insertRequest is the data of the insert request template
+type insertRequest struct {
+	RunID  string
+	Events []workload.TripEvent
+}
+
+var restTemplateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// apiOptions are the flags of the insert and query benchmarks sending their operations to a REST API
+type apiOptions struct {
+	target  string
+	timeout time.Duration
+}
+
+func (o *apiOptions) register(fs *flag.FlagSet, templatesUsage string) {
+	fs.StringVar(&o.target, "target", "", "Base URL of a REST API in front of the database, e.g. http://api:8080, to send the operations to as HTTP requests instead of SQL.\n"+templatesUsage+", see schemas/rest-api-*.tmpl. Empty sends SQL to -db")
+	fs.DurationVar(&o.timeout, "api-timeout", 30*time.Second, "Timeout of a request to the REST API of -target")
+}
+
+// mustLoadTarget returns the REST API of -target with the request templates of the file, nil if -target is empty
+func (o *apiOptions) mustLoadTarget(templatesFilepath string, required ...string) *restTarget {
+	if o.target == "" {
+		return nil
+	}
+	templates, err := loadRESTTemplates(templatesFilepath)
+	if err != nil {
+		logger.Error("Unable to load request templates", "filename", templatesFilepath, "error", err)
+		os.Exit(exitConfig)
+	}
+	for _, name := range required {
+		if templates.Lookup(name) == nil {
+			logger.Error("Unable to load request templates", "filename", templatesFilepath, "error", fmt.Sprintf("no template %q defined", name))
+			os.Exit(exitConfig)
+		}
+	}
+	api, err := newRESTTarget(o.target, templates, o.timeout)
+	if err != nil {
+		logger.Error("Invalid CLI argument", "argument", "target", "error", err)
+		os.Exit(exitConfig)
+	}
+	return api
+}
+
+// newRESTTarget returns the target of the base URL http(s)://host[:port][/prefix] rendering its requests with templates
+func newRESTTarget(rawURL string, templates *template.Template, timeout time.Duration) (*restTarget, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("Parsing REST API URL: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("REST API URL must be in the form http(s)://host[:port][/prefix], got %q", rawURL)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// every worker keeps its connection, like the workers of the SQL benchmarks
+	transport.MaxIdleConnsPerHost = 1024
+	return &restTarget{baseURL: u, client: &http.Client{Transport: transport, Timeout: timeout}, templates: templates}, nil
+}
+
+// loadRESTTemplates loads the request templates of a file like the query templates, with the additional function json
+func loadRESTTemplates(templatesFilepath string) (*template.Template, error) {
+	allTemplates, err := template.New(filepath.Base(templatesFilepath)).Funcs(restTemplateFuncs).ParseFiles(templatesFilepath)
+	if err != nil {
+		return nil, err
+	}
+	templates := template.New("").Funcs(restTemplateFuncs).Option("missingkey=error")
+	for _, tmpl := range allTemplates.Templates() {
+		if tmpl.Name() == filepath.Base(templatesFilepath) {
+			continue
+		}
+		if _, err := templates.AddParseTree(tmpl.Name(), tmpl.Tree); err != nil {
+			return nil, fmt.Errorf("Adding template %s: %w", tmpl.Name(), err)
+		}
+	}
+	if len(templates.Templates()) == 0 {
+		return nil, fmt.Errorf("No request templates defined in %s", templatesFilepath)
+	}
+	return templates, nil
+}
+
+// newRequest renders the template with data into a request
+func (t *restTarget) newRequest(ctx context.Context, name string, data any) (*http.Request, error) {
+	var rendered bytes.Buffer
+	if err := t.templates.ExecuteTemplate(&rendered, name, data); err != nil {
+		return nil, fmt.Errorf("%w: executing template %s: %w", errTemplateValidation, name, err)
+	}
+	r := bufio.NewReader(bytes.NewReader(bytes.TrimLeft(rendered.Bytes(), " \t\r\n")))
+	requestLine, _ := r.ReadString('\n')
+	method, target, ok := strings.Cut(strings.TrimSpace(requestLine), " ")
+	if !ok || !strings.HasPrefix(target, "/") {
+		return nil, fmt.Errorf("%w: template %s must start with a request line like GET /path, got %q", errTemplateValidation, name, strings.TrimSpace(requestLine))
+	}
+	header := make(http.Header)
+	for {
+		line, err := r.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok || key == "" || strings.ContainsAny(key, " \t{[\"") {
+			return nil, fmt.Errorf("%w: template %s has the invalid header line %q, the body has to follow an empty line", errTemplateValidation, name, line)
+		}
+		header.Add(strings.TrimSpace(key), strings.TrimSpace(value))
+		if err != nil {
+			break
+		}
+	}
+	body, _ := io.ReadAll(r)
+	body = bytes.TrimSpace(body)
+
+	req, err := http.NewRequestWithContext(ctx, method, t.baseURL.String()+target, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("%w: template %s: %w", errTemplateValidation, name, err)
+	}
+	req.Header = header
+	if len(body) > 0 && header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// do sends the request of the template and returns the body of a 2xx response
+func (t *restTarget) do(ctx context.Context, name string, data any) ([]byte, error) {
+	req, err := t.newRequest(ctx, name, data)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("%w: %w", errAPIConnection, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Reading response of %s %s: %w", req.Method, req.URL.Path, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		if len(body) > 512 {
+			body = body[:512]
+		}
+		return nil, fmt.Errorf("%s %s returned %s: %s", req.Method, req.URL.Path, resp.Status, bytes.TrimSpace(body))
+	}
+	return body, nil
+}
+
+// insertBatch sends the batch with the insert template and returns the number of inserted events,
+// the number "inserted" of a JSON object response or the whole batch for other successful responses
+func (t *restTarget) insertBatch(ctx context.Context, id int, batch []workload.TripEvent) int {
+	body, err := t.do(ctx, insertRequestTemplate, insertRequest{RunID: runID, Events: batch})
+	if err != nil {
+		logger.Warn("Error while inserting escooter events batch via REST API", "worker", id, "error", err)
+		return 0
+	}
+	var resp struct {
+		Inserted *int `json:"inserted"`
+	}
+	if json.Unmarshal(body, &resp) == nil && resp.Inserted != nil {
+		return min(*resp.Inserted, len(batch))
+	}
+	return len(batch)
+}
+
+// query sends the request of the query template and returns the number of resulting rows,
+// the length of a JSON array response or of the array "rows" of a JSON object response, otherwise 0
+func (t *restTarget) query(ctx context.Context, name string, fields workload.QueryFields) (int, error) {
+	body, err := t.do(ctx, name, fields)
+	if err != nil {
+		return 0, err
+	}
+	var rows []json.RawMessage
+	if json.Unmarshal(body, &rows) == nil {
+		return len(rows), nil
+	}
+	var resp struct {
+		Rows []json.RawMessage `json:"rows"`
+	}
+	if json.Unmarshal(body, &resp) == nil {
+		return len(resp.Rows), nil
+	}
+	return 0, nil
+}
+
+// validateQueries sends the request of every query template once, like ValidateTemplates does with the SQL queries
+func (t *restTarget) validateQueries(ctx context.Context, generator *workload.QueryFieldGenerator) error {
+	templateNames := workload.TemplateNames(t.templates)
+	logger.Info("Validating the templates by sending all the request types to the REST API", "templateNames", templateNames)
+	fields := generator.GenerateFields(0)
+	for _, name := range templateNames {
+		if _, err := t.query(ctx, name, fields); err != nil {
+			logger.Error("Template validation failed on requesting the REST API", "template", name, "error", err)
+			if errors.Is(err, errTemplateValidation) || errors.Is(err, errAPIConnection) {
+				return err
+			}
+			return fmt.Errorf("%w: requesting template %s: %w", errTemplateValidation, name, err)
+		}
+		logger.Info("Template validation passed", "template", name)
+	}
+	return nil
+}
+
+// String returns the base URL, for logs and metadata
+func (t *restTarget) String() string {
+	return t.baseURL.Redacted()
+}
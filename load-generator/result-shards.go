@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"load-generator/internal/results"
+)
+
+// ResultShards are results CSV files of the workers of insert and query. With them every worker writes its rows itself
+// instead of sending them to the single CSV writer of the run, which becomes the bottleneck at high worker counts.
+// The rows of all shards are merged into the results CSV file, ordered by start time, when the run finishes.
+// All methods are no-ops on a nil ResultShards, the rows are then written to the results CSV file by the single writer.
+type ResultShards struct {
+	csvWriter *results.CSVWriter // the results CSV file the shards are merged into
+	filenames []string
+	writers   []*results.CSVWriter
+}
+
+var resultShards *ResultShards
+
+// mustCreateResultShards creates a shard of the results CSV file for each worker with -result-shards, nil without
+func (o *benchmarkOptions) mustCreateResultShards(csvWriter *results.CSVWriter, header []string) *ResultShards {
+	if !o.resultShards {
+		return nil
+	}
+	s := &ResultShards{csvWriter: csvWriter}
+	base := strings.TrimSuffix(csvWriter.Name(), ".csv")
+	for id := 1; id <= o.numWorkers; id++ {
+		filename := fmt.Sprintf("%s.shard%03d.csv", base, id)
+		file, err := createNewFile(filename)
+		if err != nil {
+			logger.Error("Failed to create results shard CSV file", "filename", filename, "error", err)
+			os.Exit(exitFailure)
+		}
+		w := results.NewCSVWriter(file, o.flushInterval, o.flushRecords)
+		if err := w.Write(header); err != nil {
+			logger.Error("Failed to write results shard CSV header", "filename", filename, "error", err)
+			os.Exit(exitFailure)
+		}
+		s.filenames = append(s.filenames, filename)
+		s.writers = append(s.writers, w)
+	}
+	logger.Info("Workers write their results into shards, merged into the results CSV file when the run finishes", "shards", len(s.writers))
+	return s
+}
+
+// Write writes the record to the shard of the worker, the workers' IDs start at 1
+func (s *ResultShards) Write(workerID int, record []string) {
+	if s == nil {
+		return
+	}
+	if err := s.writers[workerID-1].Write(record); err != nil {
+		logger.Error("Failed to write CSV record", "workerId", workerID, "error", err)
+	}
+}
+
+// Merge closes the shards and merges their rows into the results CSV file, removing the shards.
+// Shards which can't be merged are kept and uploaded with the other artifacts.
+func (s *ResultShards) Merge() {
+	if s == nil {
+		return
+	}
+	for i, w := range s.writers {
+		if err := w.Close(); err != nil {
+			logger.Error("Failed to flush results shard CSV file", "filename", s.filenames[i], "error", err)
+		}
+	}
+	if err := results.MergeShards(s.csvWriter, s.filenames); err != nil {
+		logger.Error("Failed to merge the results shards into the results CSV file, the shards are kept", "filename", s.csvWriter.Name(), "error", err)
+		for _, filename := range s.filenames {
+			registerArtifact(filename)
+		}
+		return
+	}
+	for _, filename := range s.filenames {
+		os.Remove(filename)
+	}
+	logger.Info("Merged the results shards into the results CSV file", "filename", s.csvWriter.Name(), "shards", len(s.filenames))
+}
+
+// insertCSVHeader returns the header of the insert results CSV file, with the columns of -tenants and -impairments
+func insertCSVHeader() []string {
+	return tenancy.CSVHeader(networkImpairments.CSVHeader(results.InsertCSVHeader))
+}
+
+func insertCSVRecord(event results.InsertEvent) []string {
+	return tenancy.CSVRecord(networkImpairments.CSVRecord(event.CSVRecord(runID), event.StartMonotonicUs), event.Tenant)
+}
+
+// queryCSVHeader returns the header of the query results CSV file, with the columns of -tenants and -impairments
+func queryCSVHeader() []string {
+	return tenancy.CSVHeader(networkImpairments.CSVHeader(results.QueryCSVHeader))
+}
+
+func queryCSVRecord(event results.QueryEvent) []string {
+	return tenancy.CSVRecord(networkImpairments.CSVRecord(event.CSVRecord(runID), event.StartMonotonicUs), event.Tenant)
+}
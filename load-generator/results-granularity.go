@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"load-generator/internal/results"
+)
+
+// resultsAggregator writes the results of insert and query as aggregates per interval with -results-granularity aggregate:<interval>,
+// nil writes a row per operation
+var resultsAggregator *results.Aggregator
+
+// parseResultsGranularity parses -results-granularity, returning the interval of the aggregates, 0 for a row per operation
+func parseResultsGranularity(s string) (time.Duration, error) {
+	if s == "" || s == "event" {
+		return 0, nil
+	}
+	value, ok := strings.CutPrefix(s, "aggregate:")
+	if !ok {
+		return 0, fmt.Errorf("expected event or aggregate:<interval>, got %q", s)
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if interval < time.Microsecond {
+		return 0, fmt.Errorf("the interval of the aggregates has to be at least 1µs, got %s", interval)
+	}
+	return interval, nil
+}
+
+// mustCreateAggregator writes the header of the aggregates to the results CSV file with -results-granularity aggregate:<interval>, nil without
+func (o *benchmarkOptions) mustCreateAggregator(csvWriter *results.CSVWriter) *results.Aggregator {
+	if o.aggregateInterval == 0 {
+		return nil
+	}
+	a, err := results.NewAggregator(csvWriter, runID, o.aggregateInterval)
+	if err != nil {
+		logger.Error("Failed to write results CSV header", "filename", csvWriter.Name(), "error", err)
+		os.Exit(exitFailure)
+	}
+	logger.Info("Writing aggregates of the results instead of a row per operation", "interval", o.aggregateInterval)
+	return a
+}
+
+// closeAggregator writes the aggregates of the intervals still open
+func closeAggregator() {
+	if err := resultsAggregator.Close(); err != nil {
+		logger.Error("Failed to write the last aggregates of the results", "error", err)
+	}
+}
+
+// writeCSVHeaderUnlessAggregated writes the header of the rows per operation, the aggregator writes its own
+func writeCSVHeaderUnlessAggregated(csvWriter *results.CSVWriter, header []string) error {
+	if resultsAggregator != nil {
+		return nil
+	}
+	return csvWriter.Write(header)
+}
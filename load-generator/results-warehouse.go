@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"load-generator/internal/results"
+	"load-generator/internal/targets"
+)
+
+const resultsWarehouseFlushSize = 1000
+
+// resultsWarehouseQueuedBatches is the number of batches waiting for the warehouse before new batches are dropped,
+// a slow results database must not stall the collection of the events and thereby the workers
+const resultsWarehouseQueuedBatches = 64
+
+const resultsWarehouseSchemaSql = `
+CREATE TABLE IF NOT EXISTS runs (
+	run_id           BIGSERIAL PRIMARY KEY,
+	run_uuid         UUID,
+	mode             TEXT NOT NULL,
+	db_target        TEXT NOT NULL,
+	num_workers      INT NOT NULL,
+	params           JSONB,
+	start_time       TIMESTAMPTZ,
+	end_time         TIMESTAMPTZ,
+	duration_sec     DOUBLE PRECISION,
+	total_operations BIGINT,
+	total_successes  BIGINT,
+	total_failures   BIGINT
+);
+
+ALTER TABLE runs ADD COLUMN IF NOT EXISTS aborted BOOLEAN;
+ALTER TABLE runs ADD COLUMN IF NOT EXISTS run_uuid UUID;
+-- the phases of a scenario and the targets of a multi-target run share one run ID
+ALTER TABLE runs DROP CONSTRAINT IF EXISTS runs_run_uuid_key;
+
+CREATE TABLE IF NOT EXISTS insert_events (
+	run_id                BIGINT REFERENCES runs (run_id),
+	worker_id             INT,
+	job_type              TEXT,
+	batch_size            INT,
+	use_bulk_insert       BOOLEAN,
+	start_time            TIMESTAMPTZ,
+	end_time              TIMESTAMPTZ,
+	insert_duration_us    BIGINT,
+	waited_for_job_us     BIGINT,
+	successfully_inserted INT,
+	failed_inserts        INT
+);
+
+CREATE TABLE IF NOT EXISTS query_events (
+	run_id               BIGINT REFERENCES runs (run_id),
+	worker_id            INT,
+	job_type             TEXT,
+	template_name        TEXT,
+	query_duration_us    BIGINT,
+	start_time           TIMESTAMPTZ,
+	end_time             TIMESTAMPTZ,
+	successful           BOOLEAN,
+	resulting_rows_count INT,
+	query_index          INT,
+	error_msg            TEXT
+);
+
+-- warehouses created before the latencies were recorded in microseconds have millisecond columns,
+-- they are renamed and their values converted so old and new runs stay comparable
+DO $$
+DECLARE
+	renamed RECORD;
+BEGIN
+	FOR renamed IN
+		SELECT * FROM (VALUES
+			('insert_events', 'insert_duration_ms', 'insert_duration_us'),
+			('insert_events', 'waited_for_job_ms', 'waited_for_job_us'),
+			('query_events', 'query_duration_ms', 'query_duration_us')
+		) AS c (table_name, old_name, new_name)
+	LOOP
+		IF EXISTS (
+			SELECT 1 FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = renamed.table_name AND column_name = renamed.old_name
+		) THEN
+			EXECUTE format('ALTER TABLE %I RENAME COLUMN %I TO %I', renamed.table_name, renamed.old_name, renamed.new_name);
+			EXECUTE format('UPDATE %I SET %I = %I * 1000', renamed.table_name, renamed.new_name, renamed.new_name);
+		END IF;
+	END LOOP;
+END
+$$;`
+
+// ResultsWarehouse writes the per-operation events of a run into a central Postgres database,
+// so results of many runs can be compared with plain SQL.
+// All methods are no-ops on a nil warehouse.
+type ResultsWarehouse struct {
+	conn  *pgx.Conn
+	RunID int64
+
+	mu         sync.Mutex // guards the buffered rows and the dropped counters, the workers add events concurrently with -result-shards
+	insertRows [][]any
+	queryRows  [][]any
+
+	// full batches are copied into the warehouse by a dedicated goroutine
+	batches        chan warehouseBatch
+	writerDone     sync.WaitGroup
+	droppedBatches int
+	droppedRows    int
+}
+
+type warehouseBatch struct {
+	table   string
+	columns []string
+	rows    [][]any
+}
+
+var (
+	insertEventsColumns = []string{"run_id", "worker_id", "job_type", "batch_size", "use_bulk_insert", "start_time", "end_time",
+		"insert_duration_us", "waited_for_job_us", "successfully_inserted", "failed_inserts"}
+	queryEventsColumns = []string{"run_id", "worker_id", "job_type", "template_name", "query_duration_us", "start_time", "end_time",
+		"successful", "resulting_rows_count", "query_index", "error_msg"}
+)
+
+var resultsWarehouse *ResultsWarehouse
+
+// NewResultsWarehouse creates the warehouse tables if needed and registers a new run
+func NewResultsWarehouse(ctx context.Context, connString string, mode string, dbTarget targets.DBTarget, numWorkers int, params map[string]string) (*ResultsWarehouse, error) {
+	conn, err := pgx.Connect(ctx, connString)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to connect to results database: %w", err)
+	}
+
+	if _, err := conn.Exec(ctx, resultsWarehouseSchemaSql); err != nil {
+		conn.Close(ctx)
+		return nil, fmt.Errorf("Creating results database tables: %w", err)
+	}
+
+	w := &ResultsWarehouse{conn: conn, batches: make(chan warehouseBatch, resultsWarehouseQueuedBatches)}
+	err = conn.QueryRow(ctx,
+		`INSERT INTO runs (run_uuid, mode, db_target, num_workers, params) VALUES ($1, $2, $3, $4, $5) RETURNING run_id`,
+		runID, mode, dbTarget.String(), numWorkers, params,
+	).Scan(&w.RunID)
+	if err != nil {
+		conn.Close(ctx)
+		return nil, fmt.Errorf("Registering run in results database: %w", err)
+	}
+	w.writerDone.Add(1)
+	go w.writeBatches()
+	return w, nil
+}
+
+func (w *ResultsWarehouse) AddInsertEvent(event results.InsertEvent) {
+	if w == nil {
+		return
+	}
+	row := []any{
+		w.RunID,
+		event.WorkerID,
+		event.JobType,
+		event.BatchSize,
+		event.UseBulkInsert,
+		parseEventTime(event.StartTime),
+		parseEventTime(event.EndTime),
+		event.InsertDurationUs,
+		event.WaitedForJobTimeUs,
+		event.SuccessfullyInserted,
+		event.FailedInserts,
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.insertRows = append(w.insertRows, row)
+	if len(w.insertRows) >= resultsWarehouseFlushSize {
+		w.flush(false)
+	}
+}
+
+func (w *ResultsWarehouse) AddQueryEvent(event results.QueryEvent) {
+	if w == nil {
+		return
+	}
+	row := []any{
+		w.RunID,
+		event.WorkerID,
+		event.JobType,
+		event.TemplateName,
+		event.QueryDurationUs,
+		parseEventTime(event.StartTime),
+		parseEventTime(event.EndTime),
+		event.Successful,
+		event.ResultingRowsCount,
+		event.QueryIndex,
+		event.ErrorMsg,
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.queryRows = append(w.queryRows, row)
+	if len(w.queryRows) >= resultsWarehouseFlushSize {
+		w.flush(false)
+	}
+}
+
+// flush hands the buffered events to the writer goroutine. Unless wait is set,
+// they are dropped if the warehouse is too far behind. Called with mu held.
+func (w *ResultsWarehouse) flush(wait bool) {
+	if len(w.insertRows) > 0 {
+		w.enqueue(warehouseBatch{table: "insert_events", columns: insertEventsColumns, rows: w.insertRows}, wait)
+		w.insertRows = nil
+	}
+	if len(w.queryRows) > 0 {
+		w.enqueue(warehouseBatch{table: "query_events", columns: queryEventsColumns, rows: w.queryRows}, wait)
+		w.queryRows = nil
+	}
+}
+
+func (w *ResultsWarehouse) enqueue(batch warehouseBatch, wait bool) {
+	if wait {
+		w.batches <- batch
+		return
+	}
+	select {
+	case w.batches <- batch:
+	default:
+		if w.droppedBatches == 0 {
+			logger.Warn("Results database is too slow, dropping events instead of stalling the benchmark", "runId", w.RunID, "table", batch.table)
+		}
+		w.droppedBatches++
+		w.droppedRows += len(batch.rows)
+	}
+}
+
+// writeBatches copies the queued batches into the warehouse until the queue is closed
+func (w *ResultsWarehouse) writeBatches() {
+	defer w.writerDone.Done()
+	// results should be stored even if the run itself was interrupted
+	ctx := context.Background()
+	for batch := range w.batches {
+		_, err := w.conn.CopyFrom(ctx, pgx.Identifier{batch.table}, batch.columns, pgx.CopyFromRows(batch.rows))
+		if err != nil {
+			logger.Error("Failed to write events to results database", "runId", w.RunID, "table", batch.table, "count", len(batch.rows), "error", err)
+		}
+	}
+}
+
+// Finish writes the remaining events and the run summary, then closes the connection
+func (w *ResultsWarehouse) Finish(summary RunSummary) {
+	if w == nil {
+		return
+	}
+	// the last batches are waited for, unlike during the run
+	w.mu.Lock()
+	w.flush(true)
+	w.mu.Unlock()
+	close(w.batches)
+	w.writerDone.Wait()
+	if w.droppedBatches > 0 {
+		logger.Warn("Events were dropped because the results database was too slow", "runId", w.RunID, "batches", w.droppedBatches, "events", w.droppedRows)
+	}
+	ctx := context.Background()
+
+	_, err := w.conn.Exec(ctx, `
+UPDATE runs
+SET start_time = $2, end_time = $3, duration_sec = $4,
+	total_operations = $5, total_successes = $6, total_failures = $7, aborted = $8
+WHERE run_id = $1`,
+		w.RunID, summary.StartTime, summary.EndTime, summary.DurationSec,
+		summary.TotalOperations, summary.TotalSuccesses, summary.TotalFailures, summary.Aborted,
+	)
+	if err != nil {
+		logger.Error("Failed to write run summary to results database", "runId", w.RunID, "error", err)
+	} else {
+		logger.Info("Wrote results to results database", "runId", w.RunID)
+	}
+	w.conn.Close(ctx)
+}
+
+func parseEventTime(value string) *time.Time {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
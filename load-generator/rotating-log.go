@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// RotatingFile is an io.Writer which rotates the underlying file once it exceeds maxBytes.
+// Rotated files get a numeric suffix (file.log -> file.log.1, file.log.2, ...) and only the
+// keep newest of them are retained. Other files in the directory, e.g. the logs of other runs, are never removed.
+type RotatingFile struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64 // 0 disables rotation
+	keep     int   // 0 keeps all files
+
+	file      *os.File
+	written   int64
+	rotations int
+}
+
+func NewRotatingFile(path string, maxBytes int64, keep int) (*RotatingFile, error) {
+	file, err := createNewFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &RotatingFile{path: path, maxBytes: maxBytes, keep: keep, file: file}
+	if err := r.enforceRetention(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.maxBytes > 0 && r.written > 0 && r.written+int64(len(p)) > r.maxBytes {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.written += int64(n)
+	return n, err
+}
+
+func (r *RotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+
+	r.rotations++
+	rotatedPath := fmt.Sprintf("%s.%d", r.path, r.rotations)
+	if err := os.Rename(r.path, rotatedPath); err != nil {
+		return err
+	}
+	registerArtifact(rotatedPath)
+
+	file, err := os.Create(r.path)
+	if err != nil {
+		return err
+	}
+	r.file = file
+	r.written = 0
+
+	return r.enforceRetention()
+}
+
+// enforceRetention removes the oldest rotations of the file, keeping the keep newest ones
+func (r *RotatingFile) enforceRetention() error {
+	if r.keep <= 0 {
+		return nil
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(r.path))
+	if err != nil {
+		return err
+	}
+
+	type logFile struct {
+		path    string
+		modTime int64
+	}
+	var logFiles []logFile
+	for _, entry := range entries {
+		if entry.IsDir() || !r.isRotation(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		logFiles = append(logFiles, logFile{
+			path:    filepath.Join(filepath.Dir(r.path), entry.Name()),
+			modTime: info.ModTime().UnixNano(),
+		})
+	}
+	if len(logFiles) <= r.keep {
+		return nil
+	}
+
+	// newest first
+	sort.Slice(logFiles, func(i, j int) bool { return logFiles[i].modTime > logFiles[j].modTime })
+	for _, f := range logFiles[r.keep:] {
+		// never remove the file currently written to
+		if f.path == r.path {
+			continue
+		}
+		if err := os.Remove(f.path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isRotation reports whether name is the file itself or one of its numbered rotations
+func (r *RotatingFile) isRotation(name string) bool {
+	base := filepath.Base(r.path)
+	if name == base {
+		return true
+	}
+	suffix, ok := strings.CutPrefix(name, base+".")
+	if !ok || suffix == "" {
+		return false
+	}
+	for _, c := range suffix {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// RTTStats describes round trip times of trivial `SELECT 1` queries in microseconds
+type RTTStats struct {
+	Samples int     `json:"samples"`
+	MinUs   float64 `json:"minUs"`
+	MeanUs  float64 `json:"meanUs"`
+	P50Us   float64 `json:"p50Us"`
+	P99Us   float64 `json:"p99Us"`
+	MaxUs   float64 `json:"maxUs"`
+}
+
+type PeriodicRTTStats struct {
+	Timestamp string `json:"timestamp"`
+	RTTStats
+}
+
+type RTTReport struct {
+	Overall   RTTStats           `json:"overall"`
+	PerWorker map[int]RTTStats   `json:"perWorker"`
+	Periodic  []PeriodicRTTStats `json:"periodic,omitempty"`
+}
+
+// RTTCollector measures the network round trip time between the load-generator and the database,
+// so it can be subtracted from the measured latencies in the analysis.
+// All methods are no-ops on a nil collector.
+type RTTCollector struct {
+	samples int
+
+	mu        sync.Mutex
+	all       []time.Duration
+	perWorker map[int]RTTStats
+	periodic  []PeriodicRTTStats
+}
+
+var rttCollector *RTTCollector
+
+func NewRTTCollector(samples int) *RTTCollector {
+	return &RTTCollector{samples: samples, perWorker: make(map[int]RTTStats)}
+}
+
+// MeasureWorker runs the baseline measurement on the worker's connection before it starts its jobs
+func (c *RTTCollector) MeasureWorker(ctx context.Context, workerId int, conn *pgx.Conn) {
+	if c == nil {
+		return
+	}
+	durations, err := measureRTT(ctx, conn, c.samples)
+	if err != nil {
+		logger.Warn("Failed to measure round trip time", "id", workerId, "error", err)
+		return
+	}
+	stats := computeRTTStats(durations)
+	logger.Debug("Measured round trip time", "id", workerId, "meanUs", stats.MeanUs, "p99Us", stats.P99Us)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.perWorker[workerId] = stats
+	c.all = append(c.all, durations...)
+}
+
+// StartPeriodic measures the round trip time every interval on a dedicated connection.
+// Returned function stops the measurements.
+func (c *RTTCollector) StartPeriodic(ctx context.Context, connString string, interval time.Duration) func() {
+	if c == nil || interval <= 0 {
+		return func() {}
+	}
+
+	conn, err := pgx.Connect(ctx, connString)
+	if err != nil {
+		logger.Warn("Unable to connect to database for periodic round trip time measurement", "error", err)
+		return func() {}
+	}
+
+	periodicCtx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-periodicCtx.Done():
+				return
+			case now := <-ticker.C:
+				durations, err := measureRTT(periodicCtx, conn, c.samples)
+				if err != nil {
+					if periodicCtx.Err() == nil {
+						logger.Warn("Failed to measure round trip time", "error", err)
+					}
+					continue
+				}
+				stats := computeRTTStats(durations)
+				logger.Info("Measured round trip time", "meanUs", stats.MeanUs, "p99Us", stats.P99Us)
+
+				c.mu.Lock()
+				c.periodic = append(c.periodic, PeriodicRTTStats{Timestamp: now.Format(time.RFC3339Nano), RTTStats: stats})
+				c.mu.Unlock()
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		wg.Wait()
+		conn.Close(context.Background())
+	}
+}
+
+func (c *RTTCollector) Report() *RTTReport {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return &RTTReport{
+		Overall:   computeRTTStats(c.all),
+		PerWorker: c.perWorker,
+		Periodic:  c.periodic,
+	}
+}
+
+func measureRTT(ctx context.Context, conn *pgx.Conn, samples int) ([]time.Duration, error) {
+	durations := make([]time.Duration, 0, samples)
+	for range samples {
+		startTime := time.Now()
+		if _, err := conn.Exec(ctx, "SELECT 1"); err != nil {
+			return nil, err
+		}
+		durations = append(durations, time.Since(startTime))
+	}
+	return durations, nil
+}
+
+func computeRTTStats(durations []time.Duration) RTTStats {
+	if len(durations) == 0 {
+		return RTTStats{}
+	}
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	us := func(d time.Duration) float64 { return float64(d.Nanoseconds()) / 1e3 }
+	percentile := func(p float64) time.Duration { return sorted[int(p*float64(len(sorted)-1))] }
+
+	return RTTStats{
+		Samples: len(sorted),
+		MinUs:   us(sorted[0]),
+		MeanUs:  us(total / time.Duration(len(sorted))),
+		P50Us:   us(percentile(0.50)),
+		P99Us:   us(percentile(0.99)),
+		MaxUs:   us(sorted[len(sorted)-1]),
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Uploader uploads files to S3 compatible storage (AWS S3, MinIO, ...) using path-style
+// requests signed with AWS Signature Version 4. Credentials are read from the standard
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables.
+type S3Uploader struct {
+	Endpoint     *url.URL
+	Region       string
+	Bucket       string
+	Prefix       string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	Client       *http.Client
+}
+
+// NewS3Uploader parses the destination in the form s3://bucket/prefix
+func NewS3Uploader(destination, endpoint, region string) (*S3Uploader, error) {
+	dest, err := url.Parse(destination)
+	if err != nil {
+		return nil, fmt.Errorf("Parsing upload destination: %w", err)
+	}
+	if dest.Scheme != "s3" || dest.Host == "" {
+		return nil, fmt.Errorf("Upload destination must be in the form s3://bucket/prefix, got %q", destination)
+	}
+
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil || endpointURL.Host == "" {
+		return nil, fmt.Errorf("Invalid S3 endpoint %q", endpoint)
+	}
+
+	uploader := &S3Uploader{
+		Endpoint:     endpointURL,
+		Region:       region,
+		Bucket:       dest.Host,
+		Prefix:       strings.Trim(dest.Path, "/"),
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		Client:       &http.Client{Timeout: 10 * time.Minute},
+	}
+	if uploader.AccessKey == "" || uploader.SecretKey == "" {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set to upload results")
+	}
+	return uploader, nil
+}
+
+// UploadFile uploads the file under the configured prefix, keeping its base name
+func (u *S3Uploader) UploadFile(ctx context.Context, filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	// the payload hash is part of the signature, so the file is read twice
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return err
+	}
+	payloadHash := hex.EncodeToString(hash.Sum(nil))
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	key := path.Join(u.Prefix, filepath.Base(filename))
+	objectURL := *u.Endpoint
+	objectURL.Path = path.Join("/", u.Endpoint.Path, u.Bucket, key)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, objectURL.String(), f)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = stat.Size()
+	u.sign(req, payloadHash, time.Now().UTC())
+
+	resp, err := u.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("Uploading %s to s3://%s/%s failed with status %s: %s", filename, u.Bucket, key, resp.Status, body)
+	}
+	return nil
+}
+
+func (u *S3Uploader) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if u.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", u.SessionToken)
+	}
+
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           amzDate,
+	}
+	if u.SessionToken != "" {
+		headers["x-amz-security-token"] = u.SessionToken
+	}
+	headerNames := make([]string, 0, len(headers))
+	for name := range headers {
+		headerNames = append(headerNames, name)
+	}
+	sort.Strings(headerNames)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range headerNames {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(headerNames, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3EscapePath(req.URL.Path),
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + u.Region + "/s3/aws4_request"
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(canonicalRequestHash[:]),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+u.SecretKey), date)
+	signingKey = hmacSHA256(signingKey, u.Region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		u.AccessKey, scope, signedHeaders, signature))
+	// the escaped path has to match the one used in the signature
+	req.URL.RawPath = s3EscapePath(req.URL.Path)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3CanonicalQuery returns the query parameters sorted by name and value, URI-encoded as required by SigV4,
+// parameters without value get an empty one, e.g. lifecycle=
+func s3CanonicalQuery(query url.Values) string {
+	var params []string
+	for name, values := range query {
+		for _, value := range values {
+			params = append(params, s3Escape(name, false)+"="+s3Escape(value, false))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// s3EscapePath URI-encodes every byte except the unreserved characters and '/' as required by SigV4
+func s3EscapePath(p string) string {
+	return s3Escape(p, true)
+}
+
+// s3Escape URI-encodes every byte except the unreserved characters and, if keepSlash is set, '/'
+func s3Escape(p string, keepSlash bool) string {
+	var builder strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && keepSlash) {
+			builder.WriteByte(c)
+		} else {
+			fmt.Fprintf(&builder, "%%%02X", c)
+		}
+	}
+	return builder.String()
+}
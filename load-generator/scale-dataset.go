@@ -0,0 +1,55 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"load-generator/internal/workload"
+)
+
+func runScaleDataset(args []string) {
+	fs := newFlagSet("scale-dataset", "Write an N times larger trips CSV by cloning the trips of an existing one with new UUIDs,\nshifted timestamps and moved coordinates, for experiments beyond the size of the generated datasets.")
+	tripsPath := fs.String("trips", "../escooter-trips-generator/output/escooter-trips-small.csv", "Path to the CSV file containing the escooter trip events to scale")
+	out := fs.String("out", "", "Path of the scaled CSV file, defaults to the input with -x<factor> appended, e.g. trips-x10.csv. An existing file is not overwritten")
+	factor := fs.Int("factor", 10, "Scale factor, the output contains the input trips and <factor>-1 copies of them")
+	timeShift := fs.Duration("time-shift", 0, "Shift copy k of the trips by k times <duration>, 0 shifts by the time range of the input so the copies follow each other.\nA small shift instead keeps the copies overlapping, simulating a larger fleet")
+	jitter := fs.Float64("jitter", 100, "Standard deviation in metres of the random offset each copied trip is moved by")
+	seed := fs.Int64("seed", 42, "Random seed of the UUIDs and offsets, the same seed and flags produce the identical file")
+	datasetTZ := registerDatasetTZ(fs)
+	fs.Parse(args)
+
+	logger = slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	mustSetDatasetTZ(*datasetTZ)
+	ctx, stop := signalContext()
+	defer stop()
+
+	if *out == "" {
+		*out = strings.TrimSuffix(*tripsPath, ".csv") + "-x" + strconv.Itoa(*factor) + ".csv"
+	}
+	if *timeShift == 0 && *factor > 1 {
+		first, last, err := workload.ReadTimeRange(ctx, *tripsPath)
+		if err != nil {
+			logger.Error("Unable to read the time range of the trips", "filename", *tripsPath, "error", err)
+			os.Exit(exitValidation)
+		}
+		// one second more, so the first event of a copy doesn't coincide with the last of the previous one
+		*timeShift = last.Sub(first) + time.Second
+		logger.Info("Shifting the copies by the time range of the input", "from", first, "to", last, "timeShift", timeShift.String())
+	}
+
+	var trips, events int
+	writeDatasetFile(*out, func(f *os.File) error {
+		var err error
+		trips, events, err = workload.ScaleTrips(ctx, *tripsPath, f, workload.ScaleConfig{
+			Factor:       *factor,
+			TimeShift:    *timeShift,
+			JitterMetres: *jitter,
+			Seed:         *seed,
+		})
+		return err
+	})
+	logger.Info("Scaled trips", "filename", *out, "factor", *factor, "trips", trips, "events", events)
+}
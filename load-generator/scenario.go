@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// environment variable passing the run ID of a scenario to the commands of its phases
+const runIDEnv = "LOADGEN_RUN_ID"
+
+// Scenario chains commands and SQL statements into phases executed sequentially under one run ID
+type Scenario struct {
+	Name string `json:"name"`
+	// flags passed to every command phase, e.g. dbTarget and db, phase args take precedence
+	Args   map[string]string `json:"args"`
+	Phases []ScenarioPhase   `json:"phases"`
+}
+
+// ScenarioPhase either runs a command with args or executes SQL statements, e.g. to tear down a previous run
+type ScenarioPhase struct {
+	Name         string            `json:"name"`
+	Command      string            `json:"command,omitempty"`
+	Args         map[string]string `json:"args,omitempty"`
+	SQL          []string          `json:"sql,omitempty"`
+	IgnoreErrors bool              `json:"ignoreErrors,omitempty"` // continue if an SQL statement fails
+	PauseAfter   string            `json:"pauseAfter,omitempty"`   // duration to wait before the next phase, e.g. "3m"
+
+	pauseAfter time.Duration
+}
+
+type ScenarioPhaseResult struct {
+	Name        string    `json:"name"`
+	Command     string    `json:"command,omitempty"`
+	ResultsDir  string    `json:"resultsDir,omitempty"`
+	StartTime   time.Time `json:"startTime"`
+	EndTime     time.Time `json:"endTime"`
+	DurationSec float64   `json:"durationSec"`
+	ExitCode    int       `json:"exitCode"`
+}
+
+type ScenarioSummary struct {
+	RunID    string                `json:"runId"`
+	Scenario string                `json:"scenario"`
+	File     string                `json:"file"`
+	Phases   []ScenarioPhaseResult `json:"phases"`
+	Aborted  bool                  `json:"aborted"`
+}
+
+func readScenario(filename string) (Scenario, error) {
+	var scenario Scenario
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return scenario, err
+	}
+	if err := json.Unmarshal(b, &scenario); err != nil {
+		return scenario, fmt.Errorf("Parsing scenario %s: %w", filename, err)
+	}
+	if len(scenario.Phases) == 0 {
+		return scenario, fmt.Errorf("Scenario %s defines no phases", filename)
+	}
+
+	for i := range scenario.Phases {
+		phase := &scenario.Phases[i]
+		if phase.Name == "" {
+			phase.Name = phase.Command
+		}
+		if (phase.Command == "") == (len(phase.SQL) == 0) {
+			return scenario, fmt.Errorf("Phase %d (%s) needs either a command or SQL statements", i+1, phase.Name)
+		}
+		if phase.Command != "" && !scenarioCommands[phase.Command] {
+			return scenario, fmt.Errorf("Phase %d (%s) has an unsupported command %q", i+1, phase.Name, phase.Command)
+		}
+		if phase.PauseAfter != "" {
+			if phase.pauseAfter, err = time.ParseDuration(phase.PauseAfter); err != nil {
+				return scenario, fmt.Errorf("Phase %d (%s) has an invalid pauseAfter: %w", i+1, phase.Name, err)
+			}
+		}
+	}
+	return scenario, nil
+}
+
+// commands which can be phases, they all accept the common flags like -db and -results-dir
+var scenarioCommands = map[string]bool{"cleanup": true, "init": true, "insert": true, "query": true, "verify": true}
+
+// phaseArgs merges the scenario and phase args, each phase writes its logs and results into its own directory
+func (s Scenario) phaseArgs(phase ScenarioPhase, phaseDir string) []string {
+	merged := map[string]string{"results-dir": phaseDir, "log-dir": phaseDir}
+	for name, value := range s.Args {
+		merged[name] = value
+	}
+	for name, value := range phase.Args {
+		merged[name] = value
+	}
+	return flagArgs(merged)
+}
+
+// flagArgs formats the flags as -name=value sorted by name
+func flagArgs(flags map[string]string) []string {
+	names := make([]string, 0, len(flags))
+	for name := range flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	args := make([]string, 0, len(names))
+	for _, name := range names {
+		args = append(args, "-"+name+"="+flags[name])
+	}
+	return args
+}
+
+func runScenario(args []string) {
+	fs := newFlagSet("scenario", "Execute the phases of a scenario file sequentially with a shared run ID, e.g. teardown, init, insert and query.\nUsage: scenario [flags] scenario.json\nEvery phase writes its results and logs into its own directory below -results-dir.")
+	resultsDir := fs.String("results-dir", "./results", "Directory to create the directory of the scenario run in")
+	fs.Parse(args)
+
+	runID = envOrDefault(runIDEnv, newUUID())
+	logger = slog.New(slog.NewJSONHandler(os.Stdout, nil)).With("runId", runID)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(exitConfig)
+	}
+	scenario, err := readScenario(fs.Arg(0))
+	if err != nil {
+		logger.Error("Unable to read scenario", "error", err)
+		os.Exit(exitConfig)
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		logger.Error("Unable to locate the load-generator executable", "error", err)
+		os.Exit(exitFailure)
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	timestamp := time.Now().Format("20060102_150405")
+	scenarioDir := filepath.Join(*resultsDir, fmt.Sprintf("scenario_%s_%s_%s", scenario.Name, timestamp, runID))
+	summary := ScenarioSummary{RunID: runID, Scenario: scenario.Name, File: fs.Arg(0)}
+	logger.Info("Starting scenario", "scenario", scenario.Name, "phases", len(scenario.Phases), "dir", scenarioDir)
+
+	for i, phase := range scenario.Phases {
+		result := ScenarioPhaseResult{Name: phase.Name, Command: phase.Command, StartTime: time.Now()}
+		logger.Info("Starting scenario phase", "phase", phase.Name, "number", i+1, "command", phase.Command)
+
+		if phase.Command != "" {
+			result.ResultsDir = filepath.Join(scenarioDir, fmt.Sprintf("%02d-%s", i+1, phase.Name))
+			result.ExitCode = runChildCommand(ctx, executable, phase.Command, scenario.phaseArgs(phase, result.ResultsDir))
+		} else if err := execScenarioSQL(ctx, scenario, phase); err != nil {
+			logger.Error("Scenario phase failed", "phase", phase.Name, "error", err)
+			result.ExitCode = exitCode(err)
+		}
+
+		result.EndTime = time.Now()
+		result.DurationSec = result.EndTime.Sub(result.StartTime).Seconds()
+		summary.Phases = append(summary.Phases, result)
+		writeScenarioSummary(scenarioDir, summary)
+
+		// a phase ending at its -max-duration is a planned end, the scenario continues
+		if result.ExitCode == exitAborted && ctx.Err() == nil {
+			logger.Info("Scenario phase reached its maximum duration", "phase", phase.Name)
+		} else if result.ExitCode != 0 {
+			summary.Aborted = ctx.Err() != nil
+			writeScenarioSummary(scenarioDir, summary)
+			logger.Error("Stopping scenario after failed phase", "phase", phase.Name, "exitCode", result.ExitCode)
+			os.Exit(result.ExitCode)
+		}
+		logger.Info("Finished scenario phase", "phase", phase.Name, "durationSec", result.DurationSec)
+
+		if phase.pauseAfter > 0 && i < len(scenario.Phases)-1 {
+			logger.Info("Pausing before the next phase", "pause", phase.pauseAfter)
+			select {
+			case <-ctx.Done():
+				summary.Aborted = true
+				writeScenarioSummary(scenarioDir, summary)
+				os.Exit(exitAborted)
+			case <-time.After(phase.pauseAfter):
+			}
+		}
+	}
+	logger.Info("Finished scenario", "scenario", scenario.Name, "dir", scenarioDir)
+}
+
+// runChildCommand executes the command in a child process with the run ID and returns its exit code.
+// The child runs in its own process group, so a SIGINT reaches it only once, forwarded by the parent,
+// and it can drain its in-flight operations.
+func runChildCommand(ctx context.Context, executable, command string, args []string) int {
+	cmd := exec.CommandContext(ctx, executable, append([]string{command}, args...)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), runIDEnv+"="+runID)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(os.Interrupt)
+	}
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &exitErr) && exitErr.ExitCode() > 0:
+		return exitErr.ExitCode()
+	default:
+		logger.Error("Unable to run command", "command", command, "error", err)
+		return exitFailure
+	}
+}
+
+func execScenarioSQL(ctx context.Context, scenario Scenario, phase ScenarioPhase) error {
+	connString := envOrDefault("LOADGEN_DB_URL", defaultConnString)
+	if db, ok := scenario.Args["db"]; ok {
+		connString = db
+	}
+	if db, ok := phase.Args["db"]; ok {
+		connString = db
+	}
+
+	conn, err := pgx.Connect(ctx, withPasswordFromEnv(connString))
+	if err != nil {
+		return fmt.Errorf("Unable to connect to database: %w", err)
+	}
+	defer conn.Close(context.Background())
+
+	for i, stmt := range phase.SQL {
+		if _, err := conn.Exec(ctx, stmt); err != nil {
+			if !phase.IgnoreErrors {
+				return fmt.Errorf("Executing statement %d: %w", i+1, err)
+			}
+			logger.Warn("Ignoring failed statement", "phase", phase.Name, "statement", stmt, "error", err)
+		}
+	}
+	return nil
+}
+
+// writeScenarioSummary rewrites the summary after every phase, so it reflects the progress of an interrupted scenario
+func writeScenarioSummary(scenarioDir string, summary ScenarioSummary) {
+	filename := filepath.Join(scenarioDir, fmt.Sprintf("scenario_summary_%s.json", summary.RunID))
+	b, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		logger.Error("Failed to encode scenario summary", "error", err)
+		return
+	}
+	if err := os.MkdirAll(scenarioDir, 0777); err != nil {
+		logger.Error("Failed to create scenario directory", "dir", scenarioDir, "error", err)
+		return
+	}
+	if err := os.WriteFile(filename, b, 0666); err != nil {
+		logger.Error("Failed to write scenario summary", "filename", filename, "error", err)
+	}
+}
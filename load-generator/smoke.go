@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"load-generator/internal/results"
+	"load-generator/internal/targets"
+)
+
+// smokeEventsPerTrip is the number of events of a trip of the smoke dataset, the last trip may be shorter
+const smokeEventsPerTrip = 10
+
+// smokeCheck is an invariant verified by the smoke test
+type smokeCheck struct {
+	name string
+	err  error
+}
+
+func runSmoke(args []string) {
+	fs := newFlagSet("smoke", "Sanity check a database before a long experiment: init, insert a small generated dataset and query it,\nthen assert that no operation failed, all events are stored and all queries were executed.\nThe tables are created with a random -schema-prefix and dropped afterwards, so a database of earlier runs stays untouched.")
+	dbTargetStr := fs.String("dbTarget", "cratedb", "Target database: cratedb or mobilitydbc")
+	connString := fs.String("db", envOrDefault("LOADGEN_DB_URL", defaultConnString), "Connection string to use to connect to db, defaults to LOADGEN_DB_URL")
+	container := fs.Bool("container", false, "Start a disposable container of -dbTarget with the Compose file of -compose-dir instead of connecting to -db, removed afterwards")
+	composeDir := fs.String("compose-dir", "./environments", "Directory with a Compose file <target>/compose.yaml per target, used with -container")
+	wait := fs.Duration("wait", 3*time.Minute, "Wait at most this long for the container to accept queries")
+	numEvents := fs.Int("events", 1000, "Number of trip events to insert")
+	numQueries := fs.Int("nqueries", 100, "Number of queries to execute")
+	migrationsDir := fs.String("migrations", "./migrations/{target}", "Directory containing migration files, {target} is replaced by -dbTarget")
+	queriesFilepath := fs.String("queries", "./schemas/{target}-simple-read-queries.tmpl", "Path to a file containing query templates, {target} is replaced by -dbTarget")
+	keep := fs.Bool("keep", false, "Keep the tables and the directory with the logs and results of the commands, the directory is also kept if a check fails")
+	fs.Parse(args)
+
+	runID = envOrDefault(runIDEnv, newUUID())
+	logger = slog.New(slog.NewJSONHandler(os.Stdout, nil)).With("runId", runID)
+
+	dbTarget, err := targets.Parse(*dbTargetStr)
+	if err != nil {
+		logger.Error("Invalid CLI argument", "argument", "dbTarget", "error", err)
+		os.Exit(exitConfig)
+	}
+	if *numEvents < 1 || *numQueries < 1 {
+		logger.Error("Invalid CLI argument", "argument", "events", "error", "expected at least one event and one query")
+		os.Exit(exitConfig)
+	}
+	*migrationsDir = strings.ReplaceAll(*migrationsDir, "{target}", *dbTargetStr)
+	*queriesFilepath = strings.ReplaceAll(*queriesFilepath, "{target}", *dbTargetStr)
+	executable, err := os.Executable()
+	if err != nil {
+		logger.Error("Unable to locate the load-generator executable", "error", err)
+		os.Exit(exitFailure)
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	var env *dbEnvironment
+	if *container {
+		if env, err = newDBEnvironment(*dbTargetStr, *composeDir); err != nil {
+			logger.Error("Unable to load environment", "target", *dbTargetStr, "error", err)
+			os.Exit(exitConfig)
+		}
+		if _, err := env.up(ctx, *wait); err != nil {
+			logger.Error("Unable to start environment", "error", err)
+			env.down(context.Background())
+			os.Exit(exitConnection)
+		}
+		*connString = env.connString
+	}
+
+	workDir, err := os.MkdirTemp("", "loadgen-smoke-")
+	if err != nil {
+		logger.Error("Unable to create the smoke test directory", "error", err)
+		os.Exit(exitFailure)
+	}
+	poisPath, localitiesPath, tripsPath, err := writeSmokeDataset(workDir, *numEvents)
+	if err != nil {
+		logger.Error("Unable to write the smoke test dataset", "error", err)
+		os.Exit(exitFailure)
+	}
+
+	prefix := "smoke_" + strings.ReplaceAll(runID, "-", "")[:8] + "_"
+	common := []string{
+		"-dbTarget", *dbTargetStr,
+		"-db", *connString,
+		"-schema-prefix", prefix,
+		"-log-dir", filepath.Join(workDir, "logs"),
+		"-results-dir", filepath.Join(workDir, "results"),
+		"-quiet",
+	}
+	logger.Info("Starting smoke test", "dbTarget", *dbTargetStr, "db", redactConnString(*connString), "schemaPrefix", prefix, "dir", workDir,
+		"events", *numEvents, "queries", *numQueries)
+	startTime := time.Now()
+
+	checks, code := smokeSteps(ctx, executable, common, smokeConfig{
+		dbTarget:        dbTarget,
+		connString:      withPasswordFromEnv(*connString),
+		prefix:          prefix,
+		workDir:         workDir,
+		poisPath:        poisPath,
+		localitiesPath:  localitiesPath,
+		tripsPath:       tripsPath,
+		migrationsDir:   *migrationsDir,
+		queriesFilepath: *queriesFilepath,
+		numEvents:       *numEvents,
+		numQueries:      *numQueries,
+	})
+
+	failed := 0
+	for _, check := range checks {
+		if check.err != nil {
+			failed++
+			logger.Error("Smoke check failed", "check", check.name, "error", check.err)
+		} else {
+			logger.Info("Smoke check passed", "check", check.name)
+		}
+	}
+	if failed > 0 && code == 0 {
+		code = exitAssertion
+	}
+
+	if env != nil {
+		if err := env.down(context.Background()); err != nil {
+			logger.Warn("Unable to tear down environment", "error", err)
+		}
+	} else if !*keep {
+		if cleanupCode := runChildCommand(context.Background(), executable, "cleanup", append(common, "-migrations", *migrationsDir)); cleanupCode != 0 {
+			logger.Warn("Unable to drop the tables of the smoke test", "schemaPrefix", prefix, "exitCode", cleanupCode)
+		}
+	}
+	if *keep || code != 0 {
+		logger.Info("Kept the logs and results of the smoke test", "dir", workDir)
+	} else {
+		os.RemoveAll(workDir)
+	}
+
+	logger.Info("Finished smoke test", "passed", len(checks)-failed, "failed", failed, "exitCode", code, "durationSec", time.Since(startTime).Seconds())
+	if code != 0 {
+		os.Exit(code)
+	}
+}
+
+type smokeConfig struct {
+	dbTarget        targets.DBTarget
+	connString      string
+	prefix          string
+	workDir         string
+	poisPath        string
+	localitiesPath  string
+	tripsPath       string
+	migrationsDir   string
+	queriesFilepath string
+	numEvents       int
+	numQueries      int
+}
+
+// smokeSteps runs init, insert and query and returns the checks done so far,
+// the exit code is the one of a failed command or step, 0 if all commands succeeded
+func smokeSteps(ctx context.Context, executable string, common []string, cfg smokeConfig) ([]smokeCheck, int) {
+	var checks []smokeCheck
+	resultsDir := filepath.Join(cfg.workDir, "results")
+
+	code := runChildCommand(ctx, executable, "init", append(common,
+		"-pois", cfg.poisPath,
+		"-localities", cfg.localitiesPath,
+		"-migrations", cfg.migrationsDir,
+	))
+	checks = append(checks, smokeCheck{"init succeeds", exitCodeError(code)})
+	if code != 0 {
+		return checks, code
+	}
+
+	code = runChildCommand(ctx, executable, "insert", append(common,
+		"-trips", cfg.tripsPath,
+		"-nworkers", "2",
+		"-batch-size", "100",
+		"-sample-interval", "0",
+	))
+	checks = append(checks, smokeCheck{"insert succeeds", exitCodeError(code)})
+	if code != 0 {
+		return checks, code
+	}
+	insertStats, err := loadSmokeResults(resultsDir, "insert")
+	failedErr, insertedErr := err, err
+	if err == nil && insertStats.Failed > 0 {
+		failedErr = fmt.Errorf("%d of %d batches failed", insertStats.Failed, insertStats.Count)
+	}
+	if err == nil && insertStats.Operations != cfg.numEvents {
+		insertedErr = fmt.Errorf("inserted %d events, want %d", insertStats.Operations, cfg.numEvents)
+	}
+	checks = append(checks, smokeCheck{"no insert batch failed", failedErr}, smokeCheck{"all events inserted", insertedErr})
+
+	stored, err := countSmokeEvents(ctx, cfg)
+	if err == nil && stored != cfg.numEvents {
+		err = fmt.Errorf("escooter_events contains %d rows, want %d", stored, cfg.numEvents)
+	}
+	checks = append(checks, smokeCheck{"all events stored", err})
+	if err != nil && ctx.Err() != nil {
+		return checks, exitAborted
+	}
+
+	code = runChildCommand(ctx, executable, "query", append(common,
+		"-trips", cfg.tripsPath,
+		"-pois", cfg.poisPath,
+		"-localities", cfg.localitiesPath,
+		"-queries", cfg.queriesFilepath,
+		"-nworkers", "2",
+		"-nqueries", fmt.Sprint(cfg.numQueries),
+		"-sample-interval", "0",
+	))
+	checks = append(checks, smokeCheck{"query succeeds", exitCodeError(code)})
+	if code != 0 {
+		return checks, code
+	}
+	queryStats, err := loadSmokeResults(resultsDir, "query")
+	executedErr, failedErr := err, err
+	if err == nil && queryStats.Count != cfg.numQueries {
+		executedErr = fmt.Errorf("executed %d queries, want %d", queryStats.Count, cfg.numQueries)
+	}
+	if err == nil && queryStats.Failed > 0 {
+		failedErr = fmt.Errorf("%d of %d queries failed", queryStats.Failed, queryStats.Count)
+	}
+	checks = append(checks, smokeCheck{"all queries executed", executedErr}, smokeCheck{"no query failed", failedErr})
+	return checks, 0
+}
+
+// countSmokeEvents returns the number of stored events, CrateDB makes them visible only after a refresh
+func countSmokeEvents(ctx context.Context, cfg smokeConfig) (int, error) {
+	conn, err := pgx.Connect(ctx, cfg.connString)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close(context.Background())
+	table := cfg.prefix + "escooter_events"
+	if cfg.dbTarget == targets.CrateDB {
+		if _, err := conn.Exec(ctx, "REFRESH TABLE "+table); err != nil {
+			return 0, err
+		}
+	}
+	var count int
+	err = conn.QueryRow(ctx, "SELECT count(*) FROM "+table).Scan(&count)
+	return count, err
+}
+
+// loadSmokeResults returns the latency statistics of the single results CSV of the mode
+func loadSmokeResults(resultsDir, mode string) (results.LatencyStats, error) {
+	matches, err := filepath.Glob(filepath.Join(resultsDir, "results_"+mode+"_*.csv"))
+	if err != nil {
+		return results.LatencyStats{}, err
+	}
+	if len(matches) != 1 {
+		return results.LatencyStats{}, fmt.Errorf("expected one %s results CSV, found %d", mode, len(matches))
+	}
+	data, err := results.LoadCSV(matches[0])
+	if err != nil {
+		return results.LatencyStats{}, err
+	}
+	return results.ComputeLatencyStats(data.Rows), nil
+}
+
+func exitCodeError(code int) error {
+	if code == 0 {
+		return nil
+	}
+	return fmt.Errorf("exited with code %d", code)
+}
+
+// writeSmokeDataset writes three POIs, two localities in Berlin and numEvents events of straight trips through them
+func writeSmokeDataset(dir string, numEvents int) (poisPath, localitiesPath, tripsPath string, err error) {
+	poisPath = filepath.Join(dir, "pois.csv")
+	pois := "poi_id,name,category,longitude,latitude\n" +
+		"7d6c5c2e-4b4a-4e0c-9d44-8f1f0a0d6e01,Brandenburger Tor,attraction,13.377704,52.516275\n" +
+		"7d6c5c2e-4b4a-4e0c-9d44-8f1f0a0d6e02,Alexanderplatz,square,13.413215,52.521918\n" +
+		"7d6c5c2e-4b4a-4e0c-9d44-8f1f0a0d6e03,Tempelhofer Feld,park,13.401897,52.473716\n"
+	if err := os.WriteFile(poisPath, []byte(pois), 0666); err != nil {
+		return "", "", "", err
+	}
+
+	localitiesPath = filepath.Join(dir, "localities.geojson")
+	localities := `{"type": "FeatureCollection", "features": [
+{"type": "Feature", "properties": {"locality_id": "1", "name": "Mitte"},
+ "geometry": {"type": "Polygon", "coordinates": [[[13.35, 52.50], [13.43, 52.50], [13.43, 52.54], [13.35, 52.54], [13.35, 52.50]]]}},
+{"type": "Feature", "properties": {"locality_id": "2", "name": "Tempelhof"},
+ "geometry": {"type": "Polygon", "coordinates": [[[13.37, 52.45], [13.43, 52.45], [13.43, 52.49], [13.37, 52.49], [13.37, 52.45]]]}}
+]}`
+	if err := os.WriteFile(localitiesPath, []byte(localities), 0666); err != nil {
+		return "", "", "", err
+	}
+
+	tripsPath = filepath.Join(dir, "trips.csv")
+	var trips strings.Builder
+	trips.WriteString("event_id,trip_id,timestamp,latitude,longitude\n")
+	start := time.Date(2024, 6, 1, 8, 0, 0, 0, time.UTC)
+	for i := range numEvents {
+		trip, event := i/smokeEventsPerTrip, i%smokeEventsPerTrip
+		fmt.Fprintf(&trips, "00000000-0000-4000-9000-%012d,00000000-0000-4000-8000-%012d,%s,%.6f,%.6f\n",
+			i+1,
+			trip+1,
+			start.Add(time.Duration(trip)*time.Minute+time.Duration(event)*10*time.Second).Format(time.RFC3339),
+			52.47+float64(trip%8)*0.008+float64(event)*0.0005,
+			13.36+float64(trip%6)*0.01+float64(event)*0.0005,
+		)
+	}
+	if err := os.WriteFile(tripsPath, []byte(trips.String()), 0666); err != nil {
+		return "", "", "", err
+	}
+	return poisPath, localitiesPath, tripsPath, nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+
+	"load-generator/internal/workload"
+)
+
+func runSplitDataset(args []string) {
+	fs := newFlagSet("split-dataset", "Shard a trips CSV by trip_id into files with balanced event counts, keeping all events of a trip\nin one file in their order, so several load-generator hosts can insert a dataset together.")
+	tripsPath := fs.String("trips", "../escooter-trips-generator/output/escooter-trips-small.csv", "Path to the CSV file containing the escooter trip events to split")
+	shards := fs.Int("shards", 4, "Number of files to split the trips into")
+	outDir := fs.String("out-dir", "", "Directory to write <input>-shard<i>of<shards>.csv to, defaults to the directory of the input. Existing files are not overwritten")
+	datasetTZ := registerDatasetTZ(fs)
+	fs.Parse(args)
+
+	logger = slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	mustSetDatasetTZ(*datasetTZ)
+	ctx, stop := signalContext()
+	defer stop()
+
+	if *shards < 1 {
+		logger.Error("Invalid CLI argument", "argument", "shards", "error", "expected at least 1 shard")
+		os.Exit(exitConfig)
+	}
+	if *outDir == "" {
+		*outDir = path.Dir(*tripsPath)
+	}
+	base := strings.TrimSuffix(path.Base(*tripsPath), ".csv")
+
+	filenames := make([]string, *shards)
+	files := make([]*os.File, *shards)
+	writers := make([]io.Writer, *shards)
+	for i := range files {
+		filenames[i] = path.Join(*outDir, fmt.Sprintf("%s-shard%dof%d.csv", base, i+1, *shards))
+		f, err := createNewFile(filenames[i])
+		if err != nil {
+			logger.Error("Unable to create dataset file", "filename", filenames[i], "error", err)
+			os.Exit(exitConfig)
+		}
+		files[i], writers[i] = f, f
+	}
+
+	stats, err := workload.SplitTrips(ctx, *tripsPath, writers)
+	for i, f := range files {
+		if closeErr := f.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("Closing %s: %w", filenames[i], closeErr)
+		}
+	}
+	if err != nil {
+		logger.Error("Unable to split the trips", "filename", *tripsPath, "error", err)
+		os.Exit(exitFailure)
+	}
+	for i, s := range stats {
+		logger.Info("Wrote shard", "filename", filenames[i], "trips", s.Trips, "events", s.Events)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// keep packets below the typical MTU so they are not fragmented
+const statsdMaxPacketSize = 1432
+
+// StatsdClient emits metrics in the StatsD line protocol over UDP.
+// All methods are no-ops on a nil client, so callers don't have to check whether export is enabled.
+type StatsdClient struct {
+	conn   net.Conn
+	prefix string
+
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+var statsd *StatsdClient
+
+// NewStatsdClient connects to the StatsD daemon and flushes buffered metrics every flushInterval
+// until the context is done
+func NewStatsdClient(ctx context.Context, addr, prefix string, flushInterval time.Duration) (*StatsdClient, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("Connecting to statsd at %s: %w", addr, err)
+	}
+	c := &StatsdClient{conn: conn, prefix: strings.TrimSuffix(prefix, ".")}
+
+	go func() {
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.Flush()
+			}
+		}
+	}()
+	return c, nil
+}
+
+func (c *StatsdClient) Count(name string, value int64) {
+	c.send(name, fmt.Sprintf("%d|c", value))
+}
+
+func (c *StatsdClient) Gauge(name string, value float64) {
+	c.send(name, fmt.Sprintf("%g|g", value))
+}
+
+func (c *StatsdClient) Timing(name string, d time.Duration) {
+	c.send(name, fmt.Sprintf("%.3f|ms", float64(d.Microseconds())/1000))
+}
+
+func (c *StatsdClient) send(name, value string) {
+	if c == nil {
+		return
+	}
+	line := c.prefix + "." + name + ":" + value
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.buf.Len() > 0 && c.buf.Len()+1+len(line) > statsdMaxPacketSize {
+		c.flushLocked()
+	}
+	if c.buf.Len() > 0 {
+		c.buf.WriteByte('\n')
+	}
+	c.buf.WriteString(line)
+}
+
+func (c *StatsdClient) Flush() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.flushLocked()
+}
+
+func (c *StatsdClient) flushLocked() {
+	if c.buf.Len() == 0 {
+		return
+	}
+	if _, err := c.conn.Write([]byte(c.buf.String())); err != nil {
+		logger.Debug("Failed to send statsd packet", "error", err)
+	}
+	c.buf.Reset()
+}
+
+func (c *StatsdClient) Close() {
+	if c == nil {
+		return
+	}
+	c.Flush()
+	c.conn.Close()
+}
+
+// sanitizeStatsdName replaces characters with special meaning in the StatsD/Graphite naming scheme
+func sanitizeStatsdName(name string) string {
+	return strings.NewReplacer(".", "_", ":", "_", "|", "_", "@", "_", " ", "_").Replace(name)
+}
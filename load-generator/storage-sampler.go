@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"load-generator/internal/targets"
+)
+
+// Both queries return the size of the events table and the size of the write-ahead log
+// (translog for CrateDB, WAL position of the coordinator for MobilityDB/Citus) in bytes
+const cratedbStorageSql = `
+SELECT coalesce(sum(size), 0)::bigint AS table_bytes, coalesce(sum(translog_stats['size']), 0)::bigint AS log_bytes
+FROM sys.shards
+WHERE table_name = 'escooter_events' AND primary = true;`
+
+const mobilitydbStorageSql = `
+SELECT citus_total_relation_size('escooter_events')::bigint AS table_bytes,
+	pg_wal_lsn_diff(pg_current_wal_lsn(), '0/0')::bigint AS log_bytes;`
+
+type StorageSample struct {
+	Timestamp       string
+	TableBytes      int64
+	LogBytes        int64
+	TableBytesDelta int64
+	LogBytesDelta   int64
+}
+
+// startStorageSampler periodically samples the on-disk size of the events table and the
+// write-ahead log position during insert runs, so write amplification can be analyzed over time.
+// Returned function takes a final sample, stops the sampler and closes the file.
+func startStorageSampler(ctx context.Context, interval time.Duration, connString string, dbTarget targets.DBTarget, numWorkers int) func() {
+	if interval <= 0 {
+		return func() {}
+	}
+
+	conn, err := pgx.Connect(ctx, connString)
+	if err != nil {
+		logger.Error("Storage sampler was unable to connect to database", "error", err)
+		os.Exit(exitConnection)
+	}
+
+	file := createArtifactCSV("storage", "insert", dbTarget.String(), workersPart(numWorkers))
+	csvWriter := csv.NewWriter(file)
+
+	csvHeader := []string{"runId", "timestamp", "tableBytes", "logBytes", "tableBytesDelta", "logBytesDelta"}
+	if err := csvWriter.Write(csvHeader); err != nil {
+		logger.Error("Failed to write storage CSV header", "error", err)
+		os.Exit(exitFailure)
+	}
+
+	storageSql := cratedbStorageSql
+	switch dbTarget {
+	case targets.CrateDB:
+		storageSql = cratedbStorageSql
+	case targets.MobilityDB:
+		storageSql = mobilitydbStorageSql
+	}
+
+	sampler := &storageSampler{conn: conn, sql: targets.PrefixTables(storageSql), csvWriter: csvWriter}
+	// baseline before any events are inserted
+	sampler.sample(ctx, time.Now())
+
+	samplerCtx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-samplerCtx.Done():
+				return
+			case now := <-ticker.C:
+				sampler.sample(samplerCtx, now)
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		wg.Wait()
+		sampler.sample(context.Background(), time.Now())
+		csvWriter.Flush()
+		file.Close()
+		conn.Close(context.Background())
+	}
+}
+
+type storageSampler struct {
+	conn      *pgx.Conn
+	sql       string
+	csvWriter *csv.Writer
+	last      *StorageSample
+}
+
+func (s *storageSampler) sample(ctx context.Context, now time.Time) {
+	sample := StorageSample{Timestamp: now.Format(time.RFC3339)}
+	err := s.conn.QueryRow(ctx, s.sql).Scan(&sample.TableBytes, &sample.LogBytes)
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.Warn("Failed to sample storage size", "error", err)
+		}
+		return
+	}
+
+	if s.last != nil {
+		sample.TableBytesDelta = sample.TableBytes - s.last.TableBytes
+		sample.LogBytesDelta = sample.LogBytes - s.last.LogBytes
+	}
+	s.last = &sample
+
+	logger.Info("Storage size sampled",
+		"tableBytes", sample.TableBytes,
+		"logBytes", sample.LogBytes,
+		"tableBytesDelta", sample.TableBytesDelta,
+		"logBytesDelta", sample.LogBytesDelta,
+	)
+
+	record := []string{
+		runID,
+		sample.Timestamp,
+		fmt.Sprintf("%d", sample.TableBytes),
+		fmt.Sprintf("%d", sample.LogBytes),
+		fmt.Sprintf("%d", sample.TableBytesDelta),
+		fmt.Sprintf("%d", sample.LogBytesDelta),
+	}
+	if err := s.csvWriter.Write(record); err != nil {
+		logger.Error("Failed to write storage CSV record", "error", err)
+	}
+	s.csvWriter.Flush()
+}
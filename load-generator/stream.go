@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"load-generator/internal/targets"
+	"load-generator/internal/websocket"
+)
+
+// StreamUpdate is the message sent every second to the clients of -stream-addr,
+// aggregating the operations finished during the second
+type StreamUpdate struct {
+	RunID          string    `json:"runId"`
+	Mode           string    `json:"mode"`
+	DBTarget       string    `json:"dbTarget"`
+	Time           time.Time `json:"time"`
+	ElapsedSec     float64   `json:"elapsedSec"`
+	Operations     int       `json:"operations"` // batches for inserts, queries for queries
+	Succeeded      int       `json:"succeeded"`  // trip events for inserts, queries for queries
+	Failed         int       `json:"failed"`
+	MeanLatencyUs  float64   `json:"meanLatencyUs"`
+	P50LatencyUs   int64     `json:"p50LatencyUs"`
+	P99LatencyUs   int64     `json:"p99LatencyUs"`
+	MaxLatencyUs   int64     `json:"maxLatencyUs"`
+	TotalSucceeded int       `json:"totalSucceeded"`
+	TotalFailed    int       `json:"totalFailed"`
+	Final          bool      `json:"final,omitempty"` // last update of the run, the connection is closed afterwards
+}
+
+// LiveStream aggregates the finished operations per second and sends them to the connected WebSocket clients.
+// All methods are no-ops on a nil LiveStream.
+type LiveStream struct {
+	mode      string
+	dbTarget  targets.DBTarget
+	startTime time.Time
+
+	mu             sync.Mutex
+	durations      []int64 // of the operations of the current second in us
+	succeeded      int
+	failed         int
+	totalSucceeded int
+	totalFailed    int
+	clients        map[*websocket.Conn]struct{}
+}
+
+var liveStream *LiveStream
+
+// streamWriteTimeout drops clients not reading their updates
+const streamWriteTimeout = time.Second
+
+// startStreamServer serves the per-second aggregates of the run as WebSocket messages on addr, at any path.
+// Returned function sends the last aggregate and stops the server.
+func startStreamServer(ctx context.Context, addr string, mode string, dbTarget targets.DBTarget) func() {
+	if addr == "" {
+		return func() {}
+	}
+	liveStream = &LiveStream{mode: mode, dbTarget: dbTarget, startTime: time.Now(), clients: make(map[*websocket.Conn]struct{})}
+
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Upgrade(w, r)
+		if err != nil {
+			logger.Debug("Rejected stream client", "remoteAddr", r.RemoteAddr, "error", err)
+			return
+		}
+		logger.Info("Stream client connected", "remoteAddr", r.RemoteAddr)
+		liveStream.addClient(conn)
+	})}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		logger.Error("Unable to listen for stream clients", "addr", addr, "error", err)
+		os.Exit(exitConfig)
+	}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Stream server failed", "error", err)
+		}
+	}()
+	logger.Info("Streaming live results over WebSocket", "addr", listener.Addr().String())
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				liveStream.broadcast(now, false)
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+		liveStream.broadcast(time.Now(), true)
+		server.Close()
+	}
+}
+
+func (s *LiveStream) addClient(conn *websocket.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clients[conn] = struct{}{}
+}
+
+// Observe records an operation finished now, succeeded and failed count its trip events or queries
+func (s *LiveStream) Observe(duration time.Duration, succeeded, failed int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.durations = append(s.durations, duration.Microseconds())
+	s.succeeded += succeeded
+	s.failed += failed
+	s.totalSucceeded += succeeded
+	s.totalFailed += failed
+}
+
+// broadcast sends the aggregate of the operations since the last one to all clients, the final one closes their connections
+func (s *LiveStream) broadcast(now time.Time, final bool) {
+	s.mu.Lock()
+	update := StreamUpdate{
+		RunID:          runID,
+		Mode:           s.mode,
+		DBTarget:       s.dbTarget.String(),
+		Time:           now,
+		ElapsedSec:     now.Sub(s.startTime).Seconds(),
+		Operations:     len(s.durations),
+		Succeeded:      s.succeeded,
+		Failed:         s.failed,
+		TotalSucceeded: s.totalSucceeded,
+		TotalFailed:    s.totalFailed,
+		Final:          final,
+	}
+	durations := s.durations
+	s.durations, s.succeeded, s.failed = nil, 0, 0
+	clients := make([]*websocket.Conn, 0, len(s.clients))
+	for conn := range s.clients {
+		select {
+		case <-conn.Done():
+			delete(s.clients, conn)
+		default:
+			clients = append(clients, conn)
+		}
+	}
+	s.mu.Unlock()
+
+	if len(durations) > 0 {
+		slices.Sort(durations)
+		var sum int64
+		for _, d := range durations {
+			sum += d
+		}
+		update.MeanLatencyUs = float64(sum) / float64(len(durations))
+		update.P50LatencyUs = durations[(len(durations)-1)/2]
+		update.P99LatencyUs = durations[(len(durations)*99-1)/100]
+		update.MaxLatencyUs = durations[len(durations)-1]
+	}
+	msg, _ := json.Marshal(update)
+	for _, conn := range clients {
+		err := conn.WriteText(msg, streamWriteTimeout)
+		if err != nil || final {
+			conn.Close()
+		}
+		if err != nil {
+			logger.Debug("Dropped stream client", "error", err)
+			s.mu.Lock()
+			delete(s.clients, conn)
+			s.mu.Unlock()
+		}
+	}
+}
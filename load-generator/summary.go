@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+// RunSummary contains the aggregated outcome of a benchmark run
+type RunSummary struct {
+	RunID           string                `json:"runId"`
+	Mode            string                `json:"mode"`
+	DBTarget        string                `json:"dbTarget"`
+	NumWorkers      int                   `json:"numWorkers"`
+	StartTime       time.Time             `json:"startTime"`
+	EndTime         time.Time             `json:"endTime"`
+	DurationSec     float64               `json:"durationSec"`
+	WallClockStepMs float64               `json:"wallClockStepMs,omitempty"` // adjustment of the wall clock during the run, e.g. by NTP, durations and latencies use the monotonic clock
+	TotalOperations int                   `json:"totalOperations"`           // trip events read for inserts, queries scheduled for queries
+	TotalSuccesses  int                   `json:"totalSuccesses"`
+	TotalFailures   int                   `json:"totalFailures"`
+	Aborted         bool                  `json:"aborted"` // interrupted before all jobs were scheduled, totals are partial
+	AbortReason     string                `json:"abortReason,omitempty"`
+	Faults          []FaultReport         `json:"faults,omitempty"`         // faults injected with -chaos
+	Failovers       []FailoverReport      `json:"failovers,omitempty"`      // workers failing over to endpoints of -db-standby
+	Tenants         []TenantReport        `json:"tenants,omitempty"`        // latency per tenant of -tenants
+	Reconciliation  *ReconciliationReport `json:"reconciliation,omitempty"` // events stored per trip compared with the trips file, with -reconcile
+	TripIntegrity   *TripIntegrityReport  `json:"tripIntegrity,omitempty"`  // trips table compared with the stored events, with -check-trips
+	Duplicates      *DuplicateReport      `json:"duplicates,omitempty"`     // event IDs stored more than once, with -check-duplicates
+	BadRows         *BadRowReport         `json:"badRows,omitempty"`        // malformed rows of the trips file skipped with -on-bad-row
+	Fairness        *FairnessReport       `json:"fairness,omitempty"`       // operations and latency per worker of insert and query
+	Artifacts       []string              `json:"artifacts"`
+}
+
+// files produced by the current run, e.g. for uploading them once the run finishes
+var (
+	runArtifacts   []string
+	runArtifactsMu sync.Mutex
+)
+
+func registerArtifact(filename string) {
+	runArtifactsMu.Lock()
+	defer runArtifactsMu.Unlock()
+	runArtifacts = append(runArtifacts, filename)
+}
+
+func listArtifacts() []string {
+	runArtifactsMu.Lock()
+	defer runArtifactsMu.Unlock()
+	return append([]string(nil), runArtifacts...)
+}
+
+func writeSummaryJSON(summary RunSummary) string {
+	timestamp := time.Now().Format("20060102_150405")
+
+	filename := fmt.Sprintf("summary_%s_%s_%dw_%s_%s.json",
+		summary.Mode, summary.DBTarget, summary.NumWorkers, timestamp, runID)
+	filename = path.Join(resultsDir, filename)
+
+	summary.RunID = runID
+	summary.Artifacts = listArtifacts()
+	b, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		logger.Error("Failed to encode run summary", "error", err)
+		os.Exit(exitFailure)
+	}
+	if err := writeNewFile(filename, b); err != nil {
+		logger.Error("Failed to write run summary", "filename", filename, "error", err)
+		os.Exit(exitFailure)
+	}
+
+	registerArtifact(filename)
+	logger.Info("Wrote run summary", "filename", filename)
+	return filename
+}
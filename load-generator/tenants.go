@@ -0,0 +1,155 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"load-generator/internal/targets"
+	"load-generator/internal/workload"
+)
+
+// TenantReport is the load and latency of one tenant of -tenants, comparing them shows the impact of noisy neighbors
+type TenantReport struct {
+	Tenant        int     `json:"tenant"`
+	Share         float64 `json:"share"`      // configured fraction of the trips and queries
+	Operations    int     `json:"operations"` // batches for inserts, queries for queries
+	Failures      int     `json:"failures"`
+	MeanLatencyUs float64 `json:"meanLatencyUs"`
+	P99LatencyUs  int64   `json:"p99LatencyUs"`
+}
+
+// tenantOptions are the flags of init, insert, query and cleanup spreading the data and the load across tenants
+type tenantOptions struct {
+	tenants int
+	skew    float64
+}
+
+func (o *tenantOptions) register(fs *flag.FlagSet) {
+	fs.IntVar(&o.tenants, "tenants", 0, "Number of tenants sharing the database, 0 disables. On cratedb every tenant gets the tables in its own schema tenant_<n>,\n"+
+		"on mobilitydbc the tenants share the tables of -schema-variant tenants with the column tenant_id, e.g. with -queries ./schemas/mobilitydbc-tenant-read-queries.tmpl.\n"+
+		"Every trip and query belongs to one tenant, the results CSV gets the column tenant and the summary the latency per tenant")
+	fs.Float64Var(&o.skew, "tenant-skew", 0, "Skew of the trips and queries across the tenants, tenant n gets a share proportional to 1/n^skew, 0 spreads them evenly, e.g. 1.5 makes tenant 1 a noisy neighbor")
+}
+
+// Tenancy assigns trips and queries to tenants and aggregates the latency per tenant.
+// All methods are no-ops on a nil Tenancy.
+type Tenancy struct {
+	dbTarget     targets.DBTarget
+	distribution *workload.TenantDistribution
+
+	mu        sync.Mutex
+	durations [][]int64 // durations of the successful operations per tenant in us
+	failures  []int
+}
+
+var tenancy *Tenancy
+
+// mustLoad validates the tenant flags, nil without -tenants
+func (o *tenantOptions) mustLoad(dbTarget targets.DBTarget, schemaVariant string) *Tenancy {
+	if o.tenants < 0 || o.skew < 0 {
+		logger.Error("Invalid CLI argument", "argument", "tenants", "error", "-tenants and -tenant-skew must not be negative")
+		os.Exit(exitConfig)
+	}
+	if o.tenants == 0 {
+		return nil
+	}
+	if dbTarget == targets.MobilityDB && schemaVariant != targets.TenantSchemaVariant {
+		logger.Error("Invalid CLI argument", "argument", "tenants", "error", "mobilitydbc separates the tenants by the column tenant_id of -schema-variant "+targets.TenantSchemaVariant)
+		os.Exit(exitConfig)
+	}
+	logger.Info("Spreading the workload across tenants", "tenants", o.tenants, "skew", o.skew)
+	return &Tenancy{
+		dbTarget:     dbTarget,
+		distribution: workload.NewTenantDistribution(o.tenants, o.skew),
+		durations:    make([][]int64, o.tenants),
+		failures:     make([]int, o.tenants),
+	}
+}
+
+// SchemaTenants returns the tenants with tables of their own, init and cleanup run the migrations once for each of them.
+// Tenant 0 are the unqualified tables of MobilityDB and of runs without tenants.
+func (t *Tenancy) SchemaTenants() []int {
+	if t == nil || t.dbTarget != targets.CrateDB {
+		return []int{0}
+	}
+	tenants := make([]int, t.distribution.Tenants())
+	for i := range tenants {
+		tenants[i] = i + 1
+	}
+	return tenants
+}
+
+// TripTenant returns the tenant of the trip, 0 without tenants
+func (t *Tenancy) TripTenant(tripID string) int {
+	if t == nil {
+		return 0
+	}
+	return t.distribution.TripTenant(tripID)
+}
+
+// PrefixTables returns the query of a rendered template with the tables of the tenant
+func (t *Tenancy) PrefixTables(tenant int, sql string) string {
+	if t == nil {
+		return targets.PrefixTables(sql)
+	}
+	return targets.TenantTables(t.dbTarget, tenant, sql)
+}
+
+// Observe records the outcome of an operation of the tenant, a batch or a query
+func (t *Tenancy) Observe(tenant int, duration time.Duration, succeeded bool) {
+	if t == nil || tenant == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if succeeded {
+		t.durations[tenant-1] = append(t.durations[tenant-1], duration.Microseconds())
+	} else {
+		t.failures[tenant-1]++
+	}
+}
+
+// CSVHeader returns the header of a results CSV with the tenant column
+func (t *Tenancy) CSVHeader(header []string) []string {
+	if t == nil {
+		return header
+	}
+	return append(header[:len(header):len(header)], "tenant")
+}
+
+// CSVRecord returns the record with the tenant of its operation
+func (t *Tenancy) CSVRecord(record []string, tenant int) []string {
+	if t == nil {
+		return record
+	}
+	return append(record, strconv.Itoa(tenant))
+}
+
+// Report returns the latency per tenant, nil without tenants
+func (t *Tenancy) Report() []TenantReport {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	reports := make([]TenantReport, len(t.durations))
+	for i, durations := range t.durations {
+		r := TenantReport{Tenant: i + 1, Share: t.distribution.Share(i + 1), Operations: len(durations) + t.failures[i], Failures: t.failures[i]}
+		if len(durations) > 0 {
+			sorted := slices.Clone(durations)
+			slices.Sort(sorted)
+			var sum int64
+			for _, d := range sorted {
+				sum += d
+			}
+			r.MeanLatencyUs = float64(sum) / float64(len(sorted))
+			r.P99LatencyUs = sorted[(len(sorted)*99-1)/100]
+		}
+		reports[i] = r
+	}
+	return reports
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+
+	"load-generator/internal/kafka"
+	"load-generator/internal/workload"
+)
+
+// openTripSource opens the trip events file with the event attributes, or the Kafka topic of a kafka://broker:port/topic source.
+// The rows of the file are validated strictly, malformed ones are handled by -on-bad-row.
+func openTripSource(ctx context.Context, source string, attributes []workload.EventAttribute) (workload.TripEventSource, error) {
+	if !isKafkaSource(source) {
+		r, err := workload.OpenTripEventsWithAttributes(source, attributes)
+		if err != nil {
+			return nil, err
+		}
+		r.Strict()
+		return r, nil
+	}
+	broker, topic, query, err := parseKafkaURL(source)
+	if err != nil {
+		return nil, err
+	}
+	follow := query.Get("follow") == "true"
+	consumer, err := kafka.NewConsumer(ctx, broker, topic, follow)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Consuming trip events from Kafka", "broker", broker, "topic", topic, "partitions", consumer.Partitions(), "follow", follow, "records", consumer.Lag())
+	return &kafkaTripSource{ctx: ctx, consumer: consumer}, nil
+}
+
+// parseKafkaURL splits kafka://broker[:port]/topic[?options] into the broker address, the topic and the options
+func parseKafkaURL(raw string) (string, string, url.Values, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("Parsing Kafka URL: %w", err)
+	}
+	topic := strings.Trim(u.Path, "/")
+	if u.Scheme != "kafka" || u.Host == "" || topic == "" {
+		return "", "", nil, fmt.Errorf("Kafka URL must be in the form kafka://broker:port/topic, got %q", raw)
+	}
+	broker := u.Host
+	if u.Port() == "" {
+		broker = net.JoinHostPort(u.Hostname(), "9092")
+	}
+	return broker, topic, u.Query(), nil
+}
+
+func isKafkaSource(source string) bool {
+	return strings.HasPrefix(source, "kafka://")
+}
+
+// kafkaTripSource decodes the JSON or CSV encoded trip events of the records of a topic
+type kafkaTripSource struct {
+	ctx      context.Context
+	consumer *kafka.Consumer
+}
+
+func (s *kafkaTripSource) Next() (workload.TripEvent, error) {
+	for {
+		value, err := s.consumer.Next(s.ctx)
+		// following a topic ends with the run, like reaching the end of a file
+		if err == io.EOF || s.ctx.Err() != nil {
+			return workload.TripEvent{}, io.EOF
+		} else if err != nil {
+			return workload.TripEvent{}, fmt.Errorf("Consuming trip events: %w", err)
+		}
+		event, err := workload.ParseTripEventMessage(value)
+		if err != nil {
+			return workload.TripEvent{}, err
+		}
+		// producers replaying the CSV file may send its header as well
+		if event.EventID == "event_id" {
+			continue
+		}
+		return event, nil
+	}
+}
+
+func (s *kafkaTripSource) Close() error {
+	return s.consumer.Close()
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/jackc/pgx/v5"
+
+	"load-generator/internal/targets"
+)
+
+func runVerifySchema(args []string) {
+	fs := newFlagSet("verify-schema", "Compare the tables and columns of the database with the ones the migrations of the target and schema variant create\nand fail with a report of the differences.")
+	var common commonOptions
+	common.register(fs)
+	migrationsDir := fs.String("migrations", "./migrations", "Directory containing migration files")
+	fs.Parse(args)
+
+	ctx, stop := signalContext()
+	defer stop()
+	common.setup("verify-schema", 0)
+	defer common.close()
+
+	opts := targets.InitOptions{MigrationsDir: *migrationsDir, SchemaVariant: common.schemaVariant}
+	expected, err := targets.ExpectedSchema(opts)
+	if err != nil {
+		logger.Error("Unable to read the expected schema from the migrations", "error", err)
+		os.Exit(exitConfig)
+	}
+	if common.dryRun {
+		fmt.Printf("Dry run of verify-schema against %s, nothing is executed\n\nExpected tables:\n", common.dbTarget)
+		for _, table := range slices.Sorted(maps.Keys(expected)) {
+			fmt.Printf("  %s\n", table)
+			for _, column := range slices.Sorted(maps.Keys(expected[table])) {
+				fmt.Printf("    %s %s\n", column, expected[table][column])
+			}
+		}
+		return
+	}
+
+	conn, err := pgx.Connect(ctx, common.connString)
+	if err != nil {
+		logger.Error("Unable to connect to database", "error", err)
+		os.Exit(exitConnection)
+	}
+	defer conn.Close(context.Background())
+
+	live, err := targets.LiveSchema(ctx, conn, common.dbTarget)
+	if err != nil {
+		logger.Error("Unable to read the schema of the database", "error", err)
+		os.Exit(exitFailure)
+	}
+
+	diffs := targets.DiffSchemas(expected, live)
+	if len(diffs) == 0 {
+		logger.Info("Schema matches the migrations", "dbTarget", common.dbTarget.String(), "schemaVariant", common.schemaVariant, "tables", len(expected))
+		return
+	}
+	fmt.Printf("Schema of %s differs from the migrations in %s:\n", common.dbTarget, targets.VariantDir(*migrationsDir, common.schemaVariant))
+	for _, diff := range diffs {
+		fmt.Printf("  %s\n", diff)
+	}
+	logger.Error("Schema differs from the migrations", "differences", len(diffs))
+	os.Exit(exitValidation)
+}